@@ -0,0 +1,207 @@
+// Package adminui renders the admin pages for browsers: the users, the
+// audit log and the job queues, for staff signed in with a session cookie.
+package adminui
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"io/fs"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/audit"
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/outbox"
+	"github.com/jalal-akbar/belajar-golang-fiber/routing"
+	"github.com/jalal-akbar/belajar-golang-fiber/users"
+	"github.com/jalal-akbar/belajar-golang-fiber/views"
+)
+
+// Prefix is where the pages are.
+const Prefix = "/admin/pages"
+
+const pageSize = 50
+
+//go:embed templates
+var templates embed.FS
+
+type queue struct {
+	name    string
+	backlog func(context.Context) (outbox.Backlog, error)
+}
+
+// Pages renders the admin pages. Each takes the permission of the
+// matching admin endpoints: users:read, audit:read and jobs:read.
+type Pages struct {
+	users  *users.Users
+	audit  *audit.Log
+	tokens *auth.Tokens
+	views  *views.Engine
+	now    func() time.Time
+	queues []queue
+}
+
+// New renders pages that link to their stylesheet through asset, the URL
+// of a static file.
+func New(accounts *users.Users, log *audit.Log, tokens *auth.Tokens, asset func(string) (string, error)) *Pages {
+	files, _ := fs.Sub(templates, "templates")
+	engine := views.New(files, "*.html").
+		AddFunc("asset", asset).
+		AddFunc("join", strings.Join)
+	return &Pages{users: accounts, audit: log, tokens: tokens, views: engine, now: clock.System.Now}
+}
+
+// AddQueue lists a job queue on the jobs page, with what backlog reports.
+func (p *Pages) AddQueue(name string, backlog func(context.Context) (outbox.Backlog, error)) {
+	p.queues = append(p.queues, queue{name: name, backlog: backlog})
+}
+
+// Routes declares the pages, relative to Prefix. The router must
+// authenticate the request's user, as with auth.Tokens.CookieMiddleware.
+func (p *Pages) Routes() []routing.Route {
+	return []routing.Route{
+		{Method: fiber.MethodGet, Path: "/", Handler: func(c *fiber.Ctx) error {
+			return c.Redirect(Prefix+"/users", fiber.StatusFound)
+		}},
+		{Method: fiber.MethodGet, Path: "/users", Name: "admin.pages.users", Handler: p.usersPage,
+			Middlewares: []fiber.Handler{p.users.RequirePermission("users:read")}},
+		{Method: fiber.MethodGet, Path: "/audit", Name: "admin.pages.audit", Handler: p.auditPage,
+			Middlewares: []fiber.Handler{p.users.RequirePermission("audit:read")}},
+		{Method: fiber.MethodGet, Path: "/jobs", Name: "admin.pages.jobs", Handler: p.jobsPage,
+			Middlewares: []fiber.Handler{p.users.RequirePermission("jobs:read")}},
+		{Method: fiber.MethodPost, Path: "/logout", Name: "admin.pages.logout", Handler: p.logout},
+	}
+}
+
+func (p *Pages) usersPage(c *fiber.Ctx) error {
+	filter := users.Filter{Query: c.Query("q"), Role: c.Query("role"), Status: c.Query("status")}
+	if filter.Status != "active" && filter.Status != "disabled" {
+		filter.Status = ""
+	}
+	page := pageNumber(c)
+	filter.Offset, filter.Limit = (page-1)*pageSize, pageSize
+	list, total, err := p.users.List(c.UserContext(), filter)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"q": {filter.Query}, "role": {filter.Role}, "status": {filter.Status}}
+	return p.render(c, "users.html", fiber.Map{
+		"Title":  "Users",
+		"Query":  filter.Query,
+		"Role":   filter.Role,
+		"Status": filter.Status,
+		"Users":  list,
+		"Pager":  newPager(c.Path(), query, page, len(list), total),
+	})
+}
+
+func (p *Pages) auditPage(c *fiber.Ctx) error {
+	actor, action := c.Query("actor"), c.Query("action")
+	var matches []audit.Entry
+	for _, entry := range p.audit.List() {
+		if actor != "" && entry.Actor != actor || !strings.HasPrefix(entry.Action, action) {
+			continue
+		}
+		matches = append(matches, entry)
+	}
+	page := pageNumber(c)
+	shown := matches[min((page-1)*pageSize, len(matches)):min(page*pageSize, len(matches))]
+	query := url.Values{"actor": {actor}, "action": {action}}
+	return p.render(c, "audit.html", fiber.Map{
+		"Title":   "Audit log",
+		"Actor":   actor,
+		"Action":  action,
+		"Entries": shown,
+		"Pager":   newPager(c.Path(), query, page, len(shown), len(matches)),
+	})
+}
+
+func (p *Pages) jobsPage(c *fiber.Ctx) error {
+	type status struct {
+		Name    string
+		Pending int
+		Oldest  time.Time
+		Age     time.Duration
+		Error   string
+	}
+	queues := make([]status, 0, len(p.queues))
+	for _, q := range p.queues {
+		backlog, err := q.backlog(c.UserContext())
+		listed := status{Name: q.name, Pending: backlog.Pending, Oldest: backlog.Oldest}
+		if err != nil {
+			listed.Error = err.Error()
+		} else if backlog.Pending > 0 {
+			listed.Age = p.now().Sub(backlog.Oldest).Round(time.Second)
+		}
+		queues = append(queues, listed)
+	}
+	return p.render(c, "jobs.html", fiber.Map{"Title": "Jobs", "Queues": queues})
+}
+
+// logout ends the session of the cookie, not only the cookie.
+func (p *Pages) logout(c *fiber.Ctx) error {
+	if claims := auth.ClaimsFrom(c); claims != nil && claims.SessionID != "" {
+		if _, err := p.tokens.Sessions().Revoke(c.UserContext(), ctxutil.CurrentUser(c), claims.SessionID); err != nil {
+			return err
+		}
+	}
+	c.ClearCookie(auth.SessionCookie)
+	return c.Redirect("/", fiber.StatusSeeOther)
+}
+
+// render writes the page whole, so a template that fails halfway leaves
+// the error page rather than half a page.
+func (p *Pages) render(c *fiber.Ctx, name string, data fiber.Map) error {
+	data["User"] = ctxutil.CurrentUser(c)
+	data["Location"] = ctxutil.Location(c)
+	var page bytes.Buffer
+	if err := p.views.Render(&page, name, data); err != nil {
+		return err
+	}
+	// The pages show other users' data; they aren't kept anywhere.
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Type("html", "utf-8")
+	return c.Send(page.Bytes())
+}
+
+func pageNumber(c *fiber.Ctx) int {
+	return max(c.QueryInt("page", 1), 1)
+}
+
+// pager links the pages of a list of total items with shown on this one.
+type pager struct {
+	Total, First, Last int
+	Previous, Next     string
+}
+
+func newPager(path string, query url.Values, page, shown, total int) pager {
+	link := func(page int) string {
+		linked := url.Values{}
+		for name, values := range query {
+			if values[0] != "" {
+				linked[name] = values
+			}
+		}
+		if page > 1 {
+			linked.Set("page", strconv.Itoa(page))
+		}
+		if len(linked) == 0 {
+			return path
+		}
+		return path + "?" + linked.Encode()
+	}
+	p := pager{Total: total, First: (page-1)*pageSize + 1, Last: (page-1)*pageSize + shown}
+	if page > 1 {
+		p.Previous = link(min(page-1, (total+pageSize-1)/pageSize))
+	}
+	if page*pageSize < total {
+		p.Next = link(page + 1)
+	}
+	return p
+}
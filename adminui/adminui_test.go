@@ -0,0 +1,130 @@
+package adminui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/audit"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/outbox"
+	"github.com/jalal-akbar/belajar-golang-fiber/routing"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/jalal-akbar/belajar-golang-fiber/users"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPages(t *testing.T) (*fiber.App, *Pages, *audit.Log) {
+	accounts := users.New(config.RBACConfig{
+		Roles:  config.Default().RBAC.Roles,
+		Admins: []string{"root"},
+	}, testkit.OpenDB(t, users.Migrations...))
+	assert.Nil(t, accounts.GrantAdmins(context.Background()))
+	log := audit.New(slog.New(slog.NewTextHandler(io.Discard, nil)), 100)
+	pages := New(accounts, log, nil, func(name string) (string, error) { return "/static/" + name, nil })
+	app := fiber.New()
+	// FakeAuth stands in for the session cookie.
+	routing.Register(app.Group(Prefix, testkit.FakeAuth, accounts.Middleware()), pages.Routes())
+	return app, pages, log
+}
+
+func get(t *testing.T, app *fiber.App, user, path string) (int, string) {
+	request := httptest.NewRequest("GET", path, nil)
+	request.Header.Set(testkit.HeaderUser, user)
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	return response.StatusCode, string(body)
+}
+
+func TestUsersPage(t *testing.T) {
+	app, _, _ := newPages(t)
+	for i := 1; i <= 60; i++ {
+		get(t, app, fmt.Sprintf("user-%02d", i), Prefix+"/jobs")
+	}
+	get(t, app, "<script>alert(1)</script>", Prefix+"/jobs")
+
+	status, page := get(t, app, "root", Prefix+"/users")
+	assert.Equal(t, 200, status)
+	assert.Contains(t, page, `<link rel="stylesheet" href="/static/app.css">`)
+	assert.Contains(t, page, "Signed in as root")
+	assert.Contains(t, page, "<td>user-01</td>")
+	assert.Contains(t, page, "1–50 of 62")
+	assert.Contains(t, page, `href="/admin/pages/users?page=2" rel="next"`)
+	assert.NotContains(t, page, `rel="prev"`)
+
+	_, page = get(t, app, "root", Prefix+"/users?page=2")
+	assert.Contains(t, page, "51–62 of 62")
+	assert.Contains(t, page, "&lt;script&gt;alert(1)&lt;/script&gt;")
+	assert.NotContains(t, page, "<script>")
+	assert.Contains(t, page, `href="/admin/pages/users" rel="prev"`)
+
+	_, page = get(t, app, "root", Prefix+"/users?q=user-0&status=active")
+	assert.Contains(t, page, "1–9 of 9")
+	assert.Contains(t, page, `<option value="active" selected>`)
+
+	_, page = get(t, app, "root", Prefix+"/users?role=admin")
+	assert.Contains(t, page, "<td>root</td>")
+	assert.Contains(t, page, "1–1 of 1")
+
+	status, _ = get(t, app, "user-01", Prefix+"/users")
+	assert.Equal(t, 403, status)
+}
+
+func TestAuditPage(t *testing.T) {
+	app, _, log := newPages(t)
+	ctx := context.Background()
+	log.Add(ctx, audit.Entry{Actor: "root", Action: "user.disable", Target: "bob", Details: map[string]string{"sessions_revoked": "2"}})
+	log.Add(ctx, audit.Entry{Actor: "root", Action: "impersonation.request", Target: "carol"})
+	log.Add(ctx, audit.Entry{Actor: "dave", Action: "user.roles", Target: "erin"})
+
+	status, page := get(t, app, "root", Prefix+"/audit")
+	assert.Equal(t, 200, status)
+	assert.Contains(t, page, "1–3 of 3")
+	assert.Contains(t, page, "sessions_revoked=2")
+
+	_, page = get(t, app, "root", Prefix+"/audit?actor=root&action=user.")
+	assert.Contains(t, page, "1–1 of 1")
+	assert.Contains(t, page, "<td>bob</td>")
+	assert.NotContains(t, page, "<td>carol</td>")
+	assert.Contains(t, page, `value="user."`)
+}
+
+func TestJobsPage(t *testing.T) {
+	app, pages, _ := newPages(t)
+	at := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	pages.now = func() time.Time { return at.Add(90 * time.Second) }
+
+	_, page := get(t, app, "root", Prefix+"/jobs")
+	assert.Contains(t, page, "No queues are configured.")
+
+	pages.AddQueue("outbox", func(context.Context) (outbox.Backlog, error) {
+		return outbox.Backlog{Pending: 3, Oldest: at}, nil
+	})
+	pages.AddQueue("mail", func(context.Context) (outbox.Backlog, error) {
+		return outbox.Backlog{}, errors.New("database is down")
+	})
+	status, page := get(t, app, "root", Prefix+"/jobs")
+	assert.Equal(t, 200, status)
+	assert.Contains(t, page, "<td>3</td>")
+	assert.Contains(t, page, "2026-05-01 10:00:00 UTC")
+	assert.Contains(t, page, "1m30s ago")
+	assert.Contains(t, page, "unavailable: database is down")
+}
+
+func TestLogout(t *testing.T) {
+	app, _, _ := newPages(t)
+	request := httptest.NewRequest("POST", Prefix+"/logout", nil)
+	request.Header.Set(testkit.HeaderUser, "root")
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 303, response.StatusCode)
+	assert.Contains(t, response.Header.Get("Set-Cookie"), "session=;")
+}
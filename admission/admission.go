@@ -0,0 +1,162 @@
+// Package admission limits how many requests are handled at once, letting
+// priority requests ahead of the others when the server is saturated.
+package admission
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+)
+
+// The classes of requests.
+const (
+	Priority = "priority"
+	Normal   = "normal"
+)
+
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// Limiter hands out the slots requests are handled in. Waiting requests
+// get them first come, first served within their class, priority ones
+// before normal ones.
+type Limiter struct {
+	max      int
+	reserved int
+	timeout  time.Duration
+	routes   []string
+	operator func(*fiber.Ctx) bool
+
+	mu       sync.Mutex
+	inFlight int
+	queues   map[string][]*waiter
+
+	waiting  *metrics.GaugeVec
+	rejected *metrics.CounterVec
+}
+
+// New limits requests as cfg says. Besides those under the priority
+// routes, the requests operator reports true for are priority requests.
+// Waiting requests are measured in http_admission_waiting and those that
+// waited in vain are counted in http_admission_rejected_total.
+func New(cfg config.AdmissionConfig, operator func(*fiber.Ctx) bool, registry *metrics.Registry) *Limiter {
+	return &Limiter{
+		max:      cfg.MaxInFlight,
+		reserved: cfg.Reserved,
+		timeout:  cfg.QueueTimeout,
+		routes:   cfg.PriorityRoutes,
+		operator: operator,
+		queues:   map[string][]*waiter{},
+		waiting:  registry.Gauge("http_admission_waiting", "Requests waiting for their turn to be handled.", "class"),
+		rejected: registry.Counter("http_admission_rejected_total", "Requests rejected because the server was busy.", "class"),
+	}
+}
+
+// Class tells whether the request is a priority request.
+func (l *Limiter) Class(c *fiber.Ctx) string {
+	for _, prefix := range l.routes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if c.Path() == prefix || strings.HasPrefix(c.Path(), prefix+"/") {
+			return Priority
+		}
+	}
+	if l.operator != nil && l.operator(c) {
+		return Priority
+	}
+	return Normal
+}
+
+// limit is how many requests may be in flight when one of class starts.
+func (l *Limiter) limit(class string) int {
+	if class == Priority {
+		return l.max
+	}
+	return l.max - l.reserved
+}
+
+// acquire takes a slot for a request of class, waiting up to the queue
+// timeout for one. It reports whether it got one.
+func (l *Limiter) acquire(class string) bool {
+	l.mu.Lock()
+	if l.inFlight < l.limit(class) && len(l.queues[Priority]) == 0 && (class == Priority || len(l.queues[Normal]) == 0) {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+	w := &waiter{ready: make(chan struct{})}
+	l.queues[class] = append(l.queues[class], w)
+	l.mu.Unlock()
+
+	waiting := l.waiting.With(class)
+	waiting.Inc()
+	defer waiting.Dec()
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		return true
+	case <-timer.C:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// The slot may have been handed over just as the time ran out.
+	if w.granted {
+		return true
+	}
+	queue := l.queues[class]
+	for i := range queue {
+		if queue[i] == w {
+			l.queues[class] = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+	return false
+}
+
+// release frees a slot, handing it to the next waiting request if its
+// class may have it.
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	for _, class := range []string{Priority, Normal} {
+		queue := l.queues[class]
+		if len(queue) == 0 {
+			continue
+		}
+		if l.inFlight < l.limit(class) {
+			w := queue[0]
+			l.queues[class] = queue[1:]
+			l.inFlight++
+			w.granted = true
+			close(w.ready)
+		}
+		// Normal requests don't pass waiting priority ones.
+		return
+	}
+}
+
+// Middleware only lets requests through that get a slot, answering 503
+// with Retry-After to the others. Without a limit it does nothing.
+func (l *Limiter) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if l.max <= 0 {
+			return c.Next()
+		}
+		class := l.Class(c)
+		if !l.acquire(class) {
+			l.rejected.With(class).Inc()
+			c.Set(fiber.HeaderRetryAfter, "1")
+			return fiber.NewError(fiber.StatusServiceUnavailable, "server busy")
+		}
+		defer l.release()
+		return c.Next()
+	}
+}
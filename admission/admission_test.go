@@ -0,0 +1,118 @@
+package admission
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingApp holds the requests to /slow until release is closed.
+func blockingApp(limiter *Limiter, release chan struct{}) *fiber.App {
+	app := fiber.New()
+	app.Use(limiter.Middleware())
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		<-release
+		return c.SendString("slow")
+	})
+	app.Get("/*", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	return app
+}
+
+// start sends a request to /slow in the background, sending its status to
+// statuses once it is answered.
+func start(t *testing.T, app *fiber.App, wg *sync.WaitGroup, statuses chan<- int) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		response, err := app.Test(httptest.NewRequest("GET", "/slow", nil), -1)
+		if assert.Nil(t, err) {
+			statuses <- response.StatusCode
+		}
+	}()
+}
+
+func inFlight(l *Limiter) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+func TestPriorityRequestsUseTheReserve(t *testing.T) {
+	registry := metrics.NewRegistry()
+	limiter := New(config.AdmissionConfig{
+		MaxInFlight:    3,
+		Reserved:       1,
+		QueueTimeout:   50 * time.Millisecond,
+		PriorityRoutes: []string{"/healthz"},
+	}, func(c *fiber.Ctx) bool { return c.Get("X-Operator") != "" }, registry)
+	release := make(chan struct{})
+	app := blockingApp(limiter, release)
+
+	var wg sync.WaitGroup
+	statuses := make(chan int, 2)
+	start(t, app, &wg, statuses)
+	start(t, app, &wg, statuses)
+	assert.Eventually(t, func() bool { return inFlight(limiter) == 2 }, time.Second, time.Millisecond)
+
+	// The last slot is kept for priority requests.
+	response := testkit.Do(t, app, "GET", "/orders", nil).AssertStatus(503)
+	assert.Equal(t, "1", response.Header.Get("Retry-After"))
+	testkit.Do(t, app, "GET", "/healthz", nil).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/orders", nil, testkit.WithHeader("X-Operator", "yes")).AssertStatus(200)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 200, <-statuses)
+	assert.Equal(t, 200, <-statuses)
+	assert.Equal(t, 0, inFlight(limiter))
+	testkit.Do(t, app, "GET", "/orders", nil).AssertStatus(200)
+
+	output := new(strings.Builder)
+	registry.Write(output)
+	assert.Contains(t, output.String(), `http_admission_rejected_total{class="normal"} 1`)
+}
+
+func TestPriorityRequestsGoFirst(t *testing.T) {
+	limiter := New(config.AdmissionConfig{MaxInFlight: 1, QueueTimeout: time.Second}, nil, metrics.NewRegistry())
+	limiter.inFlight = 1
+
+	order := make(chan string, 2)
+	var wg sync.WaitGroup
+	for _, class := range []string{Normal, Priority} {
+		class := class
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limiter.acquire(class) {
+				order <- class
+				limiter.release()
+			}
+		}()
+		// Queue the normal request first.
+		assert.Eventually(t, func() bool {
+			limiter.mu.Lock()
+			defer limiter.mu.Unlock()
+			return len(limiter.queues[class]) == 1
+		}, time.Second, time.Millisecond)
+	}
+
+	limiter.release()
+	wg.Wait()
+	assert.Equal(t, Priority, <-order)
+	assert.Equal(t, Normal, <-order)
+}
+
+func TestNoLimit(t *testing.T) {
+	limiter := New(config.AdmissionConfig{}, nil, metrics.NewRegistry())
+	release := make(chan struct{})
+	close(release)
+	testkit.Do(t, blockingApp(limiter, release), "GET", "/slow", nil).AssertStatus(200)
+}
@@ -0,0 +1,224 @@
+// Package analytics counts how the app is used without telling who uses
+// it. Events carry the route, not the path with its IDs, and neither the
+// user, the address nor the user agent of a request; the audit log is
+// where identity goes. They are sampled, batched and sent to a Sink in
+// the background, so requests never wait for it.
+package analytics
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/geoip"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+)
+
+// maxVariant bounds the variants clients report, which are dropped if
+// they are longer or contain other than letters, digits, '-', '_' and '.',
+// so the header can't carry anything identifying.
+const maxVariant = 32
+
+var variantKey = ctxutil.NewKey[string]("analytics.variant")
+
+// Event is a request as analytics sees it. Time is cut to the minute;
+// SampleRate is the share of requests sent, to scale counts by.
+type Event struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Route      string    `json:"route"`
+	Status     int       `json:"status"`
+	Latency    string    `json:"latency"`
+	Variant    string    `json:"variant,omitempty"`
+	Country    string    `json:"country,omitempty"`
+	SampleRate float64   `json:"sample_rate"`
+}
+
+// Sink stores or forwards batches of events.
+type Sink interface {
+	Write(ctx context.Context, events []Event) error
+	Close() error
+}
+
+// Pipeline samples events and sends them to its sink in batches.
+// Events arriving while the buffer is full are dropped.
+type Pipeline struct {
+	cfg    config.AnalyticsConfig
+	sink   Sink
+	logger *slog.Logger
+	now    func() time.Time
+	sample func() float64
+	events *metrics.CounterVec
+
+	queue chan Event
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func New(cfg config.AnalyticsConfig, sink Sink, logger *slog.Logger, registry *metrics.Registry) *Pipeline {
+	return &Pipeline{
+		cfg:    cfg,
+		sink:   sink,
+		logger: logger,
+		now:    clock.System.Now,
+		sample: rand.Float64,
+		events: registry.Counter("analytics_events_total", "Analytics events by result: sent, dropped or failed.", "result"),
+		queue:  make(chan Event, 10*cfg.BatchSize),
+		stop:   make(chan struct{}),
+	}
+}
+
+// SetVariant sets the variant of the app, such as an experiment's arm,
+// the request is counted under, over the one the client reports.
+func SetVariant(c *fiber.Ctx, variant string) {
+	variantKey.Set(c, variant)
+}
+
+// Middleware tracks the requests after they are handled.
+func (p *Pipeline) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		if p.sample() >= p.cfg.SampleRate {
+			return err
+		}
+		event := Event{
+			Time:       p.now().UTC().Truncate(time.Minute),
+			Method:     c.Method(),
+			Route:      route(c, err),
+			Status:     responseStatus(c, err),
+			Latency:    p.bucket(time.Since(start)),
+			SampleRate: p.cfg.SampleRate,
+		}
+		variant, ok := variantKey.Get(c)
+		if !ok {
+			variant = c.Get(p.cfg.VariantHeader)
+		}
+		if validVariant(variant) {
+			event.Variant = variant
+		}
+		if location, ok := geoip.From(c); ok {
+			event.Country = location.Country
+		}
+		p.Track(event)
+		return err
+	}
+}
+
+// Track queues event as it is, without sampling it.
+func (p *Pipeline) Track(event Event) {
+	select {
+	case p.queue <- event:
+	default:
+		p.events.With("dropped").Inc()
+	}
+}
+
+// Start sends the events in the background until Stop.
+func (p *Pipeline) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(p.cfg.FlushInterval)
+		defer ticker.Stop()
+		batch := make([]Event, 0, p.cfg.BatchSize)
+		for {
+			select {
+			case event := <-p.queue:
+				batch = append(batch, event)
+				if len(batch) < p.cfg.BatchSize {
+					continue
+				}
+			case <-ticker.C:
+			case <-p.stop:
+				for len(p.queue) > 0 {
+					batch = append(batch, <-p.queue)
+				}
+				p.flush(batch)
+				return
+			}
+			p.flush(batch)
+			batch = batch[:0]
+		}
+	}()
+}
+
+// Stop sends the events still queued and closes the sink.
+func (p *Pipeline) Stop() error {
+	close(p.stop)
+	p.wg.Wait()
+	return p.sink.Close()
+}
+
+// flush sends batch in parts of at most BatchSize. A failed part is
+// dropped: analytics is not worth holding requests' memory for.
+func (p *Pipeline) flush(batch []Event) {
+	for len(batch) > 0 {
+		n := min(len(batch), p.cfg.BatchSize)
+		ctx, cancel := context.WithTimeout(context.Background(), p.cfg.FlushInterval)
+		err := p.sink.Write(ctx, batch[:n])
+		cancel()
+		if err != nil {
+			p.events.With("failed").Add(float64(n))
+			p.logger.Warn("sending analytics events failed", slog.Int("events", n), slog.String("error", err.Error()))
+		} else {
+			p.events.With("sent").Add(float64(n))
+		}
+		batch = batch[n:]
+	}
+}
+
+// bucket returns the latency bucket of d, as in "<100ms" or ">=2.5s".
+func (p *Pipeline) bucket(d time.Duration) string {
+	buckets := p.cfg.LatencyBuckets
+	for _, bucket := range buckets {
+		if d < bucket {
+			return "<" + bucket.String()
+		}
+	}
+	if len(buckets) == 0 {
+		return ""
+	}
+	return ">=" + buckets[len(buckets)-1].String()
+}
+
+// route reports requests that matched no route as "unmatched", rather
+// than with a path nobody chose.
+func route(c *fiber.Ctx, err error) string {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusNotFound && strings.HasPrefix(fiberErr.Message, "Cannot ") {
+		return "unmatched"
+	}
+	return c.Route().Path
+}
+
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+func validVariant(variant string) bool {
+	if variant == "" || len(variant) > maxVariant {
+		return false
+	}
+	for _, r := range variant {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
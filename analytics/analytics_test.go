@@ -0,0 +1,179 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+// memory keeps the batches written to it, failing with err when set.
+type memory struct {
+	mu      sync.Mutex
+	batches [][]Event
+	err     error
+	closed  bool
+}
+
+func (m *memory) Write(_ context.Context, events []Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.batches = append(m.batches, append([]Event(nil), events...))
+	return nil
+}
+
+func (m *memory) fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+func (m *memory) Close() error {
+	m.closed = true
+	return nil
+}
+
+func (m *memory) sizes() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sizes []int
+	for _, batch := range m.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func newPipeline(sink Sink, batchSize int, interval time.Duration) *Pipeline {
+	cfg := config.Default().Analytics
+	cfg.SampleRate = 1
+	cfg.BatchSize = batchSize
+	cfg.FlushInterval = interval
+	return New(cfg, sink, slog.New(slog.NewTextHandler(io.Discard, nil)), metrics.NewRegistry())
+}
+
+func TestMiddleware(t *testing.T) {
+	sink := &memory{}
+	pipeline := newPipeline(sink, 10, time.Hour)
+	pipeline.now = func() time.Time { return time.Date(2026, 5, 1, 10, 42, 17, 0, time.UTC) }
+	app := fiber.New()
+	app.Use(pipeline.Middleware())
+	app.Get("/orders/:id", func(c *fiber.Ctx) error { return c.SendString("order") })
+	app.Get("/checkout", func(c *fiber.Ctx) error {
+		SetVariant(c, "one-page")
+		return fiber.ErrConflict
+	})
+
+	testkit.Do(t, app, "GET", "/orders/7?email=alice@example.com", nil, testkit.WithHeader("X-Variant", "beta")).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/checkout", nil, testkit.WithHeader("X-Variant", "beta")).AssertStatus(409)
+	testkit.Do(t, app, "GET", "/users/alice", nil, testkit.WithHeader("X-Variant", "alice@example.com")).AssertStatus(404)
+	pipeline.Start()
+	assert.Nil(t, pipeline.Stop())
+	assert.True(t, sink.closed)
+
+	if assert.Equal(t, []int{3}, sink.sizes()) {
+		events := sink.batches[0]
+		at := time.Date(2026, 5, 1, 10, 42, 0, 0, time.UTC)
+		assert.Equal(t, Event{Time: at, Method: "GET", Route: "/orders/:id", Status: 200, Latency: "<50ms", Variant: "beta", SampleRate: 1}, events[0])
+		assert.Equal(t, "one-page", events[1].Variant)
+		assert.Equal(t, 409, events[1].Status)
+		assert.Equal(t, "unmatched", events[2].Route)
+		assert.Empty(t, events[2].Variant)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	sink := &memory{}
+	pipeline := newPipeline(sink, 10, time.Hour)
+	pipeline.cfg.SampleRate = 0.25
+	samples := []float64{0.1, 0.5, 0.2, 0.9}
+	pipeline.sample = func() float64 {
+		sample := samples[0]
+		samples = samples[1:]
+		return sample
+	}
+	app := fiber.New()
+	app.Use(pipeline.Middleware())
+	app.Get("/", func(c *fiber.Ctx) error { return nil })
+	for i := 0; i < 4; i++ {
+		testkit.Do(t, app, "GET", "/", nil).AssertStatus(200)
+	}
+	pipeline.Start()
+	assert.Nil(t, pipeline.Stop())
+	if assert.Equal(t, []int{2}, sink.sizes()) {
+		assert.Equal(t, 0.25, sink.batches[0][0].SampleRate)
+	}
+}
+
+func TestBatching(t *testing.T) {
+	sink := &memory{}
+	pipeline := newPipeline(sink, 2, 20*time.Millisecond)
+	pipeline.Start()
+	for i := 0; i < 5; i++ {
+		pipeline.Track(Event{Route: "/"})
+	}
+	// Full batches go out at once, the rest on the next tick.
+	assert.Eventually(t, func() bool { return len(sink.sizes()) == 3 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []int{2, 2, 1}, sink.sizes())
+
+	sink.fail(errors.New("broker down"))
+	pipeline.Track(Event{Route: "/"})
+	assert.Nil(t, pipeline.Stop())
+	assert.Equal(t, float64(5), pipeline.events.With("sent").Value())
+	assert.Equal(t, float64(1), pipeline.events.With("failed").Value())
+
+	// A full buffer drops events instead of holding requests up.
+	full := newPipeline(sink, 1, time.Hour)
+	for i := 0; i < 11; i++ {
+		full.Track(Event{})
+	}
+	assert.Equal(t, float64(1), full.events.With("dropped").Value())
+}
+
+func TestBucket(t *testing.T) {
+	pipeline := newPipeline(&memory{}, 1, time.Hour)
+	assert.Equal(t, "<50ms", pipeline.bucket(10*time.Millisecond))
+	assert.Equal(t, "<250ms", pipeline.bucket(100*time.Millisecond))
+	assert.Equal(t, ">=2.5s", pipeline.bucket(3*time.Second))
+}
+
+func TestSinks(t *testing.T) {
+	var buf bytes.Buffer
+	lines := NewLines(&buf)
+	assert.Nil(t, lines.Write(context.Background(), []Event{{Route: "/a", Status: 200}, {Route: "/b", Status: 404}}))
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"))
+	assert.Contains(t, buf.String(), `"route":"/b","status":404`)
+
+	proxy := testkit.NewMock(t, nil)
+	proxy.Respond(http.StatusOK, `{"offsets":[]}`)
+	kafka := NewKafka(config.KafkaConfig{URL: proxy.URL + "/", Topic: "app.requests"}, httpclient.New(config.Default().HTTPClient))
+	assert.Nil(t, kafka.Write(context.Background(), []Event{{Route: "/a"}}))
+	received := proxy.Requests()[0]
+	assert.Equal(t, "/topics/app.requests", received.Path)
+	assert.Equal(t, "application/vnd.kafka.json.v2+json", received.Header.Get("Content-Type"))
+	var body struct {
+		Records []struct {
+			Value Event `json:"value"`
+		} `json:"records"`
+	}
+	received.JSON(t, &body)
+	assert.Equal(t, "/a", body.Records[0].Value.Route)
+
+	proxy.Respond(http.StatusServiceUnavailable, "")
+	assert.EqualError(t, kafka.Write(context.Background(), []Event{{Route: "/a"}}), "analytics: kafka proxy returned 503 Service Unavailable")
+}
@@ -0,0 +1,113 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+)
+
+// Open returns the sink cfg.Sink names.
+func Open(cfg config.AnalyticsConfig, client *httpclient.Client) (Sink, error) {
+	switch cfg.Sink {
+	case "stdout":
+		return NewLines(os.Stdout), nil
+	case "file":
+		file, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		return NewLines(file), nil
+	case "kafka":
+		return NewKafka(cfg.Kafka, client), nil
+	}
+	return nil, fmt.Errorf("analytics: unknown sink %q", cfg.Sink)
+}
+
+// Lines writes events as JSON, one per line. It closes w with the sink if
+// w is a file other than stdout and stderr.
+type Lines struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLines(w io.Writer) *Lines {
+	return &Lines{w: w}
+}
+
+func (l *Lines) Write(_ context.Context, events []Event) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.w.Write(buf.Bytes())
+	return err
+}
+
+func (l *Lines) Close() error {
+	if file, ok := l.w.(*os.File); ok && file != os.Stdout && file != os.Stderr {
+		return file.Close()
+	}
+	return nil
+}
+
+// Kafka produces events to a topic through a Kafka REST proxy, one
+// message per event and one request per batch.
+type Kafka struct {
+	cfg    config.KafkaConfig
+	client *httpclient.Client
+}
+
+func NewKafka(cfg config.KafkaConfig, client *httpclient.Client) *Kafka {
+	return &Kafka{cfg: cfg, client: client}
+}
+
+func (k *Kafka) Write(ctx context.Context, events []Event) error {
+	type record struct {
+		Value Event `json:"value"`
+	}
+	body := struct {
+		Records []record `json:"records"`
+	}{Records: make([]record, len(events))}
+	for i, event := range events {
+		body.Records[i] = record{Value: event}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimSuffix(k.cfg.URL, "/") + "/topics/" + url.PathEscape(k.cfg.Topic)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	request.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	response, err := k.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("analytics: kafka proxy returned %s", response.Status)
+	}
+	return nil
+}
+
+func (k *Kafka) Close() error {
+	return nil
+}
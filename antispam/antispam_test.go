@@ -0,0 +1,79 @@
+package antispam
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrap(t *testing.T) {
+	cfg := config.Default().Forms
+	cfg.Secret = "rahasia"
+	registry := metrics.NewRegistry()
+	logs := new(bytes.Buffer)
+	trap := New(cfg, slog.New(slog.NewJSONHandler(logs, nil)), registry)
+	now := time.Now()
+	trap.now = func() time.Time { return now }
+
+	app := fiber.New()
+	app.Use("/web", trap.Middleware())
+	app.Post("/web/contact", func(c *fiber.Ctx) error {
+		return c.SendString("thanks " + c.FormValue("name"))
+	})
+	submit := func(form url.Values) string {
+		request := httptest.NewRequest("POST", "/web/contact", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response, err := app.Test(request)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, response.StatusCode)
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		return string(body)
+	}
+
+	stamp := trap.Stamp()
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, "thanks akbar", submit(url.Values{"name": {"akbar"}, "form_ts": {stamp}}))
+
+	assert.Equal(t, "OK", submit(url.Values{"name": {"bot"}, "form_ts": {stamp}, "website": {"http://spam.example"}}))
+	assert.Equal(t, "OK", submit(url.Values{"name": {"bot"}}))
+	assert.Equal(t, "OK", submit(url.Values{"name": {"bot"}, "form_ts": {"1.forged"}}))
+	assert.Equal(t, "OK", submit(url.Values{"name": {"bot"}, "form_ts": {trap.Stamp()}}))
+	now = now.Add(48 * time.Hour)
+	assert.Equal(t, "OK", submit(url.Values{"name": {"bot"}, "form_ts": {stamp}}))
+
+	output := new(strings.Builder)
+	registry.Write(output)
+	for _, reason := range []string{"honeypot", "missing_stamp", "invalid_stamp", "too_fast", "expired_stamp"} {
+		assert.Contains(t, output.String(), `form_spam_total{reason="`+reason+`"} 1`)
+	}
+	assert.Contains(t, logs.String(), `"msg":"form spam"`)
+}
+
+func TestTrapIgnoresOtherRequests(t *testing.T) {
+	cfg := config.Default().Forms
+	cfg.Secret = "rahasia"
+	app := fiber.New()
+	app.Use(New(cfg, slog.New(slog.NewJSONHandler(io.Discard, nil)), metrics.NewRegistry()).Middleware())
+	app.Post("/web/api", func(c *fiber.Ctx) error {
+		return c.SendString("handled")
+	})
+
+	request := httptest.NewRequest("POST", "/web/api", strings.NewReader(`{"website":"x"}`))
+	request.Header.Set("Content-Type", "application/json")
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "handled", string(body))
+}
@@ -0,0 +1,79 @@
+// Package apikeys authenticates API clients by the key they send in the
+// X-Api-Key header.
+package apikeys
+
+import (
+	"crypto/sha256"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+)
+
+const Header = "X-Api-Key"
+
+var keyKey = ctxutil.NewKey[Key]("api_key")
+
+// Key is a configured API key, without the secret.
+type Key struct {
+	Name   string
+	User   string
+	Plan   string
+	Scopes []string
+}
+
+// Keys looks keys up by their SHA-256 hash, so the lookup takes as long
+// however much of a guessed key is right.
+type Keys struct {
+	keys map[[sha256.Size]byte]Key
+}
+
+func New(cfg config.APIKeysConfig) *Keys {
+	k := &Keys{keys: map[[sha256.Size]byte]Key{}}
+	for _, key := range cfg.Keys {
+		k.keys[sha256.Sum256([]byte(key.Key))] = keyOf(key)
+	}
+	return k
+}
+
+func keyOf(cfg config.APIKey) Key {
+	user := cfg.User
+	if user == "" {
+		user = cfg.Name
+	}
+	return Key{Name: cfg.Name, User: user, Plan: cfg.Plan, Scopes: cfg.Scopes}
+}
+
+// Lookup returns the key secret belongs to.
+func (k *Keys) Lookup(secret string) (Key, bool) {
+	key, ok := k.keys[sha256.Sum256([]byte(secret))]
+	return key, ok
+}
+
+// Middleware authenticates the requests that send a key: the key's user
+// becomes the request's ctxutil.CurrentUser, its scopes the request's
+// ctxutil.Scopes, and the key is available through From.
+// Requests with an unknown key get a 401, those without one pass as they
+// are.
+func (k *Keys) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		secret := c.Get(Header)
+		if secret == "" {
+			return c.Next()
+		}
+		key, ok := k.Lookup(secret)
+		if !ok {
+			return fiber.NewError(fiber.StatusUnauthorized, "invalid API key")
+		}
+		ctxutil.SetCurrentUser(c, key.User)
+		ctxutil.SetScopes(c, key.Scopes)
+		keyKey.Set(c, key)
+		return c.Next()
+	}
+}
+
+// From returns the key Middleware authenticated the request with.
+func From(c *fiber.Ctx) (Key, bool) {
+	key, ok := keyKey.Get(c)
+	return key, ok
+}
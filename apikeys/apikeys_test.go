@@ -0,0 +1,36 @@
+package apikeys
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	keys := New(config.APIKeysConfig{Keys: []config.APIKey{
+		{Name: "ci", Key: "ci-secret", Plan: "free"},
+		{Name: "billing", Key: "billing-secret", User: "alice", Plan: "pro", Scopes: []string{"orders:read", "orders:write"}},
+	}})
+	app := fiber.New()
+	app.Use(keys.Middleware())
+	app.Get("/", func(c *fiber.Ctx) error {
+		key, ok := From(c)
+		if !ok {
+			return c.SendString("anonymous")
+		}
+		return c.SendString(strings.TrimSpace(ctxutil.CurrentUser(c) + " " + key.Name + " " + key.Plan + " " + strings.Join(ctxutil.Scopes(c), " ")))
+	})
+
+	testkit.Do(t, app, "GET", "/", nil).AssertStatus(200).AssertBody("anonymous")
+	testkit.Do(t, app, "GET", "/", nil, testkit.WithHeader(Header, "ci-secret")).AssertStatus(200).AssertBody("ci ci free")
+	testkit.Do(t, app, "GET", "/", nil, testkit.WithHeader(Header, "billing-secret")).AssertStatus(200).AssertBody("alice billing pro orders:read orders:write")
+	testkit.Do(t, app, "GET", "/", nil, testkit.WithHeader(Header, "guessed")).AssertStatus(401)
+
+	_, ok := keys.Lookup("")
+	assert.False(t, ok)
+}
@@ -0,0 +1,148 @@
+package apikeys
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+)
+
+// Meter counts the requests of every key and the bytes of their bodies per
+// calendar month, and enforces the quotas of the keys' plans.
+type Meter struct {
+	plans    map[string]config.APIPlan
+	keysOf   map[string][]Key
+	store    UsageStore
+	logger   *slog.Logger
+	now      func() time.Time
+	exceeded *metrics.CounterVec
+}
+
+// NewMeter keeps usage in store. Requests rejected for a used up quota are
+// counted in api_quota_exceeded_total.
+func NewMeter(cfg config.APIKeysConfig, store UsageStore, logger *slog.Logger, registry *metrics.Registry) *Meter {
+	m := &Meter{
+		plans:    cfg.Plans,
+		keysOf:   map[string][]Key{},
+		store:    store,
+		logger:   logger,
+		now:      clock.System.Now,
+		exceeded: registry.Counter("api_quota_exceeded_total", "Requests rejected because the quota of their API key was used up.", "key"),
+	}
+	for _, configured := range cfg.Keys {
+		key := keyOf(configured)
+		m.keysOf[key.User] = append(m.keysOf[key.User], key)
+	}
+	return m
+}
+
+// period returns the month of now and when the next one starts.
+func (m *Meter) period() (string, time.Time) {
+	now := m.now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start.Format("2006-01"), start.AddDate(0, 1, 0)
+}
+
+// Middleware meters the requests made with a key. Once a quota of the key's
+// plan is used up, requests get a 429 until the month is over. Responses
+// tell the quotas, what remains of them and in how many seconds they
+// reset in X-Quota-* headers. Errors of later handlers are handled here,
+// so the bytes of error responses count too. Usage that can't be read or
+// written is logged and the request served regardless.
+func (m *Meter) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key, ok := From(c)
+		if !ok {
+			return c.Next()
+		}
+		plan := m.plans[key.Plan]
+		month, reset := m.period()
+		ctx := c.UserContext()
+
+		usage, err := m.store.Get(ctx, key.Name, month)
+		if err != nil {
+			m.logger.Warn("reading API key usage failed", slog.String("key", key.Name), slog.String("error", err.Error()))
+		} else {
+			setQuotaHeaders(c, plan, usage, reset.Sub(m.now()))
+			if plan.MonthlyRequests > 0 && usage.Requests >= plan.MonthlyRequests ||
+				plan.MonthlyBytes > 0 && usage.Bytes >= plan.MonthlyBytes {
+				m.exceeded.With(key.Name).Inc()
+				c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(seconds(reset.Sub(m.now())), 10))
+				return fiber.NewError(fiber.StatusTooManyRequests, "monthly quota of plan "+key.Plan+" used up")
+			}
+		}
+
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+		}
+		used := Usage{Requests: 1, Bytes: int64(len(c.Request().Body()) + len(c.Response().Body()))}
+		if err := m.store.Add(ctx, key.Name, month, used); err != nil {
+			m.logger.Warn("recording API key usage failed", slog.String("key", key.Name), slog.String("error", err.Error()))
+		}
+		return nil
+	}
+}
+
+// setQuotaHeaders tells the quotas of plan and what remains of them after
+// this request, as far as it is known before it is served.
+func setQuotaHeaders(c *fiber.Ctx, plan config.APIPlan, usage Usage, reset time.Duration) {
+	if plan.MonthlyRequests > 0 {
+		c.Set("X-Quota-Requests-Limit", strconv.FormatInt(plan.MonthlyRequests, 10))
+		c.Set("X-Quota-Requests-Remaining", strconv.FormatInt(max(plan.MonthlyRequests-usage.Requests-1, 0), 10))
+	}
+	if plan.MonthlyBytes > 0 {
+		c.Set("X-Quota-Bytes-Limit", strconv.FormatInt(plan.MonthlyBytes, 10))
+		c.Set("X-Quota-Bytes-Remaining", strconv.FormatInt(max(plan.MonthlyBytes-usage.Bytes, 0), 10))
+	}
+	if plan.MonthlyRequests > 0 || plan.MonthlyBytes > 0 {
+		c.Set("X-Quota-Reset", strconv.FormatInt(seconds(reset), 10))
+	}
+}
+
+// seconds rounds d up to whole seconds.
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+type keyUsage struct {
+	Name            string `json:"name"`
+	Plan            string `json:"plan"`
+	Requests        int64  `json:"requests"`
+	Bytes           int64  `json:"bytes"`
+	MonthlyRequests int64  `json:"monthly_requests"`
+	MonthlyBytes    int64  `json:"monthly_bytes"`
+}
+
+// UsageHandler serves GET /api/me/usage: what each key of the request's
+// user used this month, with the quotas of its plan, 0 being none.
+func (m *Meter) UsageHandler(c *fiber.Ctx) error {
+	user := ctxutil.CurrentUser(c)
+	if user == "" {
+		return fiber.ErrUnauthorized
+	}
+	month, reset := m.period()
+	keys := []keyUsage{}
+	for _, key := range m.keysOf[user] {
+		usage, err := m.store.Get(c.UserContext(), key.Name, month)
+		if err != nil {
+			return err
+		}
+		plan := m.plans[key.Plan]
+		keys = append(keys, keyUsage{
+			Name:            key.Name,
+			Plan:            key.Plan,
+			Requests:        usage.Requests,
+			Bytes:           usage.Bytes,
+			MonthlyRequests: plan.MonthlyRequests,
+			MonthlyBytes:    plan.MonthlyBytes,
+		})
+	}
+	return c.JSON(fiber.Map{"period": month, "reset": reset, "keys": keys})
+}
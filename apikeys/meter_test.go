@@ -0,0 +1,105 @@
+package apikeys
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeter(t *testing.T) {
+	server := miniredis.RunT(t)
+	stores := map[string]UsageStore{
+		"memory": NewMemoryUsage(),
+		"redis":  NewRedisUsage(redis.NewClient(&redis.Options{Addr: server.Addr()})),
+	}
+	for name, store := range stores {
+		store := store
+		t.Run(name, func(t *testing.T) {
+			cfg := config.APIKeysConfig{
+				Keys: []config.APIKey{
+					{Name: "ci", Key: "ci-secret", User: "alice", Plan: "free"},
+					{Name: "export", Key: "export-secret", User: "alice", Plan: "metered"},
+					{Name: "billing", Key: "billing-secret", User: "bob", Plan: "unlimited"},
+				},
+				Plans: map[string]config.APIPlan{
+					"free":    {MonthlyRequests: 2},
+					"metered": {MonthlyBytes: 10},
+				},
+			}
+			registry := metrics.NewRegistry()
+			meter := NewMeter(cfg, store, slog.New(slog.NewTextHandler(io.Discard, nil)), registry)
+			now := time.Date(2026, 10, 31, 23, 59, 0, 0, time.UTC)
+			meter.now = func() time.Time { return now }
+
+			app := fiber.New()
+			app.Use(New(cfg).Middleware(), meter.Middleware())
+			app.Get("/me/usage", meter.UsageHandler)
+			app.Post("/echo", func(c *fiber.Ctx) error { return c.Send(c.Body()) })
+			withKey := func(key string) testkit.Option { return testkit.WithHeader(Header, key) }
+
+			testkit.Do(t, app, "POST", "/echo", strings.NewReader("hi"), withKey("ci")).AssertStatus(401)
+			testkit.Do(t, app, "POST", "/echo", strings.NewReader("hi"), withKey("ci-secret")).AssertStatus(200).
+				AssertHeader("X-Quota-Requests-Limit", "2").
+				AssertHeader("X-Quota-Requests-Remaining", "1").
+				AssertHeader("X-Quota-Reset", "60")
+			testkit.Do(t, app, "POST", "/echo", nil, withKey("ci-secret")).AssertStatus(200).AssertHeader("X-Quota-Requests-Remaining", "0")
+			testkit.Do(t, app, "POST", "/echo", nil, withKey("ci-secret")).AssertStatus(429).AssertHeader("Retry-After", "60")
+
+			// Bodies in both directions count.
+			testkit.Do(t, app, "POST", "/echo", strings.NewReader("12345"), withKey("export-secret")).AssertStatus(200).
+				AssertHeader("X-Quota-Bytes-Remaining", "10").
+				AssertHeader("X-Quota-Requests-Limit", "")
+			testkit.Do(t, app, "POST", "/echo", nil, withKey("export-secret")).AssertStatus(429)
+
+			for i := 0; i < 3; i++ {
+				testkit.Do(t, app, "POST", "/echo", nil, withKey("billing-secret")).AssertStatus(200).AssertHeader("X-Quota-Reset", "")
+			}
+
+			testkit.Do(t, app, "GET", "/me/usage", nil, withKey("billing-secret")).AssertStatus(200).AssertJSON(`{
+				"period": "2026-10",
+				"reset": "2026-11-01T00:00:00Z",
+				"keys": [{"name": "billing", "plan": "unlimited", "requests": 3, "bytes": 0, "monthly_requests": 0, "monthly_bytes": 0}]
+			}`)
+			testkit.Do(t, app, "GET", "/me/usage", nil).AssertStatus(401)
+
+			// The quotas start over with the month.
+			now = now.Add(time.Minute)
+			testkit.Do(t, app, "POST", "/echo", nil, withKey("ci-secret")).AssertStatus(200).AssertHeader("X-Quota-Requests-Remaining", "1")
+			testkit.Do(t, app, "GET", "/me/usage", nil, withKey("export-secret")).AssertStatus(200).AssertJSON(`{
+				"period": "2026-11",
+				"reset": "2026-12-01T00:00:00Z",
+				"keys": [
+					{"name": "ci", "plan": "free", "requests": 1, "bytes": 0, "monthly_requests": 2, "monthly_bytes": 0},
+					{"name": "export", "plan": "metered", "requests": 0, "bytes": 0, "monthly_requests": 0, "monthly_bytes": 10}
+				]
+			}`)
+
+			output := new(strings.Builder)
+			registry.Write(output)
+			assert.Contains(t, output.String(), `api_quota_exceeded_total{key="ci"} 1`)
+			assert.Contains(t, output.String(), `api_quota_exceeded_total{key="export"} 1`)
+		})
+	}
+}
+
+func TestMemoryUsageKeepsTwoMonths(t *testing.T) {
+	store := NewMemoryUsage()
+	for _, month := range []string{"2026-08", "2026-09", "2026-10"} {
+		assert.Nil(t, store.Add(context.Background(), "ci", month, Usage{Requests: 1, Bytes: 2}))
+	}
+	usage, _ := store.Get(context.Background(), "ci", "2026-09")
+	assert.Equal(t, Usage{Requests: 1, Bytes: 2}, usage)
+	usage, _ = store.Get(context.Background(), "ci", "2026-08")
+	assert.Equal(t, Usage{}, usage)
+}
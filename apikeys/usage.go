@@ -0,0 +1,99 @@
+package apikeys
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Usage is what a key used in a month.
+type Usage struct {
+	Requests int64 `redis:"requests"`
+	Bytes    int64 `redis:"bytes"`
+}
+
+// UsageStore keeps the usage of keys by month, as in "2026-10".
+type UsageStore interface {
+	Get(ctx context.Context, key, month string) (Usage, error)
+	Add(ctx context.Context, key, month string, usage Usage) error
+}
+
+// MemoryUsage keeps usage in memory, for a single instance. Only the
+// current and the previous month are kept.
+type MemoryUsage struct {
+	mu     sync.Mutex
+	months map[string]map[string]Usage
+}
+
+func NewMemoryUsage() *MemoryUsage {
+	return &MemoryUsage{months: map[string]map[string]Usage{}}
+}
+
+func (m *MemoryUsage) Get(ctx context.Context, key, month string) (Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.months[month][key], nil
+}
+
+func (m *MemoryUsage) Add(ctx context.Context, key, month string, usage Usage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys, ok := m.months[month]
+	if !ok {
+		keys = map[string]Usage{}
+		m.months[month] = keys
+		// A new month drops those before the previous one. Month names
+		// sort by time.
+		for old := range m.months {
+			if old < month && old != previousMonth(month) {
+				delete(m.months, old)
+			}
+		}
+	}
+	total := keys[key]
+	total.Requests += usage.Requests
+	total.Bytes += usage.Bytes
+	keys[key] = total
+	return nil
+}
+
+func previousMonth(month string) string {
+	t, err := time.Parse("2006-01", month)
+	if err != nil {
+		return ""
+	}
+	return t.AddDate(0, -1, 0).Format("2006-01")
+}
+
+// RedisUsage keeps usage in Redis, shared by all instances, in a hash per
+// key and month that expires once the next month is over.
+type RedisUsage struct {
+	client redis.UniversalClient
+}
+
+func NewRedisUsage(client redis.UniversalClient) *RedisUsage {
+	return &RedisUsage{client: client}
+}
+
+func (r *RedisUsage) Get(ctx context.Context, key, month string) (Usage, error) {
+	var usage Usage
+	err := r.client.HMGet(ctx, usageKey(key, month), "requests", "bytes").Scan(&usage)
+	return usage, err
+}
+
+func (r *RedisUsage) Add(ctx context.Context, key, month string, usage Usage) error {
+	name := usageKey(key, month)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, name, "requests", usage.Requests)
+		pipe.HIncrBy(ctx, name, "bytes", usage.Bytes)
+		pipe.Expire(ctx, name, 62*24*time.Hour)
+		return nil
+	})
+	return err
+}
+
+func usageKey(key, month string) string {
+	return "apikeys:usage:" + month + ":" + key
+}
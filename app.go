@@ -0,0 +1,874 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+	"github.com/gofiber/fiber/v2/middleware/expvar"
+	"github.com/gofiber/fiber/v2/middleware/favicon"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
+	"github.com/jalal-akbar/belajar-golang-fiber/adminui"
+	"github.com/jalal-akbar/belajar-golang-fiber/admission"
+	"github.com/jalal-akbar/belajar-golang-fiber/analytics"
+	"github.com/jalal-akbar/belajar-golang-fiber/antispam"
+	"github.com/jalal-akbar/belajar-golang-fiber/apikeys"
+	"github.com/jalal-akbar/belajar-golang-fiber/assets"
+	"github.com/jalal-akbar/belajar-golang-fiber/audit"
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/botfilter"
+	"github.com/jalal-akbar/belajar-golang-fiber/captcha"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/consent"
+	"github.com/jalal-akbar/belajar-golang-fiber/csp"
+	"github.com/jalal-akbar/belajar-golang-fiber/dashboard"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/deprecation"
+	"github.com/jalal-akbar/belajar-golang-fiber/erasure"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/export"
+	"github.com/jalal-akbar/belajar-golang-fiber/features"
+	"github.com/jalal-akbar/belajar-golang-fiber/files"
+	"github.com/jalal-akbar/belajar-golang-fiber/geoip"
+	"github.com/jalal-akbar/belajar-golang-fiber/grpcserver"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/jalal-akbar/belajar-golang-fiber/jobs"
+	"github.com/jalal-akbar/belajar-golang-fiber/kpi"
+	"github.com/jalal-akbar/belajar-golang-fiber/lifecycle"
+	"github.com/jalal-akbar/belajar-golang-fiber/logging"
+	"github.com/jalal-akbar/belajar-golang-fiber/mail"
+	"github.com/jalal-akbar/belajar-golang-fiber/messaging"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/middleware"
+	"github.com/jalal-akbar/belajar-golang-fiber/monitor"
+	"github.com/jalal-akbar/belajar-golang-fiber/notifications"
+	"github.com/jalal-akbar/belajar-golang-fiber/orders"
+	"github.com/jalal-akbar/belajar-golang-fiber/outbox"
+	"github.com/jalal-akbar/belajar-golang-fiber/payments"
+	"github.com/jalal-akbar/belajar-golang-fiber/pii"
+	"github.com/jalal-akbar/belajar-golang-fiber/pools"
+	"github.com/jalal-akbar/belajar-golang-fiber/profile"
+	"github.com/jalal-akbar/belajar-golang-fiber/proxy"
+	"github.com/jalal-akbar/belajar-golang-fiber/ratelimit"
+	"github.com/jalal-akbar/belajar-golang-fiber/record"
+	"github.com/jalal-akbar/belajar-golang-fiber/redact"
+	"github.com/jalal-akbar/belajar-golang-fiber/reload"
+	"github.com/jalal-akbar/belajar-golang-fiber/reporting"
+	"github.com/jalal-akbar/belajar-golang-fiber/routing"
+	"github.com/jalal-akbar/belajar-golang-fiber/scan"
+	"github.com/jalal-akbar/belajar-golang-fiber/sequence"
+	"github.com/jalal-akbar/belajar-golang-fiber/server"
+	"github.com/jalal-akbar/belajar-golang-fiber/sitemap"
+	"github.com/jalal-akbar/belajar-golang-fiber/timezone"
+	"github.com/jalal-akbar/belajar-golang-fiber/timing"
+	"github.com/jalal-akbar/belajar-golang-fiber/tracing"
+	"github.com/jalal-akbar/belajar-golang-fiber/transcode"
+	"github.com/jalal-akbar/belajar-golang-fiber/upload"
+	"github.com/jalal-akbar/belajar-golang-fiber/users"
+	"github.com/jalal-akbar/belajar-golang-fiber/views"
+	"github.com/jalal-akbar/belajar-golang-fiber/warmup"
+	"github.com/jalal-akbar/belajar-golang-fiber/webpush"
+	"github.com/jalal-akbar/belajar-golang-fiber/welcome"
+)
+
+func newApp(cfg *config.Config) (*fiber.App, error) {
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return nil, err
+	}
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(level)
+	redactor := redact.New(cfg.Log.Redact)
+	logger := logging.New(os.Stdout, logLevel, redactor)
+
+	client := httpclient.New(cfg.HTTPClient)
+
+	var reporter reporting.Reporter = reporting.LogReporter{Logger: logger}
+	var sentry *reporting.Sentry
+	if cfg.Sentry.DSN != "" {
+		sentry, err = reporting.NewSentry(cfg.Sentry, client, logger)
+		if err != nil {
+			return nil, err
+		}
+		reporter = sentry
+	}
+
+	app := fiber.New(fiber.Config{
+		Prefork:        cfg.Server.Prefork,
+		IdleTimeout:    cfg.Server.IdleTimeout,
+		ReadTimeout:    cfg.Server.ReadTimeout,
+		WriteTimeout:   cfg.Server.WriteTimeout,
+		Concurrency:    cfg.Server.Concurrency,
+		ReadBufferSize: cfg.Server.ReadBufferSize,
+		ErrorHandler:   reporting.ErrorHandler(reporter),
+		StrictRouting:  cfg.Server.StrictRouting,
+		CaseSensitive:  cfg.Server.CaseSensitive,
+
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.Server.TrustedProxies,
+	})
+	// Subsystems are started once the app is put together and stopped in
+	// reverse order when it shuts down.
+	hooks := lifecycle.New(cfg.Server.HookTimeout, logger)
+	if sentry != nil {
+		// First, so errors are reported up to the end.
+		hooks.Append(lifecycle.Hook{Name: "sentry", OnStop: func(context.Context) error {
+			return sentry.Close()
+		}})
+	}
+	if secrets := cfg.SecretStore(); secrets != nil {
+		hooks.Append(lifecycle.Hook{
+			Name: "secrets",
+			OnStart: func(context.Context) error {
+				secrets.Start(func(err error) {
+					logger.Warn("refreshing secrets failed", slog.String("error", err.Error()))
+				})
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				secrets.Stop()
+				return nil
+			},
+		})
+	}
+
+	registry := metrics.NewRegistry()
+	metrics.RegisterRuntime(registry)
+	httpMetrics := metrics.NewHTTP(registry)
+
+	bus := events.NewBus()
+	kpis := kpi.New(registry)
+	kpis.Listen(bus)
+	queue := jobs.New(cfg.Jobs, logger, registry)
+	hooks.Append(lifecycle.Hook{
+		Name: "jobs",
+		OnStart: func(context.Context) error {
+			queue.Start()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			queue.Stop()
+			return nil
+		},
+	})
+	watcher := reload.New(cfg, bus, logger)
+	if path := config.File(); path != "" {
+		hooks.Append(lifecycle.Hook{
+			Name:    "config watcher",
+			OnStart: func(context.Context) error { return watcher.Start(path) },
+			OnStop: func(context.Context) error {
+				watcher.Stop()
+				return nil
+			},
+		})
+	}
+	watcher.On(config.SectionLogLevel, func(cfg *config.Config) error {
+		level, err := logging.ParseLevel(cfg.Log.Level)
+		if err != nil {
+			return err
+		}
+		logLevel.Set(level)
+		return nil
+	})
+	flags := features.New(cfg.Features)
+	watcher.On(config.SectionFeatures, func(cfg *config.Config) error {
+		flags.Update(cfg.Features)
+		return nil
+	})
+
+	connectionPools := pools.New(registry)
+	stores := newBackends(cfg, hooks, connectionPools, logger, registry)
+
+	app.Use(logging.Middleware(logger))
+	if cfg.Tracing.Enabled {
+		exporter, err := tracing.Exporter(cfg.Tracing)
+		if err != nil {
+			return nil, err
+		}
+		tracer := tracing.New(cfg.Tracing, exporter)
+		hooks.Append(lifecycle.Hook{Name: "tracing", OnStop: tracer.Shutdown})
+		app.Use(tracer.Middleware())
+	}
+	app.Use(reporting.Recover(reporter))
+	app.Use(middleware.RejectMalformedParams())
+	if cfg.Server.CanonicalPaths {
+		app.Use(routing.CanonicalPaths())
+	}
+	if override := cfg.Override; len(override.FormRoutes) > 0 || len(override.HeaderRoutes) > 0 {
+		app.Use(middleware.MethodOverride(override.FormRoutes, override.HeaderRoutes))
+	}
+	if cfg.Debug.RecordDir != "" {
+		recorder, err := record.New(cfg.Debug.RecordDir, cfg.Debug.RecordMaxBody, redactor, logger)
+		if err != nil {
+			return nil, err
+		}
+		app.Use(recorder.Middleware())
+	}
+	var dumper *record.Dumper
+	if cfg.Debug.Enabled {
+		dumper = record.NewDumper(redactor, logger)
+		app.Use(dumper.Middleware())
+	}
+	realIP, err := middleware.ResolveRealIP(cfg.Server.ProxyHeader, cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	app.Use(realIP)
+	if access := cfg.Log.Access; access.Path != "" {
+		file, err := logging.OpenRotatingFile(access.Path, access.MaxSize, access.RotateEvery, access.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		app.Use(logging.AccessLog(file, redactor))
+		hooks.Append(lifecycle.Hook{Name: "access log", OnStop: func(context.Context) error {
+			return file.Close()
+		}})
+	}
+	app.Use(httpMetrics.Middleware())
+	if cfg.Analytics.Sink != "" {
+		sink, err := analytics.Open(cfg.Analytics, client)
+		if err != nil {
+			return nil, err
+		}
+		pipeline := analytics.New(cfg.Analytics, sink, logger, registry)
+		app.Use(pipeline.Middleware())
+		hooks.Append(lifecycle.Hook{
+			Name: "analytics",
+			OnStart: func(context.Context) error {
+				pipeline.Start()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				return pipeline.Stop()
+			},
+		})
+	}
+	admitted := admission.New(cfg.Admission, func(c *fiber.Ctx) bool {
+		return middleware.HasAdminToken(c, cfg.Admin.Token)
+	}, registry)
+	app.Use(admitted.Middleware())
+	maintenance := middleware.NewMaintenance(cfg.Admin.Maintenance, func(c *fiber.Ctx) bool {
+		return admitted.Class(c) == admission.Priority
+	})
+	watcher.On(config.SectionMaintenance, func(cfg *config.Config) error {
+		maintenance.Update(cfg.Admin.Maintenance)
+		return nil
+	})
+	app.Use(maintenance.Middleware())
+	if cfg.GeoIP.Database != "" {
+		locations, err := geoip.Open(cfg.GeoIP.Database)
+		if err != nil {
+			return nil, err
+		}
+		app.Use(geoip.Middleware(locations, cfg.GeoIP.BlockCountries))
+		hooks.Append(lifecycle.Hook{Name: "geoip", OnStop: func(context.Context) error {
+			return locations.Close()
+		}})
+	}
+	bots, err := botfilter.New(cfg.Bots, registry)
+	if err != nil {
+		return nil, err
+	}
+	app.Use(bots)
+	keys := apikeys.New(cfg.APIKeys)
+	app.Use(keys.Middleware())
+	// Set up with JWT below, when the limiter identifies its first client.
+	var (
+		tokens   *auth.Tokens
+		accounts *users.Users
+	)
+	limits, err := ratelimit.New(cfg.RateLimit, func(c *fiber.Ctx) ratelimit.Principal {
+		return principal(c, cfg.Admin.Token, tokens, accounts)
+	}, registry)
+	if err != nil {
+		return nil, err
+	}
+	watcher.On(config.SectionRateLimits, func(cfg *config.Config) error {
+		return limits.Update(cfg.RateLimit)
+	})
+	app.Use(limits.Middleware())
+	meter := apikeys.NewMeter(cfg.APIKeys, stores.Usage, logger, registry)
+	app.Use(meter.Middleware())
+	app.Use(logging.SlowRequests(logger, registry, cfg.Log))
+	app.Use(timing.Middleware())
+	app.Use(deprecation.New(logger, registry).Middleware())
+	app.Use(middleware.ExtractClientIdentity())
+	if cfg.TLS.Enabled() && cfg.TLS.HTTP3 {
+		app.Use(server.AltSvc(cfg.Addr))
+	}
+	for _, prefix := range cfg.TLS.ClientCertRoutes {
+		app.Use(prefix, middleware.RequireClientIdentity())
+	}
+	// Routes declared as tables are listed under /admin/routes.
+	table := routing.NewTable()
+	// Ready once the caches are warm, see the warmup hook below.
+	warm := warmup.New(cfg.Server.HookTimeout, logger)
+	table.Register(app, []routing.Route{
+		{Method: fiber.MethodGet, Path: "/metrics", Name: "metrics", Handler: registry.Handler},
+		{Method: fiber.MethodGet, Path: "/healthz", Name: "healthz", Handler: func(c *fiber.Ctx) error {
+			return c.SendString("ok")
+		}},
+		{Method: fiber.MethodGet, Path: "/readyz", Name: "readyz", Handler: warm.Handler},
+	})
+	if cfg.Web.BaseURL != "" {
+		table.Register(app, sitemap.New(cfg.Web, table).Routes())
+	}
+	app.Use(favicon.New(favicon.Config{File: "favicon.ico", FileSystem: http.FS(assets.Static())}))
+	// Templates link to /static/app.<hash>.css through the asset function.
+	static, err := assets.New(assets.Static(), "/static")
+	if err != nil {
+		return nil, err
+	}
+	table.Register(app, static.Routes())
+
+	cspReports := csp.New(registry)
+	app.Post("/csp-report", cspReports.ReportHandler)
+
+	// The middlewares the route groups pick from by preset. Those that
+	// aren't configured are added as nil, switched off.
+	chains := middleware.NewChains(cfg.Middleware.Presets)
+	chains.Add("admin-token", middleware.AdminAuth(cfg.Admin.Token))
+	var auditLog *audit.Log
+	var consents *consent.Consents
+	var (
+		orderRepo orders.Repository
+		db        *database.DB
+	)
+	if cfg.JWT.Enabled() {
+		// The database keeps the orders and their payments, along with
+		// the sessions, the accounts, the consents, the metadata of the
+		// files of users and the scheduled erasures, and is opened here,
+		// before the token, account and consent middlewares need it.
+		var migrations []database.Migration
+		for _, tables := range [][]database.Migration{auth.SessionMigrations, users.Migrations, auth.VerifyMigrations, notifications.Migrations, consent.Migrations, files.Migrations, erasure.Migrations, payments.Migrations} {
+			migrations = append(migrations, tables...)
+		}
+		orderRepo, db, err = orderRepository(cfg.Database, database.NewInstrumentation(logger, registry, cfg.Database.SlowQuery), migrations...)
+		if err != nil {
+			return nil, err
+		}
+		tokens, err = auth.New(cfg.JWT, client, db)
+		if err != nil {
+			return nil, err
+		}
+		tokens.UseBus(bus)
+		accounts = users.New(cfg.RBAC, db)
+		accounts.UseBus(bus)
+		hooks.Append(lifecycle.Hook{Name: "admins", OnStart: accounts.GrantAdmins})
+		kpis.CountAccounts(accounts.CountByStatus)
+		auditLog = audit.New(logger, 1000)
+		chains.Add("jwt", tokens.Middleware())
+		chains.Add("rbac", accounts.Middleware())
+		chains.Add("impersonation", auditLog.Impersonation())
+		chains.Add("consent", nil)
+		if len(cfg.Consent.Documents) > 0 {
+			consents = consent.New(cfg.Consent, db)
+			chains.Add("consent", consents.Middleware())
+		}
+	} else {
+		chains.Add("jwt", nil)
+		chains.Add("rbac", nil)
+		chains.Add("impersonation", nil)
+		chains.Add("consent", nil)
+	}
+	chains.Add("captcha", nil)
+	if cfg.Captcha.Provider != "" {
+		var verifier captcha.Verifier = captcha.NoOp{}
+		if cfg.Captcha.Provider != "noop" {
+			verifier, err = captcha.NewSiteVerify(cfg.Captcha.Provider, cfg.Captcha.Secret, client)
+			if err != nil {
+				return nil, err
+			}
+		}
+		guard := captcha.NewGuard(verifier, cfg.Captcha.Threshold, cfg.Captcha.Window)
+		// Signing in starts at the OIDC login; the callback the provider
+		// redirects to can't carry a token.
+		app.Use("/auth/oidc/login", guard.Middleware())
+		chains.Add("captcha", guard.Middleware())
+	}
+	chains.Add("antispam", nil)
+	if cfg.Forms.Secret != "" {
+		chains.Add("antispam", antispam.New(cfg.Forms, logger, registry).Middleware())
+	}
+	// The profiles come with the API further down; users have no zone of
+	// their own without it.
+	var profiles *profile.Profiles
+	zones := timezone.Middleware(func(userID string) string {
+		if profiles == nil {
+			return ""
+		}
+		return profiles.Get(userID).TimeZone
+	})
+	chains.Add("timezone", zones)
+	if cfg.Web.Compress {
+		app.Use("/web", compress.New())
+	}
+	if cfg.Web.Minify {
+		app.Use("/web", views.Minify())
+	}
+	if err := chains.Apply(app, "/web", "web"); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Signing.Routes) > 0 {
+		signatures := auth.NewSignatures(cfg.Signing)
+		for _, prefix := range cfg.Signing.Routes {
+			app.Use(prefix, signatures.Middleware())
+		}
+	}
+
+	uploads := upload.New(cfg.Uploads, upload.NewDisk(cfg.Uploads.Dir, cfg.Uploads.URLPrefix))
+	if cfg.Uploads.ClamdAddr != "" {
+		uploads.UseScanner(scan.NewClamd(cfg.Uploads.ClamdAddr, cfg.Uploads.ScanTimeout))
+	}
+	// Only the avatars are served as they are stored; the files of users
+	// go through the API, to their owners only.
+	if strings.HasPrefix(cfg.Uploads.URLPrefix, "/") {
+		app.Static(strings.TrimSuffix(cfg.Uploads.URLPrefix, "/")+"/"+profile.AvatarPrefix, filepath.Join(cfg.Uploads.Dir, profile.AvatarPrefix))
+	}
+	// The owners of the stored files join it with the API.
+	var userFiles *files.Files
+	uploadGC := upload.NewGC(uploads.Storage(), cfg.Uploads.GCGrace, logger, registry)
+	if cfg.Uploads.GCInterval > 0 {
+		hooks.Append(lifecycle.Hook{
+			Name: "upload-gc",
+			OnStart: func(context.Context) error {
+				uploadGC.Start(cfg.Uploads.GCInterval)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				uploadGC.Stop()
+				return nil
+			},
+		})
+	}
+
+	api := app.Group("/api")
+	if err := chains.Apply(api, "", "public-api"); err != nil {
+		return nil, err
+	}
+	// Without authentication there are no scopes to check.
+	requireScope := func(...string) fiber.Handler {
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+	if cfg.JWT.Enabled() {
+		app.Get("/.well-known/jwks.json", tokens.JWKSHandler)
+		if cfg.OIDC.Issuer != "" {
+			auth.NewOIDC(cfg.OIDC, tokens, client).Register(app.Group("/auth/oidc"))
+		}
+		requireScope = auth.RequireScope
+		// Every area of the API needs its read or write scope; the
+		// routes of the ones not listed here check their own.
+		api.Use(auth.RequireAreaScope("/api", map[string]string{
+			"orders":   "orders",
+			"me":       "users",
+			"consents": "users",
+			"files":    "files",
+			"media":    "files",
+		}))
+		tokens.Sessions().Register(api)
+		profiles = profile.New(uploads, cfg.Uploads.AvatarSize)
+		profiles.UseBus(bus)
+		profiles.Register(api)
+		// Only owners keeping track of their files in the database are
+		// looked after by the GC, so a restart doesn't have it take every
+		// file for an orphan.
+		userFiles = files.New(db, uploads, queue, logger)
+		userFiles.Register(api)
+		uploadGC.Own(files.Prefix, userFiles.Live)
+		uploadGC.Own(upload.QuarantinePrefix, userFiles.Live)
+		uploadGC.Own(files.MediaPrefix, userFiles.Live)
+		if cfg.Uploads.FFmpegPath != "" {
+			userFiles.UseTranscoder(transcode.NewFFmpeg(cfg.Uploads.FFmpegPath, cfg.Uploads.TranscodeTimeout))
+		}
+		// The orders join the exports with the database further down.
+		var exports *export.Exports
+		if cfg.Export.Secret != "" {
+			exports = export.New(cfg.Export, upload.NewDisk(cfg.Export.Dir, ""), queue, logger)
+			exports.Add("profile", func(_ context.Context, userID string) (any, error) {
+				return profiles.Get(userID), nil
+			})
+			exports.Add("files", func(ctx context.Context, userID string) (any, error) {
+				return userFiles.List(ctx, userID)
+			})
+			exports.Add("audit", func(_ context.Context, userID string) (any, error) {
+				return auditLog.ListFor(userID), nil
+			})
+			exports.Register(api, app)
+			exportGC := upload.NewGC(exports.Storage(), cfg.Uploads.GCGrace, logger, registry)
+			exportGC.Own(export.Prefix, exports.Live)
+			if cfg.Uploads.GCInterval > 0 {
+				hooks.Append(lifecycle.Hook{
+					Name: "export-gc",
+					OnStart: func(context.Context) error {
+						exportGC.Start(cfg.Uploads.GCInterval)
+						return nil
+					},
+					OnStop: func(context.Context) error {
+						exportGC.Stop()
+						return nil
+					},
+				})
+			}
+		}
+		// What is kept about a user is erased step by step, each part of
+		// the app adding its own; the audit log and the account go last.
+		erasures := erasure.New(cfg.Erasure, db, queue, auditLog, logger)
+		erasures.Add("sessions", func(ctx context.Context, userID, _ string) error {
+			_, err := tokens.Sessions().RevokeAll(ctx, userID)
+			return err
+		})
+		erasures.Add("profile", func(ctx context.Context, userID, _ string) error {
+			return profiles.Delete(ctx, userID)
+		})
+		erasures.Add("files", func(ctx context.Context, userID, _ string) error {
+			_, err := userFiles.DeleteAll(ctx, userID)
+			return err
+		})
+		if exports != nil {
+			erasures.Add("exports", func(_ context.Context, userID, _ string) error {
+				exports.Forget(userID)
+				return nil
+			})
+		}
+		if consents != nil {
+			consents.Register(api, app)
+			if exports != nil {
+				exports.Add("consents", func(ctx context.Context, userID string) (any, error) {
+					return consents.History(ctx, userID)
+				})
+			}
+			erasures.Add("consents", consents.Anonymize)
+		}
+		erasures.Register(api)
+		hooks.Append(lifecycle.Hook{Name: "erasures", OnStart: erasures.Resume})
+		// Users are managed by users with the right roles rather than with
+		// the admin token, so these routes come before the /admin group
+		// and answer before its token check.
+		users.NewAdmin(accounts, tokens, auditLog, cfg.OIDC.GrantScopes).
+			Register(app.Group("/admin/users", tokens.Middleware(), accounts.Middleware()))
+
+		// Mail goes out from the job queue, so requests don't wait for the
+		// mail server.
+		mailer := mail.New(cfg.Mail, logger)
+		queuedMail := queue.Mailer(mailer)
+		notifier := notifications.New(cfg.Notify, logger, registry, db)
+		// Email addresses and phone numbers are kept sealed when there is
+		// a key for them.
+		var personal *pii.Cipher
+		if cfg.PII.Key != "" {
+			cipher, err := pii.New(cfg.PII)
+			if err != nil {
+				return nil, err
+			}
+			personal = cipher
+		}
+		notifier.UseCipher(personal)
+		auditLog.UsePseudonyms(personal)
+		erasures.Add("notifications", func(ctx context.Context, userID, _ string) error {
+			return notifier.Forget(ctx, userID)
+		})
+		var verification *auth.Verification
+		if cfg.Verify.Secret != "" {
+			verification = auth.NewVerification(cfg.Verify, queuedMail, db)
+			verification.UseCipher(personal)
+			erasures.Add("email", func(ctx context.Context, userID, _ string) error {
+				return verification.Forget(ctx, userID)
+			})
+			// New accounts are sent a link for the address their token
+			// gives.
+			bus.Subscribe(users.EventRegistered, func(ctx context.Context, event events.Event) {
+				email := event.Data["email"]
+				if email == "" {
+					return
+				}
+				if err := verification.Send(ctx, event.UserID, email); err != nil {
+					logger.ErrorContext(ctx, "sending verification link failed", slog.String("user", event.UserID), slog.String("error", err.Error()))
+				}
+			})
+			app.Get("/auth/verify-email", verification.ConfirmHandler)
+			api.Post("/me/verify-email", verification.ResendHandler)
+			for _, prefix := range cfg.Verify.Routes {
+				app.Use(prefix, verification.RequireVerified())
+			}
+			// Only confirmed addresses get mail.
+			notifier.AddChannel(notifications.Email{Sender: queuedMail, Address: verification.Email})
+		}
+		if cfg.Mail.WelcomeURL != "" {
+			address := func(ctx context.Context, userID string) (string, bool, error) {
+				if verification == nil {
+					return "", false, nil
+				}
+				return verification.Email(ctx, userID)
+			}
+			// Sent straight from the welcome job, which is tried again
+			// itself.
+			welcome.New(cfg.Mail.WelcomeURL, mailer, address, logger).Register(bus, queue)
+		}
+		if cfg.Notify.WebhookSecret != "" {
+			notifier.AddChannel(notifications.Webhook{Client: client, Secret: cfg.Notify.WebhookSecret})
+		}
+		if messages := cfg.Notify.Messaging; messages.AccountSID != "" {
+			if messages.From != "" {
+				notifier.AddChannel(notifications.Phone{Sender: messaging.NewSMS(messages, client)})
+			}
+			if messages.WhatsAppFrom != "" {
+				notifier.AddChannel(notifications.Phone{Sender: messaging.NewWhatsApp(messages, client)})
+			}
+		}
+		if cfg.Notify.WebPush.PrivateKey != "" {
+			sender, err := webpush.New(cfg.Notify.WebPush, client)
+			if err != nil {
+				return nil, err
+			}
+			push := notifications.NewPush(sender)
+			erasures.Add("push", func(_ context.Context, userID, _ string) error {
+				for _, subscription := range push.Subscriptions(userID) {
+					push.Unsubscribe(userID, subscription.Endpoint)
+				}
+				return nil
+			})
+			push.Register(api)
+			notifier.AddChannel(push)
+		}
+		notifier.Listen(bus)
+		notifier.Register(api)
+
+		ids, err := sequence.NewSnowflake(cfg.IDs.Node)
+		if err != nil {
+			return nil, err
+		}
+		connectionPools.Add("db", pools.SQL(db.DB))
+		breaker := database.NewBreaker(cfg.Database, logger, registry)
+		connectionPools.AddBreaker("db", breaker.State)
+		orderRepo = orders.NewBreakerRepository(orderRepo, breaker)
+		if exports != nil {
+			exports.Add("orders", func(ctx context.Context, userID string) (any, error) {
+				return orderRepo.ListByUser(ctx, userID)
+			})
+		}
+		erasures.Add("orders", func(ctx context.Context, userID, pseudonym string) error {
+			_, err := orders.Anonymize(ctx, orderRepo, userID, pseudonym)
+			return err
+		})
+		erasures.Add("audit", func(_ context.Context, userID, pseudonym string) error {
+			auditLog.Anonymize(userID, pseudonym)
+			return nil
+		})
+		erasures.Add("account", func(ctx context.Context, userID, _ string) error {
+			_, err := accounts.Delete(ctx, userID)
+			return err
+		})
+		for i, replica := range db.Replicas() {
+			connectionPools.Add("db-replica-"+strconv.Itoa(i+1), pools.SQL(replica))
+		}
+		eventOutbox := outbox.New(db, bus, logger)
+		hooks.Append(lifecycle.Hook{
+			Name:    "database",
+			OnStart: db.PingContext,
+			OnStop:  func(context.Context) error { return db.Close() },
+		})
+		hooks.Append(lifecycle.Hook{
+			Name: "outbox",
+			OnStart: func(context.Context) error {
+				eventOutbox.Start()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				eventOutbox.Stop()
+				return nil
+			},
+		})
+		// Only the routes registered from here on, which keep their data
+		// in the database, run in transactions.
+		transactions := database.Middleware(db.DB, breaker)
+		api.Use(transactions)
+		app.Use("/payments/webhook", transactions)
+		if stores.Cache != nil {
+			cached := orders.NewCachedRepository(orderRepo, stores.Cache, cfg.Cache.TTL, registry)
+			warm.Add("orders", func(ctx context.Context) error {
+				return cached.Warm(ctx, cfg.Cache.Warmup)
+			})
+			orderRepo = cached
+		}
+		orderService := orders.NewService(orderRepo, bus, ids)
+		orderService.UseOutbox(database.NewUnitOfWork(db.DB), eventOutbox)
+		table.Register(api, orderService.Routes(accounts.RequirePermission("orders:write")))
+		// For browsers, signed in through the OIDC login if there is one.
+		// Like /admin/users, before the /admin group's token check.
+		loginURL := ""
+		if cfg.OIDC.Issuer != "" {
+			loginURL = "/auth/oidc/login"
+		}
+		pages := adminui.New(accounts, auditLog, tokens, static.URL)
+		pages.AddQueue("outbox", eventOutbox.Backlog)
+		pages.AddQueue("jobs", func(context.Context) (outbox.Backlog, error) {
+			backlog := queue.Backlog()
+			return outbox.Backlog{Pending: backlog.Pending, Oldest: backlog.Oldest}, nil
+		})
+		table.Register(app.Group(adminui.Prefix, tokens.CookieMiddleware(loginURL), accounts.Middleware(), zones), pages.Routes())
+		if cfg.Web.BaseURL != "" {
+			// For staff, who subscribe with the admin token as the basic
+			// auth password. Unnamed, to stay out of the sitemap.
+			staff, err := chains.Build("admin")
+			if err != nil {
+				return nil, err
+			}
+			table.Register(app, []routing.Route{
+				{Method: fiber.MethodGet, Path: "/web/feed.xml", Handler: orderService.FeedHandler(cfg.Web.BaseURL), Middlewares: staff},
+			})
+		}
+		if cfg.Payments.Provider == "sandbox" {
+			sandbox := payments.NewSandbox(cfg.Payments, client, logger)
+			sandbox.Register(app)
+			payments.New(sandbox, orderService, db, logger).Register(api, app)
+		}
+	}
+	api.Get("/dashboard", requireScope("dashboard:read"), dashboard.Handler(dashboard.HTTPSources(client, cfg.Dashboard)))
+	api.Get("/me/usage", meter.UsageHandler)
+
+	upstreams := proxy.New(cfg.Proxy, client, logger)
+	upstreams.Register(app.Group("/proxy"))
+	hooks.Append(lifecycle.Hook{
+		Name: "upstreams",
+		OnStart: func(context.Context) error {
+			upstreams.Start()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			upstreams.Stop()
+			return nil
+		},
+	})
+
+	admin := app.Group("/admin")
+	if err := chains.Apply(admin, "", "admin"); err != nil {
+		return nil, err
+	}
+	table.Register(admin, []routing.Route{
+		{Method: fiber.MethodGet, Path: "/upstreams", Name: "admin.upstreams", Handler: upstreams.StatusHandler},
+		{Method: fiber.MethodGet, Path: "/status", Name: "admin.status", Handler: connectionPools.StatusHandler},
+		{Method: fiber.MethodGet, Path: "/loglevel", Name: "admin.loglevel", Handler: logging.GetLevel(logLevel)},
+		{Method: fiber.MethodPut, Path: "/loglevel", Name: "admin.loglevel.set", Handler: logging.SetLevel(logLevel, logger)},
+		{Method: fiber.MethodGet, Path: "/csp-reports", Name: "admin.csp-reports", Handler: cspReports.SummaryHandler},
+		{Method: fiber.MethodGet, Path: "/features", Name: "admin.features", Handler: flags.Handler},
+		{Method: fiber.MethodPost, Path: "/config/reload", Name: "admin.config.reload", Handler: watcher.Handler},
+		{Method: fiber.MethodGet, Path: "/routes", Name: "admin.routes", Handler: table.Handler},
+		{Method: fiber.MethodGet, Path: "/middleware", Name: "admin.middleware", Handler: chains.Handler},
+	})
+	limits.Register(admin.Group("/ratelimits"))
+	if userFiles != nil {
+		userFiles.RegisterQuarantine(admin.Group("/quarantine"), auditLog)
+	}
+
+	monitoring := monitor.New(app, httpMetrics, time.Second, reporter)
+	monitoring.Register(admin.Group("/monitor"))
+	hooks.Append(lifecycle.Hook{Name: "monitor", OnStop: func(context.Context) error {
+		monitoring.Close()
+		return nil
+	}})
+
+	if cfg.Debug.Enabled {
+		debug := app.Group("/debug")
+		if err := chains.Apply(debug, "", "admin"); err != nil {
+			return nil, err
+		}
+		debug.Use(pprof.New(), expvar.New())
+		dumper.Register(debug)
+	}
+
+	// Last, to answer what the routes above don't.
+	app.Use(routing.Fallback(app, "/web"))
+
+	if cfg.GRPC.Addr != "" {
+		options := grpcserver.Options{Logger: logger, Registry: registry, Reporter: reporter}
+		if tokens != nil {
+			options.Tokens = tokens
+		}
+		rpc := grpcserver.New(cfg.GRPC, options)
+		// Serving once the caches are warm, like /readyz.
+		warm.Add("grpc", func(context.Context) error {
+			rpc.SetServing(true)
+			return nil
+		})
+		hooks.Append(lifecycle.Hook{Name: "grpc", OnStart: rpc.Start, OnStop: rpc.Stop})
+	}
+
+	// Last, so the caches warm up once everything they load from runs.
+	hooks.Append(lifecycle.Hook{Name: "warmup", OnStart: warm.Start, OnStop: warm.Stop})
+	if err := hooks.Start(context.Background()); err != nil {
+		return nil, err
+	}
+	app.Hooks().OnShutdown(func() error {
+		return hooks.Stop(context.Background())
+	})
+	return app, nil
+}
+
+// principal tells the rate limiter who sent a request: the API key it was
+// sent with, the holder of the admin token, the user of its bearer token or
+// else its IP. Whether the token's session was revoked is left to the
+// routes that need the user.
+func principal(c *fiber.Ctx, adminToken string, tokens *auth.Tokens, accounts *users.Users) ratelimit.Principal {
+	if key, ok := apikeys.From(c); ok {
+		return ratelimit.Principal{Tier: ratelimit.PlanPrefix + key.Plan, ID: "key:" + key.Name}
+	}
+	if middleware.HasAdminToken(c, adminToken) {
+		return ratelimit.Principal{Tier: ratelimit.Admin, ID: "admin-token"}
+	}
+	if scheme, token, _ := strings.Cut(c.Get(fiber.HeaderAuthorization), " "); tokens != nil && strings.EqualFold(scheme, "bearer") && token != "" {
+		if claims, err := tokens.Verify(c.UserContext(), token); err == nil {
+			tier := ratelimit.User
+			if admin, _ := accounts.HasRole(c.UserContext(), claims.Subject, "admin"); admin {
+				tier = ratelimit.Admin
+			}
+			return ratelimit.Principal{Tier: tier, ID: "user:" + claims.Subject}
+		}
+	}
+	return ratelimit.Principal{Tier: ratelimit.Anonymous, ID: "ip:" + middleware.RealIP(c)}
+}
+
+// orderRepository opens the database orders are kept in and migrates its
+// schema, along with the tables of migrations, which other parts of the
+// app keep in the same database. It also returns the database, for the
+// transactions the repository takes part in.
+func orderRepository(cfg config.DatabaseConfig, instrumentation *database.Instrumentation, migrations ...database.Migration) (orders.Repository, *database.DB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if cfg.ORM == "gorm" {
+		gormDB, err := database.OpenGorm(cfg, instrumentation)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool, err := gormDB.DB()
+		if err != nil {
+			return nil, nil, err
+		}
+		db := &database.DB{DB: pool, Dialect: database.DialectOf(cfg.DSN)}
+		if cfg.AutoMigrate {
+			if err := orders.AutoMigrate(gormDB.WithContext(ctx)); err != nil {
+				return nil, nil, err
+			}
+			if err := db.Migrate(ctx, append(outbox.Migrations, migrations...)...); err != nil {
+				return nil, nil, err
+			}
+		}
+		return orders.NewGormRepository(gormDB), db, nil
+	}
+
+	db, err := database.Open(cfg, instrumentation)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := db.Migrate(ctx, append(append(orders.Migrations, outbox.Migrations...), migrations...)...); err != nil {
+		return nil, nil, err
+	}
+	return orders.NewSQLRepository(db), db, nil
+}
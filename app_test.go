@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/captcha"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+// benchAddrEnv tells prefork children which address BenchmarkJSON listens on.
+const benchAddrEnv = "BENCH_ADDR"
+
+func TestMain(m *testing.M) {
+	// Prefork children re-run this binary; serve instead of testing again.
+	if fiber.IsChild() {
+		app, err := newApp(benchConfig(os.Getenv(benchAddrEnv), true))
+		if err != nil {
+			panic(err)
+		}
+		if err := app.Listen(os.Getenv(benchAddrEnv)); err != nil {
+			panic(err)
+		}
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	cfg := config.Default()
+	cfg.Admin.Token = "rahasia"
+	app, err := newApp(cfg)
+	assert.Nil(t, err)
+
+	testkit.Do(t, app, "GET", "/admin/upstreams", nil).AssertStatus(401)
+	testkit.Do(t, app, "GET", "/admin/upstreams", nil, testkit.WithAuth("rahasia")).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/admin/status", nil, testkit.WithAuth("rahasia")).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/admin/routes", nil, testkit.WithAuth("rahasia")).AssertStatus(200).
+		AssertContains(`{"method":"GET","path":"/admin/routes","name":"admin.routes"}`)
+	testkit.Do(t, app, "GET", "/admin/middleware", nil, testkit.WithAuth("rahasia")).AssertStatus(200).
+		AssertContains(`"public-api":{"applied":["timezone"],"skipped":["jwt","rbac","impersonation","consent"]}`)
+}
+
+func TestAdminDisabledWithoutToken(t *testing.T) {
+	app, err := newApp(config.Default())
+	assert.Nil(t, err)
+
+	testkit.Do(t, app, "GET", "/admin/upstreams", nil, testkit.WithAuth("")).AssertStatus(401)
+}
+
+func TestUnknownRoutes(t *testing.T) {
+	app, err := newApp(config.Default())
+	assert.Nil(t, err)
+
+	testkit.Do(t, app, "GET", "/metric", nil).AssertStatus(404).
+		AssertJSON(`{"error": "Cannot GET /metric", "suggestions": ["/metrics"]}`)
+	testkit.Do(t, app, "DELETE", "/metrics", nil).AssertStatus(405).AssertHeader("Allow", "GET, HEAD")
+	testkit.Do(t, app, "GET", "/web/nothing", nil).AssertStatus(404).AssertContains("<h1>Not Found</h1>")
+}
+
+func TestRoutingPolicy(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.StrictRouting = true
+	cfg.Server.CaseSensitive = true
+	app, err := newApp(cfg)
+	assert.Nil(t, err)
+
+	testkit.Do(t, app, "GET", "/metrics/", nil).AssertStatus(404)
+	testkit.Do(t, app, "GET", "/Metrics", nil).AssertStatus(404).
+		AssertJSON(`{"error": "Cannot GET /Metrics", "suggestions": ["/metrics"]}`)
+
+	cfg.Server.CanonicalPaths = true
+	app, err = newApp(cfg)
+	assert.Nil(t, err)
+	testkit.Do(t, app, "GET", "/metrics/", nil).AssertStatus(308).AssertHeader("Location", "/metrics")
+}
+
+func TestMethodOverride(t *testing.T) {
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.Admin.Token = "rahasia"
+	cfg.Override.FormRoutes = []string{"/admin"}
+	app, err := newApp(cfg)
+	assert.Nil(t, err)
+
+	testkit.DoForm(t, app, "POST", "/admin/loglevel", url.Values{"_method": {"PUT"}, "level": {"warn"}},
+		testkit.WithAuth("rahasia")).AssertStatus(200).AssertJSON(`{"level": "warn"}`)
+	testkit.Do(t, app, "GET", "/admin/loglevel", nil, testkit.WithAuth("rahasia")).AssertJSON(`{"level": "warn"}`)
+}
+
+func TestHealthz(t *testing.T) {
+	cfg := config.Default()
+	cfg.Admission.MaxInFlight = 1
+	app, err := newApp(cfg)
+	assert.Nil(t, err)
+	testkit.Do(t, app, "GET", "/healthz", nil).AssertStatus(200).AssertBody("ok")
+	testkit.Do(t, app, "GET", "/favicon.ico", nil).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/static/app.css", nil).AssertStatus(200)
+	assert.Eventually(t, func() bool {
+		return testkit.Do(t, app, "GET", "/readyz", nil).StatusCode == 200
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cfg.Admission.Reserved = 1
+	assert.NotNil(t, cfg.Validate())
+}
+
+func TestConfigReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(yaml string) { assert.Nil(t, os.WriteFile(path, []byte(yaml), 0o600)) }
+	write("admin:\n  token: rahasia\n")
+	t.Setenv("CONFIG_FILE", path)
+	cfg, err := config.Load()
+	assert.Nil(t, err)
+	app, err := newApp(cfg)
+	assert.Nil(t, err)
+	defer app.Shutdown()
+	admin := testkit.WithAuth("rahasia")
+
+	write("admin:\n  token: rahasia\n  maintenance:\n    enabled: true\nlog:\n  level: warn\nfeatures:\n  checkout: true\n")
+	assert.Eventually(t, func() bool {
+		return testkit.Do(t, app, "GET", "/api/dashboard", nil).StatusCode == 503
+	}, 5*time.Second, 20*time.Millisecond)
+	// Health checks and operators still get through.
+	testkit.Do(t, app, "GET", "/healthz", nil).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/admin/loglevel", nil, admin).AssertJSON(`{"level":"warn"}`)
+	testkit.Do(t, app, "GET", "/admin/features", nil, admin).AssertJSON(`{"enabled":["checkout"]}`)
+
+	write("admin:\n  token: rahasia\n")
+	assert.Eventually(t, func() bool {
+		return testkit.Do(t, app, "GET", "/api/dashboard", nil).StatusCode == 200
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestInvalidLogLevel(t *testing.T) {
+	cfg := config.Default()
+	cfg.Log.Level = "loud"
+	_, err := newApp(cfg)
+	assert.NotNil(t, err)
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	cfg := config.Default()
+	cfg.Admin.Token = "rahasia"
+
+	app, err := newApp(cfg)
+	assert.Nil(t, err)
+	testkit.Do(t, app, "GET", "/debug/vars", nil, testkit.WithAuth("rahasia")).AssertStatus(404)
+
+	cfg.Debug.Enabled = true
+	app, err = newApp(cfg)
+	assert.Nil(t, err)
+
+	testkit.Do(t, app, "GET", "/debug/pprof/", nil).AssertStatus(401)
+	testkit.Do(t, app, "GET", "/debug/dump", nil).AssertStatus(401)
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine", "/debug/vars", "/debug/dump"} {
+		testkit.Do(t, app, "GET", path, nil, testkit.WithAuth("rahasia")).AssertStatus(200)
+	}
+}
+
+func TestAdminBasicAuth(t *testing.T) {
+	cfg := config.Default()
+	cfg.Admin.Token = "rahasia"
+	app, err := newApp(cfg)
+	assert.Nil(t, err)
+
+	testkit.Do(t, app, "GET", "/admin/monitor", nil).
+		AssertStatus(401).
+		AssertHeader("WWW-Authenticate", `Basic realm="admin"`)
+	testkit.Do(t, app, "GET", "/admin/monitor", nil, testkit.WithBasicAuth("admin", "rahasia")).AssertStatus(200)
+}
+
+// BenchmarkJSON requests a JSON endpoint through the whole middleware stack
+// over loopback, with and without prefork. Prefork only pays off once a
+// single process can't keep every core busy, so compare with several CPUs:
+//
+//	go test -run '^$' -bench JSON -cpu 1,4
+func BenchmarkJSON(b *testing.B) {
+	for _, prefork := range []bool{false, true} {
+		addr := startBenchServer(b, prefork)
+		b.Run(fmt.Sprintf("prefork=%t", prefork), func(b *testing.B) {
+			client := &fasthttp.Client{MaxConnsPerHost: 1024}
+			b.RunParallel(func(pb *testing.PB) {
+				request := fasthttp.AcquireRequest()
+				response := fasthttp.AcquireResponse()
+				defer fasthttp.ReleaseRequest(request)
+				defer fasthttp.ReleaseResponse(response)
+				request.SetRequestURI("http://" + addr + "/admin/upstreams")
+				request.Header.Set("Authorization", "Bearer rahasia")
+				for pb.Next() {
+					if err := client.Do(request, response); err != nil {
+						b.Fatal(err)
+					}
+					if response.StatusCode() != 200 {
+						b.Fatalf("status %d", response.StatusCode())
+					}
+				}
+			})
+		})
+	}
+}
+
+func benchConfig(addr string, prefork bool) *config.Config {
+	cfg := config.Default()
+	cfg.Addr = addr
+	cfg.Server.Prefork = prefork
+	cfg.Admin.Token = "rahasia"
+	cfg.Log.Level = "error"
+	return cfg
+}
+
+func startBenchServer(b *testing.B, prefork bool) string {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	b.Setenv(benchAddrEnv, addr)
+
+	app, err := newApp(benchConfig(addr, prefork))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var children []int
+	app.Hooks().OnFork(func(pid int) error {
+		children = append(children, pid)
+		return nil
+	})
+	go app.Listen(addr)
+	b.Cleanup(func() {
+		for _, pid := range children {
+			if child, err := os.FindProcess(pid); err == nil {
+				child.Kill()
+			}
+		}
+		app.Shutdown()
+	})
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr
+		}
+	}
+	b.Fatal("server didn't start")
+	return ""
+}
+
+// writeJWTKey writes a new signing key for tokens, returning its path.
+func writeJWTKey(t testing.TB) string {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	assert.Nil(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	return path
+}
+
+// userScopes are the scopes users log in with, which the tokens of the
+// tests acting as users are granted.
+var userScopes = config.Default().OIDC.GrantScopes
+
+func TestAPIRequiresTokenWithJWT(t *testing.T) {
+	cfg := config.Default()
+	cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+	cfg.Database.SQLitePath = ":memory:"
+	app, err := newApp(cfg)
+	assert.Nil(t, err)
+
+	testkit.Do(t, app, "GET", "/api/dashboard", nil).AssertStatus(401)
+	testkit.Do(t, app, "GET", "/.well-known/jwks.json", nil).AssertStatus(200)
+}
+
+func TestAPIRequiresScopes(t *testing.T) {
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+	cfg.Database.SQLitePath = ":memory:"
+	cfg.RateLimit.Rules = nil
+	cfg.APIKeys.Keys = []config.APIKey{
+		{Name: "reporting", Key: "reporting-secret", Plan: "free", Scopes: []string{"orders:read"}},
+		{Name: "bare", Key: "bare-secret", Plan: "free"},
+	}
+	app, err := newApp(cfg)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	tokens, err := auth.New(cfg.JWT, nil, nil)
+	assert.Nil(t, err)
+	reader, err := tokens.Sign("alice", "orders:read")
+	assert.Nil(t, err)
+
+	testkit.Do(t, app, "GET", "/api/orders", nil, testkit.WithAuth(reader)).AssertStatus(200)
+	testkit.Do(t, app, "POST", "/api/orders", strings.NewReader(`{"items":[{"sku":"kopi","quantity":1,"price":25000}]}`),
+		testkit.WithAuth(reader), testkit.WithHeader("Content-Type", "application/json")).
+		AssertStatus(403).
+		AssertContains(`missing scope "orders:write"`)
+	testkit.Do(t, app, "GET", "/api/me", nil, testkit.WithAuth(reader)).
+		AssertStatus(403).
+		AssertContains(`missing scope "users:read"`)
+
+	// API keys are granted their scopes, and none without.
+	testkit.Do(t, app, "GET", "/api/orders", nil, testkit.WithHeader("X-Api-Key", "reporting-secret")).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/api/files", nil, testkit.WithHeader("X-Api-Key", "reporting-secret")).
+		AssertStatus(403).
+		AssertContains(`missing scope "files:read"`)
+	testkit.Do(t, app, "GET", "/api/orders", nil, testkit.WithHeader("X-Api-Key", "bare-secret")).
+		AssertStatus(403).
+		AssertContains(`missing scope "orders:read"`)
+}
+
+func TestRateLimitsAndQuotas(t *testing.T) {
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.Admin.Token = "rahasia"
+	cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+	cfg.Database.SQLitePath = ":memory:"
+	cfg.RBAC.Admins = []string{"root"}
+	cfg.APIKeys.Keys = []config.APIKey{{Name: "ci", Key: "ci-secret", Plan: "pro", Scopes: []string{"users:read"}}}
+	cfg.APIKeys.Plans = map[string]config.APIPlan{"pro": {MonthlyRequests: 100}}
+	cfg.RateLimit.Rules = []config.RateLimitRule{
+		{Name: "anonymous", Routes: []string{"/api"}, Tiers: []string{"anonymous"}, Limit: 1},
+		{Name: "users", Routes: []string{"/api"}, Tiers: []string{"user"}, Limit: 2},
+		{Name: "pro", Routes: []string{"/api"}, Tiers: []string{"plan:pro"}, Limit: 3},
+	}
+	app, err := newApp(cfg)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	tokens, err := auth.New(cfg.JWT, nil, nil)
+	assert.Nil(t, err)
+	alice, err := tokens.Sign("alice", userScopes...)
+	assert.Nil(t, err)
+	root, err := tokens.Sign("root")
+	assert.Nil(t, err)
+
+	testkit.Do(t, app, "GET", "/api/dashboard", nil).AssertStatus(401).AssertHeader("X-RateLimit-Limit", "1")
+	testkit.Do(t, app, "GET", "/api/dashboard", nil).AssertStatus(429)
+	testkit.Do(t, app, "GET", "/api/dashboard", nil, testkit.WithAuth(alice)).AssertHeader("X-RateLimit-Limit", "2")
+	testkit.Do(t, app, "GET", "/api/dashboard", nil, testkit.WithHeader("X-Api-Key", "ci-secret")).AssertHeader("X-RateLimit-Limit", "3")
+	testkit.Do(t, app, "GET", "/api/dashboard", nil, testkit.WithHeader("X-Api-Key", "wrong")).AssertStatus(401)
+	testkit.Do(t, app, "GET", "/api/me/usage", nil, testkit.WithHeader("X-Api-Key", "ci-secret")).AssertStatus(200).
+		AssertHeader("X-Quota-Requests-Remaining", "98").
+		AssertContains(`"keys":[{"name":"ci","plan":"pro","requests":1,`)
+	// No rule covers admins.
+	testkit.Do(t, app, "GET", "/api/dashboard", nil, testkit.WithAuth(root)).AssertStatus(403).AssertHeader("X-RateLimit-Limit", "")
+
+	// The rules are reloaded from the configuration file, unlike the
+	// settings this test started with, which take a restart.
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(`
+rate_limits:
+  rules:
+    - name: anonymous
+      routes: [/api]
+      tiers: [anonymous]
+      limit: 5
+`), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+	testkit.Do(t, app, "POST", "/admin/config/reload", nil, testkit.WithAuth("rahasia")).AssertStatus(200).
+		AssertJSON(`{"changed":["log.level","rate_limits"],"restart_needed":true}`)
+	testkit.Do(t, app, "GET", "/api/dashboard", nil).AssertStatus(401).AssertHeader("X-RateLimit-Limit", "5")
+	testkit.Do(t, app, "GET", "/api/dashboard", nil, testkit.WithAuth(alice)).AssertHeader("X-RateLimit-Limit", "")
+	testkit.Do(t, app, "GET", "/admin/ratelimits", nil, testkit.WithAuth("rahasia")).
+		AssertJSON(`{"rules":[{"name":"anonymous","routes":["/api"],"tiers":["anonymous"],"limit":5,"window":"1m0s"}]}`)
+}
+
+func TestExternalServices(t *testing.T) {
+	services := testkit.NewServices(t)
+	idp := services.IdP()
+	provider := services.PaymentProvider()
+	services.DashboardSource("weather", `{"temp": 31}`)
+
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+	cfg.Database.SQLitePath = ":memory:"
+	cfg.OIDC.GrantScopes = append(cfg.OIDC.GrantScopes, "dashboard:read")
+	cfg.Payments.SandboxDelay = 0
+	services.Configure(cfg)
+	app, err := newApp(cfg)
+	assert.Nil(t, err)
+
+	// Log in with the IdP.
+	login := testkit.Do(t, app, "GET", "/auth/oidc/login", nil).AssertStatus(302)
+	callback, err := url.Parse(idp.Login(login.Header.Get("Location"), "alice", nil))
+	assert.Nil(t, err)
+	var session struct {
+		AccessToken string `json:"access_token"`
+	}
+	testkit.Do(t, app, "GET", callback.RequestURI(), nil, testkit.WithCookie(login.Cookie("oidc_login"))).
+		AssertStatus(200).
+		JSON(&session)
+	testkit.Do(t, app, "GET", "/api/dashboard", nil, testkit.WithAuth(session.AccessToken)).
+		AssertStatus(200).
+		AssertContains(`"weather":{"temp":31}`)
+	// The IdP's own tokens are accepted too.
+	testkit.Do(t, app, "GET", "/api/orders", nil, testkit.WithAuth(idp.Token("alice", map[string]any{"scope": "orders:read"}))).AssertStatus(200)
+
+	// Pay an order: the sandbox reports the outcome to the provider,
+	// which passes it on to the app.
+	var order struct{ ID, Status string }
+	testkit.DoJSON(t, app, "POST", "/api/orders", map[string]any{
+		"items": []map[string]any{{"sku": "kopi", "quantity": 1, "price": 25000}},
+	}, &order, testkit.WithAuth(session.AccessToken)).AssertStatus(201)
+	var intent struct{ ID string }
+	testkit.Do(t, app, "POST", "/api/orders/"+order.ID+"/pay", nil, testkit.WithAuth(session.AccessToken)).
+		AssertStatus(201).
+		JSON(&intent)
+	testkit.Do(t, app, "POST", "/payments/sandbox/"+intent.ID+"?outcome=succeeded", nil).AssertStatus(202)
+
+	webhook := provider.WaitFor(1)[0]
+	assert.Equal(t, "/payments/webhook", webhook.Path)
+	testkit.Do(t, app, "POST", "/payments/webhook", bytes.NewReader(webhook.Body),
+		testkit.WithHeader("Content-Type", "application/json"),
+		testkit.WithHeader("X-Sandbox-Signature", webhook.Header.Get("X-Sandbox-Signature"))).
+		AssertStatus(204)
+	testkit.DoJSON(t, app, "GET", "/api/orders/"+order.ID, nil, &order, testkit.WithAuth(session.AccessToken))
+	assert.Equal(t, "paid", order.Status)
+	testkit.Send(t, app, provider.Webhook("pi_unknown", "succeeded")).AssertStatus(404)
+
+	// The product metrics count what happened, the order events once the
+	// outbox relayed them.
+	metrics := testkit.Do(t, app, "GET", "/metrics", nil).AssertStatus(200)
+	metrics.AssertContains("users_registered_total 1\n").
+		AssertContains("user_logins_total 1\n").
+		AssertContains(`users_accounts{status="active"} 1`)
+	assert.Eventually(t, func() bool {
+		return strings.Contains(testkit.Do(t, app, "GET", "/metrics", nil).String(), `orders_total{status="paid"} 1`)
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestAdminPages(t *testing.T) {
+	services := testkit.NewServices(t)
+	idp := services.IdP()
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+	cfg.Database.SQLitePath = ":memory:"
+	cfg.RBAC.Admins = []string{"root"}
+	services.Configure(cfg)
+	app, err := newApp(cfg)
+	assert.Nil(t, err)
+
+	// Browsers without a session are sent to log in, and back.
+	login := testkit.Do(t, app, "GET", "/admin/pages/jobs", nil).AssertStatus(302)
+	login = testkit.Do(t, app, "GET", login.Header.Get("Location"), nil).AssertStatus(302)
+	callback, err := url.Parse(idp.Login(login.Header.Get("Location"), "root", nil))
+	assert.Nil(t, err)
+	signedIn := testkit.Do(t, app, "GET", callback.RequestURI(), nil, testkit.WithCookie(login.Cookie("oidc_login"))).
+		AssertStatus(302)
+	assert.Equal(t, "/admin/pages/jobs", signedIn.Header.Get("Location"))
+	session := testkit.WithCookie(signedIn.Cookie("session"))
+
+	testkit.Do(t, app, "GET", "/admin/pages/jobs", nil, session).AssertStatus(200).AssertContains("<td>outbox</td>")
+	testkit.Do(t, app, "GET", "/admin/pages/users", nil, session).AssertStatus(200).AssertContains("<td>root</td>")
+	// Times are shown in the zone the browser asks for.
+	testkit.Do(t, app, "GET", "/admin/pages/users", nil, session, testkit.WithHeader("X-Timezone", "Asia/Jakarta")).
+		AssertStatus(200).AssertContains(" WIB</td>")
+	testkit.Do(t, app, "GET", "/admin/pages/audit", nil, session).AssertStatus(200)
+	testkit.Do(t, app, "POST", "/admin/pages/logout", nil, session).AssertStatus(303)
+	testkit.Do(t, app, "GET", "/admin/pages/users", nil, session).AssertStatus(302)
+}
+
+func TestLoginAsksForCaptcha(t *testing.T) {
+	services := testkit.NewServices(t)
+	services.IdP()
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+	cfg.Database.SQLitePath = ":memory:"
+	cfg.Captcha.Provider = "noop"
+	cfg.Captcha.Threshold = 0
+	services.Configure(cfg)
+	app, err := newApp(cfg)
+	assert.Nil(t, err)
+
+	testkit.Do(t, app, "GET", "/auth/oidc/login", nil).AssertStatus(403)
+	testkit.Do(t, app, "GET", "/auth/oidc/login", nil, testkit.WithHeader(captcha.HeaderToken, "solved")).AssertStatus(302)
+	testkit.Do(t, app, "GET", "/auth/oidc/login?captcha_token=solved", nil).AssertStatus(302)
+}
+
+func TestUploadsAreOnlySentToTheirOwners(t *testing.T) {
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+	cfg.Database.SQLitePath = ":memory:"
+	cfg.Uploads.Dir = t.TempDir()
+	app, err := newApp(cfg)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	tokens, err := auth.New(cfg.JWT, nil, nil)
+	assert.Nil(t, err)
+	alice, err := tokens.Sign("alice", "files:read", "files:write")
+	assert.Nil(t, err)
+	bob, err := tokens.Sign("bob", "files:read", "files:write")
+	assert.Nil(t, err)
+
+	body, contentType := testkit.Multipart(t, nil, testkit.File{Field: "file", Name: "page.html", Data: []byte("<script>alert(1)</script>")})
+	var file struct{ ID, URL string }
+	testkit.Do(t, app, "POST", "/api/files", body, contentType, testkit.WithAuth(alice)).AssertStatus(201).JSON(&file)
+
+	testkit.Do(t, app, "GET", "/files/files/"+file.ID, nil).AssertStatus(404)
+	testkit.Do(t, app, "GET", file.URL, nil, testkit.WithAuth(bob)).AssertStatus(404)
+	testkit.Do(t, app, "GET", file.URL, nil, testkit.WithAuth(alice)).
+		AssertStatus(200).
+		AssertHeader("Content-Disposition", "attachment; filename=page.html").
+		AssertHeader("X-Content-Type-Options", "nosniff")
+}
+
+func TestNewAccountsVerifyTheirEmail(t *testing.T) {
+	services := testkit.NewServices(t)
+	idp := services.IdP()
+	mailbox := services.Mailbox()
+
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+	cfg.Database.SQLitePath = ":memory:"
+	cfg.Verify.Secret = "verify-secret"
+	cfg.Verify.BaseURL = "http://app.test"
+	cfg.Verify.Routes = []string{"/api/orders"}
+	services.Configure(cfg)
+	app, err := newApp(cfg)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	// Register: log in with the IdP, whose ID token has the address.
+	login := testkit.Do(t, app, "GET", "/auth/oidc/login", nil).AssertStatus(302)
+	callback, err := url.Parse(idp.Login(login.Header.Get("Location"), "alice", map[string]any{"email": "alice@example.com"}))
+	assert.Nil(t, err)
+	var session struct {
+		AccessToken string `json:"access_token"`
+	}
+	testkit.Do(t, app, "GET", callback.RequestURI(), nil, testkit.WithCookie(login.Cookie("oidc_login"))).
+		AssertStatus(200).
+		JSON(&session)
+	testkit.Do(t, app, "GET", "/api/orders", nil, testkit.WithAuth(session.AccessToken)).AssertStatus(403)
+
+	// Get the link and open it.
+	message := mailbox.WaitFor(1)[0]
+	assert.Equal(t, "alice@example.com", message.To)
+	start := strings.Index(message.Body, "/auth/verify-email?")
+	if !assert.True(t, start >= 0, message.Body) {
+		t.FailNow()
+	}
+	link, _, _ := strings.Cut(message.Body[start:], "\n")
+	testkit.Do(t, app, "GET", link, nil).AssertStatus(200)
+
+	testkit.Do(t, app, "GET", "/api/orders", nil, testkit.WithAuth(session.AccessToken)).AssertStatus(200)
+}
@@ -0,0 +1,103 @@
+// Package assets serves the static files of the pages, embedded in the
+// binary, under URLs that change with their content, so browsers may cache
+// them for good.
+package assets
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/routing"
+)
+
+//go:embed static
+var embedded embed.FS
+
+// Static returns the embedded static files.
+func Static() fs.FS {
+	static, _ := fs.Sub(embedded, "static")
+	return static
+}
+
+const (
+	immutable = "public, max-age=31536000, immutable"
+	// Files asked for by their plain names may change under them.
+	revalidate = "no-cache"
+)
+
+type file struct {
+	name string
+	data []byte
+}
+
+// Assets serves the files of a file system under a prefix: app.css as
+// <prefix>/app.<hash>.css, where the hash is of its content, and also as
+// <prefix>/app.css for what can't know the hash.
+type Assets struct {
+	prefix string
+	hashed map[string]string
+	files  map[string]file
+}
+
+// New reads the files of fsys and hashes them.
+func New(fsys fs.FS, prefix string) (*Assets, error) {
+	a := &Assets{prefix: strings.TrimSuffix(prefix, "/"), hashed: map[string]string{}, files: map[string]file{}}
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:5]) + ext
+		a.hashed[name] = hashed
+		a.files[hashed] = file{name: name, data: data}
+		a.files[name] = file{name: name, data: data}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// URL returns the URL of the named file that changes with its content.
+// Templates call it as asset "app.css", once added to the views engine
+// with AddFunc("asset", assets.URL).
+func (a *Assets) URL(name string) (string, error) {
+	hashed, ok := a.hashed[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return "", fmt.Errorf("assets: no file %s", name)
+	}
+	return a.prefix + "/" + hashed, nil
+}
+
+// Routes declares the route the files are served on, to register on the
+// app.
+func (a *Assets) Routes() []routing.Route {
+	return []routing.Route{{Method: fiber.MethodGet, Path: a.prefix + "/*", Name: "assets", Handler: a.Handler}}
+}
+
+func (a *Assets) Handler(c *fiber.Ctx) error {
+	name := c.Params("*")
+	f, ok := a.files[name]
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	if _, plain := a.hashed[name]; plain {
+		c.Set(fiber.HeaderCacheControl, revalidate)
+	} else {
+		c.Set(fiber.HeaderCacheControl, immutable)
+	}
+	c.Type(path.Ext(f.name))
+	return c.Send(f.data)
+}
@@ -0,0 +1,87 @@
+package assets
+
+import (
+	"html/template"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/routing"
+	"github.com/stretchr/testify/assert"
+)
+
+func newApp(t *testing.T, fsys fstest.MapFS) (*fiber.App, *Assets) {
+	static, err := New(fsys, "/static")
+	assert.Nil(t, err)
+	app := fiber.New()
+	routing.Register(app, static.Routes())
+	return app, static
+}
+
+func get(t *testing.T, app *fiber.App, path string) (int, string, string) {
+	response, err := app.Test(httptest.NewRequest("GET", path, nil))
+	assert.Nil(t, err)
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	return response.StatusCode, response.Header.Get(fiber.HeaderCacheControl), string(body)
+}
+
+func TestHashedURLs(t *testing.T) {
+	app, static := newApp(t, fstest.MapFS{
+		"app.css":    {Data: []byte("body { margin: 0 }")},
+		"js/main.js": {Data: []byte("console.log(1)")},
+	})
+
+	css, err := static.URL("app.css")
+	assert.Nil(t, err)
+	assert.Regexp(t, `^/static/app\.[0-9a-f]{10}\.css$`, css)
+	js, err := static.URL("/js/main.js")
+	assert.Nil(t, err)
+	assert.Regexp(t, `^/static/js/main\.[0-9a-f]{10}\.js$`, js)
+
+	response, err := app.Test(httptest.NewRequest("GET", css, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "public, max-age=31536000, immutable", response.Header.Get(fiber.HeaderCacheControl))
+	assert.True(t, strings.HasPrefix(response.Header.Get(fiber.HeaderContentType), "text/css"))
+
+	status, cacheControl, body := get(t, app, "/static/app.css")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "no-cache", cacheControl)
+	assert.Equal(t, "body { margin: 0 }", body)
+
+	status, _, _ = get(t, app, "/static/app.0000000000.css")
+	assert.Equal(t, 404, status)
+	_, err = static.URL("missing.css")
+	assert.NotNil(t, err)
+}
+
+func TestHashChangesWithContent(t *testing.T) {
+	_, before := newApp(t, fstest.MapFS{"app.css": {Data: []byte("a {}")}})
+	_, after := newApp(t, fstest.MapFS{"app.css": {Data: []byte("b {}")}})
+	first, _ := before.URL("app.css")
+	second, _ := after.URL("app.css")
+	assert.NotEqual(t, first, second)
+}
+
+func TestTemplateFunc(t *testing.T) {
+	_, static := newApp(t, fstest.MapFS{"app.css": {Data: []byte("a {}")}})
+	page := template.Must(template.New("page").Funcs(template.FuncMap{"asset": static.URL}).
+		Parse(`<link rel="stylesheet" href="{{asset "app.css"}}">`))
+	var out strings.Builder
+	assert.Nil(t, page.Execute(&out, nil))
+	url, _ := static.URL("app.css")
+	assert.Equal(t, `<link rel="stylesheet" href="`+url+`">`, out.String())
+}
+
+func TestEmbedded(t *testing.T) {
+	static, err := New(Static(), "/static")
+	assert.Nil(t, err)
+	_, err = static.URL("favicon.ico")
+	assert.Nil(t, err)
+	_, err = static.URL("app.css")
+	assert.Nil(t, err)
+}
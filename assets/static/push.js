@@ -0,0 +1,33 @@
+// Subscribes this browser to the notifications of the signed-in user,
+// who authenticates the API calls with accessToken. Resolves to the
+// subscription, or rejects when the browser can't or won't allow push.
+async function subscribeToPush(accessToken) {
+  if (!("serviceWorker" in navigator) || !("PushManager" in window)) {
+    throw new Error("push is not supported by this browser");
+  }
+  const headers = { Authorization: "Bearer " + accessToken };
+  const registration = await navigator.serviceWorker.register("/static/sw.js");
+  const response = await fetch("/api/me/push/key", { headers });
+  if (!response.ok) {
+    throw new Error("push is not available: " + response.status);
+  }
+  const { public_key: key } = await response.json();
+  const subscription = await registration.pushManager.subscribe({
+    userVisibleOnly: true,
+    applicationServerKey: urlBase64ToBytes(key),
+  });
+  const saved = await fetch("/api/me/push/subscriptions", {
+    method: "POST",
+    headers: { ...headers, "Content-Type": "application/json" },
+    body: JSON.stringify(subscription),
+  });
+  if (!saved.ok) {
+    throw new Error("saving the subscription failed: " + saved.status);
+  }
+  return subscription;
+}
+
+function urlBase64ToBytes(value) {
+  const base64 = (value + "=".repeat((4 - (value.length % 4)) % 4)).replace(/-/g, "+").replace(/_/g, "/");
+  return Uint8Array.from(atob(base64), (c) => c.charCodeAt(0));
+}
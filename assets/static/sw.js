@@ -0,0 +1,17 @@
+// Shows the notifications the app pushes. Registered by push.js from its
+// plain, uncached URL so browsers pick up new versions.
+self.addEventListener("push", (event) => {
+  const n = event.data ? event.data.json() : {};
+  event.waitUntil(
+    self.registration.showNotification(n.title || "Notification", {
+      body: n.body,
+      tag: n.id,
+      data: n,
+    }),
+  );
+});
+
+self.addEventListener("notificationclick", (event) => {
+  event.notification.close();
+  event.waitUntil(self.clients.openWindow("/web/"));
+});
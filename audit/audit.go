@@ -0,0 +1,214 @@
+// Package audit records who did what to whom, for actions that change
+// other users' accounts.
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/geoip"
+	"github.com/jalal-akbar/belajar-golang-fiber/middleware"
+	"github.com/jalal-akbar/belajar-golang-fiber/pii"
+)
+
+// Entry is a recorded action. Country and City are where IP is
+// registered, when the geoip middleware located it.
+type Entry struct {
+	Time      time.Time         `json:"time"`
+	Actor     string            `json:"actor"`
+	Action    string            `json:"action"`
+	Target    string            `json:"target,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	IP        string            `json:"ip,omitempty"`
+	Country   string            `json:"country,omitempty"`
+	City      string            `json:"city,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+// subjectDetails are the details that name users, like Actor and Target.
+var subjectDetails = []string{"as", "user"}
+
+// Log writes entries to the logger and keeps the latest max of them in
+// memory for the admin endpoints.
+//
+// Anonymize only reaches the entries in memory. With UsePseudonyms the
+// logger is given pseudonymous subject IDs instead of user IDs, which
+// only the holder of the key can link to a user; without, the log sink
+// has to be scrubbed separately when an account is erased.
+type Log struct {
+	logger     *slog.Logger
+	max        int
+	now        func() time.Time
+	pseudonyms *pii.Cipher
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func New(logger *slog.Logger, max int) *Log {
+	return &Log{logger: logger, max: max, now: clock.System.Now}
+}
+
+// Record adds an entry for an action of the request's user, filling in the
+// time, the client address and its location, and the request ID. When an admin impersonates
+// the user, the admin is the actor and the user is named in Details["as"].
+func (l *Log) Record(c *fiber.Ctx, action, target string, details map[string]string) {
+	actor := ctxutil.CurrentUser(c)
+	if claims := auth.ClaimsFrom(c); claims != nil && claims.Actor != nil {
+		if details == nil {
+			details = map[string]string{}
+		}
+		details["as"] = utils.CopyString(actor)
+		actor = claims.Actor.Subject
+	}
+	ctx := correlation.Context(c)
+	location, _ := geoip.From(c)
+	l.Add(ctx, Entry{
+		Actor:     utils.CopyString(actor),
+		Action:    action,
+		Target:    utils.CopyString(target),
+		Details:   details,
+		IP:        utils.CopyString(middleware.RealIP(c)),
+		Country:   location.Country,
+		City:      location.City,
+		RequestID: utils.CopyString(correlation.RequestID(ctx)),
+	})
+}
+
+// Impersonation records every request made with an impersonation token.
+func (l *Log) Impersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if claims := auth.ClaimsFrom(c); claims != nil && claims.Actor != nil {
+			l.Record(c, "impersonation.request", "", map[string]string{
+				"method": utils.CopyString(c.Method()),
+				"path":   utils.CopyString(c.Path()),
+			})
+		}
+		return c.Next()
+	}
+}
+
+// UsePseudonyms has the actor, the target and the details naming users
+// logged as their blind index under cipher: a subject ID that is the same
+// in every entry of a user but can't be turned back into theirs. Other
+// details are logged as they are. A nil cipher logs the IDs.
+func (l *Log) UsePseudonyms(cipher *pii.Cipher) {
+	l.pseudonyms = cipher
+}
+
+func (l *Log) Add(ctx context.Context, entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = l.now()
+	}
+	details := entry.Details
+	if l.pseudonyms != nil {
+		details = make(map[string]string, len(entry.Details))
+		for k, v := range entry.Details {
+			details[k] = v
+		}
+		for _, k := range subjectDetails {
+			if v, ok := details[k]; ok {
+				details[k] = l.subject(v)
+			}
+		}
+	}
+	l.logger.InfoContext(ctx, "audit",
+		slog.String("actor", l.subject(entry.Actor)),
+		slog.String("action", entry.Action),
+		slog.String("target", l.subject(entry.Target)),
+		slog.Any("details", details),
+	)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > l.max {
+		l.entries = append([]Entry(nil), l.entries[len(l.entries)-l.max:]...)
+	}
+}
+
+// subject returns what is logged for the user ID id.
+func (l *Log) subject(id string) string {
+	if l.pseudonyms == nil || id == "" {
+		return id
+	}
+	return l.pseudonyms.Index("subject", id)
+}
+
+// List returns the entries, newest first.
+func (l *Log) List() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]Entry, len(l.entries))
+	for i, entry := range l.entries {
+		list[len(list)-1-i] = entry
+	}
+	return list
+}
+
+// ListFor returns the entries of actions by or on userID, newest first,
+// impersonated ones included.
+func (l *Log) ListFor(userID string) []Entry {
+	list := []Entry{}
+	for _, entry := range l.List() {
+		if entry.Actor == userID || entry.Target == userID || namedIn(entry.Details, userID) {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// Anonymize replaces userID with pseudonym in the entries kept in memory
+// and drops their client addresses and locations, for a user whose
+// account is erased. What was logged stays as it was, see UsePseudonyms.
+// It returns how many entries it changed.
+func (l *Log) Anonymize(userID, pseudonym string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	changed := 0
+	for i := range l.entries {
+		entry := &l.entries[i]
+		mentioned := false
+		if entry.Actor == userID {
+			entry.Actor, mentioned = pseudonym, true
+		}
+		if entry.Target == userID {
+			entry.Target, mentioned = pseudonym, true
+		}
+		if namedIn(entry.Details, userID) {
+			details := make(map[string]string, len(entry.Details))
+			for k, v := range entry.Details {
+				details[k] = v
+			}
+			for _, k := range subjectDetails {
+				if details[k] == userID {
+					details[k] = pseudonym
+				}
+			}
+			entry.Details, mentioned = details, true
+		}
+		if mentioned {
+			entry.IP, entry.Country, entry.City = "", "", ""
+			changed++
+		}
+	}
+	return changed
+}
+
+// namedIn reports whether details name userID.
+func namedIn(details map[string]string, userID string) bool {
+	for _, k := range subjectDetails {
+		if details[k] == userID {
+			return true
+		}
+	}
+	return false
+}
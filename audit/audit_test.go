@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/geoip"
+	"github.com/jalal-akbar/belajar-golang-fiber/pii"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogKeepsLatest(t *testing.T) {
+	var out bytes.Buffer
+	log := New(slog.New(slog.NewJSONHandler(&out, nil)), 2)
+	for _, action := range []string{"a", "b", "c"} {
+		log.Add(context.Background(), Entry{Actor: "root", Action: action})
+	}
+
+	entries := log.List()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "c", entries[0].Action)
+	assert.Equal(t, "b", entries[1].Action)
+	assert.False(t, entries[0].Time.IsZero())
+	assert.Equal(t, 3, bytes.Count(out.Bytes(), []byte(`"msg":"audit"`)))
+}
+
+type staticLocator geoip.Location
+
+func (l staticLocator) Locate(net.IP) (geoip.Location, error) {
+	return geoip.Location(l), nil
+}
+
+func TestRecordLocates(t *testing.T) {
+	log := New(slog.New(slog.NewJSONHandler(io.Discard, nil)), 10)
+	app := fiber.New()
+	app.Use(geoip.Middleware(staticLocator{Country: "ID", City: "Jakarta"}, nil))
+	app.Post("/files/:id", func(c *fiber.Ctx) error {
+		log.Record(c, "file.delete", c.Params("id"), nil)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	testkit.Do(t, app, "POST", "/files/42", nil).AssertStatus(204)
+	entries := log.List()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "42", entries[0].Target)
+	assert.Equal(t, "ID", entries[0].Country)
+	assert.Equal(t, "Jakarta", entries[0].City)
+
+	// Unlocated requests leave the location out.
+	unlocated := fiber.New()
+	unlocated.Post("/files/:id", func(c *fiber.Ctx) error {
+		log.Record(c, "file.delete", c.Params("id"), nil)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	testkit.Do(t, unlocated, "POST", "/files/43", nil).AssertStatus(204)
+	assert.Empty(t, log.List()[0].Country)
+}
+
+func TestUsePseudonyms(t *testing.T) {
+	var out bytes.Buffer
+	log := New(slog.New(slog.NewJSONHandler(&out, nil)), 10)
+	cipher, err := pii.New(config.PIIConfig{Key: base64.StdEncoding.EncodeToString(make([]byte, 32))})
+	assert.Nil(t, err)
+	log.UsePseudonyms(cipher)
+	ctx := context.Background()
+	log.Add(ctx, Entry{Actor: "alice", Action: "file.delete"})
+	log.Add(ctx, Entry{Actor: "root", Action: "user.suspend", Target: "alice"})
+	log.Add(ctx, Entry{Actor: "root", Action: "file.quarantine.purge", Details: map[string]string{"user": "alice", "reason": "malware"}})
+
+	// The log names alice by the same subject ID in every entry, and
+	// never by her ID.
+	subject := cipher.Index("subject", "alice")
+	assert.NotContains(t, out.String(), "alice")
+	assert.Equal(t, 3, strings.Count(out.String(), subject))
+	assert.Contains(t, out.String(), `"reason":"malware"`)
+	// What is kept in memory still names her, until Anonymize.
+	assert.Len(t, log.ListFor("alice"), 3)
+}
+
+func TestListFor(t *testing.T) {
+	log := New(slog.New(slog.NewJSONHandler(io.Discard, nil)), 10)
+	ctx := context.Background()
+	log.Add(ctx, Entry{Actor: "alice", Action: "file.delete"})
+	log.Add(ctx, Entry{Actor: "root", Action: "user.suspend", Target: "alice"})
+	log.Add(ctx, Entry{Actor: "root", Action: "impersonation.request", Details: map[string]string{"as": "alice"}})
+	log.Add(ctx, Entry{Actor: "bob", Action: "file.delete"})
+
+	var actions []string
+	for _, entry := range log.ListFor("alice") {
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []string{"impersonation.request", "user.suspend", "file.delete"}, actions)
+	assert.Empty(t, log.ListFor("carol"))
+}
+
+func TestAnonymize(t *testing.T) {
+	log := New(slog.New(slog.NewJSONHandler(io.Discard, nil)), 10)
+	ctx := context.Background()
+	log.Add(ctx, Entry{Actor: "alice", Action: "file.delete", IP: "203.0.113.7", Country: "ID", City: "Jakarta"})
+	log.Add(ctx, Entry{Actor: "root", Action: "impersonation.request", Details: map[string]string{"as": "alice", "path": "/api/me"}})
+	log.Add(ctx, Entry{Actor: "bob", Action: "file.delete", IP: "203.0.113.8"})
+	log.Add(ctx, Entry{Actor: "root", Action: "file.quarantine.release", Target: "42", Details: map[string]string{"user": "alice"}})
+	before := log.List()
+
+	assert.Equal(t, 3, log.Anonymize("alice", "deleted-1"))
+	assert.Empty(t, log.ListFor("alice"))
+	entries := log.ListFor("deleted-1")
+	assert.Equal(t, map[string]string{"user": "deleted-1"}, entries[0].Details)
+	assert.Equal(t, map[string]string{"as": "deleted-1", "path": "/api/me"}, entries[1].Details)
+	assert.Empty(t, entries[2].IP)
+	assert.Empty(t, entries[2].Country)
+	assert.Empty(t, entries[2].City)
+	assert.Equal(t, "203.0.113.8", log.ListFor("bob")[0].IP)
+	// Entries handed out before are left alone.
+	assert.Equal(t, "alice", before[2].Details["as"])
+}
@@ -0,0 +1,325 @@
+// Package auth issues and verifies JWT access tokens signed with RS256 or
+// EdDSA.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/jalal-akbar/belajar-golang-fiber/middleware"
+)
+
+var claimsKey = ctxutil.NewKey[*Claims]("claims")
+
+// Claims are the claims of an access token. Scope lists the granted
+// scopes separated by spaces, as in OAuth 2.0. Tokens issued by Login name
+// their session in SessionID. Tokens issued by Impersonate name the admin
+// acting as the subject in Actor (RFC 8693, section 4.1). Email is the
+// address the identity provider has for the subject, if it told.
+type Claims struct {
+	jwt.RegisteredClaims
+	Scope     string `json:"scope,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	Actor     *Actor `json:"act,omitempty"`
+	Email     string `json:"email,omitempty"`
+
+	external bool
+}
+
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// Tokens signs tokens with the configured keys and verifies tokens signed
+// by them or by the external identity provider.
+type Tokens struct {
+	cfg      config.JWTConfig
+	keys     []*signingKey
+	remote   *remoteKeys
+	sessions *Sessions
+	now      func() time.Time
+	bus      *events.Bus
+}
+
+// errSessionLookup marks the errors of Authenticate that come from reading
+// the sessions rather than from the token, which the middlewares don't
+// answer 401.
+var errSessionLookup = errors.New("auth: looking up the session failed")
+
+// EventLoggedIn is published when a user logs in.
+const EventLoggedIn = "user.logged_in"
+
+// New loads the keys of cfg. The sessions of Login are kept in db, which
+// may be nil for tokens that are only signed and verified.
+func New(cfg config.JWTConfig, client *httpclient.Client, db *database.DB) (*Tokens, error) {
+	t := &Tokens{cfg: cfg, sessions: NewSessions(db), now: time.Now}
+	for _, path := range cfg.KeyFiles {
+		key, err := loadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		t.keys = append(t.keys, key)
+	}
+	if cfg.JWKSURL != "" {
+		t.remote = newRemoteKeys(cfg.JWKSURL, client, cfg.JWKSRefresh)
+	}
+	return t, nil
+}
+
+// UseClock makes tokens and their sessions issued and checked at the time
+// of c.
+func (t *Tokens) UseClock(c clock.Clock) {
+	t.now = c.Now
+	t.sessions.now = c.Now
+}
+
+// UseBus publishes EventLoggedIn on bus for every Login.
+func (t *Tokens) UseBus(bus *events.Bus) {
+	t.bus = bus
+}
+
+// Sessions tracks the logins of Login.
+func (t *Tokens) Sessions() *Sessions {
+	return t.sessions
+}
+
+// Login starts a session for subject on the device and address of the
+// request and issues a token for it.
+func (t *Tokens) Login(c *fiber.Ctx, subject string, scopes ...string) (string, error) {
+	return t.login(c, subject, "", scopes)
+}
+
+// login is Login with the address of subject in the token, if known.
+func (t *Tokens) login(c *fiber.Ctx, subject, email string, scopes []string) (string, error) {
+	if len(t.keys) == 0 {
+		return "", errors.New("auth: no signing key configured")
+	}
+	// Strings from c are only valid during the request; sessions outlive it.
+	subject, email = utils.CopyString(subject), utils.CopyString(email)
+	device := utils.CopyString(c.Get(fiber.HeaderUserAgent))
+	session, err := t.sessions.create(c.UserContext(), subject, device, utils.CopyString(middleware.RealIP(c)), t.cfg.TTL)
+	if err != nil {
+		return "", err
+	}
+	token, err := t.sign(subject, email, session.ID, nil, scopes)
+	if err == nil && t.bus != nil {
+		t.bus.Publish(c.UserContext(), events.Event{Type: EventLoggedIn, UserID: subject, Subject: session.ID, Time: session.CreatedAt})
+	}
+	return token, err
+}
+
+// Impersonate starts a session for subject on behalf of actor. The session
+// shows up in the subject's session list, so they can see and end it.
+func (t *Tokens) Impersonate(c *fiber.Ctx, actor, subject string, scopes ...string) (string, error) {
+	if len(t.keys) == 0 {
+		return "", errors.New("auth: no signing key configured")
+	}
+	subject, actor = utils.CopyString(subject), utils.CopyString(actor)
+	session, err := t.sessions.create(c.UserContext(), subject, "impersonated by "+actor, utils.CopyString(middleware.RealIP(c)), t.cfg.TTL)
+	if err != nil {
+		return "", err
+	}
+	return t.sign(subject, "", session.ID, &Actor{Subject: actor}, scopes)
+}
+
+// Sign issues a token for subject with the given scopes, signed with the
+// first key.
+func (t *Tokens) Sign(subject string, scopes ...string) (string, error) {
+	return t.sign(subject, "", "", nil, scopes)
+}
+
+func (t *Tokens) sign(subject, email, sessionID string, actor *Actor, scopes []string) (string, error) {
+	if len(t.keys) == 0 {
+		return "", errors.New("auth: no signing key configured")
+	}
+	key := t.keys[0]
+	now := t.now()
+	claims := Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    t.cfg.Issuer,
+		Subject:   subject,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(t.cfg.TTL)),
+	}, Scope: strings.Join(scopes, " "), SessionID: sessionID, Actor: actor, Email: email}
+	if t.cfg.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{t.cfg.Audience}
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.signer)
+}
+
+// Verify checks the signature and the time, issuer and audience claims of
+// a token. Tokens whose kid isn't one of the local keys are looked up in
+// the external identity provider's key set.
+func (t *Tokens) Verify(ctx context.Context, token string) (*Claims, error) {
+	var external bool
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for _, key := range t.keys {
+			if key.id == kid {
+				return key.signer.Public(), nil
+			}
+		}
+		if t.remote == nil {
+			return nil, fmt.Errorf("auth: unknown key %q", kid)
+		}
+		external = true
+		return t.remote.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "EdDSA", "ES256", "ES384"}),
+		jwt.WithTimeFunc(t.now),
+		jwt.WithLeeway(30*time.Second),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	claims.external = external
+	issuer := t.cfg.Issuer
+	if external {
+		issuer = t.cfg.ExternalIssuer
+	}
+	if issuer != "" && claims.Issuer != issuer {
+		return nil, fmt.Errorf("auth: unexpected issuer %q", claims.Issuer)
+	}
+	if t.cfg.Audience != "" && !contains(claims.Audience, t.cfg.Audience) {
+		return nil, errors.New("auth: token not meant for this audience")
+	}
+	return claims, nil
+}
+
+// Authenticate is Verify for a token presented by a client at ip, which
+// also rejects the tokens of revoked or expired sessions and records the
+// session's use. Middleware authenticates requests with it; transports
+// other than HTTP call it directly.
+func (t *Tokens) Authenticate(ctx context.Context, token, ip string) (*Claims, error) {
+	claims, err := t.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.external && claims.SessionID != "" {
+		active, err := t.sessions.touch(ctx, claims.SessionID, claims.Subject, ip)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errSessionLookup, err)
+		}
+		if !active {
+			return nil, errors.New("auth: session revoked")
+		}
+	}
+	return claims, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// JWKSHandler serves the public keys at /.well-known/jwks.json.
+func (t *Tokens) JWKSHandler(c *fiber.Ctx) error {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range t.keys {
+		jwk, err := publicJWK(key.signer.Public())
+		if err != nil {
+			return err
+		}
+		jwk.ID = key.id
+		jwk.Use = "sig"
+		set.Keys = append(set.Keys, jwk)
+	}
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(set)
+}
+
+// Middleware only lets requests through with a valid
+// "Authorization: Bearer <token>". The token's subject becomes the
+// request's ctxutil.CurrentUser, its scopes are checked by RequireScope and its claims
+// are available through ClaimsFrom. Tokens of revoked or expired sessions
+// are rejected. Requests an earlier middleware already authenticated, such as signed
+// machine-to-machine calls, pass unchecked.
+func (t *Tokens) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ctxutil.CurrentUser(c) != "" {
+			return c.Next()
+		}
+		scheme, token, _ := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+		if !strings.EqualFold(scheme, "bearer") || token == "" {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer`)
+			return fiber.ErrUnauthorized
+		}
+		err := t.authenticate(c, token)
+		if errors.Is(err, errSessionLookup) {
+			return err
+		}
+		if err != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return fiber.ErrUnauthorized
+		}
+		return c.Next()
+	}
+}
+
+// CookieMiddleware is Middleware for the pages browsers open, which take
+// the token from the SessionCookie that an OIDC login started with a next
+// path sets. Requests without a valid one are redirected to loginURL, to
+// come back to the page they asked for, or answered 401 without one.
+func (t *Tokens) CookieMiddleware(loginURL string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ctxutil.CurrentUser(c) != "" {
+			return c.Next()
+		}
+		token := c.Cookies(SessionCookie)
+		var err error
+		if token != "" {
+			err = t.authenticate(c, token)
+		}
+		if errors.Is(err, errSessionLookup) {
+			return err
+		}
+		if token == "" || err != nil {
+			if loginURL == "" {
+				return fiber.ErrUnauthorized
+			}
+			return c.Redirect(loginURL+"?next="+url.QueryEscape(c.OriginalURL()), fiber.StatusFound)
+		}
+		return c.Next()
+	}
+}
+
+// authenticate verifies token and makes its subject the request's user.
+func (t *Tokens) authenticate(c *fiber.Ctx, token string) error {
+	claims, err := t.Authenticate(c.UserContext(), token, utils.CopyString(middleware.RealIP(c)))
+	if err != nil {
+		return err
+	}
+	ctxutil.SetCurrentUser(c, claims.Subject)
+	ctxutil.SetEmail(c, claims.Email)
+	ctxutil.SetScopes(c, strings.Fields(claims.Scope))
+	claimsKey.Set(c, claims)
+	return nil
+}
+
+// ClaimsFrom returns the claims of the token Middleware accepted, or nil.
+func ClaimsFrom(c *fiber.Ctx) *Claims {
+	claims, _ := claimsKey.Get(c)
+	return claims
+}
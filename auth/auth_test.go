@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKey(t *testing.T, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "key.pem")
+	assert.Nil(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	return path
+}
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	return key
+}
+
+func ed25519Key(t *testing.T) ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	return key
+}
+
+var ctx = context.Background()
+
+func testConfig(keyFiles ...string) config.JWTConfig {
+	return config.JWTConfig{
+		KeyFiles:    keyFiles,
+		Issuer:      "https://app.example",
+		Audience:    "api",
+		TTL:         time.Minute,
+		JWKSRefresh: time.Hour,
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for name, key := range map[string]interface{}{"RS256": rsaKey(t), "EdDSA": ed25519Key(t)} {
+		tokens, err := New(testConfig(writeKey(t, key)), nil, nil)
+		assert.Nil(t, err)
+		now := clock.NewFake(time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+		tokens.UseClock(now)
+
+		token, err := tokens.Sign("42")
+		assert.Nil(t, err)
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+		assert.Nil(t, err)
+		assert.Equal(t, name, parsed.Method.Alg())
+
+		claims, err := tokens.Verify(ctx, token)
+		assert.Nil(t, err, name)
+		assert.Equal(t, "42", claims.Subject)
+		assert.Equal(t, time.Date(2024, 5, 1, 8, 1, 0, 0, time.UTC), claims.ExpiresAt.Time.UTC())
+
+		// Past the TTL and the leeway for clock skew.
+		now.Advance(time.Minute + 30*time.Second)
+		_, err = tokens.Verify(ctx, token)
+		assert.ErrorIs(t, err, jwt.ErrTokenExpired, name)
+		now.Set(time.Date(2024, 5, 1, 8, 1, 0, 0, time.UTC))
+		_, err = tokens.Verify(ctx, token)
+		assert.Nil(t, err, name)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, newKey := writeKey(t, rsaKey(t)), writeKey(t, ed25519Key(t))
+
+	before, err := New(testConfig(oldKey), nil, nil)
+	assert.Nil(t, err)
+	token, err := before.Sign("42")
+	assert.Nil(t, err)
+
+	after, err := New(testConfig(newKey, oldKey), nil, nil)
+	assert.Nil(t, err)
+	_, err = after.Verify(ctx, token)
+	assert.Nil(t, err)
+
+	retired, err := New(testConfig(newKey), nil, nil)
+	assert.Nil(t, err)
+	_, err = retired.Verify(ctx, token)
+	assert.NotNil(t, err)
+}
+
+func TestRejectsSymmetricAlgorithms(t *testing.T) {
+	tokens, err := New(testConfig(writeKey(t, ed25519Key(t))), nil, nil)
+	assert.Nil(t, err)
+
+	// HS256 keyed with the public key, the classic algorithm confusion.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "https://app.example",
+		Subject:   "admin",
+		Audience:  jwt.ClaimStrings{"api"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	forged.Header["kid"] = tokens.keys[0].id
+	token, err := forged.SignedString([]byte(tokens.keys[0].signer.Public().(ed25519.PublicKey)))
+	assert.Nil(t, err)
+	_, err = tokens.Verify(ctx, token)
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+}
+
+func TestJWKSHandler(t *testing.T) {
+	tokens, err := New(testConfig(writeKey(t, rsaKey(t)), writeKey(t, ed25519Key(t))), nil, nil)
+	assert.Nil(t, err)
+	app := fiber.New()
+	app.Get("/.well-known/jwks.json", tokens.JWKSHandler)
+
+	response, err := app.Test(httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	assert.Nil(t, err)
+	var set JWKS
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&set))
+	assert.Len(t, set.Keys, 2)
+	assert.Equal(t, "RSA", set.Keys[0].KeyType)
+	assert.Equal(t, "AQAB", set.Keys[0].E)
+	assert.Equal(t, tokens.keys[0].id, set.Keys[0].ID)
+	assert.Equal(t, "OKP", set.Keys[1].KeyType)
+	assert.Equal(t, "Ed25519", set.Keys[1].Curve)
+	assert.Equal(t, "sig", set.Keys[1].Use)
+
+	for i, jwk := range set.Keys {
+		key, err := jwk.PublicKey()
+		assert.Nil(t, err)
+		assert.Equal(t, tokens.keys[i].signer.Public(), key)
+	}
+}
+
+func TestRemoteJWKS(t *testing.T) {
+	provider, err := New(config.JWTConfig{
+		KeyFiles: []string{writeKey(t, rsaKey(t))},
+		Issuer:   "https://idp.example",
+		Audience: "api",
+		TTL:      time.Minute,
+	}, nil, nil)
+	assert.Nil(t, err)
+	providerApp := fiber.New()
+	providerApp.Get("/jwks", provider.JWKSHandler)
+	fetches := 0
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		response, err := providerApp.Test(httptest.NewRequest("GET", "/jwks", nil))
+		assert.Nil(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		io.Copy(w, response.Body)
+	}))
+	defer idp.Close()
+
+	cfg := testConfig(writeKey(t, ed25519Key(t)))
+	cfg.JWKSURL = idp.URL
+	cfg.ExternalIssuer = "https://idp.example"
+	tokens, err := New(cfg, httpclient.New(config.Default().HTTPClient), nil)
+	assert.Nil(t, err)
+
+	token, err := provider.Sign("external-user")
+	assert.Nil(t, err)
+	claims, err := tokens.Verify(ctx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, "external-user", claims.Subject)
+	_, err = tokens.Verify(ctx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fetches)
+
+	// An unknown kid refetches the key set, but at most once a minute.
+	other, err := New(testConfig(writeKey(t, rsaKey(t))), nil, nil)
+	assert.Nil(t, err)
+	other.cfg.Issuer = "https://idp.example"
+	unknown, err := other.Sign("x")
+	assert.Nil(t, err)
+	_, err = tokens.Verify(ctx, unknown)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, fetches)
+	tokens.remote.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err = tokens.Verify(ctx, unknown)
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, fetches)
+
+	// Our own issuer is not accepted for the provider's keys.
+	tokens.cfg.ExternalIssuer = "https://other.example"
+	_, err = tokens.Verify(ctx, token)
+	assert.NotNil(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	tokens, err := New(testConfig(writeKey(t, ed25519Key(t))), nil, nil)
+	assert.Nil(t, err)
+	app := fiber.New()
+	app.Use(tokens.Middleware())
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(ctxutil.CurrentUser(c) + " " + ClaimsFrom(c).Issuer)
+	})
+
+	response, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 401, response.StatusCode)
+	assert.Equal(t, "Bearer", response.Header.Get("WWW-Authenticate"))
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Authorization", "Bearer not-a-token")
+	response, err = app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 401, response.StatusCode)
+	assert.Equal(t, `Bearer error="invalid_token"`, response.Header.Get("WWW-Authenticate"))
+
+	token, err := tokens.Sign("42")
+	assert.Nil(t, err)
+	request = httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err = app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "42 https://app.example", string(body))
+}
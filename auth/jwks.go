@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+)
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// minRefetch limits how often an unknown kid makes remoteKeys fetch the key
+// set again, so tokens with made-up kids can't hammer the provider.
+const minRefetch = time.Minute
+
+// remoteKeys caches the key set published by an identity provider. It is
+// fetched on first use, once it is older than refresh, and when a token
+// names a kid it doesn't know, which is how the provider's rotations are
+// picked up early.
+type remoteKeys struct {
+	url     string
+	client  *httpclient.Client
+	refresh time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func newRemoteKeys(url string, client *httpclient.Client, refresh time.Duration) *remoteKeys {
+	return &remoteKeys{url: url, client: client, refresh: refresh, now: time.Now}
+}
+
+func (r *remoteKeys) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	age := r.now().Sub(r.fetched)
+	key, ok := r.keys[kid]
+	if r.keys == nil || age >= r.refresh || (!ok && age >= minRefetch) {
+		if err := r.fetch(ctx); err != nil {
+			if !ok {
+				return nil, err
+			}
+			// Keep using the cached key while the provider is down.
+			return key, nil
+		}
+		key, ok = r.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("auth: unknown key %q", kid)
+	}
+	return key, nil
+}
+
+func (r *remoteKeys) fetch(ctx context.Context) error {
+	response, err := r.client.Get(ctx, r.url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("auth: fetching %s: %s", r.url, response.Status)
+	}
+	var set JWKS
+	if err := json.NewDecoder(response.Body).Decode(&set); err != nil {
+		return fmt.Errorf("auth: decoding %s: %w", r.url, err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Skip keys of types we don't know rather than rejecting the set.
+		if key, err := jwk.PublicKey(); err == nil {
+			keys[jwk.ID] = key
+		}
+	}
+	r.keys = keys
+	r.fetched = r.now()
+	return nil
+}
@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+)
+
+const (
+	loginCookie = "oidc_login"
+	loginMaxAge = 10 * time.Minute
+	// SessionCookie keeps the access token of a browser login, for the
+	// pages of CookieMiddleware.
+	SessionCookie = "session"
+)
+
+// provider is the part of an OpenID provider's discovery document we use.
+type provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// loginState travels in a cookie from the login redirect to the callback.
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Next     string `json:"next,omitempty"`
+}
+
+// OIDC logs users in with an OpenID Connect provider and hands out access
+// tokens signed by Tokens for them. The provider is discovered on the first
+// login, so the app starts while it is unreachable.
+type OIDC struct {
+	cfg    config.OIDCConfig
+	tokens *Tokens
+	client *httpclient.Client
+	now    func() time.Time
+
+	mu       sync.Mutex
+	provider *provider
+	keys     *remoteKeys
+}
+
+func NewOIDC(cfg config.OIDCConfig, tokens *Tokens, client *httpclient.Client) *OIDC {
+	return &OIDC{cfg: cfg, tokens: tokens, client: client, now: time.Now}
+}
+
+// Register adds GET /login, which redirects to the provider, and
+// GET /callback, which the provider redirects back to. The callback
+// answers with the access token, or, for a login with a next path such as
+// /login?next=/admin/pages, sets it as the SessionCookie and redirects
+// there.
+func (o *OIDC) Register(router fiber.Router) {
+	router.Get("/login", o.login)
+	router.Get("/callback", o.callback)
+}
+
+func (o *OIDC) discover(ctx context.Context) (*provider, *remoteKeys, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.provider != nil {
+		return o.provider, o.keys, nil
+	}
+
+	response, err := o.client.Get(ctx, strings.TrimSuffix(o.cfg.Issuer, "/")+"/.well-known/openid-configuration")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("auth: oidc discovery: %s", response.Status)
+	}
+	var p provider
+	if err := json.NewDecoder(response.Body).Decode(&p); err != nil {
+		return nil, nil, fmt.Errorf("auth: oidc discovery: %w", err)
+	}
+	// OpenID Connect Discovery 1.0, section 4.3.
+	if p.Issuer != o.cfg.Issuer {
+		return nil, nil, fmt.Errorf("auth: oidc discovery: issuer %q doesn't match %q", p.Issuer, o.cfg.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, nil, errors.New("auth: oidc discovery: missing endpoints")
+	}
+	o.provider = &p
+	o.keys = newRemoteKeys(p.JWKSURI, o.client, time.Hour)
+	return o.provider, o.keys, nil
+}
+
+// localPath reports whether next is a path of this app, which the login
+// may send users on to. Browsers skip tabs and line breaks in URLs and
+// read a backslash as a slash, so "/\t/evil.example" or "/\\evil.example"
+// would lead elsewhere as much as "//evil.example" does.
+func localPath(next string) bool {
+	if strings.Contains(next, "\\") || strings.ContainsFunc(next, func(r rune) bool { return unicode.IsControl(r) || unicode.IsSpace(r) }) {
+		return false
+	}
+	u, err := url.Parse(next)
+	return err == nil && u.Scheme == "" && u.Host == "" && u.User == nil &&
+		strings.HasPrefix(u.Path, "/") && !strings.HasPrefix(u.Path, "//")
+}
+
+func (o *OIDC) login(c *fiber.Ctx) error {
+	p, _, err := o.discover(c.UserContext())
+	if err != nil {
+		return err
+	}
+	next := c.Query("next")
+	if next != "" && !localPath(next) {
+		return fiber.NewError(fiber.StatusBadRequest, "next must be a path")
+	}
+	state := loginState{State: randomString(), Nonce: randomString(), Verifier: randomString(), Next: utils.CopyString(next)}
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     loginCookie,
+		Value:    b64.EncodeToString(encoded),
+		Path:     "/",
+		MaxAge:   int(loginMaxAge.Seconds()),
+		Secure:   strings.HasPrefix(o.cfg.RedirectURL, "https://"),
+		HTTPOnly: true,
+		// Lax, so the cookie comes along on the provider's top-level
+		// redirect back to the callback.
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.cfg.ClientID},
+		"redirect_uri":          {o.cfg.RedirectURL},
+		"scope":                 {strings.Join(o.cfg.Scopes, " ")},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {b64.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return c.Redirect(p.AuthorizationEndpoint+separator+query.Encode(), fiber.StatusFound)
+}
+
+func (o *OIDC) callback(c *fiber.Ctx) error {
+	p, keys, err := o.discover(c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	var state loginState
+	encoded, err := b64.DecodeString(c.Cookies(loginCookie))
+	if err != nil || json.Unmarshal(encoded, &state) != nil || state.State == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "login expired, start again")
+	}
+	c.ClearCookie(loginCookie)
+	if c.Query("state") != state.State {
+		return fiber.NewError(fiber.StatusBadRequest, "state mismatch")
+	}
+	if reason := c.Query("error"); reason != "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "login failed: "+reason)
+	}
+	code := c.Query("code")
+	if code == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "missing code")
+	}
+
+	idToken, err := o.exchange(c.UserContext(), p, code, state.Verifier)
+	if err != nil {
+		return err
+	}
+	claims, err := o.verifyIDToken(c.UserContext(), p, keys, idToken, state.Nonce)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid id token")
+	}
+	user, _ := claims[o.cfg.UserClaim].(string)
+	if user == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, fmt.Sprintf("id token has no %q claim", o.cfg.UserClaim))
+	}
+
+	// The address goes into the token, for the account it creates to
+	// confirm.
+	email, _ := claims["email"].(string)
+	token, err := o.tokens.login(c, user, email, o.cfg.GrantScopes)
+	if err != nil {
+		return err
+	}
+	if state.Next != "" {
+		c.Cookie(&fiber.Cookie{
+			Name:     SessionCookie,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   int(o.tokens.cfg.TTL.Seconds()),
+			Secure:   strings.HasPrefix(o.cfg.RedirectURL, "https://"),
+			HTTPOnly: true,
+			SameSite: fiber.CookieSameSiteLaxMode,
+		})
+		return c.Redirect(state.Next, fiber.StatusFound)
+	}
+	return c.JSON(fiber.Map{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(o.tokens.cfg.TTL.Seconds()),
+	})
+}
+
+// exchange redeems the authorization code for the provider's ID token.
+func (o *OIDC) exchange(ctx context.Context, p *provider, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.cfg.RedirectURL},
+		"client_id":     {o.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	if o.cfg.ClientSecret != "" {
+		form.Set("client_secret", o.cfg.ClientSecret)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	response, err := o.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var body struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("auth: oidc token endpoint: %w", err)
+	}
+	if response.StatusCode != http.StatusOK || body.IDToken == "" {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "code exchange failed: "+body.Error)
+	}
+	return body.IDToken, nil
+}
+
+// verifyIDToken follows OpenID Connect Core 1.0, section 3.1.3.7.
+func (o *OIDC) verifyIDToken(ctx context.Context, p *provider, keys *remoteKeys, idToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return keys.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "EdDSA", "ES256", "ES384"}),
+		jwt.WithTimeFunc(o.now),
+		jwt.WithLeeway(30*time.Second),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(o.cfg.ClientID),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if audience, _ := claims.GetAudience(); len(audience) > 1 {
+		if azp, _ := claims["azp"].(string); azp != o.cfg.ClientID {
+			return nil, errors.New("auth: id token authorized for another party")
+		}
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("auth: id token nonce mismatch")
+	}
+	return claims, nil
+}
+
+func randomString() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return b64.EncodeToString(buf)
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProvider is an OpenID provider that issues one code at a time.
+type fakeProvider struct {
+	*httptest.Server
+	key       *signingKey
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := newSigningKey(rsaKey(t))
+	assert.Nil(t, err)
+	p := &fakeProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(provider{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JWKSURI:               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk, _ := publicJWK(key.signer.Public())
+		jwk.ID = key.id
+		json.NewEncoder(w).Encode(JWKS{Keys: []JWK{jwk}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != "the-code" || b64.EncodeToString(verifier[:]) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":   p.URL,
+			"sub":   "idp-user",
+			"aud":   "app",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": p.nonce,
+			"email": "user@example.com",
+		}
+		for name, value := range p.claims {
+			claims[name] = value
+		}
+		token := jwt.NewWithClaims(key.method, claims)
+		token.Header["kid"] = key.id
+		signed, _ := token.SignedString(key.signer)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func newOIDCApp(t *testing.T, idp *fakeProvider, userClaim string) (*fiber.App, *Tokens) {
+	tokens, err := New(testConfig(writeKey(t, ed25519Key(t))), nil, testkit.OpenDB(t, SessionMigrations...))
+	assert.Nil(t, err)
+	oidc := NewOIDC(config.OIDCConfig{
+		Issuer:      idp.URL,
+		ClientID:    "app",
+		RedirectURL: "https://app.example/auth/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+		UserClaim:   userClaim,
+		GrantScopes: []string{"dashboard:read"},
+	}, tokens, httpclient.New(config.Default().HTTPClient))
+	app := fiber.New()
+	oidc.Register(app.Group("/auth/oidc"))
+	return app, tokens
+}
+
+// login starts a login and returns the login cookie and the state sent to
+// the provider, recording the PKCE challenge and nonce with it.
+func login(t *testing.T, app *fiber.App, idp *fakeProvider) (*http.Cookie, string) {
+	return loginAt(t, app, idp, "/auth/oidc/login")
+}
+
+func loginAt(t *testing.T, app *fiber.App, idp *fakeProvider, path string) (*http.Cookie, string) {
+	response, err := app.Test(httptest.NewRequest("GET", path, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 302, response.StatusCode)
+	location, err := url.Parse(response.Header.Get("Location"))
+	assert.Nil(t, err)
+	assert.Equal(t, idp.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	query := location.Query()
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, "openid email", query.Get("scope"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	idp.challenge = query.Get("code_challenge")
+	idp.nonce = query.Get("nonce")
+	return response.Cookies()[0], query.Get("state")
+}
+
+func callback(t *testing.T, app *fiber.App, cookie *http.Cookie, query string) *http.Response {
+	request := httptest.NewRequest("GET", "/auth/oidc/callback?"+query, nil)
+	request.AddCookie(cookie)
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	return response
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newFakeProvider(t)
+	app, tokens := newOIDCApp(t, idp, "email")
+
+	cookie, state := login(t, app, idp)
+	response := callback(t, app, cookie, "state="+state+"&code=the-code")
+	assert.Equal(t, 200, response.StatusCode)
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+	claims, err := tokens.Verify(ctx, body.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "user@example.com", claims.Subject)
+	assert.Equal(t, "dashboard:read", claims.Scope)
+}
+
+func TestOIDCBrowserLogin(t *testing.T) {
+	idp := newFakeProvider(t)
+	app, tokens := newOIDCApp(t, idp, "email")
+	app.Get("/pages/me", tokens.CookieMiddleware("/auth/oidc/login"), func(c *fiber.Ctx) error {
+		return c.SendString(ctxutil.CurrentUser(c))
+	})
+
+	response, err := app.Test(httptest.NewRequest("GET", "/pages/me?tab=1", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 302, response.StatusCode)
+	assert.Equal(t, "/auth/oidc/login?next=%2Fpages%2Fme%3Ftab%3D1", response.Header.Get("Location"))
+
+	cookie, state := loginAt(t, app, idp, "/auth/oidc/login?next=%2Fpages%2Fme%3Ftab%3D1")
+	response = callback(t, app, cookie, "state="+state+"&code=the-code")
+	assert.Equal(t, 302, response.StatusCode)
+	assert.Equal(t, "/pages/me?tab=1", response.Header.Get("Location"))
+	var session *http.Cookie
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == SessionCookie {
+			session = cookie
+		}
+	}
+	assert.NotNil(t, session)
+	assert.True(t, session.HttpOnly)
+	assert.True(t, session.Secure)
+
+	request := httptest.NewRequest("GET", "/pages/me", nil)
+	request.AddCookie(&http.Cookie{Name: SessionCookie, Value: session.Value})
+	response, err = app.Test(request)
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(response.Body)
+	assert.Equal(t, "user@example.com", string(body))
+
+	// Once the session is revoked, the cookie no longer lets the browser in.
+	tokens.Sessions().RevokeAll(ctx, "user@example.com")
+	request = httptest.NewRequest("GET", "/pages/me", nil)
+	request.AddCookie(&http.Cookie{Name: SessionCookie, Value: session.Value})
+	response, err = app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 302, response.StatusCode)
+
+	for _, next := range []string{
+		"https://evil.example/", "//evil.example/", "/\\evil.example", "/\t/evil.example", "/\n/evil.example", "javascript:alert(1)",
+	} {
+		response, err = app.Test(httptest.NewRequest("GET", "/auth/oidc/login?next="+url.QueryEscape(next), nil))
+		assert.Nil(t, err)
+		assert.Equal(t, 400, response.StatusCode, next)
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	idp := newFakeProvider(t)
+	app, _ := newOIDCApp(t, idp, "sub")
+
+	cookie, state := login(t, app, idp)
+	assert.Equal(t, 400, callback(t, app, cookie, "state=forged&code=the-code").StatusCode)
+	assert.Equal(t, 401, callback(t, app, cookie, "state="+state+"&error=access_denied").StatusCode)
+	assert.Equal(t, 401, callback(t, app, cookie, "state="+state+"&code=stolen").StatusCode)
+
+	// A code redeemed without the verifier of this login.
+	idp.challenge = "other"
+	assert.Equal(t, 401, callback(t, app, cookie, "state="+state+"&code=the-code").StatusCode)
+
+	cookie, state = login(t, app, idp)
+	idp.nonce = "replayed"
+	assert.Equal(t, 401, callback(t, app, cookie, "state="+state+"&code=the-code").StatusCode)
+
+	cookie, state = login(t, app, idp)
+	idp.claims = jwt.MapClaims{"aud": "someone-else"}
+	assert.Equal(t, 401, callback(t, app, cookie, "state="+state+"&code=the-code").StatusCode)
+
+	response, err := app.Test(httptest.NewRequest("GET", "/auth/oidc/callback?state=x&code=the-code", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, response.StatusCode)
+}
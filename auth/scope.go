@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+)
+
+// Scopes returns the scopes of the authenticated request: those of its
+// token, of the key that signed it or of its API key.
+func Scopes(c *fiber.Ctx) []string {
+	return ctxutil.Scopes(c)
+}
+
+// RequireScope answers 403, naming the first missing scope, unless the
+// request was granted all of scopes.
+func RequireScope(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		granted := Scopes(c)
+		for _, scope := range scopes {
+			if !contains(granted, scope) {
+				c.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+				return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("missing scope %q", scope))
+			}
+		}
+		return c.Next()
+	}
+}
+
+// RequireAreaScope is RequireScope for the areas of the API under prefix,
+// each named by the first segment of the paths under it and mapped to its
+// area by areas. Requests that only read, GET, HEAD and OPTIONS, need the
+// scope "<area>:read", the others "<area>:write". Paths of segments areas
+// doesn't list are left to check their own scopes.
+func RequireAreaScope(prefix string, areas map[string]string) fiber.Handler {
+	read, write := map[string]fiber.Handler{}, map[string]fiber.Handler{}
+	for segment, area := range areas {
+		read[segment], write[segment] = RequireScope(area+":read"), RequireScope(area+":write")
+	}
+	return func(c *fiber.Ctx) error {
+		rest, ok := strings.CutPrefix(c.Path(), strings.TrimSuffix(prefix, "/")+"/")
+		if !ok {
+			return c.Next()
+		}
+		segment, _, _ := strings.Cut(rest, "/")
+		check := write[segment]
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			check = read[segment]
+		}
+		if check == nil {
+			return c.Next()
+		}
+		return check(c)
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireScope(t *testing.T) {
+	tokens, err := New(testConfig(writeKey(t, ed25519Key(t))), nil, nil)
+	assert.Nil(t, err)
+	app := fiber.New()
+	app.Use(tokens.Middleware())
+	app.Get("/users", RequireScope("users:read"), func(c *fiber.Ctx) error { return c.SendString("users") })
+	app.Post("/orders", RequireScope("orders:read", "orders:write"), func(c *fiber.Ctx) error { return c.SendString("ordered") })
+
+	token, err := tokens.Sign("42", "users:read", "orders:read")
+	assert.Nil(t, err)
+	claims, err := tokens.Verify(ctx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, "users:read orders:read", claims.Scope)
+
+	request := httptest.NewRequest("GET", "/users", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	request = httptest.NewRequest("POST", "/orders", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err = app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 403, response.StatusCode)
+	assert.Equal(t, `Bearer error="insufficient_scope", scope="orders:write"`, response.Header.Get("WWW-Authenticate"))
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `missing scope "orders:write"`, string(body))
+}
+
+func TestSignedRequestScopes(t *testing.T) {
+	signatures := NewSignatures(config.SigningConfig{
+		Keys:    map[string]string{"billing": "s3cret", "reports": "s3cret"},
+		Scopes:  map[string][]string{"billing": {"orders:write"}},
+		MaxSkew: time.Minute,
+	})
+	app := fiber.New()
+	app.Use(signatures.Middleware())
+	app.Post("/orders", RequireScope("orders:write"), func(c *fiber.Ctx) error { return c.SendString("ordered") })
+
+	for keyID, status := range map[string]int{"billing": 200, "reports": 403} {
+		request := httptest.NewRequest("POST", "/orders", nil)
+		assert.Nil(t, SignRequest(request, keyID, "s3cret"))
+		response, err := app.Test(request)
+		assert.Nil(t, err)
+		assert.Equal(t, status, response.StatusCode, keyID)
+	}
+}
+
+func TestRequireAreaScope(t *testing.T) {
+	tokens, err := New(testConfig(writeKey(t, ed25519Key(t))), nil, nil)
+	assert.Nil(t, err)
+	app := fiber.New()
+	api := app.Group("/api", tokens.Middleware())
+	api.Use(RequireAreaScope("/api", map[string]string{"orders": "orders", "me": "users"}))
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	api.Get("/orders", ok)
+	api.Post("/orders", ok)
+	api.Get("/me", ok)
+	api.Get("/media", ok)
+	api.Get("/dashboard", ok)
+
+	token, err := tokens.Sign("42", "orders:read")
+	assert.Nil(t, err)
+	for _, test := range []struct {
+		method, path string
+		status       int
+		missing      string
+	}{
+		{"GET", "/api/orders", 200, ""},
+		{"POST", "/api/orders", 403, "orders:write"},
+		{"GET", "/api/me", 403, "users:read"},
+		// Areas are whole segments, and the others aren't checked.
+		{"GET", "/api/media", 200, ""},
+		{"GET", "/api/dashboard", 200, ""},
+	} {
+		request := httptest.NewRequest(test.method, test.path, nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		response, err := app.Test(request)
+		assert.Nil(t, err)
+		assert.Equal(t, test.status, response.StatusCode, test.method+" "+test.path)
+		if test.missing != "" {
+			body, err := io.ReadAll(response.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, `missing scope "`+test.missing+`"`, string(body))
+		}
+	}
+}
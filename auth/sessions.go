@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+)
+
+// Session is one login of a user, identified by the sid claim of the
+// access token it issued. It ends when that token expires or when the
+// user revokes it.
+type Session struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	Device    string    `json:"device"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Current   bool      `json:"current"`
+}
+
+// SessionMigrations create the table of the sessions.
+var SessionMigrations = []database.Migration{{
+	ID: "auth-0002",
+	Statements: []string{
+		`CREATE TABLE sessions (
+	id VARCHAR(64) PRIMARY KEY,
+	user_id VARCHAR(255) NOT NULL,
+	device TEXT NOT NULL,
+	ip VARCHAR(64) NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	last_seen TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+)`,
+		`CREATE INDEX sessions_user_id ON sessions (user_id, last_seen)`,
+		`CREATE INDEX sessions_expires_at ON sessions (expires_at)`,
+	},
+}}
+
+const sessionColumns = "id, user_id, device, ip, created_at, last_seen, expires_at"
+
+// Sessions keeps the active sessions in the database, in the table
+// SessionMigrations create, so every process and instance knows the
+// logins of the others, and they outlive restarts.
+type Sessions struct {
+	db  *database.DB
+	now func() time.Time
+}
+
+func NewSessions(db *database.DB) *Sessions {
+	return &Sessions{db: db, now: clock.System.Now}
+}
+
+func (s *Sessions) create(ctx context.Context, userID, device, ip string, ttl time.Duration) (Session, error) {
+	now := s.now().UTC()
+	session := Session{
+		ID:        randomString(),
+		UserID:    userID,
+		Device:    device,
+		IP:        ip,
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+	err := s.db.InTx(ctx, func(ctx context.Context) error {
+		conn := s.db.Conn(ctx)
+		// Expired sessions go as new ones come.
+		if _, err := conn.ExecContext(ctx, s.db.Rebind(`DELETE FROM sessions WHERE expires_at <= ?`), now); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, s.db.Rebind(`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+			session.ID, session.UserID, session.Device, session.IP, session.CreatedAt, session.LastSeen, session.ExpiresAt)
+		return err
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// touch records a request of the session and reports whether it is still
+// active.
+func (s *Sessions) touch(ctx context.Context, id, userID, ip string) (bool, error) {
+	now := s.now().UTC()
+	result, err := s.db.Conn(ctx).ExecContext(ctx, s.db.Rebind(`UPDATE sessions SET last_seen = ?, ip = ? WHERE id = ? AND user_id = ? AND expires_at > ?`),
+		now, ip, id, userID, now)
+	if err != nil {
+		return false, err
+	}
+	touched, err := result.RowsAffected()
+	return touched > 0, err
+}
+
+// List returns the active sessions of a user, most recently used first.
+func (s *Sessions) List(ctx context.Context, userID string) ([]Session, error) {
+	rows, err := s.db.Conn(ctx).QueryContext(ctx, s.db.Rebind(`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? AND expires_at > ? ORDER BY last_seen DESC, id`),
+		userID, s.now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.Device, &session.IP, &session.CreatedAt, &session.LastSeen, &session.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		session.CreatedAt, session.LastSeen, session.ExpiresAt = session.CreatedAt.UTC(), session.LastSeen.UTC(), session.ExpiresAt.UTC()
+		list = append(list, session)
+	}
+	return list, rows.Err()
+}
+
+// Revoke ends a session of the user and reports whether there was one.
+func (s *Sessions) Revoke(ctx context.Context, userID, id string) (bool, error) {
+	result, err := s.db.Conn(ctx).ExecContext(ctx, s.db.Rebind(`DELETE FROM sessions WHERE id = ? AND user_id = ?`), id, userID)
+	if err != nil {
+		return false, err
+	}
+	revoked, err := result.RowsAffected()
+	return revoked > 0, err
+}
+
+// RevokeAll ends every session of a user and returns how many there were.
+func (s *Sessions) RevokeAll(ctx context.Context, userID string) (int, error) {
+	result, err := s.db.Conn(ctx).ExecContext(ctx, s.db.Rebind(`DELETE FROM sessions WHERE user_id = ?`), userID)
+	if err != nil {
+		return 0, err
+	}
+	revoked, err := result.RowsAffected()
+	return int(revoked), err
+}
+
+// Register adds GET /me/sessions and DELETE /me/sessions/:id for the
+// authenticated user.
+func (s *Sessions) Register(router fiber.Router) {
+	router.Get("/me/sessions", s.listHandler)
+	router.Delete("/me/sessions/:id", s.revokeHandler)
+}
+
+func (s *Sessions) listHandler(c *fiber.Ctx) error {
+	list, err := s.List(c.UserContext(), ctxutil.CurrentUser(c))
+	if err != nil {
+		return err
+	}
+	if claims := ClaimsFrom(c); claims != nil {
+		for i := range list {
+			list[i].Current = list[i].ID == claims.SessionID
+		}
+	}
+	return c.JSON(list)
+}
+
+func (s *Sessions) revokeHandler(c *fiber.Ctx) error {
+	revoked, err := s.Revoke(c.UserContext(), ctxutil.CurrentUser(c), c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return fiber.ErrNotFound
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions(t *testing.T) {
+	tokens, err := New(testConfig(writeKey(t, ed25519Key(t))), nil, testkit.OpenDB(t, SessionMigrations...))
+	assert.Nil(t, err)
+	app := fiber.New()
+	app.Post("/login/:user", func(c *fiber.Ctx) error {
+		token, err := tokens.Login(c, c.Params("user"))
+		if err != nil {
+			return err
+		}
+		return c.SendString(token)
+	})
+	api := app.Group("/api", tokens.Middleware())
+	tokens.Sessions().Register(api)
+
+	login := func(user, device string) string {
+		request := httptest.NewRequest("POST", "/login/"+user, nil)
+		request.Header.Set("User-Agent", device)
+		response, err := app.Test(request)
+		assert.Nil(t, err)
+		token, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		return string(token)
+	}
+	call := func(method, path, token string) *http.Response {
+		request := httptest.NewRequest(method, path, nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		response, err := app.Test(request)
+		assert.Nil(t, err)
+		return response
+	}
+
+	laptop := login("42", "Firefox")
+	phone := login("42", "Safari")
+	other := login("7", "curl")
+
+	response := call("GET", "/api/me/sessions", phone)
+	assert.Equal(t, 200, response.StatusCode)
+	var sessions []Session
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&sessions))
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, "Safari", sessions[0].Device)
+	assert.True(t, sessions[0].Current)
+	assert.Equal(t, "Firefox", sessions[1].Device)
+	assert.False(t, sessions[1].Current)
+
+	// Sessions of other users can't be revoked.
+	assert.Equal(t, 404, call("DELETE", "/api/me/sessions/"+sessions[1].ID, other).StatusCode)
+
+	assert.Equal(t, 204, call("DELETE", "/api/me/sessions/"+sessions[1].ID, phone).StatusCode)
+	assert.Equal(t, 401, call("GET", "/api/me/sessions", laptop).StatusCode)
+	assert.Equal(t, 404, call("DELETE", "/api/me/sessions/"+sessions[1].ID, phone).StatusCode)
+	assert.Equal(t, 200, call("GET", "/api/me/sessions", phone).StatusCode)
+}
+
+func TestSessionsExpire(t *testing.T) {
+	sessions := NewSessions(testkit.OpenDB(t, SessionMigrations...))
+	now := time.Now()
+	sessions.now = func() time.Time { return now }
+	session, err := sessions.create(ctx, "42", "Firefox", "192.0.2.1", time.Minute)
+	assert.Nil(t, err)
+	list, err := sessions.List(ctx, "42")
+	assert.Nil(t, err)
+	assert.Len(t, list, 1)
+
+	now = now.Add(time.Minute)
+	list, _ = sessions.List(ctx, "42")
+	assert.Len(t, list, 0)
+	active, err := sessions.touch(ctx, session.ID, "42", "192.0.2.1")
+	assert.Nil(t, err)
+	assert.False(t, active)
+}
+
+func TestSessionsOutliveRestart(t *testing.T) {
+	db := testkit.OpenDB(t, SessionMigrations...)
+	cfg := testConfig(writeKey(t, ed25519Key(t)))
+	before, err := New(cfg, nil, db)
+	assert.Nil(t, err)
+	app := fiber.New()
+	app.Post("/login", func(c *fiber.Ctx) error {
+		token, err := before.Login(c, "42")
+		if err != nil {
+			return err
+		}
+		return c.SendString(token)
+	})
+	token := testkit.Do(t, app, "POST", "/login", nil).AssertStatus(200).String()
+
+	// Another instance, or this one restarted, knows the session.
+	after, err := New(cfg, nil, db)
+	assert.Nil(t, err)
+	claims, err := after.Authenticate(ctx, token, "192.0.2.1")
+	assert.Nil(t, err)
+	assert.Equal(t, "42", claims.Subject)
+
+	revoked, err := after.Sessions().RevokeAll(ctx, "42")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, revoked)
+	_, err = before.Authenticate(ctx, token, "192.0.2.1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+)
+
+// SignatureScheme is the Authorization scheme of signed requests:
+//
+//	Authorization: HMAC-SHA256 keyId="...", timestamp="...", nonce="...", signature="..."
+//
+// The signature is the base64 HMAC-SHA256, keyed with the secret of keyId,
+// over the method, request URI, timestamp, nonce and hex SHA-256 of the
+// body, joined by newlines.
+const SignatureScheme = "HMAC-SHA256"
+
+// maxNonces bounds the replay cache; beyond it signed requests are refused
+// until old nonces expire.
+const maxNonces = 100000
+
+// SignRequest signs an outgoing request for Signatures. It reads the
+// body and puts it back. Every call uses a fresh nonce, so sign each retry
+// again: the server refuses a nonce it has already seen.
+func SignRequest(request *http.Request, keyID, secret string) error {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = io.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return err
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := randomString()
+	signature := sign(secret, request.Method, request.URL.RequestURI(), timestamp, nonce, body)
+	request.Header.Set("Authorization", fmt.Sprintf(`%s keyId="%s", timestamp="%s", nonce="%s", signature="%s"`,
+		SignatureScheme, keyID, timestamp, nonce, signature))
+	return nil
+}
+
+func sign(secret, method, uri, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{method, uri, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Signatures verifies signed requests and remembers their nonces for
+// twice the allowed clock skew, which is as long as a replay could still
+// pass the timestamp check.
+type Signatures struct {
+	cfg config.SigningConfig
+	now func() time.Time
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func NewSignatures(cfg config.SigningConfig) *Signatures {
+	return &Signatures{cfg: cfg, now: time.Now, nonces: map[string]time.Time{}}
+}
+
+// Middleware only lets requests through that are signed with one of the
+// configured keys. The key id becomes the request's ctxutil.CurrentUser and the key's
+// scopes are checked by RequireScope.
+func (s *Signatures) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		keyID, err := s.verify(c)
+		if err != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, SignatureScheme)
+			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		}
+		ctxutil.SetCurrentUser(c, keyID)
+		ctxutil.SetScopes(c, s.cfg.Scopes[keyID])
+		return c.Next()
+	}
+}
+
+func (s *Signatures) verify(c *fiber.Ctx) (string, error) {
+	scheme, params, _ := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if scheme != SignatureScheme {
+		return "", fmt.Errorf("request must be signed with %s", SignatureScheme)
+	}
+	fields := parseParams(params)
+	keyID, timestamp, nonce := fields["keyId"], fields["timestamp"], fields["nonce"]
+	secret, ok := s.cfg.Keys[keyID]
+	if !ok || nonce == "" {
+		return "", errors.New("invalid signature")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", errors.New("invalid signature")
+	}
+	now := s.now()
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > s.cfg.MaxSkew || skew < -s.cfg.MaxSkew {
+		return "", errors.New("signature timestamp out of range")
+	}
+
+	expected := sign(secret, c.Method(), c.OriginalURL(), timestamp, nonce, c.Body())
+	if !hmac.Equal([]byte(expected), []byte(fields["signature"])) {
+		return "", errors.New("invalid signature")
+	}
+	// Only a valid signature may use up a nonce.
+	if !s.remember(keyID+" "+nonce, now) {
+		return "", errors.New("replayed request")
+	}
+	return keyID, nil
+}
+
+func (s *Signatures) remember(nonce string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expires, ok := s.nonces[nonce]; ok && now.Before(expires) {
+		return false
+	}
+	if len(s.nonces) >= maxNonces {
+		for n, expires := range s.nonces {
+			if !now.Before(expires) {
+				delete(s.nonces, n)
+			}
+		}
+		if len(s.nonces) >= maxNonces {
+			return false
+		}
+	}
+	s.nonces[nonce] = now.Add(2 * s.cfg.MaxSkew)
+	return true
+}
+
+// parseParams splits `a="1", b="2"` into its fields.
+func parseParams(params string) map[string]string {
+	fields := map[string]string{}
+	for _, param := range strings.Split(params, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok {
+			fields[name] = strings.Trim(value, `"`)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSignedApp() (*fiber.App, *Signatures) {
+	signatures := NewSignatures(config.SigningConfig{
+		Keys:    map[string]string{"billing": "s3cret"},
+		MaxSkew: 5 * time.Minute,
+	})
+	app := fiber.New()
+	app.Use(signatures.Middleware())
+	app.Post("/orders", func(c *fiber.Ctx) error {
+		return c.SendString(ctxutil.CurrentUser(c) + ": " + string(c.Body()))
+	})
+	return app, signatures
+}
+
+func signedRequest(t *testing.T, body, secret string) *http.Request {
+	request := httptest.NewRequest("POST", "/orders?dry_run=1", strings.NewReader(body))
+	assert.Nil(t, SignRequest(request, "billing", secret))
+	return request
+}
+
+func TestSignedRequest(t *testing.T) {
+	app, _ := newSignedApp()
+
+	request := signedRequest(t, `{"id":1}`, "s3cret")
+	replay := request.Clone(request.Context())
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `billing: {"id":1}`, string(body))
+
+	replay.Body = io.NopCloser(strings.NewReader(`{"id":1}`))
+	response, err = app.Test(replay)
+	assert.Nil(t, err)
+	assert.Equal(t, 401, response.StatusCode)
+}
+
+func TestSignatureRejects(t *testing.T) {
+	app, signatures := newSignedApp()
+
+	tampered := signedRequest(t, `{"id":1}`, "s3cret")
+	tampered.Body = io.NopCloser(strings.NewReader(`{"id":2}`))
+	wrongPath := signedRequest(t, `{"id":1}`, "s3cret")
+	wrongPath.URL.RawQuery = "dry_run=0"
+	wrongPath.RequestURI = ""
+	unsigned := httptest.NewRequest("POST", "/orders", nil)
+	unsigned.Header.Set("Authorization", "Bearer token")
+
+	for name, request := range map[string]*http.Request{
+		"wrong secret": signedRequest(t, `{"id":1}`, "guess"),
+		"tampered":     tampered,
+		"wrong path":   wrongPath,
+		"unsigned":     unsigned,
+	} {
+		response, err := app.Test(request)
+		assert.Nil(t, err)
+		assert.Equal(t, 401, response.StatusCode, name)
+		assert.Equal(t, SignatureScheme, response.Header.Get("WWW-Authenticate"), name)
+	}
+
+	stale := signedRequest(t, `{"id":1}`, "s3cret")
+	signatures.now = func() time.Time { return time.Now().Add(6 * time.Minute) }
+	response, err := app.Test(stale)
+	assert.Nil(t, err)
+	assert.Equal(t, 401, response.StatusCode)
+}
+
+func TestNonceCacheExpires(t *testing.T) {
+	signatures := NewSignatures(config.SigningConfig{MaxSkew: time.Minute})
+	now := time.Now()
+	assert.True(t, signatures.remember("k n", now))
+	assert.False(t, signatures.remember("k n", now.Add(time.Minute)))
+	assert.True(t, signatures.remember("k n", now.Add(2*time.Minute)))
+}
@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/mail"
+	"github.com/jalal-akbar/belajar-golang-fiber/pii"
+)
+
+// verifyAudience keeps verification links from passing as access tokens
+// and the other way round.
+const verifyAudience = "verify-email"
+
+var ErrResendLimit = errors.New("auth: too many verification emails")
+
+// ErrInvalidLink is returned by Confirm for links that are forged,
+// expired or for an address the user no longer has.
+var ErrInvalidLink = errors.New("auth: invalid verification link")
+
+type verifyClaims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email"`
+}
+
+// VerifyMigrations create the tables of the addresses users registered
+// with, kept sealed and found by their blind index, and of the links
+// sent to them.
+var VerifyMigrations = []database.Migration{{
+	ID: "auth-0001",
+	Statements: []string{
+		`CREATE TABLE email_verifications (
+	user_id VARCHAR(255) PRIMARY KEY,
+	email TEXT NOT NULL,
+	email_index VARCHAR(255) NOT NULL,
+	verified_at TIMESTAMP NULL
+)`,
+		`CREATE INDEX email_verifications_email_index ON email_verifications (email_index)`,
+		`CREATE TABLE email_verification_sends (
+	user_id VARCHAR(255) NOT NULL,
+	sent_at TIMESTAMP NOT NULL
+)`,
+		`CREATE INDEX email_verification_sends_user_id ON email_verification_sends (user_id, sent_at)`,
+	},
+}}
+
+// Verification confirms the email addresses of new users with signed
+// links. It keeps the addresses and the links sent in the database, in
+// the tables VerifyMigrations create.
+type Verification struct {
+	cfg    config.VerifyConfig
+	sender mail.Sender
+	db     *database.DB
+	cipher *pii.Cipher
+	now    func() time.Time
+}
+
+func NewVerification(cfg config.VerifyConfig, sender mail.Sender, db *database.DB) *Verification {
+	return &Verification{cfg: cfg, sender: sender, db: db, now: time.Now}
+}
+
+// UseCipher keeps the addresses sealed with cipher from then on.
+func (v *Verification) UseCipher(cipher *pii.Cipher) {
+	v.cipher = cipher
+}
+
+// Send mails userID a link confirming email, to be called once the user
+// registered. Earlier links for another address stop working.
+func (v *Verification) Send(ctx context.Context, userID, email string) error {
+	err := v.db.InTx(ctx, func(ctx context.Context) error {
+		conn := v.db.Conn(ctx)
+		if _, err := conn.ExecContext(ctx, v.db.Rebind(`DELETE FROM email_verifications WHERE user_id = ?`), userID); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, v.db.Rebind(`INSERT INTO email_verifications (user_id, email, email_index, verified_at) VALUES (?, ?, ?, NULL)`),
+			userID, v.cipher.Seal(userID, email), v.index(email))
+		if err != nil {
+			return err
+		}
+		_, err = conn.ExecContext(ctx, v.db.Rebind(`INSERT INTO email_verification_sends (user_id, sent_at) VALUES (?, ?)`), userID, v.now().UTC())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return v.send(ctx, userID, email)
+}
+
+// Resend mails another link for the address userID registered with,
+// within the configured rate limits.
+func (v *Verification) Resend(ctx context.Context, userID string) error {
+	var email string
+	err := v.db.InTx(ctx, func(ctx context.Context) error {
+		sealed, verified, ok, err := v.get(ctx, userID, v.db.ForUpdate())
+		if err != nil {
+			return err
+		}
+		if !ok || verified {
+			return fiber.NewError(fiber.StatusConflict, "nothing to verify")
+		}
+		if email, err = v.cipher.Open(userID, sealed); err != nil {
+			return err
+		}
+
+		// Links older than a day don't count any more.
+		now := v.now().UTC()
+		conn := v.db.Conn(ctx)
+		if _, err := conn.ExecContext(ctx, v.db.Rebind(`DELETE FROM email_verification_sends WHERE user_id = ? AND sent_at <= ?`), userID, now.Add(-24*time.Hour)); err != nil {
+			return err
+		}
+		rows, err := conn.QueryContext(ctx, v.db.Rebind(`SELECT sent_at FROM email_verification_sends WHERE user_id = ? ORDER BY sent_at DESC`), userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		var recent []time.Time
+		for rows.Next() {
+			var sent time.Time
+			if err := rows.Scan(&sent); err != nil {
+				return err
+			}
+			recent = append(recent, sent)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		if len(recent) > 0 && now.Sub(recent[0]) < v.cfg.ResendInterval || len(recent) >= v.cfg.ResendLimit {
+			return ErrResendLimit
+		}
+		_, err = conn.ExecContext(ctx, v.db.Rebind(`INSERT INTO email_verification_sends (user_id, sent_at) VALUES (?, ?)`), userID, now)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return v.send(ctx, userID, email)
+}
+
+func (v *Verification) send(ctx context.Context, userID, email string) error {
+	now := v.now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, verifyClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{verifyAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(v.cfg.LinkTTL)),
+		},
+		Email: email,
+	}).SignedString([]byte(v.cfg.Secret))
+	if err != nil {
+		return err
+	}
+	link := strings.TrimSuffix(v.cfg.BaseURL, "/") + "/auth/verify-email?token=" + url.QueryEscape(token)
+	return v.sender.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Open this link to confirm your email address:\n\n%s\n\nThe link expires in %s.\n",
+			link, v.cfg.LinkTTL),
+	})
+}
+
+// Confirm checks a link's token and marks its address verified.
+func (v *Verification) Confirm(ctx context.Context, token string) error {
+	claims := &verifyClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(v.cfg.Secret), nil
+	},
+		jwt.WithValidMethods([]string{"HS256"}),
+		jwt.WithAudience(verifyAudience),
+		jwt.WithTimeFunc(v.now),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidLink, err)
+	}
+
+	return v.db.InTx(ctx, func(ctx context.Context) error {
+		sealed, _, ok, err := v.get(ctx, claims.Subject, v.db.ForUpdate())
+		if err != nil {
+			return err
+		}
+		if email, err := v.cipher.Open(claims.Subject, sealed); !ok || err != nil || email != claims.Email {
+			return fmt.Errorf("%w: link for an old address", ErrInvalidLink)
+		}
+		_, err = v.db.Conn(ctx).ExecContext(ctx, v.db.Rebind(`UPDATE email_verifications SET verified_at = ? WHERE user_id = ?`), v.now().UTC(), claims.Subject)
+		return err
+	})
+}
+
+// Verified reports whether userID confirmed their address.
+func (v *Verification) Verified(ctx context.Context, userID string) (bool, error) {
+	_, verified, _, err := v.get(ctx, userID, "")
+	return verified, err
+}
+
+// Email returns the address userID confirmed, if any.
+func (v *Verification) Email(ctx context.Context, userID string) (string, bool, error) {
+	sealed, verified, _, err := v.get(ctx, userID, "")
+	if err != nil || !verified {
+		return "", false, err
+	}
+	email, err := v.cipher.Open(userID, sealed)
+	if err != nil {
+		return "", false, err
+	}
+	return email, true, nil
+}
+
+// UserByEmail returns the user who confirmed email, compared without
+// regard to case. Should several have, it is the one who did last.
+func (v *Verification) UserByEmail(ctx context.Context, email string) (string, bool, error) {
+	var userID string
+	err := v.db.Conn(ctx).QueryRowContext(ctx, v.db.Rebind(`SELECT user_id FROM email_verifications WHERE email_index = ? AND verified_at IS NOT NULL ORDER BY verified_at DESC LIMIT 1`),
+		v.index(email)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return userID, true, nil
+}
+
+// Forget drops the address of userID and the links sent to it, whose
+// account is erased.
+func (v *Verification) Forget(ctx context.Context, userID string) error {
+	return v.db.InTx(ctx, func(ctx context.Context) error {
+		conn := v.db.Conn(ctx)
+		if _, err := conn.ExecContext(ctx, v.db.Rebind(`DELETE FROM email_verifications WHERE user_id = ?`), userID); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, v.db.Rebind(`DELETE FROM email_verification_sends WHERE user_id = ?`), userID)
+		return err
+	})
+}
+
+// get returns the sealed address userID registered with and whether they
+// confirmed it; ok is false if there is none. lock is appended to the
+// query, to lock the row in a transaction.
+func (v *Verification) get(ctx context.Context, userID, lock string) (sealed string, verified, ok bool, err error) {
+	var verifiedAt sql.NullTime
+	err = v.db.Conn(ctx).QueryRowContext(ctx, v.db.Rebind(`SELECT email, verified_at FROM email_verifications WHERE user_id = ?`+lock), userID).
+		Scan(&sealed, &verifiedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, false, nil
+	}
+	if err != nil {
+		return "", false, false, err
+	}
+	return sealed, verifiedAt.Valid, true, nil
+}
+
+func (v *Verification) index(email string) string {
+	return v.cipher.Index("email", strings.ToLower(strings.TrimSpace(email)))
+}
+
+// ConfirmHandler serves GET /auth/verify-email, which the links point to.
+func (v *Verification) ConfirmHandler(c *fiber.Ctx) error {
+	err := v.Confirm(c.UserContext(), c.Query("token"))
+	if errors.Is(err, ErrInvalidLink) {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid or expired link")
+	}
+	if err != nil {
+		return err
+	}
+	return c.SendString("email verified")
+}
+
+// ResendHandler sends the authenticated user another link.
+func (v *Verification) ResendHandler(c *fiber.Ctx) error {
+	userID := ctxutil.CurrentUser(c)
+	err := v.Resend(c.UserContext(), utils.CopyString(userID))
+	if errors.Is(err, ErrResendLimit) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(v.cfg.ResendInterval.Seconds())))
+		return fiber.NewError(fiber.StatusTooManyRequests, "too many verification emails, try again later")
+	}
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// RequireVerified answers 403 to users who haven't confirmed their email.
+func (v *Verification) RequireVerified() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		verified, err := v.Verified(c.UserContext(), ctxutil.CurrentUser(c))
+		if err != nil {
+			return err
+		}
+		if !verified {
+			return fiber.NewError(fiber.StatusForbidden, "email not verified")
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/mail"
+	"github.com/jalal-akbar/belajar-golang-fiber/pii"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+type outbox struct {
+	messages []mail.Message
+}
+
+func (o *outbox) Send(_ context.Context, message mail.Message) error {
+	o.messages = append(o.messages, message)
+	return nil
+}
+
+var linkPattern = regexp.MustCompile(`https://app\.example/auth/verify-email\?token=\S+`)
+
+func newVerifyApp(t *testing.T) (*fiber.App, *Verification, *outbox) {
+	sent := &outbox{}
+	verification := NewVerification(config.VerifyConfig{
+		Secret:         "s3cret",
+		BaseURL:        "https://app.example/",
+		LinkTTL:        time.Hour,
+		ResendInterval: time.Minute,
+		ResendLimit:    3,
+	}, sent, testkit.OpenDB(t, VerifyMigrations...))
+	app := fiber.New()
+	app.Get("/auth/verify-email", verification.ConfirmHandler)
+	api := app.Group("/api", testkit.FakeAuth)
+	api.Post("/me/verify-email", verification.ResendHandler)
+	api.Get("/orders", verification.RequireVerified(), func(c *fiber.Ctx) error { return c.SendString("orders") })
+	return app, verification, sent
+}
+
+func status(t *testing.T, app *fiber.App, method, target, user string) int {
+	return testkit.Do(t, app, method, target, nil, testkit.WithUser(user)).StatusCode
+}
+
+func TestVerifyEmail(t *testing.T) {
+	app, verification, sent := newVerifyApp(t)
+	assert.Nil(t, verification.Send(ctx, "42", "user@example.com"))
+	assert.Len(t, sent.messages, 1)
+	assert.Equal(t, "user@example.com", sent.messages[0].To)
+	link := linkPattern.FindString(sent.messages[0].Body)
+	assert.NotEmpty(t, link)
+
+	assert.Equal(t, 403, status(t, app, "GET", "/api/orders", "42"))
+	assert.Equal(t, 400, status(t, app, "GET", "/auth/verify-email?token=forged", ""))
+	assert.Equal(t, 200, status(t, app, "GET", link[len("https://app.example"):], ""))
+	assert.Equal(t, 200, status(t, app, "GET", "/api/orders", "42"))
+	assert.Equal(t, 409, status(t, app, "POST", "/api/me/verify-email", "42"))
+}
+
+func TestVerifyEmailSealed(t *testing.T) {
+	app, verification, sent := newVerifyApp(t)
+	cipher, err := pii.New(config.PIIConfig{Key: base64.StdEncoding.EncodeToString(make([]byte, 32))})
+	assert.Nil(t, err)
+	verification.UseCipher(cipher)
+
+	assert.Nil(t, verification.Send(ctx, "42", "User@Example.com"))
+	var sealed, index string
+	assert.Nil(t, verification.db.QueryRowContext(ctx, `SELECT email, email_index FROM email_verifications WHERE user_id = '42'`).Scan(&sealed, &index))
+	assert.NotContains(t, sealed, "Example")
+	assert.NotContains(t, index, "example")
+	_, found, _ := verification.UserByEmail(ctx, "user@example.com")
+	assert.False(t, found)
+	link := linkPattern.FindString(sent.messages[0].Body)
+	assert.Equal(t, 200, status(t, app, "GET", link[len("https://app.example"):], ""))
+
+	email, _, err := verification.Email(ctx, "42")
+	assert.Nil(t, err)
+	assert.Equal(t, "User@Example.com", email)
+	userID, _, err := verification.UserByEmail(ctx, " user@example.COM")
+	assert.Nil(t, err)
+	assert.Equal(t, "42", userID)
+
+	// Another address, or none, takes the old one out of the index.
+	assert.Nil(t, verification.Send(ctx, "42", "new@example.com"))
+	_, found, _ = verification.UserByEmail(ctx, "user@example.com")
+	assert.False(t, found)
+	assert.Nil(t, verification.Forget(ctx, "42"))
+	_, _, found, _ = verification.get(ctx, "42", "")
+	assert.False(t, found)
+}
+
+func TestVerifyLinkExpiresAndFollowsAddress(t *testing.T) {
+	app, verification, sent := newVerifyApp(t)
+	assert.Nil(t, verification.Send(ctx, "42", "old@example.com"))
+	old := linkPattern.FindString(sent.messages[0].Body)[len("https://app.example"):]
+	assert.Nil(t, verification.Send(ctx, "42", "new@example.com"))
+	current := linkPattern.FindString(sent.messages[1].Body)[len("https://app.example"):]
+
+	assert.Equal(t, 400, status(t, app, "GET", old, ""))
+	verification.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	assert.Equal(t, 400, status(t, app, "GET", current, ""))
+	verified, err := verification.Verified(ctx, "42")
+	assert.Nil(t, err)
+	assert.False(t, verified)
+}
+
+func TestResendLimits(t *testing.T) {
+	app, verification, sent := newVerifyApp(t)
+	now := time.Now()
+	verification.now = func() time.Time { return now }
+	assert.Nil(t, verification.Send(ctx, "42", "user@example.com"))
+
+	assert.Equal(t, 429, status(t, app, "POST", "/api/me/verify-email", "42"))
+	now = now.Add(time.Minute)
+	assert.Equal(t, 202, status(t, app, "POST", "/api/me/verify-email", "42"))
+	now = now.Add(time.Minute)
+	assert.Equal(t, 202, status(t, app, "POST", "/api/me/verify-email", "42"))
+	now = now.Add(time.Minute)
+	assert.Equal(t, 429, status(t, app, "POST", "/api/me/verify-email", "42"))
+	assert.Len(t, sent.messages, 3)
+
+	now = now.Add(24 * time.Hour)
+	assert.Equal(t, 202, status(t, app, "POST", "/api/me/verify-email", "42"))
+	assert.Equal(t, 409, status(t, app, "POST", "/api/me/verify-email", "7"))
+}
+
+func TestVerificationOutlivesRestart(t *testing.T) {
+	app, before, sent := newVerifyApp(t)
+	now := time.Now()
+	before.now = func() time.Time { return now }
+	assert.Nil(t, before.Send(ctx, "42", "user@example.com"))
+	assert.Nil(t, before.Send(ctx, "7", "other@example.com"))
+	link := linkPattern.FindString(sent.messages[0].Body)
+	assert.Equal(t, 200, status(t, app, "GET", link[len("https://app.example"):], ""))
+
+	after := NewVerification(before.cfg, sent, before.db)
+	after.now = before.now
+	verified, err := after.Verified(ctx, "42")
+	assert.Nil(t, err)
+	assert.True(t, verified)
+	userID, _, _ := after.UserByEmail(ctx, "user@example.com")
+	assert.Equal(t, "42", userID)
+	// The link sent before the restart still counts against the limit.
+	assert.ErrorIs(t, after.Resend(ctx, "7"), ErrResendLimit)
+}
@@ -0,0 +1,88 @@
+package botfilter
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/middleware"
+)
+
+var tagKey = ctxutil.NewKey[string]("bot")
+
+type rule struct {
+	name    string
+	action  string
+	pattern *regexp.Regexp
+	limit   fiber.Handler
+}
+
+// New matches the User-Agent of every request against cfg.Rules and applies
+// the action of the first matching rule. Matches are counted in
+// http_bot_requests_total.
+func New(cfg config.BotConfig, registry *metrics.Registry) (fiber.Handler, error) {
+	rules := make([]rule, 0, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("botfilter: rule %q: %w", r.Name, err)
+		}
+		compiled := rule{name: r.Name, action: r.Action, pattern: pattern}
+
+		switch r.Action {
+		case "block", "tag":
+		case "limit":
+			if r.Limit <= 0 {
+				return nil, fmt.Errorf("botfilter: rule %q needs a positive limit", r.Name)
+			}
+			window := r.Window
+			if window <= 0 {
+				window = time.Minute
+			}
+			compiled.limit = limiter.New(limiter.Config{
+				Max:          r.Limit,
+				Expiration:   window,
+				KeyGenerator: middleware.RealIP,
+				LimitReached: func(c *fiber.Ctx) error {
+					return fiber.ErrTooManyRequests
+				},
+			})
+		default:
+			return nil, fmt.Errorf("botfilter: rule %q has unknown action %q", r.Name, r.Action)
+		}
+		rules = append(rules, compiled)
+	}
+
+	matched := registry.Counter("http_bot_requests_total", "Requests matched by a user-agent rule.", "rule", "action")
+
+	return func(c *fiber.Ctx) error {
+		userAgent := c.Get(fiber.HeaderUserAgent)
+		for _, r := range rules {
+			if !r.pattern.MatchString(userAgent) {
+				continue
+			}
+			matched.With(r.name, r.action).Inc()
+			tagKey.Set(c, r.name)
+
+			switch r.action {
+			case "block":
+				return fiber.ErrForbidden
+			case "limit":
+				return r.limit(c)
+			}
+			return c.Next()
+		}
+		return c.Next()
+	}, nil
+}
+
+// Tag is the name of the rule that matched the request, if any.
+func Tag(c *fiber.Ctx) string {
+	tag, _ := tagKey.Get(c)
+	return tag
+}
@@ -0,0 +1,75 @@
+package botfilter
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func newApp(t *testing.T, registry *metrics.Registry, rules ...config.BotRule) *fiber.App {
+	filter, err := New(config.BotConfig{Rules: rules}, registry)
+	assert.Nil(t, err)
+	app := fiber.New()
+	app.Use(filter)
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("tag=" + Tag(c))
+	})
+	return app
+}
+
+func get(t *testing.T, app *fiber.App, userAgent string) int {
+	return testkit.Do(t, app, "GET", "/", nil, testkit.WithHeader("User-Agent", userAgent)).StatusCode
+}
+
+func TestRules(t *testing.T) {
+	registry := metrics.NewRegistry()
+	app := newApp(t, registry,
+		config.BotRule{Name: "scrapers", Pattern: `(?i)ahrefsbot|semrushbot`, Action: "block"},
+		config.BotRule{Name: "empty", Pattern: `^$`, Action: "limit", Limit: 2},
+		config.BotRule{Name: "crawlers", Pattern: `(?i)googlebot`, Action: "tag"},
+	)
+
+	assert.Equal(t, 200, get(t, app, "Mozilla/5.0"))
+	assert.Equal(t, 403, get(t, app, "Mozilla/5.0 (compatible; AhrefsBot/7.0)"))
+	assert.Equal(t, 200, get(t, app, "Googlebot/2.1"))
+
+	assert.Equal(t, 200, get(t, app, ""))
+	assert.Equal(t, 200, get(t, app, ""))
+	assert.Equal(t, 429, get(t, app, ""))
+
+	output := new(strings.Builder)
+	registry.Write(output)
+	assert.Contains(t, output.String(), `http_bot_requests_total{rule="scrapers",action="block"} 1`)
+	assert.Contains(t, output.String(), `http_bot_requests_total{rule="empty",action="limit"} 3`)
+	assert.Contains(t, output.String(), `http_bot_requests_total{rule="crawlers",action="tag"} 1`)
+}
+
+func TestTag(t *testing.T) {
+	app := newApp(t, metrics.NewRegistry(), config.BotRule{Name: "crawlers", Pattern: `(?i)bingbot`, Action: "tag"})
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("User-Agent", "bingbot/2.0")
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "tag=crawlers", string(body))
+}
+
+func TestInvalidRules(t *testing.T) {
+	for _, rule := range []config.BotRule{
+		{Name: "regexp", Pattern: `(`, Action: "block"},
+		{Name: "action", Pattern: `bot`, Action: "challenge"},
+		{Name: "limit", Pattern: `bot`, Action: "limit"},
+	} {
+		_, err := New(config.BotConfig{Rules: []config.BotRule{rule}}, metrics.NewRegistry())
+		assert.NotNil(t, err, rule.Name)
+	}
+}
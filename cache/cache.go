@@ -0,0 +1,90 @@
+// Package cache keeps hot lookups close at hand, in front of the stores
+// that answer them.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+)
+
+var ErrMiss = errors.New("cache: miss")
+
+// Store is a key-value cache. Get returns ErrMiss for keys it doesn't
+// hold.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Aside caches values of type T, JSON encoded, under keys prefixed with
+// its name: Get loads values missing from the store and puts them in for
+// ttl. Writers call Invalidate after changing a value. A failing store is counted and
+// bypassed, so the cache can only make lookups faster, not break them.
+type Aside[T any] struct {
+	store    Store
+	name     string
+	ttl      time.Duration
+	requests *metrics.CounterVec
+}
+
+func NewAside[T any](store Store, name string, ttl time.Duration, registry *metrics.Registry) *Aside[T] {
+	return &Aside[T]{
+		store:    store,
+		name:     name,
+		ttl:      ttl,
+		requests: registry.Counter("cache_requests_total", "Cache lookups by result: hit, miss or error.", "cache", "result"),
+	}
+}
+
+func (a *Aside[T]) Get(ctx context.Context, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	data, err := a.store.Get(ctx, a.key(key))
+	if err == nil {
+		var value T
+		if json.Unmarshal(data, &value) == nil {
+			a.requests.With(a.name, "hit").Inc()
+			return value, nil
+		}
+		err = errors.New("cache: undecodable value")
+	}
+	if errors.Is(err, ErrMiss) {
+		a.requests.With(a.name, "miss").Inc()
+	} else {
+		a.requests.With(a.name, "error").Inc()
+	}
+
+	value, err := load(ctx)
+	if err != nil {
+		return value, err
+	}
+	if data, err := json.Marshal(value); err == nil {
+		a.store.Set(ctx, a.key(key), data, a.ttl)
+	}
+	return value, nil
+}
+
+// Warm loads the value of key and puts it in the store, whether or not it
+// is already there. Unlike Get, it isn't counted as a lookup.
+func (a *Aside[T]) Warm(ctx context.Context, key string, load func(ctx context.Context) (T, error)) error {
+	value, err := load(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return a.store.Set(ctx, a.key(key), data, a.ttl)
+}
+
+func (a *Aside[T]) Invalidate(ctx context.Context, key string) error {
+	return a.store.Delete(ctx, a.key(key))
+}
+
+func (a *Aside[T]) key(key string) string {
+	return a.name + ":" + key
+}
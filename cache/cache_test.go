@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	Name string `json:"name"`
+}
+
+func TestAside(t *testing.T) {
+	server := miniredis.RunT(t)
+	registry := metrics.NewRegistry()
+	users := NewAside[user](NewRedis(redis.NewClient(&redis.Options{Addr: server.Addr()})), "users", time.Minute, registry)
+	ctx := context.Background()
+
+	loads := 0
+	load := func(ctx context.Context) (user, error) {
+		loads++
+		return user{Name: "alice"}, nil
+	}
+	for i := 0; i < 3; i++ {
+		got, err := users.Get(ctx, "1", load)
+		assert.Nil(t, err)
+		assert.Equal(t, "alice", got.Name)
+	}
+	assert.Equal(t, 1, loads)
+	assert.Equal(t, time.Minute, server.TTL("users:1"))
+
+	assert.Nil(t, users.Invalidate(ctx, "1"))
+	users.Get(ctx, "1", load)
+	assert.Equal(t, 2, loads)
+
+	// Failed loads aren't cached.
+	missing := errors.New("not found")
+	_, err := users.Get(ctx, "2", func(ctx context.Context) (user, error) { return user{}, missing })
+	assert.ErrorIs(t, err, missing)
+	assert.False(t, server.Exists("users:2"))
+
+	// Without Redis lookups go to the loader.
+	server.Close()
+	got, err := users.Get(ctx, "1", load)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", got.Name)
+	assert.Equal(t, 3, loads)
+
+	var out strings.Builder
+	registry.Write(&out)
+	assert.Contains(t, out.String(), `cache_requests_total{cache="users",result="hit"} 2`)
+	assert.Contains(t, out.String(), `cache_requests_total{cache="users",result="miss"} 3`)
+	assert.Contains(t, out.String(), `cache_requests_total{cache="users",result="error"} 1`)
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+)
+
+// Memory stores the cache in the process, for deployments with a single
+// instance. It holds at most maxBytes of keys and values and evicts the
+// least recently used entries to make room. Expired entries are dropped
+// when they are looked up or reach the end of the list.
+type Memory struct {
+	maxBytes  int64
+	now       func() time.Time
+	evictions *metrics.CounterVec
+	bytes     *metrics.Gauge
+	entries   *metrics.Gauge
+
+	mu    sync.Mutex
+	size  int64
+	order *list.List // front is the most recently used
+	items map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time // zero for entries without a TTL
+}
+
+func (e *memoryEntry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+func NewMemory(maxBytes int64, registry *metrics.Registry) *Memory {
+	return &Memory{
+		maxBytes:  maxBytes,
+		now:       time.Now,
+		evictions: registry.Counter("cache_evictions_total", "Entries evicted from the in-memory cache, by reason: size or expired.", "reason"),
+		bytes:     registry.Gauge("cache_memory_bytes", "Bytes of keys and values held by the in-memory cache.").With(),
+		entries:   registry.Gauge("cache_memory_entries", "Entries held by the in-memory cache.").With(),
+		order:     list.New(),
+		items:     map[string]*list.Element{},
+	}
+}
+
+// Get returns the stored slice itself; callers mustn't change it.
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	element, ok := m.items[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	entry := element.Value.(*memoryEntry)
+	if m.expired(entry) {
+		m.remove(element, "expired")
+		return nil, ErrMiss
+	}
+	m.order.MoveToFront(element)
+	return entry.value, nil
+}
+
+// Set stores a copy of value. A zero ttl keeps it until it is evicted;
+// values larger than the whole cache aren't stored.
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := &memoryEntry{key: key, value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expires = m.now().Add(ttl)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if element, ok := m.items[key]; ok {
+		m.remove(element, "")
+	}
+	if entry.size() > m.maxBytes {
+		return nil
+	}
+	m.items[key] = m.order.PushFront(entry)
+	m.grow(entry.size(), 1)
+	for m.size > m.maxBytes {
+		oldest := m.order.Back()
+		if m.expired(oldest.Value.(*memoryEntry)) {
+			m.remove(oldest, "expired")
+		} else {
+			m.remove(oldest, "size")
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		if element, ok := m.items[key]; ok {
+			m.remove(element, "")
+		}
+	}
+	return nil
+}
+
+func (m *Memory) expired(entry *memoryEntry) bool {
+	return !entry.expires.IsZero() && !m.now().Before(entry.expires)
+}
+
+// remove drops an entry, counting it as evicted for reason unless that is
+// empty.
+func (m *Memory) remove(element *list.Element, reason string) {
+	entry := m.order.Remove(element).(*memoryEntry)
+	delete(m.items, entry.key)
+	m.grow(-entry.size(), -1)
+	if reason != "" {
+		m.evictions.With(reason).Inc()
+	}
+}
+
+func (m *Memory) grow(bytes int64, entries int) {
+	m.size += bytes
+	m.bytes.Add(float64(bytes))
+	m.entries.Add(float64(entries))
+}
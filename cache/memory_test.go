@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	registry := metrics.NewRegistry()
+	// Room for three 10-byte entries.
+	memory := NewMemory(30, registry)
+	now := time.Unix(0, 0)
+	memory.now = func() time.Time { return now }
+	ctx := context.Background()
+	value := []byte("12345678")
+
+	for _, key := range []string{"k1", "k2", "k3"} {
+		memory.Set(ctx, key, value, time.Minute)
+	}
+	// k1 is used, so k2 is the least recently used entry.
+	_, err := memory.Get(ctx, "k1")
+	assert.Nil(t, err)
+	memory.Set(ctx, "k4", value, time.Minute)
+	_, err = memory.Get(ctx, "k2")
+	assert.ErrorIs(t, err, ErrMiss)
+	for _, key := range []string{"k1", "k3", "k4"} {
+		_, err = memory.Get(ctx, key)
+		assert.Nil(t, err, key)
+	}
+
+	// Replacing a value doesn't count it twice.
+	memory.Set(ctx, "k4", []byte("abcdefgh"), 0)
+	assert.Equal(t, int64(30), memory.size)
+	got, _ := memory.Get(ctx, "k4")
+	assert.Equal(t, "abcdefgh", string(got))
+
+	now = now.Add(time.Minute)
+	_, err = memory.Get(ctx, "k1")
+	assert.ErrorIs(t, err, ErrMiss)
+	_, err = memory.Get(ctx, "k4")
+	assert.Nil(t, err, "entries without a TTL don't expire")
+
+	memory.Set(ctx, "huge", make([]byte, 100), 0)
+	_, err = memory.Get(ctx, "huge")
+	assert.ErrorIs(t, err, ErrMiss)
+	memory.Delete(ctx, "k3", "k4")
+	assert.Equal(t, int64(0), memory.size)
+
+	var out strings.Builder
+	registry.Write(&out)
+	assert.Contains(t, out.String(), `cache_evictions_total{reason="size"} 1`)
+	assert.Contains(t, out.String(), `cache_evictions_total{reason="expired"} 1`)
+	assert.Contains(t, out.String(), "cache_memory_bytes 0")
+	assert.Contains(t, out.String(), "cache_memory_entries 0")
+}
+
+func benchmarkStore(b *testing.B, store Store) {
+	ctx := context.Background()
+	value := make([]byte, 512)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = "orders:" + strconv.Itoa(i)
+		store.Set(ctx, keys[i], value, time.Minute)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i%len(keys)]
+			if i%10 == 0 {
+				store.Set(ctx, key, value, time.Minute)
+			} else {
+				store.Get(ctx, key)
+			}
+			i++
+		}
+	})
+}
+
+// The Redis numbers are for miniredis over loopback, so they show the
+// cost of a round trip rather than of a real server.
+func BenchmarkMemory(b *testing.B) {
+	benchmarkStore(b, NewMemory(64<<20, metrics.NewRegistry()))
+}
+
+func BenchmarkRedis(b *testing.B) {
+	server := miniredis.NewMiniRedis()
+	if err := server.Start(); err != nil {
+		b.Fatal(err)
+	}
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	benchmarkStore(b, NewRedis(client))
+}
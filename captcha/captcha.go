@@ -0,0 +1,85 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+)
+
+var ErrFailed = errors.New("captcha: verification failed")
+
+// Verifier checks the token a CAPTCHA widget produced in the browser.
+type Verifier interface {
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// NoOp accepts every token.
+type NoOp struct{}
+
+func (NoOp) Verify(context.Context, string, string) error {
+	return nil
+}
+
+var siteVerifyURLs = map[string]string{
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// SiteVerify verifies tokens with the siteverify API that hCaptcha,
+// reCAPTCHA and Turnstile share.
+type SiteVerify struct {
+	url    string
+	secret string
+	client *httpclient.Client
+}
+
+func NewSiteVerify(provider, secret string, client *httpclient.Client) (*SiteVerify, error) {
+	endpoint, ok := siteVerifyURLs[provider]
+	if !ok {
+		return nil, fmt.Errorf("captcha: unknown provider %q", provider)
+	}
+	return &SiteVerify{url: endpoint, secret: secret, client: client}, nil
+}
+
+func (v *SiteVerify) Verify(ctx context.Context, token, remoteIP string) error {
+	form := url.Values{"secret": {v.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := v.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha: siteverify answered %s", response.Status)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Success {
+		if len(result.ErrorCodes) > 0 {
+			return fmt.Errorf("%w: %s", ErrFailed, strings.Join(result.ErrorCodes, ", "))
+		}
+		return ErrFailed
+	}
+	return nil
+}
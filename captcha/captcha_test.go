@@ -0,0 +1,104 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSiteVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, r.ParseForm())
+		assert.Equal(t, "rahasia", r.PostForm.Get("secret"))
+		assert.Equal(t, "1.2.3.4", r.PostForm.Get("remoteip"))
+		if r.PostForm.Get("response") == "valid" {
+			w.Write([]byte(`{"success":true}`))
+			return
+		}
+		w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+	}))
+	defer server.Close()
+
+	verifier, err := NewSiteVerify("turnstile", "rahasia", httpclient.New(config.Default().HTTPClient))
+	assert.Nil(t, err)
+	verifier.url = server.URL
+
+	assert.Nil(t, verifier.Verify(context.Background(), "valid", "1.2.3.4"))
+	err = verifier.Verify(context.Background(), "forged", "1.2.3.4")
+	assert.True(t, errors.Is(err, ErrFailed))
+	assert.Contains(t, err.Error(), "invalid-input-response")
+
+	_, err = NewSiteVerify("friendlycaptcha", "rahasia", nil)
+	assert.NotNil(t, err)
+}
+
+type tokenVerifier string
+
+func (v tokenVerifier) Verify(_ context.Context, token, _ string) error {
+	if token != string(v) {
+		return ErrFailed
+	}
+	return nil
+}
+
+func TestGuard(t *testing.T) {
+	guard := NewGuard(tokenVerifier("solved"), 2, time.Minute)
+	now := time.Now()
+	guard.now = func() time.Time { return now }
+
+	app := fiber.New()
+	app.Post("/login", guard.Middleware(), func(c *fiber.Ctx) error {
+		if c.FormValue("password") != "rahasia" {
+			return fiber.ErrUnauthorized
+		}
+		return c.SendString("welcome")
+	})
+	login := func(password, token string) int {
+		request := httptest.NewRequest("POST", "/login", strings.NewReader("password="+password))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if token != "" {
+			request.Header.Set(HeaderToken, token)
+		}
+		response, err := app.Test(request)
+		assert.Nil(t, err)
+		return response.StatusCode
+	}
+
+	assert.Equal(t, 401, login("salah", ""))
+	assert.Equal(t, 401, login("salah", ""))
+	assert.Equal(t, 403, login("rahasia", ""))
+	assert.Equal(t, 403, login("rahasia", "guessed"))
+	assert.Equal(t, 200, login("rahasia", "solved"))
+	assert.Equal(t, 200, login("rahasia", ""))
+
+	assert.Equal(t, 401, login("salah", ""))
+	assert.Equal(t, 401, login("salah", ""))
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 200, login("rahasia", ""))
+}
+
+func TestGuardWithoutThreshold(t *testing.T) {
+	app := fiber.New()
+	app.Post("/register", NewGuard(NoOp{}, 0, time.Minute).Middleware(), func(c *fiber.Ctx) error {
+		return c.SendString("registered")
+	})
+
+	request := httptest.NewRequest("POST", "/register", strings.NewReader("h-captcha-response=token"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	response, err = app.Test(httptest.NewRequest("POST", "/register", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 403, response.StatusCode)
+}
@@ -0,0 +1,126 @@
+package captcha
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/middleware"
+)
+
+// HeaderToken carries the CAPTCHA token for API clients. Browser forms post
+// it in the field their widget uses.
+const HeaderToken = "X-Captcha-Token"
+
+var tokenFields = []string{"h-captcha-response", "g-recaptcha-response", "cf-turnstile-response", "captcha_token"}
+
+// Guard asks a client for a CAPTCHA once its requests failed Threshold
+// times within Window, and until one succeeds. A Threshold of 0 always asks.
+type Guard struct {
+	verifier  Verifier
+	threshold int
+	window    time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+func NewGuard(verifier Verifier, threshold int, window time.Duration) *Guard {
+	return &Guard{
+		verifier:  verifier,
+		threshold: threshold,
+		window:    window,
+		now:       time.Now,
+		failures:  map[string][]time.Time{},
+	}
+}
+
+// Middleware protects the handlers after it. Responses with a 4xx status
+// other than 404 and 429 count as failures, 2xx responses clear them.
+func (g *Guard) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ip := middleware.RealIP(c)
+		if g.suspicious(ip) {
+			token := c.Get(HeaderToken)
+			for _, field := range tokenFields {
+				if token != "" {
+					break
+				}
+				token = c.FormValue(field)
+			}
+			if token == "" {
+				return fiber.NewError(fiber.StatusForbidden, "captcha required")
+			}
+			if err := g.verifier.Verify(correlation.Context(c), token, ip); err != nil {
+				if errors.Is(err, ErrFailed) {
+					return fiber.NewError(fiber.StatusForbidden, "captcha verification failed")
+				}
+				return err
+			}
+		}
+
+		err := c.Next()
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		}
+		switch {
+		case status >= 200 && status < 300 && err == nil:
+			g.reset(ip)
+		case status >= 400 && status < 500 && status != fiber.StatusNotFound && status != fiber.StatusTooManyRequests:
+			g.fail(ip)
+		}
+		return err
+	}
+}
+
+func (g *Guard) suspicious(ip string) bool {
+	if g.threshold <= 0 {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.recent(ip)) >= g.threshold
+}
+
+// maxTracked bounds the memory spent on clients that failed once and never
+// came back.
+const maxTracked = 10000
+
+func (g *Guard) fail(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.failures) >= maxTracked {
+		for other := range g.failures {
+			g.recent(other)
+		}
+	}
+	g.failures[ip] = append(g.recent(ip), g.now())
+}
+
+func (g *Guard) reset(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.failures, ip)
+}
+
+// recent drops failures older than the window. g.mu must be held.
+func (g *Guard) recent(ip string) []time.Time {
+	failures := g.failures[ip]
+	cutoff := g.now().Add(-g.window)
+	i := 0
+	for i < len(failures) && failures[i].Before(cutoff) {
+		i++
+	}
+	failures = failures[i:]
+	if len(failures) == 0 {
+		delete(g.failures, ip)
+	} else {
+		g.failures[ip] = failures
+	}
+	return failures
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/gen/client"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestClient drives the orders API through the generated client, which
+// also checks openapi/openapi.yaml against the routes.
+func TestClient(t *testing.T) {
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+	cfg.Database.SQLitePath = filepath.Join(t.TempDir(), "app.db")
+	app, err := newApp(cfg)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	defer app.Shutdown()
+	tokens, err := auth.New(cfg.JWT, nil, nil)
+	assert.Nil(t, err)
+	token, err := tokens.Sign("alice", userScopes...)
+	assert.Nil(t, err)
+	doer := &http.Client{Transport: testkit.Transport(app)}
+	shop := client.New("http://shop.example", client.WithHTTPClient(doer), client.WithToken(token))
+	ctx := context.Background()
+
+	order, err := shop.CreateOrder(ctx, client.NewOrder{Items: []client.NewItem{{SKU: "kopi", Quantity: 2, Price: "15000"}}})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, client.StatusCreated, order.Status)
+	assert.Equal(t, client.Money{Amount: "30000.00", Currency: "IDR"}, order.Amount)
+	assert.Equal(t, "IDR", order.Currency)
+	assert.Equal(t, "alice", order.UserID)
+
+	orders, err := shop.ListOrders(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, orders, 1)
+	got, err := shop.GetOrder(ctx, order.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, order.ID, got.ID)
+
+	cancelled, err := shop.CancelOrder(ctx, order.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, client.StatusCancelled, cancelled.Status)
+	_, err = shop.CancelOrder(ctx, order.ID)
+	assert.ErrorIs(t, err, client.ErrConflict)
+
+	_, err = shop.GetOrder(ctx, "missing")
+	assert.ErrorIs(t, err, client.ErrNotFound)
+	_, err = shop.SetOrderStatus(ctx, order.ID, client.StatusChange{Status: client.StatusPaid})
+	assert.ErrorIs(t, err, client.ErrForbidden)
+	_, err = shop.CreateOrder(ctx, client.NewOrder{Items: []client.NewItem{{SKU: "kopi", Quantity: 1, Price: "1"}}, Currency: "XYZ"})
+	assert.ErrorIs(t, err, client.ErrInvalid)
+
+	_, err = client.New("http://shop.example", client.WithHTTPClient(doer)).ListOrders(ctx)
+	assert.ErrorIs(t, err, client.ErrUnauthorized)
+}
@@ -0,0 +1,59 @@
+// Command smoketest runs the smoketest scenario against a deployed
+// instance and exits 1 if a step fails, to gate a deploy on it:
+//
+//	SMOKE_TOKEN=... smoketest -url https://shop.example -junit smoke.xml
+//
+// The token is of a test account; as a flag it would show in the process
+// list, so it is read from SMOKE_TOKEN.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/smoketest"
+)
+
+func main() {
+	baseURL := flag.String("url", os.Getenv("SMOKE_URL"), "base URL of the instance, defaults to $SMOKE_URL")
+	junit := flag.String("junit", "", "write a JUnit XML report to this file")
+	timeout := flag.Duration("step-timeout", 10*time.Second, "time limit of each step")
+	flag.Parse()
+
+	token := os.Getenv("SMOKE_TOKEN")
+	if *baseURL == "" || token == "" {
+		fmt.Fprintln(os.Stderr, "smoketest: -url (or SMOKE_URL) and SMOKE_TOKEN are required")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	results := smoketest.Run(ctx, smoketest.Options{BaseURL: *baseURL, Token: token, StepTimeout: *timeout})
+
+	smoketest.WriteText(os.Stdout, results)
+	if *junit != "" {
+		if err := writeJUnit(*junit, results); err != nil {
+			fmt.Fprintln(os.Stderr, "smoketest:", err)
+			os.Exit(2)
+		}
+	}
+	if !smoketest.Passed(results) {
+		os.Exit(1)
+	}
+}
+
+func writeJUnit(path string, results []smoketest.Result) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := smoketest.WriteJUnit(file, "smoketest", results); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
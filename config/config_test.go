@@ -0,0 +1,84 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, Default().Validate())
+
+	tests := map[string]func(cfg *Config){
+		"negative timeout":     func(cfg *Config) { cfg.Server.ReadTimeout = -1 },
+		"no concurrency":       func(cfg *Config) { cfg.Server.Concurrency = 0 },
+		"small read buffer":    func(cfg *Config) { cfg.Server.ReadBufferSize = 512 },
+		"prefork with restart": func(cfg *Config) { cfg.Server.Prefork = true; cfg.Server.GracefulRestart = true },
+		"prefork with tls":     func(cfg *Config) { cfg.Server.Prefork = true; cfg.TLS.CertFile = "cert.pem" },
+		"oidc without client":  func(cfg *Config) { cfg.OIDC.Issuer = "https://idp.example"; cfg.JWT.KeyFiles = []string{"jwt.pem"} },
+		"oidc without keys": func(cfg *Config) {
+			cfg.OIDC = OIDCConfig{Issuer: "https://idp.example", ClientID: "app", RedirectURL: "https://app.example/auth/oidc/callback"}
+		},
+		"sandbox without secret":   func(cfg *Config) { cfg.Payments.Provider = "sandbox"; cfg.Payments.BaseURL = "http://localhost:3000" },
+		"unknown payment provider": func(cfg *Config) { cfg.Payments.Provider = "paypal" },
+		"mysql without gorm":       func(cfg *Config) { cfg.Database.DSN = "mysql://app@tcp(localhost:3306)/app" },
+		"replicas without primary": func(cfg *Config) { cfg.Database.Replicas = []string{"postgres://replica/app"} },
+		"reserve above limit":      func(cfg *Config) { cfg.Admission.MaxInFlight = 2; cfg.Admission.Reserved = 2 },
+		"api key without plan":     func(cfg *Config) { cfg.APIKeys.Keys = []APIKey{{Name: "ci", Key: "secret"}} },
+		"unnamed middleware":       func(cfg *Config) { cfg.Middleware.Presets["web"] = []string{""} },
+		"relative web base url":    func(cfg *Config) { cfg.Web.BaseURL = "example.com" },
+		"no job workers":           func(cfg *Config) { cfg.Jobs.Workers = 0 },
+		"messaging without token":  func(cfg *Config) { cfg.Notify.Messaging.AccountSID = "AC1" },
+		"push without subject":     func(cfg *Config) { cfg.Notify.WebPush.PrivateKey = "key" },
+		"zero sms limit":           func(cfg *Config) { cfg.Notify.Limits["sms"] = ChannelLimit{Window: 1} },
+		"database in uploads":      func(cfg *Config) { cfg.Database.SQLitePath = cfg.Uploads.Dir + "/app.db" },
+		"no health check interval": func(cfg *Config) { cfg.Proxy.HealthCheck.Interval = 0 },
+		"no health check timeout":  func(cfg *Config) { cfg.Proxy.HealthCheck.Timeout = 0 },
+		"no unhealthy threshold":   func(cfg *Config) { cfg.Proxy.HealthCheck.UnhealthyThreshold = 0 },
+		"no healthy threshold":     func(cfg *Config) { cfg.Proxy.HealthCheck.HealthyThreshold = 0 },
+		"proxy route without prefix": func(cfg *Config) {
+			cfg.Proxy.Routes = []ProxyRoute{{Upstream: "http://localhost:8080"}}
+		},
+		"proxy route without upstream": func(cfg *Config) { cfg.Proxy.Routes = []ProxyRoute{{Prefix: "/inventory"}} },
+	}
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := Default()
+			modify(cfg)
+			assert.NotNil(t, cfg.Validate())
+		})
+	}
+}
+
+func TestLoadPreforkFromEnv(t *testing.T) {
+	t.Setenv("PREFORK", "true")
+	cfg, err := Load()
+	assert.Nil(t, err)
+	assert.True(t, cfg.Server.Prefork)
+
+	t.Setenv("PREFORK", "sometimes")
+	_, err = Load()
+	assert.NotNil(t, err)
+}
+
+func TestReload(t *testing.T) {
+	current := Default()
+	next := Default()
+	next.Log.Level = "debug"
+	next.Features = map[string]bool{"checkout": true}
+	reloaded, changed, restart := current.Reload(next)
+	assert.Equal(t, []string{SectionLogLevel, SectionFeatures}, changed)
+	assert.False(t, restart)
+	assert.Equal(t, "debug", reloaded.Log.Level)
+	assert.Equal(t, "info", current.Log.Level)
+
+	next.Addr = "localhost:4000"
+	reloaded, changed, restart = current.Reload(next)
+	assert.Len(t, changed, 2)
+	assert.True(t, restart)
+	assert.Equal(t, "localhost:3000", reloaded.Addr)
+
+	_, changed, restart = current.Reload(Default())
+	assert.Empty(t, changed)
+	assert.False(t, restart)
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"os"
+	"reflect"
+)
+
+// File is the path of the configuration file, named by CONFIG_FILE, or ""
+// for none.
+func File() string {
+	return os.Getenv("CONFIG_FILE")
+}
+
+// The sections of the configuration that can change while the app serves.
+// Changes to the others only take effect on a restart.
+const (
+	SectionLogLevel    = "log.level"
+	SectionRateLimits  = "rate_limits"
+	SectionFeatures    = "features"
+	SectionMaintenance = "admin.maintenance"
+)
+
+// reloadable gets and sets each section that can change while serving.
+var reloadable = []struct {
+	name string
+	get  func(c *Config) any
+	set  func(c, from *Config)
+}{
+	{SectionLogLevel, func(c *Config) any { return c.Log.Level }, func(c, from *Config) { c.Log.Level = from.Log.Level }},
+	{SectionRateLimits, func(c *Config) any { return c.RateLimit }, func(c, from *Config) { c.RateLimit = from.RateLimit }},
+	{SectionFeatures, func(c *Config) any { return c.Features }, func(c, from *Config) { c.Features = from.Features }},
+	{SectionMaintenance, func(c *Config) any { return c.Admin.Maintenance }, func(c, from *Config) { c.Admin.Maintenance = from.Admin.Maintenance }},
+}
+
+// Reload returns a copy of c with the sections of next that can change
+// while serving, the names of those that differ, and whether next differs
+// in others too, which take a restart.
+func (c *Config) Reload(next *Config) (reloaded *Config, changed []string, restart bool) {
+	copied := *c
+	for _, section := range reloadable {
+		if !reflect.DeepEqual(section.get(c), section.get(next)) {
+			changed = append(changed, section.name)
+			section.set(&copied, next)
+		}
+	}
+	// The secret stores of separate loads always differ.
+	withoutStore := *next
+	withoutStore.secrets = copied.secrets
+	return &copied, changed, !reflect.DeepEqual(&copied, &withoutStore)
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretsConfig lets any string setting be a reference to a secret instead
+// of its value:
+//
+//	vault://secret/data/app#jwt_key   key jwt_key of a Vault KV secret
+//	awssm://prod/db#password          key of a JSON AWS Secrets Manager secret
+//	awssm://prod/smtp                 the whole secret string
+//
+// References are resolved once by Load. With a RefreshInterval the store
+// keeps re-reading them in the background, for code that asks
+// Config.Secrets for current values; values older than CacheTTL are
+// fetched again on access.
+type SecretsConfig struct {
+	Vault           VaultConfig   `yaml:"vault"`
+	AWS             AWSConfig     `yaml:"aws"`
+	CacheTTL        time.Duration `yaml:"cache_ttl"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// VaultConfig defaults to VAULT_ADDR and VAULT_TOKEN.
+type VaultConfig struct {
+	Addr  string `yaml:"addr"`
+	Token string `yaml:"token"`
+}
+
+// AWSConfig defaults to AWS_REGION and the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN credentials. Endpoint
+// overrides the regional Secrets Manager endpoint.
+type AWSConfig struct {
+	Region   string `yaml:"region"`
+	Endpoint string `yaml:"endpoint"`
+}
+
+type secretBackend interface {
+	// fetch returns the secret at path as key/value pairs, or under "" when
+	// it isn't a JSON object.
+	fetch(ctx context.Context, path string) (map[string]string, error)
+}
+
+type cachedSecret struct {
+	values  map[string]string
+	fetched time.Time
+}
+
+// SecretStore fetches and caches secrets referenced from the config.
+type SecretStore struct {
+	cfg      SecretsConfig
+	backends map[string]secretBackend
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+	stop  chan struct{}
+}
+
+func NewSecretStore(cfg SecretsConfig) *SecretStore {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return &SecretStore{
+		cfg: cfg,
+		backends: map[string]secretBackend{
+			"vault": &vaultBackend{cfg: cfg.Vault, client: client},
+			"awssm": &awsBackend{cfg: cfg.AWS, client: client, credentials: awsCredentialsFromEnv, now: time.Now},
+		},
+		now:   time.Now,
+		cache: map[string]cachedSecret{},
+	}
+}
+
+// IsSecretRef reports whether value refers to a secret.
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, "vault://") || strings.HasPrefix(value, "awssm://")
+}
+
+// Get resolves a reference like vault://secret/data/app#jwt_key.
+func (s *SecretStore) Get(ctx context.Context, ref string) (string, error) {
+	scheme, rest, ok := strings.Cut(ref, "://")
+	backend := s.backends[scheme]
+	if !ok || backend == nil {
+		return "", fmt.Errorf("config: %q is not a secret reference", ref)
+	}
+	path, key, _ := strings.Cut(rest, "#")
+	source := scheme + "://" + path
+
+	s.mu.Lock()
+	cached, ok := s.cache[source]
+	s.mu.Unlock()
+	if !ok || (s.cfg.CacheTTL > 0 && s.now().Sub(cached.fetched) > s.cfg.CacheTTL) {
+		values, err := backend.fetch(ctx, path)
+		if err != nil {
+			return "", fmt.Errorf("config: fetching %s: %w", source, err)
+		}
+		cached = cachedSecret{values: values, fetched: s.now()}
+		s.mu.Lock()
+		s.cache[source] = cached
+		s.mu.Unlock()
+	}
+
+	value, ok := cached.values[key]
+	if !ok {
+		return "", fmt.Errorf("config: %s has no key %q", source, key)
+	}
+	return value, nil
+}
+
+// Refresh fetches every cached secret again. A failed fetch keeps the old
+// values.
+func (s *SecretStore) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	sources := make([]string, 0, len(s.cache))
+	for source := range s.cache {
+		sources = append(sources, source)
+	}
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, source := range sources {
+		scheme, path, _ := strings.Cut(source, "://")
+		values, err := s.backends[scheme].fetch(ctx, path)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("config: refreshing %s: %w", source, err)
+			}
+			continue
+		}
+		s.mu.Lock()
+		s.cache[source] = cachedSecret{values: values, fetched: s.now()}
+		s.mu.Unlock()
+	}
+	return firstErr
+}
+
+// Start refreshes the secrets every RefreshInterval until Stop, passing
+// failures to onError.
+func (s *SecretStore) Start(onError func(error)) {
+	if s.cfg.RefreshInterval <= 0 {
+		return
+	}
+	s.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(s.cfg.RefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Refresh(context.Background()); err != nil {
+					onError(err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *SecretStore) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+	}
+}
+
+// resolveSecrets replaces every secret reference among the string fields of
+// the struct v points to.
+func resolveSecrets(ctx context.Context, store *SecretStore, v interface{}) error {
+	return resolveValue(ctx, store, reflect.ValueOf(v).Elem())
+}
+
+func resolveValue(ctx context.Context, store *SecretStore, value reflect.Value) error {
+	switch value.Kind() {
+	case reflect.String:
+		if !IsSecretRef(value.String()) {
+			return nil
+		}
+		secret, err := store.Get(ctx, value.String())
+		if err != nil {
+			return err
+		}
+		value.SetString(secret)
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).IsExported() {
+				if err := resolveValue(ctx, store, value.Field(i)); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			if err := resolveValue(ctx, store, value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if value.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		iter := value.MapRange()
+		for iter.Next() {
+			if !IsSecretRef(iter.Value().String()) {
+				continue
+			}
+			secret, err := store.Get(ctx, iter.Value().String())
+			if err != nil {
+				return err
+			}
+			value.SetMapIndex(iter.Key(), reflect.ValueOf(secret))
+		}
+	}
+	return nil
+}
+
+// secretValues turns a secret string into key/value pairs: the fields of a
+// JSON object, or the whole string under "".
+func secretValues(secret string) map[string]string {
+	values := map[string]string{"": secret}
+	var object map[string]interface{}
+	if json.Unmarshal([]byte(secret), &object) != nil {
+		return values
+	}
+	for key, value := range object {
+		if s, ok := value.(string); ok {
+			values[key] = s
+		} else {
+			encoded, _ := json.Marshal(value)
+			values[key] = string(encoded)
+		}
+	}
+	return values
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The example request from the AWS Signature Version 4 documentation.
+func TestSignAWS(t *testing.T) {
+	request, err := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	assert.Nil(t, err)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	signAWS(request, nil, "iam", "us-east-1", awsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, now)
+
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-date, "+
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		request.Header.Get("Authorization"))
+}
+
+func TestResolveSecrets(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/secret/data/app", r.URL.Path)
+		assert.Equal(t, "vault-token", r.Header.Get("X-Vault-Token"))
+		w.Write([]byte(`{"data":{"data":{"admin_token":"rahasia","api_key":"k3y"},"metadata":{"version":3}}}`))
+	}))
+	defer vault.Close()
+
+	aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		var body map[string]string
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		switch body["SecretId"] {
+		case "prod/sentry":
+			w.Write([]byte(`{"SecretString":"https://key@sentry.example/1"}`))
+		default:
+			w.WriteHeader(400)
+			w.Write([]byte(`{"__type":"ResourceNotFoundException"}`))
+		}
+	}))
+	defer aws.Close()
+
+	cfg := Default()
+	cfg.Secrets.Vault = VaultConfig{Addr: vault.URL, Token: "vault-token"}
+	cfg.Secrets.AWS = AWSConfig{Region: "ap-southeast-3", Endpoint: aws.URL}
+	cfg.Admin.Token = "vault://secret/data/app#admin_token"
+	cfg.Sentry.DSN = "awssm://prod/sentry"
+	cfg.Proxy.Routes = []ProxyRoute{{
+		Prefix:               "/billing",
+		SetRequestHeaders:    map[string]string{"X-Api-Key": "vault://secret/data/app#api_key"},
+		RemoveRequestHeaders: []string{"Cookie"},
+	}}
+
+	store := NewSecretStore(cfg.Secrets)
+	store.backends["awssm"].(*awsBackend).credentials = func() (awsCredentials, error) {
+		return awsCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	}
+	assert.Nil(t, resolveSecrets(context.Background(), store, cfg))
+	assert.Equal(t, "rahasia", cfg.Admin.Token)
+	assert.Equal(t, "https://key@sentry.example/1", cfg.Sentry.DSN)
+	assert.Equal(t, "k3y", cfg.Proxy.Routes[0].SetRequestHeaders["X-Api-Key"])
+
+	_, err := store.Get(context.Background(), "vault://secret/data/app#missing")
+	assert.NotNil(t, err)
+	_, err = store.Get(context.Background(), "awssm://prod/unknown")
+	assert.NotNil(t, err)
+}
+
+type countingBackend struct {
+	fetches int
+}
+
+func (b *countingBackend) fetch(context.Context, string) (map[string]string, error) {
+	b.fetches++
+	return secretValues(`{"password":"v` + string(rune('0'+b.fetches)) + `"}`), nil
+}
+
+func TestSecretStoreCaching(t *testing.T) {
+	backend := &countingBackend{}
+	store := NewSecretStore(SecretsConfig{CacheTTL: time.Minute})
+	store.backends["vault"] = backend
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	value, err := store.Get(context.Background(), "vault://db#password")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", value)
+	value, _ = store.Get(context.Background(), "vault://db#password")
+	assert.Equal(t, "v1", value)
+	assert.Equal(t, 1, backend.fetches)
+
+	now = now.Add(2 * time.Minute)
+	value, _ = store.Get(context.Background(), "vault://db#password")
+	assert.Equal(t, "v2", value)
+
+	assert.Nil(t, store.Refresh(context.Background()))
+	value, _ = store.Get(context.Background(), "vault://db#password")
+	assert.Equal(t, "v3", value)
+}
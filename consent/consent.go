@@ -0,0 +1,255 @@
+// Package consent keeps track of which versions of the terms of service,
+// the privacy policy and other documents users accepted, and holds users
+// back from the API until they accepted the current ones.
+package consent
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/middleware"
+)
+
+// Document is the current version of a document users accept.
+type Document struct {
+	Name    string `json:"name"`
+	Title   string `json:"title,omitempty"`
+	Version string `json:"version"`
+	URL     string `json:"url,omitempty"`
+}
+
+// Acceptance is a version of a document a user accepted, and from where.
+type Acceptance struct {
+	Document   string    `json:"document"`
+	Version    string    `json:"version"`
+	AcceptedAt time.Time `json:"accepted_at"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// Status is where a user stands: the documents they still have to accept
+// and what they accepted so far, newest first.
+type Status struct {
+	Pending []Document   `json:"pending"`
+	History []Acceptance `json:"history"`
+}
+
+// Migrations create the table of the acceptances.
+var Migrations = []database.Migration{{
+	ID: "consent-0001",
+	Statements: []string{
+		`CREATE TABLE consents (
+	user_id VARCHAR(255) NOT NULL,
+	document VARCHAR(64) NOT NULL,
+	version VARCHAR(64) NOT NULL,
+	accepted_at TIMESTAMP NOT NULL,
+	ip VARCHAR(64) NOT NULL,
+	user_agent TEXT NOT NULL,
+	PRIMARY KEY (user_id, document, version)
+)`,
+	},
+}}
+
+// Consents keeps the acceptances in the database, in the table Migrations
+// create.
+type Consents struct {
+	documents []Document
+	exempt    []string
+	db        *database.DB
+	now       func() time.Time
+}
+
+func New(cfg config.ConsentConfig, db *database.DB) *Consents {
+	c := &Consents{exempt: cfg.Exempt, db: db, now: clock.System.Now}
+	for _, document := range cfg.Documents {
+		c.documents = append(c.documents, Document(document))
+	}
+	return c
+}
+
+// Register adds GET and POST /consents for the authenticated user on
+// router, and GET /legal/documents, listing the current documents, on
+// public.
+func (c *Consents) Register(router, public fiber.Router) {
+	router.Get("/consents", c.statusHandler)
+	router.Post("/consents", c.acceptHandler)
+	public.Get("/legal/documents", c.documentsHandler)
+}
+
+// Documents returns the current documents.
+func (c *Consents) Documents() []Document {
+	return append([]Document{}, c.documents...)
+}
+
+// Status returns where userID stands.
+func (c *Consents) Status(ctx context.Context, userID string) (Status, error) {
+	history, err := c.History(ctx, userID)
+	if err != nil {
+		return Status{}, err
+	}
+	return Status{Pending: c.pending(history), History: history}, nil
+}
+
+// pending returns the current documents history doesn't accept.
+func (c *Consents) pending(history []Acceptance) []Document {
+	pending := []Document{}
+	for _, document := range c.documents {
+		if !accepted(history, document) {
+			pending = append(pending, document)
+		}
+	}
+	return pending
+}
+
+func accepted(history []Acceptance, document Document) bool {
+	for _, acceptance := range history {
+		if acceptance.Document == document.Name && acceptance.Version == document.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// Accept records that userID accepted the given versions of documents,
+// keyed by name. Versions that aren't current any more are refused, so
+// users can't accept what they haven't seen. Versions accepted before
+// keep their first acceptance.
+func (c *Consents) Accept(ctx context.Context, userID string, versions map[string]string, ip, userAgent string) (Status, error) {
+	var accept []Document
+	for name, version := range versions {
+		document, ok := c.document(name)
+		if !ok {
+			return Status{}, fiber.NewError(fiber.StatusUnprocessableEntity, "unknown document "+name)
+		}
+		if version != document.Version {
+			return Status{}, fiber.NewError(fiber.StatusConflict, name+" is now at version "+document.Version)
+		}
+		accept = append(accept, document)
+	}
+	sort.Slice(accept, func(i, j int) bool { return accept[i].Name < accept[j].Name })
+
+	now := c.now().UTC()
+	for _, document := range accept {
+		_, err := c.db.Conn(ctx).ExecContext(ctx, c.db.Rebind(`INSERT INTO consents (user_id, document, version, accepted_at, ip, user_agent) VALUES (?, ?, ?, ?, ?, ?)`),
+			userID, document.Name, document.Version, now, ip, userAgent)
+		if err != nil && !errors.Is(database.Conflict(err), database.ErrConflict) {
+			return Status{}, err
+		}
+	}
+	return c.Status(ctx, userID)
+}
+
+// History returns what userID accepted, newest first.
+func (c *Consents) History(ctx context.Context, userID string) ([]Acceptance, error) {
+	rows, err := c.db.Conn(ctx).QueryContext(ctx, c.db.Rebind(`SELECT document, version, accepted_at, ip, user_agent FROM consents
+WHERE user_id = ? ORDER BY accepted_at DESC, document DESC, version DESC`), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	history := []Acceptance{}
+	for rows.Next() {
+		var acceptance Acceptance
+		if err := rows.Scan(&acceptance.Document, &acceptance.Version, &acceptance.AcceptedAt, &acceptance.IP, &acceptance.UserAgent); err != nil {
+			return nil, err
+		}
+		acceptance.AcceptedAt = acceptance.AcceptedAt.UTC()
+		history = append(history, acceptance)
+	}
+	return history, rows.Err()
+}
+
+// Anonymize hands the acceptances of userID over to pseudonym, dropping
+// where they were made from, for a user whose account is erased.
+func (c *Consents) Anonymize(ctx context.Context, userID, pseudonym string) error {
+	_, err := c.db.Conn(ctx).ExecContext(ctx, c.db.Rebind(`UPDATE consents SET user_id = ?, ip = '', user_agent = '' WHERE user_id = ?`), pseudonym, userID)
+	return err
+}
+
+func (c *Consents) document(name string) (Document, bool) {
+	for _, document := range c.documents {
+		if document.Name == name {
+			return document, true
+		}
+	}
+	return Document{}, false
+}
+
+// Middleware answers 403 to users who haven't accepted the current
+// version of every document, except on the exempt paths.
+func (c *Consents) Middleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userID := ctxutil.CurrentUser(ctx)
+		if userID == "" || c.exempted(ctx.Method(), ctx.Path()) {
+			return ctx.Next()
+		}
+		history, err := c.History(ctx.UserContext(), userID)
+		if err != nil {
+			return err
+		}
+		if pending := c.pending(history); len(pending) > 0 {
+			names := make([]string, len(pending))
+			for i, document := range pending {
+				names[i] = document.Name
+			}
+			return fiber.NewError(fiber.StatusForbidden, "consent required: "+strings.Join(names, ", "))
+		}
+		return ctx.Next()
+	}
+}
+
+// exempted reports whether a request is on an exempt path, of prefixes
+// such as "/api/consents" or "DELETE /api/me".
+func (c *Consents) exempted(method, path string) bool {
+	for _, exempt := range c.exempt {
+		prefix := exempt
+		if m, p, found := strings.Cut(exempt, " "); found {
+			if m != method {
+				continue
+			}
+			prefix = p
+		}
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Consents) statusHandler(ctx *fiber.Ctx) error {
+	status, err := c.Status(ctx.UserContext(), ctxutil.CurrentUser(ctx))
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(status)
+}
+
+// acceptHandler records the acceptance of the documents in the body, as
+// in {"accept":{"terms":"2024-06"}}.
+func (c *Consents) acceptHandler(ctx *fiber.Ctx) error {
+	var body struct {
+		Accept map[string]string `json:"accept"`
+	}
+	if err := ctx.BodyParser(&body); err != nil || len(body.Accept) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "nothing to accept")
+	}
+	status, err := c.Accept(ctx.UserContext(), utils.CopyString(ctxutil.CurrentUser(ctx)), body.Accept,
+		utils.CopyString(middleware.RealIP(ctx)), utils.CopyString(ctx.Get(fiber.HeaderUserAgent)))
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(status)
+}
+
+func (c *Consents) documentsHandler(ctx *fiber.Ctx) error {
+	return ctx.JSON(c.Documents())
+}
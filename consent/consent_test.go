@@ -0,0 +1,117 @@
+package consent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func newConsents(db *database.DB, termsVersion string) *Consents {
+	return New(config.ConsentConfig{
+		Documents: []config.DocumentConfig{
+			{Name: "terms", Title: "Terms of Service", Version: termsVersion},
+			{Name: "privacy", Title: "Privacy Policy", Version: "2024-01"},
+		},
+		Exempt: []string{"/consents", "DELETE /me"},
+	}, db)
+}
+
+func newApp(consents *Consents) *fiber.App {
+	app := fiber.New()
+	app.Use(testkit.FakeAuth)
+	app.Use(consents.Middleware())
+	consents.Register(app, app)
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	app.Get("/me", ok)
+	app.Delete("/me", ok)
+	return app
+}
+
+func TestAccept(t *testing.T) {
+	consents := newConsents(testkit.OpenDB(t, Migrations...), "2024-06")
+	app := newApp(consents)
+	alice := testkit.WithUser("alice")
+
+	testkit.Do(t, app, "GET", "/me", nil, alice).AssertStatus(403).AssertBody("consent required: terms, privacy")
+	testkit.Do(t, app, "DELETE", "/me", nil, alice).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/legal/documents", nil).AssertStatus(200).AssertContains(`"name":"terms"`)
+
+	var status Status
+	testkit.DoJSON(t, app, "GET", "/consents", nil, &status, alice).AssertStatus(200)
+	assert.Len(t, status.Pending, 2)
+	assert.Empty(t, status.History)
+
+	testkit.DoJSON(t, app, "POST", "/consents", `{"accept":{"terms":"2023-01"}}`, nil, alice).AssertStatus(409)
+	testkit.DoJSON(t, app, "POST", "/consents", `{"accept":{"cookies":"1"}}`, nil, alice).AssertStatus(422)
+	testkit.DoJSON(t, app, "POST", "/consents", `{}`, nil, alice).AssertStatus(400)
+
+	testkit.DoJSON(t, app, "POST", "/consents", `{"accept":{"terms":"2024-06"}}`, &status,
+		alice, testkit.WithHeader("User-Agent", "shop-app/1.0")).AssertStatus(200)
+	assert.Equal(t, []Document{{Name: "privacy", Title: "Privacy Policy", Version: "2024-01"}}, status.Pending)
+	if assert.Len(t, status.History, 1) {
+		assert.Equal(t, "terms", status.History[0].Document)
+		assert.Equal(t, "shop-app/1.0", status.History[0].UserAgent)
+	}
+	testkit.Do(t, app, "GET", "/me", nil, alice).AssertStatus(403).AssertBody("consent required: privacy")
+
+	testkit.DoJSON(t, app, "POST", "/consents", `{"accept":{"terms":"2024-06","privacy":"2024-01"}}`, &status, alice).AssertStatus(200)
+	assert.Empty(t, status.Pending)
+	assert.Len(t, status.History, 2)
+	testkit.Do(t, app, "GET", "/me", nil, alice).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/me", nil, testkit.WithUser("bob")).AssertStatus(403)
+}
+
+func TestNewVersion(t *testing.T) {
+	db := testkit.OpenDB(t, Migrations...)
+	ctx := context.Background()
+	consents := newConsents(db, "2024-06")
+	_, err := consents.Accept(ctx, "alice", map[string]string{"terms": "2024-06", "privacy": "2024-01"}, "10.0.0.1", "")
+	assert.Nil(t, err)
+
+	// A new version of the terms holds alice back again, with what she
+	// accepted before kept.
+	updated := newConsents(db, "2024-09")
+	app := newApp(updated)
+	alice := testkit.WithUser("alice")
+	testkit.Do(t, app, "GET", "/me", nil, alice).AssertStatus(403).AssertBody("consent required: terms")
+	status, err := updated.Accept(ctx, "alice", map[string]string{"terms": "2024-09"}, "10.0.0.2", "")
+	assert.Nil(t, err)
+	assert.Empty(t, status.Pending)
+	if assert.Len(t, status.History, 3) {
+		assert.Equal(t, "2024-09", status.History[0].Version)
+	}
+	testkit.Do(t, app, "GET", "/me", nil, alice).AssertStatus(200)
+}
+
+func TestAnonymize(t *testing.T) {
+	ctx := context.Background()
+	consents := newConsents(testkit.OpenDB(t, Migrations...), "2024-06")
+	_, err := consents.Accept(ctx, "alice", map[string]string{"terms": "2024-06"}, "10.0.0.1", "shop-app/1.0")
+	assert.Nil(t, err)
+
+	assert.Nil(t, consents.Anonymize(ctx, "alice", "deleted-1"))
+	history, err := consents.History(ctx, "alice")
+	assert.Nil(t, err)
+	assert.Empty(t, history)
+	history, err = consents.History(ctx, "deleted-1")
+	assert.Nil(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "2024-06", history[0].Version)
+		assert.Empty(t, history[0].IP)
+		assert.Empty(t, history[0].UserAgent)
+	}
+}
+
+func TestExempted(t *testing.T) {
+	consents := newConsents(nil, "2024-06")
+	assert.True(t, consents.exempted("GET", "/consents"))
+	assert.True(t, consents.exempted("POST", "/consents/"))
+	assert.False(t, consents.exempted("GET", "/consentsx"))
+	assert.True(t, consents.exempted("DELETE", "/me"))
+	assert.False(t, consents.exempted("GET", "/me"))
+}
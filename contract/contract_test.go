@@ -0,0 +1,135 @@
+package contract
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareBody(t *testing.T) {
+	rules := map[string]Rule{
+		"$.id":           {Matchers: []Matcher{{Match: "regex", Regex: `\d+`}}},
+		"$.items":        {Matchers: []Matcher{{Match: "type", Min: intPtr(1)}}},
+		"$.items[*].sku": {Matchers: []Matcher{{Match: "include", Value: "-"}}},
+		"$.total":        {Matchers: []Matcher{{Match: "integer"}}},
+		"$.note":         {Matchers: []Matcher{{Match: "null"}, {Match: "type"}}, Combine: "OR"},
+	}
+	expected := `{"id": "1", "status": "created", "items": [{"sku": "a-b", "quantity": 1}], "total": 2, "note": "x"}`
+
+	tests := map[string]struct {
+		actual     string
+		mismatches []string
+	}{
+		"equal":          {actual: expected},
+		"extra fields":   {actual: `{"id": "1", "status": "created", "items": [{"sku": "a-b", "quantity": 1, "price": 3}], "total": 2, "note": "x", "more": true}`},
+		"matched values": {actual: `{"id": "42", "status": "created", "items": [{"sku": "c-d", "quantity": 7}, {"sku": "e-f", "quantity": 1}], "total": 9, "note": null}`},
+		"wrong values": {
+			actual: `{"id": "x1", "status": "paid", "items": [{"sku": "cd", "quantity": "7"}], "total": 9.5, "note": 1}`,
+			mismatches: []string{
+				`$.id: expected a match of \d+, got "x1"`,
+				`$.status: expected "created", got "paid"`,
+				`$.items[0].sku: expected a string including "-", got "cd"`,
+				`$.items[0].quantity: expected a number, got "7"`,
+				`$.total: expected an integer, got 9.5`,
+				`$.note: expected null, got 1`,
+				`$.note: expected a string, got 1`,
+			},
+		},
+		"missing and empty": {
+			actual:     `{"id": "1", "items": [], "total": 2, "note": "x"}`,
+			mismatches: []string{`$.status: missing`, `$.items: expected at least 1 elements, got 0`},
+		},
+		"not json": {actual: `oops`, mismatches: []string{`isn't JSON: "oops"`}},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			assert.ElementsMatch(t, test.mismatches, compareBody([]byte(expected), []byte(test.actual), rules))
+		})
+	}
+
+	assert.Equal(t, []string{"$: expected 1 elements, got 2"}, compareBody([]byte(`[1]`), []byte(`[1, 2]`), nil))
+	assert.Empty(t, compareBody(nil, []byte(`anything`), nil))
+}
+
+func TestLoad(t *testing.T) {
+	pact := `{
+		"consumer": {"name": "web"},
+		"provider": {"name": "api"},
+		"interactions": [{
+			"description": "v2",
+			"providerState": "a thing exists",
+			"request": {"method": "get", "path": "/things", "query": "a=1&b=2"},
+			"response": {"status": 200, "body": {"id": 1}, "matchingRules": {"$.body.id": {"match": "type"}}}
+		}, {
+			"description": "v3",
+			"providerStates": [{"name": "a thing exists", "params": {"id": 7}}],
+			"request": {"method": "GET", "path": "/things", "query": {"a": ["1"]}},
+			"response": {"body": {"id": 1}, "matchingRules": {"body": {"$.id": {"matchers": [{"match": "type"}]}}}}
+		}]
+	}`
+	path := filepath.Join(t.TempDir(), "pact.json")
+	assert.Nil(t, os.WriteFile(path, []byte(pact), 0o600))
+
+	loaded, err := Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "web", loaded.Consumer.Name)
+	v2, v3 := loaded.Interactions[0], loaded.Interactions[1]
+	assert.Equal(t, []State{{Name: "a thing exists"}}, v2.States)
+	assert.Equal(t, "GET", v2.Request.Method)
+	assert.Equal(t, "1", v2.Request.Query.Get("a"))
+	assert.Equal(t, "type", v2.Response.Rules["$.id"].Matchers[0].Match)
+	assert.Equal(t, float64(7), v3.States[0].Params["id"])
+	assert.Equal(t, 200, v3.Response.Status)
+	assert.Equal(t, []string{"1"}, v3.Request.Query["a"])
+	assert.Equal(t, "type", v3.Response.Rules["$.id"].Matchers[0].Match)
+}
+
+func TestVerifyInteraction(t *testing.T) {
+	app := fiber.New()
+	things := map[string]string{}
+	app.Get("/things/:id", func(c *fiber.Ctx) error {
+		name, ok := things[c.Params("id")]
+		if !ok {
+			return fiber.ErrNotFound
+		}
+		return c.JSON(fiber.Map{"id": c.Params("id"), "name": name, "owner": c.Get("X-User")})
+	})
+	verifier := NewVerifier("api", app, map[string]StateHandler{
+		"a thing exists": func(params map[string]any) error {
+			things[params["id"].(string)] = "kopi"
+			return nil
+		},
+	})
+	verifier.Prepare = func(request *http.Request) { request.Header.Set("X-User", "alice") }
+
+	interaction := Interaction{
+		States:  []State{{Name: "a thing exists", Params: map[string]any{"id": "1"}}},
+		Request: Request{Method: "GET", Path: "/things/1"},
+		Response: Response{
+			Status:  200,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    json.RawMessage(`{"id": "1", "name": "kopi", "owner": "alice"}`),
+		},
+	}
+	assert.Empty(t, verifier.VerifyInteraction(interaction))
+
+	interaction.Request.Path = "/things/2"
+	assert.Equal(t, []string{
+		`status: expected 200, got 404: Not Found`,
+		`header Content-Type: expected "application/json", got "text/plain; charset=utf-8"`,
+		`body isn't JSON: "Not Found"`,
+	}, verifier.VerifyInteraction(interaction))
+
+	interaction.States = []State{{Name: "nothing exists"}}
+	assert.Equal(t, []string{`no handler for provider state "nothing exists"`}, verifier.VerifyInteraction(interaction))
+}
+
+func intPtr(n int) *int {
+	return &n
+}
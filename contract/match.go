@@ -0,0 +1,321 @@
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// compareBody lists how the actual body differs from the expected one,
+// under rules. Objects may have fields beyond those expected; arrays must
+// have the expected elements unless a type matcher bounds their length.
+func compareBody(expected, actual []byte, rules map[string]Rule) []string {
+	if len(bytes.TrimSpace(expected)) == 0 {
+		return nil
+	}
+	want, err := decode(expected)
+	if err != nil {
+		return []string{"isn't valid in the pact: " + err.Error()}
+	}
+	got, err := decode(actual)
+	if err != nil {
+		return []string{fmt.Sprintf("isn't JSON: %q", actual)}
+	}
+	c := &comparison{}
+	for path, rule := range rules {
+		c.rules = append(c.rules, pathRule{segments: splitPath(path), rule: rule})
+	}
+	c.compare([]string{"$"}, want, got, nil)
+	return c.mismatches
+}
+
+func decode(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	return value, err
+}
+
+type pathRule struct {
+	segments []string
+	rule     Rule
+}
+
+type comparison struct {
+	rules      []pathRule
+	mismatches []string
+}
+
+func (c *comparison) fail(path []string, format string, args ...any) {
+	c.mismatches = append(c.mismatches, joinPath(path)+": "+fmt.Sprintf(format, args...))
+}
+
+// compare compares the values at path. Values below one matched by type
+// inherit that rule, unless a rule of their own overrides it.
+func (c *comparison) compare(path []string, expected, actual any, inherited *Rule) {
+	rule := c.ruleFor(path)
+	if rule == nil {
+		rule = inherited
+	}
+	var cascade *Rule
+	if rule != nil && rule.has("type") {
+		cascade = &Rule{Matchers: []Matcher{{Match: "type"}}}
+	}
+
+	switch want := expected.(type) {
+	case map[string]any:
+		got, ok := actual.(map[string]any)
+		if !ok {
+			c.fail(path, "expected an object, got %s", describe(actual))
+			return
+		}
+		if rule != nil && rule.has("equality") {
+			c.equal(path, expected, actual)
+			return
+		}
+		for key, value := range want {
+			child := append(append([]string{}, path...), key)
+			field, ok := got[key]
+			if !ok {
+				c.fail(child, "missing")
+				continue
+			}
+			c.compare(child, value, field, cascade)
+		}
+	case []any:
+		got, ok := actual.([]any)
+		if !ok {
+			c.fail(path, "expected an array, got %s", describe(actual))
+			return
+		}
+		if rule != nil && rule.has("equality") {
+			c.equal(path, expected, actual)
+			return
+		}
+		if rule != nil && rule.has("type") {
+			c.bounds(path, rule, len(got))
+			if len(want) == 0 {
+				return
+			}
+			for i, element := range got {
+				c.compare(index(path, i), want[0], element, cascade)
+			}
+			return
+		}
+		if len(got) != len(want) {
+			c.fail(path, "expected %d elements, got %d", len(want), len(got))
+			return
+		}
+		for i := range want {
+			c.compare(index(path, i), want[i], got[i], cascade)
+		}
+	default:
+		if rule == nil {
+			c.equal(path, expected, actual)
+			return
+		}
+		c.match(path, rule, expected, actual)
+	}
+}
+
+func (c *comparison) equal(path []string, expected, actual any) {
+	if !reflect.DeepEqual(expected, actual) {
+		c.fail(path, "expected %s, got %s", describe(expected), describe(actual))
+	}
+}
+
+func (c *comparison) bounds(path []string, rule *Rule, n int) {
+	for _, m := range rule.Matchers {
+		if m.Min != nil && n < *m.Min {
+			c.fail(path, "expected at least %d elements, got %d", *m.Min, n)
+		}
+		if m.Max != nil && n > *m.Max {
+			c.fail(path, "expected at most %d elements, got %d", *m.Max, n)
+		}
+	}
+}
+
+// match checks a scalar against the matchers of rule.
+func (c *comparison) match(path []string, rule *Rule, expected, actual any) {
+	either := strings.EqualFold(rule.Combine, "OR")
+	var failures []string
+	for _, m := range rule.Matchers {
+		problem := matchValue(m, expected, actual)
+		if problem == "" && either {
+			return
+		}
+		if problem != "" {
+			failures = append(failures, problem)
+		}
+	}
+	for _, problem := range failures {
+		c.fail(path, "%s", problem)
+	}
+}
+
+func matchValue(m Matcher, expected, actual any) string {
+	switch m.Match {
+	case "type":
+		if kind(expected) != kind(actual) {
+			return fmt.Sprintf("expected %s, got %s", article(kind(expected)), describe(actual))
+		}
+	case "regex":
+		var text string
+		switch v := actual.(type) {
+		case string:
+			text = v
+		case json.Number:
+			text = v.String()
+		default:
+			return fmt.Sprintf("expected a string matching %s, got %s", m.Regex, describe(actual))
+		}
+		pattern, err := regexp.Compile(`^(?:` + m.Regex + `)$`)
+		if err != nil {
+			return "invalid regex: " + err.Error()
+		}
+		if !pattern.MatchString(text) {
+			return fmt.Sprintf("expected a match of %s, got %s", m.Regex, describe(actual))
+		}
+	case "include":
+		text, ok := actual.(string)
+		if !ok || !strings.Contains(text, m.Value) {
+			return fmt.Sprintf("expected a string including %q, got %s", m.Value, describe(actual))
+		}
+	case "integer", "decimal", "number":
+		n, ok := actual.(json.Number)
+		if !ok {
+			return fmt.Sprintf("expected %s, got %s", article(m.Match), describe(actual))
+		}
+		_, err := strconv.ParseInt(n.String(), 10, 64)
+		if m.Match == "integer" && err != nil || m.Match == "decimal" && err == nil {
+			return fmt.Sprintf("expected %s, got %s", article(m.Match), describe(actual))
+		}
+	case "null":
+		if actual != nil {
+			return fmt.Sprintf("expected null, got %s", describe(actual))
+		}
+	case "equality":
+		if !reflect.DeepEqual(expected, actual) {
+			return fmt.Sprintf("expected %s, got %s", describe(expected), describe(actual))
+		}
+	default:
+		return fmt.Sprintf("unsupported matcher %q", m.Match)
+	}
+	return ""
+}
+
+func (r *Rule) has(match string) bool {
+	for _, m := range r.Matchers {
+		if m.Match == match {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleFor returns the rule of path. Of several rules matching it, the one
+// with the fewest wildcards wins.
+func (c *comparison) ruleFor(path []string) *Rule {
+	var best *Rule
+	bestWildcards := -1
+	for i := range c.rules {
+		wildcards, ok := matchPath(c.rules[i].segments, path)
+		if ok && (best == nil || wildcards < bestWildcards) {
+			best, bestWildcards = &c.rules[i].rule, wildcards
+		}
+	}
+	return best
+}
+
+func matchPath(pattern, path []string) (int, bool) {
+	if len(pattern) != len(path) {
+		return 0, false
+	}
+	wildcards := 0
+	for i, segment := range pattern {
+		switch {
+		case segment == path[i]:
+		case segment == "*" && !strings.HasPrefix(path[i], "["):
+			wildcards++
+		case segment == "[*]" && strings.HasPrefix(path[i], "["):
+			wildcards++
+		default:
+			return 0, false
+		}
+	}
+	return wildcards, true
+}
+
+// splitPath splits a rule path such as "$.items[*].sku" into "$",
+// "items", "[*]" and "sku".
+func splitPath(path string) []string {
+	var segments []string
+	for _, part := range strings.Split(path, ".") {
+		for part != "" {
+			open := strings.Index(part, "[")
+			if open < 0 {
+				segments = append(segments, part)
+				break
+			}
+			if open > 0 {
+				segments = append(segments, part[:open])
+			}
+			end := strings.Index(part[open:], "]")
+			if end < 0 {
+				segments = append(segments, part[open:])
+				break
+			}
+			segments = append(segments, part[open:open+end+1])
+			part = part[open+end+1:]
+		}
+	}
+	return segments
+}
+
+func index(path []string, i int) []string {
+	return append(append([]string{}, path...), "["+strconv.Itoa(i)+"]")
+}
+
+func joinPath(path []string) string {
+	var b strings.Builder
+	for i, segment := range path {
+		if i > 0 && !strings.HasPrefix(segment, "[") {
+			b.WriteByte('.')
+		}
+		b.WriteString(segment)
+	}
+	return b.String()
+}
+
+func kind(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	return "object"
+}
+
+func article(noun string) string {
+	if strings.ContainsRune("aeiou", rune(noun[0])) {
+		return "an " + noun
+	}
+	return "a " + noun
+}
+
+func describe(value any) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
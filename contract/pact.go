@@ -0,0 +1,192 @@
+// Package contract verifies the app against the pacts of its consumers:
+// files in the Pact format (versions 2 and 3) in which a consumer records
+// the requests it sends and the parts of the responses it relies on. Each
+// interaction is replayed against the app, after its provider state has
+// been set up, and the response is checked the way Pact checks it: extra
+// fields are allowed, and matching rules loosen values to their type or a
+// pattern.
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Pact is a consumer's contract with a provider.
+type Pact struct {
+	Consumer     Participant   `json:"consumer"`
+	Provider     Participant   `json:"provider"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Participant struct {
+	Name string `json:"name"`
+}
+
+// Interaction is a request and the response the consumer expects for it
+// once the provider is in the given states.
+type Interaction struct {
+	Description string
+	States      []State
+	Request     Request
+	Response    Response
+}
+
+// State is a provider state, such as "an order exists", with the
+// parameters of a version 3 pact.
+type State struct {
+	Name   string         `json:"name"`
+	Params map[string]any `json:"params"`
+}
+
+type Request struct {
+	Method  string
+	Path    string
+	Query   url.Values
+	Headers map[string]string
+	Body    json.RawMessage
+}
+
+type Response struct {
+	Status  int
+	Headers map[string]string
+	Body    json.RawMessage
+	// Rules are the matching rules of the body by path, such as
+	// "$.items[*].sku", in the version 3 layout.
+	Rules map[string]Rule
+}
+
+// Rule is how a value in the body is matched: all its matchers must
+// match, or any with Combine "OR".
+type Rule struct {
+	Matchers []Matcher `json:"matchers"`
+	Combine  string    `json:"combine"`
+}
+
+// Matcher matches a value by Match: "type", "regex", "include",
+// "integer", "decimal", "number", "null" or "equality". Arrays matched by
+// type may be bounded with Min and Max.
+type Matcher struct {
+	Match string `json:"match"`
+	Regex string `json:"regex"`
+	Value string `json:"value"`
+	Min   *int   `json:"min"`
+	Max   *int   `json:"max"`
+}
+
+// Load reads a pact file.
+func Load(path string) (*Pact, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pact Pact
+	if err := json.Unmarshal(data, &pact); err != nil {
+		return nil, fmt.Errorf("contract: %s: %w", path, err)
+	}
+	return &pact, nil
+}
+
+// UnmarshalJSON reads an interaction of either version: version 2 names a
+// single providerState and keeps matching rules keyed by "$.body..."
+// paths, version 3 lists providerStates and groups the rules by part.
+func (i *Interaction) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Description    string  `json:"description"`
+		ProviderState  string  `json:"providerState"`
+		ProviderStates []State `json:"providerStates"`
+		Request        struct {
+			Method  string            `json:"method"`
+			Path    string            `json:"path"`
+			Query   json.RawMessage   `json:"query"`
+			Headers map[string]string `json:"headers"`
+			Body    json.RawMessage   `json:"body"`
+		} `json:"request"`
+		Response struct {
+			Status        int                        `json:"status"`
+			Headers       map[string]string          `json:"headers"`
+			Body          json.RawMessage            `json:"body"`
+			MatchingRules map[string]json.RawMessage `json:"matchingRules"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	query, err := parseQuery(raw.Request.Query)
+	if err != nil {
+		return fmt.Errorf("interaction %q: %w", raw.Description, err)
+	}
+	rules, err := parseRules(raw.Response.MatchingRules)
+	if err != nil {
+		return fmt.Errorf("interaction %q: %w", raw.Description, err)
+	}
+	*i = Interaction{
+		Description: raw.Description,
+		States:      raw.ProviderStates,
+		Request: Request{
+			Method:  strings.ToUpper(raw.Request.Method),
+			Path:    raw.Request.Path,
+			Query:   query,
+			Headers: raw.Request.Headers,
+			Body:    raw.Request.Body,
+		},
+		Response: Response{
+			Status:  raw.Response.Status,
+			Headers: raw.Response.Headers,
+			Body:    raw.Response.Body,
+			Rules:   rules,
+		},
+	}
+	if raw.ProviderState != "" {
+		i.States = []State{{Name: raw.ProviderState}}
+	}
+	if i.Response.Status == 0 {
+		i.Response.Status = 200
+	}
+	return nil
+}
+
+// parseQuery reads a query, a string in version 2 and a map of values in
+// version 3.
+func parseQuery(raw json.RawMessage) (url.Values, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return url.Values{}, nil
+	}
+	var query string
+	if json.Unmarshal(raw, &query) == nil {
+		return url.ParseQuery(query)
+	}
+	var values url.Values
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	return values, nil
+}
+
+// parseRules reads the matching rules of the body.
+func parseRules(raw map[string]json.RawMessage) (map[string]Rule, error) {
+	rules := map[string]Rule{}
+	if body, ok := raw["body"]; ok {
+		// Version 3: {"body": {"$.id": {"matchers": [...]}}}
+		if err := json.Unmarshal(body, &rules); err != nil {
+			return nil, fmt.Errorf("matching rules: %w", err)
+		}
+		return rules, nil
+	}
+	// Version 2: {"$.body.id": {"match": "type"}}
+	for path, data := range raw {
+		rest, ok := strings.CutPrefix(path, "$.body")
+		if !ok {
+			continue
+		}
+		var matcher Matcher
+		if err := json.Unmarshal(data, &matcher); err != nil {
+			return nil, fmt.Errorf("matching rule %s: %w", path, err)
+		}
+		rules["$"+rest] = Rule{Matchers: []Matcher{matcher}}
+	}
+	return rules, nil
+}
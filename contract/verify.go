@@ -0,0 +1,166 @@
+package contract
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StateHandler puts the provider into a state an interaction expects,
+// typically by seeding a repository with the fixtures params describe.
+type StateHandler func(params map[string]any) error
+
+// Verifier replays the interactions of pacts against an app.
+type Verifier struct {
+	provider string
+	app      *fiber.App
+	states   map[string]StateHandler
+
+	// Prepare, if set, changes each request before it is sent, for
+	// instance to replace the consumer's placeholder credentials with a
+	// valid token.
+	Prepare func(request *http.Request)
+}
+
+// NewVerifier verifies app as provider, setting up the provider states of
+// interactions with states.
+func NewVerifier(provider string, app *fiber.App, states map[string]StateHandler) *Verifier {
+	return &Verifier{provider: provider, app: app, states: states}
+}
+
+// VerifyDir verifies the pacts in the *.json files of dir that name the
+// verifier's provider, each interaction in a subtest of t.
+func (v *Verifier) VerifyDir(t *testing.T, dir string) {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified := 0
+	for _, path := range paths {
+		pact, err := Load(path)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if pact.Provider.Name != v.provider {
+			continue
+		}
+		v.Verify(t, pact)
+		verified++
+	}
+	if verified == 0 {
+		t.Errorf("contract: no pacts for %s in %s", v.provider, dir)
+	}
+}
+
+// Verify verifies the interactions of pact, each in a subtest of t.
+func (v *Verifier) Verify(t *testing.T, pact *Pact) {
+	t.Helper()
+	for _, interaction := range pact.Interactions {
+		interaction := interaction
+		t.Run(pact.Consumer.Name+"/"+interaction.Description, func(t *testing.T) {
+			for _, problem := range v.VerifyInteraction(interaction) {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+// VerifyInteraction sets up the states of interaction, sends its request
+// and returns how the response falls short of the one expected.
+func (v *Verifier) VerifyInteraction(interaction Interaction) []string {
+	for _, state := range interaction.States {
+		handler, ok := v.states[state.Name]
+		if !ok {
+			return []string{fmt.Sprintf("no handler for provider state %q", state.Name)}
+		}
+		if err := handler(state.Params); err != nil {
+			return []string{fmt.Sprintf("provider state %q: %v", state.Name, err)}
+		}
+	}
+
+	request := httptest.NewRequest(interaction.Request.Method, requestURI(interaction.Request), bytes.NewReader(interaction.Request.Body))
+	for name, value := range interaction.Request.Headers {
+		request.Header.Set(name, value)
+	}
+	if len(interaction.Request.Body) > 0 && request.Header.Get(fiber.HeaderContentType) == "" {
+		request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	if v.Prepare != nil {
+		v.Prepare(request)
+	}
+	response, err := v.app.Test(request, -1)
+	if err != nil {
+		return []string{"request failed: " + err.Error()}
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return []string{"reading the response: " + err.Error()}
+	}
+
+	expected := interaction.Response
+	var problems []string
+	if response.StatusCode != expected.Status {
+		problems = append(problems, fmt.Sprintf("status: expected %d, got %d: %s", expected.Status, response.StatusCode, body))
+	}
+	problems = append(problems, compareHeaders(expected.Headers, response.Header)...)
+	for _, problem := range compareBody(expected.Body, body, expected.Rules) {
+		problems = append(problems, "body "+problem)
+	}
+	return problems
+}
+
+func requestURI(request Request) string {
+	if len(request.Query) == 0 {
+		return request.Path
+	}
+	return request.Path + "?" + request.Query.Encode()
+}
+
+// compareHeaders checks the expected headers are among the actual ones.
+// Media types are compared without the parameters the consumer left out,
+// so "application/json" accepts "application/json; charset=utf-8".
+func compareHeaders(expected map[string]string, actual http.Header) []string {
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var problems []string
+	for _, name := range names {
+		want, got := expected[name], actual.Get(name)
+		if strings.EqualFold(name, fiber.HeaderContentType) && sameMediaType(want, got) || want == got {
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("header %s: expected %q, got %q", name, want, got))
+	}
+	return problems
+}
+
+func sameMediaType(expected, actual string) bool {
+	wantType, wantParams, err := mime.ParseMediaType(expected)
+	if err != nil {
+		return false
+	}
+	gotType, gotParams, err := mime.ParseMediaType(actual)
+	if err != nil || wantType != gotType {
+		return false
+	}
+	for name, value := range wantParams {
+		if !strings.EqualFold(gotParams[name], value) {
+			return false
+		}
+	}
+	return true
+}
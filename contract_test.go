@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/contract"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/money"
+	"github.com/jalal-akbar/belajar-golang-fiber/orders"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestContracts verifies the app against the pacts its consumers publish,
+// kept in pacts/ or the directory PACT_DIR names. Consumers authenticate
+// with "Bearer <user>", which is replaced with a token for that user.
+func TestContracts(t *testing.T) {
+	dir := os.Getenv("PACT_DIR")
+	if dir == "" {
+		dir = "pacts"
+	}
+
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+	cfg.Database.SQLitePath = filepath.Join(t.TempDir(), "contracts.db")
+	cfg.RBAC.Admins = []string{"admin"}
+	app, err := newApp(cfg)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	defer app.Shutdown()
+	tokens, err := auth.New(cfg.JWT, nil, nil)
+	assert.Nil(t, err)
+
+	// The fixtures go straight into the app's database.
+	db, err := database.Open(cfg.Database, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+	repo := orders.NewSQLRepository(db)
+
+	// as sends a request as user, failing unless it succeeds.
+	as := func(user, method, path, body string) error {
+		token, err := tokens.Sign(user, userScopes...)
+		if err != nil {
+			return err
+		}
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+token)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := app.Test(request, -1)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+		if response.StatusCode >= 300 {
+			return fmt.Errorf("%s %s: status %d", method, path, response.StatusCode)
+		}
+		return nil
+	}
+	// user makes sure the account of id exists, enabled and with roles.
+	// Accounts are made when their user first signs in; enabling one that
+	// wasn't made yet fails, and needn't succeed.
+	user := func(id string, roles ...string) error {
+		as("admin", "POST", "/admin/users/"+id+"/enable", "")
+		if err := as(id, "GET", "/api/orders", ""); err != nil {
+			return err
+		}
+		return as("admin", "PUT", "/admin/users/"+id+"/roles", fmt.Sprintf(`{"roles": [%s]}`, quoteAll(roles)))
+	}
+
+	verifier := contract.NewVerifier("belajar-golang-fiber", app, map[string]contract.StateHandler{
+		"an order exists": func(params map[string]any) error {
+			id, _ := params["id"].(string)
+			userID, _ := params["user_id"].(string)
+			created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+			return repo.Create(context.Background(), orders.Order{
+				ID:        id,
+				UserID:    userID,
+				Status:    orders.Created,
+				Items:     []orders.Item{{SKU: "kopi-susu", Quantity: 2, Price: money.MustParse("18000", "IDR")}},
+				Amount:    money.MustParse("36000", "IDR"),
+				CreatedAt: created,
+				UpdatedAt: created,
+			})
+		},
+		"user bob exists": func(map[string]any) error {
+			return user("bob")
+		},
+		"users alice and bob exist, alice with the support role": func(map[string]any) error {
+			if err := user("alice", "support"); err != nil {
+				return err
+			}
+			return user("bob")
+		},
+	})
+	verifier.Prepare = func(request *http.Request) {
+		subject, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return
+		}
+		token, err := tokens.Sign(subject, userScopes...)
+		assert.Nil(t, err)
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	verifier.VerifyDir(t, dir)
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = `"` + value + `"`
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,103 @@
+package correlation
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	HeaderRequestID     = fiber.HeaderXRequestID
+	HeaderCorrelationID = "X-Correlation-ID"
+)
+
+// propagated lists the headers carried from an incoming request to
+// everything it triggers: outbound calls, jobs, events.
+var propagated = []string{
+	HeaderRequestID,
+	HeaderCorrelationID,
+	"traceparent",
+	"tracestate",
+	"baggage",
+	"X-B3-TraceId",
+	"X-B3-SpanId",
+	"X-B3-ParentSpanId",
+	"X-B3-Sampled",
+}
+
+// Metadata maps header names to values. It is the carrier used wherever a
+// request leaves the process: HTTP headers, job payloads, message headers.
+type Metadata map[string]string
+
+type metadataKey struct{}
+
+func With(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// From returns a copy of the metadata stored in ctx, so callers can attach
+// it to a job or message without sharing the map.
+func From(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	copied := make(Metadata, len(md))
+	for name, value := range md {
+		copied[name] = value
+	}
+	return copied
+}
+
+// Set changes a propagated header in the metadata stored in ctx, for
+// middleware running after it was stored, like tracing starting a trace.
+func Set(ctx context.Context, name, value string) {
+	if md, ok := ctx.Value(metadataKey{}).(Metadata); ok {
+		md[name] = value
+	}
+}
+
+func RequestID(ctx context.Context) string {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md[HeaderRequestID]
+}
+
+func CorrelationID(ctx context.Context) string {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md[HeaderCorrelationID]
+}
+
+// Context returns the request's user context. If no middleware stored
+// metadata in it yet, the propagated headers are read from the request.
+func Context(c *fiber.Ctx) context.Context {
+	ctx := c.UserContext()
+	if _, ok := ctx.Value(metadataKey{}).(Metadata); ok {
+		return ctx
+	}
+	return With(ctx, FromHeaders(c))
+}
+
+func FromHeaders(c *fiber.Ctx) Metadata {
+	md := Metadata{}
+	for _, name := range propagated {
+		if value := c.Get(name); value != "" {
+			md[name] = value
+		}
+	}
+	return md
+}
+
+// Inject sets the metadata in ctx as headers, without overriding headers the
+// caller already set.
+func Inject(ctx context.Context, header http.Header) {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	for name, value := range md {
+		if header.Get(name) == "" {
+			header.Set(name, value)
+		}
+	}
+}
+
+// Detach keeps the metadata of ctx but drops its deadline and cancellation,
+// for work that outlives the request, like a goroutine started by a handler.
+func Detach(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
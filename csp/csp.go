@@ -0,0 +1,175 @@
+package csp
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+)
+
+const (
+	// maxReportSize caps report bodies; browsers send a few KB at most.
+	maxReportSize = 64 << 10
+	// maxViolations caps the distinct violations kept in memory. Reports of
+	// new violations beyond it are only counted in the metric.
+	maxViolations = 1000
+)
+
+// Violation aggregates the reports of one directive blocking one source on
+// one page.
+type Violation struct {
+	Directive   string    `json:"directive"`
+	BlockedURI  string    `json:"blocked_uri"`
+	DocumentURI string    `json:"document_uri"`
+	SourceFile  string    `json:"source_file,omitempty"`
+	Count       int       `json:"count"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+type Collector struct {
+	reports *metrics.CounterVec
+	now     func() time.Time
+
+	mu         sync.Mutex
+	violations map[[3]string]*Violation
+}
+
+func New(registry *metrics.Registry) *Collector {
+	return &Collector{
+		reports:    registry.Counter("csp_reports_total", "Content-Security-Policy violation reports.", "directive"),
+		now:        time.Now,
+		violations: map[[3]string]*Violation{},
+	}
+}
+
+// legacyReport is the application/csp-report body sent for report-uri.
+type legacyReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		BlockedURI         string `json:"blocked-uri"`
+		SourceFile         string `json:"source-file"`
+	} `json:"csp-report"`
+}
+
+// report is an entry of the application/reports+json body sent for
+// report-to.
+type report struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		BlockedURL         string `json:"blockedURL"`
+		SourceFile         string `json:"sourceFile"`
+	} `json:"body"`
+}
+
+// ReportHandler accepts violation reports in both the report-uri and the
+// report-to format.
+func (col *Collector) ReportHandler(c *fiber.Ctx) error {
+	body := c.Body()
+	if len(body) > maxReportSize {
+		return fiber.ErrRequestEntityTooLarge
+	}
+
+	contentType := string(c.Request().Header.ContentType())
+	switch {
+	case strings.HasPrefix(contentType, "application/reports+json"):
+		var reports []report
+		if err := json.Unmarshal(body, &reports); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid reports")
+		}
+		for _, r := range reports {
+			if r.Type != "csp-violation" {
+				continue
+			}
+			col.add(r.Body.EffectiveDirective, r.Body.BlockedURL, r.Body.DocumentURL, r.Body.SourceFile)
+		}
+	case strings.HasPrefix(contentType, "application/csp-report"), strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+		var r legacyReport
+		if err := json.Unmarshal(body, &r); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid report")
+		}
+		directive := r.Report.EffectiveDirective
+		if directive == "" {
+			directive, _, _ = strings.Cut(r.Report.ViolatedDirective, " ")
+		}
+		col.add(directive, r.Report.BlockedURI, r.Report.DocumentURI, r.Report.SourceFile)
+	default:
+		return fiber.ErrUnsupportedMediaType
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (col *Collector) add(directive, blockedURI, documentURI, sourceFile string) {
+	if directive == "" {
+		return
+	}
+	col.reports.With(directive).Inc()
+
+	key := [3]string{directive, origin(blockedURI), withoutQuery(documentURI)}
+	now := col.now()
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	violation, ok := col.violations[key]
+	if !ok {
+		if len(col.violations) >= maxViolations {
+			return
+		}
+		violation = &Violation{
+			Directive:   key[0],
+			BlockedURI:  key[1],
+			DocumentURI: key[2],
+			SourceFile:  withoutQuery(sourceFile),
+			FirstSeen:   now,
+		}
+		col.violations[key] = violation
+	}
+	violation.Count++
+	violation.LastSeen = now
+}
+
+// Summary returns the violations, most frequent first.
+func (col *Collector) Summary() []Violation {
+	col.mu.Lock()
+	summary := make([]Violation, 0, len(col.violations))
+	for _, violation := range col.violations {
+		summary = append(summary, *violation)
+	}
+	col.mu.Unlock()
+
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Count != summary[j].Count {
+			return summary[i].Count > summary[j].Count
+		}
+		return summary[i].LastSeen.After(summary[j].LastSeen)
+	})
+	return summary
+}
+
+func (col *Collector) SummaryHandler(c *fiber.Ctx) error {
+	return c.JSON(col.Summary())
+}
+
+// origin reduces a blocked URL to its origin so reports for different
+// paths of the same host add up. Keywords like "inline" stay as they are.
+func origin(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return uri
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func withoutQuery(uri string) string {
+	uri, _, _ = strings.Cut(uri, "?")
+	uri, _, _ = strings.Cut(uri, "#")
+	return uri
+}
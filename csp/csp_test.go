@@ -0,0 +1,61 @@
+package csp
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func post(t *testing.T, app *fiber.App, contentType, body string) int {
+	return testkit.Do(t, app, "POST", "/csp-report", strings.NewReader(body), testkit.WithHeader("Content-Type", contentType)).StatusCode
+}
+
+func TestCollector(t *testing.T) {
+	registry := metrics.NewRegistry()
+	collector := New(registry)
+	app := fiber.New()
+	app.Post("/csp-report", collector.ReportHandler)
+	app.Get("/csp-reports", collector.SummaryHandler)
+
+	legacy := `{"csp-report":{"document-uri":"https://example.com/page?id=1","violated-directive":"script-src-elem 'self'","blocked-uri":"https://evil.example/x.js?v=2","source-file":"https://example.com/page"}}`
+	assert.Equal(t, 204, post(t, app, "application/csp-report", legacy))
+	assert.Equal(t, 204, post(t, app, "application/csp-report", legacy))
+
+	reportTo := `[
+		{"type":"csp-violation","url":"https://example.com/page","body":{"documentURL":"https://example.com/page","effectiveDirective":"script-src-elem","blockedURL":"https://evil.example/y.js"}},
+		{"type":"csp-violation","body":{"documentURL":"https://example.com/","effectiveDirective":"style-src-attr","blockedURL":"inline"}},
+		{"type":"deprecation","body":{"id":"x"}}
+	]`
+	assert.Equal(t, 204, post(t, app, "application/reports+json", reportTo))
+
+	assert.Equal(t, 400, post(t, app, "application/csp-report", "{"))
+	assert.Equal(t, 415, post(t, app, "text/plain", legacy))
+
+	response, err := app.Test(httptest.NewRequest("GET", "/csp-reports", nil))
+	assert.Nil(t, err)
+	var summary []Violation
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&summary))
+	assert.Len(t, summary, 2)
+	assert.Equal(t, "script-src-elem", summary[0].Directive)
+	assert.Equal(t, "https://evil.example", summary[0].BlockedURI)
+	assert.Equal(t, "https://example.com/page", summary[0].DocumentURI)
+	assert.Equal(t, 3, summary[0].Count)
+	assert.Equal(t, "inline", summary[1].BlockedURI)
+
+	output := new(strings.Builder)
+	registry.Write(output)
+	assert.Contains(t, output.String(), `csp_reports_total{directive="script-src-elem"} 3`)
+}
+
+func TestReportTooLarge(t *testing.T) {
+	app := fiber.New()
+	app.Post("/csp-report", New(metrics.NewRegistry()).ReportHandler)
+	status := post(t, app, "application/csp-report", strings.Repeat(" ", maxReportSize+1))
+	assert.Equal(t, 413, status)
+}
@@ -0,0 +1,126 @@
+// Package ctxutil keeps the values middlewares leave for the handlers of a
+// request in c.Locals behind typed accessors, so a misspelt key or a wrong
+// type assertion doesn't compile rather than failing at runtime.
+package ctxutil
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type key int
+
+const (
+	userKey key = iota
+	requestIDKey
+	txKey
+	locationKey
+	emailKey
+	tenantKey
+	scopesKey
+)
+
+// CurrentUser returns the ID of the user the request is made by or for,
+// empty if none.
+func CurrentUser(c *fiber.Ctx) string {
+	id, _ := c.Locals(userKey).(string)
+	return id
+}
+
+func SetCurrentUser(c *fiber.Ctx, id string) {
+	c.Locals(userKey, id)
+}
+
+// Email returns the address the token of the request gives for its user,
+// empty if none.
+func Email(c *fiber.Ctx) string {
+	email, _ := c.Locals(emailKey).(string)
+	return email
+}
+
+func SetEmail(c *fiber.Ctx, email string) {
+	c.Locals(emailKey, email)
+}
+
+// Scopes returns the scopes the request was granted by the token or key
+// it was authenticated with.
+func Scopes(c *fiber.Ctx) []string {
+	scopes, _ := c.Locals(scopesKey).([]string)
+	return scopes
+}
+
+func SetScopes(c *fiber.Ctx, scopes []string) {
+	c.Locals(scopesKey, scopes)
+}
+
+// Tenant returns the tenant the request is for, empty in a deployment
+// serving a single one.
+func Tenant(c *fiber.Ctx) string {
+	tenant, _ := c.Locals(tenantKey).(string)
+	return tenant
+}
+
+func SetTenant(c *fiber.Ctx, tenant string) {
+	c.Locals(tenantKey, tenant)
+}
+
+// RequestID returns the ID the request is logged with.
+func RequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(requestIDKey).(string)
+	return id
+}
+
+func SetRequestID(c *fiber.Ctx, id string) {
+	c.Locals(requestIDKey, id)
+}
+
+// Tx returns the transaction the request runs in, or nil.
+func Tx(c *fiber.Ctx) *sql.Tx {
+	tx, _ := c.Locals(txKey).(*sql.Tx)
+	return tx
+}
+
+func SetTx(c *fiber.Ctx, tx *sql.Tx) {
+	c.Locals(txKey, tx)
+}
+
+// Location returns the time zone to show the request's user times in,
+// UTC if none was set.
+func Location(c *fiber.Ctx) *time.Location {
+	if location, ok := c.Locals(locationKey).(*time.Location); ok {
+		return location
+	}
+	return time.UTC
+}
+
+func SetLocation(c *fiber.Ctx, location *time.Location) {
+	c.Locals(locationKey, location)
+}
+
+// Key is the key of a value of type T a package keeps in c.Locals, for
+// values of its own types ctxutil can't name without importing it. Keys
+// are compared by identity, so each NewKey is distinct from every other.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns a new key; name only tells keys apart when debugging.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// Get returns the value of the request under k, and whether there is one.
+func (k *Key[T]) Get(c *fiber.Ctx) (T, bool) {
+	value, ok := c.Locals(k).(T)
+	return value, ok
+}
+
+func (k *Key[T]) Set(c *fiber.Ctx, value T) {
+	c.Locals(k, value)
+}
+
+func (k *Key[T]) String() string {
+	return k.name
+}
@@ -0,0 +1,67 @@
+package ctxutil_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessors(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		assert.Empty(t, ctxutil.CurrentUser(c))
+		assert.Empty(t, ctxutil.RequestID(c))
+		assert.Empty(t, ctxutil.Email(c))
+		assert.Empty(t, ctxutil.Tenant(c))
+		assert.Nil(t, ctxutil.Tx(c))
+		assert.Equal(t, time.UTC, ctxutil.Location(c))
+		// The old string keys aren't read.
+		c.Locals("user_id", "alice")
+		assert.Empty(t, ctxutil.CurrentUser(c))
+
+		ctxutil.SetCurrentUser(c, "bob")
+		ctxutil.SetRequestID(c, "req-1")
+		ctxutil.SetEmail(c, "bob@example.com")
+		ctxutil.SetTenant(c, "acme")
+		tx := &sql.Tx{}
+		ctxutil.SetTx(c, tx)
+		assert.Equal(t, "bob", ctxutil.CurrentUser(c))
+		assert.Equal(t, "req-1", ctxutil.RequestID(c))
+		assert.Equal(t, "bob@example.com", ctxutil.Email(c))
+		assert.Equal(t, "acme", ctxutil.Tenant(c))
+		assert.Same(t, tx, ctxutil.Tx(c))
+		jakarta := time.FixedZone("WIB", 7*60*60)
+		ctxutil.SetLocation(c, jakarta)
+		assert.Same(t, jakarta, ctxutil.Location(c))
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	testkit.Do(t, app, "GET", "/", nil).AssertStatus(204)
+}
+
+func TestKey(t *testing.T) {
+	type point struct{ X, Y int }
+	first, second := ctxutil.NewKey[point]("point"), ctxutil.NewKey[point]("point")
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		_, ok := first.Get(c)
+		assert.False(t, ok)
+		first.Set(c, point{1, 2})
+		got, ok := first.Get(c)
+		assert.True(t, ok)
+		assert.Equal(t, point{1, 2}, got)
+		// Keys of the same name are still distinct.
+		_, ok = second.Get(c)
+		assert.False(t, ok)
+		// A value of another type under the key isn't returned.
+		c.Locals(second, "not a point")
+		_, ok = second.Get(c)
+		assert.False(t, ok)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	testkit.Do(t, app, "GET", "/", nil).AssertStatus(204)
+}
@@ -0,0 +1,105 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/jalal-akbar/belajar-golang-fiber/timing"
+)
+
+// Source is one section of the dashboard. Fetch is called with a context
+// that expires after Timeout.
+type Source struct {
+	Name    string
+	Timeout time.Duration
+	Fetch   func(ctx context.Context) (interface{}, error)
+}
+
+type Response struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors map[string]string      `json:"errors,omitempty"`
+}
+
+// HTTPSources turns the configured endpoints into sources that GET their URL
+// through client and embed the JSON body as-is.
+func HTTPSources(client *httpclient.Client, cfg config.DashboardConfig) []Source {
+	sources := make([]Source, 0, len(cfg.Sources))
+	for _, source := range cfg.Sources {
+		url := source.URL
+		timeout := source.Timeout
+		if timeout <= 0 {
+			timeout = cfg.Timeout
+		}
+		sources = append(sources, Source{
+			Name:    source.Name,
+			Timeout: timeout,
+			Fetch: func(ctx context.Context) (interface{}, error) {
+				response, err := client.Get(ctx, url)
+				if err != nil {
+					return nil, err
+				}
+				defer response.Body.Close()
+
+				if response.StatusCode >= 300 {
+					return nil, fmt.Errorf("upstream returned %d", response.StatusCode)
+				}
+				var body json.RawMessage
+				if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+					return nil, err
+				}
+				return body, nil
+			},
+		})
+	}
+	return sources
+}
+
+// Handler fetches every source concurrently and merges the results. A
+// failing source only shows up under "errors"; the request fails with 503
+// when none of them answered.
+func Handler(sources []Source) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := correlation.Context(c)
+		timings := timing.From(c)
+		response := Response{
+			Data:   map[string]interface{}{},
+			Errors: map[string]string{},
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, source := range sources {
+			wg.Add(1)
+			go func(source Source) {
+				defer wg.Done()
+				fetchCtx, cancel := context.WithTimeout(ctx, source.Timeout)
+				defer cancel()
+
+				start := time.Now()
+				value, err := source.Fetch(fetchCtx)
+				timings.Add(source.Name, time.Since(start))
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					response.Errors[source.Name] = err.Error()
+					return
+				}
+				response.Data[source.Name] = value
+			}(source)
+		}
+		wg.Wait()
+
+		if len(sources) > 0 && len(response.Data) == 0 {
+			c.Status(fiber.StatusServiceUnavailable)
+		}
+		return c.JSON(response)
+	}
+}
@@ -0,0 +1,81 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDashboardMergesSources(t *testing.T) {
+	services := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/profile":
+			io.WriteString(w, `{"username":"jalal"}`)
+		case "/orders":
+			io.WriteString(w, `[{"id":1},{"id":2}]`)
+		case "/notifications":
+			time.Sleep(200 * time.Millisecond)
+			io.WriteString(w, `[]`)
+		}
+	}))
+	defer services.Close()
+
+	client := httpclient.New(config.HTTPClientConfig{Timeout: time.Second})
+	sources := HTTPSources(client, config.DashboardConfig{
+		Timeout: time.Second,
+		Sources: []config.DashboardSource{
+			{Name: "profile", URL: services.URL + "/profile"},
+			{Name: "orders", URL: services.URL + "/orders"},
+			{Name: "notifications", URL: services.URL + "/notifications", Timeout: 20 * time.Millisecond},
+		},
+	})
+
+	app := fiber.New()
+	app.Get("/api/dashboard", Handler(sources))
+
+	response, err := app.Test(httptest.NewRequest("GET", "/api/dashboard", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+
+	var result struct {
+		Data   map[string]json.RawMessage `json:"data"`
+		Errors map[string]string          `json:"errors"`
+	}
+	assert.Nil(t, json.Unmarshal(body, &result))
+	assert.JSONEq(t, `{"username":"jalal"}`, string(result.Data["profile"]))
+	assert.JSONEq(t, `[{"id":1},{"id":2}]`, string(result.Data["orders"]))
+	assert.Contains(t, result.Errors["notifications"], "deadline exceeded")
+}
+
+func TestDashboardAllSourcesFailed(t *testing.T) {
+	failing := func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("boom")
+	}
+
+	app := fiber.New()
+	app.Get("/api/dashboard", Handler([]Source{
+		{Name: "profile", Timeout: time.Second, Fetch: failing},
+		{Name: "orders", Timeout: time.Second, Fetch: failing},
+	}))
+
+	response, err := app.Test(httptest.NewRequest("GET", "/api/dashboard", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 503, response.StatusCode)
+
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"data":{},"errors":{"profile":"boom","orders":"boom"}}`, string(body))
+}
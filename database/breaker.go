@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ErrUnavailable is a call the breaker turned away while the database
+// is failing.
+var ErrUnavailable = errors.New("database: unavailable")
+
+// UnavailableError is ErrUnavailable with the time until the breaker lets
+// calls through again, for a Retry-After.
+type UnavailableError struct {
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return ErrUnavailable.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return ErrUnavailable
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+var breakerStates = [...]string{"closed", "open", "half-open"}
+
+// Breaker is a consecutive-failure circuit breaker for the database. Once
+// open it turns calls away with an *UnavailableError for the cooldown, so
+// requests fail fast instead of queueing for a pool the database can't
+// serve. After that calls go through again and the first to finish
+// closes it or opens it again. Unlike the breakers of httpclient it
+// doesn't hold back the calls after a trial one: a transaction that has
+// begun needs all of its calls to go through.
+//
+// Only failures of the database itself count, see failure; errors it
+// answers with, like a broken constraint, don't. A nil Breaker lets every
+// call through.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    *slog.Logger
+	now       func() time.Time
+	rejected  *metrics.Counter
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func NewBreaker(cfg config.DatabaseConfig, logger *slog.Logger, registry *metrics.Registry) *Breaker {
+	b := &Breaker{
+		threshold: cfg.BreakerThreshold,
+		cooldown:  cfg.BreakerCooldown,
+		logger:    logger,
+		now:       time.Now,
+		rejected:  registry.Counter("db_breaker_rejected_total", "Database calls turned away while the circuit breaker was open.").With(),
+	}
+	registry.GaugeFunc("db_breaker_state", "State of the database circuit breaker: 0 closed, 1 open, 2 half-open.", func() float64 {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return float64(b.state)
+	})
+	return b
+}
+
+// Do calls fn unless the breaker is open, and records how it went.
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.Record(err)
+	return err
+}
+
+// Allow returns an *UnavailableError while the breaker is open. Calls it
+// lets through are recorded with Record.
+func (b *Breaker) Allow() error {
+	if b == nil || b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen {
+		if wait := b.cooldown - b.now().Sub(b.openedAt); wait > 0 {
+			b.rejected.Inc()
+			return &UnavailableError{RetryAfter: wait}
+		}
+		b.state = breakerHalfOpen
+	}
+	return nil
+}
+
+// Record counts the outcome of a call. Calls the caller gave up on tell
+// nothing about the database and are ignored.
+func (b *Breaker) Record(err error) {
+	if b == nil || b.threshold <= 0 || errors.Is(err, context.Canceled) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failure(err) {
+		if b.state != breakerClosed {
+			b.logger.Info("database circuit breaker closed")
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.state == breakerClosed && b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+		b.logger.Warn("database circuit breaker open",
+			slog.Int("failures", b.failures),
+			slog.Duration("cooldown", b.cooldown),
+			slog.String("error", err.Error()))
+	}
+}
+
+// State is "closed", "open" or "half-open", for the admin status.
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return breakerStates[b.state]
+}
+
+// failure reports whether err shows the database unreachable or too busy
+// to answer in time.
+func failure(err error) bool {
+	var netErr net.Error
+	var sqliteErr *sqlite.Error
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return true
+	case errors.As(err, &netErr), pgconn.Timeout(err):
+		return true
+	case errors.As(err, &sqliteErr):
+		return sqliteErr.Code()&0xff == sqlite3.SQLITE_BUSY
+	}
+	return false
+}
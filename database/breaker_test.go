@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	registry := metrics.NewRegistry()
+	breaker := NewBreaker(config.DatabaseConfig{BreakerThreshold: 2, BreakerCooldown: 10 * time.Second}, slog.New(slog.NewTextHandler(io.Discard, nil)), registry)
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	breaker.now = func() time.Time { return now }
+	timeout := fmt.Errorf("get order: %w", context.DeadlineExceeded)
+
+	// Answers of the database and callers giving up don't count.
+	for _, err := range []error{sql.ErrNoRows, &ConflictError{Field: "id"}, context.Canceled, errors.New("order not found")} {
+		assert.Equal(t, err, breaker.Do(func() error { return err }))
+		assert.Equal(t, err, breaker.Do(func() error { return err }))
+	}
+	assert.Equal(t, "closed", breaker.State())
+
+	// Nor do failures in between successes.
+	assert.Equal(t, timeout, breaker.Do(func() error { return timeout }))
+	assert.Nil(t, breaker.Do(func() error { return nil }))
+	assert.Equal(t, timeout, breaker.Do(func() error { return timeout }))
+	assert.Equal(t, "closed", breaker.State())
+
+	assert.Equal(t, timeout, breaker.Do(func() error { return timeout }))
+	assert.Equal(t, "open", breaker.State())
+	now = now.Add(4 * time.Second)
+	called := false
+	err := breaker.Do(func() error {
+		called = true
+		return nil
+	})
+	var unavailable *UnavailableError
+	assert.ErrorAs(t, err, &unavailable)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, 6*time.Second, unavailable.RetryAfter)
+	assert.False(t, called)
+	assert.Equal(t, 1.0, registry.Counter("db_breaker_rejected_total", "").With().Value())
+
+	// After the cooldown a failure opens it again right away...
+	now = now.Add(6 * time.Second)
+	assert.Equal(t, timeout, breaker.Do(func() error { return timeout }))
+	assert.ErrorIs(t, breaker.Allow(), ErrUnavailable)
+
+	// ...and a success closes it.
+	now = now.Add(10 * time.Second)
+	assert.Nil(t, breaker.Allow())
+	assert.Equal(t, "half-open", breaker.State())
+	breaker.Record(nil)
+	assert.Equal(t, "closed", breaker.State())
+
+	var disabled *Breaker
+	assert.Nil(t, disabled.Do(func() error { return nil }))
+	disabled = NewBreaker(config.DatabaseConfig{}, nil, metrics.NewRegistry())
+	for i := 0; i < 10; i++ {
+		disabled.Record(timeout)
+	}
+	assert.Nil(t, disabled.Allow())
+}
+
+// TestBreakerSaturatedPool has requests time out waiting for the only
+// connection, until the breaker answers them right away instead.
+func TestBreakerSaturatedPool(t *testing.T) {
+	db, err := Open(config.DatabaseConfig{SQLitePath: ":memory:"}, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+	breaker := NewBreaker(config.DatabaseConfig{BreakerThreshold: 2, BreakerCooldown: time.Minute}, slog.New(slog.NewTextHandler(io.Discard, nil)), metrics.NewRegistry())
+
+	app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+		if errors.Is(err, ErrUnavailable) {
+			return c.SendStatus(fiber.StatusServiceUnavailable)
+		}
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}})
+	app.Use(func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.UserContext(), 20*time.Millisecond)
+		defer cancel()
+		c.SetUserContext(ctx)
+		return c.Next()
+	}, Middleware(db.DB, breaker))
+	app.Post("/notes", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusCreated) })
+
+	held, err := db.DB.Conn(context.Background())
+	assert.Nil(t, err)
+	do := func() (int, time.Duration) {
+		start := time.Now()
+		response, err := app.Test(httptest.NewRequest("POST", "/notes", nil), -1)
+		assert.Nil(t, err)
+		return response.StatusCode, time.Since(start)
+	}
+	status, _ := do()
+	assert.Equal(t, 500, status)
+	status, _ = do()
+	assert.Equal(t, 500, status)
+	status, elapsed := do()
+	assert.Equal(t, 503, status)
+	assert.Less(t, elapsed, 20*time.Millisecond)
+
+	held.Close()
+	breaker.now = func() time.Time { return time.Now().Add(time.Minute) }
+	status, _ = do()
+	assert.Equal(t, 201, status)
+	assert.Equal(t, "closed", breaker.State())
+}
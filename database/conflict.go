@@ -0,0 +1,89 @@
+package database
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ErrConflict is a write that broke a unique constraint, such as a second
+// user with a taken username.
+var ErrConflict = errors.New("database: duplicate key")
+
+// ConflictError is a unique constraint violation. Field is the column, or
+// columns separated by ", ", that must be unique, as far as the driver
+// tells: MySQL names only the index.
+type ConflictError struct {
+	Table string
+	Field string
+	Err   error
+}
+
+func (e *ConflictError) Error() string {
+	if e.Err == nil {
+		return ErrConflict.Error() + " on " + e.Field
+	}
+	return ErrConflict.Error() + " on " + e.Field + ": " + e.Err.Error()
+}
+
+// Unwrap makes a ConflictError both ErrConflict and the driver's error.
+func (e *ConflictError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrConflict}
+	}
+	return []error{ErrConflict, e.Err}
+}
+
+// Conflict returns err as a *ConflictError if it is a unique constraint
+// violation of SQLite, PostgreSQL or MySQL, and err as is otherwise.
+// Repositories pass the errors of their writes through it, so handlers
+// can answer 409 instead of leaking the driver's message in a 500.
+func Conflict(err error) error {
+	if err == nil {
+		return nil
+	}
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		return err
+	}
+	var sqliteErr *sqlite.Error
+	var pgErr *pgconn.PgError
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.As(err, &sqliteErr) && (sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY):
+		// "UNIQUE constraint failed: users.username (2067)"
+		columns := sqliteErr.Error()
+		columns = columns[strings.LastIndex(columns, "constraint failed: ")+len("constraint failed: "):]
+		columns, _, _ = strings.Cut(columns, " (")
+		table, fields := "", []string{}
+		for _, column := range strings.Split(columns, ", ") {
+			var field string
+			table, field, _ = strings.Cut(column, ".")
+			fields = append(fields, field)
+		}
+		return &ConflictError{Table: table, Field: strings.Join(fields, ", "), Err: err}
+	case errors.As(err, &pgErr) && pgErr.Code == "23505":
+		// "Key (username)=(alice) already exists."
+		field := pgErr.ConstraintName
+		if _, key, ok := strings.Cut(pgErr.Detail, "Key ("); ok {
+			field, _, _ = strings.Cut(key, ")=(")
+		}
+		return &ConflictError{Table: pgErr.TableName, Field: field, Err: err}
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == 1062:
+		// "Duplicate entry 'alice' for key 'users.users_username'"
+		key := mysqlErr.Message
+		if i := strings.LastIndex(key, " for key "); i >= 0 {
+			key = strings.Trim(key[i+len(" for key "):], "'")
+		}
+		table, index, ok := strings.Cut(key, ".")
+		if !ok {
+			table, index = "", key
+		}
+		return &ConflictError{Table: table, Field: index, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConflict(t *testing.T) {
+	db, err := Open(config.DatabaseConfig{SQLitePath: ":memory:"}, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	assert.Nil(t, db.Migrate(ctx, Migration{ID: "test-0001", Statements: []string{
+		"CREATE TABLE users (id TEXT PRIMARY KEY, username TEXT NOT NULL UNIQUE)",
+		"CREATE TABLE members (team TEXT NOT NULL, user_id TEXT NOT NULL, UNIQUE (team, user_id))",
+	}}))
+	exec := func(query string, args ...any) error {
+		_, err := db.ExecContext(ctx, query, args...)
+		return Conflict(err)
+	}
+
+	assert.Nil(t, exec("INSERT INTO users (id, username) VALUES (?, ?)", "1", "alice"))
+	err = exec("INSERT INTO users (id, username) VALUES (?, ?)", "2", "alice")
+	assert.ErrorIs(t, err, ErrConflict)
+	var conflict *ConflictError
+	assert.True(t, errors.As(err, &conflict))
+	assert.Equal(t, "users", conflict.Table)
+	assert.Equal(t, "username", conflict.Field)
+
+	err = exec("INSERT INTO users (id, username) VALUES (?, ?)", "1", "bob")
+	assert.True(t, errors.As(err, &conflict))
+	assert.Equal(t, "id", conflict.Field)
+
+	assert.Nil(t, exec("INSERT INTO members (team, user_id) VALUES (?, ?)", "a", "1"))
+	err = exec("INSERT INTO members (team, user_id) VALUES (?, ?)", "a", "1")
+	assert.True(t, errors.As(err, &conflict))
+	assert.Equal(t, "team, user_id", conflict.Field)
+
+	// Other constraints aren't conflicts.
+	err = exec("INSERT INTO users (id) VALUES (?)", "3")
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrConflict))
+	assert.Nil(t, Conflict(nil))
+
+	pgErr := &pgconn.PgError{Code: "23505", TableName: "users", ConstraintName: "users_username_key", Detail: "Key (username)=(alice) already exists."}
+	err = Conflict(pgErr)
+	assert.True(t, errors.As(err, &conflict))
+	assert.Equal(t, &ConflictError{Table: "users", Field: "username", Err: pgErr}, conflict)
+	assert.ErrorIs(t, err, pgErr)
+	notNull := &pgconn.PgError{Code: "23502"}
+	assert.Equal(t, error(notNull), Conflict(notNull))
+
+	mysqlErr := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'alice' for key 'users.users_username'"}
+	assert.True(t, errors.As(Conflict(mysqlErr), &conflict))
+	assert.Equal(t, &ConflictError{Table: "users", Field: "users_username", Err: mysqlErr}, conflict)
+	// Before MySQL 8.0.19 keys were named without their table.
+	mysqlErr = &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'alice' for key 'users_username'"}
+	assert.True(t, errors.As(Conflict(mysqlErr), &conflict))
+	assert.Equal(t, &ConflictError{Field: "users_username", Err: mysqlErr}, conflict)
+}
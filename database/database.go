@@ -0,0 +1,237 @@
+// Package database opens the SQL database the repositories keep their data
+// in: PostgreSQL when a DSN is configured, otherwise a local SQLite file,
+// so the app and its tests run without external services.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	_ "modernc.org/sqlite"
+)
+
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+)
+
+// DialectOf returns the dialect of the database at dsn, as Open and
+// OpenGorm read it.
+func DialectOf(dsn string) Dialect {
+	switch {
+	case dsn == "":
+		return SQLite
+	case strings.HasPrefix(dsn, "mysql://"):
+		return MySQL
+	}
+	return Postgres
+}
+
+// DB is a connection pool together with the dialect its queries are
+// written for. Queries use ? placeholders; Rebind adapts them.
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+
+	replicas *replicas
+}
+
+// Open opens the database of cfg. Its queries are recorded by
+// instrumentation, which may be nil.
+func Open(cfg config.DatabaseConfig, instrumentation *Instrumentation) (*DB, error) {
+	if cfg.DSN == "" {
+		return openSQLite(cfg.SQLitePath, instrumentation)
+	}
+	if !strings.HasPrefix(cfg.DSN, "postgres://") && !strings.HasPrefix(cfg.DSN, "postgresql://") {
+		return nil, errors.New("database: only postgres:// DSNs are supported")
+	}
+	db, err := instrumentation.open("pgx", cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	setPool(db, cfg)
+	primary := &DB{DB: db, Dialect: Postgres}
+	if len(cfg.Replicas) > 0 {
+		if primary.replicas, err = openReplicas(cfg, instrumentation); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return primary, nil
+}
+
+// Close closes the pool and those of the replicas.
+func (db *DB) Close() error {
+	if db.replicas != nil {
+		db.replicas.close()
+	}
+	return db.DB.Close()
+}
+
+func openSQLite(path string, instrumentation *Instrumentation) (*DB, error) {
+	dsn, err := sqliteDSN(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := instrumentation.open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	setSQLitePool(db)
+	return &DB{DB: db, Dialect: SQLite}, nil
+}
+
+// sqliteDSN names the database file at path, or a private in-memory
+// database for ":memory:".
+func sqliteDSN(path string) (string, error) {
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return "", err
+		}
+	}
+	return "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", nil
+}
+
+func setPool(db *sql.DB, cfg config.DatabaseConfig) {
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+}
+
+// setSQLitePool limits the pool to a single connection: SQLite allows one
+// writer at a time, and the connection keeps an in-memory database alive.
+func setSQLitePool(db *sql.DB) {
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+}
+
+// Rebind turns the ? placeholders of query into the $1, $2, ... Postgres
+// expects.
+func (db *DB) Rebind(query string) string {
+	if db.Dialect != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ForUpdate is the clause locking the rows a SELECT reads until the
+// transaction ends. SQLite has none: its writers are serialised anyway.
+func (db *DB) ForUpdate() string {
+	if db.Dialect == SQLite {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// Querier is what *sql.DB and *sql.Tx have in common.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type txKey struct{}
+
+// transaction is a transaction together with what is to happen once it
+// is committed.
+type transaction struct {
+	tx          *sql.Tx
+	afterCommit []func()
+}
+
+func withTx(ctx context.Context, tx *sql.Tx) (context.Context, *transaction) {
+	t := &transaction{tx: tx}
+	return context.WithValue(ctx, txKey{}, t), t
+}
+
+func (t *transaction) commit() error {
+	if err := t.tx.Commit(); err != nil {
+		return fmt.Errorf("database: commit: %w", err)
+	}
+	for _, fn := range t.afterCommit {
+		fn()
+	}
+	return nil
+}
+
+// Tx returns the transaction ctx carries.
+func Tx(ctx context.Context) (*sql.Tx, bool) {
+	t, ok := ctx.Value(txKey{}).(*transaction)
+	if !ok {
+		return nil, false
+	}
+	return t.tx, true
+}
+
+// AfterCommit calls fn once the transaction of ctx is committed, or right
+// away without one. It isn't called for transactions rolled back, which
+// suits invalidating caches of what the transaction changed.
+func AfterCommit(ctx context.Context, fn func()) {
+	if t, ok := ctx.Value(txKey{}).(*transaction); ok {
+		t.afterCommit = append(t.afterCommit, fn)
+		return
+	}
+	fn()
+}
+
+// Conn returns the transaction ctx carries, so repositories called inside
+// InTx take part in it, or else the pool.
+func (db *DB) Conn(ctx context.Context) Querier {
+	if tx, ok := Tx(ctx); ok {
+		return tx
+	}
+	return db.DB
+}
+
+func (db *DB) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return InTx(ctx, db.DB, fn)
+}
+
+// InTx runs fn in a transaction: the one ctx already carries, or a new one
+// of pool that is committed if fn succeeds and rolled back if it fails or
+// panics.
+func InTx(ctx context.Context, pool *sql.DB, fn func(ctx context.Context) error) (err error) {
+	if _, ok := Tx(ctx); ok {
+		return fn(ctx)
+	}
+	tx, err := pool.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	ctx, t := withTx(ctx, tx)
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	return t.commit()
+}
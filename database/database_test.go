@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebind(t *testing.T) {
+	db := &DB{Dialect: Postgres}
+	assert.Equal(t, "SELECT * FROM t WHERE a = $1 AND b IN ($2, $3)", db.Rebind("SELECT * FROM t WHERE a = ? AND b IN (?, ?)"))
+	db.Dialect = SQLite
+	assert.Equal(t, "SELECT ?", db.Rebind("SELECT ?"))
+}
+
+func TestMigrateAndInTx(t *testing.T) {
+	db, err := Open(config.DatabaseConfig{SQLitePath: ":memory:"}, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+	ctx := context.Background()
+
+	migration := Migration{ID: "test-0001", Statements: []string{"CREATE TABLE notes (body TEXT NOT NULL)"}}
+	assert.Nil(t, db.Migrate(ctx, migration))
+	// Applied migrations aren't run again.
+	assert.Nil(t, db.Migrate(ctx, migration))
+	assert.NotNil(t, db.Migrate(ctx, Migration{ID: "test-0002", Statements: []string{"CREATE TABLE notes (x TEXT)"}}))
+
+	insert := func(ctx context.Context) error {
+		_, err := db.Conn(ctx).ExecContext(ctx, "INSERT INTO notes (body) VALUES (?)", "hello")
+		return err
+	}
+	count := func() (n int) {
+		db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notes").Scan(&n)
+		return n
+	}
+
+	failed := errors.New("failed")
+	err = db.InTx(ctx, func(ctx context.Context) error {
+		insert(ctx)
+		// Nested calls join the transaction.
+		db.InTx(ctx, insert)
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, 0, count())
+
+	assert.Panics(t, func() {
+		db.InTx(ctx, func(ctx context.Context) error {
+			insert(ctx)
+			panic("boom")
+		})
+	})
+	assert.Equal(t, 0, count())
+
+	assert.Nil(t, db.InTx(ctx, insert))
+	assert.Equal(t, 1, count())
+}
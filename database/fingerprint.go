@@ -0,0 +1,85 @@
+package database
+
+import (
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var valueLists = regexp.MustCompile(`\(\?(?:, \?)+\)`)
+
+// Fingerprint normalises a statement so all executions of it look alike:
+// literals and placeholders become ?, lists of them (?+), and runs of
+// whitespace a single space.
+func Fingerprint(query string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == ' ' || ch == '\n' || ch == '\t' || ch == '\r':
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		switch {
+		case ch == '\'':
+			for i++; i < len(query); i++ {
+				if query[i] == '\'' {
+					// Quotes inside strings are doubled.
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			b.WriteByte('?')
+		case ch == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			for i+1 < len(query) && isDigit(query[i+1]) {
+				i++
+			}
+			b.WriteByte('?')
+		case isDigit(ch) && (i == 0 || !isWord(query[i-1])):
+			for i+1 < len(query) && (isDigit(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	fingerprint := strings.ReplaceAll(b.String(), "(? ,", "(?,")
+	fingerprint = strings.ReplaceAll(fingerprint, "?,?", "?, ?")
+	return valueLists.ReplaceAllString(fingerprint, "(?+)")
+}
+
+// fingerprintID is a short, stable ID of a fingerprint, to find all
+// executions of a statement in the logs.
+func fingerprintID(fingerprint string) string {
+	h := fnv.New64a()
+	h.Write([]byte(fingerprint))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// operation is the kind of statement, by its first word: select, insert...
+func operation(fingerprint string) string {
+	word, _, _ := strings.Cut(fingerprint, " ")
+	word = strings.ToLower(strings.TrimLeft(word, "("))
+	if word == "" {
+		return "other"
+	}
+	return word
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isWord(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || isDigit(ch)
+}
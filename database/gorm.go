@@ -0,0 +1,69 @@
+package database
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// OpenGorm opens the database of cfg through GORM: PostgreSQL for
+// postgres:// DSNs, MySQL for mysql:// ones and SQLite without a DSN. Its
+// queries are recorded by instrumentation, which may be nil.
+func OpenGorm(cfg config.DatabaseConfig, instrumentation *Instrumentation) (*gorm.DB, error) {
+	var driverName, dsn string
+	switch {
+	case cfg.DSN == "":
+		var err error
+		if dsn, err = sqliteDSN(cfg.SQLitePath); err != nil {
+			return nil, err
+		}
+		// The pure Go driver Open uses, rather than the cgo one GORM
+		// defaults to.
+		driverName = "sqlite"
+	case strings.HasPrefix(cfg.DSN, "postgres://"), strings.HasPrefix(cfg.DSN, "postgresql://"):
+		driverName, dsn = "pgx", cfg.DSN
+	case strings.HasPrefix(cfg.DSN, "mysql://"):
+		driverName, dsn = "mysql", strings.TrimPrefix(cfg.DSN, "mysql://")
+		// Times are scanned into time.Time only with parseTime.
+		if !strings.Contains(dsn, "parseTime=") {
+			if strings.Contains(dsn, "?") {
+				dsn += "&parseTime=true"
+			} else {
+				dsn += "?parseTime=true"
+			}
+		}
+	default:
+		return nil, errors.New("database: only postgres:// and mysql:// DSNs are supported")
+	}
+
+	pool, err := instrumentation.open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DSN == "" {
+		setSQLitePool(pool)
+	} else {
+		setPool(pool, cfg)
+	}
+	var dialector gorm.Dialector
+	switch driverName {
+	case "sqlite":
+		dialector = sqlite.Dialector{DriverName: driverName, Conn: pool}
+	case "pgx":
+		dialector = postgres.New(postgres.Config{Conn: pool})
+	default:
+		dialector = mysql.New(mysql.Config{Conn: pool})
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,349 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+)
+
+// Instrumentation records every query run through the pools opened with
+// it: duration, rows and errors by operation (select, insert...) in the
+// metrics, and each query at debug level in the log under the fingerprint
+// of its statement. Queries taking longer than slow are logged as a
+// warning, with the ID of the request they were run for. Arguments are
+// never logged.
+type Instrumentation struct {
+	logger *slog.Logger
+	slow   time.Duration
+	now    func() time.Time
+
+	duration    *metrics.HistogramVec
+	rows        *metrics.CounterVec
+	errors      *metrics.CounterVec
+	slowQueries *metrics.CounterVec
+}
+
+func NewInstrumentation(logger *slog.Logger, registry *metrics.Registry, slow time.Duration) *Instrumentation {
+	return &Instrumentation{
+		logger:      logger,
+		slow:        slow,
+		now:         time.Now,
+		duration:    registry.Histogram("db_query_duration_seconds", "Database query latency.", metrics.DefaultBuckets, "operation"),
+		rows:        registry.Counter("db_query_rows_total", "Rows returned or affected by database queries.", "operation"),
+		errors:      registry.Counter("db_query_errors_total", "Database queries that failed.", "operation"),
+		slowQueries: registry.Counter("db_slow_queries_total", "Database queries slower than the slow query threshold.", "operation"),
+	}
+}
+
+// open opens a pool of the registered driver whose queries are recorded.
+// Without instrumentation it is a plain sql.Open.
+func (in *Instrumentation) open(driverName, dsn string) (*sql.DB, error) {
+	if in == nil {
+		return sql.Open(driverName, dsn)
+	}
+	// Opening doesn't connect; it is only the way to the driver.
+	plain, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := plain.Driver()
+	plain.Close()
+
+	var inner driver.Connector = dsnConnector{dsn: dsn, driver: drv}
+	if dc, ok := drv.(driver.DriverContext); ok {
+		if inner, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+	return sql.OpenDB(&connector{Connector: inner, in: in}), nil
+}
+
+func (in *Instrumentation) record(ctx context.Context, query string, start time.Time, rows int64, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		// database/sql retries the query another way, which is recorded.
+		return
+	}
+	elapsed := in.now().Sub(start)
+	fingerprint := Fingerprint(query)
+	op := operation(fingerprint)
+	in.duration.With(op).Observe(elapsed.Seconds())
+	in.rows.With(op).Add(float64(rows))
+
+	attrs := []slog.Attr{
+		slog.String("fingerprint", fingerprintID(fingerprint)),
+		slog.String("statement", fingerprint),
+		slog.Duration("duration", elapsed),
+		slog.Int64("rows", rows),
+	}
+	if err != nil {
+		in.errors.With(op).Inc()
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	if in.slow > 0 && elapsed > in.slow {
+		in.slowQueries.With(op).Inc()
+		in.logger.LogAttrs(ctx, slog.LevelWarn, "slow query", attrs...)
+		return
+	}
+	in.logger.LogAttrs(ctx, slog.LevelDebug, "query", attrs...)
+}
+
+// dsnConnector connects drivers that don't make connectors themselves.
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type connector struct {
+	driver.Connector
+	in *Instrumentation
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	inner, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: inner, in: c.in}, nil
+}
+
+// Close closes the driver's connector, if it has anything to close.
+func (c *connector) Close() error {
+	if closer, ok := c.Connector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// conn records the queries of a connection. It passes on the optional
+// interfaces of the driver's connection, falling back to what database/sql
+// does for drivers without them.
+type conn struct {
+	driver.Conn
+	in *Instrumentation
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var inner driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		inner, err = p.PrepareContext(ctx, query)
+	} else {
+		inner, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: inner, conn: c, query: query}, nil
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := c.in.now()
+	result, err := e.ExecContext(ctx, query, args)
+	c.in.record(ctx, query, start, affected(result, err), err)
+	return result, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := c.in.now()
+	inner, err := q.QueryContext(ctx, query, args)
+	if err != nil {
+		c.in.record(ctx, query, start, 0, err)
+		return nil, err
+	}
+	return newRows(inner, func(n int64, err error) { c.in.record(ctx, query, start, n, err) }), nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type stmt struct {
+	driver.Stmt
+	conn  *conn
+	query string
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := s.conn.in.now()
+	var result driver.Result
+	var err error
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = e.ExecContext(ctx, args)
+	} else {
+		result, err = s.Stmt.Exec(values(args))
+	}
+	s.conn.in.record(ctx, s.query, start, affected(result, err), err)
+	return result, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := s.conn.in.now()
+	var inner driver.Rows
+	var err error
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		inner, err = q.QueryContext(ctx, args)
+	} else {
+		inner, err = s.Stmt.Query(values(args))
+	}
+	if err != nil {
+		s.conn.in.record(ctx, s.query, start, 0, err)
+		return nil, err
+	}
+	return newRows(inner, func(n int64, err error) { s.conn.in.record(ctx, s.query, start, n, err) }), nil
+}
+
+func (s *stmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return s.conn.CheckNamedValue(value)
+}
+
+func affected(result driver.Result, err error) int64 {
+	if err != nil || result == nil {
+		return 0
+	}
+	n, _ := result.RowsAffected()
+	return n
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	list := make([]driver.Value, len(args))
+	for i, arg := range args {
+		list[i] = arg.Value
+	}
+	return list
+}
+
+// rows counts the rows read, so a query is recorded once its rows are
+// closed: reading them is part of its duration.
+type rows struct {
+	driver.Rows
+	n      int64
+	err    error
+	once   sync.Once
+	finish func(n int64, err error)
+}
+
+func newRows(inner driver.Rows, finish func(n int64, err error)) *rows {
+	return &rows{Rows: inner, finish: finish}
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	switch {
+	case err == nil:
+		r.n++
+	case err != io.EOF:
+		r.err = err
+	}
+	return err
+}
+
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	r.once.Do(func() { r.finish(r.n, r.err) })
+	return err
+}
+
+func (r *rows) HasNextResultSet() bool {
+	next, ok := r.Rows.(driver.RowsNextResultSet)
+	return ok && next.HasNextResultSet()
+}
+
+func (r *rows) NextResultSet() error {
+	if next, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return next.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	if t, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return t.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(any)).Elem()
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	if t, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return t.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *rows) ColumnTypeLength(index int) (int64, bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return t.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *rows) ColumnTypeNullable(index int) (bool, bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return t.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *rows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return t.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
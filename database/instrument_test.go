@@ -0,0 +1,86 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/logging"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM orders WHERE id = $1":                        "SELECT * FROM orders WHERE id = ?",
+		"SELECT  *\n\tFROM orders WHERE id = 'o-1' LIMIT 20":        "SELECT * FROM orders WHERE id = ? LIMIT ?",
+		"SELECT * FROM t2 WHERE a IN (1, 2,3) AND b IN ($1,$2)":     "SELECT * FROM t2 WHERE a IN (?+) AND b IN (?+)",
+		"INSERT INTO notes (body) VALUES ('it''s'), (?)":            "INSERT INTO notes (body) VALUES (?), (?)",
+		"UPDATE orders SET total = 12.5 WHERE id = ? RETURNING id ": "UPDATE orders SET total = ? WHERE id = ? RETURNING id",
+	}
+	for query, want := range tests {
+		assert.Equal(t, want, Fingerprint(query), query)
+	}
+	assert.Equal(t, "select", operation(Fingerprint("select 1")))
+	assert.Equal(t, fingerprintID(Fingerprint("SELECT 1")), fingerprintID(Fingerprint("SELECT 2")))
+}
+
+func TestInstrumentation(t *testing.T) {
+	var logs bytes.Buffer
+	registry := metrics.NewRegistry()
+	instrumentation := NewInstrumentation(logging.New(&logs, slog.LevelDebug, nil), registry, 100*time.Millisecond)
+	// Each reading moves the clock 50ms: queries take 50ms, unless reading
+	// their rows reads it too.
+	now := time.Now()
+	instrumentation.now = func() time.Time {
+		now = now.Add(50 * time.Millisecond)
+		return now
+	}
+	db, err := Open(config.DatabaseConfig{SQLitePath: ":memory:"}, instrumentation)
+	assert.Nil(t, err)
+	defer db.Close()
+	ctx := correlation.With(context.Background(), correlation.Metadata{correlation.HeaderRequestID: "req-1"})
+
+	_, err = db.ExecContext(ctx, "CREATE TABLE notes (body TEXT NOT NULL)")
+	assert.Nil(t, err)
+	for _, body := range []string{"a", "b", "c"} {
+		_, err = db.ExecContext(ctx, "INSERT INTO notes (body) VALUES (?)", body)
+		assert.Nil(t, err)
+	}
+	rows, err := db.QueryContext(ctx, "SELECT body FROM notes WHERE body <> 'x'")
+	assert.Nil(t, err)
+	for rows.Next() {
+		// Reading the rows counts towards the duration.
+		instrumentation.now()
+		instrumentation.now()
+	}
+	assert.Nil(t, rows.Close())
+	_, err = db.ExecContext(ctx, "INSERT INTO missing (body) VALUES (?)", "d")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, 3.0, instrumentation.rows.With("insert").Value())
+	assert.Equal(t, 3.0, instrumentation.rows.With("select").Value())
+	assert.Equal(t, 1.0, instrumentation.errors.With("insert").Value())
+	assert.Equal(t, 1.0, instrumentation.slowQueries.Total())
+	assert.Equal(t, uint64(6), instrumentation.duration.Merged().Count)
+
+	var slow []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+		var entry map[string]any
+		assert.Nil(t, json.Unmarshal(line, &entry))
+		assert.Equal(t, "req-1", entry["request_id"])
+		assert.NotContains(t, string(line), `"a"`, "arguments are logged")
+		if entry["msg"] == "slow query" {
+			slow = append(slow, entry)
+		}
+	}
+	if assert.Len(t, slow, 1) {
+		assert.Equal(t, "SELECT body FROM notes WHERE body <> ?", slow[0]["statement"])
+		assert.Equal(t, 3.0, slow[0]["rows"])
+	}
+}
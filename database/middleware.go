@@ -0,0 +1,46 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+)
+
+// Middleware runs each request that may change data, anything but GET,
+// HEAD and OPTIONS, in a transaction of pool. The transaction is in
+// ctxutil.Tx and in c.UserContext(), where the repositories find it.
+// It is committed when the handler succeeds and rolled back when it
+// returns an error, answers with an error status or panics. While
+// breaker, which may be nil, is open no transaction is begun and the
+// request fails with an *UnavailableError.
+func Middleware(pool *sql.DB, breaker *Breaker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+
+		if err := breaker.Allow(); err != nil {
+			return err
+		}
+		tx, err := pool.BeginTx(c.UserContext(), nil)
+		breaker.Record(err)
+		if err != nil {
+			return err
+		}
+		ctx, t := withTx(c.UserContext(), tx)
+		c.SetUserContext(ctx)
+		ctxutil.SetTx(c, tx)
+		// Also on panics; committed transactions ignore it.
+		defer tx.Rollback()
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		if c.Response().StatusCode() >= fiber.StatusBadRequest {
+			return nil
+		}
+		return t.commit()
+	}
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	db, err := Open(config.DatabaseConfig{SQLitePath: ":memory:"}, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.Migrate(context.Background(), Migration{ID: "test-0001", Statements: []string{"CREATE TABLE notes (body TEXT NOT NULL)"}}))
+
+	committed := 0
+	app := fiber.New()
+	app.Use(recover.New(), Middleware(db.DB, nil))
+	app.All("/notes", func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		_, inTx := Tx(ctx)
+		assert.Equal(t, c.Method() != "GET", inTx)
+		assert.Equal(t, inTx, ctxutil.Tx(c) != nil)
+		if !inTx {
+			return nil
+		}
+		if _, err := db.Conn(ctx).ExecContext(ctx, "INSERT INTO notes (body) VALUES (?)", c.Query("body")); err != nil {
+			return err
+		}
+		AfterCommit(ctx, func() { committed++ })
+		switch c.Query("fail") {
+		case "error":
+			return errors.New("failed")
+		case "status":
+			return c.SendStatus(fiber.StatusConflict)
+		case "panic":
+			panic("boom")
+		}
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	do := func(method, query string) int {
+		response, err := app.Test(httptest.NewRequest(method, "/notes?"+query, nil))
+		assert.Nil(t, err)
+		return response.StatusCode
+	}
+	assert.Equal(t, 500, do("POST", "body=a&fail=error"))
+	assert.Equal(t, 409, do("POST", "body=b&fail=status"))
+	assert.Equal(t, 500, do("POST", "body=c&fail=panic"))
+	assert.Equal(t, 0, committed)
+	assert.Equal(t, 201, do("PUT", "body=d"))
+	assert.Equal(t, 200, do("GET", ""))
+	assert.Equal(t, 1, committed)
+
+	var bodies []string
+	rows, err := db.Query("SELECT body FROM notes")
+	assert.Nil(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var body string
+		rows.Scan(&body)
+		bodies = append(bodies, body)
+	}
+	assert.Equal(t, []string{"d"}, bodies)
+}
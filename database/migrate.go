@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Migration changes the schema. Statements are run in order in one
+// transaction and must work in both dialects. Once applied, a migration
+// is recorded under its ID and never run again, so it mustn't change
+// after release; later changes go in new migrations.
+type Migration struct {
+	ID         string
+	Statements []string
+}
+
+// Migrate applies the migrations not applied yet, in order.
+func (db *DB) Migrate(ctx context.Context, migrations ...Migration) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+	id VARCHAR(255) PRIMARY KEY,
+	applied_at TIMESTAMP NOT NULL
+)`)
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		err := db.InTx(ctx, func(ctx context.Context) error {
+			conn := db.Conn(ctx)
+			var applied int
+			err := conn.QueryRowContext(ctx, db.Rebind("SELECT COUNT(*) FROM schema_migrations WHERE id = ?"), migration.ID).Scan(&applied)
+			if err != nil || applied > 0 {
+				return err
+			}
+			for _, statement := range migration.Statements {
+				if _, err := conn.ExecContext(ctx, statement); err != nil {
+					return err
+				}
+			}
+			_, err = conn.ExecContext(ctx, db.Rebind("INSERT INTO schema_migrations (id, applied_at) VALUES (?, ?)"), migration.ID, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("database: migration %s: %w", migration.ID, err)
+		}
+	}
+	return nil
+}
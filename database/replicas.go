@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+)
+
+// replicas are read-only copies of the primary. A replica serves reads
+// only while its last check found it up and at most maxLag behind the
+// primary; until the first check it is left out.
+type replicas struct {
+	list     []*replica
+	next     atomic.Uint64
+	maxLag   time.Duration
+	interval time.Duration
+	// lag measures how far a replica is behind the primary.
+	lag func(ctx context.Context, db *sql.DB) (time.Duration, error)
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+func openReplicas(cfg config.DatabaseConfig, instrumentation *Instrumentation) (*replicas, error) {
+	r := &replicas{
+		maxLag:   cfg.MaxReplicaLag,
+		interval: cfg.ReplicaCheckInterval,
+		lag:      postgresLag,
+		stop:     make(chan struct{}),
+	}
+	for _, dsn := range cfg.Replicas {
+		db, err := instrumentation.open("pgx", dsn)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		setPool(db, cfg)
+		r.list = append(r.list, &replica{db: db})
+	}
+	r.start()
+	return r, nil
+}
+
+// Replicas returns the pools of the replicas.
+func (db *DB) Replicas() []*sql.DB {
+	if db.replicas == nil {
+		return nil
+	}
+	list := make([]*sql.DB, len(db.replicas.list))
+	for i, r := range db.replicas.list {
+		list[i] = r.db
+	}
+	return list
+}
+
+// postgresLag is the time since the last transaction the replica replayed,
+// or zero when it has replayed everything it received.
+func postgresLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var seconds float64
+	err := db.QueryRowContext(ctx, `SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`).Scan(&seconds)
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+func (r *replicas) start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			r.check()
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (r *replicas) check() {
+	for _, replica := range r.list {
+		ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+		lag, err := r.lag(ctx, replica.db)
+		cancel()
+		replica.healthy.Store(err == nil && lag <= r.maxLag)
+	}
+}
+
+func (r *replicas) close() {
+	close(r.stop)
+	r.wg.Wait()
+	for _, replica := range r.list {
+		replica.db.Close()
+	}
+}
+
+// pick returns the next healthy replica in turn, or nil if there is none.
+func (r *replicas) pick() *replica {
+	n := uint64(len(r.list))
+	start := r.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if replica := r.list[(start+i)%n]; replica.healthy.Load() {
+			return replica
+		}
+	}
+	return nil
+}
+
+// Reader returns where read-only queries go: the transaction ctx carries,
+// a replica that is up to date enough, or else the primary. Reads from a
+// replica that fails are retried on the primary and take the replica out
+// until its next check finds it up again. Replicas may lag behind by up to
+// the configured maximum, so reads that must see a change just made
+// belong in the change's transaction.
+func (db *DB) Reader(ctx context.Context) Querier {
+	if tx, ok := Tx(ctx); ok {
+		return tx
+	}
+	if db.replicas != nil {
+		if replica := db.replicas.pick(); replica != nil {
+			return replicaReader{replica: replica, primary: db.DB}
+		}
+	}
+	return db.DB
+}
+
+type replicaReader struct {
+	replica *replica
+	primary *sql.DB
+}
+
+// ExecContext runs on the primary: replicas can't write.
+func (r replicaReader) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return r.primary.ExecContext(ctx, query, args...)
+}
+
+func (r replicaReader) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := r.replica.db.QueryContext(ctx, query, args...)
+	if r.failed(ctx, err) {
+		return r.primary.QueryContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+func (r replicaReader) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	row := r.replica.db.QueryRowContext(ctx, query, args...)
+	if r.failed(ctx, row.Err()) {
+		return r.primary.QueryRowContext(ctx, query, args...)
+	}
+	return row
+}
+
+// failed reports whether the replica failed a query, rather than the
+// caller giving up on it.
+func (r replicaReader) failed(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	r.replica.healthy.Store(false)
+	return true
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicas(t *testing.T) {
+	ctx := context.Background()
+	open := func(name string) *DB {
+		db, err := Open(config.DatabaseConfig{SQLitePath: ":memory:"}, nil)
+		assert.Nil(t, err)
+		db.Exec("CREATE TABLE names (name TEXT)")
+		db.Exec("INSERT INTO names (name) VALUES (?)", name)
+		return db
+	}
+	primary := open("primary")
+	first, second := open("first"), open("second")
+	lags := map[*sql.DB]time.Duration{first.DB: 0, second.DB: 0}
+	primary.replicas = &replicas{
+		list:     []*replica{{db: first.DB}, {db: second.DB}},
+		maxLag:   time.Second,
+		interval: time.Second,
+		lag: func(ctx context.Context, db *sql.DB) (time.Duration, error) {
+			if err := db.PingContext(ctx); err != nil {
+				return 0, err
+			}
+			return lags[db], nil
+		},
+		stop: make(chan struct{}),
+	}
+	defer primary.Close()
+
+	read := func(ctx context.Context) string {
+		var name string
+		assert.Nil(t, primary.Reader(ctx).QueryRowContext(ctx, "SELECT name FROM names").Scan(&name))
+		return name
+	}
+
+	assert.Equal(t, "primary", read(ctx), "replicas are used once checked")
+	primary.replicas.check()
+	assert.ElementsMatch(t, []string{"first", "second"}, []string{read(ctx), read(ctx)})
+
+	lags[first.DB] = time.Minute
+	primary.replicas.check()
+	assert.Equal(t, "second", read(ctx))
+	assert.Equal(t, "second", read(ctx))
+
+	// A replica failing a read is taken out and the read goes to the
+	// primary.
+	second.DB.Close()
+	assert.Equal(t, "primary", read(ctx))
+	assert.False(t, primary.replicas.list[1].healthy.Load())
+	primary.replicas.check()
+	assert.Equal(t, "primary", read(ctx))
+
+	// Transactions read what they wrote.
+	lags[first.DB] = 0
+	primary.replicas.check()
+	err := primary.InTx(ctx, func(ctx context.Context) error {
+		assert.Equal(t, "primary", read(ctx))
+		return errors.New("rollback")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, "first", read(ctx))
+}
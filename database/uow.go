@@ -0,0 +1,27 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// UnitOfWork makes the changes of several repositories atomic. Do runs fn
+// in a transaction that fn passes on in its context; the repositories take
+// it from there, so no *sql.Tx shows up in the signatures of services or
+// handlers. Do inside Do joins the outer unit.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// TxUnitOfWork is a UnitOfWork of the transactions of a connection pool.
+type TxUnitOfWork struct {
+	pool *sql.DB
+}
+
+func NewUnitOfWork(pool *sql.DB) *TxUnitOfWork {
+	return &TxUnitOfWork{pool: pool}
+}
+
+func (u *TxUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return InTx(ctx, u.pool, fn)
+}
@@ -0,0 +1,127 @@
+// Package deprecation warns clients about the deprecated fields of
+// request and response bodies, so they can migrate before a field is
+// removed. Fields are marked with a tag saying what to use instead:
+//
+//	Phone string `json:"phone" deprecated:"set the phone with POST /me/phone"`
+//
+// Handlers pass bodies to Request after parsing them and to Response
+// before sending them. Each deprecated field that is set adds a Warning
+// header (RFC 7234, code 299) and is counted; request fields are logged
+// too, with the user, to find the clients still sending them.
+package deprecation
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+)
+
+var localsKey = ctxutil.NewKey[*Deprecations]("deprecation")
+
+// Deprecations logs and counts the deprecated fields of the requests it
+// is the middleware of.
+type Deprecations struct {
+	logger *slog.Logger
+	used   *metrics.CounterVec
+}
+
+func New(logger *slog.Logger, registry *metrics.Registry) *Deprecations {
+	return &Deprecations{
+		logger: logger,
+		used:   registry.Counter("http_deprecated_fields_total", "Deprecated fields in request and response bodies, by body: request or response.", "route", "field", "body"),
+	}
+}
+
+// Middleware makes Request and Response log and count for d. Without it
+// they only add the Warning header.
+func (d *Deprecations) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		localsKey.Set(c, d)
+		return c.Next()
+	}
+}
+
+// Request warns about the deprecated fields set in the struct v points
+// to, a request body.
+func Request(c *fiber.Ctx, v interface{}) {
+	warn(c, v, "request")
+}
+
+// Response warns about the deprecated fields set in the struct v points
+// to, a response body.
+func Response(c *fiber.Ctx, v interface{}) {
+	warn(c, v, "response")
+}
+
+func warn(c *fiber.Ctx, v interface{}, body string) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return
+	}
+	d, _ := localsKey.Get(c)
+	for _, field := range deprecated(value.Elem(), "") {
+		c.Append(fiber.HeaderWarning, fmt.Sprintf("299 - %q", field.name+" is deprecated: "+field.replacement))
+		if d == nil {
+			continue
+		}
+		d.used.With(c.Route().Path, field.name, body).Inc()
+		if body == "request" {
+			d.logger.InfoContext(c.UserContext(), "deprecated field used",
+				slog.String("field", field.name),
+				slog.String("route", c.Route().Path),
+				slog.String("user_id", ctxutil.CurrentUser(c)),
+				slog.String("user_agent", c.Get(fiber.HeaderUserAgent)))
+		}
+	}
+}
+
+type field struct {
+	name        string
+	replacement string
+}
+
+// deprecated returns the tagged fields of value that are set, by their
+// JSON names, descending into nested structs.
+func deprecated(value reflect.Value, prefix string) []field {
+	var fields []field
+	for i := 0; i < value.NumField(); i++ {
+		f, nested := value.Type().Field(i), value.Field(i)
+		// Embedded structs have their fields promoted, like JSON does.
+		if f.Anonymous && nested.Kind() == reflect.Struct {
+			fields = append(fields, deprecated(nested, prefix)...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name := prefix + jsonName(f)
+		if replacement, ok := f.Tag.Lookup("deprecated"); ok {
+			if !nested.IsZero() {
+				fields = append(fields, field{name: name, replacement: replacement})
+			}
+			continue
+		}
+		switch nested.Kind() {
+		case reflect.Struct:
+			fields = append(fields, deprecated(nested, name+".")...)
+		case reflect.Pointer:
+			if !nested.IsNil() && nested.Elem().Kind() == reflect.Struct {
+				fields = append(fields, deprecated(nested.Elem(), name+".")...)
+			}
+		}
+	}
+	return fields
+}
+
+// jsonName is the name a field has in JSON.
+func jsonName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
@@ -0,0 +1,80 @@
+package deprecation
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type Address struct {
+	City    string `json:"city"`
+	ZipCode string `json:"zip_code" deprecated:"use postal_code"`
+}
+
+type Base struct {
+	Name string `json:"name"`
+	Nick string `json:"nick" deprecated:"use name"`
+}
+
+type body struct {
+	Base
+	Address  Address  `json:"address"`
+	Billing  *Address `json:"billing"`
+	Currency string   `json:"currency,omitempty" deprecated:"prices are in IDR"`
+	secret   string   `deprecated:"never reported"`
+}
+
+func TestRequest(t *testing.T) {
+	var logs bytes.Buffer
+	registry := metrics.NewRegistry()
+	app := fiber.New()
+	app.Use(New(slog.New(slog.NewTextHandler(&logs, nil)), registry).Middleware())
+	app.Post("/users/:id", func(c *fiber.Ctx) error {
+		var b body
+		if err := c.BodyParser(&b); err != nil {
+			return err
+		}
+		b.secret = "set"
+		Request(c, &b)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	request := httptest.NewRequest("POST", "/users/1", strings.NewReader(
+		`{"name":"Alice","nick":"al","address":{"zip_code":"12345"},"billing":{"city":"Jakarta"}}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "shop-android/1.2")
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 204, response.StatusCode)
+	assert.Equal(t, `299 - "nick is deprecated: use name", 299 - "address.zip_code is deprecated: use postal_code"`, response.Header.Get("Warning"))
+	assert.Equal(t, float64(1), registry.Counter("http_deprecated_fields_total", "", "route", "field", "body").With("/users/:id", "address.zip_code", "request").Value())
+	assert.Contains(t, logs.String(), `msg="deprecated field used" field=nick route=/users/:id user_id="" user_agent=shop-android/1.2`)
+
+	// Bodies without deprecated fields set are left alone.
+	request = httptest.NewRequest("POST", "/users/1", strings.NewReader(`{"name":"Alice","address":{"city":"Jakarta"}}`))
+	request.Header.Set("Content-Type", "application/json")
+	response, err = app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, "", response.Header.Get("Warning"))
+}
+
+func TestResponse(t *testing.T) {
+	app := fiber.New()
+	app.Get("/prices", func(c *fiber.Ctx) error {
+		b := body{Currency: "IDR"}
+		Response(c, &b)
+		Response(c, "not a struct")
+		return c.JSON(b)
+	})
+
+	response, err := app.Test(httptest.NewRequest("GET", "/prices", nil))
+	assert.Nil(t, err)
+	// Without the middleware there is only the header.
+	assert.Equal(t, `299 - "currency is deprecated: prices are in IDR"`, response.Header.Get("Warning"))
+}
@@ -0,0 +1,260 @@
+// Package erasure deletes the accounts of users who ask for it, after a
+// grace period in which they can change their mind. Erasing runs, from a
+// job, the steps the parts of the application add, each deleting what it
+// keeps about the user or, where records have to stay, such as orders,
+// handing them over to a pseudonym.
+package erasure
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/audit"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/jobs"
+	"github.com/jalal-akbar/belajar-golang-fiber/sequence"
+)
+
+// JobErase is the type of the jobs erasing accounts once their grace
+// period is over.
+const JobErase = "account.erase"
+
+// Step deletes or anonymizes what a part of the application keeps about
+// userID, replacing the ID with pseudonym where it has to keep a record.
+// An error has all steps run again later, so steps must not mind running
+// twice.
+type Step func(ctx context.Context, userID, pseudonym string) error
+
+// Deletion is a scheduled erasure of an account.
+type Deletion struct {
+	RequestedAt time.Time `json:"requested_at"`
+	EraseAt     time.Time `json:"erase_at"`
+
+	pseudonym string
+}
+
+type step struct {
+	name string
+	run  Step
+}
+
+// Migrations create the table of the scheduled deletions.
+var Migrations = []database.Migration{{
+	ID: "erasure-0001",
+	Statements: []string{
+		`CREATE TABLE erasures (
+	user_id VARCHAR(255) PRIMARY KEY,
+	pseudonym VARCHAR(64) NOT NULL,
+	requested_at TIMESTAMP NOT NULL,
+	erase_at TIMESTAMP NOT NULL
+)`,
+	},
+}}
+
+// Erasures keeps the scheduled deletions in the database, in the table
+// Migrations create, so they outlive restarts. The jobs erasing them
+// don't, and Resume queues them again.
+type Erasures struct {
+	cfg    config.ErasureConfig
+	db     *database.DB
+	queue  *jobs.Queue
+	audit  *audit.Log
+	logger *slog.Logger
+	now    func() time.Time
+	names  sequence.IDGenerator
+	steps  []step
+
+	// mu keeps Schedule from scheduling an account twice.
+	mu sync.Mutex
+}
+
+// New has queue erase the accounts and records what happens to them in
+// auditLog.
+func New(cfg config.ErasureConfig, db *database.DB, queue *jobs.Queue, auditLog *audit.Log, logger *slog.Logger) *Erasures {
+	e := &Erasures{
+		cfg:    cfg,
+		db:     db,
+		queue:  queue,
+		audit:  auditLog,
+		logger: logger,
+		now:    clock.System.Now,
+		names:  sequence.Random(8),
+	}
+	queue.Handle(JobErase, e.erase)
+	return e
+}
+
+// Add has erasing run step, after those added before it. Add steps
+// before the server starts.
+func (e *Erasures) Add(name string, run Step) {
+	e.steps = append(e.steps, step{name: name, run: run})
+}
+
+// Register adds DELETE /me, which schedules the erasure of the
+// authenticated user's account, and GET and DELETE /me/deletion to see
+// and cancel it.
+func (e *Erasures) Register(router fiber.Router) {
+	router.Delete("/me", e.scheduleHandler)
+	router.Get("/me/deletion", e.getHandler)
+	router.Delete("/me/deletion", e.cancelHandler)
+}
+
+// Schedule schedules the erasure of the account of userID once the grace
+// period is over. An erasure already scheduled is kept as it is.
+func (e *Erasures) Schedule(ctx context.Context, userID string) (Deletion, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	deletion, ok, err := e.Get(ctx, userID)
+	if err != nil || ok {
+		return deletion, err
+	}
+	name, err := e.names.NewID()
+	if err != nil {
+		return Deletion{}, fmt.Errorf("erasure: %w", err)
+	}
+	now := e.now().UTC()
+	deletion = Deletion{RequestedAt: now, EraseAt: now.Add(e.cfg.Grace), pseudonym: "deleted-" + name}
+	_, err = e.db.Conn(ctx).ExecContext(ctx, e.db.Rebind(`INSERT INTO erasures (user_id, pseudonym, requested_at, erase_at) VALUES (?, ?, ?, ?)`),
+		userID, deletion.pseudonym, deletion.RequestedAt, deletion.EraseAt)
+	if errors.Is(database.Conflict(err), database.ErrConflict) {
+		// Scheduled by another instance meanwhile, which queued the job.
+		deletion, _, err = e.Get(ctx, userID)
+		return deletion, err
+	}
+	if err != nil {
+		return Deletion{}, err
+	}
+	if err := e.enqueue(ctx, userID, deletion); err != nil {
+		e.Cancel(ctx, userID)
+		return Deletion{}, err
+	}
+	return deletion, nil
+}
+
+func (e *Erasures) enqueue(ctx context.Context, userID string, deletion Deletion) error {
+	return e.queue.EnqueueAt(ctx, JobErase, map[string]string{"user": userID}, deletion.EraseAt)
+}
+
+// Resume queues the jobs of the erasures scheduled before a restart, the
+// overdue ones to run right away.
+func (e *Erasures) Resume(ctx context.Context) error {
+	rows, err := e.db.Conn(ctx).QueryContext(ctx, `SELECT user_id, requested_at, erase_at, pseudonym FROM erasures`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	scheduled := map[string]Deletion{}
+	for rows.Next() {
+		var userID string
+		deletion, err := scanDeletion(rows, &userID)
+		if err != nil {
+			return err
+		}
+		scheduled[userID] = deletion
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for userID, deletion := range scheduled {
+		if err := e.enqueue(ctx, userID, deletion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cancel cancels the erasure of the account of userID and reports whether
+// there was one.
+func (e *Erasures) Cancel(ctx context.Context, userID string) (bool, error) {
+	result, err := e.db.Conn(ctx).ExecContext(ctx, e.db.Rebind(`DELETE FROM erasures WHERE user_id = ?`), userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// Get returns the erasure scheduled for the account of userID.
+func (e *Erasures) Get(ctx context.Context, userID string) (Deletion, bool, error) {
+	row := e.db.Conn(ctx).QueryRowContext(ctx, e.db.Rebind(`SELECT user_id, requested_at, erase_at, pseudonym FROM erasures WHERE user_id = ?`), userID)
+	deletion, err := scanDeletion(row, new(string))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Deletion{}, false, nil
+	}
+	return deletion, err == nil, err
+}
+
+func scanDeletion(row interface{ Scan(...any) error }, userID *string) (Deletion, error) {
+	var deletion Deletion
+	if err := row.Scan(userID, &deletion.RequestedAt, &deletion.EraseAt, &deletion.pseudonym); err != nil {
+		return Deletion{}, err
+	}
+	deletion.RequestedAt, deletion.EraseAt = deletion.RequestedAt.UTC(), deletion.EraseAt.UTC()
+	return deletion, nil
+}
+
+// erase runs the steps for an account whose erasure is due. Jobs of
+// erasures that were cancelled, or cancelled and scheduled again for
+// later, do nothing.
+func (e *Erasures) erase(ctx context.Context, job jobs.Job) error {
+	userID := job.Payload["user"]
+	deletion, ok, err := e.Get(ctx, userID)
+	if err != nil || !ok || e.now().Before(deletion.EraseAt) {
+		return err
+	}
+	for _, step := range e.steps {
+		if err := step.run(ctx, userID, deletion.pseudonym); err != nil {
+			return fmt.Errorf("erasure: %s: %w", step.name, err)
+		}
+	}
+	if _, err := e.Cancel(ctx, userID); err != nil {
+		return err
+	}
+	e.audit.Add(ctx, audit.Entry{Actor: "system", Action: "account.erased", Target: deletion.pseudonym})
+	e.logger.InfoContext(ctx, "account erased", slog.String("pseudonym", deletion.pseudonym))
+	return nil
+}
+
+func (e *Erasures) scheduleHandler(c *fiber.Ctx) error {
+	userID := utils.CopyString(ctxutil.CurrentUser(c))
+	deletion, err := e.Schedule(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+	e.audit.Record(c, "account.deletion.schedule", userID, map[string]string{"erase_at": deletion.EraseAt.Format(time.RFC3339)})
+	return c.Status(fiber.StatusAccepted).JSON(deletion)
+}
+
+func (e *Erasures) getHandler(c *fiber.Ctx) error {
+	deletion, ok, err := e.Get(c.UserContext(), ctxutil.CurrentUser(c))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	return c.JSON(deletion)
+}
+
+func (e *Erasures) cancelHandler(c *fiber.Ctx) error {
+	userID := ctxutil.CurrentUser(c)
+	ok, err := e.Cancel(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	e.audit.Record(c, "account.deletion.cancel", userID, nil)
+	return c.SendStatus(fiber.StatusNoContent)
+}
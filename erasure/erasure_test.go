@@ -0,0 +1,170 @@
+package erasure
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/audit"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/jobs"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func newQueue() *jobs.Queue {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return jobs.New(config.JobsConfig{Workers: 1, MaxAttempts: 3, Backoff: 10 * time.Millisecond, Timeout: time.Second}, logger, metrics.NewRegistry())
+}
+
+func newApp(t *testing.T, grace time.Duration) (*fiber.App, *Erasures, *audit.Log) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queue := newQueue()
+	auditLog := audit.New(logger, 100)
+	erasures := New(config.ErasureConfig{Grace: grace}, testkit.OpenDB(t, Migrations...), queue, auditLog, logger)
+	queue.Start()
+	t.Cleanup(queue.Stop)
+	app := fiber.New()
+	app.Use(testkit.FakeAuth)
+	erasures.Register(app)
+	return app, erasures, auditLog
+}
+
+// erased records the steps run, as step:user:pseudonym.
+type erased struct {
+	mu  sync.Mutex
+	ran []string
+}
+
+func (e *erased) step(name string) Step {
+	return func(_ context.Context, userID, pseudonym string) error {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.ran = append(e.ran, name+":"+userID+":"+pseudonym)
+		return nil
+	}
+}
+
+func (e *erased) steps() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.ran...)
+}
+
+func TestScheduleAndCancel(t *testing.T) {
+	app, erasures, auditLog := newApp(t, 50*time.Millisecond)
+	var log erased
+	erasures.Add("profile", log.step("profile"))
+	alice := testkit.WithUser("alice")
+
+	var deletion Deletion
+	testkit.Do(t, app, "DELETE", "/me", nil, alice).AssertStatus(202).JSON(&deletion)
+	assert.Equal(t, 50*time.Millisecond, deletion.EraseAt.Sub(deletion.RequestedAt))
+	var again Deletion
+	testkit.Do(t, app, "DELETE", "/me", nil, alice).AssertStatus(202).JSON(&again)
+	assert.Equal(t, deletion.EraseAt, again.EraseAt)
+	testkit.Do(t, app, "GET", "/me/deletion", nil, alice).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/me/deletion", nil, testkit.WithUser("bob")).AssertStatus(404)
+
+	testkit.Do(t, app, "DELETE", "/me/deletion", nil, alice).AssertStatus(204)
+	testkit.Do(t, app, "DELETE", "/me/deletion", nil, alice).AssertStatus(404)
+	testkit.Do(t, app, "GET", "/me/deletion", nil, alice).AssertStatus(404)
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, log.steps())
+
+	var actions []string
+	for _, entry := range auditLog.ListFor("alice") {
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []string{"account.deletion.cancel", "account.deletion.schedule", "account.deletion.schedule"}, actions)
+}
+
+func TestErase(t *testing.T) {
+	app, erasures, auditLog := newApp(t, 0)
+	var log erased
+	failures := 1
+	erasures.Add("files", log.step("files"))
+	erasures.Add("orders", func(ctx context.Context, userID, pseudonym string) error {
+		if failures > 0 {
+			failures--
+			return errors.New("database is down")
+		}
+		return log.step("orders")(ctx, userID, pseudonym)
+	})
+	erasures.Add("audit", func(_ context.Context, userID, pseudonym string) error {
+		auditLog.Anonymize(userID, pseudonym)
+		return nil
+	})
+
+	testkit.Do(t, app, "DELETE", "/me", nil, testkit.WithUser("alice")).AssertStatus(202)
+	assert.Eventually(t, func() bool {
+		_, scheduled, err := erasures.Get(context.Background(), "alice")
+		return err == nil && !scheduled
+	}, time.Second, 5*time.Millisecond)
+
+	// The steps ran again after the failure, with the same pseudonym.
+	ran := log.steps()
+	if assert.Len(t, ran, 3) {
+		pseudonym := ran[0][len("files:alice:"):]
+		assert.Regexp(t, `^deleted-[0-9a-f]{16}$`, pseudonym)
+		assert.Equal(t, []string{"files:alice:" + pseudonym, "files:alice:" + pseudonym, "orders:alice:" + pseudonym}, ran)
+
+		assert.Empty(t, auditLog.ListFor("alice"))
+		entries := auditLog.ListFor(pseudonym)
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, "account.erased", entries[0].Action)
+			assert.Equal(t, "account.deletion.schedule", entries[1].Action)
+			assert.Empty(t, entries[1].IP)
+		}
+	}
+}
+
+func TestResumeAfterRestart(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	auditLog := audit.New(logger, 100)
+	db := testkit.OpenDB(t, Migrations...)
+	// Scheduled, but the server stops before the job runs.
+	before := New(config.ErasureConfig{Grace: 50 * time.Millisecond}, db, newQueue(), auditLog, logger)
+	deletion, err := before.Schedule(context.Background(), "alice")
+	assert.Nil(t, err)
+
+	queue := newQueue()
+	erasures := New(config.ErasureConfig{}, db, queue, auditLog, logger)
+	var log erased
+	erasures.Add("profile", log.step("profile"))
+	kept, ok, err := erasures.Get(context.Background(), "alice")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, deletion.EraseAt.Equal(kept.EraseAt))
+	assert.Nil(t, erasures.Resume(context.Background()))
+	queue.Start()
+	t.Cleanup(queue.Stop)
+
+	assert.Eventually(t, func() bool { return len(log.steps()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "profile:alice:"+deletion.pseudonym, log.steps()[0])
+}
+
+func TestScheduleConcurrently(t *testing.T) {
+	_, erasures, _ := newApp(t, time.Hour)
+	deletions := make([]Deletion, 10)
+	var wg sync.WaitGroup
+	for i := range deletions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			deletion, err := erasures.Schedule(context.Background(), "alice")
+			assert.Nil(t, err)
+			deletions[i] = deletion
+		}(i)
+	}
+	wg.Wait()
+	for _, deletion := range deletions {
+		assert.Equal(t, deletions[0].pseudonym, deletion.pseudonym)
+	}
+}
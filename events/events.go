@@ -0,0 +1,57 @@
+// Package events passes domain events, like an order being created, from
+// the code that causes them to the subsystems reacting to them.
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+)
+
+// Event is something that happened to Subject (an order id, ...) that
+// concerns the user UserID.
+type Event struct {
+	Type    string            `json:"type"`
+	UserID  string            `json:"user_id"`
+	Subject string            `json:"subject,omitempty"`
+	Data    map[string]string `json:"data,omitempty"`
+	Time    time.Time         `json:"time"`
+}
+
+type Handler func(ctx context.Context, event Event)
+
+// Bus calls the handlers subscribed to an event's type synchronously, in
+// the order they subscribed. Handlers doing slow work, like sending mail,
+// start it in the background themselves.
+type Bus struct {
+	now func() time.Time
+
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{now: clock.System.Now, handlers: map[string][]Handler{}}
+}
+
+// Subscribe calls handler for every event of the given type, or of every
+// type for "*".
+func (b *Bus) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = b.now()
+	}
+	b.mu.RLock()
+	handlers := append(append([]Handler{}, b.handlers[event.Type]...), b.handlers["*"]...)
+	b.mu.RUnlock()
+	for _, handler := range handlers {
+		handler(ctx, event)
+	}
+}
@@ -0,0 +1,310 @@
+// Package export gathers all the data kept about a user into an archive
+// they can download, as data protection laws let them ask for. Archives
+// are built by a job and downloaded through a signed link, which works
+// without the user's token, so it can be opened in a browser.
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/jobs"
+	"github.com/jalal-akbar/belajar-golang-fiber/sequence"
+	"github.com/jalal-akbar/belajar-golang-fiber/upload"
+)
+
+const (
+	// Prefix is where in the storage the archives are kept.
+	Prefix = "exports"
+	// JobBuild is the type of the jobs building archives.
+	JobBuild = "export.build"
+)
+
+// Statuses of exports.
+const (
+	Pending = "pending"
+	Ready   = "ready"
+	Failed  = "failed"
+)
+
+// Source returns the data of a user a part of the application keeps,
+// which is put into the archive as JSON.
+type Source func(ctx context.Context, userID string) (any, error)
+
+// Export is an export a user asked for. DownloadURL is a signed link to
+// its archive once it is ready, valid until LinkExpiresAt.
+type Export struct {
+	ID            string     `json:"id"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	DownloadURL   string     `json:"download_url,omitempty"`
+	LinkExpiresAt *time.Time `json:"link_expires_at,omitempty"`
+
+	userID string
+}
+
+type source struct {
+	name  string
+	fetch Source
+}
+
+// Exports keeps the exports in memory, keyed by ID, and their archives in
+// storage, which must not be served to the public.
+type Exports struct {
+	cfg     config.ExportConfig
+	storage upload.Storage
+	queue   *jobs.Queue
+	logger  *slog.Logger
+	now     func() time.Time
+	ids     sequence.IDGenerator
+	sources []source
+
+	mu      sync.Mutex
+	exports map[string]Export
+}
+
+// New has queue build the archives.
+func New(cfg config.ExportConfig, storage upload.Storage, queue *jobs.Queue, logger *slog.Logger) *Exports {
+	e := &Exports{
+		cfg:     cfg,
+		storage: storage,
+		queue:   queue,
+		logger:  logger,
+		now:     clock.System.Now,
+		ids:     sequence.Random(16),
+		exports: map[string]Export{},
+	}
+	queue.Handle(JobBuild, e.build)
+	return e
+}
+
+// Add puts the data of source into archives as name.json. Add sources
+// before the server starts.
+func (e *Exports) Add(name string, fetch Source) {
+	e.sources = append(e.sources, source{name: name, fetch: fetch})
+}
+
+func (e *Exports) Storage() upload.Storage {
+	return e.storage
+}
+
+// Register adds POST /me/export and GET /me/export/:id to poll it for
+// the authenticated user on router, and the download of archives on
+// public, at GET /exports/:id.
+func (e *Exports) Register(router, public fiber.Router) {
+	router.Post("/me/export", e.requestHandler)
+	router.Get("/me/export/:id", e.statusHandler)
+	public.Get("/exports/:id", e.downloadHandler)
+}
+
+// Request starts an export of the data of userID. While one is pending,
+// that one is returned instead.
+func (e *Exports) Request(ctx context.Context, userID string) (Export, error) {
+	e.mu.Lock()
+	for _, export := range e.exports {
+		if export.userID == userID && export.Status == Pending {
+			e.mu.Unlock()
+			return export, nil
+		}
+	}
+	e.mu.Unlock()
+
+	id, err := e.ids.NewID()
+	if err != nil {
+		return Export{}, fmt.Errorf("export: %w", err)
+	}
+	export := Export{ID: id, Status: Pending, CreatedAt: e.now(), userID: userID}
+	e.mu.Lock()
+	e.exports[id] = export
+	e.mu.Unlock()
+	if err := e.queue.Enqueue(ctx, JobBuild, map[string]string{"id": id}); err != nil {
+		e.mu.Lock()
+		delete(e.exports, id)
+		e.mu.Unlock()
+		return Export{}, err
+	}
+	return export, nil
+}
+
+// Get returns the export id of userID, with a fresh download link if it
+// is ready. Exports are gone once their archive expired.
+func (e *Exports) Get(userID, id string) (Export, bool) {
+	e.mu.Lock()
+	export, ok := e.exports[id]
+	e.mu.Unlock()
+	if !ok || export.userID != userID || e.expired(export) {
+		return Export{}, false
+	}
+	if export.Status == Ready {
+		expires := e.now().Add(e.cfg.LinkTTL).Truncate(time.Second)
+		export.DownloadURL = fmt.Sprintf("/exports/%s?expires=%d&signature=%s", id, expires.Unix(), e.sign(id, expires.Unix()))
+		export.LinkExpiresAt = &expires
+	}
+	return export, true
+}
+
+// Forget drops the exports of userID, whose account is erased. Their
+// archives are left to the upload GC.
+func (e *Exports) Forget(userID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id, export := range e.exports {
+		if export.userID == userID {
+			delete(e.exports, id)
+		}
+	}
+}
+
+// Live reports whether key is the archive of an export that hasn't
+// expired, for the upload GC.
+func (e *Exports) Live(key string) bool {
+	id := strings.TrimSuffix(strings.TrimPrefix(key, Prefix+"/"), ".zip")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	export, ok := e.exports[id]
+	if ok && e.expired(export) {
+		delete(e.exports, id)
+		return false
+	}
+	return ok && key == archiveKey(id)
+}
+
+func (e *Exports) expired(export Export) bool {
+	return export.CompletedAt != nil && e.now().Sub(*export.CompletedAt) >= e.cfg.Retention
+}
+
+// build gathers the data of all sources into an archive. An export that
+// fails is marked failed rather than tried again, as the user can simply
+// ask again.
+func (e *Exports) build(ctx context.Context, job jobs.Job) error {
+	id := job.Payload["id"]
+	e.mu.Lock()
+	export, ok := e.exports[id]
+	e.mu.Unlock()
+	if !ok || export.Status != Pending {
+		return nil
+	}
+	status := Ready
+	if err := e.archive(ctx, export); err != nil {
+		e.logger.ErrorContext(ctx, "building export failed", slog.String("export", id), slog.String("error", err.Error()))
+		status = Failed
+	}
+	completed := e.now()
+	e.mu.Lock()
+	export.Status = status
+	export.CompletedAt = &completed
+	e.exports[id] = export
+	e.mu.Unlock()
+	return nil
+}
+
+// archive writes a ZIP of one JSON file per source, and export.json
+// saying what it holds, to the storage.
+func (e *Exports) archive(ctx context.Context, export Export) error {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	manifest := struct {
+		UserID    string    `json:"user_id"`
+		CreatedAt time.Time `json:"created_at"`
+		Files     []string  `json:"files"`
+	}{UserID: export.userID, CreatedAt: e.now()}
+	for _, source := range e.sources {
+		data, err := source.fetch(ctx, export.userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source.name, err)
+		}
+		name := source.name + ".json"
+		if err := writeJSON(archive, name, data); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+	if err := writeJSON(archive, "export.json", manifest); err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return e.storage.Put(ctx, archiveKey(export.ID), &buf)
+}
+
+func writeJSON(archive *zip.Writer, name string, v any) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func archiveKey(id string) string {
+	return Prefix + "/" + id + ".zip"
+}
+
+// sign returns the signature of the link to the archive id that expires
+// at the Unix time expires.
+func (e *Exports) sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(e.cfg.Secret))
+	fmt.Fprintf(mac, "%s.%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (e *Exports) requestHandler(c *fiber.Ctx) error {
+	export, err := e.Request(c.UserContext(), utils.CopyString(ctxutil.CurrentUser(c)))
+	if err != nil {
+		return err
+	}
+	c.Location("/api/me/export/" + export.ID)
+	return c.Status(fiber.StatusAccepted).JSON(export)
+}
+
+func (e *Exports) statusHandler(c *fiber.Ctx) error {
+	export, ok := e.Get(ctxutil.CurrentUser(c), c.Params("id"))
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	return c.JSON(export)
+}
+
+// downloadHandler sends an archive to whoever has a link to it that is
+// signed and hasn't expired.
+func (e *Exports) downloadHandler(c *fiber.Ctx) error {
+	id := c.Params("id")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || e.now().Unix() >= expires ||
+		!hmac.Equal([]byte(c.Query("signature")), []byte(e.sign(id, expires))) {
+		return fiber.NewError(fiber.StatusForbidden, "invalid or expired link")
+	}
+	e.mu.Lock()
+	export, ok := e.exports[id]
+	e.mu.Unlock()
+	if !ok || export.Status != Ready || e.expired(export) {
+		return fiber.ErrNotFound
+	}
+	src, err := e.storage.Open(c.UserContext(), archiveKey(export.ID))
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="export-`+export.ID+`.zip"`)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.SendStream(src)
+}
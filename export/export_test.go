@@ -0,0 +1,112 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/jobs"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/jalal-akbar/belajar-golang-fiber/upload"
+	"github.com/stretchr/testify/assert"
+)
+
+func newApp(t *testing.T) (*fiber.App, *Exports) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queue := jobs.New(config.Default().Jobs, logger, metrics.NewRegistry())
+	cfg := config.Default().Export
+	cfg.Secret = "rahasia"
+	exports := New(cfg, upload.NewDisk(t.TempDir(), ""), queue, logger)
+	queue.Start()
+	t.Cleanup(queue.Stop)
+	app := fiber.New()
+	api := app.Group("/api", testkit.FakeAuth)
+	exports.Register(api, app)
+	return app, exports
+}
+
+// ready waits for the export of user at location to be built.
+func ready(t *testing.T, app *fiber.App, user, location string) Export {
+	var export Export
+	assert.Eventually(t, func() bool {
+		testkit.Do(t, app, "GET", location, nil, testkit.WithUser(user)).AssertStatus(200).JSON(&export)
+		return export.Status != Pending
+	}, time.Second, 10*time.Millisecond)
+	return export
+}
+
+func TestExport(t *testing.T) {
+	app, exports := newApp(t)
+	alice := testkit.WithUser("alice")
+	exports.Add("profile", func(_ context.Context, userID string) (any, error) {
+		return map[string]string{"name": userID}, nil
+	})
+	exports.Add("orders", func(_ context.Context, userID string) (any, error) {
+		return []string{"order-1"}, nil
+	})
+
+	var export Export
+	response := testkit.Do(t, app, "POST", "/api/me/export", nil, alice).AssertStatus(202).JSON(&export)
+	assert.Equal(t, Pending, export.Status)
+	location := response.Header.Get("Location")
+	assert.Equal(t, "/api/me/export/"+export.ID, location)
+
+	export = ready(t, app, "alice", location)
+	assert.Equal(t, Ready, export.Status)
+	assert.NotNil(t, export.CompletedAt)
+	assert.True(t, strings.HasPrefix(export.DownloadURL, "/exports/"+export.ID+"?expires="))
+	testkit.Do(t, app, "GET", location, nil, testkit.WithUser("bob")).AssertStatus(404)
+
+	download := testkit.Do(t, app, "GET", export.DownloadURL, nil).AssertStatus(200).
+		AssertHeader("Content-Type", "application/zip").
+		AssertHeader("Cache-Control", "no-store")
+	archive, err := zip.NewReader(bytes.NewReader(download.Body), int64(len(download.Body)))
+	assert.Nil(t, err)
+	contents := map[string]string{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		assert.Nil(t, err)
+		data, _ := io.ReadAll(r)
+		contents[file.Name] = string(data)
+	}
+	assert.JSONEq(t, `{"name":"alice"}`, contents["profile.json"])
+	assert.JSONEq(t, `["order-1"]`, contents["orders.json"])
+	assert.Contains(t, contents["export.json"], `"files": [
+    "profile.json",
+    "orders.json"
+  ]`)
+
+	// Links can't be changed, and stop working.
+	testkit.Do(t, app, "GET", strings.Replace(export.DownloadURL, "signature=", "signature=0", 1), nil).AssertStatus(403)
+	testkit.Do(t, app, "GET", strings.Replace(export.DownloadURL, "expires=", "expires=9", 1), nil).AssertStatus(403)
+	exports.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	testkit.Do(t, app, "GET", export.DownloadURL, nil).AssertStatus(403)
+
+	// Nor are archives kept for ever.
+	key := "exports/" + export.ID + ".zip"
+	assert.True(t, exports.Live(key))
+	exports.now = func() time.Time { return time.Now().Add(8 * 24 * time.Hour) }
+	testkit.Do(t, app, "GET", location, nil, alice).AssertStatus(404)
+	assert.False(t, exports.Live(key))
+}
+
+func TestExportFailed(t *testing.T) {
+	app, exports := newApp(t)
+	exports.Add("orders", func(context.Context, string) (any, error) {
+		return nil, errors.New("database is down")
+	})
+	var export Export
+	testkit.Do(t, app, "POST", "/api/me/export", nil, testkit.WithUser("alice")).AssertStatus(202).JSON(&export)
+	export = ready(t, app, "alice", "/api/me/export/"+export.ID)
+	assert.Equal(t, Failed, export.Status)
+	assert.Empty(t, export.DownloadURL)
+}
@@ -0,0 +1,57 @@
+// Package features switches parts of the app on and off at runtime.
+package features
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Flags are the features that are on. A feature that isn't configured is
+// off.
+type Flags struct {
+	flags atomic.Pointer[map[string]bool]
+}
+
+func New(flags map[string]bool) *Flags {
+	f := &Flags{}
+	f.Update(flags)
+	return f
+}
+
+// Update replaces the flags.
+func (f *Flags) Update(flags map[string]bool) {
+	copied := make(map[string]bool, len(flags))
+	for name, on := range flags {
+		copied[name] = on
+	}
+	f.flags.Store(&copied)
+}
+
+func (f *Flags) Enabled(name string) bool {
+	return (*f.flags.Load())[name]
+}
+
+// Require answers 404 to the requests for a feature that is off, as if
+// its routes weren't there.
+func (f *Flags) Require(name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !f.Enabled(name) {
+			return fiber.ErrNotFound
+		}
+		return c.Next()
+	}
+}
+
+// Handler lists the features that are on.
+func (f *Flags) Handler(c *fiber.Ctx) error {
+	enabled := []string{}
+	for name, on := range *f.flags.Load() {
+		if on {
+			enabled = append(enabled, name)
+		}
+	}
+	sort.Strings(enabled)
+	return c.JSON(fiber.Map{"enabled": enabled})
+}
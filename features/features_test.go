@@ -0,0 +1,30 @@
+package features
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlags(t *testing.T) {
+	configured := map[string]bool{"checkout": true, "search": false}
+	flags := New(configured)
+	// Changing the configured map later doesn't change the flags.
+	configured["search"] = true
+
+	app := fiber.New()
+	app.Get("/checkout", flags.Require("checkout"), func(c *fiber.Ctx) error { return c.SendString("checkout") })
+	app.Get("/search", flags.Require("search"), func(c *fiber.Ctx) error { return c.SendString("search") })
+	app.Get("/features", flags.Handler)
+
+	testkit.Do(t, app, "GET", "/checkout", nil).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/search", nil).AssertStatus(404)
+	testkit.Do(t, app, "GET", "/features", nil).AssertJSON(`{"enabled":["checkout"]}`)
+
+	flags.Update(map[string]bool{"search": true})
+	testkit.Do(t, app, "GET", "/checkout", nil).AssertStatus(404)
+	testkit.Do(t, app, "GET", "/search", nil).AssertStatus(200)
+	assert.False(t, flags.Enabled("unknown"))
+}
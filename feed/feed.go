@@ -0,0 +1,144 @@
+// Package feed writes Atom and RSS feeds, for readers to follow what
+// changes in the app.
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Feed is written as Atom 1.0 (RFC 4287) or RSS 2.0. ID and the entry IDs
+// must be IRIs that never change, such as the URLs of what they are
+// about.
+type Feed struct {
+	ID      string
+	Title   string
+	Link    string
+	Updated time.Time
+	Entries []Entry
+}
+
+type Entry struct {
+	ID      string
+	Title   string
+	Link    string
+	Summary string
+	Updated time.Time
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary,omitempty"`
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	PubDate     string    `xml:"pubDate"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	Value     string `xml:",chardata"`
+	Permalink bool   `xml:"isPermaLink,attr"`
+}
+
+// Atom writes f as an Atom feed.
+func (f Feed) Atom() ([]byte, error) {
+	feed := atomFeed{ID: f.ID, Title: f.Title, Updated: atomTime(f.Updated), Link: atomLink{Href: f.Link}, Entries: []atomEntry{}}
+	for _, entry := range f.Entries {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      entry.ID,
+			Title:   entry.Title,
+			Updated: atomTime(entry.Updated),
+			Link:    atomLink{Href: entry.Link},
+			Summary: entry.Summary,
+		})
+	}
+	return marshal(feed)
+}
+
+// RSS writes f as an RSS feed.
+func (f Feed) RSS() ([]byte, error) {
+	channel := rssChannel{Title: f.Title, Link: f.Link, Description: f.Title, PubDate: rssTime(f.Updated), Items: []rssItem{}}
+	for _, entry := range f.Entries {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       entry.Title,
+			Link:        entry.Link,
+			Description: entry.Summary,
+			GUID:        rssGUID{Value: entry.ID, Permalink: entry.ID == entry.Link},
+			PubDate:     rssTime(entry.Updated),
+		})
+	}
+	return marshal(rss{Version: "2.0", Channel: channel})
+}
+
+// Handler answers with the feed build returns: RSS for "?format=rss" and
+// Atom otherwise.
+func Handler(build func(c *fiber.Ctx) (Feed, error)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		feed, err := build(c)
+		if err != nil {
+			return err
+		}
+		contentType, write := "application/atom+xml; charset=utf-8", feed.Atom
+		if c.Query("format") == "rss" {
+			contentType, write = "application/rss+xml; charset=utf-8", feed.RSS
+		}
+		body, err := write()
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		return c.Send(body)
+	}
+}
+
+func marshal(v any) ([]byte, error) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func rssTime(t time.Time) string {
+	return t.UTC().Format(time.RFC1123Z)
+}
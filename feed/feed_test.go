@@ -0,0 +1,127 @@
+package feed
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+var sample = Feed{
+	ID:      "https://shop.example/web/feed.xml",
+	Title:   "Recent <orders>",
+	Link:    "https://shop.example/web/feed.xml",
+	Updated: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	Entries: []Entry{
+		{ID: "https://shop.example/orders/2", Title: "Order 2 & more", Link: "https://shop.example/orders/2", Summary: "2 items", Updated: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{ID: "tag:shop.example,2026:1", Title: "Order 1", Link: "https://shop.example/orders/1", Updated: time.Date(2026, 2, 28, 9, 0, 0, 0, time.FixedZone("WIB", 7*3600))},
+	},
+}
+
+// validAtom checks body against the rules of RFC 4287 the generator has
+// to follow: a feed and each of its entries have exactly one id, title
+// and updated, as RFC 3339 times, and entries without content link to it.
+func validAtom(t *testing.T, body []byte) {
+	var feed struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		IDs     []string `xml:"id"`
+		Titles  []string `xml:"title"`
+		Updated []string `xml:"updated"`
+		Entries []struct {
+			IDs     []string `xml:"id"`
+			Titles  []string `xml:"title"`
+			Updated []string `xml:"updated"`
+			Links   []struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	if !assert.Nil(t, xml.Unmarshal(body, &feed)) {
+		return
+	}
+	one := func(values []string, what string) {
+		if assert.Len(t, values, 1, what) {
+			assert.NotEmpty(t, values[0], what)
+		}
+	}
+	one(feed.IDs, "feed id")
+	one(feed.Titles, "feed title")
+	one(feed.Updated, "feed updated")
+	for _, entry := range feed.Entries {
+		one(entry.IDs, "entry id")
+		one(entry.Titles, "entry title")
+		one(entry.Updated, "entry updated")
+		_, err := time.Parse(time.RFC3339, entry.Updated[0])
+		assert.Nil(t, err)
+		if assert.NotEmpty(t, entry.Links) {
+			assert.NotEmpty(t, entry.Links[0].Href)
+		}
+	}
+}
+
+// validRSS checks body against the rules of RSS 2.0: a channel with a
+// title, link and description, whose items have a title or description
+// and RFC 822 dates.
+func validRSS(t *testing.T, body []byte) {
+	var rss struct {
+		Version string `xml:"version,attr"`
+		Channel struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			Description string `xml:"description"`
+			Items       []struct {
+				Title       string `xml:"title"`
+				Description string `xml:"description"`
+				PubDate     string `xml:"pubDate"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if !assert.Nil(t, xml.Unmarshal(body, &rss)) {
+		return
+	}
+	assert.Equal(t, "2.0", rss.Version)
+	assert.NotEmpty(t, rss.Channel.Title)
+	assert.NotEmpty(t, rss.Channel.Link)
+	assert.NotEmpty(t, rss.Channel.Description)
+	for _, item := range rss.Channel.Items {
+		assert.True(t, item.Title != "" || item.Description != "")
+		_, err := time.Parse(time.RFC1123Z, item.PubDate)
+		assert.Nil(t, err)
+	}
+}
+
+func TestAtom(t *testing.T) {
+	body, err := sample.Atom()
+	assert.Nil(t, err)
+	validAtom(t, body)
+	assert.Contains(t, string(body), `<feed xmlns="http://www.w3.org/2005/Atom">`)
+	assert.Contains(t, string(body), `<title>Recent &lt;orders&gt;</title>`)
+	assert.Contains(t, string(body), `<entry><id>tag:shop.example,2026:1</id><title>Order 1</title><updated>2026-02-28T02:00:00Z</updated>`)
+
+	body, err = Feed{ID: "urn:empty", Title: "Empty", Updated: sample.Updated}.Atom()
+	assert.Nil(t, err)
+	validAtom(t, body)
+}
+
+func TestRSS(t *testing.T) {
+	body, err := sample.RSS()
+	assert.Nil(t, err)
+	validRSS(t, body)
+	assert.Contains(t, string(body), `<guid isPermaLink="true">https://shop.example/orders/2</guid><pubDate>Sun, 01 Mar 2026 12:00:00 +0000</pubDate>`)
+	assert.Contains(t, string(body), `<guid isPermaLink="false">tag:shop.example,2026:1</guid>`)
+}
+
+func TestHandler(t *testing.T) {
+	app := fiber.New()
+	app.Get("/feed.xml", Handler(func(c *fiber.Ctx) (Feed, error) { return sample, nil }))
+
+	response := testkit.Do(t, app, "GET", "/feed.xml", nil).AssertStatus(200).
+		AssertHeader("Content-Type", "application/atom+xml; charset=utf-8")
+	validAtom(t, response.Body)
+	response = testkit.Do(t, app, "GET", "/feed.xml?format=rss", nil).AssertStatus(200).
+		AssertHeader("Content-Type", "application/rss+xml; charset=utf-8")
+	validRSS(t, response.Body)
+}
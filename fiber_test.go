@@ -1,20 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
-	"io"
-	"mime/multipart"
 	"net/http"
-	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
 	_ "embed"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/stretchr/testify/assert"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
 )
 
 var app = fiber.New()
@@ -24,14 +20,7 @@ func TestRoutingHelloWorld(t *testing.T) {
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.SendString("Hello World")
 	})
-	req := httptest.NewRequest("GET", "/", nil)
-	resp, err := app.Test(req)
-	assert.Nil(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	byte, err := io.ReadAll(resp.Body)
-	assert.Nil(t, err)
-	assert.Equal(t, "Hello World", string(byte))
+	testkit.Do(t, app, "GET", "/", nil).AssertStatus(200).AssertBody("Hello World")
 }
 
 func TestRoutingCtx(t *testing.T) {
@@ -40,14 +29,7 @@ func TestRoutingCtx(t *testing.T) {
 		name := c.Query("name", "Guest")
 		return c.SendString("Hello " + name)
 	})
-	req := httptest.NewRequest("GET", "/hello?name=Akbar", nil)
-	resp, err := app.Test(req)
-	assert.Nil(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	byte, err := io.ReadAll(resp.Body)
-	assert.Nil(t, err)
-	assert.Equal(t, "Hello Akbar", string(byte))
+	testkit.Do(t, app, "GET", "/hello?name=Akbar", nil).AssertStatus(200).AssertBody("Hello Akbar")
 }
 
 func TestHttpRequestFiber(t *testing.T) {
@@ -57,16 +39,10 @@ func TestHttpRequestFiber(t *testing.T) {
 		last := c.Cookies("lastname")
 		return c.SendString("Hello " + first + " " + last)
 	})
-	req := httptest.NewRequest("GET", "/request", nil)
-	req.Header.Set("firstname", "Jalal")
-	req.AddCookie(&http.Cookie{Name: "lastname", Value: "Akbar"})
-	resp, err := app.Test(req)
-	assert.Nil(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	byte, err := io.ReadAll(resp.Body)
-	assert.Nil(t, err)
-	assert.Equal(t, "Hello Jalal Akbar", string(byte))
+	testkit.Do(t, app, "GET", "/request", nil,
+		testkit.WithHeader("firstname", "Jalal"),
+		testkit.WithCookie(&http.Cookie{Name: "lastname", Value: "Akbar"}),
+	).AssertStatus(200).AssertBody("Hello Jalal Akbar")
 }
 
 func TestRouteParameterFiber(t *testing.T) {
@@ -76,14 +52,7 @@ func TestRouteParameterFiber(t *testing.T) {
 		orderId := c.Params("orderId")
 		return c.SendString("Get Order " + orderId + " from " + userId)
 	})
-	req := httptest.NewRequest("GET", "/users/Jalal/orders/2", nil)
-	resp, err := app.Test(req)
-	assert.Nil(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	byte, err := io.ReadAll(resp.Body)
-	assert.Nil(t, err)
-	assert.Equal(t, "Get Order 2 from Jalal", string(byte))
+	testkit.Do(t, app, "GET", "/users/Jalal/orders/2", nil).AssertStatus(200).AssertBody("Get Order 2 from Jalal")
 }
 
 func TestFormValueFiber(t *testing.T) {
@@ -93,17 +62,7 @@ func TestFormValueFiber(t *testing.T) {
 		return c.SendString("Hello " + name)
 	})
 
-	body := strings.NewReader("name=Jalal")
-	req := httptest.NewRequest("POST", "/hello", body)
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err := app.Test(req)
-	assert.Nil(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	byte, err := io.ReadAll(resp.Body)
-	assert.Nil(t, err)
-	assert.Equal(t, "Hello Jalal", string(byte))
+	testkit.DoForm(t, app, "POST", "/hello", url.Values{"name": {"Jalal"}}).AssertStatus(200).AssertBody("Hello Jalal")
 }
 
 //go:embed source/contoh.txt
@@ -124,22 +83,8 @@ func TestMultipartFormFiber(t *testing.T) {
 
 		return c.SendString("Upload Success")
 	})
-	body := new(bytes.Buffer)
-	writer := multipart.NewWriter(body)
-	file, err := writer.CreateFormFile("file", "contoh.txt")
-	assert.Nil(t, err)
-	file.Write(contohFile)
-	writer.Close()
-
-	req := httptest.NewRequest("POST", "/upload", body)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	resp, err := app.Test(req)
-	assert.Nil(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	byte, err := io.ReadAll(resp.Body)
-	assert.Nil(t, err)
-	assert.Equal(t, "Upload Success", string(byte))
+	body, contentType := testkit.Multipart(t, nil, testkit.File{Field: "file", Name: "contoh.txt", Data: contohFile})
+	testkit.Do(t, app, "POST", "/upload", body, contentType).AssertStatus(200).AssertBody("Upload Success")
 }
 
 // Request Body
@@ -160,16 +105,8 @@ func TestRequestBody(t *testing.T) {
 		}
 		return c.SendString("Hello " + request.Username)
 	})
-	body := strings.NewReader(`{"username":"akbar", "password":"rahasia"}`)
-	request := httptest.NewRequest("POST", "/login", body)
-	request.Header.Set("Content-Type", "application/json")
-	response, err := app.Test(request)
-	assert.Nil(t, err)
-	assert.Equal(t, 200, response.StatusCode)
-
-	byte, err := io.ReadAll(response.Body)
-	assert.Nil(t, err)
-	assert.Equal(t, "Hello akbar", string(byte))
+	testkit.DoJSON(t, app, "POST", "/login", LoginRequest{Username: "akbar", Password: "rahasia"}, nil).
+		AssertStatus(200).AssertBody("Hello akbar")
 }
 
 // Body Parser
@@ -193,33 +130,15 @@ func TestBodyParser(t *testing.T) {
 func TestBodyParserJSON(t *testing.T) {
 	TestBodyParser(t)
 
-	body := strings.NewReader(`{"username":"akbar","password":"rahasia","name":"jalal"}`)
-	request := httptest.NewRequest("POST", "/register", body)
-	request.Header.Set("Content-Type", "application/json")
-	resp, err := app.Test(request)
-
-	assert.Nil(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	byte, err := io.ReadAll(resp.Body)
-	assert.Nil(t, err)
-	assert.Equal(t, "Register akbar Success", string(byte))
+	testkit.DoJSON(t, app, "POST", "/register", `{"username":"akbar","password":"rahasia","name":"jalal"}`, nil).
+		AssertStatus(200).AssertBody("Register akbar Success")
 }
 
 func TestBodyParserForm(t *testing.T) {
 	TestBodyParser(t)
 
-	body := strings.NewReader(`username=akbar&password=rahasia&name=jalal`)
-	request := httptest.NewRequest("POST", "/register", body)
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := app.Test(request)
-
-	assert.Nil(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	byte, err := io.ReadAll(resp.Body)
-	assert.Nil(t, err)
-	assert.Equal(t, "Register akbar Success", string(byte))
+	testkit.DoForm(t, app, "POST", "/register", url.Values{"username": {"akbar"}, "password": {"rahasia"}, "name": {"jalal"}}).
+		AssertStatus(200).AssertBody("Register akbar Success")
 }
 
 func TestBodyParserXml(t *testing.T) {
@@ -231,16 +150,8 @@ func TestBodyParserXml(t *testing.T) {
 			<password>rahasia</password>
 			<name>jalal</name>
 		</RegisterRequest>`)
-	request := httptest.NewRequest("POST", "/register", body)
-	request.Header.Set("Content-Type", "application/xml")
-	resp, err := app.Test(request)
-
-	assert.Nil(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	byte, err := io.ReadAll(resp.Body)
-	assert.Nil(t, err)
-	assert.Equal(t, "Register akbar Success", string(byte))
+	testkit.Do(t, app, "POST", "/register", body, testkit.WithHeader("Content-Type", "application/xml")).
+		AssertStatus(200).AssertBody("Register akbar Success")
 }
 
 // HTTP Response
@@ -253,14 +164,7 @@ func TestJSON(t *testing.T) {
 			"name":     "jalal akbar",
 		})
 	})
-	request := httptest.NewRequest("GET", "/user", nil)
-	response, err := app.Test(request)
-	assert.Nil(t, err)
-
-	body, err := io.ReadAll(response.Body)
-
-	assert.Nil(t, err)
-	assert.Equal(t, `{"name":"jalal akbar","username":"jalal"}`, string(body))
+	testkit.Do(t, app, "GET", "/user", nil).AssertBody(`{"name":"jalal akbar","username":"jalal"}`)
 }
 
 // Download File
@@ -271,46 +175,21 @@ func TestDownloadFile(t *testing.T) {
 		app.Get("/download", func(c *fiber.Ctx) error {
 			return c.Download("./source/contoh.txt", "contoh.txt")
 		})
-		request := httptest.NewRequest("GET", "/download", nil)
-		response, err := app.Test(request)
-
-		assert.Nil(t, err)
-		assert.Equal(t, `attachment; filename="contoh.txt"`, response.Header.Get("Content-Disposition"))
-
-		body, err := io.ReadAll(response.Body)
-
-		assert.Nil(t, err)
-		assert.Equal(t, "this is sample", string(body))
+		testkit.Do(t, app, "GET", "/download", nil).
+			AssertHeader("Content-Disposition", `attachment; filename="contoh.txt"`).
+			AssertBody("this is sample")
 	})
 	t.Run("Send", func(t *testing.T) {
 		app.Get("/send", func(c *fiber.Ctx) error {
 			return c.Send([]byte("Hello"))
 		})
-		request := httptest.NewRequest("GET", "/send", nil)
-		response, err := app.Test(request)
-
-		assert.Nil(t, err)
-
-		body, err := io.ReadAll(response.Body)
-
-		assert.Nil(t, err)
-		assert.Equal(t, "Hello", string(body))
-		fmt.Println("Send: ", string(body))
+		testkit.Do(t, app, "GET", "/send", nil).AssertBody("Hello")
 	})
 	t.Run("SendFile", func(t *testing.T) {
 		app.Get("/sendfile", func(c *fiber.Ctx) error {
 			return c.SendFile("./source/contoh.txt")
 		})
-		request := httptest.NewRequest("GET", "/sendfile", nil)
-		response, err := app.Test(request)
-
-		assert.Nil(t, err)
-
-		body, err := io.ReadAll(response.Body)
-
-		assert.Nil(t, err)
-		assert.Equal(t, "this is sample", string(body))
-		fmt.Println("Send File: ", string(body))
+		testkit.Do(t, app, "GET", "/sendfile", nil).AssertBody("this is sample")
 	})
 
 }
@@ -329,14 +208,7 @@ func TestRoutingGroup(t *testing.T) {
 	web.Group("/hello", helloWorld)
 	web.Group("/world", helloWorld)
 
-	request := httptest.NewRequest("GET", "/api/hello", nil)
-	response, err := app.Test(request)
-	assert.Nil(t, err)
-
-	body, err := io.ReadAll(response.Body)
-
-	assert.Nil(t, err)
-	assert.Equal(t, "Hello World", string(body))
+	testkit.Do(t, app, "GET", "/api/hello", nil).AssertBody("Hello World")
 }
 
 //func (t *testing.T){}
@@ -0,0 +1,289 @@
+// Package files keeps the files users upload for themselves, stored as
+// they are, and lets them list, download and delete them by ID. Files are
+// only ever sent to their owners, as attachments, since what they hold is
+// up to whoever uploaded them. Deleting drops a file right away; its
+// stored copy is removed by a job, or by the upload GC should the job be
+// lost.
+//
+// With a transcoder, videos are also turned into an HLS rendition by a
+// job; their metadata says how far that got.
+package files
+
+import (
+	"context"
+	"log/slog"
+	"mime"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/jobs"
+	"github.com/jalal-akbar/belajar-golang-fiber/transcode"
+	"github.com/jalal-akbar/belajar-golang-fiber/upload"
+)
+
+const (
+	// Prefix is where in the storage the files are kept.
+	Prefix = "files"
+	// JobRemove is the type of the jobs removing deleted files from the
+	// storage.
+	JobRemove = "files.remove"
+	// MediaPrefix is where in the storage the renditions of videos are
+	// kept, each under the ID of its file.
+	MediaPrefix = "media"
+	// JobTranscode is the type of the jobs transcoding videos.
+	JobTranscode = "files.transcode"
+
+	maxName = 255
+	// maxBulk is the most files deleted at once.
+	maxBulk = 100
+)
+
+// Statuses of files.
+const (
+	Available   = "available"
+	Quarantined = "quarantined"
+)
+
+// File is the metadata of a file. URL is where its owner downloads it;
+// quarantined files have none until an admin releases them.
+type File struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Status      string    `json:"status"`
+	URL         string    `json:"url,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Image is the size and orientation of images.
+	Image *upload.ImageInfo `json:"image,omitempty"`
+	// Video is how the transcoding of videos is going.
+	Video *Video `json:"video,omitempty"`
+
+	userID     string
+	key        string
+	reason     string
+	renditions []string
+}
+
+// Files keeps the metadata of the files in the database, in the table
+// Migrations create, so it outlives restarts like the files themselves.
+type Files struct {
+	db         *database.DB
+	uploads    *upload.Pipeline
+	queue      *jobs.Queue
+	logger     *slog.Logger
+	now        func() time.Time
+	transcoder transcode.Transcoder
+}
+
+// New has queue remove the stored copies of deleted files.
+func New(db *database.DB, uploads *upload.Pipeline, queue *jobs.Queue, logger *slog.Logger) *Files {
+	f := &Files{db: db, uploads: uploads, queue: queue, logger: logger, now: clock.System.Now}
+	queue.Handle(JobRemove, f.remove)
+	queue.Handle(JobTranscode, f.transcode)
+	return f
+}
+
+// Register adds POST, GET and DELETE /files, GET /files/:id and GET
+// /files/:id/content for the authenticated user, and GET
+// /media/:id/stream to play videos. The URLs of files point to the router
+// mounted at /api.
+func (f *Files) Register(router fiber.Router) {
+	router.Post("/files", f.uploadHandler)
+	router.Get("/files", f.listHandler)
+	router.Get("/files/:id", f.getHandler)
+	router.Get("/files/:id/content", f.contentHandler)
+	router.Delete("/files", f.deleteHandler)
+	router.Get("/media/:id/stream", f.streamHandler)
+	router.Get("/media/:id/stream/:segment", f.segmentHandler)
+}
+
+// List returns the files of userID, oldest first.
+func (f *Files) List(ctx context.Context, userID string) ([]File, error) {
+	return f.query(ctx, "user_id = ?", userID)
+}
+
+// Delete deletes the files of userID with the given IDs and returns the
+// IDs of those it deleted; others are skipped, so deleting again does no
+// harm. They are gone from the API right away and from the storage once
+// their removal jobs have run.
+func (f *Files) Delete(ctx context.Context, userID string, ids []string) ([]string, error) {
+	files, err := f.drop(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	deleted := []string{}
+	var keys []string
+	for _, file := range files {
+		deleted = append(deleted, file.ID)
+		keys = append(keys, file.key)
+		keys = append(keys, file.renditions...)
+	}
+	for _, key := range keys {
+		if err := f.queue.Enqueue(ctx, JobRemove, map[string]string{"key": key}); err != nil {
+			// The GC removes it later.
+			f.logger.ErrorContext(ctx, "queueing file removal failed", slog.String("key", key), slog.String("error", err.Error()))
+		}
+	}
+	return deleted, nil
+}
+
+// DeleteAll deletes all files of userID, quarantined ones included, and
+// returns how many.
+func (f *Files) DeleteAll(ctx context.Context, userID string) (int, error) {
+	files, err := f.List(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]string, len(files))
+	for i, file := range files {
+		ids[i] = file.ID
+	}
+	deleted, err := f.Delete(ctx, userID, ids)
+	return len(deleted), err
+}
+
+// Live reports whether key is the stored copy, or part of the rendition,
+// of a file that isn't deleted, for the upload GC. Should the database
+// fail to say, the file is taken to be live.
+func (f *Files) Live(key string) bool {
+	id := path.Base(key)
+	if rest, ok := strings.CutPrefix(key, MediaPrefix+"/"); ok {
+		id, _, _ = strings.Cut(rest, "/")
+	}
+	file, ok, err := f.get(context.Background(), id)
+	if err != nil {
+		f.logger.Error("looking up file for the upload GC failed", slog.String("key", key), slog.String("error", err.Error()))
+		return true
+	}
+	return ok && (file.key == key || slices.Contains(file.renditions, key))
+}
+
+func (f *Files) remove(ctx context.Context, job jobs.Job) error {
+	return f.uploads.Storage().Delete(ctx, job.Payload["key"])
+}
+
+// uploadHandler stores the file in the file form field. Files the scanner
+// flags are kept, but quarantined.
+func (f *Files) uploadHandler(c *fiber.Ctx) error {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "missing file")
+	}
+	stored, err := f.uploads.File(c.UserContext(), header, Prefix)
+	if err != nil {
+		return upload.HTTPError(err)
+	}
+	name := path.Base(strings.ReplaceAll(header.Filename, "\\", "/"))
+	for len(name) > maxName {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	file := File{
+		ID:          path.Base(stored.Key),
+		Name:        utils.CopyString(name),
+		ContentType: stored.ContentType,
+		Size:        header.Size,
+		Status:      Available,
+		CreatedAt:   f.now(),
+		Image:       stored.Image,
+		userID:      utils.CopyString(ctxutil.CurrentUser(c)),
+		key:         stored.Key,
+		reason:      stored.Quarantine,
+	}
+	if file.reason == "" {
+		file.URL = contentURL(file.ID)
+	} else {
+		file.Status = Quarantined
+		f.logger.WarnContext(c.UserContext(), "upload quarantined",
+			slog.String("file", file.ID),
+			slog.String("user", file.userID),
+			slog.String("reason", file.reason))
+	}
+	if file.Status == Available && f.transcodes(file) {
+		file.Video = &Video{Status: Processing}
+	}
+	if err := f.insert(c.UserContext(), file); err != nil {
+		// The stored copy is left to the GC.
+		return err
+	}
+	if file.Video != nil {
+		f.transcodeLater(c.UserContext(), file.ID)
+	}
+	return c.Status(fiber.StatusCreated).JSON(file)
+}
+
+func (f *Files) listHandler(c *fiber.Ctx) error {
+	list, err := f.List(c.UserContext(), ctxutil.CurrentUser(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(list)
+}
+
+func (f *Files) getHandler(c *fiber.Ctx) error {
+	file, ok, err := f.get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if !ok || file.userID != ctxutil.CurrentUser(c) {
+		return fiber.ErrNotFound
+	}
+	return c.JSON(file)
+}
+
+// contentHandler sends a file of the user so that browsers save it
+// rather than open it: as an attachment under its name, of the type it
+// was stored with but not to be sniffed and, should it be opened anyway,
+// sandboxed.
+func (f *Files) contentHandler(c *fiber.Ctx) error {
+	file, err := f.owned(c)
+	if err != nil {
+		return err
+	}
+	src, err := f.uploads.Storage().Open(c.UserContext(), file.key)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, file.ContentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'none'; sandbox")
+	c.Set(fiber.HeaderCacheControl, privateDay)
+	return c.SendStream(src, int(file.Size))
+}
+
+// contentURL is where contentHandler sends the file id.
+func contentURL(id string) string {
+	return "/api/files/" + id + "/content"
+}
+
+// deleteHandler deletes the files of the comma separated ids query
+// parameter, DELETE /files?ids=a,b, and answers with those it deleted.
+func (f *Files) deleteHandler(c *fiber.Ctx) error {
+	var ids []string
+	for _, id := range strings.Split(c.Query("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, utils.CopyString(id))
+		}
+	}
+	switch {
+	case len(ids) == 0:
+		return fiber.NewError(fiber.StatusBadRequest, "missing ids")
+	case len(ids) > maxBulk:
+		return fiber.NewError(fiber.StatusBadRequest, "at most 100 ids at once")
+	}
+	deleted, err := f.Delete(c.UserContext(), ctxutil.CurrentUser(c), ids)
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"deleted": deleted})
+}
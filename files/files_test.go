@@ -0,0 +1,164 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/jobs"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/jalal-akbar/belajar-golang-fiber/upload"
+	"github.com/stretchr/testify/assert"
+)
+
+func newApp(t *testing.T) (*fiber.App, *Files, string) {
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queue := jobs.New(config.Default().Jobs, logger, metrics.NewRegistry())
+	files := New(testkit.OpenDB(t, Migrations...), upload.New(config.Default().Uploads, upload.NewDisk(dir, "/files")), queue, logger)
+	queue.Start()
+	t.Cleanup(queue.Stop)
+	app := fiber.New()
+	app.Use(testkit.FakeAuth)
+	files.Register(app)
+	return app, files, dir
+}
+
+func uploadFile(t *testing.T, app *fiber.App, user, name, data string) File {
+	body, contentType := testkit.Multipart(t, nil, testkit.File{Field: "file", Name: name, Data: []byte(data)})
+	request := httptest.NewRequest("POST", "/files", body)
+	contentType(request)
+	request.Header.Set(testkit.HeaderUser, user)
+	var file File
+	testkit.Send(t, app, request).AssertStatus(201).JSON(&file)
+	return file
+}
+
+func TestFiles(t *testing.T) {
+	app, files, dir := newApp(t)
+	alice := testkit.WithUser("alice")
+
+	notes := uploadFile(t, app, "alice", "../notes.txt", "catatan")
+	assert.Equal(t, "notes.txt", notes.Name)
+	assert.Equal(t, "text/plain; charset=utf-8", notes.ContentType)
+	assert.Equal(t, int64(7), notes.Size)
+	assert.Equal(t, "/api/files/"+notes.ID+"/content", notes.URL)
+	assert.Nil(t, notes.Image)
+	page := uploadFile(t, app, "alice", "page.html", "<html></html>")
+	other := uploadFile(t, app, "bob", "bob.txt", "bob")
+
+	var list []File
+	testkit.Do(t, app, "GET", "/files", nil, alice).AssertStatus(200).JSON(&list)
+	assert.Len(t, list, 2)
+	assert.Equal(t, notes.ID, list[0].ID)
+	testkit.Do(t, app, "GET", "/files/"+notes.ID, nil, alice).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/files/"+other.ID, nil, alice).AssertStatus(404)
+	assert.True(t, files.Live("files/"+notes.ID))
+
+	// Files are downloaded by their owners only, and never shown inline.
+	testkit.Do(t, app, "GET", "/files/"+page.ID+"/content", nil, alice).
+		AssertStatus(200).
+		AssertHeader("Content-Disposition", `attachment; filename=page.html`).
+		AssertHeader("X-Content-Type-Options", "nosniff").
+		AssertBody("<html></html>")
+	testkit.Do(t, app, "GET", "/files/"+other.ID+"/content", nil, alice).AssertStatus(404)
+
+	// Bob's file and unknown IDs are skipped.
+	var deleted struct {
+		Deleted []string `json:"deleted"`
+	}
+	testkit.Do(t, app, "DELETE", "/files?ids="+notes.ID+","+other.ID+",missing", nil, alice).AssertStatus(200).JSON(&deleted)
+	assert.Equal(t, []string{notes.ID}, deleted.Deleted)
+	testkit.Do(t, app, "GET", "/files/"+notes.ID, nil, alice).AssertStatus(404)
+	assert.False(t, files.Live("files/"+notes.ID))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "files", notes.ID))
+		return os.IsNotExist(err)
+	}, time.Second, 10*time.Millisecond)
+	_, err := os.Stat(filepath.Join(dir, "files", other.ID))
+	assert.Nil(t, err)
+
+	testkit.Do(t, app, "DELETE", "/files?ids="+notes.ID, nil, alice).AssertStatus(200).AssertJSON(`{"deleted":[]}`)
+	testkit.Do(t, app, "DELETE", "/files?ids=,", nil, alice).AssertStatus(400)
+	many := "x"
+	for i := 0; i < maxBulk; i++ {
+		many += ",x"
+	}
+	testkit.Do(t, app, "DELETE", "/files?ids="+many, nil, alice).AssertStatus(400)
+	testkit.Do(t, app, "POST", "/files", nil, alice).AssertStatus(400)
+}
+
+func TestImageMetadata(t *testing.T) {
+	app, _, _ := newApp(t)
+	img := image.NewRGBA(image.Rect(0, 0, 30, 20))
+	var data bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&data, img, nil))
+
+	photo := uploadFile(t, app, "alice", "photo.jpg", data.String())
+	assert.Equal(t, "image/jpeg", photo.ContentType)
+	assert.Equal(t, &upload.ImageInfo{Width: 30, Height: 20, Orientation: 1}, photo.Image)
+}
+
+func TestDeleteWithoutQueue(t *testing.T) {
+	// Removal jobs dropped on shutdown leave the stored file to the GC.
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uploads := upload.New(config.Default().Uploads, upload.NewDisk(dir, "/files"))
+	files := New(testkit.OpenDB(t, Migrations...), uploads, jobs.New(config.Default().Jobs, logger, metrics.NewRegistry()), logger)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		ctxutil.SetCurrentUser(c, "alice")
+		return c.Next()
+	})
+	files.Register(app)
+	file := uploadFile(t, app, "alice", "a.txt", "a")
+	deleted, err := files.Delete(context.Background(), "alice", []string{file.ID})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{file.ID}, deleted)
+
+	gc := upload.NewGC(uploads.Storage(), 0, logger, metrics.NewRegistry())
+	gc.Own(Prefix, files.Live)
+	removed, err := gc.Collect(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+}
+
+func TestFilesOutliveRestarts(t *testing.T) {
+	dir := t.TempDir()
+	db := testkit.OpenDB(t, Migrations...)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uploads := upload.New(config.Default().Uploads, upload.NewDisk(dir, "/files"))
+	newFiles := func() (*fiber.App, *Files) {
+		files := New(db, uploads, jobs.New(config.Default().Jobs, logger, metrics.NewRegistry()), logger)
+		app := fiber.New()
+		app.Use(func(c *fiber.Ctx) error {
+			ctxutil.SetCurrentUser(c, "alice")
+			return c.Next()
+		})
+		files.Register(app)
+		return app, files
+	}
+	app, _ := newFiles()
+	file := uploadFile(t, app, "alice", "a.txt", "a")
+
+	// The GC of the restarted app keeps the file.
+	app, files := newFiles()
+	gc := upload.NewGC(uploads.Storage(), 0, logger, metrics.NewRegistry())
+	gc.Own(Prefix, files.Live)
+	removed, err := gc.Collect(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, removed)
+	testkit.Do(t, app, "GET", "/files/"+file.ID+"/content", nil).AssertStatus(200).AssertBody("a")
+}
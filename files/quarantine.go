@@ -0,0 +1,177 @@
+package files
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/audit"
+)
+
+// QuarantinedFile is a quarantined file as admins see it: whose it is and
+// why it was quarantined.
+type QuarantinedFile struct {
+	File
+	UserID string `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+// RegisterQuarantine adds the admin review of quarantined files, each
+// decision recorded in auditLog:
+//
+//	GET    /              the quarantined files, oldest first
+//	GET    /:id/download  the file, as an attachment
+//	POST   /:id/release   makes the file available to its owner
+//	DELETE /:id           purges the file
+func (f *Files) RegisterQuarantine(router fiber.Router, auditLog *audit.Log) {
+	q := &quarantine{files: f, audit: auditLog}
+	router.Get("/", q.listHandler)
+	router.Get("/:id/download", q.downloadHandler)
+	router.Post("/:id/release", q.releaseHandler)
+	router.Delete("/:id", q.purgeHandler)
+}
+
+// Quarantined returns the quarantined files, oldest first.
+func (f *Files) Quarantined(ctx context.Context) ([]QuarantinedFile, error) {
+	files, err := f.query(ctx, "status = ?", Quarantined)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]QuarantinedFile, len(files))
+	for i, file := range files {
+		list[i] = QuarantinedFile{File: file, UserID: file.userID, Reason: file.reason}
+	}
+	return list, nil
+}
+
+// Release moves a quarantined file out of quarantine and makes it
+// available to its owner, transcoding it if it is a video.
+func (f *Files) Release(ctx context.Context, id string) (File, error) {
+	file, err := f.quarantined(ctx, id)
+	if err != nil {
+		return File{}, err
+	}
+	storage := f.uploads.Storage()
+	src, err := storage.Open(ctx, file.key)
+	if err != nil {
+		return File{}, err
+	}
+	defer src.Close()
+	key := Prefix + "/" + file.ID
+	if err := storage.Put(ctx, key, src); err != nil {
+		return File{}, err
+	}
+
+	old := file.key
+	file, ok, err := f.update(ctx, id, func(file *File) bool {
+		if file.Status != Quarantined {
+			return false
+		}
+		file.key = key
+		file.Status = Available
+		file.URL = contentURL(file.ID)
+		file.reason = ""
+		if f.transcodes(*file) {
+			file.Video = &Video{Status: Processing}
+		}
+		return true
+	})
+	if err != nil || !ok {
+		// Purged or released meanwhile, or failed to say.
+		storage.Delete(ctx, key)
+		if err == nil {
+			err = fiber.ErrNotFound
+		}
+		return File{}, err
+	}
+	if file.Video != nil {
+		f.transcodeLater(ctx, file.ID)
+	}
+
+	if err := storage.Delete(ctx, old); err != nil {
+		// Left to the GC.
+		f.logger.WarnContext(ctx, "removing released file from quarantine failed", slog.String("key", old), slog.String("error", err.Error()))
+	}
+	return file, nil
+}
+
+// Purge deletes a quarantined file.
+func (f *Files) Purge(ctx context.Context, id string) (QuarantinedFile, error) {
+	file, err := f.quarantined(ctx, id)
+	if err != nil {
+		return QuarantinedFile{}, err
+	}
+	deleted, err := f.Delete(ctx, file.userID, []string{id})
+	if err != nil {
+		return QuarantinedFile{}, err
+	}
+	if len(deleted) == 0 {
+		return QuarantinedFile{}, fiber.ErrNotFound
+	}
+	return QuarantinedFile{File: file, UserID: file.userID, Reason: file.reason}, nil
+}
+
+// quarantined returns the file id if it is quarantined, and
+// fiber.ErrNotFound otherwise.
+func (f *Files) quarantined(ctx context.Context, id string) (File, error) {
+	file, ok, err := f.get(ctx, id)
+	if err != nil {
+		return File{}, err
+	}
+	if !ok || file.Status != Quarantined {
+		return File{}, fiber.ErrNotFound
+	}
+	return file, nil
+}
+
+type quarantine struct {
+	files *Files
+	audit *audit.Log
+}
+
+func (q *quarantine) listHandler(c *fiber.Ctx) error {
+	list, err := q.files.Quarantined(c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.JSON(list)
+}
+
+// downloadHandler sends a quarantined file so that browsers save it
+// rather than open it: as an attachment of no particular type, not to be
+// sniffed and, should it be opened anyway, sandboxed.
+func (q *quarantine) downloadHandler(c *fiber.Ctx) error {
+	file, err := q.files.quarantined(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+	src, err := q.files.uploads.Storage().Open(c.UserContext(), file.key)
+	if err != nil {
+		return err
+	}
+	q.audit.Record(c, "file.quarantine.download", file.ID, map[string]string{"user": file.userID})
+	c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+file.ID+`.quarantined"`)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'none'; sandbox")
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.SendStream(src)
+}
+
+func (q *quarantine) releaseHandler(c *fiber.Ctx) error {
+	file, err := q.files.Release(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+	q.audit.Record(c, "file.quarantine.release", file.ID, map[string]string{"user": file.userID})
+	return c.JSON(file)
+}
+
+func (q *quarantine) purgeHandler(c *fiber.Ctx) error {
+	file, err := q.files.Purge(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+	q.audit.Record(c, "file.quarantine.purge", file.ID, map[string]string{"user": file.UserID, "reason": file.Reason})
+	return c.SendStatus(fiber.StatusNoContent)
+}
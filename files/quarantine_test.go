@@ -0,0 +1,100 @@
+package files
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/audit"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/jobs"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/scan"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/jalal-akbar/belajar-golang-fiber/upload"
+	"github.com/stretchr/testify/assert"
+)
+
+// signatures flags files containing "virus".
+type signatures struct{}
+
+func (signatures) Scan(ctx context.Context, r io.Reader) (scan.Result, error) {
+	data, _ := io.ReadAll(r)
+	if strings.Contains(string(data), "virus") {
+		return scan.Result{Infected: true, Signature: "Test-Signature"}, nil
+	}
+	return scan.Result{}, nil
+}
+
+func TestQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queue := jobs.New(config.Default().Jobs, logger, metrics.NewRegistry())
+	uploads := upload.New(config.Default().Uploads, upload.NewDisk(dir, "/files"))
+	uploads.UseScanner(signatures{})
+	files := New(testkit.OpenDB(t, Migrations...), uploads, queue, logger)
+	auditLog := audit.New(logger, 10)
+	app := fiber.New()
+	app.Use(testkit.FakeAuth)
+	files.Register(app)
+	files.RegisterQuarantine(app.Group("/admin/quarantine"), auditLog)
+	alice := testkit.WithUser("alice")
+
+	flagged := uploadFile(t, app, "alice", "invoice.html", "<html>virus</html>")
+	assert.Equal(t, Quarantined, flagged.Status)
+	assert.Empty(t, flagged.URL)
+	clean := uploadFile(t, app, "alice", "clean.txt", "clean")
+	assert.Equal(t, Available, clean.Status)
+	second := uploadFile(t, app, "bob", "second.txt", "virus again")
+
+	var list []QuarantinedFile
+	testkit.Do(t, app, "GET", "/admin/quarantine", nil).AssertStatus(200).JSON(&list)
+	assert.Len(t, list, 2)
+	assert.Equal(t, flagged.ID, list[0].ID)
+	assert.Equal(t, "alice", list[0].UserID)
+	assert.Equal(t, "infected: Test-Signature", list[0].Reason)
+
+	// Downloaded to be looked at, never rendered.
+	testkit.Do(t, app, "GET", "/admin/quarantine/"+flagged.ID+"/download", nil).
+		AssertStatus(200).
+		AssertHeader("Content-Type", "application/octet-stream").
+		AssertHeader("Content-Disposition", `attachment; filename="`+flagged.ID+`.quarantined"`).
+		AssertHeader("X-Content-Type-Options", "nosniff").
+		AssertHeader("Content-Security-Policy", "default-src 'none'; sandbox").
+		AssertBody("<html>virus</html>")
+	testkit.Do(t, app, "GET", "/admin/quarantine/"+clean.ID+"/download", nil).AssertStatus(404)
+
+	// A false positive is released to its owner.
+	var released File
+	testkit.Do(t, app, "POST", "/admin/quarantine/"+flagged.ID+"/release", nil).AssertStatus(200).JSON(&released)
+	assert.Equal(t, Available, released.Status)
+	assert.Equal(t, "/api/files/"+flagged.ID+"/content", released.URL)
+	data, err := os.ReadFile(filepath.Join(dir, "files", flagged.ID))
+	assert.Nil(t, err)
+	assert.Equal(t, "<html>virus</html>", string(data))
+	_, err = os.Stat(filepath.Join(dir, "quarantine", flagged.ID))
+	assert.True(t, os.IsNotExist(err))
+	testkit.Do(t, app, "GET", "/files/"+flagged.ID, nil, alice).AssertStatus(200).AssertContains(`"status":"available"`)
+	testkit.Do(t, app, "POST", "/admin/quarantine/"+flagged.ID+"/release", nil).AssertStatus(404)
+
+	// The other is purged.
+	testkit.Do(t, app, "DELETE", "/admin/quarantine/"+second.ID, nil).AssertStatus(204)
+	testkit.Do(t, app, "GET", "/admin/quarantine", nil).AssertStatus(200).AssertJSON(`[]`)
+	assert.False(t, files.Live("quarantine/"+second.ID))
+	testkit.Do(t, app, "DELETE", "/admin/quarantine/"+second.ID, nil).AssertStatus(404)
+
+	var actions []string
+	for _, entry := range auditLog.List() {
+		actions = append(actions, entry.Action+" "+entry.Target)
+	}
+	assert.Equal(t, []string{
+		"file.quarantine.purge " + second.ID,
+		"file.quarantine.release " + flagged.ID,
+		"file.quarantine.download " + flagged.ID,
+	}, actions)
+}
@@ -0,0 +1,181 @@
+package files
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/upload"
+)
+
+// Migrations create the table of the metadata of files.
+var Migrations = []database.Migration{{
+	ID: "files-0001",
+	Statements: []string{
+		`CREATE TABLE files (
+	id VARCHAR(64) PRIMARY KEY,
+	user_id VARCHAR(64) NOT NULL,
+	name TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	storage_key TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	image TEXT NOT NULL,
+	video TEXT NOT NULL,
+	renditions TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+)`,
+		`CREATE INDEX files_user_id ON files (user_id, created_at)`,
+		`CREATE INDEX files_status ON files (status, created_at)`,
+	},
+}}
+
+const fileColumns = "id, user_id, name, content_type, size, status, storage_key, reason, image, video, renditions, created_at"
+
+// insert records the metadata of a new file.
+func (f *Files) insert(ctx context.Context, file File) error {
+	image, video, renditions, err := encodeFile(file)
+	if err != nil {
+		return err
+	}
+	_, err = f.db.Conn(ctx).ExecContext(ctx, f.db.Rebind(`INSERT INTO files (`+fileColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		file.ID, file.userID, file.Name, file.ContentType, file.Size, file.Status, file.key, file.reason, image, video, renditions, file.CreatedAt.UTC())
+	return err
+}
+
+// get returns the file id; ok is false if there is none.
+func (f *Files) get(ctx context.Context, id string) (file File, ok bool, err error) {
+	file, err = scanFile(f.db.Conn(ctx).QueryRowContext(ctx, f.db.Rebind(`SELECT `+fileColumns+` FROM files WHERE id = ?`), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return File{}, false, nil
+	}
+	return file, err == nil, err
+}
+
+// query returns the files where holds, oldest first.
+func (f *Files) query(ctx context.Context, where string, args ...any) ([]File, error) {
+	rows, err := f.db.Conn(ctx).QueryContext(ctx, f.db.Rebind(`SELECT `+fileColumns+` FROM files WHERE `+where+` ORDER BY created_at, id`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []File{}
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, file)
+	}
+	return list, rows.Err()
+}
+
+// update changes the file id in a transaction, unless it is gone or
+// change returns false; ok says whether it did.
+func (f *Files) update(ctx context.Context, id string, change func(file *File) bool) (file File, ok bool, err error) {
+	lock := ""
+	if f.db.Dialect == database.Postgres {
+		lock = " FOR UPDATE"
+	}
+	err = f.db.InTx(ctx, func(ctx context.Context) error {
+		conn := f.db.Conn(ctx)
+		file, err = scanFile(conn.QueryRowContext(ctx, f.db.Rebind(`SELECT `+fileColumns+` FROM files WHERE id = ?`+lock), id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil || !change(&file) {
+			return err
+		}
+		image, video, renditions, err := encodeFile(file)
+		if err != nil {
+			return err
+		}
+		_, err = conn.ExecContext(ctx, f.db.Rebind(`UPDATE files SET status = ?, storage_key = ?, reason = ?, image = ?, video = ?, renditions = ? WHERE id = ?`),
+			file.Status, file.key, file.reason, image, video, renditions, id)
+		ok = err == nil
+		return err
+	})
+	if err != nil || !ok {
+		return File{}, false, err
+	}
+	return file, true, nil
+}
+
+// drop deletes the records of the files of userID with the given IDs and
+// returns them.
+func (f *Files) drop(ctx context.Context, userID string, ids []string) ([]File, error) {
+	var removed []File
+	err := f.db.InTx(ctx, func(ctx context.Context) error {
+		conn := f.db.Conn(ctx)
+		for _, id := range ids {
+			file, ok, err := f.get(ctx, id)
+			if err != nil {
+				return err
+			}
+			if !ok || file.userID != userID {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx, f.db.Rebind(`DELETE FROM files WHERE id = ?`), id); err != nil {
+				return err
+			}
+			removed = append(removed, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+func encodeFile(file File) (image, video, renditions string, err error) {
+	encode := func(v any, ok bool) (string, error) {
+		if !ok {
+			return "", nil
+		}
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+	if image, err = encode(file.Image, file.Image != nil); err != nil {
+		return
+	}
+	if video, err = encode(file.Video, file.Video != nil); err != nil {
+		return
+	}
+	renditions, err = encode(file.renditions, len(file.renditions) > 0)
+	return
+}
+
+func scanFile(row interface{ Scan(...any) error }) (File, error) {
+	var file File
+	var image, video, renditions string
+	err := row.Scan(&file.ID, &file.userID, &file.Name, &file.ContentType, &file.Size, &file.Status, &file.key, &file.reason, &image, &video, &renditions, &file.CreatedAt)
+	if err != nil {
+		return File{}, err
+	}
+	file.CreatedAt = file.CreatedAt.UTC()
+	if file.Status == Available {
+		file.URL = contentURL(file.ID)
+	}
+	if image != "" {
+		file.Image = new(upload.ImageInfo)
+		if err := json.Unmarshal([]byte(image), file.Image); err != nil {
+			return File{}, err
+		}
+	}
+	if video != "" {
+		file.Video = new(Video)
+		if err := json.Unmarshal([]byte(video), file.Video); err != nil {
+			return File{}, err
+		}
+	}
+	if renditions != "" {
+		if err := json.Unmarshal([]byte(renditions), &file.renditions); err != nil {
+			return File{}, err
+		}
+	}
+	return file, nil
+}
@@ -0,0 +1,200 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/transcode"
+)
+
+const (
+	// Renditions never change under their file's ID, but are only for its
+	// owner.
+	privateImmutable = "private, max-age=31536000, immutable"
+	// Originals are kept for a day, then checked against their ETag.
+	privateDay = "private, max-age=86400"
+)
+
+// segmentTypes are the content types of the files of renditions.
+var segmentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+	".mp4":  "video/mp4",
+}
+
+// streamHandler streams a video of the user: the HLS playlist of its
+// rendition once it is ready, otherwise an MP4 original, in ranges if
+// asked. The segments the playlist lists are served by segmentHandler,
+// relative to it.
+func (f *Files) streamHandler(c *fiber.Ctx) error {
+	file, err := f.owned(c)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(file.ContentType, "video/") {
+		return fiber.ErrNotFound
+	}
+	if file.Video != nil && file.Video.Status == Ready {
+		return f.sendPlaylist(c, file)
+	}
+	if file.ContentType != "video/mp4" {
+		return fiber.NewError(fiber.StatusConflict, "video is still being transcoded")
+	}
+	return f.sendRange(c, file)
+}
+
+func (f *Files) segmentHandler(c *fiber.Ctx) error {
+	file, err := f.owned(c)
+	if err != nil {
+		return err
+	}
+	key := MediaPrefix + "/" + file.ID + "/" + c.Params("segment")
+	contentType, known := segmentTypes[path.Ext(key)]
+	if !known || !slices.Contains(file.renditions, key) {
+		return fiber.ErrNotFound
+	}
+	src, err := f.uploads.Storage().Open(c.UserContext(), key)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, privateImmutable)
+	return c.SendStream(src)
+}
+
+// sendPlaylist sends the playlist of the rendition of file with the
+// segments made relative to the stream URL, where segmentHandler serves
+// them.
+func (f *Files) sendPlaylist(c *fiber.Ctx, file File) error {
+	etag := `"` + file.ID + `-hls"`
+	c.Set(fiber.HeaderCacheControl, privateImmutable)
+	c.Set(fiber.HeaderETag, etag)
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	src, err := f.uploads.Storage().Open(c.UserContext(), MediaPrefix+"/"+file.ID+"/"+transcode.Playlist)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	var playlist bytes.Buffer
+	lines := bufio.NewScanner(src)
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			line = "stream/" + path.Base(line)
+		}
+		playlist.WriteString(line + "\n")
+	}
+	if err := lines.Err(); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, segmentTypes[".m3u8"])
+	return c.Send(playlist.Bytes())
+}
+
+// sendRange sends the stored original of file, or the single range of it
+// the Range header asks for. Other ranges, several at once included, get
+// the whole file, as RFC 9110 allows.
+func (f *Files) sendRange(c *fiber.Ctx, file File) error {
+	etag := `"` + file.ID + `"`
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderCacheControl, privateDay)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderContentType, file.ContentType)
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	start, end, ok := parseRange(c.Get(fiber.HeaderRange), file.Size)
+	if !ok {
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", file.Size))
+		return fiber.NewError(fiber.StatusRequestedRangeNotSatisfiable)
+	}
+	src, err := f.uploads.Storage().Open(c.UserContext(), file.key)
+	if err != nil {
+		return err
+	}
+	if start == 0 && end == file.Size-1 {
+		return c.SendStream(src, int(file.Size))
+	}
+	if seeker, ok := src.(io.Seeker); ok {
+		_, err = seeker.Seek(start, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, src, start)
+	}
+	if err != nil {
+		src.Close()
+		return err
+	}
+	c.Status(fiber.StatusPartialContent)
+	c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, file.Size))
+	length := end - start + 1
+	return c.SendStream(struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(src, length), src}, int(length))
+}
+
+// parseRange reads a Range header of a single range of bytes of a file of
+// size bytes, bytes=0-99, bytes=100- or bytes=-100, as the first and last
+// byte it asks for. No header, or one it doesn't understand, means the
+// whole file; ok is false for a range past the end.
+func parseRange(header string, size int64) (start, end int64, ok bool) {
+	whole := func() (int64, int64, bool) { return 0, size - 1, true }
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return whole()
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return whole()
+	}
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return whole()
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false
+		}
+		return max(size-n, 0), size - 1, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return whole()
+	}
+	end = size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return whole()
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// owned returns the available file of the id parameter if it is the
+// user's, and fiber.ErrNotFound otherwise.
+func (f *Files) owned(c *fiber.Ctx) (File, error) {
+	file, ok, err := f.get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return File{}, err
+	}
+	if !ok || file.Status != Available || file.userID != ctxutil.CurrentUser(c) {
+		return File{}, fiber.ErrNotFound
+	}
+	return file, nil
+}
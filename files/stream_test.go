@@ -0,0 +1,85 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamMP4(t *testing.T) {
+	app, _, _ := newApp(t)
+	alice := testkit.WithHeader("X-User", "alice")
+	video := uploadFile(t, app, "alice", "clip.mp4", mp4)
+	url := "/media/" + video.ID + "/stream"
+
+	testkit.Do(t, app, "GET", url, nil, alice).AssertStatus(200).
+		AssertHeader("Content-Type", "video/mp4").
+		AssertHeader("Accept-Ranges", "bytes").
+		AssertHeader("Cache-Control", "private, max-age=86400").
+		AssertBody(mp4)
+	testkit.Do(t, app, "GET", url, nil, alice, testkit.WithHeader("Range", "bytes=4-11")).AssertStatus(206).
+		AssertHeader("Content-Range", "bytes 4-11/24").
+		AssertBody("ftypmp42")
+	testkit.Do(t, app, "GET", url, nil, alice, testkit.WithHeader("Range", "bytes=-4")).AssertStatus(206).
+		AssertHeader("Content-Range", "bytes 20-23/24").
+		AssertBody("isom")
+	testkit.Do(t, app, "GET", url, nil, alice, testkit.WithHeader("Range", "bytes=24-")).AssertStatus(416).
+		AssertHeader("Content-Range", "bytes */24")
+	testkit.Do(t, app, "GET", url, nil, alice, testkit.WithHeader("If-None-Match", `"`+video.ID+`"`)).AssertStatus(304)
+
+	testkit.Do(t, app, "GET", url, nil, testkit.WithHeader("X-User", "bob")).AssertStatus(404)
+	notes := uploadFile(t, app, "alice", "notes.txt", "catatan")
+	testkit.Do(t, app, "GET", "/media/"+notes.ID+"/stream", nil, alice).AssertStatus(404)
+	testkit.Do(t, app, "GET", "/media/missing/stream", nil, alice).AssertStatus(404)
+}
+
+func TestStreamHLS(t *testing.T) {
+	app, files, _ := newApp(t)
+	alice := testkit.WithHeader("X-User", "alice")
+	files.UseTranscoder(transcoder(func(ctx context.Context, src, dir string) error {
+		os.WriteFile(filepath.Join(dir, "segment000.ts"), []byte("ts"), 0o644)
+		return os.WriteFile(filepath.Join(dir, "index.m3u8"), []byte("#EXTM3U\n#EXTINF:6.0,\nsegment000.ts\n#EXT-X-ENDLIST\n"), 0o644)
+	}))
+	// Not an MP4, so there is nothing to play until it is transcoded.
+	webm := uploadFile(t, app, "alice", "clip.webm", "\x1a\x45\xdf\xa3")
+	assert.Equal(t, "video/webm", webm.ContentType)
+	url := "/media/" + webm.ID + "/stream"
+	assert.Eventually(t, func() bool {
+		return testkit.Do(t, app, "GET", url, nil, alice).StatusCode == 200
+	}, time.Second, 10*time.Millisecond)
+
+	testkit.Do(t, app, "GET", url, nil, alice).AssertStatus(200).
+		AssertHeader("Content-Type", "application/vnd.apple.mpegurl").
+		AssertHeader("Cache-Control", "private, max-age=31536000, immutable").
+		AssertBody("#EXTM3U\n#EXTINF:6.0,\nstream/segment000.ts\n#EXT-X-ENDLIST\n")
+	testkit.Do(t, app, "GET", url+"/segment000.ts", nil, alice).AssertStatus(200).
+		AssertHeader("Content-Type", "video/mp2t").
+		AssertBody("ts")
+	testkit.Do(t, app, "GET", url+"/segment001.ts", nil, alice).AssertStatus(404)
+	testkit.Do(t, app, "GET", url+"/segment000.ts", nil, testkit.WithHeader("X-User", "bob")).AssertStatus(404)
+}
+
+func TestParseRange(t *testing.T) {
+	for header, want := range map[string][3]int64{
+		"":              {0, 99, 1},
+		"bytes=0-0":     {0, 0, 1},
+		"bytes=10-":     {10, 99, 1},
+		"bytes=90-200":  {90, 99, 1},
+		"bytes=-10":     {90, 99, 1},
+		"bytes=-200":    {0, 99, 1},
+		"bytes=100-":    {0, 0, 0},
+		"bytes=-0":      {0, 0, 0},
+		"bytes=0-1,5-6": {0, 99, 1},
+		"bytes=5-1":     {0, 99, 1},
+		"items=0-1":     {0, 99, 1},
+		"bytes=x-":      {0, 99, 1},
+	} {
+		start, end, ok := parseRange(header, 100)
+		assert.Equal(t, want, [3]int64{start, end, map[bool]int64{true: 1}[ok]}, header)
+	}
+}
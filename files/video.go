@@ -0,0 +1,148 @@
+package files
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/jobs"
+	"github.com/jalal-akbar/belajar-golang-fiber/transcode"
+)
+
+// Statuses of the transcoding of videos.
+const (
+	Processing = "processing"
+	Ready      = "ready"
+	Failed     = "failed"
+)
+
+// Video is how the transcoding of a video is going. Playlist is the URL
+// of its HLS playlist once it is ready, as streamHandler sends it.
+type Video struct {
+	Status   string `json:"status"`
+	Playlist string `json:"playlist,omitempty"`
+}
+
+// UseTranscoder has videos uploaded from now on transcoded by transcoder.
+// Call it before the first upload.
+func (f *Files) UseTranscoder(transcoder transcode.Transcoder) {
+	f.transcoder = transcoder
+}
+
+func (f *Files) transcodes(file File) bool {
+	return f.transcoder != nil && strings.HasPrefix(file.ContentType, "video/")
+}
+
+// transcodeLater queues the transcoding of the file id, which must be
+// processing already.
+func (f *Files) transcodeLater(ctx context.Context, id string) {
+	if err := f.queue.Enqueue(ctx, JobTranscode, map[string]string{"id": id}); err != nil {
+		f.logger.ErrorContext(ctx, "queueing transcoding failed", slog.String("file", id), slog.String("error", err.Error()))
+		if _, err := f.transcoded(ctx, id, &Video{Status: Failed}, nil); err != nil {
+			f.logger.ErrorContext(ctx, "recording the failed transcoding failed", slog.String("file", id), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// transcode transcodes a video in a temporary directory and stores the
+// rendition under MediaPrefix. A video the transcoder fails on is marked
+// failed for good; failing to read or store it has the job tried again.
+//
+// Transcoding takes longer than jobs usually may, so it is bounded by the
+// transcoder's own timeout instead.
+func (f *Files) transcode(ctx context.Context, job jobs.Job) error {
+	id := job.Payload["id"]
+	file, ok, err := f.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok || file.Video == nil || file.Video.Status != Processing {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "transcode-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "source")
+	if err := f.download(ctx, file.key, src); err != nil {
+		return err
+	}
+	out := filepath.Join(dir, "hls")
+	if err := os.Mkdir(out, 0o755); err != nil {
+		return err
+	}
+	if err := f.transcoder.Transcode(context.WithoutCancel(ctx), src, out); err != nil {
+		f.logger.WarnContext(ctx, "transcoding failed", slog.String("file", id), slog.String("error", err.Error()))
+		_, err := f.transcoded(ctx, id, &Video{Status: Failed}, nil)
+		return err
+	}
+
+	storage := f.uploads.Storage()
+	entries, err := os.ReadDir(out)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for _, entry := range entries {
+		key := MediaPrefix + "/" + id + "/" + entry.Name()
+		if err := f.upload(ctx, filepath.Join(out, entry.Name()), key); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	video := &Video{Status: Ready, Playlist: "/api/media/" + id + "/stream"}
+	ok, err = f.transcoded(ctx, id, video, keys)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// Deleted meanwhile.
+		for _, key := range keys {
+			storage.Delete(ctx, key)
+		}
+	}
+	return nil
+}
+
+// transcoded records how the transcoding of the file id ended, unless
+// the file is gone.
+func (f *Files) transcoded(ctx context.Context, id string, video *Video, renditions []string) (bool, error) {
+	_, ok, err := f.update(ctx, id, func(file *File) bool {
+		file.Video = video
+		file.renditions = renditions
+		return true
+	})
+	return ok, err
+}
+
+// download copies the stored file key to the local file path.
+func (f *Files) download(ctx context.Context, key, path string) error {
+	src, err := f.uploads.Storage().Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func (f *Files) upload(ctx context.Context, path, key string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return f.uploads.Storage().Put(ctx, key, src)
+}
@@ -0,0 +1,70 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+// mp4 is the start of an MP4 file, enough to be sniffed as one.
+const mp4 = "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"
+
+type transcoder func(ctx context.Context, src, dir string) error
+
+func (t transcoder) Transcode(ctx context.Context, src, dir string) error {
+	return t(ctx, src, dir)
+}
+
+func TestTranscode(t *testing.T) {
+	app, files, dir := newApp(t)
+	alice := testkit.WithHeader("X-User", "alice")
+	files.UseTranscoder(transcoder(func(ctx context.Context, src, dir string) error {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if string(data) != mp4 {
+			return errors.New("not a video")
+		}
+		os.WriteFile(filepath.Join(dir, "segment000.ts"), []byte("ts"), 0o644)
+		return os.WriteFile(filepath.Join(dir, "index.m3u8"), []byte("#EXTM3U\n"), 0o644)
+	}))
+	get := func(id string) File {
+		var file File
+		testkit.Do(t, app, "GET", "/files/"+id, nil, alice).AssertStatus(200).JSON(&file)
+		return file
+	}
+
+	video := uploadFile(t, app, "alice", "clip.mp4", mp4)
+	assert.Equal(t, "video/mp4", video.ContentType)
+	assert.Equal(t, &Video{Status: Processing}, video.Video)
+	assert.Eventually(t, func() bool { return get(video.ID).Video.Status == Ready }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "/api/media/"+video.ID+"/stream", get(video.ID).Video.Playlist)
+	segment := filepath.Join(dir, "media", video.ID, "segment000.ts")
+	_, err := os.Stat(segment)
+	assert.Nil(t, err)
+	assert.True(t, files.Live("media/"+video.ID+"/segment000.ts"))
+	assert.False(t, files.Live("media/"+video.ID+"/segment001.ts"))
+
+	notes := uploadFile(t, app, "alice", "notes.txt", "catatan")
+	assert.Nil(t, notes.Video)
+
+	// Not quite a video, after all.
+	broken := uploadFile(t, app, "alice", "broken.mp4", mp4+"\x00")
+	assert.Eventually(t, func() bool { return get(broken.ID).Video.Status == Failed }, time.Second, 10*time.Millisecond)
+	assert.Empty(t, get(broken.ID).Video.Playlist)
+
+	// Deleting removes the rendition too.
+	testkit.Do(t, app, "DELETE", "/files?ids="+video.ID, nil, alice).AssertStatus(200)
+	assert.False(t, files.Live("media/"+video.ID+"/segment000.ts"))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(segment)
+		return os.IsNotExist(err)
+	}, time.Second, 10*time.Millisecond)
+}
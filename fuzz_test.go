@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+// The fuzz targets throw malformed input at the handlers of the app newApp
+// builds, which must answer it with a 4xx, never a 5xx or a panic. Run one
+// with
+//
+//	go test -run '^$' -fuzz FuzzCreateOrder -fuzztime 30s
+//
+// The seeds run as part of go test.
+
+// send checks the status app answers request with is a 2xx, 3xx or 4xx.
+// Requests fasthttp can't read, such as truncated multipart bodies, never
+// reach the handlers: fasthttp answers them with a 400 itself and app.Test
+// reports the error.
+func send(t *testing.T, app *fiber.App, request *http.Request) {
+	t.Helper()
+	response, err := app.Test(request)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "test: timeout") || strings.Contains(err.Error(), "panic") {
+			t.Fatal(err)
+		}
+		return
+	}
+	body, _ := io.ReadAll(response.Body)
+	assert.Less(t, response.StatusCode, 500, "status %d: %s", response.StatusCode, body)
+}
+
+func post(path, contentType, token string, body io.Reader) *http.Request {
+	request := httptest.NewRequest("POST", path, body)
+	request.Header.Set(fiber.HeaderContentType, contentType)
+	request.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	return request
+}
+
+// fuzzApp returns the app, logged in to with the IdP of services, and an
+// access token of alice's.
+func fuzzApp(f *testing.F, services *testkit.Services, configure func(cfg *config.Config)) (*fiber.App, string) {
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.JWT.KeyFiles = []string{writeJWTKey(f)}
+	cfg.Database.SQLitePath = ":memory:"
+	cfg.RateLimit.Rules = nil
+	if configure != nil {
+		configure(cfg)
+	}
+	services.Configure(cfg)
+	app, err := newApp(cfg)
+	if !assert.Nil(f, err) {
+		f.FailNow()
+	}
+	return app, services.IdP().Token("alice", map[string]any{"scope": strings.Join(userScopes, " ")})
+}
+
+func FuzzCreateOrder(f *testing.F) {
+	f.Add(fiber.MIMEApplicationJSON, []byte(`{"items":[{"sku":"kopi","quantity":2,"price":15000}],"currency":"IDR"}`))
+	f.Add(fiber.MIMEApplicationJSON, []byte(`{"items":[{"sku":"kopi","quantity":1,"price":"2.25"}],"currency":"USD"}`))
+	f.Add(fiber.MIMEApplicationJSON, []byte(`{"items":[{"sku":"kopi","quantity":1,"price":0.105}],"currency":"USD"}`))
+	f.Add(fiber.MIMEApplicationJSON, []byte(`{"items":[{"sku":"kopi","quantity":-1,"price":1e400}]}`))
+	f.Add(fiber.MIMEApplicationJSON, []byte(`{"items":[{"sku":"kopi","quantity":9223372036854775807,"price":9223372036854775807}]}`))
+	f.Add(fiber.MIMEApplicationJSON, []byte(`{"items":null,"currency":"XYZ"}`))
+	f.Add(fiber.MIMEApplicationJSON, []byte(`{"items":[{"sku":`))
+	f.Add(fiber.MIMEApplicationXML, []byte(`<order><items><sku>kopi</sku></items></order>`))
+	f.Add(fiber.MIMEApplicationForm, []byte(`items[0][sku]=kopi&items[0][=x`))
+	f.Add("text/plain", []byte("kopi"))
+
+	app, token := fuzzApp(f, testkit.NewServices(f), nil)
+	f.Fuzz(func(t *testing.T, contentType string, body []byte) {
+		send(t, app, post("/api/orders", contentType, token, bytes.NewReader(body)))
+	})
+}
+
+// FuzzUploadFile sends a well-formed form with a fuzzed file name and
+// contents, then the body as a form of its own, and checks no file ends
+// up outside the upload directory.
+func FuzzUploadFile(f *testing.F) {
+	f.Add("contoh.txt", []byte("this is sample"), []byte("--x\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\nhello\r\n--x--\r\n"))
+	f.Add("../../escape.txt", []byte("<script>alert(1)</script>"), []byte("--x\r\nContent-Disposition: form-data; name=\"file\"; filename=\"../../b.txt\"\r\n\r\nhello\r\n--x--\r\n"))
+	f.Add("..", []byte("\x89PNG\r\n\x1a\n"), []byte("--x\r\nContent-Disposition: form-data; name=\"file\"; filename=\"..\"\r\n\r\n"))
+	f.Add("/etc/passwd", []byte{}, []byte("--x\r\nContent-Disposition: form-data; name=\"file\"\r\n\r\nno file\r\n--x--\r\n"))
+	f.Add("", []byte("GIF89a"), []byte("not a form"))
+
+	root := f.TempDir()
+	dir := filepath.Join(root, "uploads")
+	assert.Nil(f, os.Mkdir(dir, 0o755))
+	app, token := fuzzApp(f, testkit.NewServices(f), func(cfg *config.Config) { cfg.Uploads.Dir = dir })
+
+	f.Fuzz(func(t *testing.T, filename string, contents, raw []byte) {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("file", filename)
+		assert.Nil(t, err)
+		part.Write(contents)
+		writer.Close()
+		send(t, app, post("/api/files", writer.FormDataContentType(), token, body))
+		send(t, app, post("/api/files", fiber.MIMEMultipartForm+"; boundary=x", token, bytes.NewReader(raw)))
+
+		filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if path != root && path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+				t.Errorf("%s written outside %s", path, dir)
+			}
+			return err
+		})
+	})
+}
+
+// FuzzOIDCCallback sends the provider's redirect back with a fuzzed
+// state, code, error and login cookie, seeded from a real login.
+func FuzzOIDCCallback(f *testing.F) {
+	services := testkit.NewServices(f)
+	idp := services.IdP()
+	app, _ := fuzzApp(f, services, nil)
+
+	login := testkit.Do(f, app, "GET", "/auth/oidc/login", nil).AssertStatus(302)
+	cookie := login.Cookie("oidc_login").Value
+	callback, err := url.Parse(idp.Login(login.Header.Get("Location"), "alice", nil))
+	if !assert.Nil(f, err) {
+		f.FailNow()
+	}
+	query := callback.Query()
+	state, code := query.Get("state"), query.Get("code")
+	f.Add(state, code, "", cookie)
+	f.Add(state, code, "access_denied", cookie)
+	f.Add(state, "", "", cookie)
+	f.Add("", code, "", cookie)
+	f.Add(state, code, "", "")
+	f.Add(state, code, "", "not base64!")
+	f.Add(state, code, "", "e30")
+
+	f.Fuzz(func(t *testing.T, state, code, reason, cookie string) {
+		query := url.Values{"state": {state}, "code": {code}}
+		if reason != "" {
+			query.Set("error", reason)
+		}
+		request := httptest.NewRequest("GET", "/auth/oidc/callback?"+query.Encode(), nil)
+		request.Header.Set("Cookie", "oidc_login="+cookie)
+		send(t, app, request)
+	})
+}
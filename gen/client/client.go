@@ -0,0 +1,168 @@
+// Package client calls the API from Go. Its types and methods, in
+// client.gen.go, are generated from openapi/openapi.yaml; this file is
+// what they build on: sending requests with the caller's token and
+// turning error responses into *Error.
+//
+//	c := client.New("https://shop.example", client.WithToken(token))
+//	order, err := c.GetOrder(ctx, "1001")
+//	if errors.Is(err, client.ErrNotFound) {
+package client
+
+//go:generate go run ../../openapi/generate -spec ../../openapi/openapi.yaml -out client.gen.go -package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Doer sends requests. *http.Client implements it; tests pass an adapter
+// for a *fiber.App.
+type Doer interface {
+	Do(request *http.Request) (*http.Response, error)
+}
+
+// Client calls the API at a base URL.
+type Client struct {
+	baseURL   string
+	doer      Doer
+	token     func(ctx context.Context) (string, error)
+	userAgent string
+}
+
+type Option func(c *Client)
+
+// WithHTTPClient sends requests with doer instead of http.DefaultClient.
+func WithHTTPClient(doer Doer) Option {
+	return func(c *Client) { c.doer = doer }
+}
+
+// WithToken sends token as a bearer token to the operations that need
+// one.
+func WithToken(token string) Option {
+	return WithTokenSource(func(context.Context) (string, error) { return token, nil })
+}
+
+// WithTokenSource asks source for the bearer token of each call, for
+// tokens that are refreshed.
+func WithTokenSource(source func(ctx context.Context) (string, error)) Option {
+	return func(c *Client) { c.token = source }
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), doer: http.DefaultClient, userAgent: "belajar-golang-fiber-client"}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// The errors an *Error is, by its status, for errors.Is.
+var (
+	ErrBadRequest   = errors.New("client: bad request")
+	ErrUnauthorized = errors.New("client: unauthorized")
+	ErrForbidden    = errors.New("client: forbidden")
+	ErrNotFound     = errors.New("client: not found")
+	ErrConflict     = errors.New("client: conflict")
+	ErrInvalid      = errors.New("client: invalid")
+	ErrRateLimited  = errors.New("client: rate limited")
+	ErrServer       = errors.New("client: server error")
+)
+
+// Error is a response with a status other than the operation's success.
+// Message is its body, which the API writes in plain text.
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("client: %s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return target == ErrBadRequest
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	case http.StatusUnprocessableEntity:
+		return target == ErrInvalid
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	}
+	return e.StatusCode >= 500 && target == ErrServer
+}
+
+// call is what generated methods describe their request with.
+type call struct {
+	method  string
+	path    string
+	body    interface{}
+	out     interface{}
+	success int
+	auth    bool
+}
+
+// do sends the request of call, decoding a response with its success
+// status into out and returning an *Error for any other.
+func (c *Client) do(ctx context.Context, call call) error {
+	var body io.Reader
+	if call.body != nil {
+		data, err := json.Marshal(call.body)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, call.method, c.baseURL+call.path, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("User-Agent", c.userAgent)
+	if call.body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if call.auth && c.token != nil {
+		token, err := c.token(ctx)
+		if err != nil {
+			return fmt.Errorf("client: getting a token: %w", err)
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := c.doer.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != call.success {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return &Error{Method: call.method, Path: call.path, StatusCode: response.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if call.out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(call.out); err != nil {
+		return fmt.Errorf("client: %s %s: decoding the response: %w", call.method, call.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if c.Get("Authorization") != "Bearer secret" {
+			return fiber.ErrUnauthorized
+		}
+		return c.Next()
+	})
+	app.Get("/api/orders/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") != "1001" {
+			return fiber.NewError(fiber.StatusNotFound, "no order "+c.Params("id"))
+		}
+		return c.SendString(`{"id":"1001","status":"paid","items":[{"sku":"kopi","quantity":2,"price":{"amount":"15000.50","currency":"IDR"}}],"amount":{"amount":"30001.00","currency":"IDR"},"currency":"IDR"}`)
+	})
+	app.Post("/api/orders", func(c *fiber.Ctx) error {
+		var order NewOrder
+		if err := c.BodyParser(&order); err != nil {
+			return err
+		}
+		item := order.Items[0]
+		return c.Status(fiber.StatusCreated).JSON(Order{
+			Items:    []Item{{SKU: item.SKU, Quantity: item.Quantity, Price: Money{Amount: item.Price.String() + ".00", Currency: "IDR"}}},
+			Currency: "IDR",
+		})
+	})
+	app.Put("/api/orders/:id/status", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusConflict, "order is delivered and can't become paid")
+	})
+	doer := &http.Client{Transport: testkit.Transport(app)}
+	c := New("http://shop.example/", WithHTTPClient(doer), WithToken("secret"))
+	ctx := context.Background()
+
+	order, err := c.GetOrder(ctx, "1001")
+	assert.Nil(t, err)
+	assert.Equal(t, StatusPaid, order.Status)
+	assert.Equal(t, Money{Amount: "30001.00", Currency: "IDR"}, order.Amount)
+	assert.Equal(t, "15000.50", order.Items[0].Price.Amount)
+
+	created, err := c.CreateOrder(ctx, NewOrder{Items: []NewItem{{SKU: "kopi", Quantity: 1, Price: "15000"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, "15000.00", created.Items[0].Price.Amount)
+
+	_, err = c.GetOrder(ctx, "a/b")
+	assert.ErrorIs(t, err, ErrNotFound)
+	var apiErr *Error
+	assert.True(t, errors.As(err, &apiErr))
+	// Escaped, the ID stays one path segment.
+	assert.Equal(t, "no order a%2Fb", apiErr.Message)
+	assert.Equal(t, "/api/orders/a%2Fb", apiErr.Path)
+
+	_, err = c.SetOrderStatus(ctx, "1001", StatusChange{Status: StatusPaid})
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.EqualError(t, err, "client: PUT /api/orders/1001/status: 409 order is delivered and can't become paid")
+
+	_, err = New("http://shop.example", WithHTTPClient(doer)).ListOrders(ctx)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.False(t, errors.Is(err, ErrServer))
+
+	failing := New("http://shop.example", WithHTTPClient(doer), WithTokenSource(func(context.Context) (string, error) {
+		return "", errors.New("token expired")
+	}))
+	_, err = failing.ListOrders(ctx)
+	assert.EqualError(t, err, "client: getting a token: token expired")
+}
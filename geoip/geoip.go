@@ -0,0 +1,81 @@
+package geoip
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/middleware"
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Location is where a client address is registered. Country is the ISO
+// 3166-1 alpha-2 code.
+type Location struct {
+	Country string `json:"country"`
+	City    string `json:"city,omitempty"`
+}
+
+type Locator interface {
+	Locate(ip net.IP) (Location, error)
+}
+
+// Reader locates addresses in a MaxMind GeoIP2 or GeoLite2 City database.
+type Reader struct {
+	db *geoip2.Reader
+}
+
+func Open(path string) (*Reader, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+func (r *Reader) Locate(ip net.IP) (Location, error) {
+	record, err := r.db.City(ip)
+	if err != nil {
+		return Location{}, err
+	}
+	return Location{Country: record.Country.IsoCode, City: record.City.Names["en"]}, nil
+}
+
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
+
+var locationKey = ctxutil.NewKey[Location]("location")
+
+// Middleware stores the location of middleware.RealIP in c.Locals and
+// rejects requests from the blocked countries with 403. Addresses the
+// database doesn't know, like private ones, pass through without a location.
+func Middleware(locator Locator, blockedCountries []string) fiber.Handler {
+	blocked := make(map[string]bool, len(blockedCountries))
+	for _, country := range blockedCountries {
+		blocked[strings.ToUpper(country)] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		ip := net.ParseIP(middleware.RealIP(c))
+		if ip == nil {
+			return c.Next()
+		}
+		location, err := locator.Locate(ip)
+		if err != nil || location.Country == "" {
+			return c.Next()
+		}
+		locationKey.Set(c, location)
+		if blocked[location.Country] {
+			return fiber.NewError(fiber.StatusForbidden, "access from your country is not allowed")
+		}
+		return c.Next()
+	}
+}
+
+// From returns the location stored by Middleware.
+func From(c *fiber.Ctx) (Location, bool) {
+	location, ok := locationKey.Get(c)
+	return location, ok
+}
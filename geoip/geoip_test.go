@@ -0,0 +1,65 @@
+package geoip
+
+import (
+	"io"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticLocator map[string]Location
+
+func (l staticLocator) Locate(ip net.IP) (Location, error) {
+	return l[ip.String()], nil
+}
+
+func TestMiddleware(t *testing.T) {
+	locator := staticLocator{"0.0.0.0": {Country: "ID", City: "Jakarta"}}
+	app := fiber.New()
+	app.Use(Middleware(locator, nil))
+	app.Get("/", func(c *fiber.Ctx) error {
+		location, ok := From(c)
+		assert.True(t, ok)
+		return c.JSON(location)
+	})
+
+	response, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"country":"ID","city":"Jakarta"}`, string(body))
+}
+
+func TestMiddlewareBlocksCountries(t *testing.T) {
+	app := fiber.New()
+	app.Use(Middleware(staticLocator{"0.0.0.0": {Country: "KP"}}, []string{"kp"}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	response, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 403, response.StatusCode)
+
+	app = fiber.New()
+	app.Use(Middleware(staticLocator{}, []string{"KP"}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		_, ok := From(c)
+		assert.False(t, ok)
+		return c.SendString("ok")
+	})
+	response, err = app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+}
+
+func TestOpenMissingDatabase(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "GeoLite2-City.mmdb"))
+	assert.NotNil(t, err)
+}
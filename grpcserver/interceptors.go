@@ -0,0 +1,248 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/reporting"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// public are the prefixes of the methods callable without a token: load
+// balancers and grpcurl don't have one.
+var public = []string{"/grpc.health.v1.Health/", "/grpc.reflection."}
+
+type claimsKey struct{}
+
+// ClaimsFrom returns the claims of the token the call was authenticated
+// with, or nil.
+func ClaimsFrom(ctx context.Context) *auth.Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*auth.Claims)
+	return claims
+}
+
+// serverErrors are the codes logged as errors, the 5xx of gRPC.
+var serverErrors = map[codes.Code]bool{
+	codes.Unknown:     true,
+	codes.Internal:    true,
+	codes.DataLoss:    true,
+	codes.Unavailable: true,
+}
+
+// withCorrelation is logging.Middleware's request and correlation IDs, read
+// from and sent back as metadata.
+func withCorrelation(ctx context.Context) context.Context {
+	incoming, _ := metadata.FromIncomingContext(ctx)
+	md := correlation.Metadata{}
+	for _, name := range []string{correlation.HeaderRequestID, correlation.HeaderCorrelationID, "traceparent", "tracestate", "baggage"} {
+		if values := incoming.Get(name); len(values) > 0 && values[0] != "" {
+			md[name] = values[0]
+		}
+	}
+	if md[correlation.HeaderRequestID] == "" {
+		md[correlation.HeaderRequestID] = utils.UUIDv4()
+	}
+	if md[correlation.HeaderCorrelationID] == "" {
+		md[correlation.HeaderCorrelationID] = md[correlation.HeaderRequestID]
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(
+		correlation.HeaderRequestID, md[correlation.HeaderRequestID],
+		correlation.HeaderCorrelationID, md[correlation.HeaderCorrelationID]))
+	return correlation.With(ctx, md)
+}
+
+func logCall(ctx context.Context, logger *slog.Logger, method string, start time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	if serverErrors[code] {
+		level = slog.LevelError
+	}
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("latency", time.Since(start)),
+		slog.String("ip", peerIP(ctx)),
+	}
+	logger.LogAttrs(ctx, level, "rpc", attrs...)
+}
+
+func unaryLogging(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx = withCorrelation(ctx)
+		resp, err := handler(ctx, req)
+		logCall(ctx, logger, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+func streamLogging(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := withCorrelation(stream.Context())
+		err := handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+		logCall(ctx, logger, info.FullMethod, start, err)
+		return err
+	}
+}
+
+// callMetrics are the gRPC counterparts of metrics.HTTP, labelled by full
+// method name and status code.
+type callMetrics struct {
+	handled  *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func newCallMetrics(r *metrics.Registry) *callMetrics {
+	return &callMetrics{
+		handled:  r.Counter("grpc_server_handled_total", "gRPC calls handled.", "method", "code"),
+		duration: r.Histogram("grpc_server_handling_seconds", "gRPC call latency.", metrics.DefaultBuckets, "method"),
+	}
+}
+
+func (m *callMetrics) observe(method string, start time.Time, err error) {
+	m.handled.With(method, status.Code(err).String()).Inc()
+	m.duration.With(method).Observe(time.Since(start).Seconds())
+}
+
+func (m *callMetrics) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	m.observe(info.FullMethod, start, err)
+	return resp, err
+}
+
+func (m *callMetrics) stream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, stream)
+	m.observe(info.FullMethod, start, err)
+	return err
+}
+
+// recovered reports a panic of a call like reporting.Recover does and
+// turns it into an Internal error.
+func recovered(ctx context.Context, reporter reporting.Reporter, method string, r interface{}) error {
+	panicErr, ok := r.(error)
+	if !ok {
+		panicErr = fmt.Errorf("%v", r)
+	}
+	// The stack skips this function, the deferred call and runtime.gopanic.
+	event := reporting.Event{
+		Time:      time.Now(),
+		Err:       fmt.Errorf("panic: %w", panicErr),
+		Stack:     reporting.Stack(3),
+		Method:    "POST",
+		URL:       method,
+		Route:     method,
+		RequestID: correlation.RequestID(ctx),
+		Headers:   map[string]string{},
+	}
+	reporter.Report(ctx, event)
+	return status.Error(codes.Internal, "internal error")
+}
+
+func unaryRecovery(reporter reporting.Reporter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ctx, reporter, info.FullMethod, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func streamRecovery(reporter reporting.Reporter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(stream.Context(), reporter, info.FullMethod, r)
+			}
+		}()
+		return handler(srv, stream)
+	}
+}
+
+// authenticate is auth's Middleware for calls: it needs an "authorization:
+// Bearer <token>" metadata entry, and stores the token's claims in the
+// context for ClaimsFrom.
+func authenticate(ctx context.Context, tokens Authenticator, method string) (context.Context, error) {
+	if tokens == nil {
+		return ctx, nil
+	}
+	for _, prefix := range public {
+		if strings.HasPrefix(method, prefix) {
+			return ctx, nil
+		}
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if values := md.Get("authorization"); len(values) > 0 {
+		scheme, value, _ := strings.Cut(values[0], " ")
+		if strings.EqualFold(scheme, "bearer") {
+			token = value
+		}
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	claims, err := tokens.Authenticate(ctx, token, peerIP(ctx))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return context.WithValue(ctx, claimsKey{}, claims), nil
+}
+
+func unaryAuth(tokens Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, tokens, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamAuth(tokens Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), tokens, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// serverStream is a stream with the context an interceptor derived.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
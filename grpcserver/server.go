@@ -0,0 +1,130 @@
+// Package grpcserver is the gRPC companion of the HTTP server. It serves
+// the standard health (grpc.health.v1) and reflection services, and runs
+// every call through interceptors that mirror the HTTP middlewares:
+// correlation IDs and logging, metrics, panic recovery and bearer token
+// authentication.
+package grpcserver
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/reporting"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// Authenticator checks the bearer tokens of calls. *auth.Tokens
+// implements it.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token, ip string) (*auth.Claims, error)
+}
+
+// Options are what the interceptors log, count and report with. Without
+// Tokens calls aren't authenticated, like /api without JWT keys.
+type Options struct {
+	Logger   *slog.Logger
+	Registry *metrics.Registry
+	Reporter reporting.Reporter
+	Tokens   Authenticator
+}
+
+// Server is a gRPC server that reports itself not serving through the
+// health service until SetServing, and again once stopping.
+type Server struct {
+	addr     string
+	server   *grpc.Server
+	health   *health.Server
+	services []string
+	listener net.Listener
+}
+
+func New(cfg config.GRPCConfig, options Options) *Server {
+	calls := newCallMetrics(options.Registry)
+	s := &Server{
+		addr: cfg.Addr,
+		server: grpc.NewServer(
+			grpc.ChainUnaryInterceptor(
+				unaryLogging(options.Logger),
+				calls.unary,
+				unaryRecovery(options.Reporter),
+				unaryAuth(options.Tokens),
+			),
+			grpc.ChainStreamInterceptor(
+				streamLogging(options.Logger),
+				calls.stream,
+				streamRecovery(options.Reporter),
+				streamAuth(options.Tokens),
+			),
+		),
+		health: health.NewServer(),
+	}
+	healthpb.RegisterHealthServer(s.server, s.health)
+	if cfg.Reflection {
+		reflection.Register(s.server)
+	}
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	return s
+}
+
+// RegisterService registers a service like a generated Register function
+// would, and reports it in the health service along with the server.
+func (s *Server) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	s.server.RegisterService(desc, impl)
+	s.services = append(s.services, desc.ServiceName)
+	s.health.SetServingStatus(desc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// SetServing reports the server and its services serving or not in the
+// health service, as /readyz does for HTTP.
+func (s *Server) SetServing(serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	s.health.SetServingStatus("", status)
+	for _, service := range s.services {
+		s.health.SetServingStatus(service, status)
+	}
+}
+
+// Start listens on the configured address and serves in the background.
+func (s *Server) Start(context.Context) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	go s.server.Serve(listener)
+	return nil
+}
+
+// Addr is the address the server listens on once started.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Stop reports the server not serving, so health checking clients move
+// away, and waits for the calls in flight until ctx is done, then cancels
+// them.
+func (s *Server) Stop(ctx context.Context) error {
+	s.health.Shutdown()
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
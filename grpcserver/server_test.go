@@ -0,0 +1,151 @@
+package grpcserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/reporting"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type tokens map[string]string
+
+func (t tokens) Authenticate(_ context.Context, token, _ string) (*auth.Claims, error) {
+	subject, ok := t[token]
+	if !ok {
+		return nil, errors.New("unknown token")
+	}
+	return &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: subject}}, nil
+}
+
+type reports struct {
+	mu     sync.Mutex
+	events []reporting.Event
+}
+
+func (r *reports) Report(_ context.Context, event reporting.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// whoami is a service as protoc would generate it, with a method that
+// answers the caller's subject and one that panics.
+var whoami = &grpc.ServiceDesc{
+	ServiceName: "test.WhoAmI",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Get", Handler: func(_ interface{}, ctx context.Context, decode func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := &emptypb.Empty{}
+			if err := decode(in); err != nil {
+				return nil, err
+			}
+			return interceptor(ctx, in, &grpc.UnaryServerInfo{FullMethod: "/test.WhoAmI/Get"}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+				return wrapperspb.String(ClaimsFrom(ctx).Subject), nil
+			})
+		}},
+		{MethodName: "Panic", Handler: func(_ interface{}, ctx context.Context, decode func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := &emptypb.Empty{}
+			if err := decode(in); err != nil {
+				return nil, err
+			}
+			return interceptor(ctx, in, &grpc.UnaryServerInfo{FullMethod: "/test.WhoAmI/Panic"}, func(context.Context, interface{}) (interface{}, error) {
+				panic("boom")
+			})
+		}},
+	},
+}
+
+func TestServer(t *testing.T) {
+	var logs bytes.Buffer
+	registry := metrics.NewRegistry()
+	reported := &reports{}
+	server := New(config.GRPCConfig{Addr: "127.0.0.1:0", Reflection: true}, Options{
+		Logger:   slog.New(slog.NewTextHandler(&logs, nil)),
+		Registry: registry,
+		Reporter: reported,
+		Tokens:   tokens{"alice-token": "alice"},
+	})
+	server.RegisterService(whoami, nil)
+	assert.Nil(t, server.Start(context.Background()))
+
+	conn, err := grpc.NewClient(server.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+	ctx := context.Background()
+
+	// Health checks need no token, and fail until the app is ready.
+	health := healthpb.NewHealthClient(conn)
+	response, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: "test.WhoAmI"})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, response.Status)
+	server.SetServing(true)
+	response, err = health.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, response.Status)
+
+	// Neither does reflection.
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Send(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}}))
+	listed, err := stream.Recv()
+	assert.Nil(t, err)
+	var services []string
+	for _, service := range listed.GetListServicesResponse().Service {
+		services = append(services, service.Name)
+	}
+	assert.ElementsMatch(t, []string{"grpc.health.v1.Health", "grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection", "test.WhoAmI"}, services)
+	stream.CloseSend()
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+
+	name := &wrapperspb.StringValue{}
+	err = conn.Invoke(ctx, "/test.WhoAmI/Get", &emptypb.Empty{}, name)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	err = conn.Invoke(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer wrong"), "/test.WhoAmI/Get", &emptypb.Empty{}, name)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	var header metadata.MD
+	authorized := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer alice-token", "x-request-id", "req-1")
+	assert.Nil(t, conn.Invoke(authorized, "/test.WhoAmI/Get", &emptypb.Empty{}, name, grpc.Header(&header)))
+	assert.Equal(t, "alice", name.Value)
+	assert.Equal(t, []string{"req-1"}, header.Get("x-request-id"))
+	assert.Contains(t, logs.String(), `msg=rpc method=/test.WhoAmI/Get code=OK`)
+
+	// Panics are reported and answered like any internal error.
+	err = conn.Invoke(authorized, "/test.WhoAmI/Panic", &emptypb.Empty{}, name)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Len(t, reported.events, 1)
+	assert.Equal(t, "panic: boom", reported.events[0].Err.Error())
+	assert.Equal(t, "/test.WhoAmI/Panic", reported.events[0].Route)
+	// The innermost frame is the handler of whoami, a closure in a var.
+	stack := reported.events[0].Stack
+	assert.True(t, strings.HasPrefix(stack[len(stack)-1].Function, "github.com/jalal-akbar/belajar-golang-fiber/grpcserver.init."), stack[len(stack)-1].Function)
+	assert.Contains(t, logs.String(), `level=ERROR msg=rpc method=/test.WhoAmI/Panic code=Internal`)
+
+	handled := registry.Counter("grpc_server_handled_total", "", "method", "code")
+	assert.Equal(t, float64(1), handled.With("/test.WhoAmI/Get", "OK").Value())
+	assert.Equal(t, float64(2), handled.With("/test.WhoAmI/Get", "Unauthenticated").Value())
+	assert.Equal(t, float64(1), handled.With("/test.WhoAmI/Panic", "Internal").Value())
+
+	assert.Nil(t, server.Stop(ctx))
+}
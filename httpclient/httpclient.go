@@ -0,0 +1,152 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+)
+
+var ErrCircuitOpen = errors.New("httpclient: circuit open")
+
+type Client struct {
+	cfg  config.HTTPClientConfig
+	http *http.Client
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func New(cfg config.HTTPClientConfig) *Client {
+	return &Client{
+		cfg:      cfg,
+		http:     &http.Client{Timeout: cfg.Timeout},
+		breakers: map[string]*breaker{},
+	}
+}
+
+func (cl *Client) Get(ctx context.Context, url string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return cl.Do(request)
+}
+
+// Do sends the request with the correlation headers found in its context,
+// retrying failed idempotent requests with jittered exponential backoff.
+// Every attempt goes through the target host's circuit breaker, so a host
+// that keeps failing is short-circuited with ErrCircuitOpen instead of being
+// hammered.
+func (cl *Client) Do(request *http.Request) (*http.Response, error) {
+	correlation.Inject(request.Context(), request.Header)
+
+	b := cl.breaker(request.URL.Host)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if err := cl.wait(request.Context(), attempt); err != nil {
+				return nil, err
+			}
+			if request.GetBody != nil {
+				body, err := request.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				request.Body = body
+			}
+		}
+
+		if !b.allow() {
+			return nil, ErrCircuitOpen
+		}
+		response, err := cl.http.Do(request)
+		b.record(err == nil && response.StatusCode < 500)
+
+		if attempt >= cl.cfg.MaxRetries || !retryable(request, response, err) {
+			return response, err
+		}
+		if response != nil {
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+	}
+}
+
+// Guard lets a call to host through the host's circuit breaker, for callers
+// that send requests without Do, like the reverse proxy. It fails with
+// ErrCircuitOpen while the breaker is open; otherwise the caller reports
+// whether the call succeeded to done.
+func (cl *Client) Guard(host string) (done func(ok bool), err error) {
+	b := cl.breaker(host)
+	if !b.allow() {
+		return nil, ErrCircuitOpen
+	}
+	return b.record, nil
+}
+
+func (cl *Client) breaker(host string) *breaker {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	b, ok := cl.breakers[host]
+	if !ok {
+		b = &breaker{threshold: cl.cfg.BreakerThreshold, cooldown: cl.cfg.BreakerCooldown}
+		cl.breakers[host] = b
+	}
+	return b
+}
+
+// wait sleeps for a random duration up to base*2^(attempt-1), capped at the
+// configured maximum ("full jitter").
+func (cl *Client) wait(ctx context.Context, attempt int) error {
+	delay := cl.cfg.RetryBaseDelay << (attempt - 1)
+	if delay <= 0 || delay > cl.cfg.RetryMaxDelay {
+		delay = cl.cfg.RetryMaxDelay
+	}
+	if delay > 0 {
+		delay = time.Duration(rand.Int63n(int64(delay)))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func retryable(request *http.Request, response *http.Response, err error) bool {
+	if request.Context().Err() != nil {
+		return false
+	}
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		return false
+	}
+	if !idempotent(request) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func idempotent(request *http.Request) bool {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return request.Header.Get("Idempotency-Key") != ""
+}
@@ -0,0 +1,145 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/stretchr/testify/assert"
+)
+
+var testConfig = config.HTTPClientConfig{
+	Timeout:          time.Second,
+	MaxRetries:       2,
+	RetryBaseDelay:   time.Millisecond,
+	RetryMaxDelay:    5 * time.Millisecond,
+	BreakerThreshold: 3,
+	BreakerCooldown:  50 * time.Millisecond,
+}
+
+func flakyServer(failures int32, calls *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "OK")
+	}))
+}
+
+func TestRetryUntilSuccess(t *testing.T) {
+	var calls atomic.Int32
+	server := flakyServer(2, &calls)
+	defer server.Close()
+
+	response, err := New(testConfig).Get(context.Background(), server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRetryIsBounded(t *testing.T) {
+	var calls atomic.Int32
+	server := flakyServer(10, &calls)
+	defer server.Close()
+
+	response, err := New(testConfig).Get(context.Background(), server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, 503, response.StatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestNoRetryForPost(t *testing.T) {
+	var calls atomic.Int32
+	server := flakyServer(1, &calls)
+	defer server.Close()
+
+	request, err := http.NewRequest("POST", server.URL, strings.NewReader("name=Jalal"))
+	assert.Nil(t, err)
+	response, err := New(testConfig).Do(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 503, response.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRetryPostWithIdempotencyKey(t *testing.T) {
+	var calls atomic.Int32
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("POST", server.URL, strings.NewReader("name=Jalal"))
+	assert.Nil(t, err)
+	request.Header.Set("Idempotency-Key", "abc")
+	response, err := New(testConfig).Do(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, []string{"name=Jalal", "name=Jalal"}, bodies)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	server := flakyServer(3, &calls)
+	defer server.Close()
+
+	client := New(config.HTTPClientConfig{
+		Timeout:          time.Second,
+		BreakerThreshold: 3,
+		BreakerCooldown:  50 * time.Millisecond,
+	})
+	for i := 0; i < 3; i++ {
+		response, err := client.Get(context.Background(), server.URL)
+		assert.Nil(t, err)
+		assert.Equal(t, 503, response.StatusCode)
+	}
+
+	_, err := client.Get(context.Background(), server.URL)
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, int32(3), calls.Load())
+
+	time.Sleep(60 * time.Millisecond)
+	response, err := client.Get(context.Background(), server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+}
+
+func TestPropagatesRequestHeaders(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	client := New(testConfig)
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		response, err := client.Get(correlation.Context(c), server.URL)
+		if err != nil {
+			return err
+		}
+		return c.SendStatus(response.StatusCode)
+	})
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Request-ID", "req-1")
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "req-1", received.Get("X-Request-ID"))
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", received.Get("traceparent"))
+}
@@ -0,0 +1,228 @@
+// Package jobs runs work that shouldn't hold up a request, such as sending
+// mail, in the background and tries it again when it fails.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+)
+
+// Job is a unit of work of a type, described by its payload. It carries
+// the correlation metadata of the request that enqueued it.
+type Job struct {
+	ID       string
+	Type     string
+	Payload  map[string]string
+	Metadata correlation.Metadata
+	Attempts int
+	Enqueued time.Time
+	RunAt    time.Time
+}
+
+// Handler does a job. An error has the job tried again later.
+type Handler func(ctx context.Context, job Job) error
+
+// Backlog is what waits in the queue: how many jobs, and when the oldest
+// of them was enqueued, zero for none. Jobs enqueued to run later aren't
+// waiting until they are due; they are counted as Scheduled instead.
+type Backlog struct {
+	Pending   int
+	Oldest    time.Time
+	Scheduled int
+}
+
+// Queue keeps the jobs in memory, so jobs still waiting when the process
+// stops are lost, and runs them on the configured number of workers.
+type Queue struct {
+	cfg       config.JobsConfig
+	logger    *slog.Logger
+	now       func() time.Time
+	handlers  map[string]Handler
+	processed *metrics.CounterVec
+
+	mu      sync.Mutex
+	pending []*Job
+	running int
+	wake    chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func New(cfg config.JobsConfig, logger *slog.Logger, registry *metrics.Registry) *Queue {
+	return &Queue{
+		cfg:       cfg,
+		logger:    logger,
+		now:       clock.System.Now,
+		handlers:  map[string]Handler{},
+		processed: registry.Counter("jobs_processed_total", "Job attempts by type and result: done, retry or failed.", "type", "result"),
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Handle has handler do the jobs of jobType. Add handlers before Start.
+func (q *Queue) Handle(jobType string, handler Handler) {
+	q.handlers[jobType] = handler
+}
+
+// Enqueue adds a job of jobType, to be done as soon as a worker is free.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload map[string]string) error {
+	return q.EnqueueAt(ctx, jobType, payload, time.Time{})
+}
+
+// EnqueueAt adds a job of jobType to be done at runAt, or as soon as a
+// worker is free if that is past. Like all jobs, it is lost if the
+// process stops before then.
+func (q *Queue) EnqueueAt(ctx context.Context, jobType string, payload map[string]string, runAt time.Time) error {
+	if _, ok := q.handlers[jobType]; !ok {
+		return fmt.Errorf("jobs: no handler for %q", jobType)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	now := q.now()
+	if runAt.Before(now) {
+		runAt = now
+	}
+	q.schedule(&Job{
+		ID:       hex.EncodeToString(id),
+		Type:     jobType,
+		Payload:  payload,
+		Metadata: correlation.From(ctx),
+		Enqueued: now,
+		RunAt:    runAt,
+	})
+	return nil
+}
+
+func (q *Queue) schedule(job *Job) {
+	q.mu.Lock()
+	q.pending = append(q.pending, job)
+	sort.SliceStable(q.pending, func(i, j int) bool { return q.pending[i].RunAt.Before(q.pending[j].RunAt) })
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Backlog counts the jobs waiting or being done.
+func (q *Queue) Backlog() Backlog {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	backlog := Backlog{Pending: q.running}
+	now := q.now()
+	for _, job := range q.pending {
+		if job.Attempts == 0 && job.RunAt.After(now) {
+			backlog.Scheduled++
+			continue
+		}
+		backlog.Pending++
+		if backlog.Oldest.IsZero() || job.Enqueued.Before(backlog.Oldest) {
+			backlog.Oldest = job.Enqueued
+		}
+	}
+	return backlog
+}
+
+// Start runs the workers until Stop.
+func (q *Queue) Start() {
+	for i := 0; i < q.cfg.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Stop waits for the jobs being done and drops those still waiting.
+func (q *Queue) Stop() {
+	close(q.stop)
+	q.wg.Wait()
+	if backlog := q.Backlog(); backlog.Pending > 0 || backlog.Scheduled > 0 {
+		q.logger.Warn("jobs dropped on shutdown", slog.Int("pending", backlog.Pending), slog.Int("scheduled", backlog.Scheduled))
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		job, wait := q.next()
+		if job != nil {
+			q.run(job)
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// next takes the first job that is due, or returns how long to wait for
+// one.
+func (q *Queue) next() (*Job, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-q.stop:
+		return nil, 0
+	default:
+	}
+	if len(q.pending) == 0 {
+		return nil, time.Hour
+	}
+	if wait := q.pending[0].RunAt.Sub(q.now()); wait > 0 {
+		return nil, wait
+	}
+	job := q.pending[0]
+	q.pending = q.pending[1:]
+	q.running++
+	return job, 0
+}
+
+func (q *Queue) run(job *Job) {
+	ctx, cancel := context.WithTimeout(correlation.With(context.Background(), job.Metadata), q.cfg.Timeout)
+	defer cancel()
+	job.Attempts++
+	err := q.handlers[job.Type](ctx, *job)
+
+	q.mu.Lock()
+	q.running--
+	q.mu.Unlock()
+	if err == nil {
+		q.processed.With(job.Type, "done").Inc()
+		return
+	}
+	attrs := []any{slog.String("job", job.Type), slog.String("id", job.ID), slog.Int("attempt", job.Attempts), slog.String("error", err.Error())}
+	if job.Attempts >= q.cfg.MaxAttempts {
+		q.processed.With(job.Type, "failed").Inc()
+		q.logger.ErrorContext(ctx, "job failed, giving up", attrs...)
+		return
+	}
+	q.processed.With(job.Type, "retry").Inc()
+	q.logger.WarnContext(ctx, "job failed, trying again", attrs...)
+	job.RunAt = q.now().Add(q.cfg.Backoff << (job.Attempts - 1))
+	q.schedule(job)
+}
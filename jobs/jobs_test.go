@@ -0,0 +1,131 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/mail"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func newQueue(t *testing.T, maxAttempts int) (*Queue, *metrics.Registry) {
+	registry := metrics.NewRegistry()
+	q := New(config.JobsConfig{Workers: 2, MaxAttempts: maxAttempts, Backoff: 10 * time.Millisecond, Timeout: time.Second},
+		slog.New(slog.NewTextHandler(io.Discard, nil)), registry)
+	return q, registry
+}
+
+func TestRetry(t *testing.T) {
+	q, registry := newQueue(t, 5)
+	var mu sync.Mutex
+	var attempts []time.Time
+	var requestID string
+	q.Handle("flaky", func(ctx context.Context, job Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		requestID = correlation.RequestID(ctx)
+		if len(attempts) < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	q.Start()
+	defer q.Stop()
+
+	ctx := correlation.With(context.Background(), correlation.Metadata{correlation.HeaderRequestID: "req-1"})
+	assert.Nil(t, q.Enqueue(ctx, "flaky", map[string]string{"n": "1"}))
+	assert.Eventually(t, func() bool {
+		return registry.Counter("jobs_processed_total", "", "type", "result").With("flaky", "done").Value() == 1
+	}, 5*time.Second, 5*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, attempts, 3)
+	// Backoff, then twice the backoff.
+	assert.GreaterOrEqual(t, attempts[1].Sub(attempts[0]), 10*time.Millisecond)
+	assert.GreaterOrEqual(t, attempts[2].Sub(attempts[1]), 20*time.Millisecond)
+	assert.Equal(t, "req-1", requestID)
+	assert.Equal(t, Backlog{}, q.Backlog())
+}
+
+func TestGiveUp(t *testing.T) {
+	q, registry := newQueue(t, 2)
+	q.Handle("broken", func(context.Context, Job) error { return errors.New("broken") })
+	q.Start()
+	defer q.Stop()
+
+	assert.Nil(t, q.Enqueue(context.Background(), "broken", nil))
+	processed := registry.Counter("jobs_processed_total", "", "type", "result")
+	assert.Eventually(t, func() bool { return processed.With("broken", "failed").Value() == 1 }, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, float64(1), processed.With("broken", "retry").Value())
+
+	assert.NotNil(t, q.Enqueue(context.Background(), "unknown", nil))
+}
+
+func TestBacklog(t *testing.T) {
+	q, _ := newQueue(t, 1)
+	at := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return at }
+	q.Handle("later", func(context.Context, Job) error { return nil })
+	assert.Nil(t, q.Enqueue(context.Background(), "later", nil))
+	assert.Nil(t, q.Enqueue(context.Background(), "later", nil))
+	assert.Equal(t, Backlog{Pending: 2, Oldest: at}, q.Backlog())
+	assert.Nil(t, q.EnqueueAt(context.Background(), "later", nil, at.Add(time.Hour)))
+	assert.Equal(t, Backlog{Pending: 2, Oldest: at, Scheduled: 1}, q.Backlog())
+	at = at.Add(time.Hour)
+	assert.Equal(t, Backlog{Pending: 3, Oldest: at.Add(-time.Hour)}, q.Backlog())
+}
+
+func TestEnqueueAt(t *testing.T) {
+	q, _ := newQueue(t, 1)
+	done := make(chan time.Time, 2)
+	q.Handle("later", func(context.Context, Job) error {
+		done <- time.Now()
+		return nil
+	})
+	q.Start()
+	defer q.Stop()
+
+	start := time.Now()
+	assert.Nil(t, q.EnqueueAt(context.Background(), "later", nil, start.Add(50*time.Millisecond)))
+	assert.Nil(t, q.EnqueueAt(context.Background(), "later", nil, start.Add(-time.Hour)))
+	assert.Less(t, (<-done).Sub(start), 50*time.Millisecond)
+	assert.GreaterOrEqual(t, (<-done).Sub(start), 50*time.Millisecond)
+}
+
+type recorder struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (r *recorder) Send(_ context.Context, message mail.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, message)
+	return nil
+}
+
+func TestMailer(t *testing.T) {
+	q, _ := newQueue(t, 1)
+	sent := &recorder{}
+	mailer := q.Mailer(sent)
+	q.Start()
+	defer q.Stop()
+
+	message := mail.Message{To: "alice@example.com", Subject: "Hi", Body: "Hello"}
+	assert.Nil(t, mailer.Send(context.Background(), message))
+	assert.Eventually(t, func() bool {
+		sent.mu.Lock()
+		defer sent.mu.Unlock()
+		return len(sent.sent) == 1 && sent.sent[0] == message
+	}, 5*time.Second, 5*time.Millisecond)
+}
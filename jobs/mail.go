@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/mail"
+)
+
+// JobMail is the type of the jobs of Mailer.
+const JobMail = "mail"
+
+type queuedSender struct {
+	queue *Queue
+}
+
+// Mailer returns a mail.Sender that sends through sender from the queue,
+// so callers don't wait for the mail server and failed sends are tried
+// again.
+func (q *Queue) Mailer(sender mail.Sender) mail.Sender {
+	q.Handle(JobMail, func(ctx context.Context, job Job) error {
+		return sender.Send(ctx, mail.Message{To: job.Payload["to"], Subject: job.Payload["subject"], Body: job.Payload["body"]})
+	})
+	return queuedSender{queue: q}
+}
+
+func (s queuedSender) Send(ctx context.Context, message mail.Message) error {
+	return s.queue.Enqueue(ctx, JobMail, map[string]string{"to": message.To, "subject": message.Subject, "body": message.Body})
+}
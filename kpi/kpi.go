@@ -0,0 +1,67 @@
+// Package kpi exports product metrics, such as registrations and orders,
+// next to the HTTP ones at /metrics. They are counted from the events the
+// services publish, so the services don't know about metrics.
+package kpi
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/upload"
+	"github.com/jalal-akbar/belajar-golang-fiber/users"
+)
+
+// Metrics counts the events of a bus. Orders published through the outbox
+// may be counted twice in the rare case their relay is retried.
+type Metrics struct {
+	registry      *metrics.Registry
+	registrations *metrics.Counter
+	logins        *metrics.Counter
+	uploads       *metrics.CounterVec
+	orders        *metrics.CounterVec
+}
+
+func New(registry *metrics.Registry) *Metrics {
+	return &Metrics{
+		registry:      registry,
+		registrations: registry.Counter("users_registered_total", "Accounts created.").With(),
+		logins:        registry.Counter("user_logins_total", "Logins.").With(),
+		uploads:       registry.Counter("uploads_total", "Files stored for users, by kind.", "kind"),
+		orders:        registry.Counter("orders_total", "Orders that reached a status, by status.", "status"),
+	}
+}
+
+// Listen counts the events published on bus from now on.
+func (m *Metrics) Listen(bus *events.Bus) {
+	bus.Subscribe(users.EventRegistered, func(context.Context, events.Event) {
+		m.registrations.Inc()
+	})
+	bus.Subscribe(auth.EventLoggedIn, func(context.Context, events.Event) {
+		m.logins.Inc()
+	})
+	bus.Subscribe(upload.EventStored, func(_ context.Context, event events.Event) {
+		m.uploads.With(event.Data["kind"]).Inc()
+	})
+	bus.Subscribe("*", func(_ context.Context, event events.Event) {
+		if status, ok := strings.CutPrefix(event.Type, "order."); ok {
+			m.orders.With(status).Inc()
+		}
+	})
+}
+
+// CountAccounts exports the accounts by status, as count returns them at
+// scrape time. The gauges keep their values when count fails.
+func (m *Metrics) CountAccounts(count func(ctx context.Context) (active, disabled int, err error)) {
+	accounts := m.registry.Gauge("users_accounts", "Accounts by status: active or disabled.", "status")
+	m.registry.OnScrape(func() {
+		active, disabled, err := count(context.Background())
+		if err != nil {
+			return
+		}
+		accounts.With("active").Set(float64(active))
+		accounts.With("disabled").Set(float64(disabled))
+	})
+}
@@ -0,0 +1,51 @@
+package kpi
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/upload"
+	"github.com/jalal-akbar/belajar-golang-fiber/users"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	bus := events.NewBus()
+	m := New(registry)
+	m.Listen(bus)
+	m.CountAccounts(func(context.Context) (int, int, error) { return 7, 2, nil })
+
+	ctx := context.Background()
+	for _, event := range []events.Event{
+		{Type: users.EventRegistered, UserID: "alice"},
+		{Type: users.EventRegistered, UserID: "bob"},
+		{Type: auth.EventLoggedIn, UserID: "alice"},
+		{Type: upload.EventStored, UserID: "alice", Data: map[string]string{"kind": "avatar"}},
+		{Type: "order.created", UserID: "alice"},
+		{Type: "order.created", UserID: "bob"},
+		{Type: "order.paid", UserID: "alice"},
+		{Type: "config.reloaded"},
+	} {
+		bus.Publish(ctx, event)
+	}
+
+	var out bytes.Buffer
+	assert.Nil(t, registry.Write(&out))
+	for _, line := range []string{
+		"users_registered_total 2\n",
+		"user_logins_total 1\n",
+		`uploads_total{kind="avatar"} 1` + "\n",
+		`orders_total{status="created"} 2` + "\n",
+		`orders_total{status="paid"} 1` + "\n",
+		`users_accounts{status="active"} 7` + "\n",
+		`users_accounts{status="disabled"} 2` + "\n",
+	} {
+		assert.Contains(t, out.String(), line)
+	}
+	assert.NotContains(t, out.String(), "reloaded")
+}
@@ -0,0 +1,111 @@
+// Package lifecycle starts the subsystems of the app in the order they
+// were added and stops them in reverse, each within a time limit, so
+// nothing is stopped while something started after it may still use it.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Hook starts and stops a subsystem. Either function may be nil. Timeout
+// limits each of them, the lifecycle's default if zero.
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+	Timeout time.Duration
+}
+
+type Lifecycle struct {
+	timeout time.Duration
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	hooks   []Hook
+	started int
+}
+
+// New gives each hook timeout to start and to stop in, unless it sets its
+// own. Zero is no limit.
+func New(timeout time.Duration, logger *slog.Logger) *Lifecycle {
+	return &Lifecycle{timeout: timeout, logger: logger}
+}
+
+// Append adds a hook to start after those added before. Hooks are added
+// before Start.
+func (l *Lifecycle) Append(hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, hook)
+}
+
+// Start runs the OnStart functions in order. If one fails, the hooks that
+// started are stopped again and the error returned.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.started < len(l.hooks) {
+		hook := l.hooks[l.started]
+		if err := l.run(ctx, hook, "start", hook.OnStart); err != nil {
+			return errors.Join(fmt.Errorf("lifecycle: starting %s: %w", hook.Name, err), l.stop(ctx))
+		}
+		l.started++
+	}
+	return nil
+}
+
+// Stop runs the OnStop functions of the started hooks in reverse order.
+// Hooks that fail or time out don't keep the others from stopping; their
+// errors are returned together.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stop(ctx)
+}
+
+func (l *Lifecycle) stop(ctx context.Context) error {
+	var errs []error
+	for ; l.started > 0; l.started-- {
+		hook := l.hooks[l.started-1]
+		if err := l.run(ctx, hook, "stop", hook.OnStop); err != nil {
+			errs = append(errs, fmt.Errorf("lifecycle: stopping %s: %w", hook.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run calls fn within the hook's timeout. A function that doesn't return
+// in time is left running in the background.
+func (l *Lifecycle) run(ctx context.Context, hook Hook, action string, fn func(context.Context) error) error {
+	if fn == nil {
+		return nil
+	}
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = l.timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		l.logger.Debug("lifecycle hook ran", slog.String("hook", hook.Name), slog.String("action", action), slog.Duration("took", time.Since(start)))
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("gave up after %s: %w", timeout, ctx.Err())
+	}
+}
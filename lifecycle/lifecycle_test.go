@@ -0,0 +1,87 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) hook(name string, startErr error) Hook {
+	return Hook{
+		Name: name,
+		OnStart: func(ctx context.Context) error {
+			r.calls = append(r.calls, "start "+name)
+			return startErr
+		},
+		OnStop: func(ctx context.Context) error {
+			r.calls = append(r.calls, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func newLifecycle() *Lifecycle {
+	return New(time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestOrder(t *testing.T) {
+	r := &recorder{}
+	l := newLifecycle()
+	l.Append(r.hook("db", nil))
+	l.Append(Hook{Name: "file"})
+	l.Append(r.hook("workers", nil))
+
+	assert.Nil(t, l.Start(context.Background()))
+	assert.Nil(t, l.Stop(context.Background()))
+	assert.Equal(t, []string{"start db", "start workers", "stop workers", "stop db"}, r.calls)
+
+	// Stopped hooks aren't stopped again.
+	assert.Nil(t, l.Stop(context.Background()))
+	assert.Len(t, r.calls, 4)
+}
+
+func TestFailedStartStopsTheStarted(t *testing.T) {
+	r := &recorder{}
+	l := newLifecycle()
+	l.Append(r.hook("db", nil))
+	l.Append(r.hook("cache", errors.New("unreachable")))
+	l.Append(r.hook("workers", nil))
+
+	err := l.Start(context.Background())
+	assert.EqualError(t, err, "lifecycle: starting cache: unreachable")
+	assert.Equal(t, []string{"start db", "start cache", "stop db"}, r.calls)
+}
+
+func TestTimeouts(t *testing.T) {
+	r := &recorder{}
+	l := newLifecycle()
+	l.Append(r.hook("db", nil))
+	l.Append(Hook{
+		Name: "stuck",
+		OnStop: func(ctx context.Context) error {
+			select {}
+		},
+		Timeout: 10 * time.Millisecond,
+	})
+	l.Append(Hook{
+		Name:   "failing",
+		OnStop: func(ctx context.Context) error { return errors.New("still busy") },
+	})
+
+	assert.Nil(t, l.Start(context.Background()))
+	err := l.Stop(context.Background())
+	assert.ErrorContains(t, err, "lifecycle: stopping failing: still busy")
+	assert.ErrorContains(t, err, "lifecycle: stopping stuck: gave up after 10ms")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	// The hooks before them stop regardless.
+	assert.Equal(t, []string{"start db", "stop db"}, r.calls)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/loadtest"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLoad puts the whole app under load to check its limits and cache
+// hold up, logging the latencies of each route. It sends a few thousand
+// requests; set LOAD_DURATION to keep the load on for longer:
+//
+//	LOAD_DURATION=30s go test -run Load -v
+func TestLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+	options := func(workers, requests int) loadtest.Options {
+		opts := loadtest.Options{Workers: workers, Requests: requests}
+		if d, err := time.ParseDuration(os.Getenv("LOAD_DURATION")); err == nil {
+			opts = loadtest.Options{Workers: workers, Duration: d}
+		}
+		return opts
+	}
+
+	t.Run("rate limit", func(t *testing.T) {
+		cfg := loadConfig()
+		cfg.Bots.Rules = []config.BotRule{{Name: "load", Pattern: "^loadtest$", Action: "limit", Limit: 100, Window: time.Hour}}
+		report := runLoad(t, cfg, options(16, 2000), []loadtest.Target{
+			{Name: "limited", Method: "GET", Path: "/metrics", Header: map[string][]string{"User-Agent": {"loadtest"}}},
+			{Name: "unlimited", Method: "GET", Path: "/metrics"},
+		})
+
+		limited := report.Route("limited")
+		assert.Equal(t, 100, limited.Statuses[fiber.StatusOK])
+		assert.Equal(t, limited.Requests-100, limited.Statuses[fiber.StatusTooManyRequests])
+		unlimited := report.Route("unlimited")
+		assert.Equal(t, unlimited.Requests, unlimited.Statuses[fiber.StatusOK])
+	})
+
+	t.Run("concurrency limit", func(t *testing.T) {
+		cfg := loadConfig()
+		cfg.Server.Concurrency = 4
+		report := runLoad(t, cfg, options(32, 2000), []loadtest.Target{{Method: "GET", Path: "/metrics"}})
+
+		// Connections beyond the limit are turned away rather than queued.
+		stats := report.Route("GET /metrics")
+		assert.Greater(t, stats.Statuses[fiber.StatusOK], 0)
+		assert.Greater(t, stats.Statuses[fiber.StatusServiceUnavailable], 0)
+		assert.Equal(t, stats.Requests, stats.Statuses[fiber.StatusOK]+stats.Statuses[fiber.StatusServiceUnavailable]+stats.Errors)
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		cfg := loadConfig()
+		cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+		tokens, err := auth.New(cfg.JWT, nil, nil)
+		assert.Nil(t, err)
+		token, err := tokens.Sign("load", userScopes...)
+		assert.Nil(t, err)
+		app, err := newApp(cfg)
+		assert.Nil(t, err)
+
+		var order struct{ ID string }
+		testkit.DoJSON(t, app, "POST", "/api/orders", map[string]any{
+			"items": []map[string]any{{"sku": "kopi", "quantity": 1, "price": 25000}},
+		}, &order, testkit.WithAuth(token)).AssertStatus(201)
+
+		// The first lookup fills the cache; every one under load hits it.
+		testkit.Do(t, app, "GET", "/api/orders/"+order.ID, nil, testkit.WithAuth(token)).AssertStatus(200)
+		header := map[string][]string{"Authorization": {"Bearer " + token}}
+		report := serveLoad(t, app, options(16, 2000), []loadtest.Target{
+			{Name: "order", Method: "GET", Path: "/api/orders/" + order.ID, Header: header},
+		})
+		stats := report.Route("order")
+		assert.Equal(t, stats.Requests, stats.Statuses[fiber.StatusOK])
+
+		metrics := testkit.Do(t, app, "GET", "/metrics", nil).String()
+		assert.Contains(t, metrics, `cache_requests_total{cache="orders",result="miss"} 1`+"\n")
+		assert.Contains(t, metrics, fmt.Sprintf(`cache_requests_total{cache="orders",result="hit"} %d`+"\n", stats.Requests))
+	})
+}
+
+func loadConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.Database.SQLitePath = ":memory:"
+	return cfg
+}
+
+func runLoad(t *testing.T, cfg *config.Config, opts loadtest.Options, targets []loadtest.Target) *loadtest.Report {
+	t.Helper()
+	app, err := newApp(cfg)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	return serveLoad(t, app, opts, targets)
+}
+
+func serveLoad(t *testing.T, app *fiber.App, opts loadtest.Options, targets []loadtest.Target) *loadtest.Report {
+	t.Helper()
+	url, stop, err := loadtest.Serve(app)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	defer stop()
+
+	report := loadtest.Run(context.Background(), url, targets, opts)
+	var out strings.Builder
+	report.WriteTo(&out)
+	t.Logf("%v with %d workers:\n%s", report.Elapsed.Round(time.Millisecond), opts.Workers, out.String())
+	return report
+}
@@ -0,0 +1,270 @@
+// Package loadtest puts an app under load in-process: a pool of workers
+// sends requests to a set of routes over real connections, as clients
+// would, and reports the statuses and latency percentiles of each route.
+// It is meant for tests checking that rate limits, concurrency limits and
+// caches hold up, not for benchmarking a deployment.
+//
+//	url, stop, err := loadtest.Serve(app)
+//	defer stop()
+//	report := loadtest.Run(ctx, url, targets, loadtest.Options{Workers: 32, Requests: 5000})
+//	report.WriteTo(os.Stdout)
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Target is a request sent under load. Requests are reported by Name,
+// which defaults to the method and path.
+type Target struct {
+	Name   string
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+func (t Target) name() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Method + " " + t.Path
+}
+
+// Options sets how much load Run puts on the app: Workers send requests
+// concurrently, each waiting for its response before sending the next,
+// until Requests were sent or Duration has passed, whichever comes first.
+// Without either Run sends one request per worker.
+type Options struct {
+	Workers  int
+	Requests int
+	Duration time.Duration
+}
+
+// Stats are the results of a route. Errors counts requests that got no
+// response at all; they aren't part of the latencies.
+type Stats struct {
+	Route    string
+	Requests int
+	Errors   int
+	Statuses map[int]int
+	Mean     time.Duration
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+}
+
+type Report struct {
+	Elapsed time.Duration
+	Routes  []Stats
+}
+
+// Route returns the stats of the route named name.
+func (r *Report) Route(name string) Stats {
+	for _, stats := range r.Routes {
+		if stats.Route == name {
+			return stats
+		}
+	}
+	return Stats{Route: name}
+}
+
+// WriteTo writes the report as a table, a route per line.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	table := tabwriter.NewWriter(&out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "route\trequests\terrors\trps\tmean\tp50\tp90\tp99\tmax\tstatuses")
+	for _, s := range r.Routes {
+		rps := float64(s.Requests) / r.Elapsed.Seconds()
+		fmt.Fprintf(table, "%s\t%d\t%d\t%.0f\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			s.Route, s.Requests, s.Errors, rps, s.Mean, s.P50, s.P90, s.P99, s.Max, statuses(s.Statuses))
+	}
+	table.Flush()
+	n, err := w.Write(out.Bytes())
+	return int64(n), err
+}
+
+func statuses(counts map[int]int) string {
+	codes := make([]int, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	var b bytes.Buffer
+	for i, code := range codes {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%d:%d", code, counts[code])
+	}
+	return b.String()
+}
+
+// Serve serves app on a free loopback port, returning its base URL and the
+// function shutting it down.
+func Serve(app *fiber.App) (string, func() error, error) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	go app.Listener(ln)
+	return "http://" + ln.Addr().String(), app.Shutdown, nil
+}
+
+// sample is what a worker saw of a request.
+type sample struct {
+	target  int
+	status  int
+	latency time.Duration
+}
+
+// Run puts the app at baseURL under the load of opts, spreading requests
+// evenly over targets. Cancelling ctx stops it early.
+func Run(ctx context.Context, baseURL string, targets []Target, opts Options) *Report {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	requests := int64(opts.Requests)
+	if requests <= 0 && opts.Duration <= 0 {
+		requests = int64(workers)
+	}
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+	client := &http.Client{Transport: &http.Transport{
+		MaxIdleConns:        workers,
+		MaxIdleConnsPerHost: workers,
+	}}
+	defer client.CloseIdleConnections()
+
+	var sent atomic.Int64
+	samples := make([][]sample, workers)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < workers; w++ {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				n := sent.Add(1)
+				if requests > 0 && n > requests {
+					return
+				}
+				i := int((n - 1) % int64(len(targets)))
+				s, ok := send(ctx, client, baseURL, targets[i])
+				if !ok && ctx.Err() != nil {
+					// Cut short by the end of the run, not by the app.
+					return
+				}
+				s.target = i
+				samples[w] = append(samples[w], s)
+			}
+		}()
+	}
+	wg.Wait()
+	return report(targets, samples, time.Since(start))
+}
+
+// send sends target, reading the whole response. A request without
+// response has status 0.
+func send(ctx context.Context, client *http.Client, baseURL string, target Target) (sample, bool) {
+	request, err := http.NewRequestWithContext(ctx, target.Method, baseURL+target.Path, bytes.NewReader(target.Body))
+	if err != nil {
+		return sample{}, false
+	}
+	for name, values := range target.Header {
+		request.Header[name] = values
+	}
+	start := time.Now()
+	response, err := client.Do(request)
+	if err != nil {
+		return sample{}, false
+	}
+	_, err = io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	if err != nil {
+		return sample{}, false
+	}
+	return sample{status: response.StatusCode, latency: time.Since(start)}, true
+}
+
+// report sums the samples up by route. Targets sharing a name, such as
+// the same route with different bodies, are reported together, in the
+// order they first appear in.
+func report(targets []Target, samples [][]sample, elapsed time.Duration) *Report {
+	var routes []Stats
+	var latencies [][]time.Duration
+	route := make([]int, len(targets))
+	index := map[string]int{}
+	for i, target := range targets {
+		name := target.name()
+		r, ok := index[name]
+		if !ok {
+			r = len(routes)
+			index[name] = r
+			routes = append(routes, Stats{Route: name, Statuses: map[int]int{}})
+			latencies = append(latencies, nil)
+		}
+		route[i] = r
+	}
+	for _, worker := range samples {
+		for _, s := range worker {
+			r := route[s.target]
+			routes[r].Requests++
+			if s.status == 0 {
+				routes[r].Errors++
+				continue
+			}
+			routes[r].Statuses[s.status]++
+			latencies[r] = append(latencies[r], s.latency)
+		}
+	}
+	for r := range routes {
+		summarize(&routes[r], latencies[r])
+	}
+	return &Report{Elapsed: elapsed, Routes: routes}
+}
+
+func summarize(stats *Stats, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	stats.Mean = total / time.Duration(len(latencies))
+	stats.P50 = percentile(latencies, 0.50)
+	stats.P90 = percentile(latencies, 0.90)
+	stats.P99 = percentile(latencies, 0.99)
+	stats.Max = latencies[len(latencies)-1]
+}
+
+// percentile returns the latency the share q of the sorted latencies are
+// at most, by the nearest-rank method.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
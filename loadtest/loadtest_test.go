@@ -0,0 +1,81 @@
+package loadtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/fast", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		time.Sleep(5 * time.Millisecond)
+		return c.SendString("ok")
+	})
+	app.Post("/echo", func(c *fiber.Ctx) error {
+		if string(c.Body()) != "ping" || c.Get("X-Test") != "yes" {
+			return fiber.ErrBadRequest
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	url, stop, err := Serve(app)
+	assert.Nil(t, err)
+	defer stop()
+
+	targets := []Target{
+		{Method: "GET", Path: "/fast"},
+		{Method: "GET", Path: "/slow"},
+		{Name: "echo", Method: "POST", Path: "/echo", Body: []byte("ping"), Header: map[string][]string{"X-Test": {"yes"}}},
+		{Name: "echo", Method: "POST", Path: "/echo", Body: []byte("pong")},
+		{Method: "GET", Path: "/missing"},
+	}
+	report := Run(context.Background(), url, targets, Options{Workers: 8, Requests: 500})
+
+	assert.Len(t, report.Routes, 4)
+	fast, slow := report.Route("GET /fast"), report.Route("GET /slow")
+	assert.Equal(t, 100, fast.Requests)
+	assert.Equal(t, map[int]int{200: 100}, fast.Statuses)
+	assert.Equal(t, 0, fast.Errors)
+	assert.GreaterOrEqual(t, slow.P50, 5*time.Millisecond)
+	assert.Less(t, fast.P50, slow.P50)
+	assert.LessOrEqual(t, slow.P50, slow.P90)
+	assert.LessOrEqual(t, slow.P90, slow.P99)
+	assert.LessOrEqual(t, slow.P99, slow.Max)
+	assert.Equal(t, map[int]int{204: 100, 400: 100}, report.Route("echo").Statuses)
+	assert.Equal(t, map[int]int{404: 100}, report.Route("GET /missing").Statuses)
+
+	var out strings.Builder
+	report.WriteTo(&out)
+	assert.Contains(t, out.String(), "GET /slow")
+	assert.Contains(t, out.String(), "204:100 400:100")
+}
+
+func TestRunForDuration(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	url, stop, err := Serve(app)
+	assert.Nil(t, err)
+	defer stop()
+
+	start := time.Now()
+	report := Run(context.Background(), url, []Target{{Method: "GET", Path: "/"}}, Options{Workers: 4, Duration: 100 * time.Millisecond})
+	assert.Less(t, time.Since(start), time.Second)
+	stats := report.Route("GET /")
+	assert.Greater(t, stats.Requests, 0)
+	assert.Equal(t, 0, stats.Errors)
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[i] = time.Duration(i+1) * time.Millisecond
+	}
+	assert.Equal(t, 50*time.Millisecond, percentile(latencies, 0.5))
+	assert.Equal(t, 99*time.Millisecond, percentile(latencies, 0.99))
+	assert.Equal(t, 7*time.Millisecond, percentile(latencies[6:7], 0.99))
+}
@@ -0,0 +1,146 @@
+// Package lock hands out locks held in Redis, so that when several
+// instances run, a singleton job or a task that mustn't run twice runs on
+// one of them at a time.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrNotAcquired = errors.New("lock: held by someone else")
+	ErrLost        = errors.New("lock: lease lost")
+)
+
+// Only the holder's token may extend or release a lock; a holder whose
+// lease ran out mustn't touch its successor's.
+var (
+	refreshScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+)
+
+type Locker struct {
+	client redis.UniversalClient
+	logger *slog.Logger
+}
+
+func New(client redis.UniversalClient, logger *slog.Logger) *Locker {
+	return &Locker{client: client, logger: logger}
+}
+
+// Lock is a lease on a name: it is held until released or until ttl
+// passes without a refresh.
+type Lock struct {
+	client redis.UniversalClient
+	key    string
+	token  string
+}
+
+// Acquire takes the lock on name for ttl, or returns ErrNotAcquired if it
+// is held.
+func (l *Locker) Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	key := "lock:" + name
+	ok, err := l.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotAcquired
+	}
+	return &Lock{client: l.client, key: key, token: token}, nil
+}
+
+// Refresh extends the lease to ttl from now. It returns ErrLost if the
+// lease ran out and someone else may hold the lock.
+func (lock *Lock) Refresh(ctx context.Context, ttl time.Duration) error {
+	ok, err := refreshScript.Run(ctx, lock.client, []string{lock.key}, lock.token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrLost
+	}
+	return nil
+}
+
+// Release gives the lock up. Releasing a lost lock does nothing.
+func (lock *Lock) Release(ctx context.Context) error {
+	return releaseScript.Run(ctx, lock.client, []string{lock.key}, lock.token).Err()
+}
+
+// Run calls fn while holding the lock on name, refreshing the lease every
+// third of ttl. If the lease is lost, fn's context is cancelled: fn must
+// stop, as another instance may be taking over. Run returns
+// ErrNotAcquired without calling fn if the lock is held.
+func (l *Locker) Run(ctx context.Context, name string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	lock, err := l.Acquire(ctx, name, ttl)
+	if err != nil {
+		return err
+	}
+	defer lock.Release(context.WithoutCancel(ctx))
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		refreshed := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := lock.Refresh(ctx, ttl)
+				if err == nil {
+					refreshed = time.Now()
+					continue
+				}
+				// While Redis fails the lease may still be ours; it is
+				// given up once it has run out.
+				if errors.Is(err, ErrLost) || time.Since(refreshed) >= ttl {
+					l.logger.Warn("lock lost", "lock", name, "error", err)
+					cancel(ErrLost)
+					return
+				}
+				l.logger.Warn("lock refresh failed", "lock", name, "error", err)
+			}
+		}
+	}()
+
+	err = fn(ctx)
+	if err == nil && context.Cause(ctx) == ErrLost {
+		return ErrLost
+	}
+	return err
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
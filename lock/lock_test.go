@@ -0,0 +1,117 @@
+package lock
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newLocker(t *testing.T) (*Locker, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client, slog.New(slog.NewTextHandler(io.Discard, nil))), server
+}
+
+func TestAcquire(t *testing.T) {
+	locker, server := newLocker(t)
+	ctx := context.Background()
+
+	first, err := locker.Acquire(ctx, "report", time.Second)
+	assert.Nil(t, err)
+	_, err = locker.Acquire(ctx, "report", time.Second)
+	assert.ErrorIs(t, err, ErrNotAcquired)
+	_, err = locker.Acquire(ctx, "cleanup", time.Second)
+	assert.Nil(t, err)
+
+	assert.Nil(t, first.Refresh(ctx, time.Minute))
+	assert.Equal(t, time.Minute, server.TTL("lock:report"))
+
+	// Once the lease runs out the lock goes to the next taker, and the
+	// former holder can neither extend nor release it.
+	server.FastForward(time.Minute)
+	second, err := locker.Acquire(ctx, "report", time.Second)
+	assert.Nil(t, err)
+	assert.ErrorIs(t, first.Refresh(ctx, time.Minute), ErrLost)
+	assert.Nil(t, first.Release(ctx))
+	assert.True(t, server.Exists("lock:report"))
+
+	assert.Nil(t, second.Release(ctx))
+	assert.False(t, server.Exists("lock:report"))
+}
+
+func TestRunContention(t *testing.T) {
+	locker, _ := newLocker(t)
+	var running, ran, skipped int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := locker.Run(context.Background(), "job", time.Second, func(ctx context.Context) error {
+				if atomic.AddInt32(&running, 1) > 1 {
+					t.Error("job runs twice at once")
+				}
+				time.Sleep(20 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				atomic.AddInt32(&ran, 1)
+				return nil
+			})
+			if err == ErrNotAcquired {
+				atomic.AddInt32(&skipped, 1)
+			} else {
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, ran, int32(1))
+	assert.Equal(t, int32(20), ran+skipped)
+
+	// Released after the run.
+	assert.Nil(t, locker.Run(context.Background(), "job", time.Second, func(ctx context.Context) error { return nil }))
+}
+
+func TestRunRenewsLease(t *testing.T) {
+	locker, server := newLocker(t)
+	ttl := 300 * time.Millisecond
+
+	err := locker.Run(context.Background(), "job", ttl, func(ctx context.Context) error {
+		for i := 0; i < 5; i++ {
+			// miniredis only expires keys when told to; a lease that
+			// wasn't refreshed would be gone.
+			time.Sleep(ttl / 2)
+			server.FastForward(ttl / 2)
+			assert.True(t, server.Exists("lock:job"), "lease ran out")
+		}
+		return ctx.Err()
+	})
+	assert.Nil(t, err)
+	assert.False(t, server.Exists("lock:job"))
+}
+
+func TestRunStopsWhenLeaseLost(t *testing.T) {
+	locker, server := newLocker(t)
+	err := locker.Run(context.Background(), "job", 150*time.Millisecond, func(ctx context.Context) error {
+		server.Set("lock:job", "someone else")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(5 * time.Second):
+			t.Error("job kept running without the lock")
+			return nil
+		}
+	})
+	assert.ErrorIs(t, err, ErrLost)
+	// The new holder keeps its lock.
+	value, _ := server.Get("lock:job")
+	assert.Equal(t, "someone else", value)
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/geoip"
+	"github.com/jalal-akbar/belajar-golang-fiber/middleware"
+	"github.com/jalal-akbar/belajar-golang-fiber/redact"
+)
+
+// AccessLog writes one line per request in the Apache combined log format,
+// followed by the client's country and city ("-" without GeoIP):
+//
+//	host ident user [time] "request" status bytes "referer" "user-agent" "country" "city"
+//
+// Secret query parameters are redacted with redactor.
+func AccessLog(w io.Writer, redactor *redact.Redactor) fiber.Handler {
+	var mu sync.Mutex
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		user := "-"
+		if id := ctxutil.CurrentUser(c); id != "" {
+			user = id
+		}
+		bytes := "-"
+		if size := responseSize(c); size > 0 {
+			bytes = strconv.Itoa(size)
+		}
+
+		country, city := "-", "-"
+		if location, ok := geoip.From(c); ok {
+			country = location.Country
+			if location.City != "" {
+				city = location.City
+			}
+		}
+
+		line := fmt.Sprintf("%s - %s [%s] %s %d %s %s %s %s %s\n",
+			middleware.RealIP(c),
+			user,
+			start.Format("02/Jan/2006:15:04:05 -0700"),
+			strconv.Quote(c.Method()+" "+redactor.URI(c.OriginalURL())+" "+string(c.Request().Header.Protocol())),
+			responseStatus(c, err),
+			bytes,
+			strconv.Quote(redactor.URI(c.Get(fiber.HeaderReferer, "-"))),
+			strconv.Quote(c.Get(fiber.HeaderUserAgent, "-")),
+			strconv.Quote(country),
+			strconv.Quote(city),
+		)
+
+		// A failing log file must not fail the request.
+		mu.Lock()
+		io.WriteString(w, line)
+		mu.Unlock()
+		return err
+	}
+}
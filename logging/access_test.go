@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"bytes"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/geoip"
+	"github.com/jalal-akbar/belajar-golang-fiber/redact"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogCombinedFormat(t *testing.T) {
+	output := new(bytes.Buffer)
+	app := fiber.New()
+	app.Use(AccessLog(output, redact.New(config.Default().Log.Redact)))
+	app.Get("/hello", func(c *fiber.Ctx) error {
+		ctxutil.SetCurrentUser(c, "jalal")
+		return c.SendString("Hello World")
+	})
+
+	request := httptest.NewRequest("GET", "/hello?name=Akbar", nil)
+	request.Header.Set("Referer", "http://example.com/")
+	request.Header.Set("Authorization", "Bearer rahasia")
+	request.Header.Set("User-Agent", `curl/8.0 "test"`)
+	_, err := app.Test(request)
+	assert.Nil(t, err)
+	_, err = app.Test(httptest.NewRequest("GET", "/missing", nil))
+	assert.Nil(t, err)
+	request = httptest.NewRequest("GET", "/hello?token=rahasia&name=Akbar", nil)
+	request.Header.Set("Referer", "http://example.com/verify?token=rahasia")
+	_, err = app.Test(request)
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Regexp(t, regexp.MustCompile(
+		`^0\.0\.0\.0 - jalal \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /hello\?name=Akbar HTTP/1\.1" 200 11 "http://example\.com/" "curl/8\.0 \\"test\\"" "-" "-"$`),
+		lines[0])
+	assert.Regexp(t, regexp.MustCompile(`^0\.0\.0\.0 - - \[.*\] "GET /missing HTTP/1\.1" 404 - "-" "-" "-" "-"$`), lines[1])
+	assert.Contains(t, lines[2], `"GET /hello?name=Akbar&token=%5BREDACTED%5D HTTP/1.1" 200 11 "http://example.com/verify?token=%5BREDACTED%5D"`)
+	assert.NotContains(t, output.String(), "rahasia")
+}
+
+type jakarta struct{}
+
+func (jakarta) Locate(net.IP) (geoip.Location, error) {
+	return geoip.Location{Country: "ID", City: "Jakarta"}, nil
+}
+
+func TestAccessLogLocation(t *testing.T) {
+	output := new(bytes.Buffer)
+	app := fiber.New()
+	app.Use(AccessLog(output, redact.New(config.Default().Log.Redact)), geoip.Middleware(jakarta{}, nil))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	_, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(output.String(), ` "ID" "Jakarta"`+"\n"), output.String())
+}
+
+func TestRotatingFileBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	file, err := OpenRotatingFile(path, 10, 0, 2)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := file.Write([]byte(line))
+		assert.Nil(t, err)
+	}
+
+	current, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "fourth\n", string(current))
+
+	backups, err := filepath.Glob(path + ".*")
+	assert.Nil(t, err)
+	assert.Len(t, backups, 2)
+	oldest, err := os.ReadFile(backups[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "second\n", string(oldest))
+}
+
+func TestRotatingFileByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	now := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	file, err := OpenRotatingFile(path, 0, time.Hour, 0)
+	assert.Nil(t, err)
+	defer file.Close()
+	file.now = func() time.Time { return now }
+	file.openedAt = now
+
+	_, err = file.Write([]byte("before\n"))
+	assert.Nil(t, err)
+	now = now.Add(time.Hour)
+	_, err = file.Write([]byte("after\n"))
+	assert.Nil(t, err)
+
+	current, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "after\n", string(current))
+	_, err = os.Stat(path + ".20231101T010000.000000000")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type levelBody struct {
+	Level string `json:"level"`
+}
+
+var levels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// GetLevel reports the current level of lv.
+func GetLevel(lv *slog.LevelVar) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(levelBody{Level: strings.ToLower(lv.Level().String())})
+	}
+}
+
+// SetLevel changes lv at runtime from a body like {"level":"debug"}.
+func SetLevel(lv *slog.LevelVar, logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		body := new(levelBody)
+		if err := c.BodyParser(body); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		level, ok := levels[strings.ToLower(body.Level)]
+		if !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "level must be one of debug, info, warn, error")
+		}
+
+		previous := lv.Level()
+		lv.Set(level)
+		logger.InfoContext(c.UserContext(), "log level changed",
+			slog.String("from", strings.ToLower(previous.String())),
+			slog.String("to", strings.ToLower(level.String())),
+		)
+		return c.JSON(levelBody{Level: strings.ToLower(level.String())})
+	}
+}
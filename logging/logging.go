@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/redact"
+)
+
+// New returns a JSON logger that adds the request and correlation IDs found
+// in the context to every record logged with one of the *Context methods.
+// Attributes that redactor, if not nil, takes for secrets are redacted.
+func New(w io.Writer, level slog.Leveler, redactor *redact.Redactor) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+	if redactor != nil {
+		options.ReplaceAttr = redactor.ReplaceAttr
+	}
+	return slog.New(contextHandler{slog.NewJSONHandler(w, options)})
+}
+
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := correlation.RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if id := correlation.CorrelationID(ctx); id != "" {
+		record.AddAttrs(slog.String("correlation_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,201 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/redact"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/jalal-akbar/belajar-golang-fiber/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeLines(t *testing.T, output string) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		record := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestMiddlewareGeneratesRequestID(t *testing.T) {
+	output := new(bytes.Buffer)
+	app := fiber.New()
+	app.Use(Middleware(New(output, slog.LevelInfo, nil)))
+	app.Get("/hello", func(c *fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+
+	response, err := app.Test(httptest.NewRequest("GET", "/hello", nil))
+	assert.Nil(t, err)
+	requestID := response.Header.Get("X-Request-ID")
+	assert.NotEmpty(t, requestID)
+	assert.Equal(t, requestID, response.Header.Get("X-Correlation-ID"))
+
+	records := decodeLines(t, output.String())
+	assert.Equal(t, "request", records[0]["msg"])
+	assert.Equal(t, "/hello", records[0]["path"])
+	assert.Equal(t, float64(200), records[0]["status"])
+	assert.Equal(t, requestID, records[0]["request_id"])
+}
+
+func TestMiddlewareLogsKeptTraces(t *testing.T) {
+	output := new(bytes.Buffer)
+	app := fiber.New()
+	app.Use(Middleware(New(output, slog.LevelInfo, nil)))
+	app.Use(tracing.New(config.TracingConfig{Tail: config.TailSamplingConfig{Errors: true}}, nil).Middleware())
+	app.Get("/ok", func(c *fiber.Ctx) error { return nil })
+	app.Get("/fail", func(c *fiber.Ctx) error { return fiber.ErrServiceUnavailable })
+
+	testkit.Do(t, app, "GET", "/ok", nil).AssertStatus(200)
+	response := testkit.Do(t, app, "GET", "/fail", nil).AssertStatus(503)
+
+	records := decodeLines(t, output.String())
+	assert.NotContains(t, records[0], "trace_id")
+	assert.Equal(t, strings.Split(response.Header.Get(tracing.HeaderTraceResponse), "-")[1], records[1]["trace_id"])
+}
+
+func TestRequestIDReachesBackgroundWork(t *testing.T) {
+	output := new(bytes.Buffer)
+	logger := New(output, slog.LevelInfo, nil)
+
+	var wg sync.WaitGroup
+	var jobMetadata correlation.Metadata
+	app := fiber.New()
+	app.Use(Middleware(logger))
+	app.Post("/orders", func(c *fiber.Ctx) error {
+		ctx := correlation.Detach(c.UserContext())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jobMetadata = correlation.From(ctx)
+			logger.InfoContext(ctx, "order job finished")
+		}()
+		return c.SendStatus(fiber.StatusAccepted)
+	})
+
+	request := httptest.NewRequest("POST", "/orders", nil)
+	request.Header.Set("X-Request-ID", "req-1")
+	request.Header.Set("X-Correlation-ID", "action-1")
+	_, err := app.Test(request)
+	assert.Nil(t, err)
+	wg.Wait()
+
+	assert.Equal(t, "req-1", jobMetadata["X-Request-ID"])
+	assert.Equal(t, "action-1", jobMetadata["X-Correlation-ID"])
+
+	for _, record := range decodeLines(t, output.String()) {
+		assert.Equal(t, "req-1", record["request_id"])
+		assert.Equal(t, "action-1", record["correlation_id"])
+	}
+}
+
+func TestSlowRequests(t *testing.T) {
+	output := new(bytes.Buffer)
+	registry := metrics.NewRegistry()
+	app := fiber.New()
+	app.Use(SlowRequests(New(output, slog.LevelInfo, nil), registry, config.LogConfig{
+		SlowRequest:      20 * time.Millisecond,
+		LargeResponse:    10,
+		BodySampleLength: 8,
+	}))
+	app.Post("/slow", func(c *fiber.Ctx) error {
+		ctxutil.SetCurrentUser(c, "jalal")
+		time.Sleep(30 * time.Millisecond)
+		return c.SendString("ok")
+	}).Name("slow")
+	app.Get("/large", func(c *fiber.Ctx) error {
+		return c.SendString("this response is too large")
+	})
+	app.Get("/fast", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	request := httptest.NewRequest("POST", "/slow", strings.NewReader(`{"username":"akbar"}`))
+	_, err := app.Test(request)
+	assert.Nil(t, err)
+	_, err = app.Test(httptest.NewRequest("GET", "/large", nil))
+	assert.Nil(t, err)
+	_, err = app.Test(httptest.NewRequest("GET", "/fast", nil))
+	assert.Nil(t, err)
+
+	records := decodeLines(t, output.String())
+	assert.Len(t, records, 2)
+	assert.Equal(t, "slow", records[0]["route"])
+	assert.Equal(t, true, records[0]["slow"])
+	assert.Equal(t, "jalal", records[0]["user_id"])
+	assert.Equal(t, `{"userna…`, records[0]["body_sample"])
+	assert.Equal(t, "/large", records[1]["route"])
+	assert.Equal(t, true, records[1]["large"])
+
+	assert.Equal(t, float64(1), registry.Counter("http_slow_requests_total", "", "route").With("slow").Value())
+	assert.Equal(t, float64(1), registry.Counter("http_large_responses_total", "", "route").With("/large").Value())
+}
+
+func TestRedaction(t *testing.T) {
+	output := new(bytes.Buffer)
+	cfg := config.Default().Log
+	cfg.SlowRequest = time.Nanosecond
+	cfg.BodySampleLength = 100
+	logger := New(output, slog.LevelInfo, redact.New(cfg.Redact))
+	app := fiber.New()
+	app.Use(SlowRequests(logger, metrics.NewRegistry(), cfg))
+	app.Post("/login", func(c *fiber.Ctx) error {
+		logger.Info("signing in",
+			slog.String("authorization", c.Get("Authorization")),
+			slog.String("url", c.OriginalURL()),
+			slog.Group("user", slog.String("name", "akbar"), slog.String("password", "hunter2")),
+		)
+		return c.SendString("ok")
+	})
+
+	testkit.DoJSON(t, app, "POST", "/login?api_key=k3y", map[string]string{"username": "akbar", "password": "hunter2"}, nil,
+		testkit.WithAuth("rahasia")).AssertStatus(200)
+
+	records := decodeLines(t, output.String())
+	assert.Len(t, records, 2)
+	assert.Equal(t, redact.Redacted, records[0]["authorization"])
+	assert.Equal(t, "/login?api_key=%5BREDACTED%5D", records[0]["url"])
+	assert.Equal(t, map[string]any{"name": "akbar", "password": redact.Redacted}, records[0]["user"])
+	assert.Equal(t, `{"password":"[REDACTED]","username":"akbar"}`, records[1]["body_sample"])
+	for _, secret := range []string{"hunter2", "rahasia", "k3y"} {
+		assert.NotContains(t, output.String(), secret)
+	}
+}
+
+func TestRuntimeLogLevel(t *testing.T) {
+	output := new(bytes.Buffer)
+	level := new(slog.LevelVar)
+	logger := New(output, level, nil)
+
+	app := fiber.New()
+	app.Get("/loglevel", GetLevel(level))
+	app.Put("/loglevel", SetLevel(level, logger))
+
+	testkit.Do(t, app, "GET", "/loglevel", nil).AssertBody(`{"level":"info"}`)
+
+	logger.Debug("hidden")
+	assert.Equal(t, "", output.String())
+
+	testkit.DoJSON(t, app, "PUT", "/loglevel", `{"level":"debug"}`, nil).AssertStatus(200)
+	assert.Equal(t, slog.LevelDebug, level.Level())
+
+	logger.Debug("visible")
+	assert.Contains(t, output.String(), "visible")
+
+	testkit.DoJSON(t, app, "PUT", "/loglevel", `{"level":"loud"}`, nil).AssertStatus(400)
+	assert.Equal(t, slog.LevelDebug, level.Level())
+}
@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/geoip"
+	"github.com/jalal-akbar/belajar-golang-fiber/middleware"
+	"github.com/jalal-akbar/belajar-golang-fiber/tracing"
+)
+
+// Middleware assigns every request an ID, stores it together with the other
+// correlation headers in the user context, and logs the request once it has
+// been handled. The correlation ID defaults to the request ID of the first
+// service that saw the request.
+func Middleware(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		md := correlation.FromHeaders(c)
+		if md[correlation.HeaderRequestID] == "" {
+			md[correlation.HeaderRequestID] = utils.UUIDv4()
+		}
+		if md[correlation.HeaderCorrelationID] == "" {
+			md[correlation.HeaderCorrelationID] = md[correlation.HeaderRequestID]
+		}
+		requestID := md[correlation.HeaderRequestID]
+
+		ctx := correlation.With(c.UserContext(), md)
+		c.SetUserContext(ctx)
+		ctxutil.SetRequestID(c, requestID)
+		c.Set(correlation.HeaderRequestID, requestID)
+		c.Set(correlation.HeaderCorrelationID, md[correlation.HeaderCorrelationID])
+
+		err := c.Next()
+
+		status := responseStatus(c, err)
+
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Method()),
+			slog.String("path", c.Path()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("ip", middleware.RealIP(c)),
+			slog.Int("bytes", responseSize(c)),
+		}
+		if location, ok := geoip.From(c); ok {
+			attrs = append(attrs, slog.String("country", location.Country), slog.String("city", location.City))
+		}
+		if trace, ok := tracing.From(c); ok && trace.Kept {
+			attrs = append(attrs, slog.String("trace_id", trace.ID))
+		}
+		logger.LogAttrs(ctx, level, "request", attrs...)
+		return err
+	}
+}
+
+// responseStatus is the status the error handler will send for err.
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// responseSize avoids Body() on streamed responses, which would read the
+// whole stream into memory.
+func responseSize(c *fiber.Ctx) int {
+	if c.Response().IsBodyStream() {
+		return c.Response().Header.ContentLength()
+	}
+	return len(c.Response().Body())
+}
@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/redact"
+)
+
+// SlowRequests logs a warning, with a sample of the request body, for every
+// request slower than cfg.SlowRequest or whose response is larger than
+// cfg.LargeResponse, and counts them per route. The secrets cfg.Redact
+// lists are redacted from the sample.
+func SlowRequests(logger *slog.Logger, registry *metrics.Registry, cfg config.LogConfig) fiber.Handler {
+	slow := registry.Counter("http_slow_requests_total", "Requests slower than the configured threshold.", "route")
+	large := registry.Counter("http_large_responses_total", "Responses larger than the configured threshold.", "route")
+	redactor := redact.New(cfg.Redact)
+
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		latency := time.Since(start)
+		size := responseSize(c)
+
+		isSlow := cfg.SlowRequest > 0 && latency > cfg.SlowRequest
+		isLarge := cfg.LargeResponse > 0 && size > cfg.LargeResponse
+		if !isSlow && !isLarge {
+			return err
+		}
+
+		route := c.Route().Name
+		if route == "" {
+			route = c.Route().Path
+		}
+		if isSlow {
+			slow.With(route).Inc()
+		}
+		if isLarge {
+			large.With(route).Inc()
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Method()),
+			slog.String("path", c.Path()),
+			slog.String("route", route),
+			slog.Duration("latency", latency),
+			slog.Int("bytes", size),
+			slog.Bool("slow", isSlow),
+			slog.Bool("large", isLarge),
+			slog.String("body_sample", bodySample(redactor.Body(string(c.Request().Header.ContentType()), string(c.Body())), cfg.BodySampleLength)),
+		}
+		if user := ctxutil.CurrentUser(c); user != "" {
+			attrs = append(attrs, slog.String("user_id", user))
+		}
+		logger.LogAttrs(c.UserContext(), slog.LevelWarn, "slow or large request", attrs...)
+		return err
+	}
+}
+
+func bodySample(body string, limit int) string {
+	if len(body) <= limit {
+		return body
+	}
+	return body[:limit] + "…"
+}
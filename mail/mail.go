@@ -0,0 +1,90 @@
+// Package mail sends plain-text email.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Sender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// New returns an SMTP sender, or one that only logs the messages when no
+// SMTP server is configured.
+func New(cfg config.MailConfig, logger *slog.Logger) Sender {
+	if cfg.SMTPAddr == "" {
+		return LogSender{Logger: logger}
+	}
+	return &SMTP{cfg: cfg}
+}
+
+// LogSender logs messages instead of sending them, for development.
+type LogSender struct {
+	Logger *slog.Logger
+}
+
+func (s LogSender) Send(ctx context.Context, message Message) error {
+	s.Logger.InfoContext(ctx, "mail not sent, no smtp server configured",
+		slog.String("to", message.To),
+		slog.String("subject", message.Subject),
+		slog.String("body", message.Body),
+	)
+	return nil
+}
+
+type SMTP struct {
+	cfg config.MailConfig
+}
+
+// Send delivers the message over SMTP, with STARTTLS when the server
+// offers it and PLAIN auth when a username is configured.
+func (s *SMTP) Send(ctx context.Context, message Message) error {
+	if strings.ContainsAny(message.To+message.Subject, "\r\n") {
+		return fmt.Errorf("mail: header contains a line break")
+	}
+	host, _, err := net.SplitHostPort(s.cfg.SMTPAddr)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, host)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.cfg.SMTPAddr, auth, s.cfg.From, []string{message.To}, s.format(message))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *SMTP) format(message Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", message.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,79 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMTP accepts one message and returns what the client sent.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost")
+		var transcript strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			transcript.WriteString(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case command == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					transcript.WriteString(line)
+				}
+				reply("250 ok")
+			case command == "QUIT":
+				reply("221 bye")
+				received <- transcript.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSMTP(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	sender := New(config.MailConfig{SMTPAddr: addr, From: "app@example.com"}, nil)
+
+	err := sender.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello", Body: "line one\nline two"})
+	assert.Nil(t, err)
+	transcript := <-received
+	assert.Contains(t, transcript, "MAIL FROM:<app@example.com>")
+	assert.Contains(t, transcript, "RCPT TO:<user@example.com>")
+	assert.Contains(t, transcript, "Subject: Hello\r\n")
+	assert.Contains(t, transcript, "line one\r\nline two")
+}
+
+func TestSMTPRejectsHeaderInjection(t *testing.T) {
+	sender := New(config.MailConfig{SMTPAddr: "127.0.0.1:25"}, nil)
+	err := sender.Send(context.Background(), Message{To: "user@example.com\r\nBcc: everyone@example.com"})
+	assert.NotNil(t, err)
+}
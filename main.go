@@ -1,19 +1,41 @@
 package main
 
 import (
-	"time"
+	"os"
 
-	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/server"
 )
 
 func main() {
-	app := fiber.New(fiber.Config{
-		IdleTimeout:  time.Second * 5,
-		ReadTimeout:  time.Second * 5,
-		WriteTimeout: time.Second * 5,
-	})
+	cfg, err := config.Load()
+	if err != nil {
+		panic(err)
+	}
+
+	// "replay <file or dir>..." replays recorded requests instead of
+	// serving.
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		matched, err := replay(cfg, os.Args[2:], os.Stdout)
+		if err != nil {
+			panic(err)
+		}
+		if !matched {
+			os.Exit(1)
+		}
+		return
+	}
 
-	err := app.Listen("localhost:3000")
+	app, err := newApp(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	if cfg.Server.GracefulRestart {
+		err = server.ListenGraceful(app, cfg)
+	} else {
+		err = server.Listen(app, cfg)
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,141 @@
+// Package messaging sends text messages to phone numbers, by SMS or
+// WhatsApp.
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+)
+
+const (
+	SMS      = "sms"
+	WhatsApp = "whatsapp"
+)
+
+type Message struct {
+	To   string
+	Body string
+}
+
+// Sender delivers messages over one channel, named by Name.
+type Sender interface {
+	Name() string
+	Send(ctx context.Context, message Message) error
+}
+
+// number is an E.164 phone number: a plus and up to 15 digits.
+var number = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// ValidNumber checks that phone is an E.164 number such as +6281234567890.
+func ValidNumber(phone string) error {
+	if !number.MatchString(phone) {
+		return errors.New("phone must be an E.164 number such as +6281234567890")
+	}
+	return nil
+}
+
+// Twilio sends messages through the Twilio Messages API, or any API that
+// speaks it. WhatsApp messages go through the same API with addresses
+// prefixed "whatsapp:".
+type Twilio struct {
+	cfg     config.MessagingConfig
+	client  *httpclient.Client
+	channel string
+	from    string
+}
+
+// NewSMS sends SMS from cfg.From.
+func NewSMS(cfg config.MessagingConfig, client *httpclient.Client) *Twilio {
+	return &Twilio{cfg: cfg, client: client, channel: SMS, from: cfg.From}
+}
+
+// NewWhatsApp sends WhatsApp messages from cfg.WhatsAppFrom.
+func NewWhatsApp(cfg config.MessagingConfig, client *httpclient.Client) *Twilio {
+	return &Twilio{cfg: cfg, client: client, channel: WhatsApp, from: cfg.WhatsAppFrom}
+}
+
+func (t *Twilio) Name() string { return t.channel }
+
+func (t *Twilio) Send(ctx context.Context, message Message) error {
+	if err := ValidNumber(message.To); err != nil {
+		return fmt.Errorf("messaging: %w", err)
+	}
+	to, from := message.To, t.from
+	if t.channel == WhatsApp {
+		to, from = "whatsapp:"+to, "whatsapp:"+from
+	}
+	form := url.Values{"To": {to}, "From": {from}, "Body": {message.Body}}
+	endpoint := strings.TrimSuffix(t.cfg.BaseURL, "/") + "/2010-04-01/Accounts/" + url.PathEscape(t.cfg.AccountSID) + "/Messages.json"
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(t.cfg.AccountSID, t.cfg.AuthToken)
+	response, err := t.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		var failure struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(response.Body).Decode(&failure) == nil && failure.Message != "" {
+			return fmt.Errorf("messaging: %s returned %s: %d %s", t.channel, response.Status, failure.Code, failure.Message)
+		}
+		return fmt.Errorf("messaging: %s returned %s", t.channel, response.Status)
+	}
+	return nil
+}
+
+// Mock keeps the messages instead of sending them, failing with Err when
+// it is set. It stands in for the real channels in tests and development.
+type Mock struct {
+	Channel string
+
+	mu       sync.Mutex
+	err      error
+	messages []Message
+}
+
+func NewMock(channel string) *Mock {
+	return &Mock{Channel: channel}
+}
+
+func (m *Mock) Name() string { return m.Channel }
+
+func (m *Mock) Send(_ context.Context, message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Fail makes the following sends fail with err, or succeed again for nil.
+func (m *Mock) Fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Sent returns the messages sent so far.
+func (m *Mock) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message{}, m.messages...)
+}
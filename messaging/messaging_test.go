@@ -0,0 +1,52 @@
+package messaging
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTwilio(t *testing.T) {
+	api := testkit.NewMock(t, nil)
+	api.Respond(http.StatusCreated, `{"sid":"SM1","status":"queued"}`)
+	cfg := config.MessagingConfig{BaseURL: api.URL, AccountSID: "AC1", AuthToken: "token", From: "+15005550006", WhatsAppFrom: "+14155238886"}
+	client := httpclient.New(config.Default().HTTPClient)
+	ctx := context.Background()
+
+	sms := NewSMS(cfg, client)
+	assert.Equal(t, SMS, sms.Name())
+	assert.Nil(t, sms.Send(ctx, Message{To: "+6281234567890", Body: "Your code is 123456"}))
+	assert.Nil(t, NewWhatsApp(cfg, client).Send(ctx, Message{To: "+6281234567890", Body: "Order 7 shipped"}))
+
+	requests := api.Requests()
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "/2010-04-01/Accounts/AC1/Messages.json", requests[0].Path)
+	user, password, _ := (&http.Request{Header: requests[0].Header}).BasicAuth()
+	assert.Equal(t, "AC1:token", user+":"+password)
+	form, err := url.ParseQuery(string(requests[0].Body))
+	assert.Nil(t, err)
+	assert.Equal(t, url.Values{"To": {"+6281234567890"}, "From": {"+15005550006"}, "Body": {"Your code is 123456"}}, form)
+	form, _ = url.ParseQuery(string(requests[1].Body))
+	assert.Equal(t, "whatsapp:+6281234567890", form.Get("To"))
+	assert.Equal(t, "whatsapp:+14155238886", form.Get("From"))
+
+	api.Respond(http.StatusBadRequest, `{"code":21211,"message":"Invalid 'To' Phone Number"}`)
+	err = sms.Send(ctx, Message{To: "+6281234567890", Body: "hi"})
+	assert.EqualError(t, err, "messaging: sms returned 400 Bad Request: 21211 Invalid 'To' Phone Number")
+	assert.NotNil(t, sms.Send(ctx, Message{To: "081234567890", Body: "hi"}))
+	assert.Len(t, api.Requests(), 3)
+}
+
+func TestValidNumber(t *testing.T) {
+	assert.Nil(t, ValidNumber("+6281234567890"))
+	assert.Nil(t, ValidNumber("+15005550006"))
+	for _, phone := range []string{"", "6281234567890", "+0812345678", "+62 812 3456", "+1234567890123456", "+62812345678\n"} {
+		assert.NotNil(t, ValidNumber(phone), phone)
+	}
+}
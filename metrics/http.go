@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HTTP groups the request metrics recorded by its middleware.
+type HTTP struct {
+	Requests *CounterVec
+	Duration *HistogramVec
+	InFlight *GaugeVec
+}
+
+func NewHTTP(r *Registry) *HTTP {
+	return &HTTP{
+		Requests: r.Counter("http_requests_total", "HTTP requests handled.", "method", "route", "status"),
+		Duration: r.Histogram("http_request_duration_seconds", "HTTP request latency.", DefaultBuckets, "method", "route"),
+		InFlight: r.Gauge("http_requests_in_flight", "HTTP requests currently being handled."),
+	}
+}
+
+// Middleware labels requests by route pattern rather than raw path, so
+// path parameters don't blow up the number of series.
+func (m *HTTP) Middleware() fiber.Handler {
+	inFlight := m.InFlight.With()
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		err := c.Next()
+
+		method := c.Method()
+		route := routeLabel(c, err)
+		m.Requests.With(method, route, strconv.Itoa(responseStatus(c, err))).Inc()
+		m.Duration.With(method, route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// routeLabel reports requests that matched no route as "unmatched"; fiber
+// answers those with "Cannot <METHOD> <path>".
+func routeLabel(c *fiber.Ctx, err error) string {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusNotFound && strings.HasPrefix(fiberErr.Message, "Cannot ") {
+		return "unmatched"
+	}
+	return c.Route().Path
+}
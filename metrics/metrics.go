@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds the metric families exported at /metrics in the Prometheus
+// text format. Asking for an existing name returns the family registered
+// first, so subsystems can share metrics without passing them around.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+	onScrape []func()
+}
+
+type family interface {
+	write(w *bufio.Writer, openMetrics bool)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]family{}}
+}
+
+func (r *Registry) register(name string, create func() family) family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		return f
+	}
+	f := create()
+	r.families[name] = f
+	return f
+}
+
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	return r.register(name, func() family {
+		return &CounterVec{vec: newVec(name, help, "counter", labels)}
+	}).(*CounterVec)
+}
+
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	return r.register(name, func() family {
+		return &GaugeVec{vec: newVec(name, help, "gauge", labels)}
+	}).(*GaugeVec)
+}
+
+// GaugeFunc exports the value returned by fn at scrape time.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, func() family {
+		return &gaugeFunc{name: name, help: help, fn: fn}
+	})
+}
+
+// OnScrape calls fn before every scrape, to update metrics that are read
+// from elsewhere rather than counted as things happen.
+func (r *Registry) OnScrape(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onScrape = append(r.onScrape, fn)
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return r.register(name, func() family {
+		return &HistogramVec{vec: newVec(name, help, "histogram", labels), buckets: buckets}
+	}).(*HistogramVec)
+}
+
+// Write writes the metrics in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	return r.write(w, false)
+}
+
+// WriteOpenMetrics writes the metrics in the OpenMetrics text format,
+// which names counter families without their _total suffix and ends with
+// "# EOF".
+func (r *Registry) WriteOpenMetrics(w io.Writer) error {
+	return r.write(w, true)
+}
+
+func (r *Registry) write(w io.Writer, openMetrics bool) error {
+	r.mu.Lock()
+	hooks := r.onScrape
+	r.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make([]family, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		families = append(families, r.families[name])
+	}
+	r.mu.Unlock()
+
+	buffered := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(buffered, openMetrics)
+	}
+	if openMetrics {
+		buffered.WriteString("# EOF\n")
+	}
+	return buffered.Flush()
+}
+
+// Handler serves the metrics in the OpenMetrics format to scrapers that
+// accept it and in the Prometheus text format to the rest.
+func (r *Registry) Handler(c *fiber.Ctx) error {
+	if strings.Contains(c.Get(fiber.HeaderAccept), openMetricsType) {
+		c.Set(fiber.HeaderContentType, openMetricsType+"; version=1.0.0; charset=utf-8")
+		return r.WriteOpenMetrics(c)
+	}
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return r.Write(c)
+}
+
+const openMetricsType = "application/openmetrics-text"
+
+// vec keeps one child per distinct combination of label values.
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu       sync.Mutex
+	children map[string]interface{}
+	values   map[string][]string
+}
+
+func newVec(name, help, kind string, labels []string) vec {
+	return vec{
+		name:     name,
+		help:     help,
+		kind:     kind,
+		labels:   labels,
+		children: map[string]interface{}{},
+		values:   map[string][]string{},
+	}
+}
+
+func (v *vec) child(values []string, create func() interface{}) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.children[key]
+	if !ok {
+		c = create()
+		v.children[key] = c
+		v.values[key] = append([]string(nil), values...)
+	}
+	return c
+}
+
+// each calls fn for every child, with its label values, in a stable order.
+func (v *vec) each(fn func(values []string, child interface{})) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	children := make([]interface{}, len(keys))
+	values := make([][]string, len(keys))
+	for i, key := range keys {
+		children[i] = v.children[key]
+		values[i] = v.values[key]
+	}
+	v.mu.Unlock()
+
+	for i := range keys {
+		fn(values[i], children[i])
+	}
+}
+
+func (v *vec) header(w *bufio.Writer, openMetrics bool) {
+	name := v.name
+	if openMetrics && v.kind == "counter" {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, v.help, name, v.kind)
+}
+
+func formatLabels(names, values []string, extra ...string) string {
+	pairs := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		pairs = append(pairs, name+"="+strconv.Quote(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+strconv.Quote(extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryExposition(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("uploads_total", "Uploaded files.", "status").With("ok").Add(2)
+	registry.Gauge("queue_depth", "Jobs waiting.").With().Set(3)
+	histogram := registry.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	histogram.With("/a").Observe(0.05)
+	histogram.With("/a").Observe(0.5)
+	histogram.With("/a").Observe(5)
+
+	output := new(bytes.Buffer)
+	assert.Nil(t, registry.Write(output))
+	assert.Equal(t, `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 5.55
+latency_seconds_count{route="/a"} 3
+# HELP queue_depth Jobs waiting.
+# TYPE queue_depth gauge
+queue_depth 3
+# HELP uploads_total Uploaded files.
+# TYPE uploads_total counter
+uploads_total{status="ok"} 2
+`, output.String())
+}
+
+func TestOpenMetrics(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("uploads_total", "Uploaded files.", "status").With("ok").Add(2)
+	registry.Counter("retries", "Retries.").With().Inc()
+	registry.Gauge("queue_depth", "Jobs waiting.").With().Set(3)
+	app := fiber.New()
+	app.Get("/metrics", registry.Handler)
+
+	request := httptest.NewRequest("GET", "/metrics", nil)
+	request.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/openmetrics-text; version=1.0.0; charset=utf-8", response.Header.Get("Content-Type"))
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `# HELP queue_depth Jobs waiting.
+# TYPE queue_depth gauge
+queue_depth 3
+# HELP retries Retries.
+# TYPE retries counter
+retries_total 1
+# HELP uploads Uploaded files.
+# TYPE uploads counter
+uploads_total{status="ok"} 2
+# EOF
+`, string(body))
+
+	response, err = app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", response.Header.Get("Content-Type"))
+}
+
+func TestRegistryReturnsExistingFamily(t *testing.T) {
+	registry := NewRegistry()
+	first := registry.Counter("logins_total", "Logins.", "result")
+	second := registry.Counter("logins_total", "Logins.", "result")
+	first.With("ok").Inc()
+	assert.Equal(t, float64(1), second.With("ok").Value())
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := &Histogram{bounds: []float64{1, 2, 4}, counts: make([]uint64, 4)}
+	for i := 0; i < 50; i++ {
+		h.Observe(0.5)
+	}
+	for i := 0; i < 50; i++ {
+		h.Observe(3)
+	}
+	snapshot := h.Snapshot()
+	assert.Equal(t, 1.0, snapshot.Quantile(0.5))
+	assert.Equal(t, 3.8, snapshot.Quantile(0.95))
+	assert.Equal(t, 1.75, snapshot.Mean())
+
+	h.Observe(3)
+	diff := h.Snapshot().Sub(snapshot)
+	assert.Equal(t, uint64(1), diff.Count)
+	assert.Equal(t, 3.0, diff.Mean())
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	registry := NewRegistry()
+	m := NewHTTP(registry)
+
+	app := fiber.New()
+	app.Use(m.Middleware())
+	app.Get("/users/:id", func(c *fiber.Ctx) error {
+		return c.SendString("user " + c.Params("id"))
+	})
+	app.Get("/metrics", registry.Handler)
+
+	for _, path := range []string{"/users/1", "/users/2", "/nowhere"} {
+		_, err := app.Test(httptest.NewRequest("GET", path, nil))
+		assert.Nil(t, err)
+	}
+
+	response, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	assert.Nil(t, err)
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), `http_requests_total{method="GET",route="/users/:id",status="200"} 2`)
+	assert.Contains(t, string(body), `http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, string(body), `http_request_duration_seconds_count{method="GET",route="/users/:id"} 2`)
+}
@@ -0,0 +1,17 @@
+package metrics
+
+import (
+	"runtime"
+)
+
+// RegisterRuntime exports goroutine and heap gauges read at scrape time.
+func RegisterRuntime(r *Registry) {
+	r.GaugeFunc("go_goroutines", "Number of goroutines.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	r.GaugeFunc("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", func() float64 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		return float64(stats.HeapAlloc)
+	})
+}
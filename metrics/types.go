@@ -0,0 +1,251 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.mu.Lock()
+	c.value += delta
+	c.mu.Unlock()
+}
+
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+type CounterVec struct {
+	vec
+}
+
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.child(values, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+// Total sums the counter over all label values.
+func (v *CounterVec) Total() float64 {
+	total := 0.0
+	v.each(func(_ []string, child interface{}) {
+		total += child.(*Counter).Value()
+	})
+	return total
+}
+
+func (v *CounterVec) write(w *bufio.Writer, openMetrics bool) {
+	v.header(w, openMetrics)
+	// OpenMetrics counter samples always end in _total.
+	name := v.name
+	if openMetrics && !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+	v.each(func(values []string, child interface{}) {
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(v.labels, values), formatFloat(child.(*Counter).Value()))
+	})
+}
+
+type Gauge struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (g *Gauge) Set(value float64) {
+	g.mu.Lock()
+	g.value = value
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.mu.Lock()
+	g.value += delta
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+type GaugeVec struct {
+	vec
+}
+
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.child(values, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+func (v *GaugeVec) write(w *bufio.Writer, openMetrics bool) {
+	v.header(w, openMetrics)
+	v.each(func(values []string, child interface{}) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, values), formatFloat(child.(*Gauge).Value()))
+	})
+}
+
+type gaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer, _ bool) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.fn()))
+}
+
+// HistogramSnapshot is a point-in-time copy of a histogram. Counts are per
+// bucket (not cumulative), with the last entry counting observations above
+// the highest bound.
+type HistogramSnapshot struct {
+	Bounds []float64
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+// Sub returns the observations made between prev and s.
+func (s HistogramSnapshot) Sub(prev HistogramSnapshot) HistogramSnapshot {
+	if len(prev.Counts) != len(s.Counts) {
+		return s
+	}
+	diff := HistogramSnapshot{
+		Bounds: s.Bounds,
+		Counts: make([]uint64, len(s.Counts)),
+		Count:  s.Count - prev.Count,
+		Sum:    s.Sum - prev.Sum,
+	}
+	for i := range s.Counts {
+		diff.Counts[i] = s.Counts[i] - prev.Counts[i]
+	}
+	return diff
+}
+
+func (s HistogramSnapshot) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// Quantile estimates the q-quantile by interpolating linearly inside the
+// bucket that contains it, like Prometheus' histogram_quantile.
+func (s HistogramSnapshot) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := q * float64(s.Count)
+	seen := 0.0
+	for i, count := range s.Counts {
+		if seen+float64(count) < rank {
+			seen += float64(count)
+			continue
+		}
+		if i == len(s.Bounds) {
+			return s.Bounds[len(s.Bounds)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = s.Bounds[i-1]
+		}
+		return lower + (s.Bounds[i]-lower)*(rank-seen)/float64(count)
+	}
+	return s.Bounds[len(s.Bounds)-1]
+}
+
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *Histogram) Observe(value float64) {
+	i := 0
+	for i < len(h.bounds) && value > h.bounds[i] {
+		i++
+	}
+	h.mu.Lock()
+	h.counts[i]++
+	h.count++
+	h.sum += value
+	h.mu.Unlock()
+}
+
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HistogramSnapshot{
+		Bounds: h.bounds,
+		Counts: append([]uint64(nil), h.counts...),
+		Count:  h.count,
+		Sum:    h.sum,
+	}
+}
+
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.child(values, func() interface{} {
+		return &Histogram{bounds: v.buckets, counts: make([]uint64, len(v.buckets)+1)}
+	}).(*Histogram)
+}
+
+// Merged adds up the histograms of all label values.
+func (v *HistogramVec) Merged() HistogramSnapshot {
+	merged := HistogramSnapshot{Bounds: v.buckets, Counts: make([]uint64, len(v.buckets)+1)}
+	v.each(func(_ []string, child interface{}) {
+		s := child.(*Histogram).Snapshot()
+		for i, count := range s.Counts {
+			merged.Counts[i] += count
+		}
+		merged.Count += s.Count
+		merged.Sum += s.Sum
+	})
+	return merged
+}
+
+func (v *HistogramVec) write(w *bufio.Writer, openMetrics bool) {
+	v.header(w, openMetrics)
+	v.each(func(values []string, child interface{}) {
+		s := child.(*Histogram).Snapshot()
+		cumulative := uint64(0)
+		for i, count := range s.Counts {
+			cumulative += count
+			bound := math.Inf(1)
+			if i < len(s.Bounds) {
+				bound = s.Bounds[i]
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, values, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, formatLabels(v.labels, values), formatFloat(s.Sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, formatLabels(v.labels, values), s.Count)
+	})
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminAuth only lets requests through that carry the admin token, either
+// as "Authorization: Bearer <token>" or as the password of HTTP basic auth
+// (so browser pages like the monitor can be opened directly). With an empty
+// token every request is rejected.
+func AdminAuth(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if HasAdminToken(c, token) {
+			return c.Next()
+		}
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="admin"`)
+		return fiber.ErrUnauthorized
+	}
+}
+
+// HasAdminToken reports whether the request carries the admin token, as
+// AdminAuth accepts it.
+func HasAdminToken(c *fiber.Ctx, token string) bool {
+	return token != "" && validAdminCredential(c.Get(fiber.HeaderAuthorization), token)
+}
+
+func validAdminCredential(header, token string) bool {
+	scheme, credential, _ := strings.Cut(header, " ")
+	switch strings.ToLower(scheme) {
+	case "bearer":
+	case "basic":
+		decoded, err := base64.StdEncoding.DecodeString(credential)
+		if err != nil {
+			return false
+		}
+		_, credential, _ = strings.Cut(string(decoded), ":")
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(credential), []byte(token)) == 1
+}
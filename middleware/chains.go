@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Chains names the middlewares route groups are protected with and puts
+// them together into presets, so which protections apply where is set in
+// one place.
+type Chains struct {
+	middlewares map[string]fiber.Handler
+	presets     map[string][]string
+}
+
+// NewChains composes presets, which list the names of their middlewares
+// in the order they run.
+func NewChains(presets map[string][]string) *Chains {
+	return &Chains{middlewares: map[string]fiber.Handler{}, presets: presets}
+}
+
+// Add names a middleware. A nil handler names one that is switched off:
+// presets may list it and go without.
+func (c *Chains) Add(name string, handler fiber.Handler) {
+	c.middlewares[name] = handler
+}
+
+// Build returns the middlewares of preset that are switched on. Unknown
+// presets and middlewares are errors, so a typo doesn't go unprotected.
+func (c *Chains) Build(preset string) ([]fiber.Handler, error) {
+	names, ok := c.presets[preset]
+	if !ok {
+		return nil, fmt.Errorf("middleware: unknown preset %q", preset)
+	}
+	var handlers []fiber.Handler
+	for _, name := range names {
+		handler, ok := c.middlewares[name]
+		if !ok {
+			return nil, fmt.Errorf("middleware: unknown middleware %q in preset %q", name, preset)
+		}
+		if handler != nil {
+			handlers = append(handlers, handler)
+		}
+	}
+	return handlers, nil
+}
+
+// Apply has router run the middlewares of preset for the routes under
+// prefix, an empty prefix for all of them.
+func (c *Chains) Apply(router fiber.Router, prefix, preset string) error {
+	handlers, err := c.Build(preset)
+	if err != nil || len(handlers) == 0 {
+		return err
+	}
+	args := make([]interface{}, 0, len(handlers)+1)
+	if prefix != "" {
+		args = append(args, prefix)
+	}
+	for _, handler := range handlers {
+		args = append(args, handler)
+	}
+	router.Use(args...)
+	return nil
+}
+
+// Handler lists the presets with the middlewares they apply and those
+// they skip as switched off.
+func (c *Chains) Handler(ctx *fiber.Ctx) error {
+	type chain struct {
+		Applied []string `json:"applied"`
+		Skipped []string `json:"skipped"`
+	}
+	presets := map[string]chain{}
+	for preset, names := range c.presets {
+		listed := chain{Applied: []string{}, Skipped: []string{}}
+		for _, name := range names {
+			if c.middlewares[name] != nil {
+				listed.Applied = append(listed.Applied, name)
+			} else {
+				listed.Skipped = append(listed.Skipped, name)
+			}
+		}
+		presets[preset] = listed
+	}
+	return ctx.JSON(fiber.Map{"presets": presets})
+}
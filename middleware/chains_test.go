@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChains(t *testing.T) {
+	chains := NewChains(map[string][]string{
+		"admin":      {"admin-token"},
+		"public-api": {"tag", "jwt"},
+		"typo":       {"admin-tokne"},
+	})
+	chains.Add("admin-token", AdminAuth("rahasia"))
+	chains.Add("tag", func(c *fiber.Ctx) error {
+		c.Set("X-Chain", "public-api")
+		return c.Next()
+	})
+	chains.Add("jwt", nil)
+
+	app := fiber.New()
+	assert.Nil(t, chains.Apply(app, "/admin", "admin"))
+	api := app.Group("/api")
+	assert.Nil(t, chains.Apply(api, "", "public-api"))
+	assert.NotNil(t, chains.Apply(app, "/", "typo"))
+	assert.NotNil(t, chains.Apply(app, "/", "web"))
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	app.Get("/admin/status", ok)
+	api.Get("/orders", ok)
+	app.Get("/middleware", chains.Handler)
+
+	testkit.Do(t, app, "GET", "/admin/status", nil).AssertStatus(401)
+	testkit.Do(t, app, "GET", "/admin/status", nil, testkit.WithAuth("rahasia")).AssertStatus(200)
+	// Switched off middlewares are skipped.
+	testkit.Do(t, app, "GET", "/api/orders", nil).AssertStatus(200).AssertHeader("X-Chain", "public-api")
+
+	testkit.Do(t, app, "GET", "/middleware", nil).AssertJSON(`{"presets":{
+		"admin":{"applied":["admin-token"],"skipped":[]},
+		"public-api":{"applied":["tag"],"skipped":["jwt"]},
+		"typo":{"applied":[],"skipped":["admin-tokne"]}
+	}}`)
+}
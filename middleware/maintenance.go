@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+)
+
+// Maintenance takes the app down for maintenance and back up while it
+// serves.
+type Maintenance struct {
+	bypass func(*fiber.Ctx) bool
+	cfg    atomic.Pointer[config.MaintenanceConfig]
+}
+
+// NewMaintenance starts out as cfg says. The requests bypass reports true
+// for are served regardless.
+func NewMaintenance(cfg config.MaintenanceConfig, bypass func(*fiber.Ctx) bool) *Maintenance {
+	m := &Maintenance{bypass: bypass}
+	m.Update(cfg)
+	return m
+}
+
+func (m *Maintenance) Update(cfg config.MaintenanceConfig) {
+	m.cfg.Store(&cfg)
+}
+
+// Middleware answers 503 while maintenance is on.
+func (m *Maintenance) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		cfg := m.cfg.Load()
+		if !cfg.Enabled || m.bypass(c) {
+			return c.Next()
+		}
+		if cfg.RetryAfter > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(cfg.RetryAfter.Seconds())))
+		}
+		message := cfg.Message
+		if message == "" {
+			message = "down for maintenance"
+		}
+		return fiber.NewError(fiber.StatusServiceUnavailable, message)
+	}
+}
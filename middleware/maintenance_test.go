@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+)
+
+func TestMaintenance(t *testing.T) {
+	maintenance := NewMaintenance(config.MaintenanceConfig{}, func(c *fiber.Ctx) bool {
+		return c.Path() == "/healthz"
+	})
+	app := fiber.New()
+	app.Use(maintenance.Middleware())
+	app.Get("/*", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	testkit.Do(t, app, "GET", "/orders", nil).AssertStatus(200)
+
+	maintenance.Update(config.MaintenanceConfig{Enabled: true, Message: "back at 10:00", RetryAfter: time.Hour})
+	testkit.Do(t, app, "GET", "/orders", nil).AssertStatus(503).AssertBody("back at 10:00").AssertHeader("Retry-After", "3600")
+	testkit.Do(t, app, "GET", "/healthz", nil).AssertStatus(200)
+
+	maintenance.Update(config.MaintenanceConfig{Enabled: true})
+	testkit.Do(t, app, "GET", "/orders", nil).AssertStatus(503).AssertBody("down for maintenance").AssertHeader("Retry-After", "")
+
+	maintenance.Update(config.MaintenanceConfig{})
+	testkit.Do(t, app, "GET", "/orders", nil).AssertStatus(200)
+}
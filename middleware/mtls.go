@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"crypto/x509"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+)
+
+// ClientIdentity is the verified client certificate of an mTLS connection.
+type ClientIdentity struct {
+	Subject    string
+	CommonName string
+	SPIFFEID   string
+}
+
+var clientIdentityKey = ctxutil.NewKey[ClientIdentity]("client_identity")
+
+// ExtractClientIdentity stores the identity of a verified client
+// certificate in c.Locals. Requests without one pass through unchanged.
+func ExtractClientIdentity() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		state := c.Context().TLSConnectionState()
+		if state == nil || len(state.VerifiedChains) == 0 {
+			return c.Next()
+		}
+		clientIdentityKey.Set(c, identityOf(state.VerifiedChains[0][0]))
+		return c.Next()
+	}
+}
+
+func CurrentClientIdentity(c *fiber.Ctx) (ClientIdentity, bool) {
+	identity, ok := clientIdentityKey.Get(c)
+	return identity, ok
+}
+
+// RequireClientIdentity rejects requests without a verified client
+// certificate. When allowed is not empty, the certificate's SPIFFE ID or
+// common name must be one of them.
+func RequireClientIdentity(allowed ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		identity, ok := CurrentClientIdentity(c)
+		if !ok {
+			return fiber.NewError(fiber.StatusUnauthorized, "client certificate required")
+		}
+		if len(allowed) == 0 {
+			return c.Next()
+		}
+		for _, name := range allowed {
+			if name == identity.SPIFFEID || name == identity.CommonName {
+				return c.Next()
+			}
+		}
+		return fiber.NewError(fiber.StatusForbidden, "client certificate not allowed")
+	}
+}
+
+func identityOf(cert *x509.Certificate) ClientIdentity {
+	identity := ClientIdentity{
+		Subject:    cert.Subject.String(),
+		CommonName: cert.Subject.CommonName,
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			identity.SPIFFEID = uri.String()
+			break
+		}
+	}
+	return identity
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderMethodOverride asks for a POST to be handled as another method.
+const HeaderMethodOverride = "X-HTTP-Method-Override"
+
+// overridable are the methods a POST may become. It must not become a safe
+// method, which caches and CSRF checks let through.
+var overridable = map[string]bool{
+	fiber.MethodPut:    true,
+	fiber.MethodPatch:  true,
+	fiber.MethodDelete: true,
+}
+
+// MethodOverride lets POST requests be routed as PUT, PATCH or DELETE: forms
+// under formRoutes with a _method field, and clients under headerRoutes with
+// an X-HTTP-Method-Override header. Forms from other sites can't override
+// the method. It has to come before all routes, as it changes which of
+// them match.
+func MethodOverride(formRoutes, headerRoutes []string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodPost {
+			return c.Next()
+		}
+		var method string
+		if header := c.Get(HeaderMethodOverride); header != "" && underAny(c.Path(), headerRoutes) {
+			method = header
+		} else if isForm(c) && underAny(c.Path(), formRoutes) {
+			method = c.FormValue("_method")
+			if method != "" && crossSite(c) {
+				return fiber.NewError(fiber.StatusForbidden, "method override from another site")
+			}
+		}
+		if method == "" {
+			return c.Next()
+		}
+		method = strings.ToUpper(method)
+		if !overridable[method] {
+			return fiber.NewError(fiber.StatusBadRequest, "method can't be overridden to "+method)
+		}
+		c.Method(method)
+		return c.Next()
+	}
+}
+
+func underAny(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") || prefix == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isForm(c *fiber.Ctx) bool {
+	contentType := string(c.Request().Header.ContentType())
+	return strings.HasPrefix(contentType, fiber.MIMEApplicationForm) || strings.HasPrefix(contentType, fiber.MIMEMultipartForm)
+}
+
+// crossSite reports whether the browser says the request comes from a page
+// of another site. Requests that don't say, from other clients, are taken
+// to be from the same site.
+func crossSite(c *fiber.Ctx) bool {
+	if site := c.Get("Sec-Fetch-Site"); site != "" {
+		return site == "cross-site"
+	}
+	origin := c.Get(fiber.HeaderOrigin)
+	if origin == "" || origin == "null" {
+		return origin == "null"
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != c.Hostname()
+}
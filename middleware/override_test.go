@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethodOverride(t *testing.T) {
+	app := fiber.New()
+	app.Use(MethodOverride([]string{"/web"}, []string{"/api"}))
+	seen := 0
+	app.Use("/web", func(c *fiber.Ctx) error {
+		seen++
+		return c.Next()
+	})
+	for _, prefix := range []string{"/web", "/api"} {
+		app.Post(prefix+"/items", func(c *fiber.Ctx) error { return c.SendString("created") })
+		app.Put(prefix+"/items/:id", func(c *fiber.Ctx) error { return c.SendString("replaced " + c.Params("id")) })
+		app.Delete(prefix+"/items/:id", func(c *fiber.Ctx) error { return c.SendString("deleted " + c.Params("id")) })
+	}
+	form := func(method string) url.Values { return url.Values{"_method": {method}, "name": {"kopi"}} }
+
+	testkit.DoForm(t, app, "POST", "/web/items/1", form("delete")).AssertStatus(200).AssertBody("deleted 1")
+	assert.Equal(t, 1, seen)
+	testkit.DoForm(t, app, "POST", "/web/items/1", form("PUT"),
+		testkit.WithHeader("Origin", "http://example.com")).AssertStatus(200).AssertBody("replaced 1")
+	testkit.DoForm(t, app, "POST", "/web/items", url.Values{"name": {"kopi"}}).AssertStatus(200).AssertBody("created")
+	testkit.Do(t, app, "POST", "/api/items/2", nil, testkit.WithHeader(HeaderMethodOverride, "DELETE")).
+		AssertStatus(200).AssertBody("deleted 2")
+
+	// Only from where it is allowed, and only to unsafe methods.
+	testkit.DoForm(t, app, "POST", "/web/items/1", form("DELETE"),
+		testkit.WithHeader("Origin", "https://evil.example")).AssertStatus(403)
+	testkit.DoForm(t, app, "POST", "/web/items/1", form("DELETE"),
+		testkit.WithHeader("Sec-Fetch-Site", "cross-site")).AssertStatus(403)
+	testkit.DoForm(t, app, "POST", "/api/items/1", form("DELETE")).AssertStatus(405)
+	testkit.Do(t, app, "POST", "/web/items/1", nil, testkit.WithHeader(HeaderMethodOverride, "DELETE")).AssertStatus(405)
+	testkit.DoForm(t, app, "POST", "/web/items/1", form("GET")).AssertStatus(400)
+	testkit.Do(t, app, "GET", "/api/items/1", strings.NewReader(""), testkit.WithHeader(HeaderMethodOverride, "DELETE")).AssertStatus(405)
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RejectMalformedParams answers 400 to requests with a query, form or
+// multipart key ending in "[", such as name[0][. Fiber's QueryParser and
+// BodyParser read past the end of such keys and panic.
+func RejectMalformedParams() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		malformed := false
+		check := func(key []byte, _ []byte) {
+			if bytes.HasSuffix(key, []byte("[")) {
+				malformed = true
+			}
+		}
+		c.Request().URI().QueryArgs().VisitAll(check)
+		contentType := string(c.Request().Header.ContentType())
+		switch {
+		case strings.HasPrefix(contentType, fiber.MIMEApplicationForm):
+			c.Request().PostArgs().VisitAll(check)
+		case strings.HasPrefix(contentType, fiber.MIMEMultipartForm):
+			// The form is parsed once; handlers get the same one.
+			if form, err := c.MultipartForm(); err == nil {
+				for key := range form.Value {
+					check([]byte(key), nil)
+				}
+			}
+		}
+		if malformed {
+			return fiber.NewError(fiber.StatusBadRequest, "malformed parameter name")
+		}
+		return c.Next()
+	}
+}
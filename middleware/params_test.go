@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+)
+
+func TestRejectMalformedParams(t *testing.T) {
+	app := fiber.New()
+	app.Use(RejectMalformedParams())
+	app.Post("/", func(c *fiber.Ctx) error {
+		var body struct {
+			Tags []string `form:"tags" query:"tags"`
+		}
+		if err := c.QueryParser(&body); err != nil {
+			return err
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return err
+		}
+		return c.SendString(strings.Join(body.Tags, ","))
+	})
+
+	testkit.DoForm(t, app, "POST", "/?tags=a", url.Values{"tags": {"b"}}).AssertStatus(200)
+	testkit.DoForm(t, app, "POST", "/?tags[=a", nil).AssertStatus(400)
+	testkit.DoForm(t, app, "POST", "/", url.Values{"tags[0][": {"b"}}).AssertStatus(400)
+	body, contentType := testkit.Multipart(t, map[string]string{"tags[": "c"})
+	testkit.Do(t, app, "POST", "/", body, contentType).AssertStatus(400)
+	body, contentType = testkit.Multipart(t, map[string]string{"tags": "c"})
+	testkit.Do(t, app, "POST", "/", body, contentType).AssertStatus(200).AssertBody("c")
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+)
+
+var realIPKey = ctxutil.NewKey[string]("real_ip")
+
+// ResolveRealIP stores the client address in c.Locals for RealIP. Header
+// (X-Forwarded-For, X-Real-IP, ...) is only believed when the request comes
+// from one of trustedProxies, given as IPs or CIDRs. Forwarded-for lists are
+// read from the right, skipping trusted hops, so a client can't choose its
+// address by sending the header itself.
+func ResolveRealIP(header string, trustedProxies []string) (fiber.Handler, error) {
+	trusted := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("middleware: invalid trusted proxy %q", proxy)
+		}
+		trusted = append(trusted, network)
+	}
+
+	isTrusted := func(ip net.IP) bool {
+		for _, network := range trusted {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *fiber.Ctx) error {
+		ip := c.Context().RemoteIP()
+		if header != "" && isTrusted(ip) {
+			hops := strings.Split(c.Get(header), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := net.ParseIP(strings.TrimSpace(hops[i]))
+				if hop == nil {
+					break
+				}
+				ip = hop
+				if !isTrusted(hop) {
+					break
+				}
+			}
+		}
+		realIPKey.Set(c, ip.String())
+		return c.Next()
+	}, nil
+}
+
+// RealIP is the client address resolved by ResolveRealIP, or the peer
+// address when the middleware didn't run.
+func RealIP(c *fiber.Ctx) string {
+	if ip, ok := realIPKey.Get(c); ok {
+		return ip
+	}
+	return c.IP()
+}
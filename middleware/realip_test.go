@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func realIPApp(t *testing.T, header string, trusted ...string) *fiber.App {
+	resolve, err := ResolveRealIP(header, trusted)
+	assert.Nil(t, err)
+	app := fiber.New()
+	app.Use(resolve)
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(RealIP(c))
+	})
+	return app
+}
+
+func realIPOf(t *testing.T, app *fiber.App, header, value string) string {
+	var options []testkit.Option
+	if header != "" {
+		options = append(options, testkit.WithHeader(header, value))
+	}
+	return testkit.Do(t, app, "GET", "/", nil, options...).String()
+}
+
+// app.Test connects from 0.0.0.0.
+func TestRealIP(t *testing.T) {
+	untrusted := realIPApp(t, fiber.HeaderXForwardedFor, "10.0.0.0/8")
+	assert.Equal(t, "0.0.0.0", realIPOf(t, untrusted, fiber.HeaderXForwardedFor, "1.2.3.4"))
+
+	trusted := realIPApp(t, fiber.HeaderXForwardedFor, "0.0.0.0", "10.0.0.0/8")
+	assert.Equal(t, "0.0.0.0", realIPOf(t, trusted, "", ""))
+	assert.Equal(t, "1.2.3.4", realIPOf(t, trusted, fiber.HeaderXForwardedFor, "1.2.3.4"))
+	assert.Equal(t, "1.2.3.4", realIPOf(t, trusted, fiber.HeaderXForwardedFor, "6.6.6.6, 1.2.3.4, 10.1.2.3"))
+	assert.Equal(t, "10.1.2.3", realIPOf(t, trusted, fiber.HeaderXForwardedFor, "garbage, 10.1.2.3"))
+
+	realIP := realIPApp(t, "X-Real-IP", "0.0.0.0")
+	assert.Equal(t, "2001:db8::1", realIPOf(t, realIP, "X-Real-IP", "2001:db8::1"))
+}
+
+func TestResolveRealIPInvalidProxy(t *testing.T) {
+	_, err := ResolveRealIP(fiber.HeaderXForwardedFor, []string{"loadbalancer"})
+	assert.NotNil(t, err)
+}
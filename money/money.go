@@ -0,0 +1,275 @@
+// Package money represents amounts of money exactly, as integer minor
+// units of an ISO 4217 currency, such as cents of USD.
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("money: unknown currency")
+	ErrMismatch        = errors.New("money: currencies differ")
+	ErrSyntax          = errors.New("money: not a decimal amount")
+	ErrPrecision       = errors.New("money: more decimals than the currency has")
+	ErrOverflow        = errors.New("money: amount out of range")
+)
+
+// exponents are the minor units of the supported currencies: an amount of
+// 1 in minor units is 10^-exponent of the currency.
+var exponents = map[string]int{
+	"IDR": 2,
+	"USD": 2,
+	"EUR": 2,
+	"SGD": 2,
+	"JPY": 0,
+	"KWD": 3,
+}
+
+// Money is an amount in a currency. The zero value has no currency and
+// can't be added to anything.
+type Money struct {
+	minor    int64
+	currency string
+}
+
+// Known reports whether currency is supported.
+func Known(currency string) bool {
+	_, ok := exponents[currency]
+	return ok
+}
+
+// New returns minor units of currency, such as New(1250, "USD") for
+// $12.50.
+func New(minor int64, currency string) (Money, error) {
+	if !Known(currency) {
+		return Money{}, fmt.Errorf("%w %q", ErrUnknownCurrency, currency)
+	}
+	return Money{minor: minor, currency: currency}, nil
+}
+
+// Parse reads a decimal amount, such as "-12.50", in the major units of
+// currency. Unlike Round it refuses amounts with more decimals than the
+// currency has.
+func Parse(amount, currency string) (Money, error) {
+	return parse(amount, currency, false)
+}
+
+// MustParse is Parse for amounts known to be valid, such as constants. It
+// panics if amount isn't.
+func MustParse(amount, currency string) Money {
+	m, err := Parse(amount, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Round returns amount in currency rounded to its minor units, halves
+// away from zero. It rounds the shortest decimal that reads back as
+// amount, so 1.005 is rounded as written and becomes 1.01.
+func Round(amount float64, currency string) (Money, error) {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return Money{}, ErrSyntax
+	}
+	return parse(strconv.FormatFloat(amount, 'f', -1, 64), currency, true)
+}
+
+func parse(amount, currency string, round bool) (Money, error) {
+	exponent, ok := exponents[currency]
+	if !ok {
+		return Money{}, fmt.Errorf("%w %q", ErrUnknownCurrency, currency)
+	}
+	negative := strings.HasPrefix(amount, "-")
+	whole, fraction, point := strings.Cut(strings.TrimPrefix(amount, "-"), ".")
+	if !digits(whole) || point && !digits(fraction) {
+		return Money{}, fmt.Errorf("%w: %q", ErrSyntax, amount)
+	}
+	up := false
+	if len(fraction) > exponent {
+		if !round && strings.TrimRight(fraction[exponent:], "0") != "" {
+			return Money{}, fmt.Errorf("%w: %q in %s", ErrPrecision, amount, currency)
+		}
+		up = round && fraction[exponent] >= '5'
+		fraction = fraction[:exponent]
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+	minor, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrOverflow, amount)
+	}
+	if up {
+		if minor == math.MaxInt64 {
+			return Money{}, fmt.Errorf("%w: %q", ErrOverflow, amount)
+		}
+		minor++
+	}
+	if negative {
+		minor = -minor
+	}
+	return Money{minor: minor, currency: currency}, nil
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Minor returns the amount in minor units.
+func (m Money) Minor() int64 { return m.minor }
+
+func (m Money) Currency() string { return m.currency }
+
+func (m Money) IsZero() bool { return m.minor == 0 }
+
+func (m Money) IsNegative() bool { return m.minor < 0 }
+
+// Add returns m + other, which must be in the same currency.
+func (m Money) Add(other Money) (Money, error) {
+	if m.currency == "" || m.currency != other.currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrMismatch, m.currency, other.currency)
+	}
+	sum := m.minor + other.minor
+	if (sum > m.minor) != (other.minor > 0) {
+		return Money{}, ErrOverflow
+	}
+	return Money{minor: sum, currency: m.currency}, nil
+}
+
+// Sub returns m - other, which must be in the same currency.
+func (m Money) Sub(other Money) (Money, error) {
+	if other.minor == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return m.Add(Money{minor: -other.minor, currency: other.currency})
+}
+
+// Mul returns m times n, such as the price of n items.
+func (m Money) Mul(n int64) (Money, error) {
+	if m.minor == 0 || n == 0 {
+		return Money{minor: 0, currency: m.currency}, nil
+	}
+	product := m.minor * n
+	if product/n != m.minor || n == -1 && m.minor == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return Money{minor: product, currency: m.currency}, nil
+}
+
+// Decimal returns the amount in major units with all the currency's
+// decimals, such as "12.50".
+func (m Money) Decimal() string {
+	exponent := exponents[m.currency]
+	s := strconv.FormatUint(abs(m.minor), 10)
+	if len(s) <= exponent {
+		s = strings.Repeat("0", exponent-len(s)+1) + s
+	}
+	if exponent > 0 {
+		s = s[:len(s)-exponent] + "." + s[len(s)-exponent:]
+	}
+	if m.minor < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// Number returns the amount in major units as a JSON number, without
+// trailing zeros: 12.5 or 15000.
+func (m Money) Number() json.Number {
+	s := m.Decimal()
+	if strings.Contains(s, ".") {
+		s = strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+	}
+	return json.Number(s)
+}
+
+// String returns the amount and the currency code, such as "12.50 USD".
+func (m Money) String() string {
+	return m.Decimal() + " " + m.currency
+}
+
+// Format returns the amount as people read it. IDR is written as in
+// Indonesia, "Rp 15.000", with sen only when there are any: "Rp 15.000,50".
+// USD is written "$1,234.56". Other currencies are written as String,
+// with the thousands grouped: "1,234.56 EUR".
+func (m Money) Format() string {
+	whole, fraction, _ := strings.Cut(strings.TrimPrefix(m.Decimal(), "-"), ".")
+	sign := ""
+	if m.minor < 0 {
+		sign = "-"
+	}
+	switch m.currency {
+	case "IDR":
+		s := sign + "Rp " + group(whole, ".")
+		if strings.TrimLeft(fraction, "0") != "" {
+			s += "," + fraction
+		}
+		return s
+	case "USD":
+		return sign + "$" + group(whole, ",") + "." + fraction
+	}
+	s := sign + group(whole, ",")
+	if fraction != "" {
+		s += "." + fraction
+	}
+	return s + " " + m.currency
+}
+
+// group separates the thousands of whole, a string of digits, with sep.
+func group(whole, sep string) string {
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(sep)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func abs(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
+
+type jsonMoney struct {
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+}
+
+// MarshalJSON writes {"amount":"12.50","currency":"USD"}, with the amount
+// as a string so no decoder reads it as a float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.Decimal(), m.currency})
+}
+
+// UnmarshalJSON reads what MarshalJSON writes. The amount may also be a
+// number, but must be exact in the currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var v jsonMoney
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	parsed, err := Parse(v.Amount.String(), v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
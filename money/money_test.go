@@ -0,0 +1,217 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func must(t *testing.T, minor int64, currency string) Money {
+	m, err := New(minor, currency)
+	assert.Nil(t, err)
+	return m
+}
+
+func TestParse(t *testing.T) {
+	for amount, minor := range map[string]int64{
+		"0":                    0,
+		"12":                   1200,
+		"12.5":                 1250,
+		"12.50":                1250,
+		"12.500":               1250,
+		"0.01":                 1,
+		"-0.01":                -1,
+		"-12.34":               -1234,
+		"007.10":               710,
+		"15000":                1500000,
+		"92233720368547758.07": math.MaxInt64,
+	} {
+		m, err := Parse(amount, "USD")
+		assert.Nil(t, err, amount)
+		assert.Equal(t, minor, m.Minor(), amount)
+	}
+	for amount, want := range map[string]error{
+		"":                     ErrSyntax,
+		"-":                    ErrSyntax,
+		".5":                   ErrSyntax,
+		"5.":                   ErrSyntax,
+		"1e3":                  ErrSyntax,
+		"+5":                   ErrSyntax,
+		"1,000":                ErrSyntax,
+		" 5":                   ErrSyntax,
+		"0.001":                ErrPrecision,
+		"12.345":               ErrPrecision,
+		"92233720368547758.08": ErrOverflow,
+	} {
+		_, err := Parse(amount, "USD")
+		assert.ErrorIs(t, err, want, amount)
+	}
+
+	yen, err := Parse("500", "JPY")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(500), yen.Minor())
+	_, err = Parse("500.5", "JPY")
+	assert.ErrorIs(t, err, ErrPrecision)
+	dinar, err := Parse("1.234", "KWD")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1234), dinar.Minor())
+
+	_, err = Parse("1", "XXX")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+	_, err = Parse("1", "usd")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
+
+func TestRound(t *testing.T) {
+	for _, c := range []struct {
+		amount   float64
+		currency string
+		minor    int64
+	}{
+		{0, "USD", 0},
+		{0.004, "USD", 0},
+		{0.005, "USD", 1},
+		{0.015, "USD", 2},
+		{0.025, "USD", 3},
+		{1.005, "USD", 101},
+		{1.0049999, "USD", 100},
+		{2.675, "USD", 268},
+		{0.1 + 0.2, "USD", 30},
+		{-0.005, "USD", -1},
+		{-1.005, "USD", -101},
+		{-0.004, "USD", 0},
+		{19.99 * 3, "USD", 5997},
+		{15000, "IDR", 1500000},
+		{15000.125, "IDR", 1500013},
+		{0.5, "JPY", 1},
+		{1.4999, "JPY", 1},
+		{2.5, "JPY", 3},
+		{-2.5, "JPY", -3},
+		{0.0005, "KWD", 1},
+		{1.2345, "KWD", 1235},
+		{1e-7, "USD", 0},
+		{0.99999, "USD", 100},
+		{9.995, "USD", 1000},
+	} {
+		m, err := Round(c.amount, c.currency)
+		assert.Nil(t, err, c.amount)
+		assert.Equal(t, c.minor, m.Minor(), "%v %s", c.amount, c.currency)
+		assert.Equal(t, c.currency, m.Currency())
+	}
+
+	for _, amount := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		_, err := Round(amount, "USD")
+		assert.ErrorIs(t, err, ErrSyntax)
+	}
+	_, err := Round(1e300, "USD")
+	assert.ErrorIs(t, err, ErrOverflow)
+	_, err = Round(92233720368547758.07, "USD")
+	assert.ErrorIs(t, err, ErrOverflow)
+	_, err = Round(1, "XXX")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
+
+func TestArithmetic(t *testing.T) {
+	a, b := must(t, 1050, "USD"), must(t, 295, "USD")
+	sum, err := a.Add(b)
+	assert.Nil(t, err)
+	assert.Equal(t, must(t, 1345, "USD"), sum)
+	difference, err := b.Sub(a)
+	assert.Nil(t, err)
+	assert.Equal(t, must(t, -755, "USD"), difference)
+	assert.True(t, difference.IsNegative())
+	product, err := a.Mul(3)
+	assert.Nil(t, err)
+	assert.Equal(t, must(t, 3150, "USD"), product)
+	zero, err := a.Mul(0)
+	assert.Nil(t, err)
+	assert.True(t, zero.IsZero())
+	assert.Equal(t, "USD", zero.Currency())
+
+	// Adding what is stored as float64 would be off by a cent.
+	cents := must(t, 0, "USD")
+	for i := 0; i < 10; i++ {
+		cents, err = cents.Add(must(t, 10, "USD"))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, "1.00", cents.Decimal())
+
+	_, err = a.Add(must(t, 1050, "IDR"))
+	assert.ErrorIs(t, err, ErrMismatch)
+	_, err = Money{}.Add(Money{})
+	assert.ErrorIs(t, err, ErrMismatch)
+
+	_, err = must(t, math.MaxInt64, "USD").Add(must(t, 1, "USD"))
+	assert.ErrorIs(t, err, ErrOverflow)
+	_, err = must(t, math.MinInt64, "USD").Add(must(t, -1, "USD"))
+	assert.ErrorIs(t, err, ErrOverflow)
+	_, err = must(t, 0, "USD").Sub(must(t, math.MinInt64, "USD"))
+	assert.ErrorIs(t, err, ErrOverflow)
+	_, err = must(t, math.MaxInt64/2+1, "USD").Mul(2)
+	assert.ErrorIs(t, err, ErrOverflow)
+	_, err = must(t, math.MinInt64, "USD").Mul(-1)
+	assert.ErrorIs(t, err, ErrOverflow)
+	_, err = must(t, -1, "USD").Mul(math.MinInt64)
+	assert.ErrorIs(t, err, ErrOverflow)
+	large, err := must(t, math.MaxInt64/2, "USD").Mul(2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(math.MaxInt64-1), large.Minor())
+}
+
+func TestFormat(t *testing.T) {
+	for _, c := range []struct {
+		minor                   int64
+		currency                string
+		decimal, number, format string
+	}{
+		{0, "IDR", "0.00", "0", "Rp 0"},
+		{1500000, "IDR", "15000.00", "15000", "Rp 15.000"},
+		{1500050, "IDR", "15000.50", "15000.5", "Rp 15.000,50"},
+		{123456789, "IDR", "1234567.89", "1234567.89", "Rp 1.234.567,89"},
+		{-50000, "IDR", "-500.00", "-500", "-Rp 500"},
+		{0, "USD", "0.00", "0", "$0.00"},
+		{5, "USD", "0.05", "0.05", "$0.05"},
+		{-5, "USD", "-0.05", "-0.05", "-$0.05"},
+		{99900, "USD", "999.00", "999", "$999.00"},
+		{123456, "USD", "1234.56", "1234.56", "$1,234.56"},
+		{100000000, "USD", "1000000.00", "1000000", "$1,000,000.00"},
+		{math.MinInt64, "USD", "-92233720368547758.08", "-92233720368547758.08", "-$92,233,720,368,547,758.08"},
+		{1234567, "JPY", "1234567", "1234567", "1,234,567 JPY"},
+		{1230, "EUR", "12.30", "12.3", "12.30 EUR"},
+		{5, "KWD", "0.005", "0.005", "0.005 KWD"},
+	} {
+		m := must(t, c.minor, c.currency)
+		assert.Equal(t, c.decimal, m.Decimal())
+		assert.Equal(t, c.number, m.Number().String())
+		assert.Equal(t, c.format, m.Format())
+		assert.Equal(t, c.decimal+" "+c.currency, m.String())
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(must(t, 1250, "USD"))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"amount":"12.50","currency":"USD"}`, string(data))
+
+	for input, want := range map[string]Money{
+		`{"amount":"12.50","currency":"USD"}`: must(t, 1250, "USD"),
+		`{"amount":12.5,"currency":"USD"}`:    must(t, 1250, "USD"),
+		`{"amount":15000,"currency":"IDR"}`:   must(t, 1500000, "IDR"),
+	} {
+		var m Money
+		assert.Nil(t, json.Unmarshal([]byte(input), &m), input)
+		assert.Equal(t, want, m)
+	}
+	for input, want := range map[string]error{
+		`{"amount":"12.345","currency":"USD"}`: ErrPrecision,
+		`{"amount":"12","currency":"XXX"}`:     ErrUnknownCurrency,
+		`{"currency":"USD"}`:                   ErrSyntax,
+	} {
+		var m Money
+		assert.ErrorIs(t, json.Unmarshal([]byte(input), &m), want, input)
+	}
+	var m Money
+	assert.NotNil(t, json.Unmarshal([]byte(`{"amount":"twelve","currency":"USD"}`), &m))
+}
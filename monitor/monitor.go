@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	_ "embed"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/reporting"
+	"github.com/jalal-akbar/belajar-golang-fiber/sse"
+)
+
+//go:embed index.html
+var page []byte
+
+// retry is how long dashboards wait before reconnecting to a stream that
+// ended.
+const retry = 5 * time.Second
+
+// Snapshot describes the interval since the previous snapshot (rates and
+// latencies) and the state of the process at its end.
+type Snapshot struct {
+	Time              time.Time `json:"time"`
+	RequestsPerSecond float64   `json:"requests_per_second"`
+	LatencyMeanMs     float64   `json:"latency_mean_ms"`
+	LatencyP95Ms      float64   `json:"latency_p95_ms"`
+	HeapBytes         uint64    `json:"heap_bytes"`
+	SysBytes          uint64    `json:"sys_bytes"`
+	Goroutines        int       `json:"goroutines"`
+	OpenConnections   int32     `json:"open_connections"`
+}
+
+// Monitor serves a live dashboard fed by the HTTP metrics. Every open
+// dashboard receives a Snapshot per interval over server-sent events.
+// Streams that fail are reported to reporter.
+type Monitor struct {
+	app      *fiber.App
+	http     *metrics.HTTP
+	interval time.Duration
+	reporter reporting.Reporter
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func New(app *fiber.App, http *metrics.HTTP, interval time.Duration, reporter reporting.Reporter) *Monitor {
+	return &Monitor{
+		app:      app,
+		http:     http,
+		interval: interval,
+		reporter: reporter,
+		done:     make(chan struct{}),
+	}
+}
+
+func (m *Monitor) Register(router fiber.Router) {
+	router.Get("/", m.page)
+	router.Get("/stream", m.stream)
+}
+
+// Close ends all open streams so they don't hold up shutdown.
+func (m *Monitor) Close() {
+	m.closeOnce.Do(func() { close(m.done) })
+}
+
+type sample struct {
+	at       time.Time
+	requests float64
+	latency  metrics.HistogramSnapshot
+}
+
+func (m *Monitor) sample() sample {
+	return sample{
+		at:       time.Now(),
+		requests: m.http.Requests.Total(),
+		latency:  m.http.Duration.Merged(),
+	}
+}
+
+func (m *Monitor) snapshot(prev, cur sample) Snapshot {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	latency := cur.latency.Sub(prev.latency)
+	snapshot := Snapshot{
+		Time:            cur.at,
+		LatencyMeanMs:   latency.Mean() * 1000,
+		LatencyP95Ms:    latency.Quantile(0.95) * 1000,
+		HeapBytes:       stats.HeapAlloc,
+		SysBytes:        stats.Sys,
+		Goroutines:      runtime.NumGoroutine(),
+		OpenConnections: m.app.Server().GetOpenConnectionsCount(),
+	}
+	if elapsed := cur.at.Sub(prev.at).Seconds(); elapsed > 0 {
+		snapshot.RequestsPerSecond = (cur.requests - prev.requests) / elapsed
+	}
+	return snapshot
+}
+
+func (m *Monitor) page(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Send(page)
+}
+
+func (m *Monitor) stream(c *fiber.Ctx) error {
+	return sse.Serve(c, m.reporter, retry, func(s *sse.Stream) error {
+		ticker := time.NewTicker(m.interval)
+		s.OnClose(ticker.Stop)
+
+		prev := m.sample()
+		for {
+			select {
+			case <-m.done:
+				return nil
+			case <-ticker.C:
+			}
+
+			cur := m.sample()
+			if err := s.Send("", m.snapshot(prev, cur)); err != nil {
+				return err
+			}
+			prev = cur
+		}
+	})
+}
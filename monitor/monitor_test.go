@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/reporting"
+	"github.com/stretchr/testify/assert"
+)
+
+var reporter = reporting.LogReporter{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+func TestMonitorPage(t *testing.T) {
+	app := fiber.New()
+	New(app, metrics.NewHTTP(metrics.NewRegistry()), time.Second, reporter).Register(app.Group("/admin/monitor"))
+
+	response, err := app.Test(httptest.NewRequest("GET", "/admin/monitor", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", response.Header.Get("Content-Type"))
+}
+
+func TestMonitorStream(t *testing.T) {
+	httpMetrics := metrics.NewHTTP(metrics.NewRegistry())
+	app := fiber.New()
+	app.Use(httpMetrics.Middleware())
+	app.Get("/hello", func(c *fiber.Ctx) error {
+		return c.SendString("Hello World")
+	})
+	m := New(app, httpMetrics, 20*time.Millisecond, reporter)
+	m.Register(app.Group("/admin/monitor"))
+
+	go func() {
+		for i := 0; i < 5; i++ {
+			app.Test(httptest.NewRequest("GET", "/hello", nil))
+			time.Sleep(5 * time.Millisecond)
+		}
+		time.Sleep(50 * time.Millisecond)
+		m.Close()
+	}()
+
+	response, err := app.Test(httptest.NewRequest("GET", "/admin/monitor/stream", nil), -1)
+	assert.Nil(t, err)
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+
+	events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+	assert.Equal(t, "retry: 5000", events[0])
+	events = events[1:]
+	assert.GreaterOrEqual(t, len(events), 2)
+
+	var total float64
+	for _, event := range events {
+		var snapshot Snapshot
+		assert.True(t, strings.HasPrefix(event, "data: "))
+		assert.Nil(t, json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &snapshot))
+		assert.Greater(t, snapshot.Goroutines, 0)
+		total += snapshot.RequestsPerSecond
+	}
+	assert.Greater(t, total, 0.0)
+}
@@ -0,0 +1,93 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/jalal-akbar/belajar-golang-fiber/mail"
+	"github.com/jalal-akbar/belajar-golang-fiber/messaging"
+)
+
+// Email mails notifications to the address Address returns for the user.
+// Users without one get none.
+type Email struct {
+	Sender  mail.Sender
+	Address func(ctx context.Context, userID string) (string, bool, error)
+}
+
+func (e Email) Name() string { return "email" }
+
+func (e Email) Send(ctx context.Context, userID string, prefs Preferences, n Notification) error {
+	address, ok, err := e.Address(ctx, userID)
+	if err != nil || !ok {
+		return err
+	}
+	return e.Sender.Send(ctx, mail.Message{To: address, Subject: n.Title, Body: n.Body})
+}
+
+// Phone texts notifications to the number the user confirmed, over the
+// channel of Sender. Users without one get none.
+type Phone struct {
+	Sender messaging.Sender
+}
+
+func (p Phone) Name() string { return p.Sender.Name() }
+
+func (p Phone) Send(ctx context.Context, userID string, prefs Preferences, n Notification) error {
+	if prefs.Phone == "" {
+		return nil
+	}
+	return p.Sender.Send(ctx, messaging.Message{To: prefs.Phone, Body: n.Body})
+}
+
+// Webhook posts notifications as JSON to the URL in the user's
+// preferences, signed with Secret.
+type Webhook struct {
+	Client *httpclient.Client
+	Secret string
+}
+
+func (w Webhook) Name() string { return "webhook" }
+
+func (w Webhook) Send(ctx context.Context, userID string, prefs Preferences, n Notification) error {
+	if prefs.WebhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, prefs.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if err := auth.SignRequest(request, "notifications", w.Secret); err != nil {
+		return err
+	}
+	response, err := w.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("notifications: webhook returned %s", response.Status)
+	}
+	return nil
+}
+
+// validWebhookURL only allows https URLs with a host.
+func validWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("webhook_url must be an https URL")
+	}
+	return nil
+}
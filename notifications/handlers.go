@@ -0,0 +1,158 @@
+package notifications
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/deprecation"
+	"github.com/jalal-akbar/belajar-golang-fiber/validate"
+)
+
+// Register adds the authenticated user's notification endpoints:
+//
+//	GET  /me/notifications[?unread=true]
+//	POST /me/notifications/read       marks all read
+//	POST /me/notifications/:id/read
+//	GET  /me/notification-preferences
+//	PUT  /me/notification-preferences
+//	POST /me/phone                    texts a code to {"phone", "channel"}
+//	POST /me/phone/confirm            sets the phone with {"code"}
+//	DELETE /me/phone
+func (s *Service) Register(router fiber.Router) {
+	router.Get("/me/notifications", s.listHandler)
+	router.Post("/me/notifications/read", s.readHandler)
+	router.Post("/me/notifications/:id/read", s.readHandler)
+	router.Get("/me/notification-preferences", s.getPreferencesHandler)
+	router.Put("/me/notification-preferences", s.putPreferencesHandler)
+	router.Post("/me/phone", s.sendCodeHandler)
+	router.Post("/me/phone/confirm", s.confirmCodeHandler)
+	router.Delete("/me/phone", s.deletePhoneHandler)
+}
+
+func (s *Service) listHandler(c *fiber.Ctx) error {
+	userID := ctxutil.CurrentUser(c)
+	list, unread := s.inbox.List(userID, c.QueryBool("unread"))
+	return c.JSON(fiber.Map{"notifications": list, "unread": unread})
+}
+
+func (s *Service) readHandler(c *fiber.Ctx) error {
+	userID := ctxutil.CurrentUser(c)
+	if !s.inbox.MarkRead(userID, c.Params("id")) {
+		return fiber.ErrNotFound
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Service) getPreferencesHandler(c *fiber.Ctx) error {
+	prefs, err := s.Preferences(c.UserContext(), ctxutil.CurrentUser(c))
+	if err != nil {
+		return err
+	}
+	if prefs.Channels == nil {
+		prefs.Channels = map[string][]string{}
+	}
+	return c.JSON(prefs)
+}
+
+func (s *Service) putPreferencesHandler(c *fiber.Ctx) error {
+	var body struct {
+		Preferences
+		Phone string `json:"phone" deprecated:"set the phone with POST /me/phone"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid preferences")
+	}
+	deprecation.Request(c, &body)
+	prefs := body.Preferences
+	for _, channels := range prefs.Channels {
+		for _, name := range channels {
+			if _, ok := s.channels[name]; !ok && name != InApp {
+				return fiber.NewError(fiber.StatusUnprocessableEntity, "unknown channel "+name)
+			}
+		}
+	}
+	if prefs.WebhookURL != "" {
+		if err := validWebhookURL(prefs.WebhookURL); err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+		}
+	}
+	userID := utils.CopyString(ctxutil.CurrentUser(c))
+	current, err := s.Preferences(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+	prefs.Phone = current.Phone
+	if err := s.SetPreferences(c.UserContext(), userID, prefs); err != nil {
+		return err
+	}
+	return c.JSON(prefs)
+}
+
+func (s *Service) sendCodeHandler(c *fiber.Ctx) error {
+	var body struct {
+		Phone   string `json:"phone" validate:"required,phone"`
+		Channel string `json:"channel"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid body")
+	}
+	if err := validate.Struct(c.UserContext(), &body); err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+	userID := utils.CopyString(ctxutil.CurrentUser(c))
+	err := s.SendCode(c.UserContext(), userID, body.Channel, body.Phone)
+	var limited *LimitError
+	switch {
+	case errors.As(err, &limited):
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+		return fiber.NewError(fiber.StatusTooManyRequests, "too many messages, try again later")
+	case errors.Is(err, ErrNoPhoneChannel):
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "unknown phone channel "+body.Channel)
+	case err != nil:
+		s.logger.WarnContext(c.UserContext(), "sending phone code failed",
+			slog.String("channel", body.Channel),
+			slog.String("error", err.Error()),
+		)
+		return fiber.NewError(fiber.StatusBadGateway, "sending the code failed")
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+func (s *Service) confirmCodeHandler(c *fiber.Ctx) error {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid body")
+	}
+	userID := utils.CopyString(ctxutil.CurrentUser(c))
+	prefs, err := s.ConfirmCode(c.UserContext(), userID, body.Code)
+	if errors.Is(err, ErrInvalidCode) {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid or expired code")
+	}
+	if err != nil {
+		return err
+	}
+	if prefs.Channels == nil {
+		prefs.Channels = map[string][]string{}
+	}
+	return c.JSON(prefs)
+}
+
+func (s *Service) deletePhoneHandler(c *fiber.Ctx) error {
+	userID := utils.CopyString(ctxutil.CurrentUser(c))
+	prefs, err := s.Preferences(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+	prefs.Phone = ""
+	if err := s.SetPreferences(c.UserContext(), userID, prefs); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
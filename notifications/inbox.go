@@ -0,0 +1,79 @@
+package notifications
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+)
+
+// Inbox keeps the latest in-app notifications of every user.
+type Inbox struct {
+	keep int
+	now  func() time.Time
+
+	mu    sync.Mutex
+	users map[string][]Notification
+}
+
+func newInbox(keep int) *Inbox {
+	return &Inbox{keep: keep, now: clock.System.Now, users: map[string][]Notification{}}
+}
+
+func (i *Inbox) add(userID string, n Notification) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	list := append(i.users[userID], n)
+	if len(list) > i.keep {
+		list = append([]Notification(nil), list[len(list)-i.keep:]...)
+	}
+	i.users[userID] = list
+}
+
+// List returns the notifications of userID, newest first, and how many of
+// them are unread.
+func (i *Inbox) List(userID string, unreadOnly bool) ([]Notification, int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	stored := i.users[userID]
+	list := []Notification{}
+	unread := 0
+	for j := len(stored) - 1; j >= 0; j-- {
+		if stored[j].ReadAt == nil {
+			unread++
+		} else if unreadOnly {
+			continue
+		}
+		list = append(list, stored[j])
+	}
+	return list, unread
+}
+
+// MarkRead marks the notification id of userID read, or all of them for
+// an empty id, and reports whether there was one.
+func (i *Inbox) MarkRead(userID, id string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	now := i.now()
+	found := false
+	for j, n := range i.users[userID] {
+		if id != "" && n.ID != id {
+			continue
+		}
+		found = true
+		if n.ReadAt == nil {
+			i.users[userID][j].ReadAt = &now
+		}
+	}
+	return found || id == ""
+}
+
+func newID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
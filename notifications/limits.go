@@ -0,0 +1,57 @@
+package notifications
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+)
+
+// LimitError is returned for a message the channel's limit for the user
+// doesn't allow, until RetryAfter has passed.
+type LimitError struct {
+	Channel    string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("notifications: %s limit reached, retry after %s", e.Channel, e.RetryAfter)
+}
+
+// limiter counts what each channel sent each user within the channel's
+// window. Channels without a limit aren't counted.
+type limiter struct {
+	limits map[string]config.ChannelLimit
+
+	mu   sync.Mutex
+	sent map[string][]time.Time
+}
+
+func newLimiter(limits map[string]config.ChannelLimit) *limiter {
+	return &limiter{limits: limits, sent: map[string][]time.Time{}}
+}
+
+// allow counts a message channel sends userID at now, if the limit allows
+// it, and otherwise says how long until it does.
+func (l *limiter) allow(channel, userID string, now time.Time) (time.Duration, bool) {
+	limit, ok := l.limits[channel]
+	if !ok {
+		return 0, true
+	}
+	key := channel + "\x00" + userID
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var recent []time.Time
+	for _, sent := range l.sent[key] {
+		if now.Sub(sent) < limit.Window {
+			recent = append(recent, sent)
+		}
+	}
+	if len(recent) >= limit.Limit {
+		l.sent[key] = recent
+		return recent[0].Add(limit.Window).Sub(now), false
+	}
+	l.sent[key] = append(recent, now)
+	return 0, true
+}
@@ -0,0 +1,186 @@
+// Package notifications tells users about events concerning them, in the
+// app and through the channels they choose.
+package notifications
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/pii"
+)
+
+const InApp = "in_app"
+
+type Notification struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	Subject   string     `json:"subject,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+// Channel delivers notifications outside the app.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, userID string, prefs Preferences, n Notification) error
+}
+
+// Preferences are a user's choices. Channels maps event types, or "*" for
+// all others, to the channels to use; types not listed fall back to the
+// configured defaults. An empty list turns a type off. Phone is only set
+// by confirming a code sent to it.
+type Preferences struct {
+	Channels   map[string][]string `json:"channels"`
+	WebhookURL string              `json:"webhook_url,omitempty"`
+	Phone      string              `json:"phone,omitempty"`
+}
+
+// Template renders an event as a notification's title and body.
+type Template func(event events.Event) (title, body string)
+
+// Service turns events into notifications and dispatches them. In-app
+// notifications are stored before Dispatch returns; the other channels
+// deliver in the background. Preferences and the codes confirming phones
+// are kept in the database, in the tables Migrations create; the in-app
+// notifications in memory.
+type Service struct {
+	cfg      config.NotifyConfig
+	logger   *slog.Logger
+	inbox    *Inbox
+	channels map[string]Channel
+	limits   *limiter
+	db       *database.DB
+	cipher   *pii.Cipher
+	now      func() time.Time
+	failures *metrics.CounterVec
+	limited  *metrics.CounterVec
+}
+
+func New(cfg config.NotifyConfig, logger *slog.Logger, registry *metrics.Registry, db *database.DB) *Service {
+	return &Service{
+		cfg:      cfg,
+		logger:   logger,
+		inbox:    newInbox(cfg.Keep),
+		channels: map[string]Channel{},
+		limits:   newLimiter(cfg.Limits),
+		db:       db,
+		now:      clock.System.Now,
+		failures: registry.Counter("notifications_failed_total", "Notifications a channel failed to deliver.", "channel"),
+		limited:  registry.Counter("notifications_limited_total", "Notifications a channel dropped for the user's limit.", "channel"),
+	}
+}
+
+func (s *Service) AddChannel(channel Channel) {
+	s.channels[channel.Name()] = channel
+}
+
+// Listen notifies users of the events of bus that have a template.
+func (s *Service) Listen(bus *events.Bus) {
+	for eventType, template := range templates {
+		template := template
+		bus.Subscribe(eventType, func(ctx context.Context, event events.Event) {
+			title, body := template(event)
+			s.Dispatch(ctx, event.UserID, Notification{
+				Type:      event.Type,
+				Title:     title,
+				Body:      body,
+				Subject:   event.Subject,
+				CreatedAt: event.Time,
+			})
+		})
+	}
+}
+
+// Dispatch sends n to userID through the channels their preferences pick
+// for its type. Channels past their limit for the user skip it.
+func (s *Service) Dispatch(ctx context.Context, userID string, n Notification) {
+	n.ID = newID()
+	prefs, err := s.Preferences(ctx, userID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "reading notification preferences failed",
+			slog.String("type", n.Type),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	for _, name := range s.channelsFor(prefs, n.Type) {
+		if name == InApp {
+			s.inbox.add(userID, n)
+			continue
+		}
+		channel, ok := s.channels[name]
+		if !ok {
+			continue
+		}
+		if _, ok := s.limits.allow(name, userID, s.now()); !ok {
+			s.limited.With(name).Inc()
+			s.logger.DebugContext(ctx, "notification over the channel limit",
+				slog.String("channel", name),
+				slog.String("type", n.Type),
+			)
+			continue
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(correlation.Detach(ctx), s.cfg.Timeout)
+			defer cancel()
+			if err := channel.Send(ctx, userID, prefs, n); err != nil {
+				s.failures.With(channel.Name()).Inc()
+				s.logger.WarnContext(ctx, "sending notification failed",
+					slog.String("channel", channel.Name()),
+					slog.String("type", n.Type),
+					slog.String("error", err.Error()),
+				)
+			}
+		}()
+	}
+}
+
+func (s *Service) channelsFor(prefs Preferences, eventType string) []string {
+	for _, choices := range []map[string][]string{prefs.Channels, s.cfg.Channels} {
+		if channels, ok := choices[eventType]; ok {
+			return channels
+		}
+		if channels, ok := choices["*"]; ok {
+			return channels
+		}
+	}
+	return nil
+}
+
+// Preferences returns the preferences of userID with the phone opened. A
+// phone that can't be opened, sealed under another key, is left out.
+func (s *Service) Preferences(ctx context.Context, userID string) (Preferences, error) {
+	stored, err := s.getPreferences(ctx, userID, "")
+	if err != nil {
+		return Preferences{}, err
+	}
+	prefs := stored.Preferences
+	if prefs.Phone, err = s.cipher.Open(userID, prefs.Phone); err != nil {
+		prefs.Phone = ""
+	}
+	return prefs, nil
+}
+
+func (s *Service) SetPreferences(ctx context.Context, userID string, prefs Preferences) error {
+	return s.setPreferences(ctx, userID, prefs, false)
+}
+
+// Forget drops the preferences and the phone of userID, whose account is
+// erased.
+func (s *Service) Forget(ctx context.Context, userID string) error {
+	return s.forget(ctx, userID)
+}
+
+// Inbox returns the in-app notifications.
+func (s *Service) Inbox() *Inbox {
+	return s.inbox
+}
@@ -0,0 +1,344 @@
+package notifications
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/jalal-akbar/belajar-golang-fiber/mail"
+	"github.com/jalal-akbar/belajar-golang-fiber/messaging"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/pii"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/jalal-akbar/belajar-golang-fiber/webpush"
+	"github.com/stretchr/testify/assert"
+)
+
+type outbox struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (o *outbox) Send(ctx context.Context, message mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, message)
+	return nil
+}
+
+func (o *outbox) sent() []mail.Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]mail.Message{}, o.messages...)
+}
+
+func newService(t *testing.T) (*Service, *events.Bus, *fiber.App) {
+	cfg := config.Default().Notify
+	cfg.Keep = 3
+	service := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), metrics.NewRegistry(), testkit.OpenDB(t, Migrations...))
+	bus := events.NewBus()
+	service.Listen(bus)
+
+	app := fiber.New()
+	app.Use(testkit.FakeAuth)
+	service.Register(app)
+	return service, bus, app
+}
+
+func do(t *testing.T, app *fiber.App, method, path, body string) (int, string) {
+	response := testkit.DoJSON(t, app, method, path, body, nil, testkit.WithUser("alice"))
+	return response.StatusCode, response.String()
+}
+
+type inbox struct {
+	Notifications []Notification `json:"notifications"`
+	Unread        int            `json:"unread"`
+}
+
+func list(t *testing.T, app *fiber.App, query string) inbox {
+	status, body := do(t, app, "GET", "/me/notifications"+query, "")
+	assert.Equal(t, 200, status)
+	var result inbox
+	assert.Nil(t, json.Unmarshal([]byte(body), &result))
+	return result
+}
+
+func TestInApp(t *testing.T) {
+	_, bus, app := newService(t)
+	ctx := context.Background()
+	for _, order := range []string{"1", "2", "3", "4"} {
+		bus.Publish(ctx, events.Event{Type: "order.created", UserID: "alice", Subject: order})
+	}
+	bus.Publish(ctx, events.Event{Type: "order.created", UserID: "bob", Subject: "5"})
+	bus.Publish(ctx, events.Event{Type: "untemplated", UserID: "alice"})
+
+	result := list(t, app, "")
+	assert.Equal(t, 3, result.Unread)
+	assert.Len(t, result.Notifications, 3)
+	latest := result.Notifications[0]
+	assert.Equal(t, "Order 4 received", latest.Title)
+	assert.Equal(t, "order.created", latest.Type)
+	assert.Nil(t, latest.ReadAt)
+
+	status, _ := do(t, app, "POST", "/me/notifications/"+latest.ID+"/read", "")
+	assert.Equal(t, 204, status)
+	status, _ = do(t, app, "POST", "/me/notifications/missing/read", "")
+	assert.Equal(t, 404, status)
+
+	result = list(t, app, "?unread=true")
+	assert.Equal(t, 2, result.Unread)
+	assert.Len(t, result.Notifications, 2)
+
+	do(t, app, "POST", "/me/notifications/read", "")
+	assert.Equal(t, 0, list(t, app, "").Unread)
+}
+
+func TestPreferences(t *testing.T) {
+	service, bus, app := newService(t)
+	sent := &outbox{}
+	service.AddChannel(Email{Sender: sent, Address: func(_ context.Context, userID string) (string, bool, error) {
+		return userID + "@example.com", true, nil
+	}})
+
+	status, _ := do(t, app, "PUT", "/me/notification-preferences", `{"channels":{"*":["sms"]}}`)
+	assert.Equal(t, 422, status)
+	status, _ = do(t, app, "PUT", "/me/notification-preferences", `{"webhook_url":"http://169.254.169.254/"}`)
+	assert.Equal(t, 422, status)
+	status, _ = do(t, app, "PUT", "/me/notification-preferences", `{"channels":{"order.created":["email"]}}`)
+	assert.Equal(t, 200, status)
+
+	bus.Publish(context.Background(), events.Event{Type: "order.created", UserID: "alice", Subject: "7"})
+	assert.Eventually(t, func() bool { return len(sent.sent()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "alice@example.com", sent.sent()[0].To)
+	assert.Equal(t, "Order 7 received", sent.sent()[0].Subject)
+	// Email only, as chosen.
+	assert.Len(t, list(t, app, "").Notifications, 0)
+}
+
+func TestWebhook(t *testing.T) {
+	consumer := testkit.NewServices(t).WebhookConsumer("alice")
+	consumer.Respond(http.StatusOK, "")
+
+	cfg := config.Default()
+	cfg.HTTPClient.MaxRetries = 0
+	registry := metrics.NewRegistry()
+	service := New(cfg.Notify, slog.New(slog.NewTextHandler(io.Discard, nil)), registry, testkit.OpenDB(t, Migrations...))
+	service.AddChannel(Webhook{Client: httpclient.New(cfg.HTTPClient), Secret: consumer.Secret})
+	// Set directly: the handler only accepts https URLs.
+	assert.Nil(t, service.SetPreferences(context.Background(), "alice", Preferences{
+		Channels:   map[string][]string{"*": {"webhook"}},
+		WebhookURL: consumer.URL,
+	}))
+
+	service.Dispatch(context.Background(), "alice", Notification{Type: "order.created", Title: "hi"})
+	received := consumer.WaitFor(1)[0]
+	assert.True(t, strings.HasPrefix(received.Header.Get("Authorization"), `HMAC-SHA256 keyId="notifications"`))
+	var n Notification
+	received.JSON(t, &n)
+	assert.Equal(t, "hi", n.Title)
+
+	consumer.Respond(http.StatusInternalServerError, "")
+	service.Dispatch(context.Background(), "alice", Notification{Type: "order.created"})
+	assert.Eventually(t, func() bool { return service.failures.Total() == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestPhone(t *testing.T) {
+	service, bus, app := newService(t)
+	service.limits = newLimiter(map[string]config.ChannelLimit{"sms": {Limit: 3, Window: time.Hour}})
+	at := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return at }
+	sms := messaging.NewMock(messaging.SMS)
+	service.AddChannel(Phone{Sender: sms})
+
+	status, _ := do(t, app, "POST", "/me/phone", `{"phone":"12345","channel":"sms"}`)
+	assert.Equal(t, 422, status)
+	status, _ = do(t, app, "POST", "/me/phone", `{"phone":"+6281234567890","channel":"email"}`)
+	assert.Equal(t, 422, status)
+	// Numbers are taken as written in Indonesia and stored in E.164.
+	status, _ = do(t, app, "POST", "/me/phone", `{"phone":"0812-3456-7890","channel":"sms"}`)
+	assert.Equal(t, 202, status)
+	assert.Equal(t, "+6281234567890", sms.Sent()[0].To)
+	assert.Len(t, sms.Sent(), 1)
+	code := strings.TrimSuffix(strings.Fields(sms.Sent()[0].Body)[4], ".")
+	assert.Len(t, code, 6)
+
+	status, _ = do(t, app, "POST", "/me/phone/confirm", `{"code":"nope"}`)
+	assert.Equal(t, 400, status)
+	status, body := do(t, app, "POST", "/me/phone/confirm", `{"code":"`+code+`"}`)
+	assert.Equal(t, 200, status)
+	assert.Contains(t, body, `"phone":"+6281234567890"`)
+	status, _ = do(t, app, "POST", "/me/phone/confirm", `{"code":"`+code+`"}`)
+	assert.Equal(t, 400, status)
+
+	// Choosing channels keeps the confirmed phone, and warns clients still
+	// sending one.
+	response := testkit.DoJSON(t, app, "PUT", "/me/notification-preferences", `{"channels":{"*":["sms"]},"phone":"+15005550006"}`, nil, testkit.WithUser("alice"))
+	response.AssertStatus(200)
+	assert.Contains(t, response.String(), `"phone":"+6281234567890"`)
+	assert.Equal(t, `299 - "phone is deprecated: set the phone with POST /me/phone"`, response.Header.Get("Warning"))
+
+	bus.Publish(context.Background(), events.Event{Type: "order.shipped", UserID: "alice", Subject: "7"})
+	assert.Eventually(t, func() bool { return len(sms.Sent()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, messaging.Message{To: "+6281234567890", Body: "Your order 7 is on its way."}, sms.Sent()[1])
+
+	// The code and the order update used two of the three messages.
+	bus.Publish(context.Background(), events.Event{Type: "order.delivered", UserID: "alice", Subject: "7"})
+	bus.Publish(context.Background(), events.Event{Type: "order.delivered", UserID: "alice", Subject: "8"})
+	assert.Eventually(t, func() bool { return len(sms.Sent()) == 3 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, float64(1), service.limited.With("sms").Value())
+
+	response = testkit.DoJSON(t, app, "POST", "/me/phone", `{"phone":"+6281234567890","channel":"sms"}`, nil, testkit.WithUser("alice"))
+	response.AssertStatus(429)
+	assert.Equal(t, "3600", response.Header.Get("Retry-After"))
+
+	at = at.Add(time.Hour)
+	sms.Fail(errors.New("provider down"))
+	status, _ = do(t, app, "POST", "/me/phone", `{"phone":"+6281234567890","channel":"sms"}`)
+	assert.Equal(t, 502, status)
+
+	status, _ = do(t, app, "DELETE", "/me/phone", "")
+	assert.Equal(t, 204, status)
+	prefs, err := service.Preferences(context.Background(), "alice")
+	assert.Nil(t, err)
+	assert.Equal(t, "", prefs.Phone)
+}
+
+func TestPhoneSealed(t *testing.T) {
+	service, _, app := newService(t)
+	cipher, err := pii.New(config.PIIConfig{Key: base64.StdEncoding.EncodeToString(make([]byte, 32))})
+	assert.Nil(t, err)
+	service.UseCipher(cipher)
+	sms := messaging.NewMock(messaging.SMS)
+	service.AddChannel(Phone{Sender: sms})
+
+	status, _ := do(t, app, "POST", "/me/phone", `{"phone":"+6281234567890","channel":"sms"}`)
+	assert.Equal(t, 202, status)
+	ctx := context.Background()
+	column := func(query string) string {
+		var value string
+		assert.Nil(t, service.db.QueryRowContext(ctx, query).Scan(&value))
+		return value
+	}
+	assert.NotContains(t, column(`SELECT phone FROM phone_codes WHERE user_id = 'alice'`), "6281234567890")
+	code := strings.TrimSuffix(strings.Fields(sms.Sent()[0].Body)[4], ".")
+	status, _ = do(t, app, "POST", "/me/phone/confirm", `{"code":"`+code+`"}`)
+	assert.Equal(t, 200, status)
+
+	assert.NotContains(t, column(`SELECT phone FROM notification_preferences WHERE user_id = 'alice'`), "6281234567890")
+	assert.NotContains(t, column(`SELECT phone_index FROM notification_preferences WHERE user_id = 'alice'`), "6281234567890")
+	prefs, err := service.Preferences(ctx, "alice")
+	assert.Nil(t, err)
+	assert.Equal(t, "+6281234567890", prefs.Phone)
+	userID, _, err := service.UserByPhone(ctx, "+6281234567890")
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", userID)
+
+	// Restarted, the phone is still found by its index.
+	restarted := New(service.cfg, service.logger, metrics.NewRegistry(), service.db)
+	restarted.UseCipher(cipher)
+	userID, _, _ = restarted.UserByPhone(ctx, "+6281234567890")
+	assert.Equal(t, "alice", userID)
+
+	status, _ = do(t, app, "DELETE", "/me/phone", "")
+	assert.Equal(t, 204, status)
+	_, found, _ := service.UserByPhone(ctx, "+6281234567890")
+	assert.False(t, found)
+}
+
+func TestCodeAttempts(t *testing.T) {
+	service, _, _ := newService(t)
+	at := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return at }
+	sms := messaging.NewMock(messaging.SMS)
+	service.AddChannel(Phone{Sender: sms})
+	ctx := context.Background()
+
+	assert.Nil(t, service.SendCode(ctx, "alice", "sms", "+6281234567890"))
+	code := strings.TrimSuffix(strings.Fields(sms.Sent()[0].Body)[4], ".")
+	for i := 0; i < codeAttempts; i++ {
+		_, err := service.ConfirmCode(ctx, "alice", "wrong")
+		assert.ErrorIs(t, err, ErrInvalidCode)
+	}
+	_, err := service.ConfirmCode(ctx, "alice", code)
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	assert.Nil(t, service.SendCode(ctx, "alice", "sms", "+6281234567890"))
+	code = strings.TrimSuffix(strings.Fields(sms.Sent()[1].Body)[4], ".")
+	at = at.Add(service.cfg.CodeTTL)
+	_, err = service.ConfirmCode(ctx, "alice", code)
+	assert.ErrorIs(t, err, ErrInvalidCode)
+}
+
+func TestPush(t *testing.T) {
+	var mu sync.Mutex
+	answer, pushed := http.StatusCreated, 0
+	pushService := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		pushed++
+		w.WriteHeader(answer)
+	}))
+	defer pushService.Close()
+	transport := http.DefaultTransport
+	http.DefaultTransport = pushService.Client().Transport
+	defer func() { http.DefaultTransport = transport }()
+
+	service, bus, app := newService(t)
+	private, public, err := webpush.GenerateKey()
+	assert.Nil(t, err)
+	sender, err := webpush.New(config.WebPushConfig{PrivateKey: private, Subject: "mailto:ops@example.com", TTL: time.Hour}, httpclient.New(config.Default().HTTPClient))
+	assert.Nil(t, err)
+	push := NewPush(sender)
+	push.Register(app)
+	service.AddChannel(push)
+
+	status, body := do(t, app, "GET", "/me/push/key", "")
+	assert.Equal(t, 200, status)
+	assert.Contains(t, body, public)
+
+	browser, err := ecdh.P256().GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	subscription := fmt.Sprintf(`{"endpoint":%q,"keys":{"p256dh":%q,"auth":"AAAAAAAAAAAAAAAAAAAAAA"}}`,
+		pushService.URL+"/push/1", base64.RawURLEncoding.EncodeToString(browser.PublicKey().Bytes()))
+	status, _ = do(t, app, "POST", "/me/push/subscriptions", strings.Replace(subscription, "https:", "http:", 1))
+	assert.Equal(t, 422, status)
+	status, _ = do(t, app, "POST", "/me/push/subscriptions", subscription)
+	assert.Equal(t, 201, status)
+	do(t, app, "POST", "/me/push/subscriptions", subscription)
+	assert.Len(t, push.Subscriptions("alice"), 1)
+
+	do(t, app, "PUT", "/me/notification-preferences", `{"channels":{"*":["push"]}}`)
+	bus.Publish(context.Background(), events.Event{Type: "order.shipped", UserID: "alice", Subject: "7"})
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return pushed == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// The browser unsubscribed: the push service forgets it, and so do we.
+	mu.Lock()
+	answer = http.StatusGone
+	mu.Unlock()
+	bus.Publish(context.Background(), events.Event{Type: "order.delivered", UserID: "alice", Subject: "7"})
+	assert.Eventually(t, func() bool { return len(push.Subscriptions("alice")) == 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, float64(0), service.failures.Total())
+
+	status, _ = do(t, app, "DELETE", "/me/push/subscriptions", `{"endpoint":"https://push.example.com/1"}`)
+	assert.Equal(t, 404, status)
+}
@@ -0,0 +1,147 @@
+package notifications
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/messaging"
+	"github.com/jalal-akbar/belajar-golang-fiber/pii"
+)
+
+// codeAttempts is how many wrong codes drop the pending one.
+const codeAttempts = 5
+
+var (
+	ErrNoPhoneChannel = errors.New("notifications: not a phone channel")
+	ErrInvalidCode    = errors.New("notifications: invalid or expired code")
+)
+
+// phoneCode is a code sent to confirm phone, which is sealed.
+type phoneCode struct {
+	phone    string
+	code     string
+	expires  time.Time
+	attempts int
+}
+
+// SendCode texts userID a one-time code over the phone channel named
+// channel, which confirms phone as theirs. A new code replaces the one
+// sent before. Codes count towards the channel's limit like any other
+// message, which fails with a *LimitError.
+func (s *Service) SendCode(ctx context.Context, userID, channel, phone string) error {
+	sender, ok := s.channels[channel].(Phone)
+	if !ok {
+		return ErrNoPhoneChannel
+	}
+	now := s.now()
+	if retryAfter, ok := s.limits.allow(channel, userID, now); !ok {
+		s.limited.With(channel).Inc()
+		return &LimitError{Channel: channel, RetryAfter: retryAfter}
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	err = s.putCode(ctx, userID, phoneCode{phone: s.cipher.Seal(userID, phone), code: code, expires: now.Add(s.cfg.CodeTTL)})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(correlation.Detach(ctx), s.cfg.Timeout)
+	defer cancel()
+	err = sender.Sender.Send(ctx, messaging.Message{
+		To:   phone,
+		Body: fmt.Sprintf("Your verification code is %s. It expires in %s.", code, s.cfg.CodeTTL),
+	})
+	if err != nil {
+		s.failures.With(channel).Inc()
+	}
+	return err
+}
+
+// ConfirmCode sets the phone the code was sent to as userID's, if code is
+// the one sent and hasn't expired.
+func (s *Service) ConfirmCode(ctx context.Context, userID, code string) (Preferences, error) {
+	var prefs Preferences
+	invalid := false
+	err := s.db.InTx(ctx, func(ctx context.Context) error {
+		pending, ok, err := s.getCode(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !ok || !s.now().Before(pending.expires) {
+			invalid = true
+			return s.deleteCode(ctx, userID)
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(pending.code)) != 1 {
+			invalid = true
+			pending.attempts++
+			if pending.attempts >= codeAttempts {
+				return s.deleteCode(ctx, userID)
+			}
+			return s.countAttempt(ctx, userID, pending.attempts)
+		}
+		if err := s.deleteCode(ctx, userID); err != nil {
+			return err
+		}
+		phone, err := s.cipher.Open(userID, pending.phone)
+		if err != nil {
+			return err
+		}
+		if prefs, err = s.Preferences(ctx, userID); err != nil {
+			return err
+		}
+		prefs.Phone = phone
+		return s.setPreferences(ctx, userID, prefs, true)
+	})
+	if err != nil {
+		return Preferences{}, err
+	}
+	if invalid {
+		return Preferences{}, ErrInvalidCode
+	}
+	return prefs, nil
+}
+
+// UseCipher keeps the phones sealed with cipher from then on.
+func (s *Service) UseCipher(cipher *pii.Cipher) {
+	s.cipher = cipher
+}
+
+// UserByPhone returns the user who confirmed phone. Should several have,
+// it is the one who did last.
+func (s *Service) UserByPhone(ctx context.Context, phone string) (string, bool, error) {
+	return s.userByIndex(ctx, s.cipher.Index("phone", phone))
+}
+
+// setPreferences keeps prefs with the phone sealed and indexed. A phone
+// counts as confirmed when it changes, or with confirm when it is
+// confirmed again.
+func (s *Service) setPreferences(ctx context.Context, userID string, prefs Preferences, confirm bool) error {
+	return s.db.InTx(ctx, func(ctx context.Context) error {
+		old, err := s.getPreferences(ctx, userID, s.db.ForUpdate())
+		if err != nil {
+			return err
+		}
+		stored := storedPreferences{Preferences: prefs}
+		var index sql.NullString
+		if prefs.Phone != "" {
+			index = sql.NullString{String: s.cipher.Index("phone", prefs.Phone), Valid: true}
+			stored.confirmed = old.confirmed
+			if phone, err := s.cipher.Open(userID, old.Phone); confirm || err != nil || phone != prefs.Phone {
+				stored.confirmed = sql.NullTime{Time: s.now().UTC(), Valid: true}
+			}
+		}
+		stored.Phone = s.cipher.Seal(userID, prefs.Phone)
+		return s.putPreferences(ctx, userID, stored, index)
+	})
+}
@@ -0,0 +1,129 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/webpush"
+)
+
+// maxSubscriptions is how many browsers a user can subscribe; subscribing
+// another drops the oldest.
+const maxSubscriptions = 10
+
+// Push pushes notifications to the browsers each user subscribed, as the
+// JSON of the notification. Subscriptions the push service says are gone
+// are forgotten.
+type Push struct {
+	sender *webpush.Sender
+
+	mu            sync.Mutex
+	subscriptions map[string][]webpush.Subscription
+}
+
+func NewPush(sender *webpush.Sender) *Push {
+	return &Push{sender: sender, subscriptions: map[string][]webpush.Subscription{}}
+}
+
+func (p *Push) Name() string { return "push" }
+
+func (p *Push) Send(ctx context.Context, userID string, prefs Preferences, n Notification) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, subscription := range p.Subscriptions(userID) {
+		err := p.sender.Send(ctx, subscription, payload)
+		if errors.Is(err, webpush.ErrGone) {
+			p.Unsubscribe(userID, subscription.Endpoint)
+			continue
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Subscribe adds a browser of userID, replacing an earlier subscription
+// with the same endpoint.
+func (p *Push) Subscribe(userID string, subscription webpush.Subscription) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := []webpush.Subscription{}
+	for _, existing := range p.subscriptions[userID] {
+		if existing.Endpoint != subscription.Endpoint {
+			list = append(list, existing)
+		}
+	}
+	list = append(list, subscription)
+	if len(list) > maxSubscriptions {
+		list = list[len(list)-maxSubscriptions:]
+	}
+	p.subscriptions[userID] = list
+}
+
+// Unsubscribe removes the browser with endpoint, reporting whether userID
+// had subscribed it.
+func (p *Push) Unsubscribe(userID, endpoint string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := p.subscriptions[userID]
+	for i, existing := range list {
+		if existing.Endpoint == endpoint {
+			p.subscriptions[userID] = append(list[:i:i], list[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Push) Subscriptions(userID string) []webpush.Subscription {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]webpush.Subscription{}, p.subscriptions[userID]...)
+}
+
+// Register adds the authenticated user's push endpoints:
+//
+//	GET    /me/push/key            the VAPID key to subscribe with
+//	POST   /me/push/subscriptions  a PushSubscription as JSON
+//	DELETE /me/push/subscriptions  with {"endpoint"}
+func (p *Push) Register(router fiber.Router) {
+	router.Get("/me/push/key", p.keyHandler)
+	router.Post("/me/push/subscriptions", p.subscribeHandler)
+	router.Delete("/me/push/subscriptions", p.unsubscribeHandler)
+}
+
+func (p *Push) keyHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"public_key": p.sender.PublicKey()})
+}
+
+func (p *Push) subscribeHandler(c *fiber.Ctx) error {
+	var subscription webpush.Subscription
+	if err := c.BodyParser(&subscription); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid subscription")
+	}
+	if err := webpush.Valid(subscription); err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+	p.Subscribe(utils.CopyString(ctxutil.CurrentUser(c)), subscription)
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+func (p *Push) unsubscribeHandler(c *fiber.Ctx) error {
+	var body struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid body")
+	}
+	if !p.Unsubscribe(ctxutil.CurrentUser(c), body.Endpoint) {
+		return fiber.ErrNotFound
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
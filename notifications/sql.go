@@ -0,0 +1,140 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+)
+
+// Migrations create the tables of the preferences and of the codes sent
+// to confirm phones. Phones are kept sealed, and found by their blind
+// index.
+var Migrations = []database.Migration{{
+	ID: "notifications-0001",
+	Statements: []string{
+		`CREATE TABLE notification_preferences (
+	user_id VARCHAR(255) PRIMARY KEY,
+	channels TEXT NOT NULL,
+	webhook_url TEXT NOT NULL,
+	phone TEXT NOT NULL,
+	phone_index VARCHAR(255) NULL,
+	phone_confirmed_at TIMESTAMP NULL
+)`,
+		`CREATE INDEX notification_preferences_phone_index ON notification_preferences (phone_index)`,
+		`CREATE TABLE phone_codes (
+	user_id VARCHAR(255) PRIMARY KEY,
+	phone TEXT NOT NULL,
+	code VARCHAR(16) NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	attempts INTEGER NOT NULL
+)`,
+	},
+}}
+
+// storedPreferences are preferences as kept, with the phone still sealed.
+type storedPreferences struct {
+	Preferences
+	confirmed sql.NullTime
+}
+
+// getPreferences returns the preferences of userID, the zero ones if they
+// set none. lock is appended to the query, to lock the row in a
+// transaction.
+func (s *Service) getPreferences(ctx context.Context, userID, lock string) (storedPreferences, error) {
+	var stored storedPreferences
+	var channels string
+	err := s.db.Conn(ctx).QueryRowContext(ctx, s.db.Rebind(`SELECT channels, webhook_url, phone, phone_confirmed_at FROM notification_preferences WHERE user_id = ?`+lock), userID).
+		Scan(&channels, &stored.WebhookURL, &stored.Phone, &stored.confirmed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storedPreferences{}, nil
+	}
+	if err != nil {
+		return storedPreferences{}, err
+	}
+	if err := json.Unmarshal([]byte(channels), &stored.Channels); err != nil {
+		return storedPreferences{}, err
+	}
+	return stored, nil
+}
+
+// putPreferences replaces the preferences of userID with stored, whose
+// phone is sealed under index.
+func (s *Service) putPreferences(ctx context.Context, userID string, stored storedPreferences, index sql.NullString) error {
+	channels, err := json.Marshal(stored.Channels)
+	if err != nil {
+		return err
+	}
+	conn := s.db.Conn(ctx)
+	if _, err := conn.ExecContext(ctx, s.db.Rebind(`DELETE FROM notification_preferences WHERE user_id = ?`), userID); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, s.db.Rebind(`INSERT INTO notification_preferences (user_id, channels, webhook_url, phone, phone_index, phone_confirmed_at) VALUES (?, ?, ?, ?, ?, ?)`),
+		userID, string(channels), stored.WebhookURL, stored.Phone, index, stored.confirmed)
+	return err
+}
+
+// putCode replaces the code pending for userID.
+func (s *Service) putCode(ctx context.Context, userID string, pending phoneCode) error {
+	return s.db.InTx(ctx, func(ctx context.Context) error {
+		conn := s.db.Conn(ctx)
+		if _, err := conn.ExecContext(ctx, s.db.Rebind(`DELETE FROM phone_codes WHERE user_id = ?`), userID); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, s.db.Rebind(`INSERT INTO phone_codes (user_id, phone, code, expires_at, attempts) VALUES (?, ?, ?, ?, ?)`),
+			userID, pending.phone, pending.code, pending.expires.UTC(), pending.attempts)
+		return err
+	})
+}
+
+// getCode returns the code pending for userID, locked for the transaction
+// of ctx; ok is false if there is none.
+func (s *Service) getCode(ctx context.Context, userID string) (pending phoneCode, ok bool, err error) {
+	err = s.db.Conn(ctx).QueryRowContext(ctx, s.db.Rebind(`SELECT phone, code, expires_at, attempts FROM phone_codes WHERE user_id = ?`+s.db.ForUpdate()), userID).
+		Scan(&pending.phone, &pending.code, &pending.expires, &pending.attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return phoneCode{}, false, nil
+	}
+	if err != nil {
+		return phoneCode{}, false, err
+	}
+	return pending, true, nil
+}
+
+// deleteCode drops the code pending for userID.
+func (s *Service) deleteCode(ctx context.Context, userID string) error {
+	_, err := s.db.Conn(ctx).ExecContext(ctx, s.db.Rebind(`DELETE FROM phone_codes WHERE user_id = ?`), userID)
+	return err
+}
+
+// countAttempt records a wrong code for the code pending for userID.
+func (s *Service) countAttempt(ctx context.Context, userID string, attempts int) error {
+	_, err := s.db.Conn(ctx).ExecContext(ctx, s.db.Rebind(`UPDATE phone_codes SET attempts = ? WHERE user_id = ?`), attempts, userID)
+	return err
+}
+
+// userByIndex returns the user who last confirmed the phone of index.
+func (s *Service) userByIndex(ctx context.Context, index string) (string, bool, error) {
+	var userID string
+	err := s.db.Conn(ctx).QueryRowContext(ctx, s.db.Rebind(`SELECT user_id FROM notification_preferences WHERE phone_index = ? ORDER BY phone_confirmed_at DESC LIMIT 1`), index).
+		Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return userID, true, nil
+}
+
+// forget drops the preferences and the code pending of userID.
+func (s *Service) forget(ctx context.Context, userID string) error {
+	return s.db.InTx(ctx, func(ctx context.Context) error {
+		if _, err := s.db.Conn(ctx).ExecContext(ctx, s.db.Rebind(`DELETE FROM notification_preferences WHERE user_id = ?`), userID); err != nil {
+			return err
+		}
+		return s.deleteCode(ctx, userID)
+	})
+}
@@ -0,0 +1,31 @@
+package notifications
+
+import (
+	"fmt"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+)
+
+// templates lists the events users are notified of.
+var templates = map[string]Template{
+	"order.created": func(event events.Event) (string, string) {
+		return fmt.Sprintf("Order %s received", event.Subject),
+			fmt.Sprintf("We received your order %s and will let you know when it ships.", event.Subject)
+	},
+	"order.paid": func(event events.Event) (string, string) {
+		return fmt.Sprintf("Order %s paid", event.Subject),
+			fmt.Sprintf("Thank you, we received the payment for order %s.", event.Subject)
+	},
+	"order.shipped": func(event events.Event) (string, string) {
+		return fmt.Sprintf("Order %s shipped", event.Subject),
+			fmt.Sprintf("Your order %s is on its way.", event.Subject)
+	},
+	"order.delivered": func(event events.Event) (string, string) {
+		return fmt.Sprintf("Order %s delivered", event.Subject),
+			fmt.Sprintf("Your order %s was delivered.", event.Subject)
+	},
+	"order.cancelled": func(event events.Event) (string, string) {
+		return fmt.Sprintf("Order %s cancelled", event.Subject),
+			fmt.Sprintf("Your order %s was cancelled.", event.Subject)
+	},
+}
@@ -0,0 +1,389 @@
+// Command generate writes the types and methods of gen/client from an
+// OpenAPI 3 document. It understands the part of OpenAPI the document
+// uses: object, array, string enum and scalar schemas, references to
+// components, path parameters, JSON bodies and bearer authentication.
+//
+//	go run ./openapi/generate -spec openapi/openapi.yaml -out gen/client/client.gen.go -package client
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+func main() {
+	specPath := flag.String("spec", "openapi/openapi.yaml", "OpenAPI document to generate from")
+	out := flag.String("out", "client.gen.go", "file to write")
+	pkg := flag.String("package", "client", "package of the generated file")
+	flag.Parse()
+
+	data, err := os.ReadFile(*specPath)
+	if err != nil {
+		fail(err)
+	}
+	source, err := Generate(data, *pkg)
+	if err != nil {
+		fail(err)
+	}
+	if err := os.WriteFile(*out, source, 0o644); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "generate:", err)
+	os.Exit(1)
+}
+
+type spec struct {
+	Paths      map[string]map[string]*operation `yaml:"paths"`
+	Security   []map[string][]string            `yaml:"security"`
+	Components struct {
+		Schemas map[string]*schema `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+type operation struct {
+	OperationID string                 `yaml:"operationId"`
+	Summary     string                 `yaml:"summary"`
+	Parameters  []parameter            `yaml:"parameters"`
+	RequestBody *body                  `yaml:"requestBody"`
+	Responses   map[string]body        `yaml:"responses"`
+	Security    *[]map[string][]string `yaml:"security"`
+}
+
+type parameter struct {
+	Name   string  `yaml:"name"`
+	In     string  `yaml:"in"`
+	Schema *schema `yaml:"schema"`
+}
+
+type body struct {
+	Content map[string]struct {
+		Schema *schema `yaml:"schema"`
+	} `yaml:"content"`
+}
+
+// json is the schema of the body's JSON, or nil.
+func (b *body) json() *schema {
+	if b == nil {
+		return nil
+	}
+	return b.Content["application/json"].Schema
+}
+
+type schema struct {
+	Ref         string     `yaml:"$ref"`
+	Type        string     `yaml:"type"`
+	Format      string     `yaml:"format"`
+	Description string     `yaml:"description"`
+	Enum        []string   `yaml:"enum"`
+	Required    []string   `yaml:"required"`
+	Properties  properties `yaml:"properties"`
+	Items       *schema    `yaml:"items"`
+}
+
+type property struct {
+	name   string
+	schema *schema
+}
+
+// properties keep the order of the document, which becomes the order of
+// the struct fields.
+type properties []property
+
+func (p *properties) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: properties aren't a mapping", node.Line)
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		s := &schema{}
+		if err := node.Content[i+1].Decode(s); err != nil {
+			return err
+		}
+		*p = append(*p, property{name: node.Content[i].Value, schema: s})
+	}
+	return nil
+}
+
+// Generate returns the gofmt'ed Go source of the client for the OpenAPI
+// document data, in package pkg.
+func Generate(data []byte, pkg string) ([]byte, error) {
+	var doc spec
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	g := &generator{}
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := g.declare(name, doc.Components.Schemas[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	type method struct {
+		path, verb string
+		op         *operation
+	}
+	var methods []method
+	for path, verbs := range doc.Paths {
+		for verb, op := range verbs {
+			methods = append(methods, method{path, strings.ToUpper(verb), op})
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].op.OperationID < methods[j].op.OperationID })
+	for _, m := range methods {
+		security := doc.Security
+		if m.op.Security != nil {
+			security = *m.op.Security
+		}
+		if err := g.method(m.path, m.verb, m.op, len(security) > 0); err != nil {
+			return nil, err
+		}
+	}
+
+	// The imports are known once the code using them is.
+	code := g.buf.String()
+	var header bytes.Buffer
+	fmt.Fprintf(&header, "// Code generated by openapi/generate from openapi/openapi.yaml. DO NOT EDIT.\n\npackage %s\n\nimport (\n\"context\"\n", pkg)
+	for _, imported := range []struct{ path, use string }{
+		{"encoding/json", "json."},
+		{"net/url", "url."},
+		{"time", "time."},
+	} {
+		if strings.Contains(code, imported.use) {
+			fmt.Fprintf(&header, "%q\n", imported.path)
+		}
+	}
+	header.WriteString(")\n\n")
+	return format.Source(append(header.Bytes(), code...))
+}
+
+type generator struct {
+	buf bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) comment(text string) {
+	for _, line := range wrap(strings.TrimSpace(text), 74) {
+		g.printf("// %s\n", line)
+	}
+}
+
+// declare writes the type of a component schema: a struct for objects, a
+// string type with constants for enums, and a plain type otherwise.
+func (g *generator) declare(name string, s *schema) error {
+	if s.Description != "" {
+		g.comment(name + " is " + lowerFirst(s.Description))
+	}
+	switch {
+	case s.Type == "object":
+		required := map[string]bool{}
+		for _, name := range s.Required {
+			required[name] = true
+		}
+		g.printf("type %s struct {\n", name)
+		for _, p := range s.Properties {
+			typ, err := goType(p.schema)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", name, p.name, err)
+			}
+			if p.schema.Description != "" {
+				g.comment(p.schema.Description)
+			}
+			tag := p.name
+			if !required[p.name] {
+				tag += ",omitempty"
+			}
+			g.printf("%s %s `json:%q`\n", exported(p.name), typ, tag)
+		}
+		g.printf("}\n\n")
+	case s.Type == "string" && len(s.Enum) > 0:
+		g.printf("type %s string\n\nconst (\n", name)
+		for _, value := range s.Enum {
+			g.printf("%s%s %s = %q\n", name, exported(value), name, value)
+		}
+		g.printf(")\n\n")
+	default:
+		typ, err := goType(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		g.printf("type %s %s\n\n", name, typ)
+	}
+	return nil
+}
+
+// method writes the client method of an operation, named by its
+// operationId.
+func (g *generator) method(path, verb string, op *operation, auth bool) error {
+	if op.OperationID == "" {
+		return fmt.Errorf("%s %s: no operationId", verb, path)
+	}
+	params := []string{"ctx context.Context"}
+	pathExpr := strconv.Quote(path)
+	for _, p := range op.Parameters {
+		if p.In != "path" {
+			return fmt.Errorf("%s: %s parameters aren't supported", op.OperationID, p.In)
+		}
+		name := unexported(p.Name)
+		params = append(params, name+" string")
+		pathExpr = strings.Replace(pathExpr, "{"+p.Name+"}", `" + url.PathEscape(`+name+`) + "`, 1)
+	}
+	pathExpr = strings.TrimSuffix(strings.TrimPrefix(pathExpr, `"" + `), ` + ""`)
+	bodyArg := ""
+	if s := op.RequestBody.json(); s != nil {
+		typ, err := goType(s)
+		if err != nil {
+			return fmt.Errorf("%s request: %w", op.OperationID, err)
+		}
+		params = append(params, "body "+typ)
+		bodyArg = ", body: body"
+	}
+
+	success, result := 0, (*schema)(nil)
+	for code, response := range op.Responses {
+		status, err := strconv.Atoi(code)
+		if err != nil || status < 200 || status > 299 || success != 0 && status > success {
+			continue
+		}
+		success, result = status, response.json()
+	}
+	if success == 0 {
+		return fmt.Errorf("%s: no 2xx response", op.OperationID)
+	}
+
+	g.comment(fmt.Sprintf("%s sends %s %s: %s", op.OperationID, verb, path, lowerFirst(op.Summary)))
+	if result == nil {
+		g.printf("func (c *Client) %s(%s) error {\n", op.OperationID, strings.Join(params, ", "))
+		g.printf("return c.do(ctx, call{method: %q, path: %s%s, success: %d, auth: %t})\n}\n\n",
+			verb, pathExpr, bodyArg, success, auth)
+		return nil
+	}
+	typ, err := goType(result)
+	if err != nil {
+		return fmt.Errorf("%s response: %w", op.OperationID, err)
+	}
+	// Objects are returned by pointer, slices and maps as they are.
+	resultType, ref := "*"+typ, "&out"
+	if strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[") {
+		resultType, ref = typ, "out"
+	}
+	g.printf("func (c *Client) %s(%s) (%s, error) {\n", op.OperationID, strings.Join(params, ", "), resultType)
+	g.printf("var out %s\n", typ)
+	g.printf("if err := c.do(ctx, call{method: %q, path: %s%s, out: &out, success: %d, auth: %t}); err != nil {\nreturn nil, err\n}\n",
+		verb, pathExpr, bodyArg, success, auth)
+	g.printf("return %s, nil\n}\n\n", ref)
+	return nil
+}
+
+// goType is the Go type of a schema used in a field, parameter or body.
+func goType(s *schema) (string, error) {
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+		if !ok {
+			return "", fmt.Errorf("unsupported reference %s", s.Ref)
+		}
+		return name, nil
+	}
+	switch s.Type {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			return "time.Time", nil
+		case "byte":
+			return "[]byte", nil
+		}
+		return "string", nil
+	case "integer":
+		if s.Format == "int64" {
+			return "int64", nil
+		}
+		return "int", nil
+	case "number":
+		// Decimals, such as amounts of money, are kept exact.
+		if s.Format == "decimal" {
+			return "json.Number", nil
+		}
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		if s.Items == nil {
+			return "", fmt.Errorf("array without items")
+		}
+		item, err := goType(s.Items)
+		return "[]" + item, err
+	case "object":
+		if len(s.Properties) == 0 {
+			return "map[string]interface{}", nil
+		}
+		return "", fmt.Errorf("inline objects aren't supported; declare them in components")
+	}
+	return "", fmt.Errorf("unsupported type %q", s.Type)
+}
+
+// initialisms are written in capitals in Go names, as in UserID.
+var initialisms = map[string]bool{"id": true, "sku": true, "url": true, "uri": true, "api": true, "http": true, "json": true, "ip": true}
+
+// exported turns a JSON name such as user_id into a Go name such as
+// UserID.
+func exported(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == ' ' || r == '.' }) {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+func unexported(name string) string {
+	name = exported(name)
+	if initialisms[strings.ToLower(name)] {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// wrap breaks text into lines of at most width bytes, between words.
+func wrap(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	return append(lines, line)
+}
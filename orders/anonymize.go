@@ -0,0 +1,24 @@
+package orders
+
+import "context"
+
+// Anonymize hands the orders of userID over to pseudonym, for a user
+// whose account is erased: the orders stay in the books, but no longer
+// say whose they were. It returns how many it changed, and may be called
+// again after an error.
+func Anonymize(ctx context.Context, repo Repository, userID, pseudonym string) (int, error) {
+	list, err := repo.ListByUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	for i, order := range list {
+		_, err := repo.Update(ctx, order.ID, func(ctx context.Context, order *Order) error {
+			order.UserID = pseudonym
+			return nil
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(list), nil
+}
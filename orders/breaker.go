@@ -0,0 +1,67 @@
+package orders
+
+import (
+	"context"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+)
+
+// BreakerRepository passes the calls of a Repository through a database
+// circuit breaker, so they fail fast with a *database.UnavailableError
+// while the database is failing.
+type BreakerRepository struct {
+	repo    Repository
+	breaker *database.Breaker
+}
+
+func NewBreakerRepository(repo Repository, breaker *database.Breaker) *BreakerRepository {
+	return &BreakerRepository{repo: repo, breaker: breaker}
+}
+
+func (r *BreakerRepository) Create(ctx context.Context, order Order) error {
+	return r.breaker.Do(func() error {
+		return r.repo.Create(ctx, order)
+	})
+}
+
+func (r *BreakerRepository) Get(ctx context.Context, id string) (order Order, err error) {
+	err = r.breaker.Do(func() error {
+		order, err = r.repo.Get(ctx, id)
+		return err
+	})
+	return order, err
+}
+
+func (r *BreakerRepository) ListByUser(ctx context.Context, userID string) (orders []Order, err error) {
+	err = r.breaker.Do(func() error {
+		orders, err = r.repo.ListByUser(ctx, userID)
+		return err
+	})
+	return orders, err
+}
+
+func (r *BreakerRepository) ListRecent(ctx context.Context, limit int) (orders []Order, err error) {
+	err = r.breaker.Do(func() error {
+		orders, err = r.repo.ListRecent(ctx, limit)
+		return err
+	})
+	return orders, err
+}
+
+// Update goes through the breaker as one call: errors of change are the
+// caller's and don't count against the database.
+func (r *BreakerRepository) Update(ctx context.Context, id string, change func(ctx context.Context, order *Order) error) (order Order, err error) {
+	err = r.breaker.Do(func() error {
+		order, err = r.repo.Update(ctx, id, change)
+		return err
+	})
+	return order, err
+}
+
+func (r *BreakerRepository) NextNumber(ctx context.Context, series string) (n int64, err error) {
+	err = r.breaker.Do(func() error {
+		n, err = r.repo.NextNumber(ctx, series)
+		return err
+	})
+	return n, err
+}
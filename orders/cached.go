@@ -0,0 +1,68 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/cache"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+)
+
+// CachedRepository puts a cache in front of the order lookups of a
+// Repository. Create and Update invalidate the cached order once it is
+// stored; a lookup racing a change may still cache the order as it was,
+// for at most the TTL. Lists aren't cached.
+type CachedRepository struct {
+	Repository
+	orders *cache.Aside[Order]
+}
+
+func NewCachedRepository(repo Repository, store cache.Store, ttl time.Duration, registry *metrics.Registry) *CachedRepository {
+	return &CachedRepository{Repository: repo, orders: cache.NewAside[Order](store, "orders", ttl, registry)}
+}
+
+func (r *CachedRepository) Create(ctx context.Context, order Order) error {
+	if err := r.Repository.Create(ctx, order); err != nil {
+		return err
+	}
+	r.invalidate(ctx, order.ID)
+	return nil
+}
+
+func (r *CachedRepository) Get(ctx context.Context, id string) (Order, error) {
+	return r.orders.Get(ctx, id, func(ctx context.Context) (Order, error) {
+		return r.Repository.Get(ctx, id)
+	})
+}
+
+// Warm caches the orders with the given IDs. Those that don't exist are
+// skipped.
+func (r *CachedRepository) Warm(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		err := r.orders.Warm(ctx, id, func(ctx context.Context) (Order, error) {
+			return r.Repository.Get(ctx, id)
+		})
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *CachedRepository) Update(ctx context.Context, id string, change func(ctx context.Context, order *Order) error) (Order, error) {
+	order, err := r.Repository.Update(ctx, id, change)
+	if err != nil {
+		return order, err
+	}
+	r.invalidate(ctx, id)
+	return order, nil
+}
+
+// invalidate drops the cached order once the change is committed: until
+// then lookups outside the transaction still see the order as it was.
+func (r *CachedRepository) invalidate(ctx context.Context, id string) {
+	ctx = context.WithoutCancel(ctx)
+	database.AfterCommit(ctx, func() { r.orders.Invalidate(ctx, id) })
+}
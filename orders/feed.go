@@ -0,0 +1,47 @@
+package orders
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/feed"
+)
+
+// feedSize is how many orders the feed lists.
+const feedSize = 20
+
+// FeedHandler answers with a feed of the newest orders of all users, for
+// staff to follow. baseURL is the public URL of the app; the entries link
+// to the orders in the API.
+func (s *Service) FeedHandler(baseURL string) fiber.Handler {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return feed.Handler(func(c *fiber.Ctx) (feed.Feed, error) {
+		list, err := s.Recent(c.UserContext(), feedSize)
+		if err != nil {
+			return feed.Feed{}, err
+		}
+		recent := feed.Feed{ID: baseURL + "/web/feed.xml", Title: "Recent orders", Link: baseURL + "/web/feed.xml"}
+		for _, order := range list {
+			link := baseURL + "/api/orders/" + order.ID
+			items := 0
+			for _, item := range order.Items {
+				items += item.Quantity
+			}
+			recent.Entries = append(recent.Entries, feed.Entry{
+				ID:      link,
+				Title:   fmt.Sprintf("Order %s is %s", order.ID, order.Status),
+				Link:    link,
+				Summary: fmt.Sprintf("%d items for %s by %s", items, order.Amount.Format(), order.UserID),
+				Updated: order.UpdatedAt,
+			})
+			if order.UpdatedAt.After(recent.Updated) {
+				recent.Updated = order.UpdatedAt
+			}
+		}
+		if recent.Updated.IsZero() {
+			recent.Updated = s.now()
+		}
+		return recent, nil
+	})
+}
@@ -0,0 +1,294 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The GORM models map to the tables of Migrations, so both repositories
+// can share a database. Sizes are given for MySQL, which can't index
+// unbounded text.
+type gormOrder struct {
+	ID            string     `gorm:"primaryKey;size:64"`
+	UserID        string     `gorm:"size:64;not null;index:orders_user_id,priority:1"`
+	Status        string     `gorm:"size:16;not null"`
+	Amount        int64      `gorm:"not null"`
+	Currency      string     `gorm:"size:3;not null"`
+	InvoiceNumber string     `gorm:"size:32;not null;default:''"`
+	CreatedAt     time.Time  `gorm:"not null;autoCreateTime:false;index:orders_user_id,priority:2"`
+	UpdatedAt     time.Time  `gorm:"not null;autoUpdateTime:false"`
+	Items         []gormItem `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE"`
+}
+
+func (gormOrder) TableName() string { return "orders" }
+
+type gormItem struct {
+	OrderID  string `gorm:"primaryKey;size:64"`
+	Position int    `gorm:"primaryKey;autoIncrement:false"`
+	SKU      string `gorm:"size:64;not null"`
+	Quantity int    `gorm:"not null"`
+	Price    int64  `gorm:"not null"`
+}
+
+func (gormItem) TableName() string { return "order_items" }
+
+type gormSequence struct {
+	Series string `gorm:"primaryKey;size:64"`
+	Value  int64  `gorm:"not null"`
+}
+
+func (gormSequence) TableName() string { return "sequences" }
+
+// The columns GORM adds to tables that still keep amounts in major
+// units, to move them to minor units.
+type minorUnitsOrder struct {
+	AmountMinor int64 `gorm:"not null;default:0"`
+}
+
+func (minorUnitsOrder) TableName() string { return "orders" }
+
+type minorUnitsItem struct {
+	PriceMinor int64 `gorm:"not null;default:0"`
+}
+
+func (minorUnitsItem) TableName() string { return "order_items" }
+
+// AutoMigrate creates or updates the tables of GormRepository. Tables
+// that still keep amounts in major units are moved to minor units first,
+// as the orders-0002 migration does.
+func AutoMigrate(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if migrator.HasTable(&gormOrder{}) {
+		columns, err := migrator.ColumnTypes(&gormOrder{})
+		if err != nil {
+			return err
+		}
+		for _, column := range columns {
+			if column.Name() == "amount" && !strings.Contains(strings.ToUpper(column.DatabaseTypeName()), "INT") {
+				if err := toMinorUnitsGorm(db); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return db.AutoMigrate(&gormOrder{}, &gormItem{}, &gormSequence{})
+}
+
+func toMinorUnitsGorm(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+		if err := migrator.AddColumn(&minorUnitsOrder{}, "AmountMinor"); err != nil {
+			return err
+		}
+		if err := migrator.AddColumn(&minorUnitsItem{}, "PriceMinor"); err != nil {
+			return err
+		}
+		for _, statement := range toMinorUnits {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		if err := migrator.DropColumn(&gormOrder{}, "amount"); err != nil {
+			return err
+		}
+		if err := migrator.DropColumn(&gormItem{}, "price"); err != nil {
+			return err
+		}
+		if err := migrator.RenameColumn(&minorUnitsOrder{}, "amount_minor", "amount"); err != nil {
+			return err
+		}
+		return migrator.RenameColumn(&minorUnitsItem{}, "price_minor", "price")
+	})
+}
+
+// GormRepository keeps orders in a database through GORM. Times are
+// stored in UTC.
+type GormRepository struct {
+	db *gorm.DB
+}
+
+func NewGormRepository(db *gorm.DB) *GormRepository {
+	return &GormRepository{db: db}
+}
+
+// conn returns a session on the transaction of ctx, or else on the pool.
+func (r *GormRepository) conn(ctx context.Context) *gorm.DB {
+	db := r.db.WithContext(ctx)
+	if tx, ok := database.Tx(ctx); ok {
+		db.Statement.ConnPool = tx
+	}
+	return db
+}
+
+// inTx shares the transactions of the database package, so GORM and SQL
+// repositories can take part in the same one.
+func (r *GormRepository) inTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	pool, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	return database.InTx(ctx, pool, fn)
+}
+
+// withItems preloads the items of the orders a query loads.
+func withItems(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position") })
+}
+
+func (r *GormRepository) Create(ctx context.Context, order Order) error {
+	row := toGormOrder(order)
+	return database.Conflict(r.conn(ctx).Create(&row).Error)
+}
+
+func (r *GormRepository) Get(ctx context.Context, id string) (Order, error) {
+	return r.get(r.conn(ctx), id)
+}
+
+func (r *GormRepository) get(db *gorm.DB, id string) (Order, error) {
+	var row gormOrder
+	err := withItems(db).Where("id = ?", id).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Order{}, ErrNotFound
+	}
+	if err != nil {
+		return Order{}, err
+	}
+	return row.order()
+}
+
+// ListByUser returns the orders of a user with their items, newest first.
+func (r *GormRepository) ListByUser(ctx context.Context, userID string) ([]Order, error) {
+	var rows []gormOrder
+	err := withItems(r.conn(ctx)).Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return toOrders(rows)
+}
+
+// ListRecent returns the limit newest orders of all users with their
+// items, newest first.
+func (r *GormRepository) ListRecent(ctx context.Context, limit int) ([]Order, error) {
+	var rows []gormOrder
+	err := withItems(r.conn(ctx)).Order("created_at DESC, id DESC").Limit(limit).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return toOrders(rows)
+}
+
+func (r *GormRepository) Update(ctx context.Context, id string, change func(ctx context.Context, order *Order) error) (Order, error) {
+	var order Order
+	err := r.inTx(ctx, func(ctx context.Context) error {
+		var err error
+		order, err = r.get(r.conn(ctx).Clauses(clause.Locking{Strength: "UPDATE"}), id)
+		if err != nil {
+			return err
+		}
+		if err := change(ctx, &order); err != nil {
+			return err
+		}
+		row := toGormOrder(order)
+		conn := r.conn(ctx)
+		err = conn.Model(&gormOrder{ID: id}).Updates(map[string]any{
+			"user_id":        row.UserID,
+			"status":         row.Status,
+			"amount":         row.Amount,
+			"currency":       row.Currency,
+			"invoice_number": row.InvoiceNumber,
+			"updated_at":     row.UpdatedAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := conn.Where("order_id = ?", id).Delete(&gormItem{}).Error; err != nil {
+			return err
+		}
+		if len(row.Items) == 0 {
+			return nil
+		}
+		return conn.Create(&row.Items).Error
+	})
+	if err != nil {
+		return Order{}, database.Conflict(err)
+	}
+	return order, nil
+}
+
+// NextNumber counts in the transaction of ctx, which keeps the series
+// locked until it ends.
+func (r *GormRepository) NextNumber(ctx context.Context, series string) (int64, error) {
+	var sequence gormSequence
+	err := r.inTx(ctx, func(ctx context.Context) error {
+		conn := r.conn(ctx)
+		err := conn.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "series"}},
+			DoUpdates: clause.Assignments(map[string]any{"value": gorm.Expr("sequences.value + 1")}),
+		}).Create(&gormSequence{Series: series, Value: 1}).Error
+		if err != nil {
+			return err
+		}
+		return conn.Where("series = ?", series).First(&sequence).Error
+	})
+	return sequence.Value, err
+}
+
+func toGormOrder(order Order) gormOrder {
+	row := gormOrder{
+		ID:            order.ID,
+		UserID:        order.UserID,
+		Status:        string(order.Status),
+		Amount:        order.Amount.Minor(),
+		Currency:      order.Amount.Currency(),
+		InvoiceNumber: order.InvoiceNumber,
+		CreatedAt:     order.CreatedAt.UTC(),
+		UpdatedAt:     order.UpdatedAt.UTC(),
+	}
+	for i, item := range order.Items {
+		row.Items = append(row.Items, gormItem{OrderID: order.ID, Position: i, SKU: item.SKU, Quantity: item.Quantity, Price: item.Price.Minor()})
+	}
+	return row
+}
+
+func toOrders(rows []gormOrder) ([]Order, error) {
+	list := make([]Order, 0, len(rows))
+	for _, row := range rows {
+		order, err := row.order()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, order)
+	}
+	return list, nil
+}
+
+func (row gormOrder) order() (Order, error) {
+	amount, err := money.New(row.Amount, row.Currency)
+	if err != nil {
+		return Order{}, err
+	}
+	order := Order{
+		ID:            row.ID,
+		UserID:        row.UserID,
+		Status:        Status(row.Status),
+		Amount:        amount,
+		InvoiceNumber: row.InvoiceNumber,
+		CreatedAt:     row.CreatedAt.UTC(),
+		UpdatedAt:     row.UpdatedAt.UTC(),
+	}
+	for _, item := range row.Items {
+		price, err := money.New(item.Price, row.Currency)
+		if err != nil {
+			return Order{}, err
+		}
+		order.Items = append(order.Items, Item{SKU: item.SKU, Quantity: item.Quantity, Price: price})
+	}
+	return order, nil
+}
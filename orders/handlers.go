@@ -0,0 +1,147 @@
+package orders
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/money"
+	"github.com/jalal-akbar/belajar-golang-fiber/routing"
+)
+
+// Routes declares the order endpoints of the authenticated user:
+//
+//	POST /orders              create an order
+//	GET  /orders              the user's orders
+//	GET  /orders/:id
+//	POST /orders/:id/cancel
+//	PUT  /orders/:id/status   set any status the lifecycle allows; staff only
+//
+// staff guards the status endpoint.
+func (s *Service) Routes(staff fiber.Handler) []routing.Route {
+	return []routing.Route{
+		{Method: fiber.MethodPost, Path: "/orders", Name: "orders.create", Handler: s.createHandler},
+		{Method: fiber.MethodGet, Path: "/orders", Name: "orders.list", Handler: s.listHandler},
+		{Method: fiber.MethodGet, Path: "/orders/:id", Name: "orders.get", Handler: s.getHandler},
+		{Method: fiber.MethodPost, Path: "/orders/:id/cancel", Name: "orders.cancel", Handler: s.cancelHandler},
+		{Method: fiber.MethodPut, Path: "/orders/:id/status", Name: "orders.status", Handler: s.statusHandler, Middlewares: []fiber.Handler{staff}},
+	}
+}
+
+// Register adds the endpoints of Routes to router.
+func (s *Service) Register(router fiber.Router, staff fiber.Handler) {
+	routing.Register(router, s.Routes(staff))
+}
+
+// createHandler creates an order from a body such as
+// {"items":[{"sku":"kopi","quantity":2,"price":15000}],"currency":"IDR"},
+// with the prices numbers or strings in major units of the currency.
+func (s *Service) createHandler(c *fiber.Ctx) error {
+	var body struct {
+		Items []struct {
+			SKU      string      `json:"sku"`
+			Quantity int         `json:"quantity"`
+			Price    json.Number `json:"price"`
+		} `json:"items"`
+		Currency string `json:"currency"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid order")
+	}
+	if body.Currency == "" {
+		body.Currency = defaultCurrency
+	}
+	if !money.Known(body.Currency) {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "unknown currency "+body.Currency)
+	}
+	items := make([]Item, len(body.Items))
+	for i, item := range body.Items {
+		if item.Price == "" {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, "items need a price")
+		}
+		price, err := money.Parse(item.Price.String(), body.Currency)
+		if err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("price %s isn't an amount of %s", item.Price, body.Currency))
+		}
+		items[i] = Item{SKU: item.SKU, Quantity: item.Quantity, Price: price}
+	}
+	userID := ctxutil.CurrentUser(c)
+	order, err := s.Create(c.UserContext(), utils.CopyString(userID), items)
+	if err != nil {
+		return httpError(err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(order)
+}
+
+func (s *Service) listHandler(c *fiber.Ctx) error {
+	userID := ctxutil.CurrentUser(c)
+	list, err := s.List(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(list)
+}
+
+func (s *Service) getHandler(c *fiber.Ctx) error {
+	order, err := s.own(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(order)
+}
+
+func (s *Service) cancelHandler(c *fiber.Ctx) error {
+	order, err := s.own(c)
+	if err != nil {
+		return err
+	}
+	order, err = s.Transition(c.UserContext(), order.ID, Cancelled)
+	if err != nil {
+		return httpError(err)
+	}
+	return c.JSON(order)
+}
+
+func (s *Service) statusHandler(c *fiber.Ctx) error {
+	var body struct {
+		Status Status `json:"status"`
+	}
+	if err := c.BodyParser(&body); err != nil || !body.Status.Valid() {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid status")
+	}
+	order, err := s.Transition(c.UserContext(), c.Params("id"), body.Status)
+	if err != nil {
+		return httpError(err)
+	}
+	return c.JSON(order)
+}
+
+// own returns the order of the :id parameter if it belongs to the
+// request's user. Others' orders are reported missing.
+func (s *Service) own(c *fiber.Ctx) (Order, error) {
+	order, err := s.Get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return Order{}, httpError(err)
+	}
+	if userID := ctxutil.CurrentUser(c); order.UserID != userID {
+		return Order{}, fiber.ErrNotFound
+	}
+	return order, nil
+}
+
+func httpError(err error) error {
+	var transition *TransitionError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return fiber.ErrNotFound
+	case errors.As(err, &transition):
+		return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("order is %s and can't become %s", transition.From, transition.To))
+	case errors.Is(err, ErrInvalid):
+		return fiber.NewError(fiber.StatusUnprocessableEntity, strings.TrimPrefix(err.Error(), "orders: "))
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+// Package orders models orders and their lifecycle.
+package orders
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/money"
+)
+
+type Status string
+
+const (
+	Created   Status = "created"
+	Paid      Status = "paid"
+	Shipped   Status = "shipped"
+	Delivered Status = "delivered"
+	Cancelled Status = "cancelled"
+)
+
+// transitions is the order lifecycle:
+//
+//	created → paid → shipped → delivered
+//	   ↓        ↓
+//	cancelled cancelled
+var transitions = map[Status][]Status{
+	Created: {Paid, Cancelled},
+	Paid:    {Shipped, Cancelled},
+	Shipped: {Delivered},
+}
+
+var ErrNotFound = errors.New("orders: order not found")
+
+// TransitionError is returned for a transition the lifecycle doesn't
+// allow.
+type TransitionError struct {
+	From, To Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("orders: can't go from %s to %s", e.From, e.To)
+}
+
+// CanTransition reports whether an order may go from one status to
+// another.
+func CanTransition(from, to Status) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Status) Valid() bool {
+	switch s {
+	case Created, Paid, Shipped, Delivered, Cancelled:
+		return true
+	}
+	return false
+}
+
+type Item struct {
+	SKU      string
+	Quantity int
+	Price    money.Money
+}
+
+// Order IDs are Snowflake IDs, so they sort by creation time. Paid orders
+// get an invoice number, INV-<year>-<n>, numbered without gaps per year.
+// Its items are priced in the currency of its amount.
+type Order struct {
+	ID            string
+	UserID        string
+	Status        Status
+	Items         []Item
+	Amount        money.Money
+	InvoiceNumber string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// wireOrder is the JSON of an order. The amount and the prices are
+// written as Money writes them, {"amount":"15000.00","currency":"IDR"},
+// next to the currency of the order.
+type wireOrder struct {
+	ID            string      `json:"id"`
+	UserID        string      `json:"user_id"`
+	Status        Status      `json:"status"`
+	Items         []wireItem  `json:"items"`
+	Amount        money.Money `json:"amount"`
+	Currency      string      `json:"currency"`
+	InvoiceNumber string      `json:"invoice_number,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+type wireItem struct {
+	SKU      string      `json:"sku"`
+	Quantity int         `json:"quantity"`
+	Price    money.Money `json:"price"`
+}
+
+func (o Order) MarshalJSON() ([]byte, error) {
+	wire := wireOrder{
+		ID:            o.ID,
+		UserID:        o.UserID,
+		Status:        o.Status,
+		Items:         make([]wireItem, len(o.Items)),
+		Amount:        o.Amount,
+		Currency:      o.Amount.Currency(),
+		InvoiceNumber: o.InvoiceNumber,
+		CreatedAt:     o.CreatedAt,
+		UpdatedAt:     o.UpdatedAt,
+	}
+	for i, item := range o.Items {
+		wire.Items[i] = wireItem(item)
+	}
+	return json.Marshal(wire)
+}
+
+func (o *Order) UnmarshalJSON(data []byte) error {
+	var wire wireOrder
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	*o = Order{
+		ID:            wire.ID,
+		UserID:        wire.UserID,
+		Status:        wire.Status,
+		Amount:        wire.Amount,
+		InvoiceNumber: wire.InvoiceNumber,
+		CreatedAt:     wire.CreatedAt,
+		UpdatedAt:     wire.UpdatedAt,
+	}
+	for _, item := range wire.Items {
+		o.Items = append(o.Items, Item(item))
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/cache"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/money"
+	"github.com/jalal-akbar/belajar-golang-fiber/outbox"
+	"github.com/jalal-akbar/belajar-golang-fiber/sequence"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newService(t *testing.T, bus *events.Bus) *Service {
+	ids, err := sequence.NewSnowflake(1)
+	assert.Nil(t, err)
+	return NewService(NewMemoryRepository(), bus, ids)
+}
+
+func TestCreateWithClockAndIDs(t *testing.T) {
+	service := NewService(NewMemoryRepository(), events.NewBus(), sequence.NewStepper("order-"))
+	now := clock.NewFake(time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+	service.UseClock(now)
+	ctx := context.Background()
+
+	order, err := service.Create(ctx, "alice", []Item{{SKU: "kopi", Quantity: 1, Price: money.MustParse("15000", "IDR")}})
+	assert.Nil(t, err)
+	assert.Equal(t, Order{
+		ID:        "order-1",
+		UserID:    "alice",
+		Status:    Created,
+		Items:     []Item{{SKU: "kopi", Quantity: 1, Price: money.MustParse("15000", "IDR")}},
+		Amount:    money.MustParse("15000", "IDR"),
+		CreatedAt: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+	}, order)
+
+	now.Advance(time.Hour)
+	order, err = service.Transition(ctx, order.ID, Cancelled)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC), order.UpdatedAt)
+
+	second, err := service.Create(ctx, "alice", []Item{{SKU: "teh", Quantity: 1, Price: money.MustParse("8000", "IDR")}})
+	assert.Nil(t, err)
+	assert.Equal(t, "order-2", second.ID)
+}
+
+func TestCanTransition(t *testing.T) {
+	allowed := map[Status][]Status{
+		Created: {Paid, Cancelled},
+		Paid:    {Shipped, Cancelled},
+		Shipped: {Delivered},
+	}
+	all := []Status{Created, Paid, Shipped, Delivered, Cancelled}
+	for _, from := range all {
+		for _, to := range all {
+			want := false
+			for _, next := range allowed[from] {
+				want = want || next == to
+			}
+			assert.Equal(t, want, CanTransition(from, to), "%s → %s", from, to)
+		}
+	}
+}
+
+func TestTransitionsPublishEvents(t *testing.T) {
+	bus := events.NewBus()
+	var published []events.Event
+	bus.Subscribe("*", func(ctx context.Context, event events.Event) {
+		published = append(published, event)
+	})
+	service := newService(t, bus)
+	ctx := context.Background()
+
+	order, err := service.Create(ctx, "alice", []Item{{SKU: "kopi", Quantity: 2, Price: money.MustParse("15000", "IDR")}})
+	assert.Nil(t, err)
+	assert.Equal(t, Created, order.Status)
+	assert.Equal(t, money.MustParse("30000", "IDR"), order.Amount)
+
+	for _, status := range []Status{Paid, Shipped, Delivered} {
+		order, err = service.Transition(ctx, order.ID, status)
+		assert.Nil(t, err)
+		assert.Equal(t, status, order.Status)
+	}
+
+	_, err = service.Transition(ctx, order.ID, Cancelled)
+	var transition *TransitionError
+	assert.True(t, errors.As(err, &transition))
+	assert.Equal(t, Delivered, transition.From)
+
+	var types []string
+	for _, event := range published {
+		types = append(types, event.Type)
+		assert.Equal(t, "alice", event.UserID)
+		assert.Equal(t, order.ID, event.Subject)
+	}
+	assert.Equal(t, []string{"order.created", "order.paid", "order.shipped", "order.delivered"}, types)
+	assert.Equal(t, "paid", published[2].Data["from"])
+	assert.Equal(t, fmt.Sprintf("INV-%d-000001", time.Now().UTC().Year()), order.InvoiceNumber)
+
+	_, err = service.Create(ctx, "alice", nil)
+	assert.ErrorIs(t, err, ErrInvalid)
+	_, err = service.Transition(ctx, "missing", Paid)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// Orders paid at the same time get consecutive invoice numbers, and only
+// paid orders use one up.
+func TestInvoiceNumbersWithoutGaps(t *testing.T) {
+	for name, newRepo := range repositories {
+		newRepo := newRepo
+		t.Run(name, func(t *testing.T) {
+			ids, _ := sequence.NewSnowflake(1)
+			testInvoiceNumbers(t, NewService(newRepo(t), events.NewBus(), ids))
+		})
+	}
+}
+
+func testInvoiceNumbers(t *testing.T, service *Service) {
+	ctx := context.Background()
+	var ids []string
+	for i := 0; i < 200; i++ {
+		order, err := service.Create(ctx, "alice", []Item{{SKU: "kopi", Quantity: 1, Price: money.MustParse("1", "IDR")}})
+		assert.Nil(t, err)
+		ids = append(ids, order.ID)
+	}
+
+	var wg sync.WaitGroup
+	numbers := make(chan string, len(ids)*2)
+	for _, id := range ids {
+		wg.Add(2)
+		// Racing to pay and to cancel: orders cancelled first get no number.
+		go func(id string) {
+			defer wg.Done()
+			if order, err := service.Transition(ctx, id, Paid); err == nil {
+				numbers <- order.InvoiceNumber
+			}
+		}(id)
+		go func(id string) {
+			defer wg.Done()
+			service.Transition(ctx, id, Cancelled)
+		}(id)
+	}
+	wg.Wait()
+	close(numbers)
+
+	var seen []int
+	prefix := fmt.Sprintf("INV-%d-", time.Now().UTC().Year())
+	for number := range numbers {
+		assert.True(t, strings.HasPrefix(number, prefix), number)
+		n, err := strconv.Atoi(strings.TrimPrefix(number, prefix))
+		assert.Nil(t, err)
+		seen = append(seen, n)
+	}
+	sort.Ints(seen)
+	assert.NotEmpty(t, seen)
+	for i := 1; i < len(seen); i++ {
+		assert.Equal(t, seen[i-1]+1, seen[i], "numbers %d and %d", seen[i-1], seen[i])
+	}
+}
+
+func TestFeed(t *testing.T) {
+	service := NewService(NewMemoryRepository(), events.NewBus(), sequence.NewStepper("order-"))
+	now := clock.NewFake(time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+	service.UseClock(now)
+	app := fiber.New()
+	app.Get("/web/feed.xml", service.FeedHandler("https://shop.example/"))
+
+	testkit.Do(t, app, "GET", "/web/feed.xml", nil).AssertStatus(200).
+		AssertContains(`<updated>2024-05-01T08:00:00Z</updated><link href="https://shop.example/web/feed.xml"></link></feed>`)
+
+	ctx := context.Background()
+	service.Create(ctx, "alice", []Item{{SKU: "kopi", Quantity: 2, Price: money.MustParse("15000", "IDR")}})
+	now.Advance(time.Hour)
+	service.Create(ctx, "bob", []Item{{SKU: "teh", Quantity: 1, Price: money.MustParse("8000", "IDR")}})
+	service.Transition(ctx, "order-1", Paid)
+
+	body := testkit.Do(t, app, "GET", "/web/feed.xml", nil).AssertStatus(200).String()
+	assert.Contains(t, body, `<updated>2024-05-01T09:00:00Z</updated>`)
+	// Newest first.
+	assert.Regexp(t, `<entry><id>https://shop.example/api/orders/order-2</id><title>Order order-2 is created</title>.*`+
+		`<entry><id>https://shop.example/api/orders/order-1</id><title>Order order-1 is paid</title>`, body)
+	assert.Contains(t, body, `<summary>2 items for Rp 30.000 by alice</summary>`)
+}
+
+func TestHandlers(t *testing.T) {
+	service := newService(t, events.NewBus())
+	app := fiber.New()
+	app.Use(testkit.FakeAuth)
+	staff := func(c *fiber.Ctx) error {
+		if c.Get(testkit.HeaderUser) != "staff" {
+			return fiber.ErrForbidden
+		}
+		return c.Next()
+	}
+	service.Register(app, staff)
+
+	do := func(user, method, path, body string) (int, Order) {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set(testkit.HeaderUser, user)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := app.Test(request)
+		assert.Nil(t, err)
+		data, _ := io.ReadAll(response.Body)
+		var order Order
+		json.Unmarshal(data, &order)
+		return response.StatusCode, order
+	}
+
+	status, order := do("alice", "POST", "/orders", `{"items":[{"sku":"teh","quantity":1,"price":8000}]}`)
+	assert.Equal(t, 201, status)
+	status, _ = do("alice", "POST", "/orders", `{"items":[{"sku":"teh","quantity":0,"price":8000}]}`)
+	assert.Equal(t, 422, status)
+	for _, body := range []string{
+		`{"items":[{"sku":"teh","quantity":1,"price":0.10}],"currency":"XXX"}`,
+		`{"items":[{"sku":"teh","quantity":1,"price":0.105}],"currency":"USD"}`,
+		`{"items":[{"sku":"teh","quantity":1}],"currency":"USD"}`,
+	} {
+		status, _ = do("alice", "POST", "/orders", body)
+		assert.Equal(t, 422, status, body)
+	}
+	status, dollars := do("alice", "POST", "/orders", `{"items":[{"sku":"teh","quantity":3,"price":0.1},{"sku":"kopi","quantity":1,"price":"2.25"}],"currency":"USD"}`)
+	assert.Equal(t, 201, status)
+	assert.Equal(t, money.MustParse("2.55", "USD"), dollars.Amount)
+	assert.Equal(t, money.MustParse("0.10", "USD"), dollars.Items[0].Price)
+
+	status, _ = do("bob", "GET", "/orders/"+order.ID, "")
+	assert.Equal(t, 404, status)
+	status, _ = do("bob", "POST", "/orders/"+order.ID+"/cancel", "")
+	assert.Equal(t, 404, status)
+
+	status, _ = do("alice", "PUT", "/orders/"+order.ID+"/status", `{"status":"shipped"}`)
+	assert.Equal(t, 403, status)
+	status, _ = do("staff", "PUT", "/orders/"+order.ID+"/status", `{"status":"shipped"}`)
+	assert.Equal(t, 409, status)
+	status, _ = do("staff", "PUT", "/orders/"+order.ID+"/status", `{"status":"lost"}`)
+	assert.Equal(t, 400, status)
+
+	status, order = do("alice", "POST", "/orders/"+order.ID+"/cancel", "")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, Cancelled, order.Status)
+	status, _ = do("alice", "POST", "/orders/"+order.ID+"/cancel", "")
+	assert.Equal(t, 409, status)
+}
+
+func TestCachedRepository(t *testing.T) {
+	server := miniredis.RunT(t)
+	ids, _ := sequence.NewSnowflake(1)
+	repo := NewCachedRepository(NewMemoryRepository(), cache.NewRedis(redis.NewClient(&redis.Options{Addr: server.Addr()})), time.Minute, metrics.NewRegistry())
+	service := NewService(repo, events.NewBus(), ids)
+	ctx := context.Background()
+
+	order, err := service.Create(ctx, "alice", []Item{{SKU: "kopi", Quantity: 1, Price: money.MustParse("1", "IDR")}})
+	assert.Nil(t, err)
+	cached, err := service.Get(ctx, order.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, order.Items, cached.Items)
+	assert.True(t, server.Exists("orders:"+order.ID))
+
+	// Changes aren't hidden by the cached copy.
+	_, err = service.Transition(ctx, order.ID, Paid)
+	assert.Nil(t, err)
+	assert.False(t, server.Exists("orders:"+order.ID))
+	cached, _ = service.Get(ctx, order.ID)
+	assert.Equal(t, Paid, cached.Status)
+	assert.NotEmpty(t, cached.InvoiceNumber)
+
+	_, err = service.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Warming up skips orders that don't exist.
+	server.FlushAll()
+	assert.Nil(t, repo.Warm(ctx, []string{"missing", order.ID}))
+	assert.True(t, server.Exists("orders:"+order.ID))
+}
+
+// slowRepository times out on lookups, as a saturated database does.
+type slowRepository struct {
+	*MemoryRepository
+	lookups int
+}
+
+func (r *slowRepository) Get(ctx context.Context, id string) (Order, error) {
+	r.lookups++
+	return Order{}, context.DeadlineExceeded
+}
+
+func TestBreakerRepository(t *testing.T) {
+	slow := &slowRepository{MemoryRepository: NewMemoryRepository()}
+	breaker := database.NewBreaker(config.DatabaseConfig{BreakerThreshold: 2, BreakerCooldown: time.Minute}, slog.New(slog.NewTextHandler(io.Discard, nil)), metrics.NewRegistry())
+	ids, _ := sequence.NewSnowflake(1)
+	service := NewService(NewBreakerRepository(slow, breaker), events.NewBus(), ids)
+	ctx := context.Background()
+
+	// Orders not found don't count as failures of the database.
+	_, err := service.Create(ctx, "alice", []Item{{SKU: "kopi", Quantity: 1, Price: money.MustParse("1", "IDR")}})
+	assert.Nil(t, err)
+	_, err = service.Transition(ctx, "missing", Paid)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	for i := 0; i < 2; i++ {
+		_, err = service.Get(ctx, "any")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+	_, err = service.Get(ctx, "any")
+	assert.ErrorIs(t, err, database.ErrUnavailable)
+	assert.Equal(t, 2, slow.lookups)
+	_, err = service.List(ctx, "alice")
+	assert.ErrorIs(t, err, database.ErrUnavailable)
+}
+
+// With an outbox, events are published once their change is committed and
+// not at all for changes rolled back.
+func TestServiceWithOutbox(t *testing.T) {
+	db := openTestDB(t)
+	assert.Nil(t, db.Migrate(context.Background(), outbox.Migrations...))
+	bus := events.NewBus()
+	var published []string
+	bus.Subscribe("*", func(ctx context.Context, event events.Event) {
+		published = append(published, event.Type)
+	})
+	relay := outbox.New(db, bus, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ids, _ := sequence.NewSnowflake(1)
+	service := NewService(NewSQLRepository(db), bus, ids)
+	service.UseOutbox(database.NewUnitOfWork(db.DB), relay)
+	ctx := context.Background()
+
+	order, err := service.Create(ctx, "alice", []Item{{SKU: "kopi", Quantity: 1, Price: money.MustParse("1", "IDR")}})
+	assert.Nil(t, err)
+	failed := errors.New("failed")
+	err = database.InTx(ctx, db.DB, func(ctx context.Context) error {
+		_, err := service.Transition(ctx, order.ID, Paid)
+		assert.Nil(t, err)
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	assert.Empty(t, published)
+
+	relay.Relay(ctx)
+	assert.Equal(t, []string{"order.created"}, published)
+	order, _ = service.Get(ctx, order.ID)
+	assert.Equal(t, Created, order.Status)
+}
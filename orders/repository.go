@@ -0,0 +1,116 @@
+package orders
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/sequence"
+)
+
+// Repository stores orders. Update changes an order atomically: change
+// sees the current order and its result, all but its ID and creation
+// time, is stored unless it returns an error. Create and Update return a
+// *database.ConflictError for an ID or invoice number another order has.
+//
+// NextNumber returns the next gap-free number of a series, such as the
+// invoices of a year. Called by a change of Update with the context it
+// was given, it belongs to that update, so a database implementation
+// takes it in the same transaction and a rollback gives the number back.
+type Repository interface {
+	Create(ctx context.Context, order Order) error
+	Get(ctx context.Context, id string) (Order, error)
+	ListByUser(ctx context.Context, userID string) ([]Order, error)
+	ListRecent(ctx context.Context, limit int) ([]Order, error)
+	Update(ctx context.Context, id string, change func(ctx context.Context, order *Order) error) (Order, error)
+	NextNumber(ctx context.Context, series string) (int64, error)
+}
+
+// MemoryRepository keeps orders in memory.
+type MemoryRepository struct {
+	numbers *sequence.Counter
+
+	mu     sync.Mutex
+	orders map[string]Order
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{numbers: sequence.NewCounter(), orders: map[string]Order{}}
+}
+
+func (r *MemoryRepository) Create(ctx context.Context, order Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.orders[order.ID]; ok {
+		return &database.ConflictError{Table: "orders", Field: "id"}
+	}
+	r.orders[order.ID] = order.copy()
+	return nil
+}
+
+func (r *MemoryRepository) Get(ctx context.Context, id string) (Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[id]
+	if !ok {
+		return Order{}, ErrNotFound
+	}
+	return order.copy(), nil
+}
+
+// ListByUser returns the orders of a user, newest first.
+func (r *MemoryRepository) ListByUser(ctx context.Context, userID string) ([]Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := []Order{}
+	for _, order := range r.orders {
+		if order.UserID == userID {
+			list = append(list, order.copy())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, nil
+}
+
+// ListRecent returns the limit newest orders of all users, newest first.
+func (r *MemoryRepository) ListRecent(ctx context.Context, limit int) ([]Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]Order, 0, len(r.orders))
+	for _, order := range r.orders {
+		list = append(list, order.copy())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		}
+		return list[i].ID > list[j].ID
+	})
+	return list[:min(limit, len(list))], nil
+}
+
+func (r *MemoryRepository) Update(ctx context.Context, id string, change func(ctx context.Context, order *Order) error) (Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[id]
+	if !ok {
+		return Order{}, ErrNotFound
+	}
+	order = order.copy()
+	if err := change(ctx, &order); err != nil {
+		return Order{}, err
+	}
+	r.orders[id] = order
+	return order.copy(), nil
+}
+
+// NextNumber doesn't take the lock of Update, so changes can call it.
+func (r *MemoryRepository) NextNumber(ctx context.Context, series string) (int64, error) {
+	return r.numbers.Next(series), nil
+}
+
+func (o Order) copy() Order {
+	o.Items = append([]Item(nil), o.Items...)
+	return o
+}
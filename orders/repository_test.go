@@ -0,0 +1,286 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/money"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// instrumentation runs the repository tests through the instrumented
+// driver, as the app does.
+var instrumentation = database.NewInstrumentation(slog.New(slog.NewTextHandler(io.Discard, nil)), metrics.NewRegistry(), time.Second)
+
+// openTestDB opens an in-memory SQLite database, or the PostgreSQL
+// database at TEST_DATABASE_URL when it is set.
+func openTestDB(t *testing.T) *database.DB {
+	db, err := database.Open(config.DatabaseConfig{DSN: os.Getenv("TEST_DATABASE_URL"), SQLitePath: ":memory:", MaxOpenConns: 10}, instrumentation)
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+	assert.Nil(t, db.Migrate(context.Background(), Migrations...))
+	return db
+}
+
+// openTestGorm opens an in-memory SQLite database through GORM, or the
+// database at TEST_GORM_DATABASE_URL (postgres:// or mysql://) when it
+// is set.
+func openTestGorm(t *testing.T) *gorm.DB {
+	db, err := database.OpenGorm(config.DatabaseConfig{DSN: os.Getenv("TEST_GORM_DATABASE_URL"), SQLitePath: ":memory:", MaxOpenConns: 10}, instrumentation)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		if pool, err := db.DB(); err == nil {
+			pool.Close()
+		}
+	})
+	assert.Nil(t, AutoMigrate(db))
+	return db
+}
+
+// repositories are the implementations the shared tests run against.
+var repositories = map[string]func(t *testing.T) Repository{
+	"memory": func(t *testing.T) Repository { return NewMemoryRepository() },
+	"sql":    func(t *testing.T) Repository { return NewSQLRepository(openTestDB(t)) },
+	"gorm":   func(t *testing.T) Repository { return NewGormRepository(openTestGorm(t)) },
+}
+
+func TestRepositories(t *testing.T) {
+	for name, newRepo := range repositories {
+		newRepo := newRepo
+		t.Run(name, func(t *testing.T) {
+			testRepository(t, newRepo(t))
+		})
+	}
+}
+
+func testRepository(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	// Unique per run, for databases that outlive it.
+	run := strconv.FormatInt(time.Now().UnixNano(), 36)
+	user := "alice-" + run
+	start := time.Now().UTC().Truncate(time.Millisecond)
+
+	var created []Order
+	for i := 0; i < 3; i++ {
+		order := Order{
+			ID:        run + "-" + strconv.Itoa(i),
+			UserID:    user,
+			Status:    Created,
+			Items:     []Item{{SKU: "kopi", Quantity: i + 1, Price: money.MustParse("15000", "IDR")}, {SKU: "teh", Quantity: 1, Price: money.MustParse("8000", "IDR")}},
+			Amount:    money.MustParse(strconv.Itoa((i+1)*15000+8000), "IDR"),
+			CreatedAt: start.Add(time.Duration(i) * time.Second),
+			UpdatedAt: start.Add(time.Duration(i) * time.Second),
+		}
+		assert.Nil(t, repo.Create(ctx, order))
+		created = append(created, order)
+	}
+	assert.Nil(t, repo.Create(ctx, Order{ID: run + "-bob", UserID: "bob-" + run, Status: Created, Items: []Item{{SKU: "teh", Quantity: 1, Price: money.MustParse("0.10", "IDR")}}, Amount: money.MustParse("0.10", "IDR"), CreatedAt: start, UpdatedAt: start}))
+
+	// A taken ID is a conflict rather than a driver error.
+	err := repo.Create(ctx, created[0])
+	assert.ErrorIs(t, err, database.ErrConflict)
+	var conflict *database.ConflictError
+	if assert.True(t, errors.As(err, &conflict)) {
+		assert.Equal(t, "id", conflict.Field)
+	}
+
+	got, err := repo.Get(ctx, created[1].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, created[1].Items, got.Items)
+	assert.Equal(t, created[1].Amount, got.Amount)
+	assert.True(t, created[1].CreatedAt.Equal(got.CreatedAt), "created at %s, got %s", created[1].CreatedAt, got.CreatedAt)
+	_, err = repo.Get(ctx, "missing-"+run)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	list, err := repo.ListByUser(ctx, user)
+	assert.Nil(t, err)
+	var ids []string
+	for _, order := range list {
+		ids = append(ids, order.ID)
+	}
+	assert.Equal(t, []string{created[2].ID, created[1].ID, created[0].ID}, ids)
+	assert.Equal(t, created[0].Items, list[2].Items)
+	list, err = repo.ListByUser(ctx, "nobody-"+run)
+	assert.Nil(t, err)
+	assert.NotNil(t, list)
+	assert.Empty(t, list)
+
+	// Orders of earlier runs are older.
+	list, err = repo.ListRecent(ctx, 2)
+	assert.Nil(t, err)
+	if assert.Len(t, list, 2) {
+		assert.Equal(t, created[2].ID, list[0].ID)
+		assert.Equal(t, created[1].ID, list[1].ID)
+		assert.Equal(t, created[1].Items, list[1].Items)
+	}
+
+	series := "invoice-" + run
+	updated, err := repo.Update(ctx, created[0].ID, func(ctx context.Context, order *Order) error {
+		n, err := repo.NextNumber(ctx, series)
+		order.Status = Paid
+		order.InvoiceNumber = "INV-" + strconv.FormatInt(n, 10)
+		order.Items = order.Items[:1]
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "INV-1", updated.InvoiceNumber)
+	got, _ = repo.Get(ctx, created[0].ID)
+	assert.Equal(t, Paid, got.Status)
+	assert.Equal(t, "INV-1", got.InvoiceNumber)
+	assert.Len(t, got.Items, 1)
+
+	failed := errors.New("failed")
+	_, err = repo.Update(ctx, created[1].ID, func(ctx context.Context, order *Order) error {
+		order.Status = Cancelled
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	got, _ = repo.Get(ctx, created[1].ID)
+	assert.Equal(t, Created, got.Status)
+	_, err = repo.Update(ctx, "missing-"+run, func(ctx context.Context, order *Order) error { return nil })
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	n, _ := repo.NextNumber(ctx, series)
+	other, _ := repo.NextNumber(ctx, series+"-other")
+	assert.Equal(t, int64(1), other)
+	if _, ok := repo.(*MemoryRepository); !ok {
+		// In a database a rolled back update gives its number back.
+		repo.Update(ctx, created[2].ID, func(ctx context.Context, order *Order) error {
+			repo.NextNumber(ctx, series)
+			return failed
+		})
+		next, _ := repo.NextNumber(ctx, series)
+		assert.Equal(t, n+1, next)
+	}
+
+	anonymized, err := Anonymize(ctx, repo, user, "deleted-"+run)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, anonymized)
+	list, _ = repo.ListByUser(ctx, user)
+	assert.Empty(t, list)
+	list, _ = repo.ListByUser(ctx, "deleted-"+run)
+	assert.Len(t, list, 3)
+	got, _ = repo.Get(ctx, created[0].ID)
+	assert.Equal(t, "deleted-"+run, got.UserID)
+	assert.Equal(t, "INV-1", got.InvoiceNumber)
+}
+
+// Database repositories take part in the transaction of the context, as
+// opened by database.Middleware.
+func TestRepositoriesJoinTransactions(t *testing.T) {
+	db := openTestDB(t)
+	gormDB := openTestGorm(t)
+	gormPool, _ := gormDB.DB()
+	repositories := map[string]struct {
+		repo Repository
+		pool *sql.DB
+	}{
+		"sql":  {NewSQLRepository(db), db.DB},
+		"gorm": {NewGormRepository(gormDB), gormPool},
+	}
+	for name, test := range repositories {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			order := Order{ID: "tx-" + strconv.FormatInt(time.Now().UnixNano(), 36), UserID: "alice", Status: Created, Items: []Item{{SKU: "kopi", Quantity: 1, Price: money.MustParse("1", "IDR")}}, Amount: money.MustParse("1", "IDR")}
+			failed := errors.New("failed")
+			err := database.InTx(ctx, test.pool, func(ctx context.Context) error {
+				assert.Nil(t, test.repo.Create(ctx, order))
+				_, err := test.repo.Update(ctx, order.ID, func(ctx context.Context, order *Order) error {
+					order.Status = Paid
+					return nil
+				})
+				assert.Nil(t, err)
+				got, err := test.repo.Get(ctx, order.ID)
+				assert.Nil(t, err)
+				assert.Equal(t, Paid, got.Status)
+				return failed
+			})
+			assert.ErrorIs(t, err, failed)
+			_, err = test.repo.Get(ctx, order.ID)
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+// The GORM models of before the amounts moved to minor units.
+type majorUnitsOrder struct {
+	ID            string  `gorm:"primaryKey;size:64"`
+	UserID        string  `gorm:"size:64;not null;index:orders_user_id,priority:1"`
+	Status        string  `gorm:"size:16;not null"`
+	Amount        float64 `gorm:"not null"`
+	Currency      string  `gorm:"size:3;not null"`
+	InvoiceNumber string  `gorm:"size:32;not null;default:''"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (majorUnitsOrder) TableName() string { return "orders" }
+
+type majorUnitsItem struct {
+	OrderID  string  `gorm:"primaryKey;size:64"`
+	Position int     `gorm:"primaryKey;autoIncrement:false"`
+	SKU      string  `gorm:"size:64;not null"`
+	Quantity int     `gorm:"not null"`
+	Price    float64 `gorm:"not null"`
+}
+
+func (majorUnitsItem) TableName() string { return "order_items" }
+
+func TestAmountsMoveToMinorUnits(t *testing.T) {
+	// Orders stored in major units, in tables created beforehand.
+	stored := func(t *testing.T, db *sql.DB) {
+		ctx := context.Background()
+		now := time.Now().UTC()
+		for _, row := range [][]any{{"1", 30001.5, "IDR"}, {"2", 1500.0, "JPY"}} {
+			_, err := db.ExecContext(ctx, `INSERT INTO orders (id, user_id, status, amount, currency, created_at, updated_at) VALUES (?, 'alice', 'created', ?, ?, ?, ?)`, row[0], row[1], row[2], now, now)
+			assert.Nil(t, err)
+		}
+		_, err := db.ExecContext(ctx, `INSERT INTO order_items (order_id, position, sku, quantity, price) VALUES ('1', 0, 'kopi', 2, 15000.75), ('2', 0, 'ocha', 1, 1500)`)
+		assert.Nil(t, err)
+	}
+	check := func(t *testing.T, repo Repository) {
+		order, err := repo.Get(context.Background(), "1")
+		if assert.Nil(t, err) {
+			assert.Equal(t, money.MustParse("30001.50", "IDR"), order.Amount)
+			assert.Equal(t, []Item{{SKU: "kopi", Quantity: 2, Price: money.MustParse("15000.75", "IDR")}}, order.Items)
+		}
+		order, err = repo.Get(context.Background(), "2")
+		if assert.Nil(t, err) {
+			assert.Equal(t, money.MustParse("1500", "JPY"), order.Amount)
+			assert.Equal(t, money.MustParse("1500", "JPY"), order.Items[0].Price)
+		}
+	}
+
+	t.Run("sql", func(t *testing.T) {
+		db, err := database.Open(config.DatabaseConfig{SQLitePath: ":memory:"}, instrumentation)
+		assert.Nil(t, err)
+		t.Cleanup(func() { db.Close() })
+		assert.Nil(t, db.Migrate(context.Background(), Migrations[0]))
+		stored(t, db.DB)
+		assert.Nil(t, db.Migrate(context.Background(), Migrations...))
+		check(t, NewSQLRepository(db))
+	})
+	t.Run("gorm", func(t *testing.T) {
+		db, err := database.OpenGorm(config.DatabaseConfig{SQLitePath: ":memory:"}, instrumentation)
+		assert.Nil(t, err)
+		pool, err := db.DB()
+		assert.Nil(t, err)
+		t.Cleanup(func() { pool.Close() })
+		assert.Nil(t, db.AutoMigrate(&majorUnitsOrder{}, &majorUnitsItem{}))
+		stored(t, pool)
+		assert.Nil(t, AutoMigrate(db))
+		check(t, NewGormRepository(db))
+	})
+}
@@ -0,0 +1,183 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/money"
+	"github.com/jalal-akbar/belajar-golang-fiber/sequence"
+)
+
+// defaultCurrency prices orders created without a currency.
+const defaultCurrency = "IDR"
+
+var ErrInvalid = errors.New("orders: invalid order")
+
+// Service creates orders and moves them through their lifecycle. Every
+// change publishes an "order.<status>" event once it is stored.
+type Service struct {
+	repo   Repository
+	bus    *events.Bus
+	ids    sequence.IDGenerator
+	now    func() time.Time
+	uow    database.UnitOfWork
+	outbox Outbox
+}
+
+// Outbox stores events in the transaction of their context, to publish
+// them once it is committed.
+type Outbox interface {
+	Add(ctx context.Context, event events.Event) error
+}
+
+func NewService(repo Repository, bus *events.Bus, ids sequence.IDGenerator) *Service {
+	return &Service{repo: repo, bus: bus, ids: ids, now: clock.System.Now}
+}
+
+// UseClock makes the service stamp orders with the time of c.
+func (s *Service) UseClock(c clock.Clock) {
+	s.now = c.Now
+}
+
+// UseOutbox makes every change a unit of work with its event, which goes
+// through outbox instead of straight to the bus: it is published if and
+// only if the change is committed.
+func (s *Service) UseOutbox(uow database.UnitOfWork, outbox Outbox) {
+	s.uow = uow
+	s.outbox = outbox
+}
+
+// Create orders items, which must all be priced in one currency.
+func (s *Service) Create(ctx context.Context, userID string, items []Item) (Order, error) {
+	if len(items) == 0 {
+		return Order{}, fmt.Errorf("%w: no items", ErrInvalid)
+	}
+	currency := items[0].Price.Currency()
+	amount, err := money.New(0, currency)
+	if err != nil {
+		return Order{}, fmt.Errorf("%w: unknown currency %q", ErrInvalid, currency)
+	}
+	for _, item := range items {
+		if item.SKU == "" || item.Quantity <= 0 || item.Price.IsNegative() {
+			return Order{}, fmt.Errorf("%w: items need a sku, a positive quantity and a price", ErrInvalid)
+		}
+		if item.Price.Currency() != currency {
+			return Order{}, fmt.Errorf("%w: items must be priced in one currency", ErrInvalid)
+		}
+		total, err := item.Price.Mul(int64(item.Quantity))
+		if err == nil {
+			amount, err = amount.Add(total)
+		}
+		if err != nil {
+			return Order{}, fmt.Errorf("%w: amount too large", ErrInvalid)
+		}
+	}
+
+	id, err := s.ids.NewID()
+	if err != nil {
+		return Order{}, err
+	}
+	now := s.now()
+	order := Order{
+		ID:        id,
+		UserID:    userID,
+		Status:    Created,
+		Items:     items,
+		Amount:    amount,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = s.atomically(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, order); err != nil {
+			return err
+		}
+		return s.publish(ctx, order, "")
+	})
+	if err != nil {
+		return Order{}, err
+	}
+	return order, nil
+}
+
+func (s *Service) Get(ctx context.Context, id string) (Order, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *Service) List(ctx context.Context, userID string) ([]Order, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+// Recent returns the limit newest orders of all users.
+func (s *Service) Recent(ctx context.Context, limit int) ([]Order, error) {
+	return s.repo.ListRecent(ctx, limit)
+}
+
+// Transition moves an order to status to, or returns a *TransitionError if
+// its lifecycle doesn't allow that from where it is.
+func (s *Service) Transition(ctx context.Context, id string, to Status) (Order, error) {
+	var from Status
+	var order Order
+	err := s.atomically(ctx, func(ctx context.Context) error {
+		var err error
+		order, err = s.repo.Update(ctx, id, func(ctx context.Context, order *Order) error {
+			from = order.Status
+			if !CanTransition(from, to) {
+				return &TransitionError{From: from, To: to}
+			}
+			order.Status = to
+			order.UpdatedAt = s.now()
+			if to == Paid {
+				// Last, so no error can drop the number.
+				year := order.UpdatedAt.UTC().Year()
+				n, err := s.repo.NextNumber(ctx, fmt.Sprintf("invoice-%d", year))
+				if err != nil {
+					return err
+				}
+				order.InvoiceNumber = fmt.Sprintf("INV-%d-%06d", year, n)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return s.publish(ctx, order, from)
+	})
+	if err != nil {
+		return Order{}, err
+	}
+	return order, nil
+}
+
+// atomically runs fn as a unit of work, if the service has one.
+func (s *Service) atomically(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.uow == nil {
+		return fn(ctx)
+	}
+	return s.uow.Do(ctx, fn)
+}
+
+// publish adds the event of a change to the outbox or, without one,
+// publishes it right away.
+func (s *Service) publish(ctx context.Context, order Order, from Status) error {
+	data := map[string]string{"to": string(order.Status)}
+	if from != "" {
+		data["from"] = string(from)
+	}
+	event := events.Event{
+		Type:    "order." + string(order.Status),
+		UserID:  order.UserID,
+		Subject: order.ID,
+		Data:    data,
+		Time:    order.UpdatedAt,
+	}
+	if s.outbox != nil {
+		return s.outbox.Add(ctx, event)
+	}
+	s.bus.Publish(ctx, event)
+	return nil
+}
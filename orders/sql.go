@@ -0,0 +1,259 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/money"
+)
+
+// Migrations create the tables of SQLRepository.
+var Migrations = []database.Migration{{
+	ID: "orders-0001",
+	Statements: []string{
+		`CREATE TABLE orders (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	status TEXT NOT NULL,
+	amount DOUBLE PRECISION NOT NULL,
+	currency TEXT NOT NULL,
+	invoice_number TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+)`,
+		`CREATE INDEX orders_user_id ON orders (user_id, created_at)`,
+		`CREATE UNIQUE INDEX orders_invoice_number ON orders (invoice_number) WHERE invoice_number <> ''`,
+		`CREATE TABLE order_items (
+	order_id TEXT NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	sku TEXT NOT NULL,
+	quantity INTEGER NOT NULL,
+	price DOUBLE PRECISION NOT NULL,
+	PRIMARY KEY (order_id, position)
+)`,
+		`CREATE TABLE sequences (
+	series TEXT PRIMARY KEY,
+	value BIGINT NOT NULL
+)`,
+	},
+}, {
+	ID: "orders-0002",
+	Statements: append(append([]string{
+		`ALTER TABLE orders ADD COLUMN amount_minor BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE order_items ADD COLUMN price_minor BIGINT NOT NULL DEFAULT 0`,
+	}, toMinorUnits...),
+		`ALTER TABLE orders DROP COLUMN amount`,
+		`ALTER TABLE order_items DROP COLUMN price`,
+		`ALTER TABLE orders RENAME COLUMN amount_minor TO amount`,
+		`ALTER TABLE order_items RENAME COLUMN price_minor TO price`,
+	),
+}}
+
+// toMinorUnits fill amount_minor and price_minor with the amounts and
+// prices once stored in major units as DOUBLE PRECISION. The exponents
+// are those of the currencies money knew when amounts moved to minor
+// units.
+var toMinorUnits = []string{
+	`UPDATE orders SET amount_minor = ROUND(amount * CASE currency WHEN 'JPY' THEN 1 WHEN 'KWD' THEN 1000 ELSE 100 END)`,
+	`UPDATE order_items SET price_minor = ROUND(price * (SELECT CASE currency WHEN 'JPY' THEN 1 WHEN 'KWD' THEN 1000 ELSE 100 END FROM orders WHERE orders.id = order_items.order_id))`,
+}
+
+const orderColumns = "id, user_id, status, amount, currency, invoice_number, created_at, updated_at"
+
+// SQLRepository keeps orders in an SQL database. Times are stored in UTC;
+// amounts in BIGINT minor units of the order's currency.
+// Lookups outside a transaction may be served by a replica.
+type SQLRepository struct {
+	db *database.DB
+}
+
+func NewSQLRepository(db *database.DB) *SQLRepository {
+	return &SQLRepository{db: db}
+}
+
+func (r *SQLRepository) Create(ctx context.Context, order Order) error {
+	return database.Conflict(r.db.InTx(ctx, func(ctx context.Context) error {
+		_, err := r.db.Conn(ctx).ExecContext(ctx, r.db.Rebind(`INSERT INTO orders (`+orderColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+			order.ID, order.UserID, order.Status, order.Amount.Minor(), order.Amount.Currency(), order.InvoiceNumber,
+			order.CreatedAt.UTC(), order.UpdatedAt.UTC())
+		if err != nil {
+			return err
+		}
+		return r.insertItems(ctx, order)
+	}))
+}
+
+func (r *SQLRepository) Get(ctx context.Context, id string) (Order, error) {
+	return r.get(ctx, r.db.Reader(ctx), id, "")
+}
+
+func (r *SQLRepository) get(ctx context.Context, conn database.Querier, id, lock string) (Order, error) {
+	row := conn.QueryRowContext(ctx, r.db.Rebind(`SELECT `+orderColumns+` FROM orders WHERE id = ?`+lock), id)
+	order, err := scanOrder(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Order{}, ErrNotFound
+	}
+	if err != nil {
+		return Order{}, err
+	}
+	items, err := r.items(ctx, conn, "order_id = ?", id)
+	if err != nil {
+		return Order{}, err
+	}
+	order.Items = items[id]
+	return order, nil
+}
+
+// ListByUser returns the orders of a user, newest first.
+func (r *SQLRepository) ListByUser(ctx context.Context, userID string) ([]Order, error) {
+	conn := r.db.Reader(ctx)
+	rows, err := conn.QueryContext(ctx, r.db.Rebind(`SELECT `+orderColumns+` FROM orders WHERE user_id = ? ORDER BY created_at DESC, id DESC`), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Order{}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	items, err := r.items(ctx, conn, "order_id IN (SELECT id FROM orders WHERE user_id = ?)", userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].Items = items[list[i].ID]
+	}
+	return list, nil
+}
+
+func (r *SQLRepository) Update(ctx context.Context, id string, change func(ctx context.Context, order *Order) error) (Order, error) {
+	var order Order
+	err := r.db.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		order, err = r.get(ctx, r.db.Conn(ctx), id, r.db.ForUpdate())
+		if err != nil {
+			return err
+		}
+		if err := change(ctx, &order); err != nil {
+			return err
+		}
+		conn := r.db.Conn(ctx)
+		_, err = conn.ExecContext(ctx, r.db.Rebind(`UPDATE orders SET user_id = ?, status = ?, amount = ?, currency = ?, invoice_number = ?, updated_at = ? WHERE id = ?`),
+			order.UserID, order.Status, order.Amount.Minor(), order.Amount.Currency(), order.InvoiceNumber, order.UpdatedAt.UTC(), id)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, r.db.Rebind(`DELETE FROM order_items WHERE order_id = ?`), id); err != nil {
+			return err
+		}
+		return r.insertItems(ctx, order)
+	})
+	if err != nil {
+		return Order{}, database.Conflict(err)
+	}
+	return order, nil
+}
+
+// NextNumber counts in the transaction of ctx, which keeps the series
+// locked until it ends.
+func (r *SQLRepository) NextNumber(ctx context.Context, series string) (int64, error) {
+	var n int64
+	err := r.db.Conn(ctx).QueryRowContext(ctx, r.db.Rebind(`INSERT INTO sequences (series, value) VALUES (?, 1)
+ON CONFLICT (series) DO UPDATE SET value = sequences.value + 1
+RETURNING value`), series).Scan(&n)
+	return n, err
+}
+
+// ListRecent returns the limit newest orders of all users, newest first.
+func (r *SQLRepository) ListRecent(ctx context.Context, limit int) ([]Order, error) {
+	conn := r.db.Reader(ctx)
+	rows, err := conn.QueryContext(ctx, r.db.Rebind(`SELECT `+orderColumns+` FROM orders ORDER BY created_at DESC, id DESC LIMIT ?`), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Order{}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return list, nil
+	}
+	ids := make([]any, len(list))
+	for i, order := range list {
+		ids[i] = order.ID
+	}
+	items, err := r.items(ctx, conn, "order_id IN (?"+strings.Repeat(", ?", len(ids)-1)+")", ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].Items = items[list[i].ID]
+	}
+	return list, nil
+}
+
+func (r *SQLRepository) insertItems(ctx context.Context, order Order) error {
+	for i, item := range order.Items {
+		_, err := r.db.Conn(ctx).ExecContext(ctx, r.db.Rebind(`INSERT INTO order_items (order_id, position, sku, quantity, price) VALUES (?, ?, ?, ?, ?)`),
+			order.ID, i, item.SKU, item.Quantity, item.Price.Minor())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// items returns the items of the orders matching where, by order ID.
+func (r *SQLRepository) items(ctx context.Context, conn database.Querier, where string, args ...any) (map[string][]Item, error) {
+	rows, err := conn.QueryContext(ctx, r.db.Rebind(`SELECT order_id, sku, quantity, price, currency FROM order_items JOIN orders ON orders.id = order_id WHERE `+where+` ORDER BY order_id, position`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := map[string][]Item{}
+	for rows.Next() {
+		var orderID, currency string
+		var item Item
+		var price int64
+		if err := rows.Scan(&orderID, &item.SKU, &item.Quantity, &price, &currency); err != nil {
+			return nil, err
+		}
+		if item.Price, err = money.New(price, currency); err != nil {
+			return nil, err
+		}
+		items[orderID] = append(items[orderID], item)
+	}
+	return items, rows.Err()
+}
+
+func scanOrder(row interface{ Scan(...any) error }) (Order, error) {
+	var order Order
+	var amount int64
+	var currency string
+	err := row.Scan(&order.ID, &order.UserID, &order.Status, &amount, &currency, &order.InvoiceNumber, &order.CreatedAt, &order.UpdatedAt)
+	if err != nil {
+		return Order{}, err
+	}
+	order.Amount, err = money.New(amount, currency)
+	order.CreatedAt = order.CreatedAt.UTC()
+	order.UpdatedAt = order.UpdatedAt.UTC()
+	return order, err
+}
@@ -0,0 +1,207 @@
+// Package outbox publishes events only once the changes they report are
+// committed: events are stored in the transaction of the change and
+// relayed to the bus from there.
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+)
+
+// Migrations create the outbox table.
+var Migrations = []database.Migration{{
+	ID: "outbox-0001",
+	Statements: []string{`CREATE TABLE outbox (
+	id VARCHAR(64) PRIMARY KEY,
+	type VARCHAR(64) NOT NULL,
+	user_id VARCHAR(64) NOT NULL,
+	subject VARCHAR(64) NOT NULL,
+	data TEXT NOT NULL,
+	occurred_at TIMESTAMP NOT NULL
+)`},
+}}
+
+const batchSize = 100
+
+// Outbox stores events in the database and relays them to a bus. Events
+// are delivered at least once: the relay removes them in the transaction
+// it publishes them in, which handlers take part in through their
+// context, and an event whose relay fails is published again later.
+type Outbox struct {
+	db       *database.DB
+	bus      *events.Bus
+	logger   *slog.Logger
+	interval time.Duration
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func New(db *database.DB, bus *events.Bus, logger *slog.Logger) *Outbox {
+	return &Outbox{
+		db:       db,
+		bus:      bus,
+		logger:   logger,
+		interval: 5 * time.Second,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Add stores event in the transaction of ctx. The relay picks it up as
+// soon as that is committed.
+func (o *Outbox) Add(ctx context.Context, event events.Event) error {
+	if event.Time.IsZero() {
+		event.Time = clock.System.Now()
+	}
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	id, err := newID(event.Time)
+	if err != nil {
+		return err
+	}
+	_, err = o.db.Conn(ctx).ExecContext(ctx, o.db.Rebind(`INSERT INTO outbox (id, type, user_id, subject, data, occurred_at) VALUES (?, ?, ?, ?, ?, ?)`),
+		id, event.Type, event.UserID, event.Subject, string(data), event.Time.UTC())
+	if err != nil {
+		return err
+	}
+	database.AfterCommit(ctx, o.notify)
+	return nil
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start relays events in the background until Stop: right after they are
+// committed and, to catch up after failures, every few seconds.
+func (o *Outbox) Start() {
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		ticker := time.NewTicker(o.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-o.stop:
+				return
+			case <-o.wake:
+			case <-ticker.C:
+			}
+			for {
+				n, err := o.Relay(context.Background())
+				if err != nil {
+					o.logger.Error("outbox relay failed", "error", err)
+				}
+				if err != nil || n < batchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+func (o *Outbox) Stop() {
+	close(o.stop)
+	o.wg.Wait()
+}
+
+// Relay publishes a batch of stored events, oldest first, and returns how
+// many it published.
+func (o *Outbox) Relay(ctx context.Context) (int, error) {
+	// Instances relaying at the same time skip each other's events.
+	lock := ""
+	if o.db.Dialect == database.Postgres {
+		lock = " FOR UPDATE SKIP LOCKED"
+	}
+	published := 0
+	err := o.db.InTx(ctx, func(ctx context.Context) error {
+		conn := o.db.Conn(ctx)
+		rows, err := conn.QueryContext(ctx, o.db.Rebind(fmt.Sprintf(`SELECT id, type, user_id, subject, data, occurred_at FROM outbox ORDER BY id LIMIT %d`, batchSize)+lock))
+		if err != nil {
+			return err
+		}
+		var ids []string
+		var batch []events.Event
+		for rows.Next() {
+			var id, data string
+			var event events.Event
+			if err := rows.Scan(&id, &event.Type, &event.UserID, &event.Subject, &data, &event.Time); err != nil {
+				rows.Close()
+				return err
+			}
+			if err := json.Unmarshal([]byte(data), &event.Data); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+			batch = append(batch, event)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for i, event := range batch {
+			o.bus.Publish(ctx, event)
+			if _, err := conn.ExecContext(ctx, o.db.Rebind(`DELETE FROM outbox WHERE id = ?`), ids[i]); err != nil {
+				return err
+			}
+		}
+		published = len(batch)
+		return nil
+	})
+	return published, err
+}
+
+// Backlog is what waits in the outbox: how many events, and when the
+// oldest of them happened, zero for none.
+type Backlog struct {
+	Pending int
+	Oldest  time.Time
+}
+
+// Backlog counts the events waiting to be relayed.
+func (o *Outbox) Backlog(ctx context.Context) (Backlog, error) {
+	var backlog Backlog
+	conn := o.db.Conn(ctx)
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbox`).Scan(&backlog.Pending); err != nil {
+		return Backlog{}, err
+	}
+	if backlog.Pending == 0 {
+		return backlog, nil
+	}
+	err := conn.QueryRowContext(ctx, `SELECT occurred_at FROM outbox ORDER BY id LIMIT 1`).Scan(&backlog.Oldest)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Relayed in between.
+		return Backlog{}, nil
+	}
+	return backlog, err
+}
+
+// newID orders events by the time they happened.
+func newID(t time.Time) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%020d-%s", t.UnixNano(), hex.EncodeToString(b)), nil
+}
@@ -0,0 +1,88 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func newOutbox(t *testing.T) (*Outbox, *database.DB, func() []events.Event) {
+	db, err := database.Open(config.DatabaseConfig{SQLitePath: ":memory:"}, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+	assert.Nil(t, db.Migrate(context.Background(), Migrations...))
+
+	bus := events.NewBus()
+	var mu sync.Mutex
+	var published []events.Event
+	bus.Subscribe("*", func(ctx context.Context, event events.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		published = append(published, event)
+	})
+	outbox := New(db, bus, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return outbox, db, func() []events.Event {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]events.Event(nil), published...)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	outbox, db, published := newOutbox(t)
+	ctx := context.Background()
+	at := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	failed := errors.New("failed")
+	err := db.InTx(ctx, func(ctx context.Context) error {
+		assert.Nil(t, outbox.Add(ctx, events.Event{Type: "order.created", UserID: "alice", Subject: "1", Time: at}))
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	err = db.InTx(ctx, func(ctx context.Context) error {
+		assert.Nil(t, outbox.Add(ctx, events.Event{Type: "order.paid", UserID: "alice", Subject: "2", Data: map[string]string{"from": "created"}, Time: at.Add(time.Second)}))
+		assert.Nil(t, outbox.Add(ctx, events.Event{Type: "order.created", UserID: "bob", Subject: "3", Time: at}))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, published(), "events wait for the relay")
+	backlog, err := outbox.Backlog(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, backlog.Pending)
+	assert.True(t, at.Equal(backlog.Oldest))
+
+	n, err := outbox.Relay(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	got := published()
+	assert.Equal(t, []string{"3", "2"}, []string{got[0].Subject, got[1].Subject})
+	assert.Equal(t, "created", got[1].Data["from"])
+	assert.True(t, at.Equal(got[0].Time))
+
+	n, _ = outbox.Relay(ctx)
+	assert.Equal(t, 0, n)
+	backlog, err = outbox.Backlog(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, Backlog{}, backlog)
+}
+
+func TestStartRelaysOnCommit(t *testing.T) {
+	outbox, db, published := newOutbox(t)
+	outbox.interval = time.Hour
+	outbox.Start()
+	defer outbox.Stop()
+
+	db.InTx(context.Background(), func(ctx context.Context) error {
+		return outbox.Add(ctx, events.Event{Type: "order.created", UserID: "alice", Subject: "1"})
+	})
+	assert.Eventually(t, func() bool { return len(published()) == 1 }, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,180 @@
+// Package payments takes payments for orders through a payment provider.
+// Paying is asynchronous: the client starts a payment intent, completes it
+// with the provider, and the provider later reports the outcome to our
+// webhook, which marks the order paid.
+package payments
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/money"
+	"github.com/jalal-akbar/belajar-golang-fiber/orders"
+)
+
+type IntentStatus string
+
+const (
+	RequiresPayment IntentStatus = "requires_payment"
+	Succeeded       IntentStatus = "succeeded"
+	Failed          IntentStatus = "failed"
+)
+
+// Intent is an attempt to pay an order. The client completes it at
+// NextActionURL, the provider's payment page.
+type Intent struct {
+	ID            string       `json:"id"`
+	OrderID       string       `json:"order_id"`
+	Amount        money.Money  `json:"amount"`
+	Status        IntentStatus `json:"status"`
+	NextActionURL string       `json:"next_action_url,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// WebhookEvent is the outcome of an intent as reported by the provider.
+// Providers may deliver an event more than once.
+type WebhookEvent struct {
+	ID       string       `json:"id"`
+	IntentID string       `json:"intent_id"`
+	Status   IntentStatus `json:"status"`
+}
+
+// Provider is a payment provider.
+type Provider interface {
+	CreateIntent(ctx context.Context, order orders.Order) (Intent, error)
+	// ParseWebhook authenticates a webhook request and returns its event.
+	ParseWebhook(c *fiber.Ctx) (WebhookEvent, error)
+}
+
+var (
+	ErrInvalidWebhook = errors.New("payments: invalid webhook")
+	// ErrPending is returned by Pay when another request started paying
+	// the order meanwhile; paying again returns its intent.
+	ErrPending = errors.New("payments: payment already started")
+)
+
+// Payments starts intents for orders and applies their outcomes. It keeps
+// the intents in the database, in the tables Migrations create. Nothing
+// is locked while the provider is called; the outcomes of an intent are
+// applied one at a time under a lock of its row.
+type Payments struct {
+	provider Provider
+	orders   *orders.Service
+	db       *database.DB
+	logger   *slog.Logger
+}
+
+func New(provider Provider, orders *orders.Service, db *database.DB, logger *slog.Logger) *Payments {
+	return &Payments{provider: provider, orders: orders, db: db, logger: logger}
+}
+
+// Pay starts paying an order of userID. Paying again while an intent is
+// pending returns that intent, so a client retrying doesn't pay twice.
+// Should two requests start paying at once, the one that records its
+// intent last fails with ErrPending.
+func (p *Payments) Pay(ctx context.Context, userID, orderID string) (Intent, error) {
+	order, err := p.orders.Get(ctx, orderID)
+	if err != nil || order.UserID != userID {
+		return Intent{}, orders.ErrNotFound
+	}
+	if order.Status != orders.Created {
+		return Intent{}, &orders.TransitionError{From: order.Status, To: orders.Paid}
+	}
+
+	intent, ok, err := p.pending(ctx, orderID)
+	if err != nil || ok {
+		return intent, err
+	}
+	intent, err = p.provider.CreateIntent(ctx, order)
+	if err != nil {
+		return Intent{}, err
+	}
+	if err := p.insert(ctx, intent); errors.Is(err, database.ErrConflict) {
+		return Intent{}, ErrPending
+	} else if err != nil {
+		return Intent{}, err
+	}
+	return intent, nil
+}
+
+// Intent returns the intent of id.
+func (p *Payments) Intent(ctx context.Context, id string) (Intent, bool, error) {
+	return p.get(ctx, id, "")
+}
+
+// Apply records the outcome of an intent and marks its order paid when it
+// succeeded. Events already applied are ignored. An event is recorded in
+// the transaction that marks its order, so when that fails the provider's
+// redelivery applies it again; the intent's row is locked meanwhile, so a
+// copy delivered at the same time waits for the outcome of the first.
+func (p *Payments) Apply(ctx context.Context, event WebhookEvent) error {
+	return p.db.InTx(ctx, func(ctx context.Context) error {
+		intent, ok, err := p.get(ctx, event.IntentID, p.db.ForUpdate())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return orders.ErrNotFound
+		}
+		applied, err := p.applied(ctx, event.ID)
+		if err != nil || applied || intent.Status != RequiresPayment {
+			return err
+		}
+		if event.Status == Succeeded {
+			_, err := p.orders.Transition(ctx, intent.OrderID, orders.Paid)
+			var transition *orders.TransitionError
+			if errors.As(err, &transition) {
+				// Cancelled meanwhile: the money has to go back by hand.
+				p.logger.WarnContext(ctx, "payment for an order that can't be paid",
+					slog.String("order", intent.OrderID),
+					slog.String("status", string(transition.From)),
+				)
+			} else if err != nil {
+				return err
+			}
+		}
+		return p.settle(ctx, intent.ID, event.Status, event.ID)
+	})
+}
+
+// Register adds POST /orders/:id/pay to the authenticated router and the
+// provider's webhook, POST /payments/webhook, to public.
+func (p *Payments) Register(router, public fiber.Router) {
+	router.Post("/orders/:id/pay", p.payHandler)
+	public.Post("/payments/webhook", p.webhookHandler)
+}
+
+func (p *Payments) payHandler(c *fiber.Ctx) error {
+	userID := ctxutil.CurrentUser(c)
+	intent, err := p.Pay(c.UserContext(), userID, c.Params("id"))
+	var transition *orders.TransitionError
+	switch {
+	case errors.Is(err, orders.ErrNotFound):
+		return fiber.ErrNotFound
+	case errors.As(err, &transition):
+		return fiber.NewError(fiber.StatusConflict, "order is "+string(transition.From))
+	case errors.Is(err, ErrPending):
+		return fiber.NewError(fiber.StatusConflict, "payment already started, try again")
+	case err != nil:
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(intent)
+}
+
+func (p *Payments) webhookHandler(c *fiber.Ctx) error {
+	event, err := p.provider.ParseWebhook(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid webhook")
+	}
+	if err := p.Apply(c.UserContext(), event); errors.Is(err, orders.ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "unknown payment intent")
+	} else if err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,249 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/jalal-akbar/belajar-golang-fiber/money"
+	"github.com/jalal-akbar/belajar-golang-fiber/orders"
+	"github.com/jalal-akbar/belajar-golang-fiber/sequence"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+type testApp struct {
+	*fiber.App
+	t       *testing.T
+	orders  *orders.Service
+	sandbox *Sandbox
+}
+
+// newTestApp serves the app on a real port, which the sandbox calls the
+// webhook at.
+func newTestApp(t *testing.T) *testApp {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	cfg := config.Default()
+	cfg.Payments = config.PaymentsConfig{
+		Provider:      "sandbox",
+		WebhookSecret: "s3cret",
+		BaseURL:       "http://" + listener.Addr().String(),
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ids, err := sequence.NewSnowflake(0)
+	assert.Nil(t, err)
+	orderService := orders.NewService(orders.NewMemoryRepository(), events.NewBus(), ids)
+	sandbox := NewSandbox(cfg.Payments, httpclient.New(cfg.HTTPClient), logger)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	sandbox.Register(app)
+	api := app.Group("/api", testkit.FakeAuth)
+	New(sandbox, orderService, testkit.OpenDB(t, Migrations...), logger).Register(api, app)
+	go app.Listener(listener)
+	t.Cleanup(func() { app.Shutdown() })
+	return &testApp{App: app, t: t, orders: orderService, sandbox: sandbox}
+}
+
+func (a *testApp) order(user string) orders.Order {
+	order, err := a.orders.Create(context.Background(), user, []orders.Item{{SKU: "kopi", Quantity: 1, Price: money.MustParse("20000", "IDR")}})
+	assert.Nil(a.t, err)
+	return order
+}
+
+func (a *testApp) pay(user, orderID string) (int, Intent) {
+	response := testkit.Do(a.t, a.App, "POST", "/api/orders/"+orderID+"/pay", nil, testkit.WithUser(user))
+	// Errors have no intent to decode.
+	var intent Intent
+	json.Unmarshal(response.Body, &intent)
+	return response.StatusCode, intent
+}
+
+func (a *testApp) status(orderID string) orders.Status {
+	order, err := a.orders.Get(context.Background(), orderID)
+	assert.Nil(a.t, err)
+	return order.Status
+}
+
+func (a *testApp) complete(intent Intent, outcome string) int {
+	return testkit.Do(a.t, a.App, "POST", "/payments/sandbox/"+intent.ID+"?outcome="+outcome, nil).StatusCode
+}
+
+func TestPayOrder(t *testing.T) {
+	app := newTestApp(t)
+	order := app.order("alice")
+
+	status, _ := app.pay("bob", order.ID)
+	assert.Equal(t, 404, status)
+	status, intent := app.pay("alice", order.ID)
+	assert.Equal(t, 201, status)
+	assert.Equal(t, RequiresPayment, intent.Status)
+	assert.Equal(t, money.MustParse("20000", "IDR"), intent.Amount)
+	assert.True(t, strings.HasSuffix(intent.NextActionURL, "/payments/sandbox/"+intent.ID))
+
+	// Retrying returns the pending intent.
+	_, again := app.pay("alice", order.ID)
+	assert.Equal(t, intent.ID, again.ID)
+
+	assert.Equal(t, 202, app.complete(intent, "succeeded"))
+	assert.Eventually(t, func() bool { return app.status(order.ID) == orders.Paid }, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, 409, app.complete(intent, "failed"))
+
+	status, _ = app.pay("alice", order.ID)
+	assert.Equal(t, 409, status)
+}
+
+func TestFailedPayment(t *testing.T) {
+	app := newTestApp(t)
+	order := app.order("alice")
+
+	_, first := app.pay("alice", order.ID)
+	assert.Equal(t, 202, app.complete(first, "failed"))
+	assert.Eventually(t, func() bool {
+		_, intent := app.pay("alice", order.ID)
+		return intent.ID != first.ID
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, orders.Created, app.status(order.ID))
+}
+
+func TestWebhookSignature(t *testing.T) {
+	app := newTestApp(t)
+	order := app.order("alice")
+	_, intent := app.pay("alice", order.ID)
+
+	body := `{"id":"evt_1","intent_id":"` + intent.ID + `","status":"succeeded"}`
+	post := func(signature string) int {
+		request := httptest.NewRequest("POST", "/payments/webhook", strings.NewReader(body))
+		request.Header.Set(signatureHeader, signature)
+		response, err := app.Test(request)
+		assert.Nil(t, err)
+		return response.StatusCode
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	assert.Equal(t, 400, post(""))
+	assert.Equal(t, 400, post("t="+now+",v1=forged"))
+	assert.Equal(t, 400, post("t="+old+",v1="+app.sandbox.sign(old, []byte(body))))
+	assert.Equal(t, orders.Created, app.status(order.ID))
+
+	assert.Equal(t, 204, post("t="+now+",v1="+app.sandbox.sign(now, []byte(body))))
+	assert.Equal(t, orders.Paid, app.status(order.ID))
+	// Providers redeliver; the event is applied once.
+	assert.Equal(t, 204, post("t="+now+",v1="+app.sandbox.sign(now, []byte(body))))
+}
+
+// failingRepository fails the updates of orders while fail is set.
+type failingRepository struct {
+	*orders.MemoryRepository
+	fail bool
+}
+
+func (r *failingRepository) Update(ctx context.Context, id string, change func(ctx context.Context, order *orders.Order) error) (orders.Order, error) {
+	if r.fail {
+		return orders.Order{}, errors.New("database is down")
+	}
+	return r.MemoryRepository.Update(ctx, id, change)
+}
+
+func TestApplyAgainAfterFailure(t *testing.T) {
+	repo := &failingRepository{MemoryRepository: orders.NewMemoryRepository()}
+	ids, err := sequence.NewSnowflake(0)
+	assert.Nil(t, err)
+	orderService := orders.NewService(repo, events.NewBus(), ids)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	payments := New(NewSandbox(config.PaymentsConfig{}, nil, logger), orderService, testkit.OpenDB(t, Migrations...), logger)
+
+	ctx := context.Background()
+	order, err := orderService.Create(ctx, "alice", []orders.Item{{SKU: "kopi", Quantity: 1, Price: money.MustParse("20000", "IDR")}})
+	assert.Nil(t, err)
+	intent, err := payments.Pay(ctx, "alice", order.ID)
+	assert.Nil(t, err)
+
+	event := WebhookEvent{ID: "evt_1", IntentID: intent.ID, Status: Succeeded}
+	repo.fail = true
+	assert.NotNil(t, payments.Apply(ctx, event))
+	stored, _, _ := payments.Intent(ctx, intent.ID)
+	assert.Equal(t, RequiresPayment, stored.Status)
+
+	// The provider delivers the event again once the database is back.
+	repo.fail = false
+	assert.Nil(t, payments.Apply(ctx, event))
+	stored, _, _ = payments.Intent(ctx, intent.ID)
+	assert.Equal(t, Succeeded, stored.Status)
+	order, err = orderService.Get(ctx, order.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, orders.Paid, order.Status)
+}
+
+// slowProvider holds the intents of the orders in slow until released.
+type slowProvider struct {
+	Provider
+	slow    map[string]chan struct{}
+	started chan struct{}
+}
+
+func (p *slowProvider) CreateIntent(ctx context.Context, order orders.Order) (Intent, error) {
+	if release, ok := p.slow[order.ID]; ok {
+		p.started <- struct{}{}
+		<-release
+	}
+	return p.Provider.CreateIntent(ctx, order)
+}
+
+func TestPayWithoutWaitingForOthers(t *testing.T) {
+	ids, err := sequence.NewSnowflake(0)
+	assert.Nil(t, err)
+	orderService := orders.NewService(orders.NewMemoryRepository(), events.NewBus(), ids)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+	create := func() orders.Order {
+		order, err := orderService.Create(ctx, "alice", []orders.Item{{SKU: "kopi", Quantity: 1, Price: money.MustParse("20000", "IDR")}})
+		assert.Nil(t, err)
+		return order
+	}
+	slow, fast := create(), create()
+	release := make(chan struct{})
+	provider := &slowProvider{
+		Provider: NewSandbox(config.PaymentsConfig{}, nil, logger),
+		slow:     map[string]chan struct{}{slow.ID: release},
+		started:  make(chan struct{}),
+	}
+	db := testkit.OpenDB(t, Migrations...)
+	payments := New(provider, orderService, db, logger)
+
+	done := make(chan Intent)
+	go func() {
+		intent, err := payments.Pay(ctx, "alice", slow.ID)
+		assert.Nil(t, err)
+		done <- intent
+	}()
+	<-provider.started
+	// The provider is still busy with the slow order.
+	_, err = payments.Pay(ctx, "alice", fast.ID)
+	assert.Nil(t, err)
+	close(release)
+	intent := <-done
+
+	// Restarted, the pending intent is still the one paying for the order.
+	restarted := New(provider, orderService, db, logger)
+	again, err := restarted.Pay(ctx, "alice", slow.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, intent.ID, again.ID)
+	assert.Nil(t, restarted.Apply(ctx, WebhookEvent{ID: "evt_1", IntentID: intent.ID, Status: Succeeded}))
+	order, err := orderService.Get(ctx, slow.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, orders.Paid, order.Status)
+}
@@ -0,0 +1,169 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/jalal-akbar/belajar-golang-fiber/orders"
+)
+
+const (
+	signatureHeader = "X-Sandbox-Signature"
+	// signatureTolerance is how old a webhook's timestamp may be.
+	signatureTolerance = 5 * time.Minute
+)
+
+// Sandbox is a payment provider living inside the app, for development
+// and demos. Its payment page is POST /payments/sandbox/:id?outcome=...;
+// some time after it was called the sandbox reports the outcome to the
+// webhook, like a real provider would.
+//
+// Webhooks are signed in the header
+//
+//	X-Sandbox-Signature: t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+type Sandbox struct {
+	cfg    config.PaymentsConfig
+	client *httpclient.Client
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu      sync.Mutex
+	intents map[string]Intent
+}
+
+func NewSandbox(cfg config.PaymentsConfig, client *httpclient.Client, logger *slog.Logger) *Sandbox {
+	return &Sandbox{cfg: cfg, client: client, logger: logger, now: clock.System.Now, intents: map[string]Intent{}}
+}
+
+func (s *Sandbox) CreateIntent(ctx context.Context, order orders.Order) (Intent, error) {
+	id := "pi_" + randomHex()
+	intent := Intent{
+		ID:            id,
+		OrderID:       order.ID,
+		Amount:        order.Amount,
+		Status:        RequiresPayment,
+		NextActionURL: strings.TrimSuffix(s.cfg.BaseURL, "/") + "/payments/sandbox/" + id,
+		CreatedAt:     s.now(),
+	}
+	s.mu.Lock()
+	s.intents[id] = intent
+	s.mu.Unlock()
+	return intent, nil
+}
+
+// Register adds the sandbox's payment page.
+func (s *Sandbox) Register(router fiber.Router) {
+	router.Post("/payments/sandbox/:id", s.payHandler)
+}
+
+func (s *Sandbox) payHandler(c *fiber.Ctx) error {
+	status := IntentStatus(c.Query("outcome", string(Succeeded)))
+	if status != Succeeded && status != Failed {
+		return fiber.NewError(fiber.StatusBadRequest, `outcome must be "succeeded" or "failed"`)
+	}
+	s.mu.Lock()
+	intent, ok := s.intents[c.Params("id")]
+	if ok && intent.Status == RequiresPayment {
+		intent.Status = status
+		s.intents[intent.ID] = intent
+	}
+	s.mu.Unlock()
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	if intent.Status != status {
+		return fiber.NewError(fiber.StatusConflict, "payment already "+string(intent.Status))
+	}
+
+	event := WebhookEvent{ID: "evt_" + randomHex(), IntentID: intent.ID, Status: status}
+	go func() {
+		time.Sleep(s.cfg.SandboxDelay)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := s.deliver(ctx, event); err != nil {
+			s.logger.Warn("sandbox webhook failed", slog.String("intent", event.IntentID), slog.String("error", err.Error()))
+		}
+	}()
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"status": "processing"})
+}
+
+func (s *Sandbox) deliver(ctx context.Context, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(s.cfg.BaseURL, "/") + "/payments/webhook"
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(signatureHeader, "t="+timestamp+",v1="+s.sign(timestamp, body))
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("payments: webhook returned %s", response.Status)
+	}
+	return nil
+}
+
+func (s *Sandbox) ParseWebhook(c *fiber.Ctx) (WebhookEvent, error) {
+	fields := map[string]string{}
+	for _, field := range strings.Split(c.Get(signatureHeader), ",") {
+		name, value, _ := strings.Cut(field, "=")
+		fields[name] = value
+	}
+	seconds, err := strconv.ParseInt(fields["t"], 10, 64)
+	if err != nil {
+		return WebhookEvent{}, ErrInvalidWebhook
+	}
+	if age := s.now().Sub(time.Unix(seconds, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return WebhookEvent{}, ErrInvalidWebhook
+	}
+	if !hmac.Equal([]byte(s.sign(fields["t"], c.Body())), []byte(fields["v1"])) {
+		return WebhookEvent{}, ErrInvalidWebhook
+	}
+	var event WebhookEvent
+	if err := json.Unmarshal(c.Body(), &event); err != nil || event.ID == "" {
+		return WebhookEvent{}, ErrInvalidWebhook
+	}
+	if event.Status != Succeeded && event.Status != Failed {
+		return WebhookEvent{}, ErrInvalidWebhook
+	}
+	return event, nil
+}
+
+func (s *Sandbox) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.WebhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
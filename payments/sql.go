@@ -0,0 +1,93 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/money"
+)
+
+// Migrations create the tables of the intents and of the webhook events
+// applied to them. pending_order_id is the order of an intent while it
+// requires payment, and unique, so an order has one pending intent at
+// most.
+var Migrations = []database.Migration{{
+	ID: "payments-0001",
+	Statements: []string{
+		`CREATE TABLE payment_intents (
+	id VARCHAR(255) PRIMARY KEY,
+	order_id VARCHAR(255) NOT NULL,
+	pending_order_id VARCHAR(255) NULL UNIQUE,
+	amount BIGINT NOT NULL,
+	currency VARCHAR(3) NOT NULL,
+	status VARCHAR(32) NOT NULL,
+	next_action_url TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+)`,
+		`CREATE INDEX payment_intents_order_id ON payment_intents (order_id)`,
+		`CREATE TABLE payment_events (
+	id VARCHAR(255) PRIMARY KEY,
+	intent_id VARCHAR(255) NOT NULL
+)`,
+	},
+}}
+
+const intentColumns = "id, order_id, amount, currency, status, next_action_url, created_at"
+
+// insert records a new intent. It fails with database.ErrConflict when
+// its order already has one pending.
+func (p *Payments) insert(ctx context.Context, intent Intent) error {
+	pending := sql.NullString{String: intent.OrderID, Valid: intent.Status == RequiresPayment}
+	_, err := p.db.Conn(ctx).ExecContext(ctx, p.db.Rebind(`INSERT INTO payment_intents (`+intentColumns+`, pending_order_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		intent.ID, intent.OrderID, intent.Amount.Minor(), intent.Amount.Currency(), intent.Status, intent.NextActionURL, intent.CreatedAt.UTC(), pending)
+	return database.Conflict(err)
+}
+
+// get returns the intent of id; ok is false if there is none. lock is
+// appended to the query, to lock the row in a transaction.
+func (p *Payments) get(ctx context.Context, id, lock string) (Intent, bool, error) {
+	return p.scan(p.db.Conn(ctx).QueryRowContext(ctx, p.db.Rebind(`SELECT `+intentColumns+` FROM payment_intents WHERE id = ?`+lock), id))
+}
+
+// pending returns the intent of orderID that requires payment, if any.
+func (p *Payments) pending(ctx context.Context, orderID string) (Intent, bool, error) {
+	return p.scan(p.db.Conn(ctx).QueryRowContext(ctx, p.db.Rebind(`SELECT `+intentColumns+` FROM payment_intents WHERE pending_order_id = ?`), orderID))
+}
+
+// applied reports whether the webhook event of id was applied.
+func (p *Payments) applied(ctx context.Context, id string) (bool, error) {
+	var count int
+	err := p.db.Conn(ctx).QueryRowContext(ctx, p.db.Rebind(`SELECT COUNT(*) FROM payment_events WHERE id = ?`), id).Scan(&count)
+	return count > 0, err
+}
+
+// settle sets the final status of the intent of id and records that
+// eventID was applied to it.
+func (p *Payments) settle(ctx context.Context, id string, status IntentStatus, eventID string) error {
+	conn := p.db.Conn(ctx)
+	if _, err := conn.ExecContext(ctx, p.db.Rebind(`INSERT INTO payment_events (id, intent_id) VALUES (?, ?)`), eventID, id); err != nil {
+		return err
+	}
+	_, err := conn.ExecContext(ctx, p.db.Rebind(`UPDATE payment_intents SET status = ?, pending_order_id = NULL WHERE id = ?`), status, id)
+	return err
+}
+
+func (p *Payments) scan(row *sql.Row) (Intent, bool, error) {
+	var intent Intent
+	var amount int64
+	var currency string
+	err := row.Scan(&intent.ID, &intent.OrderID, &amount, &currency, &intent.Status, &intent.NextActionURL, &intent.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Intent{}, false, nil
+	}
+	if err != nil {
+		return Intent{}, false, err
+	}
+	if intent.Amount, err = money.New(amount, currency); err != nil {
+		return Intent{}, false, err
+	}
+	intent.CreatedAt = intent.CreatedAt.UTC()
+	return intent, true, nil
+}
@@ -0,0 +1,111 @@
+// Package pii encrypts personal data, such as email addresses and phone
+// numbers, where it is kept. Values are sealed with AES-256-GCM, bound to
+// the record they belong to, and found again by exact match through a
+// blind index: an HMAC of the value, which reveals nothing of it but
+// whether two values are equal.
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"golang.org/x/crypto/hkdf"
+)
+
+// sealedPrefix marks sealed values, and the version of their format.
+const sealedPrefix = "pii1:"
+
+var ErrSealed = errors.New("pii: value can't be opened")
+
+// Cipher seals and indexes values under the configured key. A nil Cipher
+// keeps values in the clear, so stores work the same without a key.
+type Cipher struct {
+	aead     cipher.AEAD
+	indexKey []byte
+}
+
+// New derives the encryption and index keys from cfg.Key, 32 bytes in
+// base64.
+func New(cfg config.PIIConfig) (*Cipher, error) {
+	key, err := base64.StdEncoding.DecodeString(cfg.Key)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("pii: key must be 32 bytes in base64")
+	}
+	derive := func(purpose string) []byte {
+		derived := make([]byte, 32)
+		// Reading 32 bytes from HKDF-SHA256 can't fail.
+		io.ReadFull(hkdf.New(sha256.New, key, nil, []byte(purpose)), derived)
+		return derived
+	}
+	block, err := aes.NewCipher(derive("pii encryption"))
+	if err != nil {
+		return nil, fmt.Errorf("pii: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("pii: %w", err)
+	}
+	return &Cipher{aead: aead, indexKey: derive("pii blind index")}, nil
+}
+
+// Seal encrypts value for the record of owner, usually a user ID, so it
+// can't be moved to another record and opened there. Empty values stay
+// empty.
+func (c *Cipher) Seal(owner, value string) string {
+	if c == nil || value == "" {
+		return value
+	}
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(value)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		panic("pii: " + err.Error())
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), []byte(owner))
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed)
+}
+
+// Open decrypts what Seal returned for owner. Values that aren't sealed
+// are returned as they are, which lets a key be introduced over data kept
+// in the clear.
+func (c *Cipher) Open(owner, sealed string) (string, error) {
+	data, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if !ok {
+		return sealed, nil
+	}
+	if c == nil {
+		return "", ErrSealed
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil || len(raw) < c.aead.NonceSize() {
+		return "", ErrSealed
+	}
+	nonce, ciphertext := raw[:c.aead.NonceSize()], raw[c.aead.NonceSize():]
+	value, err := c.aead.Open(nil, nonce, ciphertext, []byte(owner))
+	if err != nil {
+		return "", ErrSealed
+	}
+	return string(value), nil
+}
+
+// Index returns the blind index of value as a field, such as "email", to
+// look it up by. Equal values of a field have equal indexes, so callers
+// normalize values first; the same value gets another index in another
+// field. Without a key the index is the field and value in the clear.
+func (c *Cipher) Index(field, value string) string {
+	if c == nil {
+		return field + ":" + value
+	}
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,70 @@
+package pii
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCipher(t *testing.T, key string) *Cipher {
+	cipher, err := New(config.PIIConfig{Key: base64.StdEncoding.EncodeToString([]byte(key))})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	return cipher
+}
+
+func TestSealAndOpen(t *testing.T) {
+	cipher := newCipher(t, "0123456789abcdef0123456789abcdef")
+	sealed := cipher.Seal("alice", "alice@example.com")
+	assert.True(t, strings.HasPrefix(sealed, "pii1:"))
+	assert.NotContains(t, sealed, "alice@example.com")
+	assert.NotEqual(t, sealed, cipher.Seal("alice", "alice@example.com"))
+
+	value, err := cipher.Open("alice", sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice@example.com", value)
+
+	// Sealed for another record or under another key, it stays shut.
+	_, err = cipher.Open("bob", sealed)
+	assert.ErrorIs(t, err, ErrSealed)
+	_, err = newCipher(t, "fedcba9876543210fedcba9876543210").Open("alice", sealed)
+	assert.ErrorIs(t, err, ErrSealed)
+	_, err = cipher.Open("alice", sealed[:len(sealed)-4])
+	assert.ErrorIs(t, err, ErrSealed)
+	_, err = (*Cipher)(nil).Open("alice", sealed)
+	assert.ErrorIs(t, err, ErrSealed)
+
+	// Values kept before there was a key are read as they are.
+	value, err = cipher.Open("alice", "alice@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "alice@example.com", value)
+	assert.Equal(t, "", cipher.Seal("alice", ""))
+}
+
+func TestIndex(t *testing.T) {
+	cipher := newCipher(t, "0123456789abcdef0123456789abcdef")
+	index := cipher.Index("email", "alice@example.com")
+	assert.Equal(t, index, cipher.Index("email", "alice@example.com"))
+	assert.NotEqual(t, index, cipher.Index("email", "bob@example.com"))
+	assert.NotEqual(t, index, cipher.Index("phone", "alice@example.com"))
+	assert.NotEqual(t, index, newCipher(t, "fedcba9876543210fedcba9876543210").Index("email", "alice@example.com"))
+	assert.NotContains(t, index, "alice")
+}
+
+func TestWithoutKey(t *testing.T) {
+	var cipher *Cipher
+	assert.Equal(t, "+6281234567890", cipher.Seal("alice", "+6281234567890"))
+	value, err := cipher.Open("alice", "+6281234567890")
+	assert.Nil(t, err)
+	assert.Equal(t, "+6281234567890", value)
+	assert.Equal(t, "phone:+6281234567890", cipher.Index("phone", "+6281234567890"))
+
+	_, err = New(config.PIIConfig{Key: base64.StdEncoding.EncodeToString([]byte("short"))})
+	assert.EqualError(t, err, "pii: key must be 32 bytes in base64")
+	_, err = New(config.PIIConfig{Key: "not base64!"})
+	assert.NotNil(t, err)
+}
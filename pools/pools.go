@@ -0,0 +1,170 @@
+// Package pools watches the connection pools of the app, database and
+// Redis alike, so a pool running out of connections shows up in the
+// metrics and at /admin/status before requests start queueing for them.
+package pools
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+// Stats is the state of a pool. Waits counts the times a caller had to
+// wait for a connection, Timeouts those it gave up. Max is zero for pools
+// without a limit, which are never exhausted.
+type Stats struct {
+	Max         int     `json:"max"`
+	Open        int     `json:"open"`
+	InUse       int     `json:"in_use"`
+	Idle        int     `json:"idle"`
+	Waits       int64   `json:"waits"`
+	WaitSeconds float64 `json:"wait_seconds"`
+	Timeouts    int64   `json:"timeouts"`
+	Utilization float64 `json:"utilization"`
+	Exhausted   bool    `json:"exhausted"`
+	// Breaker is the state of the circuit breaker in front of the pool,
+	// if it has one.
+	Breaker string `json:"breaker,omitempty"`
+}
+
+// SQL reads the stats of a database pool.
+func SQL(db *sql.DB) func() Stats {
+	return func() Stats {
+		stats := db.Stats()
+		return Stats{
+			Max:         stats.MaxOpenConnections,
+			Open:        stats.OpenConnections,
+			InUse:       stats.InUse,
+			Idle:        stats.Idle,
+			Waits:       stats.WaitCount,
+			WaitSeconds: stats.WaitDuration.Seconds(),
+		}
+	}
+}
+
+// Redis reads the stats of a Redis client's pool.
+func Redis(client *redis.Client) func() Stats {
+	return func() Stats {
+		stats := client.PoolStats()
+		return Stats{
+			Max:      client.Options().PoolSize,
+			Open:     int(stats.TotalConns),
+			InUse:    int(stats.TotalConns) - int(stats.IdleConns),
+			Idle:     int(stats.IdleConns),
+			Timeouts: int64(stats.Timeouts),
+		}
+	}
+}
+
+// Pools reports the stats of the pools added to it, labelled with their
+// names, in the metrics at every scrape:
+//
+//	pool_connections{state}                     max, open, in_use and idle
+//	pool_utilization_ratio                      in use / max, to alert on
+//	pool_exhausted                              1 while all are in use
+//	pool_waits_total, pool_wait_seconds_total   waits for a connection
+//	pool_timeouts_total                         waits given up
+type Pools struct {
+	mu       sync.Mutex
+	sources  map[string]func() Stats
+	breakers map[string]func() string
+	last     map[string]Stats
+
+	connections *metrics.GaugeVec
+	utilization *metrics.GaugeVec
+	exhausted   *metrics.GaugeVec
+	waits       *metrics.CounterVec
+	waitSeconds *metrics.CounterVec
+	timeouts    *metrics.CounterVec
+}
+
+func New(registry *metrics.Registry) *Pools {
+	p := &Pools{
+		sources:     map[string]func() Stats{},
+		breakers:    map[string]func() string{},
+		last:        map[string]Stats{},
+		connections: registry.Gauge("pool_connections", "Connections of a pool by state: max, open, in_use or idle.", "pool", "state"),
+		utilization: registry.Gauge("pool_utilization_ratio", "Share of a pool's connection limit in use.", "pool"),
+		exhausted:   registry.Gauge("pool_exhausted", "1 while all connections of a pool are in use.", "pool"),
+		waits:       registry.Counter("pool_waits_total", "Times a caller waited for a connection.", "pool"),
+		waitSeconds: registry.Counter("pool_wait_seconds_total", "Time callers spent waiting for a connection.", "pool"),
+		timeouts:    registry.Counter("pool_timeouts_total", "Times a caller gave up waiting for a connection.", "pool"),
+	}
+	registry.OnScrape(p.collect)
+	return p
+}
+
+func (p *Pools) Add(name string, stats func() Stats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sources[name] = stats
+}
+
+// AddBreaker reports the state of the circuit breaker in front of the
+// pool name with its stats.
+func (p *Pools) AddBreaker(name string, state func() string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.breakers[name] = state
+}
+
+// Stats reads the stats of every pool, by name.
+func (p *Pools) Stats() map[string]Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	all := make(map[string]Stats, len(p.sources))
+	for name, source := range p.sources {
+		stats := source()
+		if stats.Max > 0 {
+			stats.Utilization = float64(stats.InUse) / float64(stats.Max)
+			stats.Exhausted = stats.InUse >= stats.Max
+		}
+		if state, ok := p.breakers[name]; ok {
+			stats.Breaker = state()
+		}
+		all[name] = stats
+	}
+	return all
+}
+
+func (p *Pools) collect() {
+	all := p.Stats()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, stats := range all {
+		p.connections.With(name, "max").Set(float64(stats.Max))
+		p.connections.With(name, "open").Set(float64(stats.Open))
+		p.connections.With(name, "in_use").Set(float64(stats.InUse))
+		p.connections.With(name, "idle").Set(float64(stats.Idle))
+		p.utilization.With(name).Set(stats.Utilization)
+		exhausted := 0.0
+		if stats.Exhausted {
+			exhausted = 1
+		}
+		p.exhausted.With(name).Set(exhausted)
+
+		// The pools count from their start; the counters only take what
+		// was added since the last scrape.
+		last := p.last[name]
+		increase(p.waits.With(name), float64(stats.Waits-last.Waits))
+		increase(p.waitSeconds.With(name), stats.WaitSeconds-last.WaitSeconds)
+		increase(p.timeouts.With(name), float64(stats.Timeouts-last.Timeouts))
+		p.last[name] = stats
+	}
+}
+
+// increase adds delta to counter, unless a pool's count went back, as
+// Redis's wrapping ones can.
+func increase(counter *metrics.Counter, delta float64) {
+	if delta > 0 {
+		counter.Add(delta)
+	}
+}
+
+// StatusHandler reports the stats of every pool, for the admin API.
+func (p *Pools) StatusHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"pools": p.Stats()})
+}
@@ -0,0 +1,77 @@
+package pools
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestPools(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.Nil(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), PoolSize: 4})
+	defer client.Close()
+	assert.Nil(t, client.Ping(context.Background()).Err())
+
+	registry := metrics.NewRegistry()
+	pools := New(registry)
+	pools.Add("db", SQL(db))
+	pools.Add("redis", Redis(client))
+	pools.AddBreaker("db", func() string { return "closed" })
+
+	// The only connection is taken, so the next caller waits for it.
+	conn, err := db.Conn(context.Background())
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.NotNil(t, db.PingContext(ctx))
+
+	stats := pools.Stats()
+	assert.True(t, stats["db"].Exhausted)
+	assert.Equal(t, 1.0, stats["db"].Utilization)
+	assert.Equal(t, int64(1), stats["db"].Waits)
+	assert.Equal(t, 4, stats["redis"].Max)
+	assert.Equal(t, 1, stats["redis"].Idle)
+	assert.False(t, stats["redis"].Exhausted)
+
+	output := new(bytes.Buffer)
+	assert.Nil(t, registry.Write(output))
+	assert.Contains(t, output.String(), `pool_connections{pool="db",state="in_use"} 1`)
+	assert.Contains(t, output.String(), `pool_exhausted{pool="db"} 1`)
+	assert.Contains(t, output.String(), `pool_waits_total{pool="db"} 1`)
+	assert.Contains(t, output.String(), `pool_connections{pool="redis",state="max"} 4`)
+
+	conn.Close()
+	output.Reset()
+	assert.Nil(t, registry.Write(output))
+	assert.Contains(t, output.String(), `pool_exhausted{pool="db"} 0`)
+	// Waits are counted once.
+	assert.Contains(t, output.String(), `pool_waits_total{pool="db"} 1`)
+
+	app := fiber.New()
+	app.Get("/admin/status", pools.StatusHandler)
+	response, err := app.Test(httptest.NewRequest("GET", "/admin/status", nil))
+	assert.Nil(t, err)
+	var status struct {
+		Pools map[string]Stats `json:"pools"`
+	}
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&status))
+	assert.Equal(t, 1, status.Pools["db"].Max)
+	assert.Equal(t, "closed", status.Pools["db"].Breaker)
+	assert.Contains(t, status.Pools, "redis")
+	assert.Empty(t, status.Pools["redis"].Breaker)
+}
@@ -0,0 +1,162 @@
+// Package profile serves the authenticated user's profile.
+package profile
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/timezone"
+	"github.com/jalal-akbar/belajar-golang-fiber/upload"
+)
+
+const (
+	// AvatarPrefix is where in the storage the avatars are kept. Unlike
+	// other uploads they are served publicly, as the images they were
+	// turned into.
+	AvatarPrefix = "avatars"
+
+	maxName = 100
+	maxBio  = 500
+)
+
+type Profile struct {
+	Name      string    `json:"name"`
+	Bio       string    `json:"bio"`
+	AvatarURL string    `json:"avatar_url,omitempty"`
+	TimeZone  string    `json:"time_zone,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+
+	avatar string
+}
+
+// Profiles keeps the profiles in memory, keyed by user id. Users who
+// haven't saved one get an empty profile.
+type Profiles struct {
+	uploads    *upload.Pipeline
+	avatarSize int
+	now        func() time.Time
+	bus        *events.Bus
+
+	mu       sync.Mutex
+	profiles map[string]Profile
+}
+
+func New(uploads *upload.Pipeline, avatarSize int) *Profiles {
+	return &Profiles{uploads: uploads, avatarSize: avatarSize, now: clock.System.Now, profiles: map[string]Profile{}}
+}
+
+// UseBus publishes upload.EventStored on bus for every avatar stored.
+func (p *Profiles) UseBus(bus *events.Bus) {
+	p.bus = bus
+}
+
+func (p *Profiles) Get(userID string) Profile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.profiles[userID]
+}
+
+// Delete deletes the profile of userID and its avatar. The upload GC
+// doesn't look after avatars, as the profiles referring to them don't
+// outlive restarts.
+func (p *Profiles) Delete(ctx context.Context, userID string) error {
+	p.mu.Lock()
+	avatar := p.profiles[userID].avatar
+	delete(p.profiles, userID)
+	p.mu.Unlock()
+	if avatar == "" {
+		return nil
+	}
+	return p.uploads.Storage().Delete(ctx, avatar)
+}
+
+// Register adds GET and PUT /me and POST /me/avatar for the authenticated
+// user.
+func (p *Profiles) Register(router fiber.Router) {
+	router.Get("/me", p.getHandler)
+	router.Put("/me", p.putHandler)
+	router.Post("/me/avatar", p.avatarHandler)
+}
+
+func (p *Profiles) getHandler(c *fiber.Ctx) error {
+	userID := ctxutil.CurrentUser(c)
+	return c.JSON(p.Get(userID))
+}
+
+func (p *Profiles) putHandler(c *fiber.Ctx) error {
+	var body struct {
+		Name     string `json:"name"`
+		Bio      string `json:"bio"`
+		TimeZone string `json:"time_zone"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid profile")
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if utf8.RuneCountInString(body.Name) > maxName || utf8.RuneCountInString(body.Bio) > maxBio {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "name or bio too long")
+	}
+	if body.TimeZone != "" {
+		if _, err := timezone.Load(body.TimeZone); err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, "unknown time zone "+body.TimeZone)
+		}
+	}
+
+	userID := ctxutil.CurrentUser(c)
+	p.mu.Lock()
+	profile := p.profiles[userID]
+	profile.Name = utils.CopyString(body.Name)
+	profile.Bio = utils.CopyString(body.Bio)
+	profile.TimeZone = utils.CopyString(body.TimeZone)
+	profile.UpdatedAt = p.now()
+	p.profiles[utils.CopyString(userID)] = profile
+	p.mu.Unlock()
+	return c.JSON(profile)
+}
+
+// avatarHandler takes the image in the avatar form field and answers with
+// the public URL of the processed avatar.
+func (p *Profiles) avatarHandler(c *fiber.Ctx) error {
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "missing avatar file")
+	}
+	key, err := p.uploads.Image(c.UserContext(), file, AvatarPrefix, p.avatarSize)
+	if err != nil {
+		return upload.HTTPError(err)
+	}
+	storage := p.uploads.Storage()
+
+	userID := ctxutil.CurrentUser(c)
+	p.mu.Lock()
+	profile := p.profiles[userID]
+	old := profile.avatar
+	profile.avatar = key
+	profile.AvatarURL = storage.URL(key)
+	profile.UpdatedAt = p.now()
+	p.profiles[utils.CopyString(userID)] = profile
+	p.mu.Unlock()
+
+	if old != "" {
+		// A leftover file only wastes space.
+		_ = storage.Delete(c.UserContext(), old)
+	}
+	if p.bus != nil {
+		p.bus.Publish(c.UserContext(), events.Event{
+			Type:    upload.EventStored,
+			UserID:  utils.CopyString(userID),
+			Subject: key,
+			Data:    map[string]string{"kind": "avatar"},
+			Time:    profile.UpdatedAt,
+		})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"avatar_url": profile.AvatarURL})
+}
@@ -0,0 +1,104 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/jalal-akbar/belajar-golang-fiber/upload"
+	"github.com/stretchr/testify/assert"
+)
+
+func newApp(t *testing.T) (*fiber.App, string) {
+	dir := t.TempDir()
+	cfg := config.Default().Uploads
+	profiles := New(upload.New(cfg, upload.NewDisk(dir, "/files")), 32)
+	app := fiber.New()
+	app.Use(testkit.FakeAuth)
+	profiles.Register(app)
+	return app, dir
+}
+
+func do(t *testing.T, app *fiber.App, request *http.Request, user string) (*testkit.Response, map[string]interface{}) {
+	request.Header.Set(testkit.HeaderUser, user)
+	response := testkit.Send(t, app, request)
+	var body map[string]interface{}
+	json.Unmarshal(response.Body, &body)
+	return response, body
+}
+
+func avatarRequest(t *testing.T) *http.Request {
+	var buf bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 80, 60)), nil))
+	body, contentType := testkit.Multipart(t, nil, testkit.File{Field: "avatar", Name: "me.jpg", Data: buf.Bytes()})
+	request := httptest.NewRequest("POST", "/me/avatar", body)
+	contentType(request)
+	return request
+}
+
+func TestProfile(t *testing.T) {
+	app, _ := newApp(t)
+
+	response, body := do(t, app, httptest.NewRequest("GET", "/me", nil), "alice")
+	assert.Equal(t, 200, response.StatusCode)
+	assert.Equal(t, "", body["name"])
+
+	request := httptest.NewRequest("PUT", "/me", strings.NewReader(`{"name":" Alice ","bio":"Gopher","time_zone":"Asia/Jakarta"}`))
+	request.Header.Set("Content-Type", "application/json")
+	response, _ = do(t, app, request, "alice")
+	assert.Equal(t, 200, response.StatusCode)
+
+	_, body = do(t, app, httptest.NewRequest("GET", "/me", nil), "alice")
+	assert.Equal(t, "Alice", body["name"])
+	assert.Equal(t, "Gopher", body["bio"])
+	assert.Equal(t, "Asia/Jakarta", body["time_zone"])
+	assert.True(t, strings.HasSuffix(body["updated_at"].(string), "Z"))
+	_, body = do(t, app, httptest.NewRequest("GET", "/me", nil), "bob")
+	assert.Equal(t, "", body["name"])
+
+	request = httptest.NewRequest("PUT", "/me", strings.NewReader(`{"bio":"`+strings.Repeat("x", 501)+`"}`))
+	request.Header.Set("Content-Type", "application/json")
+	response, _ = do(t, app, request, "alice")
+	assert.Equal(t, 422, response.StatusCode)
+
+	request = httptest.NewRequest("PUT", "/me", strings.NewReader(`{"time_zone":"Mars/Olympus_Mons"}`))
+	request.Header.Set("Content-Type", "application/json")
+	response, _ = do(t, app, request, "alice")
+	assert.Equal(t, 422, response.StatusCode)
+}
+
+func TestAvatar(t *testing.T) {
+	app, dir := newApp(t)
+
+	response, body := do(t, app, avatarRequest(t), "alice")
+	assert.Equal(t, 201, response.StatusCode)
+	first, _ := body["avatar_url"].(string)
+	assert.True(t, strings.HasPrefix(first, "/files/avatars/"))
+	assert.True(t, strings.HasSuffix(first, ".jpg"))
+
+	_, body = do(t, app, httptest.NewRequest("GET", "/me", nil), "alice")
+	assert.Equal(t, first, body["avatar_url"])
+
+	// A new avatar replaces the old file.
+	_, body = do(t, app, avatarRequest(t), "alice")
+	second, _ := body["avatar_url"].(string)
+	assert.NotEqual(t, first, second)
+	_, err := os.Stat(filepath.Join(dir, strings.TrimPrefix(first, "/files/")))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, strings.TrimPrefix(second, "/files/")))
+	assert.Nil(t, err)
+
+	request := httptest.NewRequest("POST", "/me/avatar", strings.NewReader("not a form"))
+	response, _ = do(t, app, request, "alice")
+	assert.Equal(t, 400, response.StatusCode)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/apikeys"
+	"github.com/jalal-akbar/belajar-golang-fiber/cache"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/lifecycle"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/pools"
+	"github.com/jalal-akbar/belajar-golang-fiber/redisguard"
+	"github.com/redis/go-redis/v9"
+)
+
+// backends are the stores that have an implementation per environment:
+// in memory on a single instance, in Redis when one is configured.
+type backends struct {
+	Redis *redis.Client
+	Usage apikeys.UsageStore
+	// Cache is nil when caching is disabled.
+	Cache cache.Store
+}
+
+// provideRedis connects to Redis, or returns nil if it isn't configured.
+func provideRedis(cfg config.RedisConfig, hooks *lifecycle.Lifecycle, connectionPools *pools.Pools) *redis.Client {
+	if cfg.Addr == "" {
+		return nil
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+		PoolSize: cfg.PoolSize,
+	})
+	hooks.Append(lifecycle.Hook{Name: "redis", OnStop: func(context.Context) error {
+		return client.Close()
+	}})
+	connectionPools.Add("redis", pools.Redis(client))
+	return client
+}
+
+// provideRedisGuard watches the connection to Redis for the stores on it,
+// which fall back while it is down; nil without Redis.
+func provideRedisGuard(redisClient *redis.Client, hooks *lifecycle.Lifecycle, logger *slog.Logger, registry *metrics.Registry) *redisguard.Guard {
+	if redisClient == nil {
+		return nil
+	}
+	guard := redisguard.New(redisClient, logger, registry)
+	hooks.Append(lifecycle.Hook{Name: "redisguard", OnStop: func(context.Context) error {
+		guard.Stop()
+		return nil
+	}})
+	return guard
+}
+
+func provideUsageStore(redisClient *redis.Client, guard *redisguard.Guard) apikeys.UsageStore {
+	if redisClient != nil {
+		return redisguard.Usage(guard, apikeys.NewRedisUsage(redisClient), apikeys.NewMemoryUsage())
+	}
+	return apikeys.NewMemoryUsage()
+}
+
+func provideCacheStore(cfg config.CacheConfig, redisClient *redis.Client, guard *redisguard.Guard, registry *metrics.Registry) cache.Store {
+	switch {
+	case cfg.Disabled:
+		return nil
+	case redisClient != nil:
+		return redisguard.Cache(guard, cache.NewRedis(redisClient))
+	default:
+		return cache.NewMemory(cfg.MaxBytes, registry)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/apikeys"
+	"github.com/jalal-akbar/belajar-golang-fiber/cache"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/lifecycle"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/pools"
+	"github.com/jalal-akbar/belajar-golang-fiber/redisguard"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackends(t *testing.T) {
+	registry := metrics.NewRegistry()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	hooks := lifecycle.New(0, logger)
+
+	cfg := config.Default()
+	stores := newBackends(cfg, hooks, pools.New(registry), logger, registry)
+	assert.Nil(t, stores.Redis)
+	assert.IsType(t, &apikeys.MemoryUsage{}, stores.Usage)
+	assert.IsType(t, &cache.Memory{}, stores.Cache)
+
+	server := miniredis.RunT(t)
+	cfg.Redis.Addr = server.Addr()
+	cfg.Cache.Disabled = true
+	stores = newBackends(cfg, hooks, pools.New(registry), logger, registry)
+	assert.NotNil(t, stores.Redis)
+	assert.Nil(t, stores.Cache)
+	ctx := context.Background()
+	assert.Nil(t, stores.Usage.Add(ctx, "key", "2026-10", apikeys.Usage{Requests: 1}))
+	assert.True(t, server.Exists("apikeys:usage:2026-10:key"))
+
+	cfg.Cache.Disabled = false
+	stores = newBackends(cfg, hooks, pools.New(registry), logger, registry)
+	assert.Nil(t, stores.Cache.Set(ctx, "key", []byte("value"), time.Minute))
+	assert.True(t, server.Exists("key"))
+
+	// Without Redis the stores fall back rather than fail.
+	server.Close()
+	_, err := stores.Cache.Get(ctx, "key")
+	assert.ErrorIs(t, err, redisguard.ErrUnavailable)
+	assert.Nil(t, stores.Usage.Add(ctx, "key", "2026-10", apikeys.Usage{Requests: 1}))
+	fallbacks := registry.Counter("redis_fallbacks_total", "", "subsystem")
+	assert.Equal(t, 1.0, fallbacks.With("cache").Value())
+	assert.Equal(t, 1.0, fallbacks.With("usage").Value())
+
+	// The client is closed with the app.
+	assert.Nil(t, hooks.Start(context.Background()))
+	assert.Nil(t, hooks.Stop(context.Background()))
+	assert.NotNil(t, stores.Redis.Ping(context.Background()).Err())
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+)
+
+var errNoHealthyBackend = errors.New("no healthy upstream")
+
+type BackendStatus struct {
+	URL       string    `json:"url"`
+	Healthy   bool      `json:"healthy"`
+	Failures  int       `json:"consecutive_failures"`
+	LastCheck time.Time `json:"last_check,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type UpstreamStatus struct {
+	Prefix   string          `json:"prefix"`
+	Backends []BackendStatus `json:"backends"`
+}
+
+type backend struct {
+	url  string
+	host string
+
+	mu        sync.Mutex
+	healthy   bool
+	failures  int
+	successes int
+	lastCheck time.Time
+	lastError string
+}
+
+// record updates the consecutive success/failure counters and flips the
+// backend's health once the configured threshold is crossed.
+func (b *backend) record(err error, hc config.HealthCheckConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastCheck = time.Now()
+	if err != nil {
+		b.lastError = err.Error()
+		b.successes = 0
+		b.failures++
+		if b.failures >= hc.UnhealthyThreshold {
+			b.healthy = false
+		}
+		return
+	}
+
+	b.lastError = ""
+	b.failures = 0
+	b.successes++
+	if b.successes >= hc.HealthyThreshold {
+		b.healthy = true
+	}
+}
+
+func (b *backend) isHealthy() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.healthy
+}
+
+func (b *backend) status() BackendStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BackendStatus{
+		URL:       b.url,
+		Healthy:   b.healthy,
+		Failures:  b.failures,
+		LastCheck: b.lastCheck,
+		LastError: b.lastError,
+	}
+}
+
+type upstream struct {
+	route    config.ProxyRoute
+	backends []*backend
+	next     atomic.Uint64
+}
+
+func newUpstream(route config.ProxyRoute) *upstream {
+	urls := route.Upstreams
+	if route.Upstream != "" {
+		urls = append([]string{route.Upstream}, urls...)
+	}
+
+	u := &upstream{route: route}
+	for _, raw := range urls {
+		b := &backend{url: strings.TrimRight(raw, "/"), healthy: true}
+		if parsed, err := url.Parse(b.url); err == nil {
+			b.host = parsed.Host
+		}
+		u.backends = append(u.backends, b)
+	}
+	return u
+}
+
+// pick returns the next healthy backend in round-robin order.
+func (u *upstream) pick() (*backend, error) {
+	n := uint64(len(u.backends))
+	start := u.next.Add(1) - 1
+	for i := uint64(0); i < n; i++ {
+		b := u.backends[(start+i)%n]
+		if b.isHealthy() {
+			return b, nil
+		}
+	}
+	return nil, errNoHealthyBackend
+}
+
+func (u *upstream) status() UpstreamStatus {
+	status := UpstreamStatus{Prefix: u.route.Prefix}
+	for _, b := range u.backends {
+		status.Backends = append(status.Backends, b.status())
+	}
+	return status
+}
+
+func checkBackend(ctx context.Context, client *httpclient.Client, b *backend, path string) error {
+	response, err := client.Get(ctx, b.url+path)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 500 {
+		return fmt.Errorf("health check returned %d", response.StatusCode)
+	}
+	return nil
+}
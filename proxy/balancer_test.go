@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func namedUpstream(name string, healthy *atomic.Bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, name)
+	}))
+}
+
+func get(t *testing.T, app *fiber.App, path string) string {
+	return testkit.Do(t, app, "GET", path, nil).String()
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	one := namedUpstream("one", &healthy)
+	defer one.Close()
+	two := namedUpstream("two", &healthy)
+	defer two.Close()
+
+	app := fiber.New()
+	New(config.ProxyConfig{
+		Timeout: time.Second,
+		Routes:  []config.ProxyRoute{{Prefix: "/svc", Upstreams: []string{one.URL, two.URL}}},
+	}, breakers, discard).Register(app.Group("/proxy"))
+
+	assert.Equal(t, "one", get(t, app, "/proxy/svc"))
+	assert.Equal(t, "two", get(t, app, "/proxy/svc"))
+	assert.Equal(t, "one", get(t, app, "/proxy/svc"))
+}
+
+func TestBalancerEjectsUnhealthyBackend(t *testing.T) {
+	var oneHealthy, twoHealthy atomic.Bool
+	oneHealthy.Store(true)
+	twoHealthy.Store(false)
+	one := namedUpstream("one", &oneHealthy)
+	defer one.Close()
+	two := namedUpstream("two", &twoHealthy)
+	defer two.Close()
+
+	p := New(config.ProxyConfig{
+		Timeout: time.Second,
+		HealthCheck: config.HealthCheckConfig{
+			Path:               "/healthz",
+			Interval:           10 * time.Millisecond,
+			Timeout:            time.Second,
+			UnhealthyThreshold: 2,
+			HealthyThreshold:   1,
+		},
+		Routes: []config.ProxyRoute{{Prefix: "/svc", Upstreams: []string{one.URL, two.URL}}},
+	}, breakers, discard)
+	app := fiber.New()
+	p.Register(app.Group("/proxy"))
+	p.Start()
+	defer p.Stop()
+
+	assert.Eventually(t, func() bool {
+		return !p.Status()[0].Backends[1].Healthy
+	}, time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "one", get(t, app, "/proxy/svc"))
+	}
+
+	twoHealthy.Store(true)
+	assert.Eventually(t, func() bool {
+		return p.Status()[0].Backends[1].Healthy
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBalancerAllBackendsDown(t *testing.T) {
+	p := New(config.ProxyConfig{
+		Timeout: time.Second,
+		Routes:  []config.ProxyRoute{{Prefix: "/svc", Upstream: "http://127.0.0.1:1"}},
+	}, breakers, discard)
+	p.upstreams[0].backends[0].healthy = false
+
+	app := fiber.New()
+	p.Register(app.Group("/proxy"))
+
+	response, err := app.Test(httptest.NewRequest("GET", "/proxy/svc", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 503, response.StatusCode)
+}
+
+func TestStatusHandler(t *testing.T) {
+	p := New(config.ProxyConfig{
+		Routes: []config.ProxyRoute{{Prefix: "/svc", Upstreams: []string{"http://a:1", "http://b:2/"}}},
+	}, breakers, discard)
+	app := fiber.New()
+	app.Get("/admin/upstreams", p.StatusHandler)
+
+	response, err := app.Test(httptest.NewRequest("GET", "/admin/upstreams", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	var statuses []UpstreamStatus
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&statuses))
+	assert.Equal(t, "/svc", statuses[0].Prefix)
+	assert.Equal(t, "http://b:2", statuses[0].Backends[1].URL)
+	assert.True(t, statuses[0].Backends[1].Healthy)
+}
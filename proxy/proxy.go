@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	fiberproxy "github.com/gofiber/fiber/v2/middleware/proxy"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/valyala/fasthttp"
+)
+
+type Proxy struct {
+	cfg       config.ProxyConfig
+	client    *fasthttp.Client
+	breakers  *httpclient.Client
+	upstreams []*upstream
+	logger    *slog.Logger
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New builds the proxy of cfg. Forwarding goes through the per-host circuit
+// breakers of breakers, shared with the app's other outbound calls.
+func New(cfg config.ProxyConfig, breakers *httpclient.Client, logger *slog.Logger) *Proxy {
+	p := &Proxy{
+		cfg:      cfg,
+		breakers: breakers,
+		logger:   logger,
+		// Responses are streamed from the upstream instead of being
+		// buffered, so large downloads don't sit in memory.
+		client: &fasthttp.Client{
+			ReadTimeout:              cfg.Timeout,
+			WriteTimeout:             cfg.Timeout,
+			StreamResponseBody:       true,
+			NoDefaultUserAgentHeader: true,
+			DisablePathNormalizing:   true,
+		},
+	}
+	for _, route := range cfg.Routes {
+		p.upstreams = append(p.upstreams, newUpstream(route))
+	}
+	return p
+}
+
+// Register mounts one catch-all route per configured upstream on router.
+func (p *Proxy) Register(router fiber.Router) {
+	for _, u := range p.upstreams {
+		handler := p.forward(u)
+		router.All(u.route.Prefix, handler)
+		router.All(u.route.Prefix+"/*", handler)
+	}
+}
+
+// Start launches the active health checks. It is a no-op when no health
+// check path is configured.
+func (p *Proxy) Start() {
+	hc := p.cfg.HealthCheck
+	if hc.Path == "" {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	// Probes neither retry nor trip a breaker: the thresholds above
+	// already decide when a backend is out.
+	client := httpclient.New(config.HTTPClientConfig{Timeout: hc.Timeout})
+
+	for _, u := range p.upstreams {
+		for _, b := range u.backends {
+			p.wg.Add(1)
+			go func(b *backend) {
+				defer p.wg.Done()
+				ticker := time.NewTicker(hc.Interval)
+				defer ticker.Stop()
+				for {
+					b.record(checkBackend(ctx, client, b, hc.Path), hc)
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+					}
+				}
+			}(b)
+		}
+	}
+}
+
+func (p *Proxy) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+func (p *Proxy) Status() []UpstreamStatus {
+	statuses := make([]UpstreamStatus, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		statuses = append(statuses, u.status())
+	}
+	return statuses
+}
+
+// StatusHandler reports the health of every backend, for the admin API.
+func (p *Proxy) StatusHandler(c *fiber.Ctx) error {
+	return c.JSON(p.Status())
+}
+
+func (p *Proxy) forward(u *upstream) fiber.Handler {
+	rewrite := strings.TrimRight(u.route.Rewrite, "/")
+
+	return func(c *fiber.Ctx) error {
+		b, err := u.pick()
+		if err != nil {
+			return fiber.NewError(fiber.StatusServiceUnavailable, err.Error())
+		}
+
+		target := b.url + rewrite + "/" + c.Params("*")
+		if query := c.Request().URI().QueryString(); len(query) > 0 {
+			target += "?" + string(query)
+		}
+
+		setForwardedHeaders(c)
+		setCorrelationHeaders(c)
+		for _, name := range u.route.RemoveRequestHeaders {
+			c.Request().Header.Del(name)
+		}
+		for name, value := range u.route.SetRequestHeaders {
+			c.Request().Header.Set(name, value)
+		}
+
+		done, err := p.breakers.Guard(b.host)
+		if err != nil {
+			p.logger.WarnContext(c.UserContext(), "proxying skipped",
+				slog.String("upstream", b.url), slog.String("error", err.Error()))
+			return fiber.ErrServiceUnavailable
+		}
+		err = fiberproxy.Do(c, target, p.client)
+		done(err == nil && c.Response().StatusCode() < fiber.StatusInternalServerError)
+		p.observe(b, err)
+		if err != nil {
+			// The error names the backend and how it failed, which is
+			// for the logs, not the client.
+			p.logger.WarnContext(c.UserContext(), "proxying failed",
+				slog.String("upstream", b.url), slog.String("error", err.Error()))
+			return fiber.ErrBadGateway
+		}
+
+		for _, name := range u.route.RemoveResponseHeaders {
+			c.Response().Header.Del(name)
+		}
+		for name, value := range u.route.SetResponseHeaders {
+			c.Response().Header.Set(name, value)
+		}
+		return nil
+	}
+}
+
+// observe feeds forwarding results into the health counters, so a dead
+// backend is ejected before the next probe. Without active checks nothing
+// would re-admit it, so passive ejection is only enabled alongside them.
+func (p *Proxy) observe(b *backend, err error) {
+	if p.cfg.HealthCheck.Path == "" {
+		return
+	}
+	b.record(err, p.cfg.HealthCheck)
+}
+
+// setCorrelationHeaders passes the request's correlation metadata on to
+// the upstream. The metadata wins over the headers the client sent, which
+// middleware such as tracing may have moved on from.
+func setCorrelationHeaders(c *fiber.Ctx) {
+	header := http.Header{}
+	correlation.Inject(correlation.Context(c), header)
+	for name := range header {
+		c.Request().Header.Set(name, header.Get(name))
+	}
+}
+
+// setForwardedHeaders adds the peer to X-Forwarded-For. The hops already
+// listed are only kept when the peer is one of the app's trusted proxies;
+// anyone else could have made them up.
+func setForwardedHeaders(c *fiber.Ctx) {
+	header := &c.Request().Header
+
+	forwardedFor := c.Context().RemoteIP().String()
+	if prior := c.Get(fiber.HeaderXForwardedFor); prior != "" && c.IsProxyTrusted() {
+		forwardedFor = prior + ", " + forwardedFor
+	}
+	header.Set(fiber.HeaderXForwardedFor, forwardedFor)
+	header.Set(fiber.HeaderXForwardedHost, c.Hostname())
+	header.Set(fiber.HeaderXForwardedProto, c.Protocol())
+	header.Set("X-Forwarded-Prefix", strings.TrimSuffix(c.Route().Path, "/*"))
+}
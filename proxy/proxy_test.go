@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/stretchr/testify/assert"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// breakers never open, for the tests that aren't about them.
+var breakers = httpclient.New(config.HTTPClientConfig{})
+
+func TestProxyRewritesPathAndHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "upstream")
+		w.Header().Set("X-Path", r.URL.RequestURI())
+		w.Header().Set("X-Got-Forwarded-For", r.Header.Get("X-Forwarded-For"))
+		w.Header().Set("X-Got-Forwarded-Prefix", r.Header.Get("X-Forwarded-Prefix"))
+		w.Header().Set("X-Got-Secret", r.Header.Get("X-Secret"))
+		w.Header().Set("X-Got-Tenant", r.Header.Get("X-Tenant"))
+		io.WriteString(w, "Hello from upstream")
+	}))
+	defer upstream.Close()
+
+	app := fiber.New()
+	New(config.ProxyConfig{
+		Timeout: time.Second,
+		Routes: []config.ProxyRoute{{
+			Prefix:                "/users",
+			Upstream:              upstream.URL + "/v1",
+			Rewrite:               "/people",
+			SetRequestHeaders:     map[string]string{"X-Tenant": "demo"},
+			RemoveRequestHeaders:  []string{"X-Secret"},
+			RemoveResponseHeaders: []string{"Server"},
+		}},
+	}, breakers, discard).Register(app.Group("/proxy"))
+
+	request := httptest.NewRequest("GET", "/proxy/users/42?expand=orders", nil)
+	request.Header.Set("X-Secret", "rahasia")
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	assert.Equal(t, "/v1/people/42?expand=orders", response.Header.Get("X-Path"))
+	assert.Equal(t, "0.0.0.0", response.Header.Get("X-Got-Forwarded-For"))
+	assert.Equal(t, "/proxy/users", response.Header.Get("X-Got-Forwarded-Prefix"))
+	assert.Equal(t, "", response.Header.Get("X-Got-Secret"))
+	assert.Equal(t, "demo", response.Header.Get("X-Got-Tenant"))
+	assert.Equal(t, "", response.Header.Get("Server"))
+
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello from upstream", string(body))
+}
+
+func TestProxyStreamsLargeResponse(t *testing.T) {
+	payload := strings.Repeat("a", 8<<20)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, payload)
+	}))
+	defer upstream.Close()
+
+	app := fiber.New()
+	New(config.ProxyConfig{
+		Timeout: time.Second,
+		Routes:  []config.ProxyRoute{{Prefix: "/files", Upstream: upstream.URL}},
+	}, breakers, discard).Register(app.Group("/proxy"))
+
+	response, err := app.Test(httptest.NewRequest("GET", "/proxy/files/big.bin", nil), -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, len(payload), len(body))
+}
+
+func TestProxyUpstreamDown(t *testing.T) {
+	logs := new(bytes.Buffer)
+	app := fiber.New()
+	New(config.ProxyConfig{
+		Timeout: time.Second,
+		Routes:  []config.ProxyRoute{{Prefix: "/down", Upstream: "http://127.0.0.1:1"}},
+	}, breakers, slog.New(slog.NewTextHandler(logs, nil))).Register(app.Group("/proxy"))
+
+	response, err := app.Test(httptest.NewRequest("GET", "/proxy/down", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 502, response.StatusCode)
+
+	// The client learns nothing about the upstream; the logs do.
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "Bad Gateway", string(body))
+	assert.Contains(t, logs.String(), "127.0.0.1:1")
+}
+
+func TestProxyCircuitBreaker(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	app := fiber.New()
+	New(config.ProxyConfig{
+		Timeout: time.Second,
+		Routes:  []config.ProxyRoute{{Prefix: "/flaky", Upstream: upstream.URL}},
+	}, httpclient.New(config.HTTPClientConfig{BreakerThreshold: 2, BreakerCooldown: time.Minute}), discard).Register(app.Group("/proxy"))
+
+	for _, status := range []int{500, 500, 503, 503} {
+		response, err := app.Test(httptest.NewRequest("GET", "/proxy/flaky", nil))
+		assert.Nil(t, err)
+		assert.Equal(t, status, response.StatusCode)
+	}
+	// Once open, the breaker keeps requests off the upstream.
+	assert.Equal(t, 2, calls)
+}
+
+func TestProxyPassesCorrelationOn(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get(correlation.HeaderRequestID)+" "+r.Header.Get(correlation.HeaderCorrelationID))
+	}))
+	defer upstream.Close()
+
+	app := fiber.New()
+	proxied := app.Group("/proxy", func(c *fiber.Ctx) error {
+		c.SetUserContext(correlation.With(c.UserContext(), correlation.Metadata{
+			correlation.HeaderRequestID:     "req-1",
+			correlation.HeaderCorrelationID: "corr-1",
+		}))
+		return c.Next()
+	})
+	New(config.ProxyConfig{
+		Timeout: time.Second,
+		Routes:  []config.ProxyRoute{{Prefix: "/users", Upstream: upstream.URL}},
+	}, breakers, discard).Register(proxied)
+
+	request := httptest.NewRequest("GET", "/proxy/users", nil)
+	request.Header.Set(correlation.HeaderRequestID, "made-up")
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "req-1 corr-1", string(body))
+}
+
+func TestProxyForwardedForFromTrustedProxies(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-Forwarded-For"))
+	}))
+	defer upstream.Close()
+
+	forwardedFor := func(trusted []string) string {
+		app := fiber.New(fiber.Config{EnableTrustedProxyCheck: true, TrustedProxies: trusted})
+		New(config.ProxyConfig{
+			Timeout: time.Second,
+			Routes:  []config.ProxyRoute{{Prefix: "/users", Upstream: upstream.URL}},
+		}, breakers, discard).Register(app.Group("/proxy"))
+
+		request := httptest.NewRequest("GET", "/proxy/users", nil)
+		request.Header.Set("X-Forwarded-For", "1.2.3.4")
+		response, err := app.Test(request)
+		assert.Nil(t, err)
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		return string(body)
+	}
+
+	// app.Test's requests come from 0.0.0.0.
+	assert.Equal(t, "0.0.0.0", forwardedFor(nil))
+	assert.Equal(t, "1.2.3.4, 0.0.0.0", forwardedFor([]string{"0.0.0.0"}))
+}
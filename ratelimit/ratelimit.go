@@ -0,0 +1,203 @@
+// Package ratelimit limits how many requests clients make, by route and by
+// the tier of the client: anonymous, a user, an admin or an API key plan.
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+)
+
+// The tiers of clients. The API keys of a plan are in the tier
+// PlanPrefix+plan.
+const (
+	Anonymous  = "anonymous"
+	User       = "user"
+	Admin      = "admin"
+	PlanPrefix = "plan:"
+)
+
+var principalKey = ctxutil.NewKey[Principal]("ratelimit_principal")
+
+// Principal is who sent a request: its tier and an ID the requests are
+// counted by, such as "user:alice" or "ip:192.0.2.1".
+type Principal struct {
+	Tier string
+	ID   string
+}
+
+// Identify tells who sent a request.
+type Identify func(c *fiber.Ctx) Principal
+
+type rule struct {
+	config.RateLimitRule
+	limit fiber.Handler
+}
+
+func (r *rule) matchesRoute(path string) bool {
+	if len(r.Routes) == 0 {
+		return true
+	}
+	for _, prefix := range r.Routes {
+		if prefix == "/" || path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) matchesTier(tier string) bool {
+	if len(r.Tiers) == 0 {
+		return true
+	}
+	for _, t := range r.Tiers {
+		if t == tier {
+			return true
+		}
+	}
+	return false
+}
+
+// Limiter applies the first rule matching a request. Its rules can be
+// replaced while it serves; the counts of the rules that keep their name
+// carry over.
+type Limiter struct {
+	identify Identify
+	storage  *memoryStorage
+	limited  *metrics.CounterVec
+	rules    atomic.Pointer[[]*rule]
+}
+
+// New limits requests by cfg.Rules, telling clients apart with identify.
+// Rejected requests are counted in http_rate_limited_total.
+func New(cfg config.RateLimitConfig, identify Identify, registry *metrics.Registry) (*Limiter, error) {
+	l := &Limiter{
+		identify: identify,
+		storage:  newMemoryStorage(),
+		limited:  registry.Counter("http_rate_limited_total", "Requests rejected by a rate limit.", "rule", "tier"),
+	}
+	if err := l.Update(cfg); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Update replaces the rules with those of cfg, unless they are invalid.
+func (l *Limiter) Update(cfg config.RateLimitConfig) error {
+	rules := make([]*rule, 0, len(cfg.Rules))
+	names := map[string]bool{}
+	for _, r := range cfg.Rules {
+		if r.Name == "" || names[r.Name] {
+			return fmt.Errorf("ratelimit: rules need distinct names, got %q", r.Name)
+		}
+		names[r.Name] = true
+		if r.Limit <= 0 {
+			return fmt.Errorf("ratelimit: rule %q needs a positive limit", r.Name)
+		}
+		for _, route := range r.Routes {
+			if !strings.HasPrefix(route, "/") {
+				return fmt.Errorf("ratelimit: rule %q has route %q, which doesn't start with /", r.Name, route)
+			}
+		}
+		for _, tier := range r.Tiers {
+			if tier != Anonymous && tier != User && tier != Admin && (!strings.HasPrefix(tier, PlanPrefix) || tier == PlanPrefix) {
+				return fmt.Errorf("ratelimit: rule %q has unknown tier %q", r.Name, tier)
+			}
+		}
+		if r.Window <= 0 {
+			r.Window = time.Minute
+		}
+		rules = append(rules, l.compile(r))
+	}
+	l.rules.Store(&rules)
+	return nil
+}
+
+func (l *Limiter) compile(r config.RateLimitRule) *rule {
+	name := r.Name
+	return &rule{RateLimitRule: r, limit: limiter.New(limiter.Config{
+		Max:        r.Limit,
+		Expiration: r.Window,
+		// The rules share the storage, so the key starts with the rule.
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return name + "|" + principalOf(c).ID
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			// The tier may point into the request, which is reused.
+			l.limited.With(name, utils.CopyString(principalOf(c).Tier)).Inc()
+			return fiber.ErrTooManyRequests
+		},
+		Storage: l.storage,
+	})}
+}
+
+// principalOf returns the principal Middleware identified the request as,
+// the zero Principal if it didn't.
+func principalOf(c *fiber.Ctx) Principal {
+	principal, _ := principalKey.Get(c)
+	return principal
+}
+
+// Rules returns the rules in effect.
+func (l *Limiter) Rules() []config.RateLimitRule {
+	rules := *l.rules.Load()
+	configured := make([]config.RateLimitRule, 0, len(rules))
+	for _, r := range rules {
+		configured = append(configured, r.RateLimitRule)
+	}
+	return configured
+}
+
+// Middleware limits the requests a rule matches, answering 429 with a
+// Retry-After header once a client is over the limit. Responses to the
+// others tell the limit, how many requests remain and when the window
+// resets in X-RateLimit-* headers. Clients are only identified for the
+// routes some rule covers.
+func (l *Limiter) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var principal *Principal
+		for _, r := range *l.rules.Load() {
+			if !r.matchesRoute(c.Path()) {
+				continue
+			}
+			if principal == nil {
+				identified := l.identify(c)
+				principal = &identified
+			}
+			if r.matchesTier(principal.Tier) {
+				principalKey.Set(c, *principal)
+				return r.limit(c)
+			}
+		}
+		return c.Next()
+	}
+}
+
+// Register adds GET / to router, listing the rules in effect.
+func (l *Limiter) Register(router fiber.Router) {
+	router.Get("/", l.rulesHandler)
+}
+
+type ruleBody struct {
+	Name   string   `json:"name"`
+	Routes []string `json:"routes"`
+	Tiers  []string `json:"tiers"`
+	Limit  int      `json:"limit"`
+	Window string   `json:"window"`
+}
+
+func (l *Limiter) rulesHandler(c *fiber.Ctx) error {
+	rules := []ruleBody{}
+	for _, r := range l.Rules() {
+		rules = append(rules, ruleBody{Name: r.Name, Routes: r.Routes, Tiers: r.Tiers, Limit: r.Limit, Window: r.Window.String()})
+	}
+	return c.JSON(fiber.Map{"rules": rules})
+}
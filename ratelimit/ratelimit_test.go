@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+// identifyByHeader takes the tier and ID from the X-Tier and X-ID headers.
+func identifyByHeader(c *fiber.Ctx) Principal {
+	return Principal{Tier: c.Get("X-Tier", Anonymous), ID: c.Get("X-ID", "ip:"+c.IP())}
+}
+
+func newApp(t *testing.T, registry *metrics.Registry, rules ...config.RateLimitRule) (*fiber.App, *Limiter) {
+	limits, err := New(config.RateLimitConfig{Rules: rules}, identifyByHeader, registry)
+	assert.Nil(t, err)
+	app := fiber.New()
+	app.Use(limits.Middleware())
+	app.Get("/*", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	return app, limits
+}
+
+func get(t *testing.T, app *fiber.App, path, tier, id string) *testkit.Response {
+	return testkit.Do(t, app, "GET", path, nil, testkit.WithHeader("X-Tier", tier), testkit.WithHeader("X-ID", id))
+}
+
+func TestRules(t *testing.T) {
+	registry := metrics.NewRegistry()
+	app, _ := newApp(t, registry,
+		config.RateLimitRule{Name: "search", Routes: []string{"/api/search"}, Limit: 1},
+		config.RateLimitRule{Name: "api-anonymous", Routes: []string{"/api"}, Tiers: []string{Anonymous}, Limit: 2},
+		config.RateLimitRule{Name: "api-pro", Routes: []string{"/api"}, Tiers: []string{"plan:pro"}, Limit: 3},
+	)
+
+	// The first matching rule applies, to every tier.
+	get(t, app, "/api/search", User, "user:alice").AssertStatus(200)
+	get(t, app, "/api/search", User, "user:alice").AssertStatus(429)
+	get(t, app, "/api/search", User, "user:bob").AssertStatus(200)
+
+	get(t, app, "/api/orders", Anonymous, "ip:192.0.2.1").AssertStatus(200).AssertHeader("X-RateLimit-Limit", "2")
+	get(t, app, "/api/orders", Anonymous, "ip:192.0.2.1").AssertStatus(200).AssertHeader("X-RateLimit-Remaining", "0")
+	response := get(t, app, "/api/orders", Anonymous, "ip:192.0.2.1").AssertStatus(429)
+	assert.NotEmpty(t, response.Header.Get("Retry-After"))
+
+	for i := 0; i < 3; i++ {
+		get(t, app, "/api/orders", "plan:pro", "key:ci").AssertStatus(200)
+	}
+	get(t, app, "/api/orders", "plan:pro", "key:ci").AssertStatus(429)
+
+	// Without a matching rule, users and other routes aren't limited.
+	for i := 0; i < 5; i++ {
+		get(t, app, "/api/orders", User, "user:alice").AssertStatus(200)
+		get(t, app, "/apiary", Anonymous, "ip:192.0.2.1").AssertStatus(200)
+	}
+
+	output := new(strings.Builder)
+	registry.Write(output)
+	assert.Contains(t, output.String(), `http_rate_limited_total{rule="search",tier="user"} 1`)
+	assert.Contains(t, output.String(), `http_rate_limited_total{rule="api-anonymous",tier="anonymous"} 1`)
+	assert.Contains(t, output.String(), `http_rate_limited_total{rule="api-pro",tier="plan:pro"} 1`)
+}
+
+func TestUpdate(t *testing.T) {
+	app, limits := newApp(t, metrics.NewRegistry(),
+		config.RateLimitRule{Name: "api", Routes: []string{"/api"}, Limit: 2},
+	)
+	get(t, app, "/api/orders", User, "user:alice").AssertStatus(200)
+
+	// A rule that keeps its name keeps its counts.
+	assert.Nil(t, limits.Update(config.RateLimitConfig{Rules: []config.RateLimitRule{
+		{Name: "api", Routes: []string{"/api"}, Limit: 2},
+		{Name: "web", Routes: []string{"/web"}, Tiers: []string{User}, Limit: 1},
+	}}))
+	get(t, app, "/api/orders", User, "user:alice").AssertStatus(200)
+	get(t, app, "/api/orders", User, "user:alice").AssertStatus(429)
+	get(t, app, "/web", User, "user:alice").AssertStatus(200)
+	get(t, app, "/web", User, "user:alice").AssertStatus(429)
+
+	// Invalid rules leave those in effect as they are.
+	for _, invalid := range []config.RateLimitRule{
+		{Name: "", Limit: 1},
+		{Name: "zero"},
+		{Name: "relative", Routes: []string{"api"}, Limit: 1},
+		{Name: "tier", Tiers: []string{"guest"}, Limit: 1},
+		{Name: "plan", Tiers: []string{"plan:"}, Limit: 1},
+	} {
+		assert.NotNil(t, limits.Update(config.RateLimitConfig{Rules: []config.RateLimitRule{invalid}}), invalid.Name)
+	}
+	assert.NotNil(t, limits.Update(config.RateLimitConfig{Rules: []config.RateLimitRule{{Name: "a", Limit: 1}, {Name: "a", Limit: 1}}}))
+	assert.Len(t, limits.Rules(), 2)
+
+	assert.Nil(t, limits.Update(config.RateLimitConfig{}))
+	get(t, app, "/api/orders", User, "user:alice").AssertStatus(200)
+}
+
+func TestRegister(t *testing.T) {
+	_, limits := newApp(t, metrics.NewRegistry(), config.RateLimitRule{Name: "api", Routes: []string{"/api"}, Limit: 10})
+	admin := fiber.New()
+	limits.Register(admin)
+	testkit.Do(t, admin, "GET", "/", nil).AssertStatus(200).
+		AssertJSON(`{"rules":[{"name":"api","routes":["/api"],"tiers":null,"limit":10,"window":"1m0s"}]}`)
+}
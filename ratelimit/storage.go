@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// memoryStorage is the fiber.Storage the counts of all rules are kept in.
+// Expired entries are dropped by Set, at most once a minute, rather than
+// by a goroutine of their own.
+type memoryStorage struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	nextSweep time.Time
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{now: time.Now, entries: map[string]memoryEntry{}}
+}
+
+func (s *memoryStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || !entry.expires.IsZero() && !s.now().Before(entry.expires) {
+		return nil, nil
+	}
+	return entry.value, nil
+}
+
+func (s *memoryStorage) Set(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.After(s.nextSweep) {
+		for k, entry := range s.entries {
+			if !entry.expires.IsZero() && !now.Before(entry.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.nextSweep = now.Add(time.Minute)
+	}
+	entry := memoryEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expires = now.Add(ttl)
+	}
+	s.entries[key] = entry
+	return nil
+}
+
+func (s *memoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *memoryStorage) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = map[string]memoryEntry{}
+	return nil
+}
+
+func (s *memoryStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,127 @@
+package record
+
+import (
+	"log/slog"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/redact"
+)
+
+const (
+	defaultDumpBody = 4 << 10
+	defaultDumpFor  = 15 * time.Minute
+	maxDumpFor      = 24 * time.Hour
+)
+
+// Dumper logs the requests to paths matching a pattern set at runtime, with
+// their responses, redacted like recordings. Dumping stops by itself after
+// a while, so it isn't left on by mistake.
+type Dumper struct {
+	redactor *redact.Redactor
+	logger   *slog.Logger
+	now      func() time.Time
+	rule     atomic.Pointer[dumpRule]
+}
+
+type dumpRule struct {
+	pattern *regexp.Regexp
+	maxBody int
+	until   time.Time
+}
+
+type dumpBody struct {
+	Pattern  string     `json:"pattern"`
+	MaxBody  int        `json:"max_body,omitempty"`
+	Duration string     `json:"duration,omitempty"`
+	Until    *time.Time `json:"until,omitempty"`
+}
+
+func NewDumper(redactor *redact.Redactor, logger *slog.Logger) *Dumper {
+	return &Dumper{redactor: redactor, logger: logger, now: time.Now}
+}
+
+// Middleware dumps the matching requests that pass it. Errors of later
+// handlers are handled here, so the response dumped is the one sent.
+func (d *Dumper) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		rule := d.rule.Load()
+		if rule == nil || !rule.pattern.MatchString(c.Path()) {
+			return c.Next()
+		}
+		if d.now().After(rule.until) {
+			d.rule.CompareAndSwap(rule, nil)
+			return c.Next()
+		}
+
+		request := requestMessage(c, d.redactor, rule.maxBody)
+		handle(c)
+		d.logger.LogAttrs(c.UserContext(), slog.LevelInfo, "dump",
+			slog.Any("request", request),
+			slog.Any("response", responseMessage(c, d.redactor, rule.maxBody)),
+		)
+		return nil
+	}
+}
+
+// Register adds GET, PUT and DELETE /dump, to see, set and clear what is
+// dumped. PUT takes a body like
+//
+//	{"pattern": "^/api/orders", "max_body": 4096, "duration": "10m"}
+//
+// where the pattern is a regular expression for paths, bodies are cut off
+// at max_body bytes, and dumping stops after duration, at most a day.
+func (d *Dumper) Register(router fiber.Router) {
+	router.Get("/dump", d.getHandler)
+	router.Put("/dump", d.putHandler)
+	router.Delete("/dump", d.deleteHandler)
+}
+
+func (d *Dumper) getHandler(c *fiber.Ctx) error {
+	rule := d.rule.Load()
+	if rule == nil || d.now().After(rule.until) {
+		return c.JSON(dumpBody{})
+	}
+	return c.JSON(dumpBody{Pattern: rule.pattern.String(), MaxBody: rule.maxBody, Until: &rule.until})
+}
+
+func (d *Dumper) putHandler(c *fiber.Ctx) error {
+	var body dumpBody
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	pattern, err := regexp.Compile(body.Pattern)
+	if err != nil || body.Pattern == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "pattern must be a regular expression")
+	}
+	if body.MaxBody < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "max_body can't be negative")
+	}
+	if body.MaxBody == 0 {
+		body.MaxBody = defaultDumpBody
+	}
+	duration := defaultDumpFor
+	if body.Duration != "" {
+		duration, err = time.ParseDuration(body.Duration)
+		if err != nil || duration <= 0 || duration > maxDumpFor {
+			return fiber.NewError(fiber.StatusBadRequest, "duration must be positive and at most 24h")
+		}
+	}
+
+	rule := &dumpRule{pattern: pattern, maxBody: body.MaxBody, until: d.now().Add(duration)}
+	d.rule.Store(rule)
+	d.logger.InfoContext(c.UserContext(), "dumping requests",
+		slog.String("pattern", body.Pattern),
+		slog.Time("until", rule.until),
+	)
+	return c.JSON(dumpBody{Pattern: body.Pattern, MaxBody: rule.maxBody, Until: &rule.until})
+}
+
+func (d *Dumper) deleteHandler(c *fiber.Ctx) error {
+	if d.rule.Swap(nil) != nil {
+		d.logger.InfoContext(c.UserContext(), "stopped dumping requests")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
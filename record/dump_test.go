@@ -0,0 +1,82 @@
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/redact"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumper(t *testing.T) {
+	var logs bytes.Buffer
+	dumper := NewDumper(redactor, slog.New(slog.NewJSONHandler(&logs, nil)))
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	dumper.now = func() time.Time { return now }
+
+	app := fiber.New()
+	app.Use(dumper.Middleware())
+	dumper.Register(app.Group("/debug"))
+	app.Post("/api/orders", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": "1", "payment_token": "tok_123"})
+	})
+	app.Get("/api/orders/:id", func(c *fiber.Ctx) error { return fiber.ErrNotFound })
+	app.Get("/health", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	dumps := func() []map[string]any {
+		var entries []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+			var entry map[string]any
+			if line != "" && json.Unmarshal([]byte(line), &entry) == nil && entry["msg"] == "dump" {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+
+	testkit.Do(t, app, "GET", "/health", nil).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/debug/dump", nil).AssertJSON(`{"pattern": ""}`)
+	assert.Empty(t, dumps())
+
+	testkit.DoJSON(t, app, "PUT", "/debug/dump", map[string]any{"pattern": "^/api/", "max_body": 20, "duration": "10m"}, nil).
+		AssertStatus(200).
+		AssertJSON(`{"pattern": "^/api/", "max_body": 20, "until": "2024-05-01T08:10:00Z"}`)
+	testkit.Do(t, app, "GET", "/health", nil).AssertStatus(200)
+	testkit.DoJSON(t, app, "POST", "/api/orders", map[string]any{"sku": "kopi", "password": "hunter2"}, nil,
+		testkit.WithAuth("secret-token")).AssertStatus(201)
+	testkit.Do(t, app, "GET", "/api/orders/2", nil).AssertStatus(404).AssertBody("Not Found")
+
+	entries := dumps()
+	assert.Len(t, entries, 2)
+	request := entries[0]["request"].(map[string]any)
+	response := entries[0]["response"].(map[string]any)
+	assert.Equal(t, "POST", request["method"])
+	assert.Equal(t, `{"password":"[REDACT`, request["body"])
+	assert.Equal(t, true, request["truncated"])
+	assert.Equal(t, []any{redact.Redacted}, request["header"].(map[string]any)["Authorization"])
+	assert.Equal(t, float64(201), response["status"])
+	assert.Equal(t, `{"id":"1","payment_t`, response["body"])
+	assert.NotContains(t, logs.String(), "hunter2")
+	assert.NotContains(t, logs.String(), "secret-token")
+	assert.Equal(t, float64(404), entries[1]["response"].(map[string]any)["status"])
+
+	// Dumping stops on its own, or when told to.
+	now = now.Add(11 * time.Minute)
+	testkit.Do(t, app, "GET", "/api/orders/2", nil).AssertStatus(404)
+	assert.Len(t, dumps(), 2)
+	testkit.Do(t, app, "GET", "/debug/dump", nil).AssertJSON(`{"pattern": ""}`)
+
+	testkit.DoJSON(t, app, "PUT", "/debug/dump", map[string]any{"pattern": "/api"}, nil).AssertStatus(200)
+	testkit.Do(t, app, "DELETE", "/debug/dump", nil).AssertStatus(204)
+	testkit.Do(t, app, "GET", "/api/orders/2", nil).AssertStatus(404)
+	assert.Len(t, dumps(), 2)
+
+	testkit.DoJSON(t, app, "PUT", "/debug/dump", map[string]any{"pattern": "("}, nil).AssertStatus(400)
+	testkit.DoJSON(t, app, "PUT", "/debug/dump", map[string]any{"pattern": "/api", "duration": "48h"}, nil).AssertStatus(400)
+}
@@ -0,0 +1,176 @@
+// Package record records the requests an app serves together with its
+// responses, redacted, so a bug seen in development can be reproduced by
+// replaying them.
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/redact"
+)
+
+// Exchange is a recorded request and the response it got. User is the
+// authenticated user, whose credentials are not recorded, and Scopes the
+// scopes they granted.
+type Exchange struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user,omitempty"`
+	Scopes   []string  `json:"scopes,omitempty"`
+	Request  Message   `json:"request"`
+	Response Message   `json:"response"`
+}
+
+// Message is a request or a response. Method and URI are only set for
+// requests, Status only for responses. Bodies that aren't text are left
+// out, noted in Omitted, and long ones are cut off at the recorder's limit.
+type Message struct {
+	Method    string              `json:"method,omitempty"`
+	URI       string              `json:"uri,omitempty"`
+	Status    int                 `json:"status,omitempty"`
+	Header    map[string][]string `json:"header,omitempty"`
+	Body      string              `json:"body,omitempty"`
+	Omitted   string              `json:"omitted,omitempty"`
+	Truncated bool                `json:"truncated,omitempty"`
+}
+
+// Recorder writes every exchange to its own JSON file in a directory.
+type Recorder struct {
+	dir      string
+	maxBody  int
+	redactor *redact.Redactor
+	logger   *slog.Logger
+	now      func() time.Time
+	seq      atomic.Int64
+}
+
+// New records into dir, creating it if needed, leaving out what redactor
+// redacts. Bodies are kept up to maxBody bytes.
+func New(dir string, maxBody int, redactor *redact.Redactor, logger *slog.Logger) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("record: %w", err)
+	}
+	return &Recorder{dir: dir, maxBody: maxBody, redactor: redactor, logger: logger, now: time.Now}, nil
+}
+
+// Middleware records the requests that pass it. Errors of later handlers
+// are handled here, so the response recorded is the one sent.
+func (r *Recorder) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		exchange := Exchange{Time: r.now(), Request: requestMessage(c, r.redactor, r.maxBody)}
+		handle(c)
+		exchange.User = ctxutil.CurrentUser(c)
+		exchange.Scopes = ctxutil.Scopes(c)
+		exchange.Response = responseMessage(c, r.redactor, r.maxBody)
+
+		// A failing recording must not fail the request.
+		if err := r.write(&exchange); err != nil {
+			r.logger.Warn("recording the request failed", slog.String("error", err.Error()))
+		}
+		return nil
+	}
+}
+
+// handle runs the next handlers, handling their error so the response is
+// final.
+func handle(c *fiber.Ctx) {
+	if err := c.Next(); err != nil {
+		if err := c.App().ErrorHandler(c, err); err != nil {
+			c.Status(fiber.StatusInternalServerError)
+		}
+	}
+}
+
+func requestMessage(c *fiber.Ctx, redactor *redact.Redactor, maxBody int) Message {
+	request := c.Request()
+	m := Message{
+		Method: c.Method(),
+		URI:    redactor.URI(string(request.RequestURI())),
+		Header: redactor.Headers(requestHeader(c)),
+	}
+	setBody(&m, redactor, string(request.Header.ContentType()), request.Body(), maxBody)
+	return m
+}
+
+func responseMessage(c *fiber.Ctx, redactor *redact.Redactor, maxBody int) Message {
+	response := c.Response()
+	m := Message{
+		Status: response.StatusCode(),
+		Header: redactor.Headers(responseHeader(c)),
+	}
+	setBody(&m, redactor, string(response.Header.ContentType()), response.Body(), maxBody)
+	return m
+}
+
+func setBody(m *Message, redactor *redact.Redactor, contentType string, body []byte, maxBody int) {
+	if len(body) == 0 {
+		return
+	}
+	if !textual(contentType) {
+		m.Omitted = fmt.Sprintf("%d bytes of %s", len(body), contentType)
+		return
+	}
+	// Cut off after redacting, as a cut off body may no longer parse.
+	m.Body = redactor.Body(contentType, string(body))
+	if len(m.Body) > maxBody {
+		m.Body, m.Truncated = m.Body[:maxBody], true
+	}
+}
+
+func (r *Recorder) write(exchange *Exchange) error {
+	data, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%06d-%s.json", exchange.Time.UTC().Format("20060102T150405.000"), r.seq.Add(1), slug(exchange.Request))
+	return os.WriteFile(filepath.Join(r.dir, name), data, 0o600)
+}
+
+var unsafeName = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slug names the file of a request after its method and path, as in
+// "get-api-orders".
+func slug(request Message) string {
+	path, _, _ := strings.Cut(request.URI, "?")
+	name := strings.Trim(unsafeName.ReplaceAllString(strings.ToLower(request.Method+" "+path), "-"), "-")
+	if len(name) > 60 {
+		name = name[:60]
+	}
+	return name
+}
+
+func textual(contentType string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return mediaType == "" ||
+		strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") ||
+		mediaType == fiber.MIMEApplicationForm ||
+		mediaType == fiber.MIMEApplicationJavaScript
+}
+
+func requestHeader(c *fiber.Ctx) map[string][]string {
+	header := map[string][]string{}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		header[string(key)] = append(header[string(key)], string(value))
+	})
+	return header
+}
+
+func responseHeader(c *fiber.Ctx) map[string][]string {
+	header := map[string][]string{}
+	c.Response().Header.VisitAll(func(key, value []byte) {
+		header[string(key)] = append(header[string(key)], string(value))
+	})
+	return header
+}
@@ -0,0 +1,122 @@
+package record
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/redact"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+var redactor = redact.New(config.Default().Log.Redact)
+
+func newApp(t *testing.T, maxBody int) (*fiber.App, string) {
+	dir := t.TempDir()
+	recorder, err := New(dir, maxBody, redactor, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	assert.Nil(t, err)
+	app := fiber.New()
+	app.Use(recorder.Middleware())
+	app.Use(testkit.FakeAuth)
+	app.Post("/login", func(c *fiber.Ctx) error {
+		c.Cookie(&fiber.Cookie{Name: "session", Value: "s3cret"})
+		return c.JSON(fiber.Map{"access_token": "abc", "user": fiber.Map{"id": 12345678901234567}})
+	})
+	app.Get("/orders/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") != "1" {
+			return fiber.ErrNotFound
+		}
+		return c.JSON(fiber.Map{"id": "1", "status": "created"})
+	})
+	app.Post("/avatar", func(c *fiber.Ctx) error {
+		return c.SendString(strings.Repeat("x", 200))
+	})
+	return app, dir
+}
+
+func recorded(t *testing.T, dir string) []*Exchange {
+	exchanges, err := LoadAll(dir)
+	assert.Nil(t, err)
+	return exchanges
+}
+
+func TestMiddleware(t *testing.T) {
+	app, dir := newApp(t, 100)
+
+	testkit.Do(t, app, "POST", "/login?next=/home&token=t0k", strings.NewReader(`{"email": "alice@example.com", "password": "hunter2"}`),
+		testkit.WithHeader("Content-Type", "application/json"),
+		testkit.WithAuth("jwt"),
+		testkit.WithUser("alice")).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/orders/2", nil).AssertStatus(404)
+	testkit.Do(t, app, "POST", "/avatar", strings.NewReader("\x89PNG"), testkit.WithHeader("Content-Type", "image/png")).AssertStatus(200)
+
+	exchanges := recorded(t, dir)
+	assert.Len(t, exchanges, 3)
+
+	login := exchanges[0]
+	assert.Equal(t, "alice", login.User)
+	assert.Equal(t, "POST", login.Request.Method)
+	assert.Equal(t, "/login?next=%2Fhome&token=%5BREDACTED%5D", login.Request.URI)
+	assert.Equal(t, []string{redact.Redacted}, login.Request.Header["Authorization"])
+	assert.Equal(t, []string{"alice"}, login.Request.Header["X-User"])
+	assert.Equal(t, `{"email":"alice@example.com","password":"[REDACTED]"}`, login.Request.Body)
+	assert.Equal(t, 200, login.Response.Status)
+	assert.Equal(t, []string{redact.Redacted}, login.Response.Header["Set-Cookie"])
+	assert.Equal(t, `{"access_token":"[REDACTED]","user":{"id":12345678901234567}}`, login.Response.Body)
+
+	notFound := exchanges[1]
+	assert.Equal(t, 404, notFound.Response.Status)
+	assert.Equal(t, "Not Found", notFound.Response.Body)
+
+	avatar := exchanges[2]
+	assert.Equal(t, "4 bytes of image/png", avatar.Request.Omitted)
+	assert.Empty(t, avatar.Request.Body)
+	assert.Equal(t, strings.Repeat("x", 100), avatar.Response.Body)
+	assert.True(t, avatar.Response.Truncated)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(files[0], "-000001-post-login.json"), files[0])
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		assert.Nil(t, err)
+		for _, secret := range []string{"hunter2", "s3cret", "t0k", "Bearer jwt", `"abc"`} {
+			assert.NotContains(t, string(data), secret)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	app, dir := newApp(t, 1<<10)
+	testkit.Do(t, app, "GET", "/orders/1", nil, testkit.WithAuth("jwt")).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/orders/2", nil).AssertStatus(404)
+	exchanges := recorded(t, dir)
+
+	var authorization []string
+	prepare := func(request *http.Request, exchange *Exchange) {
+		authorization = append(authorization, request.Header.Get("Authorization"))
+	}
+	for _, exchange := range exchanges {
+		result, err := Replay(app, exchange, redactor, prepare)
+		assert.Nil(t, err)
+		assert.Empty(t, result.Problems)
+	}
+	// The redacted token isn't sent.
+	assert.Equal(t, []string{"", ""}, authorization)
+
+	exchanges[1].Request.URI = "/orders/1"
+	result, err := Replay(app, exchanges[1], redactor, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, result.Status)
+	assert.Equal(t, []string{
+		"status: recorded 404, got 200",
+		`body: recorded "Not Found", got "{\"id\":\"1\",\"status\":\"created\"}"`,
+	}, result.Problems)
+}
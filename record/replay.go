@@ -0,0 +1,114 @@
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/redact"
+)
+
+// Load reads the recorded exchange in the file at path.
+func Load(path string) (*Exchange, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("record: %w", err)
+	}
+	var exchange Exchange
+	if err := json.Unmarshal(data, &exchange); err != nil {
+		return nil, fmt.Errorf("record: %s: %w", path, err)
+	}
+	return &exchange, nil
+}
+
+// LoadAll reads the exchanges in paths, taking the *.json files of the
+// paths that are directories, in the order they were recorded.
+func LoadAll(paths ...string) ([]*Exchange, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("record: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("record: %w", err)
+		}
+		// The names start with the time they were recorded.
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	exchanges := make([]*Exchange, 0, len(files))
+	for _, file := range files {
+		exchange, err := Load(file)
+		if err != nil {
+			return nil, err
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges, nil
+}
+
+// Result is how a replayed exchange went. Problems lists how the response
+// differs from the recorded one.
+type Result struct {
+	Exchange *Exchange
+	Status   int
+	Body     string
+	Problems []string
+}
+
+// Replay sends the request of exchange to app. The body is sent as it was
+// recorded, secrets redacted. Redacted headers aren't sent; prepare, if
+// not nil, can put credentials in their place, for instance a token for
+// exchange.User. The response is redacted with redactor before it is
+// compared to the recorded one.
+func Replay(app *fiber.App, exchange *Exchange, redactor *redact.Redactor, prepare func(*http.Request, *Exchange)) (*Result, error) {
+	recorded := exchange.Request
+	request := httptest.NewRequest(recorded.Method, recorded.URI, strings.NewReader(recorded.Body))
+	for name, values := range recorded.Header {
+		if len(values) == 1 && values[0] == redact.Redacted || strings.EqualFold(name, fiber.HeaderContentLength) {
+			continue
+		}
+		for _, value := range values {
+			request.Header.Add(name, value)
+		}
+	}
+	if prepare != nil {
+		prepare(request, exchange)
+	}
+
+	response, err := app.Test(request, -1)
+	if err != nil {
+		return nil, fmt.Errorf("record: replaying %s %s: %w", recorded.Method, recorded.URI, err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("record: replaying %s %s: %w", recorded.Method, recorded.URI, err)
+	}
+
+	result := &Result{Exchange: exchange, Status: response.StatusCode, Body: string(body)}
+	expected := exchange.Response
+	if response.StatusCode != expected.Status {
+		result.Problems = append(result.Problems, fmt.Sprintf("status: recorded %d, got %d", expected.Status, response.StatusCode))
+	}
+	if expected.Omitted == "" && !expected.Truncated {
+		got := redactor.Body(response.Header.Get(fiber.HeaderContentType), string(body))
+		if got != expected.Body {
+			result.Problems = append(result.Problems, fmt.Sprintf("body: recorded %q, got %q", expected.Body, got))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,160 @@
+// Package redact keeps credentials and other secrets out of logs and
+// recordings.
+package redact
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+)
+
+// Redacted replaces the values left out.
+const Redacted = "[REDACTED]"
+
+// Redactor redacts the headers and the fields of bodies and queries that
+// hold secrets.
+type Redactor struct {
+	headers map[string]bool
+	fields  []string
+}
+
+func New(cfg config.RedactConfig) *Redactor {
+	r := &Redactor{headers: map[string]bool{}}
+	for _, name := range cfg.Headers {
+		r.headers[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, field := range cfg.Fields {
+		r.fields = append(r.fields, strings.ToLower(field))
+	}
+	return r
+}
+
+// Header reports whether the header name holds a secret.
+func (r *Redactor) Header(name string) bool {
+	return r.headers[http.CanonicalHeaderKey(name)]
+}
+
+// Field reports whether the field or query parameter name holds a secret,
+// that is whether its name includes one of the configured fields,
+// regardless of case.
+func (r *Redactor) Field(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range r.fields {
+		if strings.Contains(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers returns header with the values of secret headers redacted.
+func (r *Redactor) Headers(header map[string][]string) map[string][]string {
+	redacted := make(map[string][]string, len(header))
+	for name, values := range header {
+		if r.Header(name) {
+			values = []string{Redacted}
+		}
+		redacted[name] = values
+	}
+	return redacted
+}
+
+// URI redacts the secret query parameters of uri, such as the token of an
+// email verification link. A uri without any is returned as it is.
+func (r *Redactor) URI(uri string) string {
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return path + "?" + Redacted
+	}
+	if !r.values(values) {
+		return uri
+	}
+	return path + "?" + values.Encode()
+}
+
+// Body redacts the secret fields of a JSON or form body. Other bodies, and
+// those without secrets, are returned as they are.
+func (r *Redactor) Body(contentType, body string) string {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	switch mediaType = strings.TrimSpace(mediaType); {
+	case strings.HasSuffix(mediaType, "json"):
+		decoder := json.NewDecoder(strings.NewReader(body))
+		decoder.UseNumber()
+		var value any
+		if decoder.Decode(&value) != nil || !r.json(value) {
+			return body
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return Redacted
+		}
+		return string(data)
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(body)
+		if err != nil {
+			return Redacted
+		}
+		if !r.values(values) {
+			return body
+		}
+		return values.Encode()
+	}
+	return body
+}
+
+// ReplaceAttr is a slog.HandlerOptions.ReplaceAttr that redacts attributes
+// named like a secret header or field, and the queries of "url" and "uri"
+// attributes.
+func (r *Redactor) ReplaceAttr(_ []string, a slog.Attr) slog.Attr {
+	switch {
+	case r.Field(a.Key) || r.Header(a.Key):
+		return slog.String(a.Key, Redacted)
+	case (a.Key == "url" || a.Key == "uri") && a.Value.Kind() == slog.KindString:
+		return slog.String(a.Key, r.URI(a.Value.String()))
+	}
+	return a
+}
+
+// values redacts the secrets in values, reporting whether there were any.
+func (r *Redactor) values(values url.Values) bool {
+	redacted := false
+	for name := range values {
+		if r.Field(name) {
+			values[name] = []string{Redacted}
+			redacted = true
+		}
+	}
+	return redacted
+}
+
+// json redacts the secrets in the decoded JSON value in place, reporting
+// whether there were any.
+func (r *Redactor) json(value any) bool {
+	redacted := false
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if r.Field(key) {
+				v[key] = Redacted
+				redacted = true
+			} else if r.json(field) {
+				redacted = true
+			}
+		}
+	case []any:
+		for _, element := range v {
+			if r.json(element) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,57 @@
+package redact
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactor(t *testing.T) {
+	r := New(config.Default().Log.Redact)
+
+	assert.True(t, r.Header("authorization"))
+	assert.True(t, r.Header("X-API-KEY"))
+	assert.False(t, r.Header("Content-Type"))
+	assert.True(t, r.Field("New_Password"))
+	assert.True(t, r.Field("client_secret"))
+	assert.False(t, r.Field("country_code"))
+
+	assert.Equal(t, map[string][]string{"Cookie": {Redacted}, "Accept": {"*/*"}},
+		r.Headers(map[string][]string{"Cookie": {"a=1", "b=2"}, "Accept": {"*/*"}}))
+
+	assert.Equal(t, "/verify?next=%2Fhome&token=%5BREDACTED%5D", r.URI("/verify?token=t0k&next=/home"))
+	assert.Equal(t, "/orders?b=2&a=1", r.URI("/orders?b=2&a=1"))
+	assert.Equal(t, "/orders", r.URI("/orders"))
+}
+
+func TestRedactBody(t *testing.T) {
+	r := New(config.Default().Log.Redact)
+
+	assert.Equal(t, "card_number=%5BREDACTED%5D&country_code=ID&new_password=%5BREDACTED%5D",
+		r.Body("application/x-www-form-urlencoded; charset=utf-8", "card_number=4111&country_code=ID&new_password=x"))
+	assert.Equal(t, `[{"client_secret":"[REDACTED]","id":12345678901234567,"name":"kopi"}]`,
+		r.Body("application/json", `[{"name": "kopi", "id": 12345678901234567, "client_secret": "s"}]`))
+	// Bodies without secrets are kept as they were sent.
+	assert.Equal(t, `{"name": "kopi"}`, r.Body("application/json", `{"name": "kopi"}`))
+	assert.Equal(t, `{"broken`, r.Body("application/json", `{"broken`))
+	assert.Equal(t, "password=x", r.Body("text/plain", "password=x"))
+}
+
+func TestConfiguredLists(t *testing.T) {
+	r := New(config.RedactConfig{Headers: []string{"X-Tenant-Key"}, Fields: []string{"pin"}})
+
+	assert.True(t, r.Header("x-tenant-key"))
+	assert.False(t, r.Header("Authorization"))
+	assert.Equal(t, "password=x&pin=%5BREDACTED%5D", r.Body("application/x-www-form-urlencoded", "pin=1234&password=x"))
+}
+
+func TestReplaceAttr(t *testing.T) {
+	r := New(config.Default().Log.Redact)
+
+	assert.Equal(t, slog.String("Set-Cookie", Redacted), r.ReplaceAttr(nil, slog.String("Set-Cookie", "session=1")))
+	assert.Equal(t, slog.String("access_token", Redacted), r.ReplaceAttr(nil, slog.Int("access_token", 1)))
+	assert.Equal(t, slog.String("url", "/x?token=%5BREDACTED%5D"), r.ReplaceAttr(nil, slog.String("url", "/x?token=1")))
+	assert.Equal(t, slog.String("path", "/x?token=1"), r.ReplaceAttr(nil, slog.String("path", "/x?token=1")))
+}
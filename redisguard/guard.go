@@ -0,0 +1,133 @@
+// Package redisguard keeps the app serving while Redis is unreachable. The
+// stores on top of Redis are wrapped so that, from the first connection
+// error until Redis answers a PING again, they fall back instead of
+// failing requests: the cache is bypassed and API-key usage is counted in
+// memory. Each fallback is counted in redis_fallbacks_total by subsystem
+// and redis_up says whether Redis is reachable.
+package redisguard
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrUnavailable is returned by the cache while Redis is down.
+var ErrUnavailable = errors.New("redisguard: redis unavailable")
+
+// Guard tracks whether Redis is reachable. After an outage it probes
+// Redis in the background, so requests don't wait on a dead connection to
+// find out.
+type Guard struct {
+	client     redis.UniversalClient
+	logger     *slog.Logger
+	probeEvery time.Duration
+	fallbacks  *metrics.CounterVec
+
+	down     atomic.Bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	probes   sync.WaitGroup
+}
+
+func New(client redis.UniversalClient, logger *slog.Logger, registry *metrics.Registry) *Guard {
+	g := &Guard{
+		client:     client,
+		logger:     logger,
+		probeEvery: time.Second,
+		fallbacks:  registry.Counter("redis_fallbacks_total", "Operations served without Redis while it was unavailable, by subsystem.", "subsystem"),
+		stop:       make(chan struct{}),
+	}
+	registry.GaugeFunc("redis_up", "Whether Redis is reachable, 0 while the stores on it fall back.", func() float64 {
+		if g.Up() {
+			return 1
+		}
+		return 0
+	})
+	return g
+}
+
+// Up reports whether Redis is reachable, as far as the guard knows.
+func (g *Guard) Up() bool {
+	return !g.down.Load()
+}
+
+// Skip reports whether subsystem should skip Redis because it is down,
+// counting the fallback.
+func (g *Guard) Skip(subsystem string) bool {
+	if g.Up() {
+		return false
+	}
+	g.fallbacks.With(subsystem).Inc()
+	return true
+}
+
+// Failed reports whether err, of a Redis command of subsystem, means Redis
+// is unreachable, and then marks it down and counts the fallback. Answers
+// of a working Redis, such as redis.Nil, aren't failures.
+func (g *Guard) Failed(subsystem string, err error) bool {
+	if !outage(err) {
+		return false
+	}
+	g.markDown(err)
+	g.fallbacks.With(subsystem).Inc()
+	return true
+}
+
+// Stop stops probing; it is called on shutdown.
+func (g *Guard) Stop() {
+	g.stopOnce.Do(func() { close(g.stop) })
+	g.probes.Wait()
+}
+
+func (g *Guard) markDown(err error) {
+	select {
+	case <-g.stop:
+		return
+	default:
+	}
+	if !g.down.CompareAndSwap(false, true) {
+		return
+	}
+	g.logger.Warn("redis unavailable, falling back until it answers again", slog.String("error", err.Error()))
+	g.probes.Add(1)
+	go g.probe()
+}
+
+// probe pings Redis until it answers, then marks it up again.
+func (g *Guard) probe() {
+	defer g.probes.Done()
+	ticker := time.NewTicker(g.probeEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), g.probeEvery)
+		err := g.client.Ping(ctx).Err()
+		cancel()
+		if err == nil {
+			g.down.Store(false)
+			g.logger.Info("redis available again")
+			return
+		}
+	}
+}
+
+// outage tells errors of an unreachable Redis from answers of a working
+// one and from callers giving up.
+func outage(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var answer redis.Error
+	return !errors.As(err, &answer)
+}
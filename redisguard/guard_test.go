@@ -0,0 +1,115 @@
+package redisguard
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/apikeys"
+	"github.com/jalal-akbar/belajar-golang-fiber/cache"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newGuard(t *testing.T) (*Guard, *redis.Client, *miniredis.Miniredis, *metrics.Registry) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), DialTimeout: 100 * time.Millisecond, MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	registry := metrics.NewRegistry()
+	guard := New(client, slog.New(slog.NewTextHandler(io.Discard, nil)), registry)
+	guard.probeEvery = 10 * time.Millisecond
+	t.Cleanup(guard.Stop)
+	return guard, client, server, registry
+}
+
+func fallbacks(registry *metrics.Registry, subsystem string) float64 {
+	return registry.Counter("redis_fallbacks_total", "", "subsystem").With(subsystem).Value()
+}
+
+func TestCacheOutage(t *testing.T) {
+	guard, client, server, registry := newGuard(t)
+	aside := cache.NewAside[string](Cache(guard, cache.NewRedis(client)), "greetings", time.Minute, registry)
+	ctx := context.Background()
+	loads := 0
+	load := func(context.Context) (string, error) {
+		loads++
+		return "halo", nil
+	}
+
+	value, err := aside.Get(ctx, "id", load)
+	assert.Nil(t, err)
+	assert.Equal(t, "halo", value)
+	_, err = aside.Get(ctx, "id", load)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, loads)
+
+	// Redis goes away: lookups still succeed, from the source.
+	server.Close()
+	value, err = aside.Get(ctx, "id", load)
+	assert.Nil(t, err)
+	assert.Equal(t, "halo", value)
+	assert.False(t, guard.Up())
+	// Later lookups don't wait on Redis any more.
+	start := time.Now()
+	_, err = aside.Get(ctx, "id", load)
+	assert.Nil(t, err)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, 3, loads)
+	assert.GreaterOrEqual(t, fallbacks(registry, "cache"), 2.0)
+	assert.ErrorIs(t, aside.Invalidate(ctx, "id"), ErrUnavailable)
+
+	// It comes back: the probe notices and caching resumes.
+	assert.Nil(t, server.Restart())
+	assert.Eventually(t, guard.Up, time.Second, 10*time.Millisecond)
+	_, err = aside.Get(ctx, "id", load)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, loads)
+}
+
+func TestUsageOutage(t *testing.T) {
+	guard, client, server, registry := newGuard(t)
+	usage := Usage(guard, apikeys.NewRedisUsage(client), apikeys.NewMemoryUsage())
+	ctx := context.Background()
+
+	assert.Nil(t, usage.Add(ctx, "key", "2026-10", apikeys.Usage{Requests: 1, Bytes: 10}))
+	got, err := usage.Get(ctx, "key", "2026-10")
+	assert.Nil(t, err)
+	assert.Equal(t, apikeys.Usage{Requests: 1, Bytes: 10}, got)
+
+	server.Close()
+	assert.Nil(t, usage.Add(ctx, "key", "2026-10", apikeys.Usage{Requests: 1, Bytes: 5}))
+	got, err = usage.Get(ctx, "key", "2026-10")
+	assert.Nil(t, err)
+	assert.Equal(t, apikeys.Usage{Requests: 1, Bytes: 5}, got)
+	assert.Equal(t, 2.0, fallbacks(registry, "usage"))
+
+	// Back on Redis, which kept what it had.
+	assert.Nil(t, server.Restart())
+	assert.Eventually(t, guard.Up, time.Second, 10*time.Millisecond)
+	got, err = usage.Get(ctx, "key", "2026-10")
+	assert.Nil(t, err)
+	assert.Equal(t, apikeys.Usage{Requests: 1, Bytes: 10}, got)
+}
+
+func TestFailed(t *testing.T) {
+	guard, _, _, registry := newGuard(t)
+	assert.False(t, guard.Failed("cache", nil))
+	assert.False(t, guard.Failed("cache", redis.Nil))
+	assert.False(t, guard.Failed("cache", context.Canceled))
+	assert.False(t, guard.Failed("cache", errors.Join(errors.New("set"), redisError("WRONGTYPE Operation against a key holding the wrong kind of value"))))
+	assert.True(t, guard.Up())
+	assert.Equal(t, 0.0, fallbacks(registry, "cache"))
+
+	assert.True(t, guard.Failed("cache", errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")))
+	assert.False(t, guard.Up())
+}
+
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+func (redisError) RedisError()     {}
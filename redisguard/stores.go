@@ -0,0 +1,91 @@
+package redisguard
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/apikeys"
+	"github.com/jalal-akbar/belajar-golang-fiber/cache"
+)
+
+type cacheStore struct {
+	guard *Guard
+	store cache.Store
+}
+
+// Cache wraps a cache store on Redis so that it fails fast with
+// ErrUnavailable while Redis is down; cache.Aside then bypasses it and
+// loads values from their source. Invalidations missed during the outage
+// leave entries stale until their TTL runs out.
+func Cache(g *Guard, store cache.Store) cache.Store {
+	return &cacheStore{guard: g, store: store}
+}
+
+func (c *cacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if c.guard.Skip("cache") {
+		return nil, ErrUnavailable
+	}
+	data, err := c.store.Get(ctx, key)
+	if !errors.Is(err, cache.ErrMiss) && c.guard.Failed("cache", err) {
+		return nil, ErrUnavailable
+	}
+	return data, err
+}
+
+func (c *cacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if c.guard.Skip("cache") {
+		return ErrUnavailable
+	}
+	err := c.store.Set(ctx, key, value, ttl)
+	if c.guard.Failed("cache", err) {
+		return ErrUnavailable
+	}
+	return err
+}
+
+func (c *cacheStore) Delete(ctx context.Context, keys ...string) error {
+	if c.guard.Skip("cache") {
+		return ErrUnavailable
+	}
+	err := c.store.Delete(ctx, keys...)
+	if c.guard.Failed("cache", err) {
+		return ErrUnavailable
+	}
+	return err
+}
+
+type usageStore struct {
+	guard    *Guard
+	primary  apikeys.UsageStore
+	fallback apikeys.UsageStore
+}
+
+// Usage wraps an API-key usage store on Redis so that usage is kept in
+// fallback while Redis is down. Quotas are then enforced per instance on
+// the usage since the outage began, and that usage isn't added to Redis
+// once it is back: an outage lets keys through rather than locking them
+// out.
+func Usage(g *Guard, primary, fallback apikeys.UsageStore) apikeys.UsageStore {
+	return &usageStore{guard: g, primary: primary, fallback: fallback}
+}
+
+func (u *usageStore) Get(ctx context.Context, key, month string) (apikeys.Usage, error) {
+	if !u.guard.Skip("usage") {
+		usage, err := u.primary.Get(ctx, key, month)
+		if !u.guard.Failed("usage", err) {
+			return usage, err
+		}
+	}
+	return u.fallback.Get(ctx, key, month)
+}
+
+func (u *usageStore) Add(ctx context.Context, key, month string, usage apikeys.Usage) error {
+	if !u.guard.Skip("usage") {
+		err := u.primary.Add(ctx, key, month, usage)
+		if !u.guard.Failed("usage", err) {
+			return err
+		}
+	}
+	return u.fallback.Add(ctx, key, month, usage)
+}
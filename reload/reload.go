@@ -0,0 +1,153 @@
+// Package reload watches the configuration file and takes over the values
+// that can change while the app serves, without restarting its listeners.
+package reload
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+)
+
+// EventType is the type of the event published when the configuration
+// changed. Its "changed" data lists the sections that did, separated by
+// commas.
+const EventType = "config.changed"
+
+// settle is how long the file has to stay unchanged before it is read, as
+// saving a file takes editors several writes.
+const settle = 100 * time.Millisecond
+
+// Watcher keeps the configuration the app runs with.
+type Watcher struct {
+	bus    *events.Bus
+	logger *slog.Logger
+	load   func() (*config.Config, error)
+
+	mu      sync.Mutex
+	current *config.Config
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// New starts out with cfg and reloads with config.Load. Changes are
+// published on bus.
+func New(cfg *config.Config, bus *events.Bus, logger *slog.Logger) *Watcher {
+	return &Watcher{bus: bus, logger: logger, load: config.Load, current: cfg}
+}
+
+// Config returns the configuration in effect.
+func (w *Watcher) Config() *config.Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Reload reads the configuration again and takes over the sections that
+// can change while serving, publishing an event if any did. It returns
+// those, and whether others changed too, which takes a restart. An invalid
+// configuration changes nothing.
+func (w *Watcher) Reload(ctx context.Context) (changed []string, restart bool, err error) {
+	next, err := w.load()
+	if err != nil {
+		return nil, false, err
+	}
+	w.mu.Lock()
+	var reloaded *config.Config
+	reloaded, changed, restart = w.current.Reload(next)
+	w.current = reloaded
+	w.mu.Unlock()
+
+	if restart {
+		w.logger.Warn("some configuration changes take a restart")
+	}
+	if len(changed) > 0 {
+		w.logger.Info("configuration reloaded", slog.String("changed", strings.Join(changed, ",")))
+		w.bus.Publish(ctx, events.Event{Type: EventType, Data: map[string]string{"changed": strings.Join(changed, ",")}})
+	}
+	return changed, restart, nil
+}
+
+// Handler reloads the configuration on request, answering with what
+// changed.
+func (w *Watcher) Handler(c *fiber.Ctx) error {
+	changed, restart, err := w.Reload(c.UserContext())
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+	if changed == nil {
+		changed = []string{}
+	}
+	return c.JSON(fiber.Map{"changed": changed, "restart_needed": restart})
+}
+
+// On calls apply with the configuration whenever section changed. Errors
+// are logged, as there is no one else to tell.
+func (w *Watcher) On(section string, apply func(cfg *config.Config) error) {
+	w.bus.Subscribe(EventType, func(ctx context.Context, event events.Event) {
+		for _, changed := range strings.Split(event.Data["changed"], ",") {
+			if changed != section {
+				continue
+			}
+			if err := apply(w.Config()); err != nil {
+				w.logger.Warn("applying the configuration failed", slog.String("section", section), slog.String("error", err.Error()))
+			}
+			return
+		}
+	})
+}
+
+// Start reloads whenever the file at path changes. The directory is
+// watched rather than the file, as editors and Kubernetes replace files
+// instead of writing them in place.
+func (w *Watcher) Start(path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	w.stop, w.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(w.done)
+		defer watcher.Close()
+		timer := time.NewTimer(settle)
+		timer.Stop()
+		for {
+			select {
+			case event := <-watcher.Events:
+				// Kubernetes swaps the ..data link of mounted config maps.
+				if filepath.Clean(event.Name) == path || filepath.Base(event.Name) == "..data" {
+					timer.Reset(settle)
+				}
+			case err := <-watcher.Errors:
+				w.logger.Warn("watching the configuration failed", slog.String("error", err.Error()))
+			case <-timer.C:
+				if _, _, err := w.Reload(context.Background()); err != nil {
+					w.logger.Warn("reloading the configuration failed", slog.String("error", err.Error()))
+				}
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops watching.
+func (w *Watcher) Stop() {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+	}
+}
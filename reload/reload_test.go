@@ -0,0 +1,75 @@
+package reload
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, path, yaml string) {
+	assert.Nil(t, os.WriteFile(path, []byte(yaml), 0o600))
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "log:\n  level: info\n")
+	t.Setenv("CONFIG_FILE", path)
+	cfg, err := config.Load()
+	assert.Nil(t, err)
+
+	bus := events.NewBus()
+	var mu sync.Mutex
+	var levels []string
+	var published []events.Event
+	bus.Subscribe(EventType, func(ctx context.Context, event events.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		published = append(published, event)
+	})
+	watcher := New(cfg, bus, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	watcher.On(config.SectionLogLevel, func(cfg *config.Config) error {
+		mu.Lock()
+		defer mu.Unlock()
+		levels = append(levels, cfg.Log.Level)
+		return nil
+	})
+	assert.Nil(t, watcher.Start(path))
+	defer watcher.Stop()
+
+	writeConfig(t, path, "log:\n  level: debug\naddr: localhost:4000\n")
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(levels) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"debug"}, levels)
+	assert.Equal(t, "log.level", published[0].Data["changed"])
+	// The address takes a restart.
+	assert.Equal(t, "localhost:3000", watcher.Config().Addr)
+
+	// An invalid file changes nothing.
+	writeConfig(t, path, "log: [")
+	changed, _, err := watcher.Reload(context.Background())
+	assert.NotNil(t, err)
+	assert.Empty(t, changed)
+	assert.Equal(t, "debug", watcher.Config().Log.Level)
+
+	// Nor does one with only changes that take a restart.
+	writeConfig(t, path, "log:\n  level: debug\naddr: localhost:5000\n")
+	changed, restart, err := watcher.Reload(context.Background())
+	assert.Nil(t, err)
+	assert.Empty(t, changed)
+	assert.True(t, restart)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, published, 1)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/record"
+	"github.com/jalal-akbar/belajar-golang-fiber/redact"
+)
+
+// replay sends the requests recorded in paths, files or directories, to an
+// app built from cfg and writes how their responses compare to the
+// recorded ones to w. It reports whether they all matched.
+//
+// Credentials aren't recorded: requests of an authenticated user get a
+// token for that user with the scopes recorded, and others that had an Authorization header get the
+// admin token.
+func replay(cfg *config.Config, paths []string, w io.Writer) (bool, error) {
+	exchanges, err := record.LoadAll(paths...)
+	if err != nil {
+		return false, err
+	}
+
+	cfg.Debug.RecordDir = ""
+	app, err := newApp(cfg)
+	if err != nil {
+		return false, err
+	}
+	defer app.Shutdown()
+	var tokens *auth.Tokens
+	if len(cfg.JWT.KeyFiles) > 0 {
+		if tokens, err = auth.New(cfg.JWT, nil, nil); err != nil {
+			return false, err
+		}
+	}
+	prepare := func(request *http.Request, exchange *record.Exchange) {
+		switch {
+		case exchange.User != "" && tokens != nil:
+			token, err := tokens.Sign(exchange.User, exchange.Scopes...)
+			if err == nil {
+				request.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+			}
+		case len(exchange.Request.Header[fiber.HeaderAuthorization]) > 0 && cfg.Admin.Token != "":
+			request.Header.Set(fiber.HeaderAuthorization, "Bearer "+cfg.Admin.Token)
+		}
+	}
+
+	redactor := redact.New(cfg.Log.Redact)
+	matched := 0
+	for _, exchange := range exchanges {
+		result, err := record.Replay(app, exchange, redactor, prepare)
+		if err != nil {
+			return false, err
+		}
+		request := exchange.Request.Method + " " + exchange.Request.URI
+		if len(result.Problems) == 0 {
+			matched++
+			fmt.Fprintf(w, "ok    %s %d\n", request, result.Status)
+			continue
+		}
+		fmt.Fprintf(w, "FAIL  %s\n", request)
+		for _, problem := range result.Problems {
+			fmt.Fprintf(w, "      %s\n", problem)
+		}
+	}
+	fmt.Fprintf(w, "%d of %d responses matched\n", matched, len(exchanges))
+	return matched == len(exchanges), nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/orders"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+	cfg.Database.SQLitePath = filepath.Join(dir, "app.db")
+	cfg.Debug.RecordDir = filepath.Join(dir, "recordings")
+	app, err := newApp(cfg)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	tokens, err := auth.New(cfg.JWT, nil, nil)
+	assert.Nil(t, err)
+	token, err := tokens.Sign("alice", userScopes...)
+	assert.Nil(t, err)
+
+	var order orders.Order
+	testkit.DoJSON(t, app, "POST", "/api/orders", map[string]any{
+		"items": []map[string]any{{"sku": "kopi", "quantity": 1, "price": 15000}},
+	}, &order, testkit.WithAuth(token)).AssertStatus(201)
+	testkit.Do(t, app, "GET", "/api/orders/"+order.ID, nil, testkit.WithAuth(token)).AssertStatus(200)
+	testkit.Do(t, app, "GET", "/api/orders/missing", nil, testkit.WithAuth(token)).AssertStatus(404)
+	assert.Nil(t, app.Shutdown())
+
+	// A fresh app on the same database gets the same answers, except for
+	// the order created again under a new ID.
+	var out bytes.Buffer
+	matched, err := replay(cfg, []string{cfg.Debug.RecordDir}, &out)
+	assert.Nil(t, err)
+	assert.False(t, matched)
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, "FAIL  POST /api/orders", lines[0])
+	assert.Contains(t, lines[1], "body: recorded")
+	assert.Equal(t, []string{
+		"ok    GET /api/orders/" + order.ID + " 200",
+		"ok    GET /api/orders/missing 404",
+		"2 of 3 responses matched",
+		"",
+	}, lines[2:])
+}
@@ -0,0 +1,169 @@
+package reporting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+)
+
+// sensitiveHeaders are replaced by "[Filtered]" before an event leaves the
+// process.
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+}
+
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"filename"`
+	Line     int    `json:"lineno"`
+}
+
+// Event is an unexpected error together with the request it happened in.
+type Event struct {
+	Time      time.Time
+	Err       error
+	Stack     []Frame
+	Method    string
+	URL       string
+	Route     string
+	UserID    string
+	RequestID string
+	Headers   map[string]string
+}
+
+type Reporter interface {
+	Report(ctx context.Context, event Event)
+}
+
+// NewEvent captures the request context of c for err.
+func NewEvent(c *fiber.Ctx, err error) Event {
+	event := Event{
+		Time:      time.Now(),
+		Err:       err,
+		Method:    c.Method(),
+		URL:       c.BaseURL() + c.OriginalURL(),
+		Route:     c.Route().Path,
+		RequestID: correlation.RequestID(c.UserContext()),
+		Headers:   map[string]string{},
+	}
+	event.UserID = ctxutil.CurrentUser(c)
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		name := string(key)
+		if sensitiveHeaders[strings.ToLower(name)] {
+			event.Headers[name] = "[Filtered]"
+			return
+		}
+		event.Headers[name] = string(value)
+	})
+	return event
+}
+
+// LogReporter writes events to the log. It is used when no error tracker is
+// configured.
+type LogReporter struct {
+	Logger *slog.Logger
+}
+
+func (r LogReporter) Report(ctx context.Context, event Event) {
+	attrs := []slog.Attr{
+		slog.String("error", event.Err.Error()),
+		slog.String("method", event.Method),
+		slog.String("url", event.URL),
+		slog.String("route", event.Route),
+	}
+	if event.UserID != "" {
+		attrs = append(attrs, slog.String("user_id", event.UserID))
+	}
+	if len(event.Stack) > 0 {
+		top := event.Stack[len(event.Stack)-1]
+		attrs = append(attrs, slog.String("at", fmt.Sprintf("%s (%s:%d)", top.Function, top.File, top.Line)))
+	}
+	r.Logger.LogAttrs(ctx, slog.LevelError, "unhandled error", attrs...)
+}
+
+// ErrorHandler is the app's central error handler. Errors created with
+// fiber.NewError are answered with their status and message, and unique
+// constraint violations with a 409 naming the field, calls the database
+// breaker turned away with a 503 and Retry-After; anything else is
+// reported and answered with a bare 500, so internal details don't leak
+// to clients.
+func ErrorHandler(reporter Reporter) fiber.ErrorHandler {
+	return func(c *fiber.Ctx, err error) error {
+		var fiberErr *fiber.Error
+		var conflict *database.ConflictError
+		var unavailable *database.UnavailableError
+		switch {
+		case errors.As(err, &fiberErr):
+		case errors.As(err, &conflict):
+			fiberErr = fiber.NewError(fiber.StatusConflict, conflict.Field+" already exists")
+		case errors.As(err, &unavailable):
+			// The database is failing, which the breaker already logged.
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(unavailable.RetryAfter.Seconds()))))
+			fiberErr = fiber.ErrServiceUnavailable
+		default:
+			reporter.Report(c.UserContext(), NewEvent(c, err))
+			fiberErr = fiber.ErrInternalServerError
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.Status(fiberErr.Code).SendString(fiberErr.Message)
+	}
+}
+
+// Recover turns a panic into a reported event with the panicking goroutine's
+// stack, and a 500 for the client.
+func Recover(reporter Reporter) fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				panicErr, ok := r.(error)
+				if !ok {
+					panicErr = fmt.Errorf("%v", r)
+				}
+				event := NewEvent(c, fmt.Errorf("panic: %w", panicErr))
+				// Skip runtime.Callers, stack, this function and runtime.gopanic.
+				event.Stack = stack(4)
+				reporter.Report(c.UserContext(), event)
+				err = fiber.ErrInternalServerError
+			}
+		}()
+		return c.Next()
+	}
+}
+
+// Stack returns the frames of its caller's stack, oldest first, without
+// the innermost skip ones, for events of panics recovered outside Recover.
+func Stack(skip int) []Frame {
+	return stack(skip + 3)
+}
+
+// stack returns the caller frames, oldest first, as Sentry expects them.
+func stack(skip int) []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var result []Frame
+	for {
+		frame, more := frames.Next()
+		result = append([]Frame{{Function: frame.Function, File: frame.File, Line: frame.Line}}, result...)
+		if !more {
+			break
+		}
+	}
+	return result
+}
@@ -0,0 +1,144 @@
+package reporting
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Report(ctx context.Context, event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func newTestApp(reporter Reporter) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler(reporter)})
+	app.Use(Recover(reporter))
+	app.Get("/panic/:id", func(c *fiber.Ctx) error {
+		ctxutil.SetCurrentUser(c, "jalal")
+		panic("boom")
+	})
+	app.Get("/error", func(c *fiber.Ctx) error {
+		return errors.New("database password is rahasia")
+	})
+	app.Get("/teapot", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusTeapot, "I'm a teapot")
+	})
+	app.Get("/conflict", func(c *fiber.Ctx) error {
+		return fmt.Errorf("register: %w", &database.ConflictError{Table: "users", Field: "username", Err: errors.New(`duplicate key value violates unique constraint "users_username_key"`)})
+	})
+	app.Get("/unavailable", func(c *fiber.Ctx) error {
+		return fmt.Errorf("get order: %w", &database.UnavailableError{RetryAfter: 2500 * time.Millisecond})
+	})
+	return app
+}
+
+func TestRecoverReportsPanic(t *testing.T) {
+	reporter := &recorder{}
+	app := newTestApp(reporter)
+
+	request := httptest.NewRequest("GET", "/panic/1", nil)
+	request.Header.Set("Authorization", "Bearer rahasia")
+	request.Header.Set("Accept", "text/plain")
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	assert.Equal(t, 500, response.StatusCode)
+
+	assert.Len(t, reporter.events, 1)
+	event := reporter.events[0]
+	assert.Equal(t, "panic: boom", event.Err.Error())
+	assert.Equal(t, "/panic/:id", event.Route)
+	assert.Equal(t, "jalal", event.UserID)
+	assert.Equal(t, "[Filtered]", event.Headers["Authorization"])
+	assert.Equal(t, "text/plain", event.Headers["Accept"])
+	assert.Contains(t, event.Stack[len(event.Stack)-1].Function, "newTestApp")
+}
+
+func TestErrorHandlerHidesInternalErrors(t *testing.T) {
+	reporter := &recorder{}
+	app := newTestApp(reporter)
+
+	testkit.Do(t, app, "GET", "/error", nil).AssertStatus(500).AssertBody("Internal Server Error")
+	assert.Len(t, reporter.events, 1)
+
+	testkit.Do(t, app, "GET", "/teapot", nil).AssertStatus(418).AssertBody("I'm a teapot")
+	assert.Len(t, reporter.events, 1)
+
+	// Duplicates are the client's doing and name only the field.
+	testkit.Do(t, app, "GET", "/conflict", nil).AssertStatus(409).AssertBody("username already exists")
+	assert.Len(t, reporter.events, 1)
+
+	// The breaker logged why; the client is told when to come back.
+	testkit.Do(t, app, "GET", "/unavailable", nil).AssertStatus(503).AssertHeader("Retry-After", "3").AssertBody("Service Unavailable")
+	assert.Len(t, reporter.events, 1)
+}
+
+func TestSentryEnvelope(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	lines := make(chan []string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			body = append(body, scanner.Text())
+		}
+		received <- r
+		lines <- body
+	}))
+	defer server.Close()
+
+	sentry, err := NewSentry(config.SentryConfig{
+		DSN:         strings.Replace(server.URL, "http://", "http://publickey@", 1) + "/42",
+		Environment: "test",
+	}, httpclient.New(config.HTTPClientConfig{Timeout: time.Second}), slog.Default())
+	assert.Nil(t, err)
+
+	app := newTestApp(sentry)
+	_, err = app.Test(httptest.NewRequest("GET", "/panic/7", nil))
+	assert.Nil(t, err)
+	assert.Nil(t, sentry.Close())
+
+	request := <-received
+	assert.Equal(t, "/api/42/envelope/", request.URL.Path)
+	assert.Contains(t, request.Header.Get("X-Sentry-Auth"), "sentry_key=publickey")
+
+	body := <-lines
+	assert.Len(t, body, 3)
+	assert.Equal(t, `{"type":"event"}`, body[1])
+
+	var event map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(body[2]), &event))
+	assert.Equal(t, "test", event["environment"])
+	assert.Equal(t, "GET /panic/:id", event["transaction"])
+	assert.Equal(t, map[string]interface{}{"id": "jalal"}, event["user"])
+	exception := event["exception"].(map[string]interface{})["values"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "panic: boom", exception["value"])
+}
+
+func TestInvalidSentryDSN(t *testing.T) {
+	_, err := NewSentry(config.SentryConfig{DSN: "http://sentry.example.com/"}, nil, slog.Default())
+	assert.NotNil(t, err)
+}
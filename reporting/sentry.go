@@ -0,0 +1,204 @@
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+)
+
+// Sentry sends events to a Sentry-compatible server (Sentry, GlitchTip, …)
+// through its envelope endpoint. Events are queued and sent in the
+// background; when the queue is full new events are dropped and logged.
+type Sentry struct {
+	endpoint    string
+	auth        string
+	environment string
+	release     string
+	serverName  string
+	client      *httpclient.Client
+	logger      *slog.Logger
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan sentryEvent
+	done   chan struct{}
+}
+
+func NewSentry(cfg config.SentryConfig, client *httpclient.Client, logger *slog.Logger) (*Sentry, error) {
+	dsn, err := url.Parse(cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	key := dsn.User.Username()
+	project := path.Base(dsn.Path)
+	if key == "" || project == "." || project == "/" {
+		return nil, fmt.Errorf("reporting: invalid sentry DSN")
+	}
+	prefix := strings.TrimSuffix(path.Dir(dsn.Path), "/")
+
+	hostname, _ := os.Hostname()
+	s := &Sentry{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/envelope/", dsn.Scheme, dsn.Host, prefix, project),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=belajar-golang-fiber/1.0, sentry_key=%s", key),
+		environment: cfg.Environment,
+		release:     cfg.Release,
+		serverName:  hostname,
+		client:      client,
+		logger:      logger,
+		queue:       make(chan sentryEvent, 100),
+		done:        make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *Sentry) Report(ctx context.Context, event Event) {
+	payload := s.payload(event)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- payload:
+	default:
+		s.logger.WarnContext(ctx, "sentry queue full, dropping event", slog.String("error", event.Err.Error()))
+	}
+}
+
+// Close sends the queued events and stops the background sender.
+func (s *Sentry) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.done
+	return nil
+}
+
+func (s *Sentry) run() {
+	defer close(s.done)
+	for event := range s.queue {
+		if err := s.send(event); err != nil {
+			s.logger.Warn("sending event to sentry failed", slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (s *Sentry) send(event sentryEvent) error {
+	body := new(bytes.Buffer)
+	encoder := json.NewEncoder(body)
+	encoder.Encode(map[string]string{"event_id": event.EventID, "sent_at": time.Now().UTC().Format(time.RFC3339)})
+	encoder.Encode(map[string]string{"type": "event"})
+	if err := encoder.Encode(event); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-sentry-envelope")
+	request.Header.Set("X-Sentry-Auth", s.auth)
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("sentry returned %d", response.StatusCode)
+	}
+	return nil
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Transaction string            `json:"transaction,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	User        map[string]string `json:"user,omitempty"`
+	Request     sentryRequest     `json:"request"`
+	Exception   struct {
+		Values []sentryException `json:"values"`
+	} `json:"exception"`
+}
+
+type sentryRequest struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryStacktrace struct {
+	Frames []Frame `json:"frames"`
+}
+
+func (s *Sentry) payload(event Event) sentryEvent {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	payload := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   event.Time.UTC().Format(time.RFC3339Nano),
+		Platform:    "go",
+		Level:       "error",
+		Environment: s.environment,
+		Release:     s.release,
+		ServerName:  s.serverName,
+		Transaction: event.Method + " " + event.Route,
+		Tags:        map[string]string{"route": event.Route},
+		Request: sentryRequest{
+			URL:     event.URL,
+			Method:  event.Method,
+			Headers: event.Headers,
+		},
+	}
+	if event.RequestID != "" {
+		payload.Tags["request_id"] = event.RequestID
+	}
+	if event.UserID != "" {
+		payload.User = map[string]string{"id": event.UserID}
+	}
+
+	exception := sentryException{
+		Type:  reflect.TypeOf(event.Err).String(),
+		Value: event.Err.Error(),
+	}
+	if len(event.Stack) > 0 {
+		exception.Stacktrace = &sentryStacktrace{Frames: event.Stack}
+	}
+	payload.Exception.Values = []sentryException{exception}
+	return payload
+}
@@ -0,0 +1,36 @@
+package routing
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CanonicalPaths redirects requests for paths with a trailing slash or
+// repeated slashes, such as /api/orders/ or /api//orders, to the canonical
+// path with a 308, keeping the query. Unlike a 301, a 308 makes clients
+// repeat the method and body, so it is safe for POSTs too.
+func CanonicalPaths() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		path := string(c.Request().URI().PathOriginal())
+		canonical := canonicalPath(path)
+		// Browsers read a Location of /\host as //host, another site.
+		if canonical == path || strings.Contains(path, "\\") {
+			return c.Next()
+		}
+		if query := c.Request().URI().QueryString(); len(query) > 0 {
+			canonical += "?" + string(query)
+		}
+		return c.Redirect(canonical, fiber.StatusPermanentRedirect)
+	}
+}
+
+func canonicalPath(path string) string {
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
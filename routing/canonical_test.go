@@ -0,0 +1,35 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalPaths(t *testing.T) {
+	app := fiber.New(fiber.Config{StrictRouting: true})
+	app.Use(CanonicalPaths())
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("home") })
+	app.Get("/api/users", func(c *fiber.Ctx) error { return c.SendString("users") })
+
+	testkit.Do(t, app, "GET", "/", nil).AssertStatus(200).AssertBody("home")
+	testkit.Do(t, app, "GET", "/api/users", nil).AssertStatus(200).AssertBody("users")
+	testkit.Do(t, app, "GET", "/api/users/", nil).AssertStatus(308).AssertHeader("Location", "/api/users")
+	testkit.Do(t, app, "POST", "/api//users/?page=2", nil).AssertStatus(308).AssertHeader("Location", "/api/users?page=2")
+	testkit.Do(t, app, "GET", `/\evil.example/`, nil).AssertStatus(404)
+}
+
+func TestCanonicalPath(t *testing.T) {
+	for path, canonical := range map[string]string{
+		"/":              "/",
+		"//":             "/",
+		"/api/users":     "/api/users",
+		"/api/users/":    "/api/users",
+		"/api///users//": "/api/users",
+		"//evil.example": "/evil.example",
+	} {
+		assert.Equal(t, canonical, canonicalPath(path), path)
+	}
+}
@@ -0,0 +1,166 @@
+// Package routing handles the requests that don't quite match a route.
+package routing
+
+import (
+	"errors"
+	"html/template"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+const maxSuggestions = 3
+
+var notFoundPage = template.Must(template.New("").Parse(`<!doctype html>
+<html lang="en">
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{- if .Suggestions}}
+<p>Did you mean:</p>
+<ul>
+{{- range .Suggestions}}
+<li><a href="{{.}}">{{.}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+
+// Fallback answers the requests no route of app handles, registered after
+// all of them with app.Use. A path that routes only take with other methods
+// gets a 405 with an Allow header listing those; any other gets a 404
+// suggesting the routes with paths close to the one asked for. Both are
+// JSON, except under htmlPrefix, where they are pages.
+func Fallback(app *fiber.App, htmlPrefix string) fiber.Handler {
+	var (
+		once  sync.Once
+		paths []string
+	)
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		var fiberErr *fiber.Error
+		if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusNotFound && fiberErr.Code != fiber.StatusMethodNotAllowed {
+			return err
+		}
+		// Routes are only read once all have been added.
+		once.Do(func() { paths = routePaths(app) })
+
+		status := fiberErr.Code
+		message := "Cannot " + c.Method() + " " + c.Path()
+		var suggestions []string
+		if status == fiber.StatusNotFound {
+			suggestions = suggest(paths, c.Path())
+		} else {
+			message += "; allowed: " + string(c.Response().Header.Peek(fiber.HeaderAllow))
+		}
+
+		c.Status(status)
+		if htmlPrefix != "" && (c.Path() == htmlPrefix || strings.HasPrefix(c.Path(), strings.TrimSuffix(htmlPrefix, "/")+"/")) {
+			c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+			return notFoundPage.Execute(c.Response().BodyWriter(), map[string]any{
+				"Title":       utils.StatusMessage(status),
+				"Message":     message,
+				"Suggestions": suggestions,
+			})
+		}
+		body := fiber.Map{"error": message}
+		if status == fiber.StatusNotFound {
+			body["suggestions"] = suggestions
+		}
+		return c.JSON(body)
+	}
+}
+
+// routePaths lists the distinct paths of the routes of app, without the
+// middleware.
+func routePaths(app *fiber.App) []string {
+	seen := map[string]bool{}
+	var paths []string
+	for _, route := range app.GetRoutes(true) {
+		if !seen[route.Path] {
+			seen[route.Path] = true
+			paths = append(paths, route.Path)
+		}
+	}
+	return paths
+}
+
+// suggest returns the paths closest to path, a few edits away at most.
+// Parameters of a route take the value path has in their place, so the
+// suggestions are paths that can be requested.
+func suggest(routes []string, path string) []string {
+	type candidate struct {
+		path     string
+		distance int
+	}
+	limit := max(2, len(path)/4)
+	seen := map[string]bool{}
+	var candidates []candidate
+	for _, route := range routes {
+		concrete := fill(route, path)
+		if seen[concrete] {
+			continue
+		}
+		seen[concrete] = true
+		if distance := levenshtein(strings.ToLower(concrete), strings.ToLower(path)); distance <= limit {
+			candidates = append(candidates, candidate{concrete, distance})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].path < candidates[j].path
+	})
+	suggestions := []string{}
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, candidates[i].path)
+	}
+	return suggestions
+}
+
+// fill replaces the parameters of route with the segments of path in their
+// place. A wildcard takes the rest of path.
+func fill(route, path string) string {
+	routeSegments := strings.Split(route, "/")
+	pathSegments := strings.Split(path, "/")
+	for i, segment := range routeSegments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			if i < len(pathSegments) {
+				routeSegments[i] = pathSegments[i]
+			}
+		case segment == "*" || segment == "+":
+			if i < len(pathSegments) {
+				return strings.Join(append(routeSegments[:i], pathSegments[i:]...), "/")
+			}
+		}
+	}
+	return strings.Join(routeSegments, "/")
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func newApp() *fiber.App {
+	app := fiber.New()
+	app.Use("/api", func(c *fiber.Ctx) error {
+		c.Set("X-API", "yes")
+		return c.Next()
+	})
+	app.Get("/api/orders", func(c *fiber.Ctx) error { return c.SendString("orders") })
+	app.Post("/api/orders", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusCreated) })
+	app.Get("/api/orders/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") != "1" {
+			return fiber.ErrNotFound
+		}
+		return c.SendString("order 1")
+	})
+	app.Delete("/api/orders/:id", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) })
+	app.Get("/web/orders", func(c *fiber.Ctx) error { return c.SendString("<h1>Orders</h1>") })
+	app.Use(Fallback(app, "/web"))
+	return app
+}
+
+func TestFallback(t *testing.T) {
+	app := newApp()
+
+	testkit.Do(t, app, "GET", "/api/orders", nil).AssertStatus(200).AssertBody("orders")
+	testkit.Do(t, app, "GET", "/api/ordrs", nil).AssertStatus(404).
+		AssertHeader("X-API", "yes").
+		AssertJSON(`{"error": "Cannot GET /api/ordrs", "suggestions": ["/api/orders"]}`)
+	testkit.Do(t, app, "GET", "/api/order/7", nil).AssertStatus(404).
+		AssertJSON(`{"error": "Cannot GET /api/order/7", "suggestions": ["/api/orders/7", "/api/orders"]}`)
+	testkit.Do(t, app, "GET", "/nothing/like/it", nil).AssertStatus(404).
+		AssertJSON(`{"error": "Cannot GET /nothing/like/it", "suggestions": []}`)
+
+	testkit.Do(t, app, "PATCH", "/api/orders", nil).AssertStatus(405).
+		AssertHeader("Allow", "GET, HEAD, POST").
+		AssertJSON(`{"error": "Cannot PATCH /api/orders; allowed: GET, HEAD, POST"}`)
+	testkit.Do(t, app, "PUT", "/api/orders/1", nil).AssertStatus(405).
+		AssertHeader("Allow", "GET, HEAD, DELETE")
+
+	// Handlers' own 404s are left to the error handler.
+	testkit.Do(t, app, "GET", "/api/orders/2", nil).AssertStatus(404).AssertBody("Not Found")
+}
+
+func TestFallbackHTML(t *testing.T) {
+	app := newApp()
+
+	response := testkit.Do(t, app, "GET", "/web/order", nil).AssertStatus(404).
+		AssertHeader("Content-Type", "text/html; charset=utf-8").
+		AssertContains("<title>Not Found</title>").
+		AssertContains(`<li><a href="/web/orders">/web/orders</a></li>`)
+	assert.NotContains(t, response.String(), "{")
+
+	testkit.Do(t, app, "POST", "/web/orders", nil).AssertStatus(405).
+		AssertContains("<title>Method Not Allowed</title>").
+		AssertContains("Cannot POST /web/orders; allowed: GET, HEAD")
+	testkit.Do(t, app, "GET", "/web/<script>", nil).AssertStatus(404).
+		AssertContains("Cannot GET /web/&lt;script&gt;")
+}
+
+func TestSuggest(t *testing.T) {
+	routes := []string{"/", "/metrics", "/api/orders", "/api/orders/:id", "/api/orders/:id/pay", "/files/*"}
+
+	assert.Equal(t, []string{"/metrics"}, suggest(routes, "/metric"))
+	assert.Equal(t, []string{"/api/orders"}, suggest(routes, "/API/Orders"))
+	assert.Equal(t, []string{"/api/orders/5/pay", "/api/orders/5"}, suggest(routes, "/api/orders/5/pey"))
+	assert.Equal(t, []string{"/files/a/b.png"}, suggest(routes, "/file/a/b.png"))
+	assert.Empty(t, suggest(routes, "/completely/different"))
+	assert.Equal(t, 3, levenshtein("kitten", "sitting"))
+}
@@ -0,0 +1,97 @@
+package routing
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Route declares an endpoint. Path is relative to the router the route is
+// registered on; Name, if set, names the fiber route. Version is the API
+// version the route belongs to, empty for routes outside the versioned
+// API.
+type Route struct {
+	Method      string
+	Path        string
+	Name        string
+	Handler     fiber.Handler
+	Middlewares []fiber.Handler
+	Version     string
+}
+
+// Register adds routes to router, each behind its middlewares. GET routes
+// answer HEAD too, as with router.Get.
+func Register(router fiber.Router, routes []Route) {
+	for _, route := range routes {
+		handlers := append(append([]fiber.Handler{}, route.Middlewares...), route.Handler)
+		var added fiber.Router
+		if route.Method == fiber.MethodGet {
+			added = router.Get(route.Path, handlers...)
+		} else {
+			added = router.Add(route.Method, route.Path, handlers...)
+		}
+		if route.Name != "" {
+			added.Name(route.Name)
+		}
+	}
+}
+
+// RouteInfo is a registered route as listed: its method, full path, name
+// and version.
+type RouteInfo struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// Table keeps the routes registered through it, so one declaration serves
+// the router, the route listing and the tests.
+type Table struct {
+	mu     sync.Mutex
+	routes []RouteInfo
+}
+
+func NewTable() *Table {
+	return &Table{}
+}
+
+// Register registers routes on router like the Register function and
+// keeps them.
+func (t *Table) Register(router fiber.Router, routes []Route) {
+	Register(router, routes)
+	prefix := ""
+	if group, ok := router.(*fiber.Group); ok {
+		prefix = strings.TrimSuffix(group.Prefix, "/")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, route := range routes {
+		path := prefix + route.Path
+		if path == "" {
+			path = "/"
+		}
+		t.routes = append(t.routes, RouteInfo{Method: route.Method, Path: path, Name: route.Name, Version: route.Version})
+	}
+}
+
+// Routes returns the kept routes ordered by path and method.
+func (t *Table) Routes() []RouteInfo {
+	t.mu.Lock()
+	routes := append([]RouteInfo{}, t.routes...)
+	t.mu.Unlock()
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// Handler lists the kept routes.
+func (t *Table) Handler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"routes": t.Routes()})
+}
@@ -0,0 +1,37 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable(t *testing.T) {
+	app := fiber.New()
+	table := NewTable()
+	send := func(body string) fiber.Handler {
+		return func(c *fiber.Ctx) error { return c.SendString(body) }
+	}
+	forbid := func(c *fiber.Ctx) error { return fiber.ErrForbidden }
+
+	table.Register(app, []Route{{Method: fiber.MethodGet, Path: "/", Name: "home", Handler: send("home")}})
+	table.Register(app.Group("/api").Group("/v1"), []Route{
+		{Method: fiber.MethodPost, Path: "/items", Name: "items.create", Handler: send("created"), Middlewares: []fiber.Handler{forbid}, Version: "v1"},
+		{Method: fiber.MethodGet, Path: "/items", Name: "items.list", Handler: send("items"), Version: "v1"},
+	})
+	app.Get("/routes", table.Handler)
+
+	testkit.Do(t, app, "GET", "/", nil).AssertStatus(200).AssertBody("home")
+	testkit.Do(t, app, "GET", "/api/v1/items", nil).AssertStatus(200).AssertBody("items")
+	testkit.Do(t, app, "HEAD", "/api/v1/items", nil).AssertStatus(200)
+	testkit.Do(t, app, "POST", "/api/v1/items", nil).AssertStatus(403)
+	assert.Equal(t, "/api/v1/items", app.GetRoute("items.list").Path)
+
+	testkit.Do(t, app, "GET", "/routes", nil).AssertStatus(200).AssertJSON(`{"routes":[
+		{"method":"GET","path":"/","name":"home"},
+		{"method":"GET","path":"/api/v1/items","name":"items.list","version":"v1"},
+		{"method":"POST","path":"/api/v1/items","name":"items.create","version":"v1"}
+	]}`)
+}
@@ -0,0 +1,61 @@
+package sanitize
+
+import (
+	"html"
+	"reflect"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+var (
+	richText  = bluemonday.UGCPolicy()
+	plainText = bluemonday.StrictPolicy()
+)
+
+// RichText keeps the markup user content may use (paragraphs, emphasis,
+// lists, links, images) and drops scripts, styles, event handlers and
+// javascript: URLs. Links get rel="nofollow".
+func RichText(s string) string {
+	return richText.Sanitize(s)
+}
+
+// Text removes all markup. The result is plain text, to be escaped when it
+// is rendered.
+func Text(s string) string {
+	return html.UnescapeString(plainText.Sanitize(s))
+}
+
+// Struct sanitizes the string fields of the struct v points to that are
+// tagged `sanitize:"richtext"` or `sanitize:"text"`, descending into nested
+// structs. Handlers call it on request bodies before storing them.
+func Struct(v interface{}) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return
+	}
+	sanitizeStruct(value.Elem())
+}
+
+func sanitizeStruct(value reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.Struct:
+			sanitizeStruct(field)
+		case reflect.Pointer:
+			if !field.IsNil() && field.Elem().Kind() == reflect.Struct {
+				sanitizeStruct(field.Elem())
+			}
+		case reflect.String:
+			switch value.Type().Field(i).Tag.Get("sanitize") {
+			case "richtext":
+				field.SetString(RichText(field.String()))
+			case "text":
+				field.SetString(Text(field.String()))
+			}
+		}
+	}
+}
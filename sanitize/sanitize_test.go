@@ -0,0 +1,62 @@
+package sanitize
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var hostile = []string{
+	`<script>alert(1)</script>`,
+	`<img src=x onerror=alert(1)>`,
+	`<a href="javascript:alert(1)">click</a>`,
+	`<svg onload=alert(1)>`,
+	`<iframe src="https://evil.example"></iframe>`,
+	`<p style="background:url(javascript:alert(1))">x</p>`,
+	`"><script>alert(1)</script>`,
+	`<scr<script>ipt>alert(1)</script>`,
+}
+
+func TestRichText(t *testing.T) {
+	for _, payload := range hostile {
+		clean := strings.ToLower(RichText(payload))
+		assert.NotContains(t, clean, "<script", payload)
+		assert.NotContains(t, clean, "onerror", payload)
+		assert.NotContains(t, clean, "onload", payload)
+		assert.NotContains(t, clean, "javascript:", payload)
+		assert.NotContains(t, clean, "<iframe", payload)
+	}
+
+	assert.Equal(t, `<p>Hello <b>world</b></p>`, RichText(`<p onclick="x()">Hello <b>world</b></p>`))
+	assert.Equal(t, `<a href="https://example.com" rel="nofollow">link</a>`, RichText(`<a href="https://example.com">link</a>`))
+}
+
+func TestText(t *testing.T) {
+	assert.Equal(t, "Hello world", Text(`Hello <b>world</b><script>alert(1)</script>`))
+	assert.Equal(t, "Tom & Jerry < 3", Text("Tom & Jerry < 3"))
+}
+
+func TestStruct(t *testing.T) {
+	type Author struct {
+		Name string `sanitize:"text"`
+	}
+	type Post struct {
+		Title  string `sanitize:"text"`
+		Body   string `sanitize:"richtext"`
+		Slug   string
+		Author *Author
+	}
+	post := &Post{
+		Title:  `Hi<script>alert(1)</script>`,
+		Body:   `<p>Hi</p><img src=x onerror=alert(1)>`,
+		Slug:   `<b>kept</b>`,
+		Author: &Author{Name: `<i>akbar</i>`},
+	}
+	Struct(post)
+
+	assert.Equal(t, "Hi", post.Title)
+	assert.Equal(t, `<p>Hi</p><img src="x">`, post.Body)
+	assert.Equal(t, `<b>kept</b>`, post.Slug)
+	assert.Equal(t, "akbar", post.Author.Name)
+}
@@ -0,0 +1,80 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// eicar is the standard antivirus test file.
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd answers INSTREAM like clamd, finding the EICAR test file.
+func fakeClamd(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				command := make([]byte, len("zINSTREAM\x00"))
+				if _, err := io.ReadFull(conn, command); err != nil || string(command) != "zINSTREAM\x00" {
+					io.WriteString(conn, "UNKNOWN COMMAND\x00")
+					return
+				}
+				var data bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					io.CopyN(&data, conn, int64(size))
+				}
+				if data.Len() > 1024 {
+					io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+					return
+				}
+				if strings.Contains(data.String(), eicar) {
+					io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+					return
+				}
+				io.WriteString(conn, "stream: OK\x00")
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestClamd(t *testing.T) {
+	clamd := NewClamd(fakeClamd(t), time.Second)
+	ctx := context.Background()
+
+	result, err := clamd.Scan(ctx, strings.NewReader("catatan"))
+	assert.Nil(t, err)
+	assert.False(t, result.Infected)
+
+	result, err = clamd.Scan(ctx, strings.NewReader("prefix "+eicar))
+	assert.Nil(t, err)
+	assert.Equal(t, Result{Infected: true, Signature: "Eicar-Test-Signature"}, result)
+
+	_, err = clamd.Scan(ctx, bytes.NewReader(make([]byte, 2048)))
+	assert.EqualError(t, err, "scan: clamd: INSTREAM size limit exceeded. ERROR")
+
+	_, err = NewClamd("127.0.0.1:1", time.Second).Scan(ctx, strings.NewReader("x"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,22 @@
+package sequence
+
+import "sync"
+
+// Counter hands out 1, 2, 3, ... per series, in memory. A number is only
+// lost if the caller drops it, so take it as the last step of whatever it
+// numbers.
+type Counter struct {
+	mu     sync.Mutex
+	series map[string]int64
+}
+
+func NewCounter() *Counter {
+	return &Counter{series: map[string]int64{}}
+}
+
+func (c *Counter) Next(series string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.series[series]++
+	return c.series[series]
+}
@@ -0,0 +1,54 @@
+package sequence
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+)
+
+// IDGenerator hands out unique IDs. Services take one so tests can predict
+// the IDs they get.
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+// NewID returns the next ID in decimal.
+func (s *Snowflake) NewID() (string, error) {
+	id, err := s.Next()
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+// Random generates IDs of that many random bytes in hex, for IDs that must
+// not be guessable, such as the names of public files.
+type Random int
+
+func (r Random) NewID() (string, error) {
+	buf := make([]byte, r)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Stepper generates prefix1, prefix2, ..., for tests.
+type Stepper struct {
+	prefix string
+
+	mu sync.Mutex
+	n  int
+}
+
+func NewStepper(prefix string) *Stepper {
+	return &Stepper{prefix: prefix}
+}
+
+func (s *Stepper) NewID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n++
+	return s.prefix + strconv.Itoa(s.n), nil
+}
@@ -0,0 +1,140 @@
+package sequence
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnowflakeUniqueUnderConcurrency(t *testing.T) {
+	ids, err := NewSnowflake(7)
+	assert.Nil(t, err)
+
+	const workers, perWorker = 8, 10000
+	results := make([][]int64, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id, err := ids.Next()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				results[w] = append(results[w], id)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[int64]bool, workers*perWorker)
+	for _, list := range results {
+		for i, id := range list {
+			assert.False(t, seen[id], "duplicate id %d", id)
+			seen[id] = true
+			assert.Equal(t, int64(7), id>>sequenceBits&MaxNode)
+			if i > 0 {
+				assert.Greater(t, id, list[i-1])
+			}
+		}
+	}
+	assert.Len(t, seen, workers*perWorker)
+}
+
+func TestSnowflakeSequenceOverflow(t *testing.T) {
+	ids, _ := NewSnowflake(0)
+	start := Epoch.Add(time.Hour)
+	calls := 0
+	// The clock only moves after 5000 readings.
+	ids.now = func() time.Time {
+		calls++
+		return start.Add(time.Duration(calls/5000) * time.Millisecond)
+	}
+	var last int64
+	for i := 0; i < maxSequence+2; i++ {
+		id, err := ids.Next()
+		assert.Nil(t, err)
+		assert.Greater(t, id, last)
+		last = id
+	}
+	assert.Equal(t, int64(0), last&maxSequence)
+}
+
+func TestSnowflakeClockBackwards(t *testing.T) {
+	ids, _ := NewSnowflake(0)
+	now := Epoch.Add(time.Hour)
+	ids.now = func() time.Time { return now }
+	first, err := ids.Next()
+	assert.Nil(t, err)
+
+	now = now.Add(-2 * time.Second)
+	_, err = ids.Next()
+	assert.ErrorIs(t, err, ErrClockBackwards)
+
+	// A small step back is waited out.
+	readings := 0
+	now = Epoch.Add(time.Hour - time.Millisecond)
+	ids.now = func() time.Time {
+		readings++
+		if readings > 1 {
+			return Epoch.Add(time.Hour + time.Millisecond)
+		}
+		return now
+	}
+	second, err := ids.Next()
+	assert.Nil(t, err)
+	assert.Greater(t, second, first)
+
+	_, err = NewSnowflake(MaxNode + 1)
+	assert.NotNil(t, err)
+}
+
+func TestCounter(t *testing.T) {
+	counter := NewCounter()
+	var wg sync.WaitGroup
+	got := make(chan int64, 1000)
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got <- counter.Next("invoice-2026")
+		}()
+	}
+	wg.Wait()
+	close(got)
+
+	seen := map[int64]bool{}
+	for n := range got {
+		seen[n] = true
+	}
+	for n := int64(1); n <= 1000; n++ {
+		assert.True(t, seen[n], "missing %d", n)
+	}
+	assert.Equal(t, int64(1), counter.Next("invoice-2027"))
+}
+
+func TestIDGenerators(t *testing.T) {
+	stepper := NewStepper("order-")
+	for _, want := range []string{"order-1", "order-2", "order-3"} {
+		id, err := stepper.NewID()
+		assert.Nil(t, err)
+		assert.Equal(t, want, id)
+	}
+
+	id, err := Random(16).NewID()
+	assert.Nil(t, err)
+	assert.Len(t, id, 32)
+	other, err := Random(16).NewID()
+	assert.Nil(t, err)
+	assert.NotEqual(t, id, other)
+
+	snowflake, err := NewSnowflake(1)
+	assert.Nil(t, err)
+	id, err = snowflake.NewID()
+	assert.Nil(t, err)
+	assert.Regexp(t, `^[1-9][0-9]+$`, id)
+}
@@ -0,0 +1,77 @@
+// Package sequence generates identifiers: unique, time-ordered IDs and
+// gap-free numbers per series.
+package sequence
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+	MaxNode      = 1<<nodeBits - 1
+	maxSequence  = 1<<sequenceBits - 1
+)
+
+// Epoch is the start of Snowflake time, 2024-01-01 UTC. 41 bits of
+// milliseconds last until 2093.
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var ErrClockBackwards = errors.New("sequence: clock moved backwards")
+
+// Snowflake generates 63-bit IDs from the milliseconds since Epoch, the
+// node number and a per-millisecond sequence, like Twitter's Snowflake.
+// IDs of one node increase; nodes running at the same time need distinct
+// numbers.
+type Snowflake struct {
+	node int64
+	now  func() time.Time
+
+	mu       sync.Mutex
+	last     int64
+	sequence int64
+}
+
+func NewSnowflake(node int) (*Snowflake, error) {
+	if node < 0 || node > MaxNode {
+		return nil, errors.New("sequence: node out of range")
+	}
+	return &Snowflake{node: int64(node), now: time.Now}, nil
+}
+
+// Next returns the next ID. When the clock is set back a little it waits
+// for it to catch up; beyond a second it fails rather than risk handing out
+// an ID twice.
+func (s *Snowflake) Next() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.millis()
+	if now < s.last {
+		if s.last-now > 1000 {
+			return 0, ErrClockBackwards
+		}
+		for now < s.last {
+			time.Sleep(time.Duration(s.last-now) * time.Millisecond)
+			now = s.millis()
+		}
+	}
+	if now == s.last {
+		s.sequence = (s.sequence + 1) & maxSequence
+		if s.sequence == 0 {
+			// 4096 IDs this millisecond already.
+			for now <= s.last {
+				now = s.millis()
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.last = now
+	return now<<(nodeBits+sequenceBits) | s.node<<sequenceBits | s.sequence, nil
+}
+
+func (s *Snowflake) millis() int64 {
+	return s.now().Sub(Epoch).Milliseconds()
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// httpHandler serves app from net/http servers (HTTP/2, HTTP/3). Unlike
+// fiber's adaptor it exposes the connection's TLS state to handlers and
+// passes streamed response bodies through chunk by chunk instead of
+// buffering them.
+func httpHandler(app *fiber.App) http.Handler {
+	handler := app.Handler()
+	bodyLimit := int64(app.Config().BodyLimit)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, bodyLimit+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) > bodyLimit {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init2(&requestConn{request: r}, nil, false)
+		ctx.Request.Header.SetMethod(r.Method)
+		ctx.Request.SetRequestURI(r.RequestURI)
+		ctx.Request.Header.SetHost(r.Host)
+		for name, values := range r.Header {
+			for _, value := range values {
+				ctx.Request.Header.Add(name, value)
+			}
+		}
+		ctx.Request.SetBody(body)
+
+		handler(ctx)
+
+		ctx.Response.Header.VisitAll(func(name, value []byte) {
+			w.Header().Add(string(name), string(value))
+		})
+		w.WriteHeader(ctx.Response.StatusCode())
+
+		if !ctx.Response.IsBodyStream() {
+			w.Write(ctx.Response.Body())
+			return
+		}
+		stream := ctx.Response.BodyStream()
+		defer ctx.Response.CloseBodyStream()
+		flusher, _ := w.(http.Flusher)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := stream.Read(buf)
+			if n > 0 {
+				if _, err := w.Write(buf[:n]); err != nil {
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+}
+
+// requestConn stands in for the network connection of a net/http request.
+// It implements the interface fasthttp uses to detect TLS connections.
+type requestConn struct {
+	request *http.Request
+}
+
+func (c *requestConn) Handshake() error {
+	return nil
+}
+
+func (c *requestConn) ConnectionState() tls.ConnectionState {
+	if c.request.TLS == nil {
+		return tls.ConnectionState{}
+	}
+	return *c.request.TLS
+}
+
+func (c *requestConn) RemoteAddr() net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", c.request.RemoteAddr)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return addr
+}
+
+func (c *requestConn) LocalAddr() net.Addr {
+	if addr, ok := c.request.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
+
+func (c *requestConn) Read([]byte) (int, error)         { return 0, io.EOF }
+func (c *requestConn) Write(b []byte) (int, error)      { return len(b), nil }
+func (c *requestConn) Close() error                     { return nil }
+func (c *requestConn) SetDeadline(time.Time) error      { return nil }
+func (c *requestConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *requestConn) SetWriteDeadline(time.Time) error { return nil }
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+)
+
+const handshakeTimeout = 10 * time.Second
+
+// splitByALPN completes the TLS handshake of every connection accepted on ln
+// and hands it to the returned h2 listener when the client negotiated HTTP/2,
+// to the http1 listener otherwise. Both listeners are closed once ln is.
+func splitByALPN(ln net.Listener, tlsConfig *tls.Config) (http1, h2 *connListener) {
+	http1 = newConnListener(ln.Addr())
+	h2 = newConnListener(ln.Addr())
+	go func() {
+		defer http1.Close()
+		defer h2.Close()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go dispatch(tls.Server(conn, tlsConfig), http1, h2)
+		}
+	}()
+	return http1, h2
+}
+
+// dispatch runs the handshake in its own goroutine so a slow client can't
+// hold up the accept loop.
+func dispatch(conn *tls.Conn, http1, h2 *connListener) {
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return
+	}
+
+	target := http1
+	if conn.ConnectionState().NegotiatedProtocol == "h2" {
+		target = h2
+	}
+	select {
+	case target.conns <- conn:
+	case <-target.done:
+		conn.Close()
+	}
+}
+
+// connListener is a net.Listener fed with already accepted connections.
+type connListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{addr: addr, conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cloudflare/tableflip"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+)
+
+// ListenGraceful serves app like Listen and restarts without dropping
+// connections: on SIGUSR2 the running binary is started again and inherits
+// the listening sockets. Once the new process is ready the old one stops
+// accepting and waits up to cfg.Server.DrainTimeout for in-flight requests.
+// SIGINT and SIGTERM drain the same way without a successor.
+func ListenGraceful(app *fiber.App, cfg *config.Config) error {
+	upgrader, err := tableflip.New(tableflip.Options{PIDFile: cfg.Server.PIDFile})
+	if err != nil {
+		return err
+	}
+	defer upgrader.Stop()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			if sig != syscall.SIGUSR2 {
+				upgrader.Stop()
+				return
+			}
+			if err := upgrader.Upgrade(); err != nil {
+				slog.Error("restart failed", "error", err)
+			}
+		}
+	}()
+
+	app.Hooks().OnListen(func(fiber.ListenData) error {
+		return upgrader.Ready()
+	})
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(app, cfg, upgrader)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-upgrader.Exit():
+	}
+	return app.ShutdownWithTimeout(cfg.Server.DrainTimeout)
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Listeners opens the sockets the server accepts on. *tableflip.Upgrader
+// implements it so sockets can be handed over to a new process.
+type Listeners interface {
+	Listen(network, addr string) (net.Listener, error)
+	ListenPacket(network, addr string) (net.PacketConn, error)
+}
+
+type netListeners struct{}
+
+func (netListeners) Listen(network, addr string) (net.Listener, error) {
+	return net.Listen(network, addr)
+}
+
+func (netListeners) ListenPacket(network, addr string) (net.PacketConn, error) {
+	return net.ListenPacket(network, addr)
+}
+
+// Listen serves app on cfg.Addr until it is shut down, over TLS when it is
+// configured.
+func Listen(app *fiber.App, cfg *config.Config) error {
+	return Serve(app, cfg, netListeners{})
+}
+
+// Serve is Listen with the sockets opened through listeners.
+func Serve(app *fiber.App, cfg *config.Config, listeners Listeners) error {
+	if cfg.Server.Prefork {
+		return app.Listen(cfg.Addr)
+	}
+	if !cfg.TLS.Enabled() {
+		ln, err := listeners.Listen("tcp", cfg.Addr)
+		if err != nil {
+			return err
+		}
+		return app.Listener(ln)
+	}
+
+	tlsConfig, redirect, err := tlsSetup(cfg.TLS)
+	if err != nil {
+		return err
+	}
+
+	if cfg.TLS.RedirectAddr != "" {
+		redirectListener, err := listeners.Listen("tcp", cfg.TLS.RedirectAddr)
+		if err != nil {
+			return err
+		}
+		redirectServer := &http.Server{
+			Handler:           redirect,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go redirectServer.Serve(redirectListener)
+		app.Hooks().OnShutdown(func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return redirectServer.Shutdown(ctx)
+		})
+	}
+
+	if cfg.TLS.HTTP3 {
+		if err := listenHTTP3(app, listeners, cfg.Addr, tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	ln, err := listeners.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+	if !cfg.TLS.HTTP2 {
+		return app.Listener(tls.NewListener(ln, tlsConfig))
+	}
+
+	http1, h2 := splitByALPN(ln, tlsConfig)
+	h2Server := &http.Server{
+		Handler:           httpHandler(app),
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       app.Config().IdleTimeout,
+	}
+	go h2Server.Serve(h2)
+	app.Hooks().OnShutdown(func() error {
+		ln.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return h2Server.Shutdown(ctx)
+	})
+	return app.Listener(http1)
+}
+
+// listenHTTP3 serves app over QUIC on the UDP port matching addr. Clients
+// discover it through the Alt-Svc header set by AltSvc.
+func listenHTTP3(app *fiber.App, listeners Listeners, addr string, tlsConfig *tls.Config) error {
+	conn, err := listeners.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	h3Server := &http3.Server{
+		Handler:   httpHandler(app),
+		TLSConfig: http3.ConfigureTLSConfig(tlsConfig.Clone()),
+	}
+	go h3Server.Serve(conn)
+	app.Hooks().OnShutdown(func() error {
+		h3Server.Close()
+		return conn.Close()
+	})
+	return nil
+}
+
+// AltSvc advertises the HTTP/3 listener on the same port as addr.
+func AltSvc(addr string) fiber.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+	value := fmt.Sprintf(`h3=":%s"; ma=86400`, port)
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderAltSvc, value)
+		return c.Next()
+	}
+}
@@ -0,0 +1,363 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/middleware"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// issue creates a certificate from template, signed by parent or
+// self-signed when parent is nil.
+func issue(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write stores the certificate and key as PEM files and returns their paths.
+func (c *testCert) write(t *testing.T) (string, string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	assert.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600))
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func serverCert(t *testing.T) *testCert {
+	return issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, nil)
+}
+
+// listenTLS starts app with cfg on a free port and waits until it accepts
+// connections.
+func listenTLS(t *testing.T, app *fiber.App, cfg *config.Config) {
+	cfg.Addr = freeAddr(t)
+	go Listen(app, cfg)
+	t.Cleanup(func() { app.Shutdown() })
+
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", cfg.Addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestListenTLSFromFiles(t *testing.T) {
+	certFile, keyFile := serverCert(t).write(t)
+	cfg := config.Default()
+	cfg.TLS = config.TLSConfig{CertFile: certFile, KeyFile: keyFile}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("Hello " + c.Protocol())
+	})
+	listenTLS(t, app, cfg)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	response, err := client.Get("https://" + cfg.Addr + "/")
+	assert.Nil(t, err)
+
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello https", string(body))
+	assert.NotNil(t, response.TLS)
+}
+
+func TestTLSSetupRequiresKeyPair(t *testing.T) {
+	_, _, err := tlsSetup(config.TLSConfig{CertFile: "cert.pem"})
+	assert.NotNil(t, err)
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	request := httptest.NewRequest("POST", "http://example.com:8080/api/users?page=2", nil)
+	recorder := httptest.NewRecorder()
+	redirectToHTTPS(recorder, request)
+
+	assert.Equal(t, 308, recorder.Code)
+	assert.Equal(t, "https://example.com/api/users?page=2", recorder.Header().Get("Location"))
+}
+
+func TestAutocertSetup(t *testing.T) {
+	tlsConfig, handler, err := tlsSetup(config.TLSConfig{
+		AutocertDomains:  []string{"example.com"},
+		AutocertCacheDir: t.TempDir(),
+	})
+	assert.Nil(t, err)
+	assert.Contains(t, tlsConfig.NextProtos, "acme-tls/1")
+
+	request := httptest.NewRequest("GET", "http://example.com/login", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, 308, recorder.Code)
+	assert.Equal(t, "https://example.com/login", recorder.Header().Get("Location"))
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := issue(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	spiffeID, err := url.Parse("spiffe://example.org/billing")
+	assert.Nil(t, err)
+	client := issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "billing", Organization: []string{"Example"}},
+		URIs:         []*url.URL{spiffeID},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+
+	certFile, keyFile := serverCert(t).write(t)
+	caFile, _ := ca.write(t)
+	cfg := config.Default()
+	cfg.TLS = config.TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: "request", ClientCAFile: caFile}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(middleware.ExtractClientIdentity())
+	app.Get("/public", func(c *fiber.Ctx) error {
+		return c.SendString("public")
+	})
+	app.Get("/api/internal", middleware.RequireClientIdentity("spiffe://example.org/billing"), func(c *fiber.Ctx) error {
+		identity, _ := middleware.CurrentClientIdentity(c)
+		return c.SendString(identity.SPIFFEID + " " + identity.Subject)
+	})
+	listenTLS(t, app, cfg)
+
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	withCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{{Certificate: [][]byte{client.der}, PrivateKey: client.key}},
+	}}}
+
+	response, err := anonymous.Get("https://" + cfg.Addr + "/public")
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	response, err = anonymous.Get("https://" + cfg.Addr + "/api/internal")
+	assert.Nil(t, err)
+	assert.Equal(t, 401, response.StatusCode)
+
+	response, err = withCert.Get("https://" + cfg.Addr + "/api/internal")
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "spiffe://example.org/billing CN=billing,O=Example", string(body))
+}
+
+func TestUnknownClientAuth(t *testing.T) {
+	certFile, keyFile := serverCert(t).write(t)
+	_, _, err := tlsSetup(config.TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: "always"})
+	assert.NotNil(t, err)
+}
+
+func TestHTTP2Negotiation(t *testing.T) {
+	certFile, keyFile := serverCert(t).write(t)
+	cfg := config.Default()
+	cfg.TLS = config.TLSConfig{CertFile: certFile, KeyFile: keyFile, HTTP2: true}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("Hello " + c.Protocol())
+	})
+	listenTLS(t, app, cfg)
+
+	h2 := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, ForceAttemptHTTP2: true}}
+	response, err := h2.Get("https://" + cfg.Addr + "/")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, response.ProtoMajor)
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello https", string(body))
+
+	http1 := &http.Client{Transport: http1Transport()}
+	response, err = http1.Get("https://" + cfg.Addr + "/")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, response.ProtoMajor)
+	body, err = io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello https", string(body))
+}
+
+// http1Transport never negotiates HTTP/2.
+func http1Transport() *http.Transport {
+	return &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		TLSNextProto:    map[string]func(string, *tls.Conn) http.RoundTripper{},
+	}
+}
+
+func TestStreamingOverEachProtocol(t *testing.T) {
+	certFile, keyFile := serverCert(t).write(t)
+	cfg := config.Default()
+	cfg.TLS = config.TLSConfig{CertFile: certFile, KeyFile: keyFile, HTTP2: true, HTTP3: true}
+
+	next := make(chan struct{})
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/stream", func(c *fiber.Ctx) error {
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			fmt.Fprint(w, "first\n")
+			w.Flush()
+			select {
+			case <-next:
+			case <-time.After(5 * time.Second):
+			}
+			fmt.Fprint(w, "second\n")
+			w.Flush()
+		})
+		return nil
+	})
+	listenTLS(t, app, cfg)
+
+	transports := []struct {
+		name      string
+		transport http.RoundTripper
+		major     int
+	}{
+		{"HTTP/1.1", http1Transport(), 1},
+		{"HTTP/2", &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, ForceAttemptHTTP2: true}, 2},
+		{"HTTP/3", &http3.RoundTripper{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}, 3},
+	}
+	for _, tt := range transports {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := (&http.Client{Transport: tt.transport}).Get("https://" + cfg.Addr + "/stream")
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer response.Body.Close()
+			assert.Equal(t, tt.major, response.ProtoMajor)
+
+			reader := bufio.NewReader(response.Body)
+			line, err := reader.ReadString('\n')
+			assert.Nil(t, err)
+			assert.Equal(t, "first\n", line)
+
+			// The first chunk has to arrive while the handler is still
+			// writing, otherwise the response was buffered.
+			select {
+			case next <- struct{}{}:
+			case <-time.After(time.Second):
+				t.Fatal("stream was buffered until the handler finished")
+			}
+			line, err = reader.ReadString('\n')
+			assert.Nil(t, err)
+			assert.Equal(t, "second\n", line)
+		})
+	}
+}
+
+func TestAltSvc(t *testing.T) {
+	app := fiber.New()
+	app.Use(AltSvc("localhost:8443"))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	response, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, `h3=":8443"; ma=86400`, response.Header.Get("Alt-Svc"))
+}
+
+func TestListenGracefulDrainsRequests(t *testing.T) {
+	cfg := config.Default()
+	cfg.Addr = freeAddr(t)
+
+	started := make(chan struct{})
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		return c.SendString("done")
+	})
+	served := make(chan error, 1)
+	go func() {
+		served <- ListenGraceful(app, cfg)
+	}()
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", cfg.Addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	bodies := make(chan string, 1)
+	go func() {
+		response, err := http.Get("http://" + cfg.Addr + "/slow")
+		if err != nil {
+			bodies <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(response.Body)
+		bodies <- string(body)
+	}()
+	<-started
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	assert.Equal(t, "done", <-bodies)
+	assert.Nil(t, <-served)
+	_, err := net.Dial("tcp", cfg.Addr)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsSetup returns the TLS config for the HTTPS listener and the handler for
+// the plain HTTP redirect listener. With autocert the manager renews
+// certificates in the background, shortly before they expire.
+func tlsSetup(cfg config.TLSConfig) (*tls.Config, http.Handler, error) {
+	tlsConfig, redirect, err := serverCertificates(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := clientAuth(tlsConfig, cfg); err != nil {
+		return nil, nil, err
+	}
+	if cfg.HTTP2 {
+		if len(tlsConfig.NextProtos) == 0 {
+			tlsConfig.NextProtos = []string{"http/1.1"}
+		}
+		tlsConfig.NextProtos = append([]string{"h2"}, tlsConfig.NextProtos...)
+	}
+	return tlsConfig, redirect, nil
+}
+
+func serverCertificates(cfg config.TLSConfig) (*tls.Config, http.Handler, error) {
+	if len(cfg.AutocertDomains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		tlsConfig := &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: manager.GetCertificate,
+			NextProtos:     []string{"http/1.1", acme.ALPNProto},
+		}
+		return tlsConfig, manager.HTTPHandler(http.HandlerFunc(redirectToHTTPS)), nil
+	}
+
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, nil, errors.New("server: tls needs both cert_file and key_file")
+	}
+	certificate, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+	}
+	return tlsConfig, http.HandlerFunc(redirectToHTTPS), nil
+}
+
+func clientAuth(tlsConfig *tls.Config, cfg config.TLSConfig) error {
+	switch cfg.ClientAuth {
+	case "":
+		return nil
+	case "request":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return fmt.Errorf("server: unknown client_auth %q", cfg.ClientAuth)
+	}
+
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return err
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("server: no certificates in %s", cfg.ClientCAFile)
+	}
+	return nil
+}
+
+// redirectToHTTPS sends clients to the same URL over HTTPS, keeping the
+// method and body (308).
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+}
@@ -0,0 +1,134 @@
+// Package sitemap tells search engines about the pages under /web: which
+// there are, in /sitemap.xml, and which paths to stay out of, in
+// /robots.txt.
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/routing"
+)
+
+// Prefix is where the pages listed in the sitemap are.
+const Prefix = "/web"
+
+type urlset struct {
+	XMLName xml.Name `xml:"urlset"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	URLs    []url    `xml:"url"`
+}
+
+type url struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// Sitemap lists the pages of a routing.Table. It is built on the first
+// request, once all routes are registered, and again after the configured
+// TTL, and kept gzipped as well for the clients that take it.
+type Sitemap struct {
+	cfg      config.WebConfig
+	table    *routing.Table
+	now      func() time.Time
+	modified map[string]func() time.Time
+
+	mu      sync.Mutex
+	plain   []byte
+	gzipped []byte
+	built   time.Time
+}
+
+func New(cfg config.WebConfig, table *routing.Table) *Sitemap {
+	return &Sitemap{cfg: cfg, table: table, now: time.Now, modified: map[string]func() time.Time{}}
+}
+
+// LastModified has the page of the named route listed as last modified at
+// the time modified returns, such as the time its content last changed.
+// A zero time leaves it out. Set before the first request.
+func (s *Sitemap) LastModified(name string, modified func() time.Time) {
+	s.modified[name] = modified
+}
+
+// Routes declares /sitemap.xml and /robots.txt.
+func (s *Sitemap) Routes() []routing.Route {
+	return []routing.Route{
+		{Method: fiber.MethodGet, Path: "/sitemap.xml", Name: "sitemap", Handler: s.SitemapHandler},
+		{Method: fiber.MethodGet, Path: "/robots.txt", Name: "robots", Handler: s.RobotsHandler},
+	}
+}
+
+func (s *Sitemap) SitemapHandler(c *fiber.Ctx) error {
+	plain, gzipped, err := s.sitemap()
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "application/xml; charset=utf-8")
+	c.Set(fiber.HeaderVary, fiber.HeaderAcceptEncoding)
+	if c.Request().Header.HasAcceptEncoding("gzip") {
+		c.Set(fiber.HeaderContentEncoding, "gzip")
+		return c.Send(gzipped)
+	}
+	return c.Send(plain)
+}
+
+func (s *Sitemap) RobotsHandler(c *fiber.Ctx) error {
+	var robots strings.Builder
+	robots.WriteString("User-agent: *\n")
+	for _, path := range s.cfg.Disallow {
+		robots.WriteString("Disallow: " + path + "\n")
+	}
+	robots.WriteString("\nSitemap: " + strings.TrimSuffix(s.cfg.BaseURL, "/") + "/sitemap.xml\n")
+	return c.SendString(robots.String())
+}
+
+func (s *Sitemap) sitemap() (plain, gzipped []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.plain != nil && s.now().Sub(s.built) < s.cfg.SitemapTTL {
+		return s.plain, s.gzipped, nil
+	}
+
+	set := urlset{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9", URLs: []url{}}
+	base := strings.TrimSuffix(s.cfg.BaseURL, "/")
+	for _, route := range s.table.Routes() {
+		if !listed(route) {
+			continue
+		}
+		entry := url{Loc: base + route.Path}
+		if modified, ok := s.modified[route.Name]; ok {
+			if at := modified(); !at.IsZero() {
+				entry.LastMod = at.UTC().Format(time.RFC3339)
+			}
+		}
+		set.URLs = append(set.URLs, entry)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(set); err != nil {
+		return nil, nil, err
+	}
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write(buf.Bytes())
+	if err := w.Close(); err != nil {
+		return nil, nil, err
+	}
+	s.plain, s.gzipped, s.built = buf.Bytes(), compressed.Bytes(), s.now()
+	return s.plain, s.gzipped, nil
+}
+
+// listed reports whether route is a page: a named GET route under Prefix
+// without parameters.
+func listed(route routing.RouteInfo) bool {
+	return route.Method == fiber.MethodGet && route.Name != "" &&
+		(route.Path == Prefix || strings.HasPrefix(route.Path, Prefix+"/")) &&
+		!strings.ContainsAny(route.Path, ":*+")
+}
@@ -0,0 +1,73 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/routing"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func newApp(t *testing.T) (*fiber.App, *Sitemap, *time.Time) {
+	page := func(c *fiber.Ctx) error { return c.SendString("page") }
+	app := fiber.New()
+	table := routing.NewTable()
+	table.Register(app.Group("/web"), []routing.Route{
+		{Method: fiber.MethodGet, Path: "", Name: "web.home", Handler: page},
+		{Method: fiber.MethodGet, Path: "/about", Name: "web.about", Handler: page},
+		{Method: fiber.MethodGet, Path: "/unnamed", Handler: page},
+		{Method: fiber.MethodGet, Path: "/posts/:slug", Name: "web.post", Handler: page},
+		{Method: fiber.MethodPost, Path: "/contact", Name: "web.contact", Handler: page},
+	})
+	table.Register(app, []routing.Route{{Method: fiber.MethodGet, Path: "/api/orders", Name: "orders.list", Handler: page}})
+
+	sitemaps := New(config.WebConfig{
+		BaseURL:    "https://shop.example/",
+		Disallow:   []string{"/api/", "/admin/"},
+		SitemapTTL: time.Hour,
+	}, table)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	sitemaps.now = func() time.Time { return now }
+	table.Register(app, sitemaps.Routes())
+	return app, sitemaps, &now
+}
+
+func TestSitemap(t *testing.T) {
+	app, sitemaps, now := newApp(t)
+	updated := time.Date(2026, 2, 14, 8, 30, 0, 0, time.FixedZone("WIB", 7*3600))
+	sitemaps.LastModified("web.about", func() time.Time { return updated })
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` +
+		`<url><loc>https://shop.example/web</loc></url>` +
+		`<url><loc>https://shop.example/web/about</loc><lastmod>2026-02-14T01:30:00Z</lastmod></url>` +
+		`</urlset>`
+	testkit.Do(t, app, "GET", "/sitemap.xml", nil).AssertStatus(200).
+		AssertHeader("Content-Type", "application/xml; charset=utf-8").
+		AssertBody(expected)
+
+	response := testkit.Do(t, app, "GET", "/sitemap.xml", nil, testkit.WithHeader("Accept-Encoding", "gzip, br")).
+		AssertHeader("Content-Encoding", "gzip").AssertHeader("Vary", "Accept-Encoding")
+	reader, err := gzip.NewReader(bytes.NewReader(response.Body))
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(reader)
+	assert.Equal(t, expected, string(body))
+
+	// Content changes show once the cached sitemap expires.
+	updated = updated.Add(24 * time.Hour)
+	testkit.Do(t, app, "GET", "/sitemap.xml", nil).AssertContains("2026-02-14T01:30:00Z")
+	*now = now.Add(time.Hour)
+	testkit.Do(t, app, "GET", "/sitemap.xml", nil).AssertContains("2026-02-15T01:30:00Z")
+}
+
+func TestRobots(t *testing.T) {
+	app, _, _ := newApp(t)
+	testkit.Do(t, app, "GET", "/robots.txt", nil).AssertStatus(200).AssertBody(
+		"User-agent: *\nDisallow: /api/\nDisallow: /admin/\n\nSitemap: https://shop.example/sitemap.xml\n")
+}
@@ -0,0 +1,83 @@
+package smoketest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes results as a JUnit XML test suite named suite, the
+// report CI servers show test results from.
+func WriteJUnit(w io.Writer, suite string, results []Result) error {
+	report := junitSuite{Name: suite, Tests: len(results)}
+	var total time.Duration
+	for _, result := range results {
+		total += result.Duration
+		c := junitCase{Name: result.Name, ClassName: suite, Time: seconds(result.Duration)}
+		switch {
+		case result.Skipped:
+			c.Skipped = &struct{}{}
+			report.Skipped++
+		case result.Err != nil:
+			c.Failure = &junitFailure{Message: result.Err.Error(), Text: result.Err.Error()}
+			report.Failures++
+		}
+		report.Cases = append(report.Cases, c)
+	}
+	report.Time = seconds(total)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteText writes results as a table for people, one step per line.
+func WriteText(w io.Writer, results []Result) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+			fmt.Fprintf(table, "SKIP\t%s\t\t\n", result.Name)
+		case result.Err != nil:
+			fmt.Fprintf(table, "FAIL\t%s\t%s\t%s\n", result.Name, result.Duration.Round(time.Millisecond), result.Err)
+		default:
+			fmt.Fprintf(table, "ok\t%s\t%s\t\n", result.Name, result.Duration.Round(time.Millisecond))
+		}
+	}
+	return table.Flush()
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
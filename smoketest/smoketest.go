@@ -0,0 +1,285 @@
+// Package smoketest checks a deployed instance end to end with the
+// scenario a customer goes through: sign in, set up a profile, upload an
+// avatar and get it back, then place an order and look it up. It is the
+// gate after a deploy, run by cmd/smoketest.
+//
+// There is no sign-up or password login to script, so the scenario signs
+// in with the token of an existing test account. The order it places is
+// cancelled at the end, so nothing ships.
+package smoketest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/gen/client"
+)
+
+// Options are the instance to test and how.
+type Options struct {
+	// BaseURL is where the instance is, as in https://shop.example.
+	BaseURL string
+	// Token is a bearer token of the test account.
+	Token string
+	// StepTimeout bounds each step; zero means 10 seconds.
+	StepTimeout time.Duration
+	// HTTPClient defaults to one without a timeout of its own.
+	HTTPClient *http.Client
+}
+
+// Result is how a step went. Steps after a failed one are skipped, as
+// each builds on the ones before.
+type Result struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+	Skipped  bool
+}
+
+// Passed reports whether all steps passed.
+func Passed(results []Result) bool {
+	for _, result := range results {
+		if result.Err != nil || result.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+type step struct {
+	name string
+	run  func(s *scenario, ctx context.Context) error
+}
+
+// steps is the scenario, in order.
+var steps = []step{
+	{"ready", (*scenario).ready},
+	{"sign in", (*scenario).signIn},
+	{"set up profile", (*scenario).setUpProfile},
+	{"upload avatar", (*scenario).uploadAvatar},
+	{"download avatar", (*scenario).downloadAvatar},
+	{"create order", (*scenario).createOrder},
+	{"get order", (*scenario).getOrder},
+	{"cancel order", (*scenario).cancelOrder},
+}
+
+// scenario is the state the steps pass on to each other.
+type scenario struct {
+	base   *url.URL
+	token  string
+	http   *http.Client
+	api    *client.Client
+	avatar string
+	order  *client.Order
+}
+
+// Run runs the scenario against the instance of options.
+func Run(ctx context.Context, options Options) []Result {
+	if options.StepTimeout <= 0 {
+		options.StepTimeout = 10 * time.Second
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{}
+	}
+	s := &scenario{
+		token: options.Token,
+		http:  options.HTTPClient,
+		api: client.New(options.BaseURL,
+			client.WithHTTPClient(options.HTTPClient),
+			client.WithToken(options.Token),
+			client.WithUserAgent("smoketest")),
+	}
+	base, err := url.Parse(strings.TrimSuffix(options.BaseURL, "/"))
+	if err != nil || base.Host == "" {
+		return []Result{{Name: "ready", Err: fmt.Errorf("invalid base URL %q", options.BaseURL)}}
+	}
+	s.base = base
+
+	results := make([]Result, 0, len(steps))
+	failed := false
+	for _, step := range steps {
+		if failed {
+			results = append(results, Result{Name: step.name, Skipped: true})
+			continue
+		}
+		stepCtx, cancel := context.WithTimeout(ctx, options.StepTimeout)
+		start := time.Now()
+		err := step.run(s, stepCtx)
+		cancel()
+		results = append(results, Result{Name: step.name, Duration: time.Since(start), Err: err})
+		failed = err != nil
+	}
+	return results
+}
+
+// ready waits for /readyz, which fails while a new instance warms up.
+func (s *scenario) ready(ctx context.Context) error {
+	for {
+		_, err := s.send(ctx, http.MethodGet, "/readyz", "", nil, false, http.StatusOK)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// signIn checks the instance accepts the test account's token.
+func (s *scenario) signIn(ctx context.Context) error {
+	_, err := s.send(ctx, http.MethodGet, "/api/me", "", nil, true, http.StatusOK)
+	return err
+}
+
+func (s *scenario) setUpProfile(ctx context.Context) error {
+	body := `{"name":"Smoke Test","time_zone":"Asia/Jakarta"}`
+	data, err := s.send(ctx, http.MethodPut, "/api/me", "application/json", strings.NewReader(body), true, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	var profile struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &profile); err != nil || profile.Name != "Smoke Test" {
+		return fmt.Errorf("profile not saved: %s", data)
+	}
+	return nil
+}
+
+func (s *scenario) uploadAvatar(ctx context.Context) error {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: 128, A: 255})
+		}
+	}
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, err := writer.CreateFormFile("avatar", "smoketest.png")
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(part, img); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	data, err := s.send(ctx, http.MethodPost, "/api/me/avatar", writer.FormDataContentType(), &form, true, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	var uploaded struct {
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := json.Unmarshal(data, &uploaded); err != nil || uploaded.AvatarURL == "" {
+		return fmt.Errorf("no avatar URL in %s", data)
+	}
+	s.avatar = uploaded.AvatarURL
+	return nil
+}
+
+// downloadAvatar fetches the avatar from where the instance said it is,
+// its own static files or a CDN.
+func (s *scenario) downloadAvatar(ctx context.Context) error {
+	location, err := s.base.Parse(s.avatar)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, location.String(), nil)
+	if err != nil {
+		return err
+	}
+	response, err := s.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %d", location, response.StatusCode)
+	}
+	if _, _, err := image.Decode(response.Body); err != nil {
+		return fmt.Errorf("GET %s: not an image: %w", location, err)
+	}
+	return nil
+}
+
+func (s *scenario) createOrder(ctx context.Context) error {
+	order, err := s.api.CreateOrder(ctx, client.NewOrder{
+		Items:    []client.NewItem{{SKU: "smoketest", Quantity: 2, Price: "15000"}},
+		Currency: "IDR",
+	})
+	if err != nil {
+		return err
+	}
+	if order.Amount != (client.Money{Amount: "30000.00", Currency: "IDR"}) || order.Status != client.StatusCreated {
+		return fmt.Errorf("order %s is %s for %s %s, want created for 30000.00 IDR", order.ID, order.Status, order.Amount.Amount, order.Amount.Currency)
+	}
+	s.order = order
+	return nil
+}
+
+func (s *scenario) getOrder(ctx context.Context) error {
+	order, err := s.api.GetOrder(ctx, s.order.ID)
+	if err != nil {
+		return err
+	}
+	if order.Amount != s.order.Amount || len(order.Items) != 1 {
+		return fmt.Errorf("order %s came back as %+v", s.order.ID, order)
+	}
+	return nil
+}
+
+func (s *scenario) cancelOrder(ctx context.Context) error {
+	order, err := s.api.CancelOrder(ctx, s.order.ID)
+	if err != nil {
+		return err
+	}
+	if order.Status != client.StatusCancelled {
+		return fmt.Errorf("order %s is %s after cancelling", order.ID, order.Status)
+	}
+	return nil
+}
+
+// send sends a request to the instance and returns the body of a response
+// with status want.
+func (s *scenario) send(ctx context.Context, method, path, contentType string, body io.Reader, auth bool, want int) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, method, s.base.String()+path, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", "smoketest")
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if auth {
+		request.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	response, err := s.http.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != want {
+		return nil, fmt.Errorf("%s %s: %d %s", method, path, response.StatusCode, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
@@ -0,0 +1,63 @@
+package smoketest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunSkipsAfterFailure(t *testing.T) {
+	app := fiber.New()
+	app.Get("/readyz", func(c *fiber.Ctx) error { return c.SendString("ready") })
+	app.Get("/api/me", func(c *fiber.Ctx) error { return fiber.ErrUnauthorized })
+
+	results := Run(context.Background(), Options{
+		BaseURL:    "http://shop.example/",
+		Token:      "expired",
+		HTTPClient: &http.Client{Transport: testkit.Transport(app)},
+	})
+	assert.False(t, Passed(results))
+	assert.Len(t, results, len(steps))
+	assert.Nil(t, results[0].Err)
+	assert.EqualError(t, results[1].Err, "GET /api/me: 401 Unauthorized")
+	for _, result := range results[2:] {
+		assert.True(t, result.Skipped, result.Name)
+	}
+
+	results = Run(context.Background(), Options{BaseURL: "shop.example"})
+	assert.EqualError(t, results[0].Err, `invalid base URL "shop.example"`)
+}
+
+func TestReports(t *testing.T) {
+	results := []Result{
+		{Name: "ready", Duration: 1500 * time.Millisecond},
+		{Name: "sign in", Duration: 20 * time.Millisecond, Err: errors.New(`GET /api/me: 401 <"Unauthorized">`)},
+		{Name: "create order", Skipped: true},
+	}
+
+	var junit bytes.Buffer
+	assert.Nil(t, WriteJUnit(&junit, "smoketest", results))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuite name="smoketest" tests="3" failures="1" skipped="1" time="1.520">
+  <testcase name="ready" classname="smoketest" time="1.500"></testcase>
+  <testcase name="sign in" classname="smoketest" time="0.020">
+    <failure message="GET /api/me: 401 &lt;&#34;Unauthorized&#34;&gt;">GET /api/me: 401 &lt;&#34;Unauthorized&#34;&gt;</failure>
+  </testcase>
+  <testcase name="create order" classname="smoketest" time="0.000">
+    <skipped></skipped>
+  </testcase>
+</testsuite>
+`, junit.String())
+
+	var text bytes.Buffer
+	assert.Nil(t, WriteText(&text, results))
+	assert.Regexp(t, regexp.MustCompile(`^ok +ready +1.5s *\nFAIL +sign in +20ms +GET /api/me: 401 <"Unauthorized">\nSKIP +create order *\n$`), text.String())
+}
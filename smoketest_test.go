@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/smoketest"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSmoketest keeps the post-deploy scenario passing against the app.
+func TestSmoketest(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Log.Level = "error"
+	cfg.JWT.KeyFiles = []string{writeJWTKey(t)}
+	cfg.Database.SQLitePath = filepath.Join(dir, "app.db")
+	cfg.Uploads.Dir = filepath.Join(dir, "uploads")
+	app, err := newApp(cfg)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	defer app.Shutdown()
+	tokens, err := auth.New(cfg.JWT, nil, nil)
+	assert.Nil(t, err)
+	token, err := tokens.Sign("smoketest", userScopes...)
+	assert.Nil(t, err)
+
+	results := smoketest.Run(context.Background(), smoketest.Options{
+		BaseURL:    "http://shop.example",
+		Token:      token,
+		HTTPClient: &http.Client{Transport: testkit.Transport(app)},
+	})
+	for _, result := range results {
+		assert.Nil(t, result.Err, result.Name)
+	}
+	assert.True(t, smoketest.Passed(results))
+	assert.Len(t, results, 8)
+}
@@ -0,0 +1,158 @@
+// Package sse serves server-sent event streams.
+//
+// fasthttp writes a streamed body from a goroutine of its own, after the
+// handler returned and out of reach of reporting.Recover, so a panic
+// while streaming would take the whole process down. Serve isolates each
+// connection instead: a panic or an error ends that stream alone, is
+// reported like one of a handler, and is sent to the client as an error
+// event advising when to reconnect, after which the stream's resources
+// are released.
+package sse
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/reporting"
+)
+
+// EventError is the event a stream ends with when it fails.
+const EventError = "error"
+
+// ErrClosed is returned by Send once the client has gone.
+var ErrClosed = errors.New("sse: stream closed")
+
+// Failure is the data of an error event. Message is the one of a
+// fiber.Error, or "internal error" for anything else, which is reported.
+type Failure struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	RetryMs int64  `json:"retry_ms"`
+}
+
+// Stream is the connection of one client.
+type Stream struct {
+	ctx     context.Context
+	w       *bufio.Writer
+	cleanup []func()
+	closed  bool
+}
+
+// Context is done once the stream ended, however it did.
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// OnClose runs fn when the stream ends, last added first, also after a
+// panic.
+func (s *Stream) OnClose(fn func()) {
+	s.cleanup = append(s.cleanup, fn)
+}
+
+// Send writes an event with data as JSON and flushes it to the client.
+// Without a name it is a "message" event.
+func (s *Stream) Send(event string, data any) error {
+	if s.closed {
+		return ErrClosed
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if event != "" {
+		fmt.Fprintf(s.w, "event: %s\n", event)
+	}
+	fmt.Fprintf(s.w, "data: %s\n\n", encoded)
+	return s.flush()
+}
+
+func (s *Stream) flush() error {
+	if err := s.w.Flush(); err != nil {
+		s.closed = true
+		return ErrClosed
+	}
+	return nil
+}
+
+// Serve answers c with a stream run writes events to until it returns.
+// Clients are told to wait retry before reconnecting.
+func Serve(c *fiber.Ctx, reporter reporting.Reporter, retry time.Duration, run func(s *Stream) error) error {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	// c is recycled before the stream ends, so what a report needs of the
+	// request is copied now.
+	template := reporting.NewEvent(c, nil)
+	template.Method = utils.CopyString(template.Method)
+	template.UserID = utils.CopyString(template.UserID)
+	template.RequestID = utils.CopyString(template.RequestID)
+	md := correlation.From(c.UserContext())
+	for name, value := range md {
+		md[name] = utils.CopyString(value)
+	}
+	ctx, cancel := context.WithCancel(correlation.With(correlation.Detach(c.UserContext()), md))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		s := &Stream{ctx: ctx, w: w}
+		defer func() {
+			cancel()
+			for i := len(s.cleanup) - 1; i >= 0; i-- {
+				s.cleanup[i]()
+			}
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				panicErr, ok := r.(error)
+				if !ok {
+					panicErr = fmt.Errorf("%v", r)
+				}
+				event := template
+				event.Time = time.Now()
+				event.Err = fmt.Errorf("panic: %w", panicErr)
+				// The stack skips this function, the deferred call and
+				// runtime.gopanic.
+				event.Stack = reporting.Stack(3)
+				reporter.Report(ctx, event)
+				s.fail(fiber.StatusInternalServerError, "internal error", retry)
+			}
+		}()
+
+		fmt.Fprintf(w, "retry: %d\n\n", retry.Milliseconds())
+		if s.flush() != nil {
+			return
+		}
+		err := run(s)
+		var fiberErr *fiber.Error
+		switch {
+		case err == nil, errors.Is(err, ErrClosed), errors.Is(err, context.Canceled):
+		case errors.As(err, &fiberErr):
+			s.fail(fiberErr.Code, fiberErr.Message, retry)
+		default:
+			event := template
+			event.Time = time.Now()
+			event.Err = err
+			reporter.Report(ctx, event)
+			s.fail(fiber.StatusInternalServerError, "internal error", retry)
+		}
+	})
+	return nil
+}
+
+// fail ends the stream with an error event and reconnection advice, if
+// the client is still there.
+func (s *Stream) fail(status int, message string, retry time.Duration) {
+	if s.closed {
+		return
+	}
+	fmt.Fprintf(s.w, "retry: %d\n", retry.Milliseconds())
+	s.Send(EventError, Failure{Status: status, Message: message, RetryMs: retry.Milliseconds()})
+}
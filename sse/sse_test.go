@@ -0,0 +1,106 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/reporting"
+	"github.com/stretchr/testify/assert"
+)
+
+type reports struct {
+	mu     sync.Mutex
+	events []reporting.Event
+}
+
+func (r *reports) Report(_ context.Context, event reporting.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *reports) all() []reporting.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]reporting.Event(nil), r.events...)
+}
+
+func stream(t *testing.T, run func(s *Stream) error) (string, *reports) {
+	reporter := &reports{}
+	app := fiber.New()
+	app.Get("/events", func(c *fiber.Ctx) error {
+		return Serve(c, reporter, 3*time.Second, run)
+	})
+	response, err := app.Test(httptest.NewRequest("GET", "/events", nil), -1)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	return string(body), reporter
+}
+
+func TestServe(t *testing.T) {
+	closed := false
+	body, reporter := stream(t, func(s *Stream) error {
+		s.OnClose(func() { closed = true })
+		assert.Nil(t, s.Send("", map[string]int{"n": 1}))
+		return s.Send("tick", map[string]int{"n": 2})
+	})
+	assert.Equal(t, "retry: 3000\n\ndata: {\"n\":1}\n\nevent: tick\ndata: {\"n\":2}\n\n", body)
+	assert.True(t, closed)
+	assert.Empty(t, reporter.all())
+}
+
+func TestPanicIsolated(t *testing.T) {
+	var ctx context.Context
+	var cleanup []string
+	body, reporter := stream(t, func(s *Stream) error {
+		ctx = s.Context()
+		s.OnClose(func() { cleanup = append(cleanup, "subscription") })
+		s.OnClose(func() { cleanup = append(cleanup, "ticker") })
+		assert.Nil(t, s.Send("", "before"))
+		var snapshots map[string]int
+		snapshots["n"]++
+		return nil
+	})
+
+	// The panic ends this stream alone, with advice to reconnect.
+	assert.Equal(t, "retry: 3000\n\ndata: \"before\"\n\n"+
+		"retry: 3000\nevent: error\ndata: {\"status\":500,\"message\":\"internal error\",\"retry_ms\":3000}\n\n", body)
+	assert.Equal(t, []string{"ticker", "subscription"}, cleanup)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	events := reporter.all()
+	if assert.Len(t, events, 1) {
+		assert.True(t, strings.HasPrefix(events[0].Err.Error(), "panic: assignment to entry in nil map"))
+		assert.Equal(t, "GET", events[0].Method)
+		assert.Equal(t, "/events", events[0].Route)
+		assert.NotEmpty(t, events[0].Stack)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	body, reporter := stream(t, func(s *Stream) error {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "shutting down")
+	})
+	assert.Contains(t, body, "event: error\ndata: {\"status\":503,\"message\":\"shutting down\",\"retry_ms\":3000}")
+	assert.Empty(t, reporter.all())
+
+	body, reporter = stream(t, func(s *Stream) error {
+		return errors.New("broker connection lost")
+	})
+	assert.Contains(t, body, `{"status":500,"message":"internal error","retry_ms":3000}`)
+	assert.NotContains(t, body, "broker")
+	if assert.Len(t, reporter.all(), 1) {
+		assert.EqualError(t, reporter.all()[0].Err, "broker connection lost")
+	}
+}
@@ -0,0 +1,25 @@
+package testkit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/stretchr/testify/assert"
+)
+
+// OpenDB opens a private in-memory SQLite database with the tables of
+// migrations, closed when the test ends.
+func OpenDB(t testing.TB, migrations ...database.Migration) *database.DB {
+	t.Helper()
+	db, err := database.Open(config.DatabaseConfig{SQLitePath: ":memory:"}, nil)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { db.Close() })
+	if !assert.Nil(t, db.Migrate(context.Background(), migrations...)) {
+		t.FailNow()
+	}
+	return db
+}
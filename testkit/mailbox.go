@@ -0,0 +1,131 @@
+package testkit
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Mail is a message the Mailbox received.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailbox is an SMTP server standing in for the app's mail server. It
+// accepts every message and keeps it. It is closed when the test ends.
+type Mailbox struct {
+	Addr string
+	t    testing.TB
+
+	mu       sync.Mutex
+	messages []Mail
+}
+
+func newMailbox(t testing.TB) *Mailbox {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { ln.Close() })
+	m := &Mailbox{Addr: ln.Addr().String(), t: t}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+	return m
+}
+
+// serve speaks just enough SMTP for net/smtp to deliver to it.
+func (m *Mailbox) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case command == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			m.receive(data.String())
+			reply("250 ok")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (m *Mailbox) receive(data string) {
+	message, err := mail.ReadMessage(strings.NewReader(data))
+	if !assert.Nil(m.t, err) {
+		return
+	}
+	body, err := io.ReadAll(message.Body)
+	if !assert.Nil(m.t, err) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, Mail{
+		To:      message.Header.Get("To"),
+		Subject: message.Header.Get("Subject"),
+		Body:    strings.ReplaceAll(string(body), "\r\n", "\n"),
+	})
+}
+
+// Messages returns the messages received so far.
+func (m *Mailbox) Messages() []Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Mail{}, m.messages...)
+}
+
+// WaitFor waits until n messages were received, failing the test if they
+// don't arrive in time, and returns them.
+func (m *Mailbox) WaitFor(n int) []Mail {
+	m.t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		messages := m.Messages()
+		if len(messages) >= n {
+			return messages
+		}
+		if time.Now().After(deadline) {
+			m.t.Fatalf("testkit: mailbox received %d messages, expected %d", len(messages), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
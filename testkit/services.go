@@ -0,0 +1,463 @@
+package testkit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// waitTimeout is how long Mock.WaitFor waits for requests sent in the
+// background, such as webhooks.
+const waitTimeout = 5 * time.Second
+
+// Received is a request a mock received.
+type Received struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// JSON decodes the body into out.
+func (r Received) JSON(t testing.TB, out any) {
+	t.Helper()
+	assert.Nil(t, json.Unmarshal(r.Body, out), "body: %s", r.Body)
+}
+
+// Mock is an HTTP server standing in for a service the app calls. It
+// records the requests it receives before handling them. It is closed
+// when the test ends.
+type Mock struct {
+	*httptest.Server
+	t testing.TB
+
+	mu       sync.Mutex
+	handler  http.Handler
+	requests []Received
+}
+
+// NewMock serves handler, or answers 204 No Content without one.
+func NewMock(t testing.TB, handler http.Handler) *Mock {
+	m := &Mock{t: t, handler: handler}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *Mock) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	m.mu.Lock()
+	m.requests = append(m.requests, Received{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	handler := m.handler
+	m.mu.Unlock()
+	if handler == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// Handle replaces the handler, for instance to make the service fail.
+func (m *Mock) Handle(handler http.Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handler = handler
+}
+
+// Respond makes the mock answer every request with status and body.
+func (m *Mock) Respond(status int, body string) {
+	m.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+}
+
+// Requests returns the requests received so far.
+func (m *Mock) Requests() []Received {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Received{}, m.requests...)
+}
+
+// WaitFor waits until n requests were received, failing the test if they
+// don't arrive in time, and returns them.
+func (m *Mock) WaitFor(n int) []Received {
+	m.t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		requests := m.Requests()
+		if len(requests) >= n {
+			return requests
+		}
+		if time.Now().After(deadline) {
+			m.t.Fatalf("testkit: %s received %d requests, expected %d", m.URL, len(requests), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Reset forgets the requests received so far.
+func (m *Mock) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = nil
+}
+
+// Services are the mocks of the external services an app depends on,
+// started as a test asks for them. Configure points a config at those
+// started:
+//
+//	services := testkit.NewServices(t)
+//	idp := services.IdP()
+//	cfg := config.Default()
+//	services.Configure(cfg)
+type Services struct {
+	t testing.TB
+
+	mu        sync.Mutex
+	idp       *IdP
+	payments  *PaymentProvider
+	mailbox   *Mailbox
+	consumers map[string]*WebhookConsumer
+	sources   map[string]*Mock
+}
+
+func NewServices(t testing.TB) *Services {
+	return &Services{t: t, consumers: map[string]*WebhookConsumer{}, sources: map[string]*Mock{}}
+}
+
+// IdP returns the OpenID provider users log in with.
+func (s *Services) IdP() *IdP {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.idp == nil {
+		s.idp = newIdP(s.t)
+	}
+	return s.idp
+}
+
+// PaymentProvider returns the payment provider.
+func (s *Services) PaymentProvider() *PaymentProvider {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.payments == nil {
+		s.payments = &PaymentProvider{Mock: NewMock(s.t, nil), Secret: "payments-secret"}
+	}
+	return s.payments
+}
+
+// Mailbox returns the mail server.
+func (s *Services) Mailbox() *Mailbox {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mailbox == nil {
+		s.mailbox = newMailbox(s.t)
+	}
+	return s.mailbox
+}
+
+// WebhookConsumer returns the receiver of webhooks of name, such as a
+// user's notification endpoint.
+func (s *Services) WebhookConsumer(name string) *WebhookConsumer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	consumer, ok := s.consumers[name]
+	if !ok {
+		consumer = &WebhookConsumer{Mock: NewMock(s.t, nil), Secret: "notifications-secret"}
+		s.consumers[name] = consumer
+	}
+	return consumer
+}
+
+// DashboardSource returns the JSON endpoint of the dashboard source name,
+// answering with body.
+func (s *Services) DashboardSource(name, body string) *Mock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	source, ok := s.sources[name]
+	if !ok {
+		source = NewMock(s.t, nil)
+		s.sources[name] = source
+	}
+	source.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+	return source
+}
+
+// Configure points cfg at the services started so far:
+//
+//   - the IdP as the OIDC issuer, and as the external issuer whose
+//     tokens the API accepts
+//   - the payment provider as the sandbox's base URL, so the webhooks
+//     the sandbox sends are recorded by it
+//   - the mailbox as the SMTP server
+//   - the secret notification webhooks are signed with
+//   - the dashboard sources
+func (s *Services) Configure(cfg *config.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.idp != nil {
+		cfg.OIDC.Issuer = s.idp.URL
+		cfg.OIDC.ClientID = s.idp.ClientID
+		cfg.OIDC.ClientSecret = s.idp.ClientSecret
+		if cfg.OIDC.RedirectURL == "" {
+			cfg.OIDC.RedirectURL = "http://app.test/auth/oidc/callback"
+		}
+		cfg.JWT.JWKSURL = s.idp.URL + "/jwks"
+		cfg.JWT.ExternalIssuer = s.idp.URL
+	}
+	if s.payments != nil {
+		cfg.Payments.Provider = "sandbox"
+		cfg.Payments.BaseURL = s.payments.URL
+		cfg.Payments.WebhookSecret = s.payments.Secret
+	}
+	if s.mailbox != nil {
+		cfg.Mail.SMTPAddr = s.mailbox.Addr
+		if cfg.Mail.From == "" {
+			cfg.Mail.From = "app@app.test"
+		}
+	}
+	for _, consumer := range s.consumers {
+		cfg.Notify.WebhookSecret = consumer.Secret
+	}
+	for name, source := range s.sources {
+		cfg.Dashboard.Sources = append(cfg.Dashboard.Sources, config.DashboardSource{Name: name, URL: source.URL})
+	}
+}
+
+// WebhookConsumer receives webhooks the app signs with Secret.
+type WebhookConsumer struct {
+	*Mock
+	Secret string
+}
+
+// PaymentProvider stands in for the payment provider: the sandbox's
+// webhooks are delivered to it, and Webhook builds the webhooks it would
+// send the app, signed with Secret like the sandbox signs them.
+type PaymentProvider struct {
+	*Mock
+	Secret string
+}
+
+// Webhook returns a request reporting the outcome of an intent to the
+// app's webhook, to send with Send.
+func (p *PaymentProvider) Webhook(intentID, status string) *http.Request {
+	body, _ := json.Marshal(map[string]string{"id": "evt_" + randomHex(), "intent_id": intentID, "status": status})
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(p.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	request := httptest.NewRequest(http.MethodPost, "/payments/webhook", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Sandbox-Signature", "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+	return request
+}
+
+// IdP is an OpenID provider that approves every login. Its ID tokens and
+// access tokens are signed with an RSA key published at /jwks.
+type IdP struct {
+	*Mock
+	ClientID     string
+	ClientSecret string
+
+	key *rsa.PrivateKey
+	kid string
+
+	mu     sync.Mutex
+	logins map[string]idpLogin
+}
+
+// idpLogin is a login waiting for its code to be redeemed.
+type idpLogin struct {
+	subject   string
+	nonce     string
+	challenge string
+	claims    map[string]any
+}
+
+func newIdP(t testing.TB) *IdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	p := &IdP{ClientID: "app", ClientSecret: "app-secret", key: key, kid: "idp-" + randomHex()[:8], logins: map[string]idpLogin{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.Mock = NewMock(t, mux)
+	return p
+}
+
+// Login approves the login the app redirected to, at location, for
+// subject with extra claims, and returns the URL of the app's callback the
+// IdP redirects back to.
+func (p *IdP) Login(location, subject string, claims map[string]any) string {
+	p.t.Helper()
+	callback, err := p.approve(location, subject, claims)
+	if !assert.Nil(p.t, err) {
+		p.t.FailNow()
+	}
+	return callback
+}
+
+func (p *IdP) approve(location, subject string, claims map[string]any) (string, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	if query.Get("client_id") != p.ClientID {
+		return "", fmt.Errorf("testkit: login for client %q, expected %q", query.Get("client_id"), p.ClientID)
+	}
+	if query.Get("code_challenge_method") != "S256" {
+		return "", errors.New("testkit: login without an S256 code challenge")
+	}
+	callback, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		return "", err
+	}
+	code := randomHex()
+	p.mu.Lock()
+	p.logins[code] = idpLogin{subject: subject, nonce: query.Get("nonce"), challenge: query.Get("code_challenge"), claims: claims}
+	p.mu.Unlock()
+
+	values := callback.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	callback.RawQuery = values.Encode()
+	return callback.String(), nil
+}
+
+// Token returns an access token the IdP issued to subject, which the API
+// accepts once Configure made the IdP its external issuer.
+func (p *IdP) Token(subject string, claims map[string]any) string {
+	p.t.Helper()
+	token, err := p.sign(subject, claims)
+	assert.Nil(p.t, err)
+	return token
+}
+
+func (p *IdP) sign(subject string, extra map[string]any) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": p.URL,
+		"sub": subject,
+		"aud": p.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for name, value := range extra {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.kid
+	return token.SignedString(p.key)
+}
+
+func (p *IdP) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 p.URL,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/jwks",
+	})
+}
+
+func (p *IdP) jwks(w http.ResponseWriter, r *http.Request) {
+	encode := base64.RawURLEncoding.EncodeToString
+	json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"alg": "RS256",
+		"use": "sig",
+		"kid": p.kid,
+		"n":   encode(p.key.N.Bytes()),
+		"e":   encode(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+// authorize approves logins made in a browser, for the user named by the
+// login_hint parameter.
+func (p *IdP) authorize(w http.ResponseWriter, r *http.Request) {
+	subject := r.URL.Query().Get("login_hint")
+	if subject == "" {
+		subject = "user"
+	}
+	callback, err := p.approve(r.URL.String(), subject, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, callback, http.StatusFound)
+}
+
+func (p *IdP) token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(reason string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": reason})
+	}
+	if r.PostFormValue("client_id") != p.ClientID || r.PostFormValue("client_secret") != p.ClientSecret {
+		fail("invalid_client")
+		return
+	}
+	code := r.PostFormValue("code")
+	p.mu.Lock()
+	login, ok := p.logins[code]
+	delete(p.logins, code)
+	p.mu.Unlock()
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != login.challenge {
+		fail("invalid_grant")
+		return
+	}
+	claims := map[string]any{"nonce": login.nonce}
+	for name, value := range login.claims {
+		claims[name] = value
+	}
+	idToken, err := p.sign(login.subject, claims)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func randomHex() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,214 @@
+// Package testkit sends requests to a Fiber app from tests and checks the
+// responses, so tests state what they send and expect rather than how
+// requests are built and bodies read.
+//
+//	var user User
+//	testkit.DoJSON(t, app, "POST", "/users", NewUser{Name: "jalal"}, &user, testkit.WithAuth(token)).
+//		AssertStatus(201)
+package testkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// Option changes a request before it is sent.
+type Option func(request *http.Request)
+
+func WithHeader(name, value string) Option {
+	return func(request *http.Request) { request.Header.Set(name, value) }
+}
+
+// WithAuth sends token as a bearer token.
+func WithAuth(token string) Option {
+	return WithHeader(fiber.HeaderAuthorization, "Bearer "+token)
+}
+
+// HeaderUser is the header FakeAuth takes the request's user from.
+const HeaderUser = "X-User"
+
+// WithUser sends the request as user, to an app that authenticates with
+// FakeAuth.
+func WithUser(user string) Option {
+	return WithHeader(HeaderUser, user)
+}
+
+// FakeAuth stands in for authentication in tests of what comes after it:
+// the user named in the X-User header becomes the request's user.
+func FakeAuth(c *fiber.Ctx) error {
+	ctxutil.SetCurrentUser(c, c.Get(HeaderUser))
+	return c.Next()
+}
+
+func WithBasicAuth(user, password string) Option {
+	return func(request *http.Request) { request.SetBasicAuth(user, password) }
+}
+
+func WithCookie(cookie *http.Cookie) Option {
+	return func(request *http.Request) { request.AddCookie(cookie) }
+}
+
+// Response is a response with its body read.
+type Response struct {
+	t          testing.TB
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	cookies    []*http.Cookie
+}
+
+// Send sends request to app, failing the test if app can't answer it.
+func Send(t testing.TB, app *fiber.App, request *http.Request) *Response {
+	t.Helper()
+	response, err := app.Test(request)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	return &Response{t: t, StatusCode: response.StatusCode, Header: response.Header, Body: body, cookies: response.Cookies()}
+}
+
+// Transport sends the requests of an http.Client to app instead of over
+// the network, for clients such as gen/client.
+func Transport(app *fiber.App) http.RoundTripper {
+	return roundTripper(func(request *http.Request) (*http.Response, error) {
+		return app.Test(request, -1)
+	})
+}
+
+type roundTripper func(request *http.Request) (*http.Response, error)
+
+func (fn roundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	return fn(request)
+}
+
+// Do sends a request with body, which may be nil, to app.
+func Do(t testing.TB, app *fiber.App, method, path string, body io.Reader, options ...Option) *Response {
+	t.Helper()
+	request := httptest.NewRequest(method, path, body)
+	for _, option := range options {
+		option(request)
+	}
+	return Send(t, app, request)
+}
+
+// DoJSON sends body encoded as JSON, unless it is nil, or a string, which
+// is sent as is. The response is decoded into out unless it is nil or the
+// response has no body.
+func DoJSON(t testing.TB, app *fiber.App, method, path string, body, out any, options ...Option) *Response {
+	t.Helper()
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(body)
+	default:
+		data, err := json.Marshal(body)
+		assert.Nil(t, err)
+		reader = bytes.NewReader(data)
+	}
+	options = append([]Option{WithHeader(fiber.HeaderContentType, fiber.MIMEApplicationJSON)}, options...)
+	response := Do(t, app, method, path, reader, options...)
+	if out != nil && len(response.Body) > 0 {
+		response.JSON(out)
+	}
+	return response
+}
+
+// DoForm sends values URL-encoded, as an HTML form does.
+func DoForm(t testing.TB, app *fiber.App, method, path string, values url.Values, options ...Option) *Response {
+	t.Helper()
+	options = append([]Option{WithHeader(fiber.HeaderContentType, fiber.MIMEApplicationForm)}, options...)
+	return Do(t, app, method, path, strings.NewReader(values.Encode()), options...)
+}
+
+// File is a file sent in a multipart form.
+type File struct {
+	Field string
+	Name  string
+	Data  []byte
+}
+
+// Multipart encodes fields and files as a multipart form, returning the
+// body and the option setting its content type.
+func Multipart(t testing.TB, fields map[string]string, files ...File) (io.Reader, Option) {
+	t.Helper()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	for name, value := range fields {
+		assert.Nil(t, writer.WriteField(name, value))
+	}
+	for _, file := range files {
+		part, err := writer.CreateFormFile(file.Field, file.Name)
+		assert.Nil(t, err)
+		part.Write(file.Data)
+	}
+	assert.Nil(t, writer.Close())
+	return body, WithHeader(fiber.HeaderContentType, writer.FormDataContentType())
+}
+
+func (r *Response) String() string {
+	return string(r.Body)
+}
+
+// JSON decodes the body into out.
+func (r *Response) JSON(out any) *Response {
+	r.t.Helper()
+	assert.Nil(r.t, json.Unmarshal(r.Body, out), "body: %s", r.Body)
+	return r
+}
+
+// Cookie returns the cookie the response sets under name, or nil.
+func (r *Response) Cookie(name string) *http.Cookie {
+	for _, cookie := range r.cookies {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func (r *Response) AssertStatus(status int) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, status, r.StatusCode, "body: %s", r.Body)
+	return r
+}
+
+func (r *Response) AssertBody(body string) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, body, string(r.Body))
+	return r
+}
+
+func (r *Response) AssertContains(text string) *Response {
+	r.t.Helper()
+	assert.Contains(r.t, string(r.Body), text)
+	return r
+}
+
+// AssertJSON checks the body is the JSON document expected, regardless of
+// formatting and key order.
+func (r *Response) AssertJSON(expected string) *Response {
+	r.t.Helper()
+	assert.JSONEq(r.t, expected, string(r.Body))
+	return r
+}
+
+func (r *Response) AssertHeader(name, value string) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, value, r.Header.Get(name), name)
+	return r
+}
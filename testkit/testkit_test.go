@@ -0,0 +1,78 @@
+package testkit
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDo(t *testing.T) {
+	app := fiber.New()
+	app.Post("/echo", func(c *fiber.Ctx) error {
+		var body struct {
+			Name string `json:"name" form:"name"`
+			Auth string `json:"auth"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return err
+		}
+		body.Auth = c.Get(fiber.HeaderAuthorization)
+		c.Cookie(&fiber.Cookie{Name: "seen", Value: "yes"})
+		return c.Status(201).JSON(body)
+	})
+	app.Post("/form", func(c *fiber.Ctx) error {
+		file, err := c.FormFile("file")
+		if err != nil {
+			return err
+		}
+		return c.SendString(c.FormValue("name") + ":" + file.Filename)
+	})
+
+	var out map[string]string
+	response := DoJSON(t, app, "POST", "/echo", map[string]string{"name": "jalal"}, &out, WithAuth("token")).
+		AssertStatus(201).
+		AssertJSON(`{"name":"jalal","auth":"Bearer token"}`)
+	assert.Equal(t, "jalal", out["name"])
+	assert.Equal(t, "yes", response.Cookie("seen").Value)
+	assert.Nil(t, response.Cookie("missing"))
+
+	DoForm(t, app, "POST", "/echo", url.Values{"name": {"akbar"}}).AssertContains(`"name":"akbar"`)
+
+	body, contentType := Multipart(t, map[string]string{"name": "akbar"}, File{Field: "file", Name: "contoh.txt", Data: []byte("x")})
+	Do(t, app, "POST", "/form", body, contentType).AssertStatus(200).AssertBody("akbar:contoh.txt")
+}
+
+func TestFakeAuth(t *testing.T) {
+	app := fiber.New()
+	app.Get("/whoami", FakeAuth, func(c *fiber.Ctx) error {
+		return c.SendString(ctxutil.CurrentUser(c))
+	})
+	Do(t, app, "GET", "/whoami", nil, WithUser("alice")).AssertBody("alice")
+	Do(t, app, "GET", "/whoami", nil).AssertBody("")
+}
+
+func TestMock(t *testing.T) {
+	mock := NewMock(t, nil)
+	go http.Post(mock.URL+"/hooks?x=1", "application/json", strings.NewReader(`{"a": 1}`))
+	received := mock.WaitFor(1)[0]
+	assert.Equal(t, "POST", received.Method)
+	assert.Equal(t, "/hooks", received.Path)
+	assert.Equal(t, "1", received.Query.Get("x"))
+	var body map[string]int
+	received.JSON(t, &body)
+	assert.Equal(t, 1, body["a"])
+
+	mock.Respond(http.StatusTeapot, "no")
+	response, err := http.Get(mock.URL)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusTeapot, response.StatusCode)
+	assert.Len(t, mock.Requests(), 2)
+	mock.Reset()
+	assert.Empty(t, mock.Requests())
+}
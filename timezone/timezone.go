@@ -0,0 +1,75 @@
+// Package timezone picks the time zone a request's user sees times in.
+// Times are kept and sent in UTC; only the strings shown to people, such
+// as in pages, are in the user's zone.
+package timezone
+
+import (
+	"errors"
+	"sync"
+	"time"
+	// So zones load on hosts without a zoneinfo database.
+	_ "time/tzdata"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+)
+
+// Header carries the client's IANA zone, such as Asia/Jakarta. It takes
+// precedence over the zone in the user's profile.
+const Header = "X-Timezone"
+
+// DisplayLayout is how times are shown, with the zone's abbreviation.
+const DisplayLayout = "2006-01-02 15:04:05 MST"
+
+var locations sync.Map
+
+// Load returns the zone called name, an IANA zone name. Unlike
+// time.LoadLocation it refuses "" and "Local", which would be UTC and the
+// server's zone.
+func Load(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, errors.New("timezone: not an IANA zone name")
+	}
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location), nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, location)
+	return location, nil
+}
+
+// Middleware sets ctxutil.Location to the zone in Header, or else the zone
+// profile returns for the authenticated user, or else UTC. An unknown zone
+// in Header is a 400; an unknown one in a profile is ignored. Run it after
+// the middleware authenticating the user.
+func Middleware(profile func(userID string) string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Vary(Header)
+		if name := c.Get(Header); name != "" {
+			location, err := Load(name)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "unknown time zone "+name)
+			}
+			ctxutil.SetLocation(c, location)
+			return c.Next()
+		}
+		if userID := ctxutil.CurrentUser(c); userID != "" && profile != nil {
+			if location, err := Load(profile(userID)); err == nil {
+				ctxutil.SetLocation(c, location)
+			}
+		}
+		return c.Next()
+	}
+}
+
+// Display shows t in location, as DisplayLayout, or nothing for the zero
+// time.
+func Display(t time.Time, location *time.Location) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(location).Format(DisplayLayout)
+}
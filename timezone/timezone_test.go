@@ -0,0 +1,40 @@
+package timezone
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	zones := map[string]string{"alice": "Asia/Jakarta", "bob": "Nowhere/Special"}
+	app := fiber.New()
+	app.Use(testkit.FakeAuth, Middleware(func(userID string) string { return zones[userID] }))
+	at := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(Display(at, ctxutil.Location(c)))
+	})
+
+	get := func(options ...testkit.Option) *testkit.Response {
+		return testkit.Do(t, app, "GET", "/", nil, options...)
+	}
+	get().AssertBody("2026-05-01 10:00:00 UTC")
+	response := get(testkit.WithUser("alice")).AssertBody("2026-05-01 17:00:00 WIB")
+	assert.Equal(t, Header, response.Header.Get("Vary"))
+	// The header wins over the profile.
+	get(testkit.WithUser("alice"), testkit.WithHeader(Header, "Europe/Berlin")).AssertBody("2026-05-01 12:00:00 CEST")
+	get(testkit.WithUser("bob")).AssertBody("2026-05-01 10:00:00 UTC")
+	get(testkit.WithHeader(Header, "Local")).AssertStatus(400)
+	get(testkit.WithHeader(Header, "../../etc/passwd")).AssertStatus(400)
+}
+
+func TestDisplay(t *testing.T) {
+	assert.Equal(t, "", Display(time.Time{}, time.UTC))
+	location, err := Load("America/New_York")
+	assert.Nil(t, err)
+	assert.Equal(t, "2026-01-15 07:30:00 EST", Display(time.Date(2026, 1, 15, 12, 30, 0, 0, time.UTC), location))
+}
@@ -0,0 +1,94 @@
+package timing
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+)
+
+var localsKey = ctxutil.NewKey[*Timings]("server-timing")
+
+// Timings collects the named phases of one request. It is safe to add to
+// from the goroutines a handler starts.
+type Timings struct {
+	mu     sync.Mutex
+	phases []phase
+}
+
+type phase struct {
+	name        string
+	description string
+	duration    time.Duration
+}
+
+func (t *Timings) Add(name string, duration time.Duration, description ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phases = append(t.phases, phase{name: name, description: strings.Join(description, " "), duration: duration})
+}
+
+// Header formats the phases as a Server-Timing header value.
+func (t *Timings) Header() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	metrics := make([]string, 0, len(t.phases))
+	for _, p := range t.phases {
+		metric := fmt.Sprintf("%s;dur=%.2f", token(p.name), float64(p.duration.Microseconds())/1000)
+		if p.description != "" {
+			metric += fmt.Sprintf(";desc=%q", p.description)
+		}
+		metrics = append(metrics, metric)
+	}
+	return strings.Join(metrics, ", ")
+}
+
+// Middleware makes From and Start available to handlers and emits the
+// Server-Timing header, including a "total" phase, once they are done.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		timings := &Timings{}
+		localsKey.Set(c, timings)
+
+		err := c.Next()
+
+		timings.Add("total", time.Since(start))
+		c.Set("Server-Timing", timings.Header())
+		return err
+	}
+}
+
+// From returns the request's timings. Without the middleware the returned
+// Timings still works but is never sent.
+func From(c *fiber.Ctx) *Timings {
+	if timings, ok := localsKey.Get(c); ok {
+		return timings
+	}
+	return &Timings{}
+}
+
+// Start begins a phase and returns the function that ends it:
+//
+//	defer timing.Start(c, "db")()
+func Start(c *fiber.Ctx, name string, description ...string) func() {
+	timings := From(c)
+	start := time.Now()
+	return func() {
+		timings.Add(name, time.Since(start), description...)
+	}
+}
+
+// token replaces characters that are not allowed in a metric name.
+func token(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,36 @@
+package timing
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerTimingHeader(t *testing.T) {
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Get("/users/:id", func(c *fiber.Ctx) error {
+		stop := Start(c, "db", "load user")
+		time.Sleep(5 * time.Millisecond)
+		stop()
+
+		From(c).Add("render", 2*time.Millisecond)
+		return c.SendString("user")
+	})
+
+	response, err := app.Test(httptest.NewRequest("GET", "/users/1", nil))
+	assert.Nil(t, err)
+	assert.Regexp(t,
+		regexp.MustCompile(`^db;dur=[0-9.]+;desc="load user", render;dur=2\.00, total;dur=[0-9.]+$`),
+		response.Header.Get("Server-Timing"))
+}
+
+func TestHeaderFormatting(t *testing.T) {
+	timings := &Timings{}
+	timings.Add("cache hit", 1500*time.Microsecond)
+	assert.Equal(t, "cache_hit;dur=1.50", timings.Header())
+}
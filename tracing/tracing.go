@@ -0,0 +1,263 @@
+// Package tracing traces requests with the OpenTelemetry SDK, in the W3C
+// trace context (traceparent) the app propagates to the services it calls.
+//
+// The decision is made twice. At the head, when a request starts a trace,
+// its Sampler samples it at the ratio configured for its route, while a
+// request that comes with a traceparent keeps its caller's decision. At
+// the tail, once the request is handled, a span processor keeps the span
+// of one that failed or was slow even if the head didn't sample it: the
+// span is exported, the request log carries its trace ID, and the
+// traceresponse header tells the caller.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	HeaderTraceParent   = "traceparent"
+	HeaderTraceResponse = "traceresponse"
+)
+
+const instrumentation = "github.com/jalal-akbar/belajar-golang-fiber/tracing"
+
+var traceKey = ctxutil.NewKey[*Trace]("tracing.trace")
+
+// Trace is the part of a trace a request is. ParentID is the span of the
+// caller, if any; SpanID the request's own, which the calls it makes
+// carry as their parent. Sampled is the head's decision, Kept the final
+// one.
+type Trace struct {
+	ID       string
+	SpanID   string
+	ParentID string
+	Sampled  bool
+	Kept     bool
+}
+
+// Tracer traces requests as configured for the app, exporting the spans
+// it keeps.
+type Tracer struct {
+	tail     config.TailSamplingConfig
+	provider *sdktrace.TracerProvider
+	tracer   oteltrace.Tracer
+}
+
+// New returns a Tracer deciding as cfg says and sending the spans it keeps
+// to exporter, if not nil.
+func New(cfg config.TracingConfig, exporter sdktrace.SpanExporter) *Tracer {
+	options := []sdktrace.TracerProviderOption{sdktrace.WithSampler(NewSampler(cfg))}
+	if exporter != nil {
+		options = append(options, sdktrace.WithSpanProcessor(&tailProcessor{
+			tail: cfg.Tail,
+			next: sdktrace.NewBatchSpanProcessor(exporter),
+		}))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+	return &Tracer{tail: cfg.Tail, provider: provider, tracer: provider.Tracer(instrumentation)}
+}
+
+// Exporter returns the OTLP/HTTP exporter to cfg.Endpoint, or nil without
+// one.
+func Exporter(cfg config.TracingConfig) (sdktrace.SpanExporter, error) {
+	if cfg.Endpoint == "" {
+		return nil, nil
+	}
+	return otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.Endpoint))
+}
+
+// Shutdown exports the spans still buffered and stops.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	return t.provider.Shutdown(ctx)
+}
+
+// Middleware continues or starts the trace of the request in a server
+// span, which handlers find in the user context, and passes it on in the
+// correlation metadata, which logging.Middleware must have stored before.
+func (t *Tracer) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := propagation.TraceContext{}.Extract(c.UserContext(), propagation.MapCarrier{
+			HeaderTraceParent: c.Get(HeaderTraceParent),
+		})
+		parent := oteltrace.SpanContextFromContext(ctx)
+		ctx, span := t.tracer.Start(ctx, c.Method(),
+			oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+			oteltrace.WithAttributes(semconv.HTTPRequestMethodKey.String(c.Method()), semconv.URLPath(c.Path())))
+		c.SetUserContext(ctx)
+		spanContext := span.SpanContext()
+		trace := Trace{
+			ID:      spanContext.TraceID().String(),
+			SpanID:  spanContext.SpanID().String(),
+			Sampled: spanContext.IsSampled(),
+		}
+		if parent.IsValid() {
+			trace.ParentID = parent.SpanID().String()
+		}
+		correlation.Set(ctx, HeaderTraceParent, format(trace.ID, trace.SpanID, trace.Sampled))
+		traceKey.Set(c, &trace)
+
+		err := c.Next()
+
+		status := responseStatus(c, err)
+		span.SetName(c.Method() + " " + c.Route().Path)
+		span.SetAttributes(semconv.HTTPRoute(c.Route().Path), semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+		span.End()
+		trace.Kept = trace.Sampled
+		if ended, ok := span.(sdktrace.ReadOnlySpan); ok && !trace.Sampled {
+			trace.Kept = keep(t.tail, ended)
+		}
+		c.Set(HeaderTraceResponse, format(trace.ID, trace.SpanID, trace.Kept))
+		return err
+	}
+}
+
+// From returns the trace of the request, once Middleware handled it.
+func From(c *fiber.Ctx) (Trace, bool) {
+	trace, ok := traceKey.Get(c)
+	if !ok {
+		return Trace{}, false
+	}
+	return *trace, true
+}
+
+// Sampler is the head sampler: a span with a parent follows the parent's
+// decision, a root span is sampled at the ratio of the longest prefix in
+// the routes of the config its url.path starts with, or the default one.
+// Spans it doesn't sample are still recorded when there is a tail to
+// decide on them.
+type Sampler struct {
+	cfg      config.TracingConfig
+	prefixes []string
+	ratios   map[string]sdktrace.Sampler
+	fallback sdktrace.Sampler
+}
+
+var _ sdktrace.Sampler = (*Sampler)(nil)
+
+func NewSampler(cfg config.TracingConfig) *Sampler {
+	s := &Sampler{cfg: cfg, ratios: map[string]sdktrace.Sampler{}, fallback: sdktrace.TraceIDRatioBased(cfg.DefaultRatio)}
+	for prefix, ratio := range cfg.Routes {
+		s.prefixes = append(s.prefixes, prefix)
+		s.ratios[prefix] = sdktrace.TraceIDRatioBased(ratio)
+	}
+	// Longest first, so the most specific prefix wins.
+	sort.Slice(s.prefixes, func(i, j int) bool { return len(s.prefixes[i]) > len(s.prefixes[j]) })
+	return s
+}
+
+func (s *Sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	parent := oteltrace.SpanContextFromContext(p.ParentContext)
+	sampled := parent.IsSampled()
+	if !parent.IsValid() {
+		path := ""
+		for _, attr := range p.Attributes {
+			if attr.Key == semconv.URLPathKey {
+				path = attr.Value.AsString()
+			}
+		}
+		sampled = s.ratio(path).ShouldSample(p).Decision == sdktrace.RecordAndSample
+	}
+	result := sdktrace.SamplingResult{Decision: sdktrace.Drop, Tracestate: parent.TraceState()}
+	switch {
+	case sampled:
+		result.Decision = sdktrace.RecordAndSample
+	case s.cfg.Tail.Errors || s.cfg.Tail.SlowerThan > 0:
+		result.Decision = sdktrace.RecordOnly
+	}
+	return result
+}
+
+func (s *Sampler) Description() string {
+	return "RouteRatio"
+}
+
+// ratio returns the head sampler of path.
+func (s *Sampler) ratio(path string) sdktrace.Sampler {
+	for _, prefix := range s.prefixes {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return s.ratios[prefix]
+		}
+	}
+	return s.fallback
+}
+
+// tailProcessor passes the spans the head sampled to next, and those it
+// didn't if keep says the tail wants them after all.
+type tailProcessor struct {
+	tail config.TailSamplingConfig
+	next sdktrace.SpanProcessor
+}
+
+func (p *tailProcessor) OnStart(ctx context.Context, span sdktrace.ReadWriteSpan) {
+	p.next.OnStart(ctx, span)
+}
+
+func (p *tailProcessor) OnEnd(span sdktrace.ReadOnlySpan) {
+	if span.SpanContext().IsSampled() {
+		p.next.OnEnd(span)
+	} else if keep(p.tail, span) {
+		p.next.OnEnd(kept{span})
+	}
+}
+
+func (p *tailProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *tailProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// kept is a span the tail keeps, marked sampled, as exporters only take
+// those.
+type kept struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (k kept) SpanContext() oteltrace.SpanContext {
+	spanContext := k.ReadOnlySpan.SpanContext()
+	return spanContext.WithTraceFlags(spanContext.TraceFlags().WithSampled(true))
+}
+
+// keep reports whether an ended span is worth keeping at the tail: it
+// failed, or took long.
+func keep(tail config.TailSamplingConfig, span sdktrace.ReadOnlySpan) bool {
+	return tail.Errors && span.Status().Code == codes.Error ||
+		tail.SlowerThan > 0 && span.EndTime().Sub(span.StartTime()) >= tail.SlowerThan
+}
+
+func format(id, spanID string, sampled bool) string {
+	flags := "00"
+	if sampled {
+		flags = "01"
+	}
+	return "00-" + id + "-" + spanID + "-" + flags
+}
+
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
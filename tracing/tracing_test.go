@@ -0,0 +1,131 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/correlation"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func newApp(tracer *Tracer) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(correlation.With(c.UserContext(), correlation.FromHeaders(c)))
+		return c.Next()
+	})
+	app.Use(tracer.Middleware())
+	// The traceparent calls made while handling the request would carry.
+	outbound := func(c *fiber.Ctx) error {
+		return c.SendString(correlation.From(c.UserContext())[HeaderTraceParent])
+	}
+	app.Get("/api/orders", outbound)
+	app.Get("/healthz", outbound)
+	app.Get("/fail", func(c *fiber.Ctx) error { return fiber.ErrBadGateway })
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	return app
+}
+
+// exported returns the names of the spans tracer exported to exporter.
+func exported(t *testing.T, tracer *Tracer, exporter *tracetest.InMemoryExporter) []string {
+	assert.Nil(t, tracer.provider.ForceFlush(context.Background()))
+	names := []string{}
+	for _, span := range exporter.GetSpans() {
+		assert.True(t, span.SpanContext.IsSampled())
+		names = append(names, span.Name)
+	}
+	exporter.Reset()
+	return names
+}
+
+func TestHeadSampling(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := New(config.TracingConfig{
+		DefaultRatio: 0.5,
+		Routes:       map[string]float64{"/api": 1, "/healthz": 0},
+	}, exporter)
+	app := newApp(tracer)
+
+	response := testkit.Do(t, app, "GET", "/api/orders", nil).AssertStatus(200)
+	traceparent := strings.Split(response.String(), "-")
+	assert.Len(t, traceparent, 4)
+	assert.Equal(t, "01", traceparent[3])
+	assert.Equal(t, response.String(), response.Header.Get(HeaderTraceResponse))
+	assert.Equal(t, []string{"GET /api/orders"}, exported(t, tracer, exporter))
+
+	response = testkit.Do(t, app, "GET", "/healthz", nil).AssertStatus(200)
+	assert.True(t, strings.HasSuffix(response.String(), "-00"))
+	assert.Empty(t, exported(t, tracer, exporter))
+
+	// A caller's trace is continued with its decision, whatever the
+	// route's ratio.
+	response = testkit.Do(t, app, "GET", "/healthz", nil, testkit.WithHeader(HeaderTraceParent, parent)).AssertStatus(200)
+	traceparent = strings.Split(response.String(), "-")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceparent[1])
+	assert.NotEqual(t, "00f067aa0ba902b7", traceparent[2])
+	assert.Equal(t, "01", traceparent[3])
+	assert.Equal(t, []string{"GET /healthz"}, exported(t, tracer, exporter))
+
+	// Invalid traceparents start a trace of their own.
+	for _, invalid := range []string{
+		"00-" + strings.Repeat("0", 32) + "-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz",
+	} {
+		response = testkit.Do(t, app, "GET", "/healthz", nil, testkit.WithHeader(HeaderTraceParent, invalid)).AssertStatus(200)
+		assert.NotContains(t, strings.ToLower(response.String()), "4bf92f3577b34da6a3ce929d0e0e4736", invalid)
+		assert.True(t, strings.HasSuffix(response.String(), "-00"), invalid)
+	}
+}
+
+func TestSamplerRatios(t *testing.T) {
+	sampler := NewSampler(config.TracingConfig{
+		DefaultRatio: 1,
+		Routes:       map[string]float64{"/api": 0, "/api/orders": 1},
+	})
+	decide := func(path string) sdktrace.SamplingDecision {
+		return sampler.ShouldSample(sdktrace.SamplingParameters{
+			ParentContext: context.Background(),
+			TraceID:       oteltrace.TraceID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			Attributes:    []attribute.KeyValue{semconv.URLPath(path)},
+		}).Decision
+	}
+	assert.Equal(t, sdktrace.RecordAndSample, decide("/api/orders/1"))
+	assert.Equal(t, sdktrace.Drop, decide("/api/users"))
+	assert.Equal(t, sdktrace.Drop, decide("/api"))
+	assert.Equal(t, sdktrace.RecordAndSample, decide("/apis"))
+	assert.Equal(t, sdktrace.RecordAndSample, decide("/"))
+}
+
+func TestTailSampling(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := New(config.TracingConfig{Tail: config.TailSamplingConfig{Errors: true, SlowerThan: 10 * time.Millisecond}}, exporter)
+	app := newApp(tracer)
+
+	response := testkit.Do(t, app, "GET", "/api/orders", nil).AssertStatus(200)
+	assert.True(t, strings.HasSuffix(response.String(), "-00"))
+	assert.True(t, strings.HasSuffix(response.Header.Get(HeaderTraceResponse), "-00"))
+	assert.Empty(t, exported(t, tracer, exporter))
+
+	response = testkit.Do(t, app, "GET", "/fail", nil).AssertStatus(502)
+	assert.True(t, strings.HasSuffix(response.Header.Get(HeaderTraceResponse), "-01"))
+	response = testkit.Do(t, app, "GET", "/slow", nil).AssertStatus(200)
+	assert.True(t, strings.HasSuffix(response.Header.Get(HeaderTraceResponse), "-01"))
+	assert.Equal(t, []string{"GET /fail", "GET /slow"}, exported(t, tracer, exporter))
+}
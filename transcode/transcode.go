@@ -0,0 +1,75 @@
+// Package transcode turns uploaded videos into renditions every browser
+// can play.
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Playlist is the name of the HLS playlist a Transcoder writes, next to
+// the segments it lists.
+const Playlist = "index.m3u8"
+
+// Transcoder writes an H.264 HLS rendition of the video at src into the
+// directory dir: Playlist and its segments.
+type Transcoder interface {
+	Transcode(ctx context.Context, src, dir string) error
+}
+
+// segmentSeconds is the target length of the HLS segments.
+const segmentSeconds = 6
+
+// FFmpeg transcodes by running the ffmpeg binary at path, for up to
+// timeout per video.
+type FFmpeg struct {
+	path    string
+	timeout time.Duration
+}
+
+func NewFFmpeg(path string, timeout time.Duration) *FFmpeg {
+	return &FFmpeg{path: path, timeout: timeout}
+}
+
+func (f *FFmpeg) Transcode(ctx context.Context, src, dir string) error {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, f.path, args(src, dir)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("transcode: %w", ctx.Err())
+		}
+		return fmt.Errorf("transcode: %w: %s", err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+// args has ffmpeg write H.264 video of at most 720 lines, and AAC audio
+// if there is any, in segments of a VOD playlist. Both dimensions are
+// kept even, which H.264 requires.
+func args(src, dir string) []string {
+	return []string{
+		"-hide_banner", "-loglevel", "error", "-nostdin", "-y",
+		"-i", src,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-vf", "scale=-2:'min(720,trunc(ih/2)*2)'",
+		"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "128k", "-ac", "2",
+		"-f", "hls", "-hls_time", fmt.Sprint(segmentSeconds), "-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, "segment%03d.ts"),
+		filepath.Join(dir, Playlist),
+	}
+}
+
+// lastLine is the last line ffmpeg wrote, which says what went wrong.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return lines[len(lines)-1]
+}
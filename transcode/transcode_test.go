@@ -0,0 +1,50 @@
+package transcode
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFFmpeg writes a script that stands in for ffmpeg, running body
+// with the playlist to write, the last argument, in $out.
+func fakeFFmpeg(t *testing.T, body string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell")
+	}
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	script := "#!/bin/sh\nfor out; do :; done\n" + body + "\n"
+	assert.Nil(t, os.WriteFile(path, []byte(script), 0o755))
+	return path
+}
+
+func TestFFmpeg(t *testing.T) {
+	dir := t.TempDir()
+	ffmpeg := NewFFmpeg(fakeFFmpeg(t, `printf '#EXTM3U\n' > "$out"`), time.Minute)
+	assert.Nil(t, ffmpeg.Transcode(context.Background(), "in.mp4", dir))
+	data, err := os.ReadFile(filepath.Join(dir, Playlist))
+	assert.Nil(t, err)
+	assert.Equal(t, "#EXTM3U\n", string(data))
+
+	ffmpeg = NewFFmpeg(fakeFFmpeg(t, "echo 'Input #0' >&2; echo 'in.mp4: Invalid data found when processing input' >&2; exit 1"), time.Minute)
+	assert.EqualError(t, ffmpeg.Transcode(context.Background(), "in.mp4", dir),
+		"transcode: exit status 1: in.mp4: Invalid data found when processing input")
+
+	ffmpeg = NewFFmpeg(fakeFFmpeg(t, "exec sleep 10"), 50*time.Millisecond)
+	assert.ErrorIs(t, ffmpeg.Transcode(context.Background(), "in.mp4", dir), context.DeadlineExceeded)
+
+	ffmpeg = NewFFmpeg(filepath.Join(dir, "missing"), time.Minute)
+	assert.NotNil(t, ffmpeg.Transcode(context.Background(), "in.mp4", dir))
+}
+
+func TestArgs(t *testing.T) {
+	got := args("/tmp/in", "/tmp/out")
+	assert.Equal(t, []string{"-i", "/tmp/in"}, got[5:7])
+	assert.Equal(t, "/tmp/out/segment%03d.ts", got[len(got)-2])
+	assert.Equal(t, "/tmp/out/index.m3u8", got[len(got)-1])
+}
@@ -0,0 +1,135 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// withOrientation puts an EXIF segment with orientation into a JPEG,
+// written in the byte order of order.
+func withOrientation(data []byte, orientation uint16, order binary.ByteOrder) []byte {
+	tiff := make([]byte, 8+2+2*12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+	// An unrelated tag first: 0x010F, the make, as ASCII.
+	order.PutUint16(tiff[10:], 0x010F)
+	order.PutUint16(tiff[12:], 2)
+	order.PutUint16(tiff[22:], 0x0112)
+	order.PutUint16(tiff[24:], 3)
+	order.PutUint32(tiff[26:], 1)
+	order.PutUint16(tiff[30:], orientation)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+// halves is a JPEG whose left half is red and right half blue.
+func halves(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}))
+	return buf.Bytes()
+}
+
+func TestOrientation(t *testing.T) {
+	data := halves(t, 8, 4)
+	assert.Equal(t, 1, Orientation(data))
+	assert.Equal(t, 6, Orientation(withOrientation(data, 6, binary.BigEndian)))
+	assert.Equal(t, 8, Orientation(withOrientation(data, 8, binary.LittleEndian)))
+	assert.Equal(t, 1, Orientation(withOrientation(data, 9, binary.BigEndian)))
+	assert.Equal(t, 1, Orientation(pngFile(t, 2, 2)))
+	// Truncated anywhere, it is read as upright rather than failing.
+	rotated := withOrientation(data, 6, binary.BigEndian)
+	for n := 0; n < 80; n++ {
+		assert.NotPanics(t, func() { Orientation(rotated[:n]) })
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// 3×2, numbered row by row: 1 2 3 / 4 5 6.
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		img.Pix[i*4] = uint8(i + 1)
+	}
+	pixels := func(img image.Image) (int, int, []uint8) {
+		rgba := img.(*image.RGBA)
+		var out []uint8
+		for i := 0; i < len(rgba.Pix); i += 4 {
+			out = append(out, rgba.Pix[i])
+		}
+		return rgba.Bounds().Dx(), rgba.Bounds().Dy(), out
+	}
+	for orientation, want := range map[int][]uint8{
+		1: {1, 2, 3, 4, 5, 6},
+		2: {3, 2, 1, 6, 5, 4},
+		3: {6, 5, 4, 3, 2, 1},
+		4: {4, 5, 6, 1, 2, 3},
+		5: {1, 4, 2, 5, 3, 6},
+		6: {4, 1, 5, 2, 6, 3},
+		7: {6, 3, 5, 2, 4, 1},
+		8: {3, 6, 2, 5, 1, 4},
+	} {
+		width, height, got := pixels(Orient(img, orientation))
+		assert.Equal(t, want, got, orientation)
+		if orientation >= 5 {
+			assert.Equal(t, [2]int{2, 3}, [2]int{width, height}, orientation)
+		} else {
+			assert.Equal(t, [2]int{3, 2}, [2]int{width, height}, orientation)
+		}
+	}
+}
+
+func TestImageTurnedUpright(t *testing.T) {
+	pipeline := New(config.Default().Uploads, NewDisk(t.TempDir(), "/files"))
+	ctx := context.Background()
+	// Taken with the phone on its side: red on the left becomes the top.
+	data := withOrientation(halves(t, 80, 40), 6, binary.BigEndian)
+	key, err := pipeline.Image(ctx, fileHeader(t, "photo.jpg", data), "avatars", 32)
+	assert.Nil(t, err)
+
+	src, err := pipeline.Storage().Open(ctx, key)
+	assert.Nil(t, err)
+	defer src.Close()
+	thumbnail, err := jpeg.Decode(src)
+	assert.Nil(t, err)
+	top, bottom := thumbnail.At(16, 4), thumbnail.At(16, 28)
+	r, _, b, _ := top.RGBA()
+	assert.Greater(t, r, b)
+	r, _, b, _ = bottom.RGBA()
+	assert.Greater(t, b, r)
+
+	stored, err := pipeline.File(ctx, fileHeader(t, "photo.jpg", data), "files")
+	assert.Nil(t, err)
+	assert.Equal(t, &ImageInfo{Width: 80, Height: 40, Orientation: 6}, stored.Image)
+	stored, err = pipeline.File(ctx, fileHeader(t, "notes.txt", []byte("catatan")), "files")
+	assert.Nil(t, err)
+	assert.Nil(t, stored.Image)
+}
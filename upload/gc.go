@@ -0,0 +1,112 @@
+package upload
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+)
+
+// GC removes stored files nothing refers to any more: those whose removal
+// was lost, as with jobs dropped on shutdown, and leftovers of uploads
+// that failed halfway. Only files under the prefixes of owners are looked
+// at, so other files in the same directory, like the SQLite database, are
+// safe; and only those older than grace, so uploads that are stored but
+// not yet recorded by their owner are too.
+type GC struct {
+	storage Storage
+	grace   time.Duration
+	logger  *slog.Logger
+	now     func() time.Time
+	removed *metrics.CounterVec
+
+	mu     sync.Mutex
+	owners map[string]func(key string) bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewGC(storage Storage, grace time.Duration, logger *slog.Logger, registry *metrics.Registry) *GC {
+	return &GC{
+		storage: storage,
+		grace:   grace,
+		logger:  logger,
+		now:     time.Now,
+		removed: registry.Counter("upload_gc_removed_total", "Stored files removed by the GC because nothing referred to them, by prefix.", "prefix"),
+		owners:  map[string]func(key string) bool{},
+		stop:    make(chan struct{}),
+	}
+}
+
+// Own has the GC look after the files under prefix, which are in use
+// while live says so.
+func (g *GC) Own(prefix string, live func(key string) bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.owners[strings.Trim(prefix, "/")] = live
+}
+
+// Collect removes the files no owner uses and returns how many. Storage
+// that can't list its files has nothing collected.
+func (g *GC) Collect(ctx context.Context) (int, error) {
+	lister, ok := g.storage.(Lister)
+	if !ok {
+		return 0, nil
+	}
+	g.mu.Lock()
+	owners := make(map[string]func(key string) bool, len(g.owners))
+	for prefix, live := range g.owners {
+		owners[prefix] = live
+	}
+	g.mu.Unlock()
+
+	removed := 0
+	cutoff := g.now().Add(-g.grace)
+	for prefix, live := range owners {
+		objects, err := lister.List(ctx, prefix)
+		if err != nil {
+			return removed, err
+		}
+		for _, object := range objects {
+			if object.ModTime.After(cutoff) || live(object.Key) {
+				continue
+			}
+			if err := g.storage.Delete(ctx, object.Key); err != nil {
+				return removed, err
+			}
+			g.removed.With(prefix).Inc()
+			g.logger.InfoContext(ctx, "orphaned upload removed", slog.String("key", object.Key))
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Start collects every interval until Stop.
+func (g *GC) Start(interval time.Duration) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-g.stop:
+				return
+			case <-ticker.C:
+			}
+			if _, err := g.Collect(context.Background()); err != nil {
+				g.logger.Error("upload GC failed", slog.String("error", err.Error()))
+			}
+		}
+	}()
+}
+
+func (g *GC) Stop() {
+	close(g.stop)
+	g.wg.Wait()
+}
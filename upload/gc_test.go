@@ -0,0 +1,58 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGC(t *testing.T) {
+	dir := t.TempDir()
+	disk := NewDisk(dir, "/files")
+	ctx := context.Background()
+	for _, key := range []string{"files/kept", "files/orphan", "files/.upload-123", "avatars/a.png", "files/new"} {
+		assert.Nil(t, disk.Put(ctx, key, strings.NewReader(key)))
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "app.db"), []byte("data"), 0o644))
+	// All but files/new were stored two hours ago.
+	old := time.Now().Add(-2 * time.Hour)
+	for _, key := range []string{"files/kept", "files/orphan", "files/.upload-123", "avatars/a.png"} {
+		assert.Nil(t, os.Chtimes(filepath.Join(dir, key), old, old))
+	}
+
+	objects, err := disk.List(ctx, "files")
+	assert.Nil(t, err)
+	assert.Len(t, objects, 4)
+	objects, err = disk.List(ctx, "missing")
+	assert.Nil(t, err)
+	assert.Empty(t, objects)
+
+	registry := metrics.NewRegistry()
+	gc := NewGC(disk, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)), registry)
+	gc.Own("files", func(key string) bool { return key == "files/kept" })
+	removed, err := gc.Collect(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, 2.0, registry.Counter("upload_gc_removed_total", "", "prefix").With("files").Value())
+
+	for key, exists := range map[string]bool{
+		"files/kept":        true,
+		"files/orphan":      false,
+		"files/.upload-123": false,
+		// Too new to tell, and of no owner.
+		"files/new":     true,
+		"avatars/a.png": true,
+		"app.db":        true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, key))
+		assert.Equal(t, exists, err == nil, key)
+	}
+}
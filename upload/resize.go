@@ -0,0 +1,63 @@
+package upload
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Fill scales img to cover width×height and crops the overflow evenly
+// from both sides. Each pixel of the result averages the source pixels it
+// covers, which is cheap and good enough for shrinking photos; enlarged
+// images are blocky.
+func Fill(img image.Image, width, height int) *image.RGBA {
+	bounds := img.Bounds()
+	// The largest centred part of img with the aspect ratio of the result.
+	crop := bounds
+	if bounds.Dx()*height > bounds.Dy()*width {
+		w := bounds.Dy() * width / height
+		crop.Min.X += (bounds.Dx() - w) / 2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		h := bounds.Dx() * height / width
+		crop.Min.Y += (bounds.Dy() - h) / 2
+		crop.Max.Y = crop.Min.Y + h
+	}
+	src := image.NewRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	draw.Draw(src, src.Bounds(), img, crop.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := span(y, height, crop.Dy())
+		for x := 0; x < width; x++ {
+			x0, x1 := span(x, width, crop.Dx())
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(row[sx*4])
+					g += uint64(row[sx*4+1])
+					b += uint64(row[sx*4+2])
+					a += uint64(row[sx*4+3])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// span returns the source pixels [from, to) that pixel i of n covers in a
+// source of size pixels, at least one.
+func span(i, n, size int) (int, int) {
+	from := i * size / n
+	to := (i + 1) * size / n
+	if to <= from {
+		to = from + 1
+	}
+	return from, to
+}
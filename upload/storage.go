@@ -0,0 +1,118 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Storage keeps processed uploads under keys and knows their public URLs.
+// Open returns an error matching fs.ErrNotExist for keys it doesn't hold.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// Object is a stored file, as a Lister lists it.
+type Object struct {
+	Key     string
+	ModTime time.Time
+}
+
+// Lister is a Storage that lists the files it holds under a prefix, which
+// the GC needs to find those nothing refers to.
+type Lister interface {
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// Disk stores uploads as files in a directory served at urlPrefix.
+type Disk struct {
+	dir       string
+	urlPrefix string
+}
+
+func NewDisk(dir, urlPrefix string) *Disk {
+	return &Disk{dir: dir, urlPrefix: strings.TrimSuffix(urlPrefix, "/")}
+}
+
+// Put writes to a temporary file first, so a file under key is always
+// complete.
+func (d *Disk) Put(ctx context.Context, key string, r io.Reader) error {
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (d *Disk) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(d.path(key))
+}
+
+func (d *Disk) Delete(ctx context.Context, key string) error {
+	err := os.Remove(d.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List lists the files under the directory prefix, including those Put
+// left behind half written.
+func (d *Disk) List(ctx context.Context, prefix string) ([]Object, error) {
+	root := filepath.Clean(d.dir)
+	var objects []Object
+	err := filepath.WalkDir(d.path(prefix), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return ctx.Err()
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: filepath.ToSlash(rel), ModTime: info.ModTime()})
+		return nil
+	})
+	return objects, err
+}
+
+func (d *Disk) URL(key string) string {
+	return d.urlPrefix + "/" + key
+}
+
+// path keeps key inside dir even if it tries to climb out of it.
+func (d *Disk) path(key string) string {
+	return filepath.Join(d.dir, filepath.FromSlash(filepath.Clean("/"+key)))
+}
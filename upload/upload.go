@@ -0,0 +1,213 @@
+// Package upload validates, processes and stores uploaded files.
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/scan"
+	"github.com/jalal-akbar/belajar-golang-fiber/sequence"
+)
+
+// EventStored is published for an upload stored for a user, with the kind
+// of file in Data["kind"].
+const EventStored = "upload.stored"
+
+// QuarantinePrefix is where File stores the files it puts in quarantine.
+const QuarantinePrefix = "quarantine"
+
+var (
+	ErrTooLarge    = errors.New("upload: file too large")
+	ErrUnsupported = errors.New("upload: unsupported file type")
+)
+
+// imageTypes are the content types Image accepts, sniffed from the file
+// itself rather than taken from the client.
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Pipeline checks uploads against the configured limits, processes them
+// and puts the result into storage.
+type Pipeline struct {
+	cfg     config.UploadConfig
+	storage Storage
+	names   sequence.IDGenerator
+	scanner scan.Scanner
+}
+
+// New stores files under random names, which can't be guessed to find
+// others' files.
+func New(cfg config.UploadConfig, storage Storage) *Pipeline {
+	return &Pipeline{cfg: cfg, storage: storage, names: sequence.Random(16)}
+}
+
+// UseScanner has File scan the files it stores with scanner. Images aren't
+// scanned: Image decodes and re-encodes them, which leaves nothing but
+// pixels.
+func (p *Pipeline) UseScanner(scanner scan.Scanner) {
+	p.scanner = scanner
+}
+
+// UseNames makes the pipeline name the files it stores with names.
+func (p *Pipeline) UseNames(names sequence.IDGenerator) {
+	p.names = names
+}
+
+func (p *Pipeline) Storage() Storage {
+	return p.storage
+}
+
+// Image decodes an uploaded image, turns it upright as its EXIF
+// orientation says, scales it to cover a size×size square, crops it to
+// the centre and stores it re-encoded under prefix, dropping
+// whatever metadata the original carried. It returns the key it stored the
+// image under.
+func (p *Pipeline) Image(ctx context.Context, file *multipart.FileHeader, prefix string, size int) (string, error) {
+	if file.Size > p.cfg.MaxSize {
+		return "", ErrTooLarge
+	}
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, p.cfg.MaxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > p.cfg.MaxSize {
+		return "", ErrTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	if !imageTypes[contentType] {
+		return "", ErrUnsupported
+	}
+
+	// Check the dimensions before decoding, which allocates all pixels.
+	header, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrUnsupported
+	}
+	if header.Width <= 0 || header.Height <= 0 || header.Width*header.Height > p.cfg.MaxPixels {
+		return "", ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrUnsupported
+	}
+	img = Orient(img, Orientation(data))
+
+	var out bytes.Buffer
+	ext := ".png"
+	thumbnail := Fill(img, size, size)
+	if contentType == "image/jpeg" {
+		ext = ".jpg"
+		err = jpeg.Encode(&out, thumbnail, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&out, thumbnail)
+	}
+	if err != nil {
+		return "", err
+	}
+	name, err := p.names.NewID()
+	if err != nil {
+		return "", fmt.Errorf("upload: %w", err)
+	}
+	key := prefix + "/" + name + ext
+	if err := p.storage.Put(ctx, key, &out); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Stored is a file File stored. Quarantine is why it was put in
+// quarantine instead, if it was. Image describes images.
+type Stored struct {
+	Key         string
+	ContentType string
+	Quarantine  string
+	Image       *ImageInfo
+}
+
+// ImageInfo is the size of an image as uploaded, in pixels, and its EXIF
+// orientation. Images of orientations 5 to 8 are shown turned on their
+// side, width and height swapped.
+type ImageInfo struct {
+	Width       int `json:"width"`
+	Height      int `json:"height"`
+	Orientation int `json:"orientation"`
+}
+
+// File stores an uploaded file as it is under prefix, with its content
+// type sniffed from the file rather than taken from the client. With a
+// scanner, files it flags, or fails to scan, are stored under
+// QuarantinePrefix instead, for an admin to review.
+func (p *Pipeline) File(ctx context.Context, file *multipart.FileHeader, prefix string) (Stored, error) {
+	if file.Size > p.cfg.MaxSize {
+		return Stored{}, ErrTooLarge
+	}
+	src, err := file.Open()
+	if err != nil {
+		return Stored{}, err
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, p.cfg.MaxSize+1))
+	if err != nil {
+		return Stored{}, err
+	}
+	if int64(len(data)) > p.cfg.MaxSize {
+		return Stored{}, ErrTooLarge
+	}
+	name, err := p.names.NewID()
+	if err != nil {
+		return Stored{}, fmt.Errorf("upload: %w", err)
+	}
+	stored := Stored{ContentType: http.DetectContentType(data)}
+	if imageTypes[stored.ContentType] {
+		if header, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			stored.Image = &ImageInfo{Width: header.Width, Height: header.Height, Orientation: Orientation(data)}
+		}
+	}
+	if p.scanner != nil {
+		result, err := p.scanner.Scan(ctx, bytes.NewReader(data))
+		switch {
+		case err != nil:
+			stored.Quarantine = "scan failed: " + err.Error()
+		case result.Infected:
+			stored.Quarantine = "infected: " + result.Signature
+		}
+	}
+	if stored.Quarantine != "" {
+		prefix = QuarantinePrefix
+	}
+	stored.Key = prefix + "/" + name
+	if err := p.storage.Put(ctx, stored.Key, bytes.NewReader(data)); err != nil {
+		return Stored{}, err
+	}
+	return stored, nil
+}
+
+// HTTPError maps the pipeline's errors to responses.
+func HTTPError(err error) error {
+	switch {
+	case errors.Is(err, ErrTooLarge):
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "file too large")
+	case errors.Is(err, ErrUnsupported):
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, "unsupported file type")
+	}
+	return err
+}
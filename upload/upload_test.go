@@ -0,0 +1,152 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/scan"
+	"github.com/jalal-akbar/belajar-golang-fiber/sequence"
+	"github.com/stretchr/testify/assert"
+)
+
+func pngFile(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// fileHeader runs data through multipart parsing like a real upload.
+func fileHeader(t *testing.T, name string, data []byte) *multipart.FileHeader {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", name)
+	assert.Nil(t, err)
+	part.Write(data)
+	writer.Close()
+
+	request := httptest.NewRequest("POST", "/", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	assert.Nil(t, request.ParseMultipartForm(1<<20))
+	return request.MultipartForm.File["file"][0]
+}
+
+func TestFill(t *testing.T) {
+	img := Fill(image.NewRGBA(image.Rect(0, 0, 300, 100)), 50, 50)
+	assert.Equal(t, image.Rect(0, 0, 50, 50), img.Bounds())
+
+	img = Fill(image.NewRGBA(image.Rect(0, 0, 3, 7)), 20, 10)
+	assert.Equal(t, image.Rect(0, 0, 20, 10), img.Bounds())
+}
+
+func TestImage(t *testing.T) {
+	dir := t.TempDir()
+	pipeline := New(config.Default().Uploads, NewDisk(dir, "/files/"))
+	pipeline.UseNames(sequence.NewStepper("img-"))
+
+	key, err := pipeline.Image(context.Background(), fileHeader(t, "me.png", pngFile(t, 400, 300)), "avatars", 64)
+	assert.Nil(t, err)
+	assert.Equal(t, "avatars/img-1.png", key)
+	assert.Equal(t, "/files/avatars/img-1.png", pipeline.Storage().URL(key))
+
+	data, err := os.ReadFile(filepath.Join(dir, key))
+	assert.Nil(t, err)
+	stored, err := png.DecodeConfig(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, 64, stored.Width)
+	assert.Equal(t, 64, stored.Height)
+}
+
+func TestImageRejects(t *testing.T) {
+	cfg := config.Default().Uploads
+	cfg.MaxSize = 4096
+	cfg.MaxPixels = 100 * 100
+	pipeline := New(cfg, NewDisk(t.TempDir(), "/files"))
+	ctx := context.Background()
+
+	// Named like an image, but isn't one.
+	_, err := pipeline.Image(ctx, fileHeader(t, "me.png", []byte("<html><script>")), "avatars", 64)
+	assert.ErrorIs(t, err, ErrUnsupported)
+
+	_, err = pipeline.Image(ctx, fileHeader(t, "me.png", make([]byte, 5000)), "avatars", 64)
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	_, err = pipeline.Image(ctx, fileHeader(t, "me.png", pngFile(t, 101, 100)), "avatars", 64)
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestDiskStaysInDir(t *testing.T) {
+	dir := t.TempDir()
+	disk := NewDisk(filepath.Join(dir, "uploads"), "/files")
+	assert.Nil(t, disk.Put(context.Background(), "../../escaped", strings.NewReader("x")))
+
+	_, err := os.Stat(filepath.Join(dir, "uploads", "escaped"))
+	assert.Nil(t, err)
+	assert.Nil(t, disk.Delete(context.Background(), "../../escaped"))
+	assert.Nil(t, disk.Delete(context.Background(), "missing"))
+}
+
+type scanner func(data string) (scan.Result, error)
+
+func (s scanner) Scan(ctx context.Context, r io.Reader) (scan.Result, error) {
+	data, _ := io.ReadAll(r)
+	return s(string(data))
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	pipeline := New(config.Default().Uploads, NewDisk(dir, "/files"))
+	pipeline.UseNames(sequence.NewStepper("f-"))
+	ctx := context.Background()
+
+	stored, err := pipeline.File(ctx, fileHeader(t, "notes.txt", []byte("catatan")), "files")
+	assert.Nil(t, err)
+	assert.Equal(t, Stored{Key: "files/f-1", ContentType: "text/plain; charset=utf-8"}, stored)
+
+	pipeline.UseScanner(scanner(func(data string) (scan.Result, error) {
+		switch data {
+		case "virus":
+			return scan.Result{Infected: true, Signature: "Test-Signature"}, nil
+		case "timeout":
+			return scan.Result{}, errors.New("scan: i/o timeout")
+		}
+		return scan.Result{}, nil
+	}))
+	stored, err = pipeline.File(ctx, fileHeader(t, "virus.exe", []byte("virus")), "files")
+	assert.Nil(t, err)
+	assert.Equal(t, "quarantine/f-2", stored.Key)
+	assert.Equal(t, "infected: Test-Signature", stored.Quarantine)
+	stored, err = pipeline.File(ctx, fileHeader(t, "slow.bin", []byte("timeout")), "files")
+	assert.Nil(t, err)
+	assert.Equal(t, "quarantine/f-3", stored.Key)
+	assert.Equal(t, "scan failed: scan: i/o timeout", stored.Quarantine)
+	stored, err = pipeline.File(ctx, fileHeader(t, "clean.txt", []byte("clean")), "files")
+	assert.Nil(t, err)
+	assert.Equal(t, "files/f-4", stored.Key)
+
+	src, err := pipeline.Storage().Open(ctx, "quarantine/f-2")
+	assert.Nil(t, err)
+	data, _ := io.ReadAll(src)
+	src.Close()
+	assert.Equal(t, "virus", string(data))
+	_, err = pipeline.Storage().Open(ctx, "files/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -0,0 +1,211 @@
+package users
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/audit"
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 200
+)
+
+// Admin lets users with the users:* permissions manage the accounts of
+// others. Every change is written to the audit log.
+type Admin struct {
+	users  *Users
+	tokens *auth.Tokens
+	audit  *audit.Log
+	scopes []string
+}
+
+// NewAdmin manages users, ending their sessions through tokens.
+// Impersonation tokens are granted scopes, the scopes of a regular login.
+func NewAdmin(users *Users, tokens *auth.Tokens, log *audit.Log, scopes []string) *Admin {
+	return &Admin{users: users, tokens: tokens, audit: log, scopes: scopes}
+}
+
+// Register adds the user management endpoints. The router must
+// authenticate the request's user.
+func (a *Admin) Register(router fiber.Router) {
+	router.Use(notImpersonated)
+	read := a.users.RequirePermission("users:read")
+	write := a.users.RequirePermission("users:write")
+	router.Get("/", read, a.list)
+	router.Get("/:id", read, a.get)
+	router.Post("/:id/disable", write, a.setDisabled(true))
+	router.Post("/:id/enable", write, a.setDisabled(false))
+	router.Post("/:id/password-reset", write, a.passwordReset)
+	router.Put("/:id/roles", write, a.setRoles)
+	router.Post("/:id/impersonate", a.users.RequirePermission("users:impersonate"), a.impersonate)
+}
+
+// notImpersonated keeps an admin acting as someone else from managing
+// users with that someone's rights.
+func notImpersonated(c *fiber.Ctx) error {
+	if claims := auth.ClaimsFrom(c); claims != nil && claims.Actor != nil {
+		return fiber.NewError(fiber.StatusForbidden, "not allowed while impersonating")
+	}
+	return c.Next()
+}
+
+func (a *Admin) list(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultLimit)
+	if limit <= 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+	offset := c.QueryInt("offset")
+	if offset < 0 {
+		offset = 0
+	}
+	status := c.Query("status")
+	if status != "" && status != "active" && status != "disabled" {
+		return fiber.NewError(fiber.StatusBadRequest, `status must be "active" or "disabled"`)
+	}
+	list, total, err := a.users.List(c.UserContext(), Filter{
+		Query:  c.Query("q"),
+		Role:   c.Query("role"),
+		Status: status,
+		Offset: offset,
+		Limit:  limit,
+	})
+	if err != nil {
+		return err
+	}
+	c.Set("X-Total-Count", strconv.Itoa(total))
+	return c.JSON(fiber.Map{"users": list, "total": total})
+}
+
+func (a *Admin) get(c *fiber.Ctx) error {
+	user, ok, err := a.users.Get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	return c.JSON(user)
+}
+
+func (a *Admin) setDisabled(disabled bool) fiber.Handler {
+	action := "user.enable"
+	if disabled {
+		action = "user.disable"
+	}
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if self := ctxutil.CurrentUser(c); disabled && id == self {
+			return fiber.NewError(fiber.StatusConflict, "can't disable your own account")
+		}
+		user, ok, err := a.users.Update(c.UserContext(), id, func(user *User) { user.Disabled = disabled })
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fiber.ErrNotFound
+		}
+		details := map[string]string{}
+		if disabled {
+			revoked, err := a.tokens.Sessions().RevokeAll(c.UserContext(), id)
+			if err != nil {
+				return err
+			}
+			details["sessions_revoked"] = strconv.Itoa(revoked)
+		}
+		a.audit.Record(c, action, id, details)
+		return c.JSON(user)
+	}
+}
+
+// passwordReset makes the user pick a new password on their next password
+// login and signs them out everywhere.
+func (a *Admin) passwordReset(c *fiber.Ctx) error {
+	id := c.Params("id")
+	user, ok, err := a.users.Update(c.UserContext(), id, func(user *User) { user.PasswordResetRequired = true })
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	revoked, err := a.tokens.Sessions().RevokeAll(c.UserContext(), id)
+	if err != nil {
+		return err
+	}
+	a.audit.Record(c, "user.password_reset", id, map[string]string{"sessions_revoked": strconv.Itoa(revoked)})
+	return c.JSON(user)
+}
+
+func (a *Admin) setRoles(c *fiber.Ctx) error {
+	var body struct {
+		Roles []string `json:"roles"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Roles == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "expected {\"roles\": [...]}")
+	}
+	roles := make([]string, 0, len(body.Roles))
+	for _, role := range body.Roles {
+		if !a.users.ValidRole(role) {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, "unknown role "+strconv.Quote(role))
+		}
+		if !contains(roles, role) {
+			roles = append(roles, utils.CopyString(role))
+		}
+	}
+	id := c.Params("id")
+	var previous []string
+	user, ok, err := a.users.Update(c.UserContext(), id, func(user *User) {
+		previous = user.Roles
+		user.Roles = roles
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	a.audit.Record(c, "user.roles", id, map[string]string{
+		"from": strings.Join(previous, ","),
+		"to":   strings.Join(roles, ","),
+	})
+	return c.JSON(user)
+}
+
+// impersonate issues a token for the user that names the admin as its
+// actor, so everything done with it can be traced back.
+func (a *Admin) impersonate(c *fiber.Ctx) error {
+	id := c.Params("id")
+	actor := ctxutil.CurrentUser(c)
+	if id == actor {
+		return fiber.NewError(fiber.StatusConflict, "can't impersonate yourself")
+	}
+	user, ok, err := a.users.Get(c.UserContext(), id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	if user.Disabled {
+		return fiber.NewError(fiber.StatusConflict, "account disabled")
+	}
+	admin, err := a.users.Can(c.UserContext(), id, "users:impersonate")
+	if err != nil {
+		return err
+	}
+	if admin {
+		return fiber.NewError(fiber.StatusForbidden, "can't impersonate another admin")
+	}
+	token, err := a.tokens.Impersonate(c, actor, id, a.scopes...)
+	if err != nil {
+		return err
+	}
+	a.audit.Record(c, "user.impersonate", id, nil)
+	return c.JSON(fiber.Map{"access_token": token, "token_type": "Bearer"})
+}
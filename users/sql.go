@@ -0,0 +1,189 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+)
+
+// Migrations create the tables of the accounts and their roles.
+var Migrations = []database.Migration{{
+	ID: "users-0001",
+	Statements: []string{
+		`CREATE TABLE users (
+	id VARCHAR(255) PRIMARY KEY,
+	disabled BOOLEAN NOT NULL,
+	password_reset_required BOOLEAN NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	last_seen TIMESTAMP NOT NULL
+)`,
+		`CREATE INDEX users_created_at ON users (created_at, id)`,
+		`CREATE TABLE user_roles (
+	user_id VARCHAR(255) NOT NULL,
+	role VARCHAR(64) NOT NULL,
+	PRIMARY KEY (user_id, role)
+)`,
+	},
+}}
+
+const userColumns = "id, disabled, password_reset_required, created_at, last_seen"
+
+// insert records a new account, without roles.
+func (u *Users) insert(ctx context.Context, user User) error {
+	_, err := u.db.Conn(ctx).ExecContext(ctx, u.db.Rebind(`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?)`),
+		user.ID, user.Disabled, user.PasswordResetRequired, user.CreatedAt.UTC(), user.LastSeen.UTC())
+	return database.Conflict(err)
+}
+
+// get returns the account id with its roles; ok is false if there is
+// none. lock is appended to the query, to lock the row in a transaction.
+func (u *Users) get(ctx context.Context, id, lock string) (user User, ok bool, err error) {
+	user, err = scanUser(u.db.Conn(ctx).QueryRowContext(ctx, u.db.Rebind(`SELECT `+userColumns+` FROM users WHERE id = ?`+lock), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, false, nil
+	}
+	if err != nil {
+		return User{}, false, err
+	}
+	roles, err := u.rolesOf(ctx, id)
+	if err != nil {
+		return User{}, false, err
+	}
+	user.Roles = roles[id]
+	return user, true, nil
+}
+
+// rolesOf returns the roles of the accounts ids, sorted, keyed by account.
+// Accounts without roles get an empty list.
+func (u *Users) rolesOf(ctx context.Context, ids ...string) (map[string][]string, error) {
+	byUser := make(map[string][]string, len(ids))
+	if len(ids) == 0 {
+		return byUser, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		byUser[id] = []string{}
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	rows, err := u.db.Conn(ctx).QueryContext(ctx, u.db.Rebind(`SELECT user_id, role FROM user_roles WHERE user_id IN (`+placeholders+`) ORDER BY user_id, role`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, role string
+		if err := rows.Scan(&id, &role); err != nil {
+			return nil, err
+		}
+		byUser[id] = append(byUser[id], role)
+	}
+	return byUser, rows.Err()
+}
+
+// save writes the status and roles of an existing account.
+func (u *Users) save(ctx context.Context, user User) error {
+	conn := u.db.Conn(ctx)
+	_, err := conn.ExecContext(ctx, u.db.Rebind(`UPDATE users SET disabled = ?, password_reset_required = ?, last_seen = ? WHERE id = ?`),
+		user.Disabled, user.PasswordResetRequired, user.LastSeen.UTC(), user.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, u.db.Rebind(`DELETE FROM user_roles WHERE user_id = ?`), user.ID); err != nil {
+		return err
+	}
+	for _, role := range user.Roles {
+		if _, err := conn.ExecContext(ctx, u.db.Rebind(`INSERT INTO user_roles (user_id, role) VALUES (?, ?)`), user.ID, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// touch records that the account id was seen at now.
+func (u *Users) touch(ctx context.Context, id string, now time.Time) error {
+	_, err := u.db.Conn(ctx).ExecContext(ctx, u.db.Rebind(`UPDATE users SET last_seen = ? WHERE id = ?`), now.UTC(), id)
+	return err
+}
+
+// query returns one page of the accounts filter selects, oldest first,
+// and how many it selects in total.
+func (u *Users) query(ctx context.Context, filter Filter) ([]User, int, error) {
+	var where []string
+	var args []any
+	if filter.Query != "" {
+		where = append(where, `LOWER(id) LIKE ? ESCAPE '!'`)
+		args = append(args, "%"+likeEscaper.Replace(strings.ToLower(filter.Query))+"%")
+	}
+	if filter.Role != "" {
+		where = append(where, `id IN (SELECT user_id FROM user_roles WHERE role = ?)`)
+		args = append(args, filter.Role)
+	}
+	switch filter.Status {
+	case "active":
+		where = append(where, `disabled = ?`)
+		args = append(args, false)
+	case "disabled":
+		where = append(where, `disabled = ?`)
+		args = append(args, true)
+	}
+	clause := ""
+	if len(where) > 0 {
+		clause = ` WHERE ` + strings.Join(where, ` AND `)
+	}
+
+	conn := u.db.Conn(ctx)
+	var total int
+	if err := conn.QueryRowContext(ctx, u.db.Rebind(`SELECT COUNT(*) FROM users`+clause), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	rows, err := conn.QueryContext(ctx, u.db.Rebind(`SELECT `+userColumns+` FROM users`+clause+` ORDER BY created_at, id LIMIT ? OFFSET ?`),
+		append(args, limit, max(filter.Offset, 0))...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	list := []User{}
+	var ids []string
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, user)
+		ids = append(ids, user.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	roles, err := u.rolesOf(ctx, ids...)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range list {
+		list[i].Roles = roles[list[i].ID]
+	}
+	return list, total, nil
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns, with the ESCAPE
+// character of the queries.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func scanUser(row interface{ Scan(...any) error }) (User, error) {
+	var user User
+	if err := row.Scan(&user.ID, &user.Disabled, &user.PasswordResetRequired, &user.CreatedAt, &user.LastSeen); err != nil {
+		return User{}, err
+	}
+	user.CreatedAt, user.LastSeen = user.CreatedAt.UTC(), user.LastSeen.UTC()
+	return user, nil
+}
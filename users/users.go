@@ -0,0 +1,281 @@
+// Package users keeps the accounts of the users who signed in, their roles
+// and status, and checks the permissions the roles grant.
+package users
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jalal-akbar/belajar-golang-fiber/clock"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/database"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+)
+
+type User struct {
+	ID                    string    `json:"id"`
+	Roles                 []string  `json:"roles"`
+	Disabled              bool      `json:"disabled"`
+	PasswordResetRequired bool      `json:"password_reset_required"`
+	CreatedAt             time.Time `json:"created_at"`
+	LastSeen              time.Time `json:"last_seen"`
+}
+
+// Filter selects users for List. Query matches part of the id; Status is
+// "active", "disabled" or empty for both.
+type Filter struct {
+	Query  string
+	Role   string
+	Status string
+	Offset int
+	Limit  int
+}
+
+// EventRegistered is published when an account is created, with the
+// Accept-Language of the request in Data["accept_language"] and the
+// address from the user's token in Data["email"].
+const EventRegistered = "user.registered"
+
+// seenEvery is how often the last request of a user is written back.
+const seenEvery = time.Minute
+
+// Users keeps the accounts and their roles in the database, in the tables
+// Migrations create. An account is created the first time its user is
+// seen by Middleware.
+type Users struct {
+	roles  map[string][]string
+	admins []string
+	db     *database.DB
+	now    func() time.Time
+	bus    *events.Bus
+}
+
+func New(cfg config.RBACConfig, db *database.DB) *Users {
+	return &Users{roles: cfg.Roles, admins: cfg.Admins, db: db, now: clock.System.Now}
+}
+
+// UseBus publishes EventRegistered on bus for the accounts created from
+// then on.
+func (u *Users) UseBus(bus *events.Bus) {
+	u.bus = bus
+}
+
+// GrantAdmins gives the configured admins the admin role, creating their
+// accounts if needed, so there is someone to manage the others. Roles
+// granted to them otherwise stay.
+func (u *Users) GrantAdmins(ctx context.Context) error {
+	for _, id := range u.admins {
+		now := u.now()
+		err := u.insert(ctx, User{ID: id, CreatedAt: now, LastSeen: now})
+		if err != nil && !errors.Is(err, database.ErrConflict) {
+			return err
+		}
+		_, _, err = u.Update(ctx, id, func(user *User) {
+			if !contains(user.Roles, "admin") {
+				user.Roles = append(user.Roles, "admin")
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *Users) Get(ctx context.Context, id string) (User, bool, error) {
+	return u.get(ctx, id, "")
+}
+
+// Delete deletes the account of id. Should the user sign in again, they
+// get a new one.
+func (u *Users) Delete(ctx context.Context, id string) (bool, error) {
+	var deleted bool
+	err := u.db.InTx(ctx, func(ctx context.Context) error {
+		conn := u.db.Conn(ctx)
+		if _, err := conn.ExecContext(ctx, u.db.Rebind(`DELETE FROM user_roles WHERE user_id = ?`), id); err != nil {
+			return err
+		}
+		result, err := conn.ExecContext(ctx, u.db.Rebind(`DELETE FROM users WHERE id = ?`), id)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		deleted = n > 0
+		return err
+	})
+	return deleted, err
+}
+
+// Update changes the account of id with change, in a transaction, and
+// returns the result.
+func (u *Users) Update(ctx context.Context, id string, change func(*User)) (User, bool, error) {
+	var user User
+	var ok bool
+	err := u.db.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		user, ok, err = u.get(ctx, id, u.db.ForUpdate())
+		if err != nil || !ok {
+			return err
+		}
+		change(&user)
+		sort.Strings(user.Roles)
+		return u.save(ctx, user)
+	})
+	if err != nil || !ok {
+		return User{}, false, err
+	}
+	return user, true, nil
+}
+
+// List returns one page of the users matching filter, oldest first, and
+// how many match in total.
+func (u *Users) List(ctx context.Context, filter Filter) ([]User, int, error) {
+	return u.query(ctx, filter)
+}
+
+// CountByStatus returns how many accounts are active and how many are
+// disabled.
+func (u *Users) CountByStatus(ctx context.Context) (active, disabled int, err error) {
+	rows, err := u.db.Conn(ctx).QueryContext(ctx, `SELECT disabled, COUNT(*) FROM users GROUP BY disabled`)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var isDisabled bool
+		var n int
+		if err := rows.Scan(&isDisabled, &n); err != nil {
+			return 0, 0, err
+		}
+		if isDisabled {
+			disabled += n
+		} else {
+			active += n
+		}
+	}
+	return active, disabled, rows.Err()
+}
+
+// ValidRole reports whether role is configured.
+func (u *Users) ValidRole(role string) bool {
+	_, ok := u.roles[role]
+	return ok
+}
+
+// Can reports whether one of the roles of user id grants permission.
+func (u *Users) Can(ctx context.Context, id, permission string) (bool, error) {
+	user, ok, err := u.Get(ctx, id)
+	if err != nil || !ok || user.Disabled {
+		return false, err
+	}
+	for _, role := range user.Roles {
+		if contains(u.roles[role], permission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasRole reports whether user id has role and isn't disabled.
+func (u *Users) HasRole(ctx context.Context, id, role string) (bool, error) {
+	user, ok, err := u.Get(ctx, id)
+	return ok && !user.Disabled && contains(user.Roles, role), err
+}
+
+// Middleware records the authenticated user of the request, creating their
+// account on the first request, and answers 403 to disabled users.
+func (u *Users) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := ctxutil.CurrentUser(c)
+		if id == "" {
+			return c.Next()
+		}
+		ctx := c.UserContext()
+		now := u.now()
+		user, ok, err := u.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !ok:
+			user, err = u.register(c, id, now)
+			if err != nil {
+				return err
+			}
+		case now.Sub(user.LastSeen) >= seenEvery:
+			if err := u.touch(ctx, id, now); err != nil {
+				return err
+			}
+		}
+		if user.Disabled {
+			return fiber.NewError(fiber.StatusForbidden, "account disabled")
+		}
+		return c.Next()
+	}
+}
+
+// register creates the account of id. Only the request that creates it
+// publishes EventRegistered: should another request, on this instance or
+// another, have created it meanwhile, that one did, and the account it
+// created is returned.
+func (u *Users) register(c *fiber.Ctx, id string, now time.Time) (User, error) {
+	user := User{ID: utils.CopyString(id), Roles: []string{}, CreatedAt: now, LastSeen: now}
+	err := u.insert(c.UserContext(), user)
+	if errors.Is(err, database.ErrConflict) {
+		user, _, err = u.Get(c.UserContext(), id)
+		return user, err
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if u.bus != nil {
+		u.registered(c, user)
+	}
+	return user, nil
+}
+
+// registered publishes EventRegistered for user, whose account the
+// request created.
+func (u *Users) registered(c *fiber.Ctx, user User) {
+	event := events.Event{Type: EventRegistered, UserID: user.ID, Time: user.CreatedAt}
+	// For the languages of what is sent to the new user, and where.
+	if languages := c.Get(fiber.HeaderAcceptLanguage); languages != "" {
+		event.Data = map[string]string{"accept_language": utils.CopyString(languages)}
+	}
+	if email := ctxutil.Email(c); email != "" {
+		if event.Data == nil {
+			event.Data = map[string]string{}
+		}
+		event.Data["email"] = utils.CopyString(email)
+	}
+	u.bus.Publish(c.UserContext(), event)
+}
+
+// RequirePermission answers 403 unless the roles of the request's user
+// grant permission.
+func (u *Users) RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		can, err := u.Can(c.UserContext(), ctxutil.CurrentUser(c), permission)
+		if err != nil {
+			return err
+		}
+		if !can {
+			return fiber.NewError(fiber.StatusForbidden, "missing permission "+permission)
+		}
+		return c.Next()
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,322 @@
+package users
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/audit"
+	"github.com/jalal-akbar/belajar-golang-fiber/auth"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/ctxutil"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+type testApp struct {
+	*fiber.App
+	t      testing.TB
+	tokens *auth.Tokens
+	audit  *audit.Log
+	events []string
+}
+
+func newTestApp(t testing.TB) *testApp {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "key.pem")
+	assert.Nil(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	db := testkit.OpenDB(t, append(auth.SessionMigrations, Migrations...)...)
+	tokens, err := auth.New(config.JWTConfig{KeyFiles: []string{path}, TTL: time.Minute}, nil, db)
+	assert.Nil(t, err)
+
+	rbac := config.Default().RBAC
+	rbac.Admins = []string{"root"}
+	accounts := New(rbac, db)
+	assert.Nil(t, accounts.GrantAdmins(context.Background()))
+	log := audit.New(slog.New(slog.NewTextHandler(io.Discard, nil)), 100)
+	a := &testApp{t: t, tokens: tokens, audit: log}
+	bus := events.NewBus()
+	bus.Subscribe("*", func(_ context.Context, event events.Event) {
+		a.events = append(a.events, event.Type+" "+event.UserID)
+	})
+	accounts.UseBus(bus)
+	tokens.UseBus(bus)
+
+	app := fiber.New()
+	app.Post("/login/:user", func(c *fiber.Ctx) error {
+		token, err := tokens.Login(c, c.Params("user"))
+		if err != nil {
+			return err
+		}
+		return c.SendString(token)
+	})
+	NewAdmin(accounts, tokens, log, []string{"dashboard:read"}).
+		Register(app.Group("/admin/users", tokens.Middleware(), accounts.Middleware()))
+	app.Get("/api/whoami", tokens.Middleware(), accounts.Middleware(), log.Impersonation(), func(c *fiber.Ctx) error {
+		return c.SendString(ctxutil.CurrentUser(c))
+	})
+	a.App = app
+	return a
+}
+
+func (a *testApp) login(user string) string {
+	return testkit.Do(a.t, a.App, "POST", "/login/"+user, nil).String()
+}
+
+func (a *testApp) do(method, path, token, body string) (int, string) {
+	response := testkit.DoJSON(a.t, a.App, method, path, body, nil, testkit.WithAuth(token))
+	return response.StatusCode, response.String()
+}
+
+func (a *testApp) actions() []string {
+	var actions []string
+	for _, entry := range a.audit.List() {
+		actions = append(actions, entry.Action)
+	}
+	return actions
+}
+
+func TestListAndRoles(t *testing.T) {
+	app := newTestApp(t)
+	root, alice := app.login("root"), app.login("alice")
+	app.do("GET", "/api/whoami", alice, "")
+	app.do("GET", "/api/whoami", app.login("bob"), "")
+	// root has an account from the start.
+	assert.Equal(t, []string{
+		"user.logged_in root", "user.logged_in alice", "user.registered alice",
+		"user.logged_in bob", "user.registered bob",
+	}, app.events)
+
+	status, _ := app.do("GET", "/admin/users", alice, "")
+	assert.Equal(t, 403, status)
+
+	var page struct {
+		Users []User `json:"users"`
+		Total int    `json:"total"`
+	}
+	status, body := app.do("GET", "/admin/users?limit=2", root, "")
+	assert.Equal(t, 200, status)
+	assert.Nil(t, json.Unmarshal([]byte(body), &page))
+	assert.Equal(t, 3, page.Total)
+	assert.Len(t, page.Users, 2)
+	assert.Equal(t, "root", page.Users[0].ID)
+
+	_, body = app.do("GET", "/admin/users?q=ALI", root, "")
+	assert.Nil(t, json.Unmarshal([]byte(body), &page))
+	assert.Equal(t, 1, page.Total)
+	assert.Equal(t, "alice", page.Users[0].ID)
+
+	status, _ = app.do("PUT", "/admin/users/alice/roles", root, `{"roles":["owner"]}`)
+	assert.Equal(t, 422, status)
+	status, _ = app.do("PUT", "/admin/users/alice/roles", root, `{"roles":["support","support"]}`)
+	assert.Equal(t, 200, status)
+
+	// Roles take effect on the next request.
+	_, body = app.do("GET", "/admin/users?role=support", alice, "")
+	assert.Nil(t, json.Unmarshal([]byte(body), &page))
+	assert.Equal(t, []string{"support"}, page.Users[0].Roles)
+	status, _ = app.do("POST", "/admin/users/bob/disable", alice, "")
+	assert.Equal(t, 403, status)
+
+	status, _ = app.do("GET", "/admin/users/nobody", root, "")
+	assert.Equal(t, 404, status)
+	assert.Equal(t, []string{"user.roles"}, app.actions())
+}
+
+func TestDisableAndPasswordReset(t *testing.T) {
+	app := newTestApp(t)
+	root, alice := app.login("root"), app.login("alice")
+	app.do("GET", "/api/whoami", alice, "")
+
+	status, _ := app.do("POST", "/admin/users/root/disable", root, "")
+	assert.Equal(t, 409, status)
+	status, _ = app.do("POST", "/admin/users/alice/disable", root, "")
+	assert.Equal(t, 200, status)
+
+	// Her session ended, and tokens without one are refused too.
+	status, _ = app.do("GET", "/api/whoami", alice, "")
+	assert.Equal(t, 401, status)
+	unbound, err := app.tokens.Sign("alice")
+	assert.Nil(t, err)
+	status, body := app.do("GET", "/api/whoami", unbound, "")
+	assert.Equal(t, 403, status)
+	assert.Equal(t, "account disabled", body)
+
+	status, _ = app.do("POST", "/admin/users/alice/enable", root, "")
+	assert.Equal(t, 200, status)
+	alice = app.login("alice")
+	status, _ = app.do("GET", "/api/whoami", alice, "")
+	assert.Equal(t, 200, status)
+
+	status, body = app.do("POST", "/admin/users/alice/password-reset", root, "")
+	assert.Equal(t, 200, status)
+	assert.Contains(t, body, `"password_reset_required":true`)
+	status, _ = app.do("GET", "/api/whoami", alice, "")
+	assert.Equal(t, 401, status)
+
+	assert.Equal(t, []string{"user.password_reset", "user.enable", "user.disable"}, app.actions())
+	assert.Equal(t, "1", app.audit.List()[2].Details["sessions_revoked"])
+}
+
+func TestAccountsOutliveRestart(t *testing.T) {
+	ctx := context.Background()
+	db := testkit.OpenDB(t, Migrations...)
+	rbac := config.Default().RBAC
+	rbac.Admins = []string{"root"}
+	before := New(rbac, db)
+	assert.Nil(t, before.GrantAdmins(ctx))
+	app := fiber.New()
+	app.Get("/", testkit.FakeAuth, before.Middleware(), func(c *fiber.Ctx) error { return nil })
+	testkit.Do(t, app, "GET", "/", nil, testkit.WithUser("alice")).AssertStatus(200)
+	_, ok, err := before.Update(ctx, "alice", func(user *User) {
+		user.Disabled = true
+		user.Roles = []string{"support"}
+	})
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	after := New(rbac, db)
+	assert.Nil(t, after.GrantAdmins(ctx))
+	alice, ok, err := after.Get(ctx, "alice")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	assert.True(t, alice.Disabled)
+	assert.Equal(t, []string{"support"}, alice.Roles)
+	admin, err := after.HasRole(ctx, "root", "admin")
+	assert.True(t, admin)
+	assert.Nil(t, err)
+	active, disabled, err := after.CountByStatus(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 1}, []int{active, disabled})
+
+	app = fiber.New()
+	app.Get("/", testkit.FakeAuth, after.Middleware(), func(c *fiber.Ctx) error { return nil })
+	testkit.Do(t, app, "GET", "/", nil, testkit.WithUser("alice")).AssertStatus(403)
+
+	deleted, err := after.Delete(ctx, "alice")
+	assert.True(t, deleted)
+	assert.Nil(t, err)
+	_, ok, _ = after.Get(ctx, "alice")
+	assert.False(t, ok)
+}
+
+func TestRegisterOnce(t *testing.T) {
+	db := testkit.OpenDB(t, Migrations...)
+	var registered []string
+	bus := events.NewBus()
+	bus.Subscribe(EventRegistered, func(_ context.Context, event events.Event) {
+		registered = append(registered, event.UserID)
+	})
+	instance := func() *Users {
+		accounts := New(config.Default().RBAC, db)
+		accounts.UseBus(bus)
+		return accounts
+	}
+	serve := func(accounts *Users) *fiber.App {
+		app := fiber.New()
+		app.Get("/", testkit.FakeAuth, accounts.Middleware(), func(c *fiber.Ctx) error { return nil })
+		app.Get("/register/:user", func(c *fiber.Ctx) error {
+			user, err := accounts.register(c, c.Params("user"), time.Now())
+			if err != nil {
+				return err
+			}
+			return c.JSON(user)
+		})
+		return app
+	}
+
+	first := serve(instance())
+	testkit.Do(t, first, "GET", "/", nil, testkit.WithUser("alice")).AssertStatus(200)
+	assert.Equal(t, []string{"alice"}, registered)
+
+	// After a restart, or on another instance, alice is no newcomer.
+	second := serve(instance())
+	testkit.Do(t, second, "GET", "/", nil, testkit.WithUser("alice")).AssertStatus(200)
+	assert.Equal(t, []string{"alice"}, registered)
+
+	// Losing the race to create the account returns the one created.
+	var user User
+	testkit.Do(t, second, "GET", "/register/alice", nil).AssertStatus(200).JSON(&user)
+	assert.Equal(t, "alice", user.ID)
+	assert.Equal(t, []string{"alice"}, registered)
+}
+
+func TestImpersonate(t *testing.T) {
+	app := newTestApp(t)
+	root := app.login("root")
+	app.do("GET", "/api/whoami", app.login("alice"), "")
+
+	status, _ := app.do("POST", "/admin/users/root/impersonate", root, "")
+	assert.Equal(t, 409, status)
+	status, body := app.do("POST", "/admin/users/alice/impersonate", root, "")
+	assert.Equal(t, 200, status)
+	var response struct {
+		AccessToken string `json:"access_token"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(body), &response))
+	token := response.AccessToken
+
+	status, body = app.do("GET", "/api/whoami", token, "")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "alice", body)
+
+	// Acting as alice gives no way back into user management.
+	status, _ = app.do("GET", "/admin/users", token, "")
+	assert.Equal(t, 403, status)
+
+	entries := app.audit.List()
+	assert.Equal(t, "impersonation.request", entries[0].Action)
+	assert.Equal(t, "root", entries[0].Actor)
+	assert.Equal(t, "alice", entries[0].Details["as"])
+	assert.Equal(t, "/api/whoami", entries[0].Details["path"])
+	assert.Equal(t, "user.impersonate", entries[1].Action)
+	assert.Equal(t, "alice", entries[1].Target)
+
+	// Alice sees the session and can end it.
+	sessions, err := app.tokens.Sessions().List(context.Background(), "alice")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, "impersonated by root", sessions[0].Device)
+}
+
+// FuzzListQuery binds arbitrary queries to the user list, which must
+// answer them with a 200 or a 400.
+func FuzzListQuery(f *testing.F) {
+	f.Add("limit=10&offset=20&status=active&q=al&role=admin")
+	f.Add("limit=-1&offset=-5")
+	f.Add("limit=99999999999999999999&offset=9223372036854775807")
+	f.Add("status=deleted&q=%zz")
+	f.Add("limit[=1&q[]=a&&&=")
+
+	app := newTestApp(f)
+	token := app.login("root")
+	app.login("alice")
+	f.Fuzz(func(t *testing.T, query string) {
+		for _, b := range []byte(query) {
+			// These can't be sent in a request line.
+			if b <= ' ' || b == '#' || b >= 0x7f {
+				t.Skip()
+			}
+		}
+		request := httptest.NewRequest("GET", "/admin/users", nil)
+		request.URL.RawQuery = query
+		request.Header.Set("Authorization", "Bearer "+token)
+		status := testkit.Send(t, app.App, request).StatusCode
+		assert.Contains(t, []int{200, 400}, status)
+	})
+}
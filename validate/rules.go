@@ -0,0 +1,175 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The errors of the rules read as what is wrong with a field, as clients
+// are shown them after its name.
+var (
+	ErrPhone = errors.New("not a phone number")
+	ErrEmail = errors.New("not an email address")
+	ErrNoMX  = errors.New("domain doesn't receive mail")
+	ErrNIK   = errors.New("not a NIK")
+)
+
+// DefaultCountryCode is the calling code of numbers written nationally,
+// with a trunk 0, as in 0812-3456-7890 in Indonesia.
+const DefaultCountryCode = "62"
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Phone returns number in E.164, as in +6281234567890. It drops spaces,
+// dashes, dots and parentheses, reads a leading 00 as + and a leading 0
+// as the trunk prefix of countryCode, or DefaultCountryCode if that is
+// empty.
+func Phone(number, countryCode string) (string, error) {
+	if countryCode == "" {
+		countryCode = DefaultCountryCode
+	}
+	number = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" -.()\u00a0", r) {
+			return -1
+		}
+		return r
+	}, number)
+	switch {
+	case strings.HasPrefix(number, "00"):
+		number = "+" + number[2:]
+	case strings.HasPrefix(number, "0"):
+		number = "+" + countryCode + number[1:]
+	}
+	if !e164.MatchString(number) {
+		return "", ErrPhone
+	}
+	return number, nil
+}
+
+// phone is Phone as a rule, taking the country code as its parameter:
+// `validate:"phone=65"`.
+func phone(_ context.Context, value, param string) (string, error) {
+	return Phone(value, param)
+}
+
+// Email returns address with its domain in lower case, if it is a bare
+// RFC 5322 address, without a name, comments or quotes, that fits in
+// SMTP's limits. Domains need a dot, as mail between people doesn't go to
+// dotless ones.
+func Email(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address || len(address) > 254 {
+		return "", ErrEmail
+	}
+	at := strings.LastIndexByte(address, '@')
+	local, domain := address[:at], strings.ToLower(address[at+1:])
+	if len(local) > 64 || !strings.Contains(strings.Trim(domain, "."), ".") || strings.HasPrefix(domain, "[") {
+		return "", ErrEmail
+	}
+	return local + "@" + domain, nil
+}
+
+// resolver looks up mail exchangers; tests replace it.
+var resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+} = net.DefaultResolver
+
+// mxTimeout bounds the lookups of CheckMX.
+const mxTimeout = 3 * time.Second
+
+// CheckMX reports ErrNoMX if the domain of address can't receive mail: it
+// has no MX records and no address to fall back to, or a null MX (RFC
+// 7505). Lookups that fail for other reasons, such as a timeout, pass,
+// so an unreachable DNS server doesn't turn away every address.
+func CheckMX(ctx context.Context, address string) error {
+	domain := address[strings.LastIndexByte(address, '@')+1:]
+	ctx, cancel := context.WithTimeout(ctx, mxTimeout)
+	defer cancel()
+	records, err := resolver.LookupMX(ctx, domain)
+	if err == nil {
+		if len(records) == 1 && records[0].Host == "." {
+			return ErrNoMX
+		}
+		if len(records) > 0 {
+			return nil
+		}
+	}
+	if err != nil && !notFound(err) {
+		return nil
+	}
+	// Without MX records mail goes to the domain's own address.
+	if _, err := resolver.LookupHost(ctx, domain); err != nil && notFound(err) {
+		return ErrNoMX
+	}
+	return nil
+}
+
+func notFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// email is Email as a rule. With the parameter mx it also checks the
+// domain with CheckMX: `validate:"email=mx"`.
+func email(ctx context.Context, value, param string) (string, error) {
+	address, err := Email(value)
+	if err != nil {
+		return "", err
+	}
+	if param == "mx" {
+		if err := CheckMX(ctx, address); err != nil {
+			return "", err
+		}
+	}
+	return address, nil
+}
+
+// provinces are the codes of Indonesia's provinces, the first two digits
+// of a NIK.
+var provinces = map[string]bool{
+	"11": true, "12": true, "13": true, "14": true, "15": true, "16": true, "17": true, "18": true, "19": true,
+	"21": true,
+	"31": true, "32": true, "33": true, "34": true, "35": true, "36": true,
+	"51": true, "52": true, "53": true,
+	"61": true, "62": true, "63": true, "64": true, "65": true,
+	"71": true, "72": true, "73": true, "74": true, "75": true, "76": true,
+	"81": true, "82": true,
+	"91": true, "92": true, "93": true, "94": true, "95": true, "96": true,
+}
+
+// NIK returns nik, the 16-digit Indonesian identity number, without the
+// spaces or dots it may be written with. Its digits are the province,
+// regency and district codes, the date of birth as DDMMYY with 40 added
+// to the day for women, and a serial number from 0001.
+func NIK(nik string) (string, error) {
+	nik = strings.NewReplacer(" ", "", ".", "").Replace(nik)
+	if len(nik) != 16 || strings.Trim(nik, "0123456789") != "" || !provinces[nik[:2]] {
+		return "", ErrNIK
+	}
+	if nik[2:4] == "00" || nik[4:6] == "00" || nik[12:] == "0000" {
+		return "", ErrNIK
+	}
+	day, _ := strconv.Atoi(nik[6:8])
+	month, _ := strconv.Atoi(nik[8:10])
+	if day > 40 {
+		day -= 40
+	}
+	// 2000 was a leap year, so 29 February passes.
+	birth := time.Date(2000, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if day < 1 || month < 1 || month > 12 || birth.Day() != day {
+		return "", ErrNIK
+	}
+	return nik, nil
+}
+
+func nik(_ context.Context, value, _ string) (string, error) {
+	return NIK(value)
+}
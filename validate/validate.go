@@ -0,0 +1,159 @@
+// Package validate checks and normalizes request bodies by their struct
+// tags. A field tagged `validate:"required,phone"` must be set and is
+// rewritten as an E.164 number; rules take a parameter after "=", as in
+// `validate:"email=mx"`.
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Func checks value against a rule and returns it normalized. param is
+// what follows "=" in the tag, if anything.
+type Func func(ctx context.Context, value, param string) (string, error)
+
+var (
+	mu    sync.RWMutex
+	rules = map[string]Func{
+		"required": required,
+		"phone":    phone,
+		"email":    email,
+		"nik":      nik,
+	}
+)
+
+// Register adds a rule for tags to name, or replaces one.
+func Register(name string, fn Func) {
+	mu.Lock()
+	defer mu.Unlock()
+	rules[name] = fn
+}
+
+// FieldError is a field that broke a rule. Field is its JSON name.
+type FieldError struct {
+	Field string
+	Rule  string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// Errors are the fields of a struct that broke their rules.
+type Errors []*FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap lets errors.Is and errors.As look at each field's error.
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Struct applies the rules tagged on the string fields of the struct v
+// points to, descending into nested structs and slices of them, and
+// stores the normalized values. Rules other than required pass empty
+// fields, so optional fields are only checked when set. It returns Errors
+// for the fields that broke a rule, and panics on a rule that was never
+// registered.
+func Struct(ctx context.Context, v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	var errs Errors
+	validateStruct(ctx, value.Elem(), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateStruct(ctx context.Context, value reflect.Value, prefix string, errs *Errors) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		name := prefix + fieldName(value.Type().Field(i))
+		switch field.Kind() {
+		case reflect.Struct:
+			validateStruct(ctx, field, name+".", errs)
+		case reflect.Pointer:
+			if !field.IsNil() && field.Elem().Kind() == reflect.Struct {
+				validateStruct(ctx, field.Elem(), name+".", errs)
+			}
+		case reflect.Slice:
+			for j := 0; j < field.Len(); j++ {
+				if element := field.Index(j); element.Kind() == reflect.Struct {
+					validateStruct(ctx, element, fmt.Sprintf("%s[%d].", name, j), errs)
+				}
+			}
+		case reflect.String:
+			if err := validateString(ctx, field, value.Type().Field(i).Tag.Get("validate")); err != nil {
+				err.Field = name
+				*errs = append(*errs, err)
+			}
+		}
+	}
+}
+
+// validateString applies the rules of tag to field in order, stopping at
+// the first broken one.
+func validateString(ctx context.Context, field reflect.Value, tag string) *FieldError {
+	if tag == "" {
+		return nil
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		mu.RLock()
+		fn, ok := rules[name]
+		mu.RUnlock()
+		if !ok {
+			panic("validate: unknown rule " + name)
+		}
+		if field.String() == "" && name != "required" {
+			continue
+		}
+		normalized, err := fn(ctx, field.String(), param)
+		if err != nil {
+			return &FieldError{Rule: name, Err: err}
+		}
+		field.SetString(normalized)
+	}
+	return nil
+}
+
+// fieldName is the name a field has in JSON.
+func fieldName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+var ErrRequired = errors.New("required")
+
+func required(_ context.Context, value, _ string) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return "", ErrRequired
+	}
+	return value, nil
+}
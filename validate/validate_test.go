@@ -0,0 +1,198 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhone(t *testing.T) {
+	for number, want := range map[string]string{
+		"+6281234567890":    "+6281234567890",
+		"081234567890":      "+6281234567890",
+		"0812-3456-7890":    "+6281234567890",
+		"0812 3456 7890":    "+6281234567890",
+		"(021) 555.1234":    "+62215551234",
+		"006281234567890":   "+6281234567890",
+		"+1 (415) 555-0100": "+14155550100",
+		"+62 812 3456 7890": "+6281234567890",
+	} {
+		got, err := Phone(number, "")
+		assert.Nil(t, err, number)
+		assert.Equal(t, want, got, number)
+	}
+	got, err := Phone("0 9123 4567", "65")
+	assert.Nil(t, err)
+	assert.Equal(t, "+6591234567", got)
+
+	for _, number := range []string{"", "0", "+0812345678", "+62812", "+6281234567890123", "08123abc890", "++6281234567890", "62-812-3456-7890x"} {
+		_, err := Phone(number, "")
+		assert.ErrorIs(t, err, ErrPhone, number)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	for address, want := range map[string]string{
+		"alice@example.com":               "alice@example.com",
+		"Alice.Smith@Example.COM":         "Alice.Smith@example.com",
+		" bob+orders@mail.example.co.id ": "bob+orders@mail.example.co.id",
+	} {
+		got, err := Email(address)
+		assert.Nil(t, err, address)
+		assert.Equal(t, want, got, address)
+	}
+	for _, address := range []string{
+		"",
+		"alice",
+		"alice@",
+		"@example.com",
+		"alice@localhost",
+		"alice@@example.com",
+		"Alice <alice@example.com>",
+		"alice@example.com (Alice)",
+		"alice@[192.0.2.1]",
+		`"john doe"@example.com`,
+		strings.Repeat("a", 65) + "@example.com",
+		"alice@" + strings.Repeat("a", 250) + ".com",
+	} {
+		_, err := Email(address)
+		assert.ErrorIs(t, err, ErrEmail, address)
+	}
+}
+
+type fakeResolver struct {
+	mx    map[string][]*net.MX
+	hosts map[string][]string
+	err   error
+}
+
+func (r fakeResolver) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if records, ok := r.mx[name]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if addresses, ok := r.hosts[host]; ok {
+		return addresses, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestCheckMX(t *testing.T) {
+	defer func(r interface {
+		LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+		LookupHost(ctx context.Context, host string) ([]string, error)
+	}) {
+		resolver = r
+	}(resolver)
+	resolver = fakeResolver{
+		mx: map[string][]*net.MX{
+			"example.com":  {{Host: "mx.example.com.", Pref: 10}},
+			"null.example": {{Host: "."}},
+		},
+		hosts: map[string][]string{"a-only.example": {"192.0.2.1"}},
+	}
+	ctx := context.Background()
+	assert.Nil(t, CheckMX(ctx, "alice@example.com"))
+	assert.Nil(t, CheckMX(ctx, "alice@a-only.example"))
+	assert.ErrorIs(t, CheckMX(ctx, "alice@null.example"), ErrNoMX)
+	assert.ErrorIs(t, CheckMX(ctx, "alice@missing.example"), ErrNoMX)
+
+	resolver = fakeResolver{err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}
+	assert.Nil(t, CheckMX(ctx, "alice@missing.example"))
+}
+
+func TestNIK(t *testing.T) {
+	for nik, want := range map[string]string{
+		"3174051208900001":     "3174051208900001",
+		"3174 0512 0890 0001":  "3174051208900001",
+		"31.74.05.120890.0001": "3174051208900001",
+		"3174055208900002":     "3174055208900002", // a woman born on 12 August 1990
+		"9471022902000001":     "9471022902000001", // 29 February
+		"1101017112990123":     "1101017112990123",
+	} {
+		got, err := NIK(nik)
+		assert.Nil(t, err, nik)
+		assert.Equal(t, want, got, nik)
+	}
+	for _, nik := range []string{
+		"",
+		"317405120890000",
+		"31740512089000011",
+		"317405120890000a",
+		"2074051208900001", // no province 20
+		"3100051208900001",
+		"3174001208900001",
+		"3174053208900001", // day 32
+		"3174054008900001", // day 0 for a woman
+		"3174051213900001", // month 13
+		"3174053102900001", // 31 February
+		"3174051208900000",
+	} {
+		_, err := NIK(nik)
+		assert.ErrorIs(t, err, ErrNIK, nik)
+	}
+}
+
+func TestStruct(t *testing.T) {
+	type Contact struct {
+		Phone string `json:"phone" validate:"phone"`
+	}
+	type Body struct {
+		Email    string    `json:"email" validate:"required,email"`
+		Phone    string    `json:"phone" validate:"required,phone"`
+		NIK      string    `json:"nik" validate:"nik"`
+		Name     string    `json:"name"`
+		Contacts []Contact `json:"contacts"`
+		Manager  *Contact
+	}
+	body := &Body{
+		Email:    "Alice@Example.com",
+		Phone:    "0812-3456-7890",
+		Name:     "<kept>",
+		Contacts: []Contact{{Phone: "0812 1111 2222"}, {}},
+		Manager:  &Contact{Phone: "+62 812 3333 4444"},
+	}
+	assert.Nil(t, Struct(context.Background(), body))
+	assert.Equal(t, "Alice@example.com", body.Email)
+	assert.Equal(t, "+6281234567890", body.Phone)
+	assert.Equal(t, "", body.NIK)
+	assert.Equal(t, "<kept>", body.Name)
+	assert.Equal(t, "+6281211112222", body.Contacts[0].Phone)
+	assert.Equal(t, "", body.Contacts[1].Phone)
+	assert.Equal(t, "+6281233334444", body.Manager.Phone)
+
+	invalid := &Body{Email: "alice", NIK: "123", Contacts: []Contact{{Phone: "12"}}}
+	err := Struct(context.Background(), invalid)
+	assert.Equal(t, "email: not an email address; phone: required; nik: not a NIK; contacts[0].phone: not a phone number", err.Error())
+	var errs Errors
+	assert.True(t, errors.As(err, &errs))
+	assert.Equal(t, "required", errs[1].Rule)
+	assert.ErrorIs(t, err, ErrNIK)
+	assert.ErrorIs(t, err, ErrRequired)
+	assert.Equal(t, "alice", invalid.Email)
+
+	Register("upper", func(_ context.Context, value, _ string) (string, error) {
+		return strings.ToUpper(value), nil
+	})
+	code := &struct {
+		Code string `validate:"required,upper"`
+	}{"idr"}
+	assert.Nil(t, Struct(context.Background(), code))
+	assert.Equal(t, "IDR", code.Code)
+
+	assert.Panics(t, func() {
+		Struct(context.Background(), &struct {
+			Code string `validate:"unknown"`
+		}{"x"})
+	})
+}
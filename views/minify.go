@@ -0,0 +1,47 @@
+package views
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+)
+
+func newMinifier() *minify.M {
+	m := minify.New()
+	// Optional tags are kept: leaving them out is valid HTML but makes the
+	// pages hard to read when debugging.
+	m.Add("text/html", &html.Minifier{KeepDocumentTags: true, KeepEndTags: true, KeepSpecialComments: true})
+	m.AddFunc("text/css", css.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`^(application|text)/(x-)?(java|ecma)script$`), js.Minify)
+	return m
+}
+
+// Minify minifies the HTML responses of the routes after it, with the CSS
+// and JavaScript inline in them. Put it after the compression middleware,
+// which then compresses the minified body. Responses that don't minify,
+// such as those with broken inline scripts, are sent as they are.
+func Minify() fiber.Handler {
+	m := newMinifier()
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+		response := c.Response()
+		if response.IsBodyStream() || len(response.Header.ContentEncoding()) > 0 ||
+			!strings.HasPrefix(string(response.Header.ContentType()), fiber.MIMETextHTML) {
+			return nil
+		}
+		var out bytes.Buffer
+		if err := m.Minify("text/html", &out, bytes.NewReader(response.Body())); err != nil {
+			return nil
+		}
+		response.SetBodyRaw(out.Bytes())
+		return nil
+	}
+}
@@ -0,0 +1,111 @@
+package views
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+	"github.com/stretchr/testify/assert"
+)
+
+type order struct {
+	ID     int
+	Item   string
+	Status string
+}
+
+func newPageApp(minified, compressed bool) *fiber.App {
+	app := fiber.New(fiber.Config{Views: New(os.DirFS("testdata"), "*.html")})
+	if compressed {
+		app.Use(compress.New())
+	}
+	if minified {
+		app.Use(Minify())
+	}
+	app.Get("/web/orders", func(c *fiber.Ctx) error {
+		orders := make([]order, 50)
+		for i := range orders {
+			orders[i] = order{ID: i + 1, Item: fmt.Sprintf("Item %d", i+1), Status: "paid"}
+		}
+		return c.Render("orders.html", fiber.Map{"Title": "Orders", "Orders": orders})
+	})
+	app.Get("/web/data", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"text": "  kept  "})
+	})
+	return app
+}
+
+// fetch returns the body of path as sent and as read.
+func fetch(t testing.TB, app *fiber.App, path string) (sent int, body string) {
+	request := httptest.NewRequest("GET", path, nil)
+	request.Header.Set(fiber.HeaderAcceptEncoding, "gzip")
+	response, err := app.Test(request)
+	assert.Nil(t, err)
+	raw, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	if response.Header.Get(fiber.HeaderContentEncoding) != "gzip" {
+		return len(raw), string(raw)
+	}
+	reader, err := gzip.NewReader(strings.NewReader(string(raw)))
+	assert.Nil(t, err)
+	plain, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	return len(raw), string(plain)
+}
+
+func TestMinify(t *testing.T) {
+	plainSize, plain := fetch(t, newPageApp(false, false), "/web/orders")
+	minifiedSize, minified := fetch(t, newPageApp(true, false), "/web/orders")
+
+	assert.Less(t, minifiedSize, plainSize)
+	assert.NotContains(t, minified, "<!--")
+	assert.NotContains(t, minified, "// Highlights")
+	assert.Contains(t, minified, "border-collapse:collapse")
+	assert.Contains(t, minified, "<td>42</td>")
+	assert.Contains(t, minified, "</html>")
+	// Preformatted text keeps its whitespace.
+	assert.Contains(t, plain, "  kept   as   it   is")
+	assert.Contains(t, minified, "  kept   as   it   is")
+
+	_, data := fetch(t, newPageApp(true, false), "/web/data")
+	assert.Equal(t, `{"text":"  kept  "}`, data)
+}
+
+func TestMinifyThenCompress(t *testing.T) {
+	minifiedSize, minified := fetch(t, newPageApp(true, false), "/web/orders")
+	compressedSize, body := fetch(t, newPageApp(true, true), "/web/orders")
+	assert.Less(t, compressedSize, minifiedSize)
+	assert.Equal(t, minified, body)
+}
+
+// BenchmarkPage renders a page of orders and reports the bytes sent with
+// minification and compression each switched on and off:
+//
+//	go test ./views -run NONE -bench Page
+func BenchmarkPage(b *testing.B) {
+	for _, bench := range []struct {
+		name                 string
+		minified, compressed bool
+	}{
+		{"plain", false, false},
+		{"minified", true, false},
+		{"compressed", false, true},
+		{"minified+compressed", true, true},
+	} {
+		bench := bench
+		b.Run(bench.name, func(b *testing.B) {
+			app := newPageApp(bench.minified, bench.compressed)
+			var sent int
+			for i := 0; i < b.N; i++ {
+				sent, _ = fetch(b, app, "/web/orders")
+			}
+			b.ReportMetric(float64(sent), "bytes/page")
+		})
+	}
+}
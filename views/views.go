@@ -0,0 +1,56 @@
+package views
+
+import (
+	"html/template"
+	"io"
+	"io/fs"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/sanitize"
+	"github.com/jalal-akbar/belajar-golang-fiber/timezone"
+)
+
+// Engine renders html/template templates for fiber's c.Render. Values are
+// escaped for the context they appear in; the richtext function is the only
+// way to output markup from a value, and it sanitizes it first. Times are
+// shown with localtime and the request's ctxutil.Location. Layouts aren't
+// supported.
+type Engine struct {
+	fsys      fs.FS
+	patterns  []string
+	funcs     template.FuncMap
+	templates *template.Template
+}
+
+func New(fsys fs.FS, patterns ...string) *Engine {
+	return &Engine{fsys: fsys, patterns: patterns, funcs: template.FuncMap{
+		"richtext": func(s string) template.HTML {
+			return template.HTML(sanitize.RichText(s))
+		},
+		"localtime": timezone.Display,
+	}}
+}
+
+// AddFunc makes fn callable from the templates as name. Add functions
+// before the templates are loaded.
+func (e *Engine) AddFunc(name string, fn interface{}) *Engine {
+	e.funcs[name] = fn
+	return e
+}
+
+func (e *Engine) Load() error {
+	templates, err := template.New("").Funcs(e.funcs).ParseFS(e.fsys, e.patterns...)
+	if err != nil {
+		return err
+	}
+	e.templates = templates
+	return nil
+}
+
+func (e *Engine) Render(w io.Writer, name string, binding interface{}, _ ...string) error {
+	if e.templates == nil {
+		if err := e.Load(); err != nil {
+			return err
+		}
+	}
+	return e.templates.ExecuteTemplate(w, name, binding)
+}
@@ -0,0 +1,51 @@
+package views
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderEscapesValues(t *testing.T) {
+	templates := fstest.MapFS{
+		"post.html": {Data: []byte(`<h1 title="{{.Title}}">{{.Title}}</h1>` +
+			`<a href="{{.Link}}">more</a>` +
+			`<script>var title = {{.Title}};</script>` +
+			`<div>{{richtext .Body}}</div>`)},
+	}
+	app := fiber.New(fiber.Config{Views: New(templates, "*.html")})
+	app.Get("/post", func(c *fiber.Ctx) error {
+		return c.Render("post.html", fiber.Map{
+			"Title": `"><script>alert(1)</script>`,
+			"Link":  `javascript:alert(1)`,
+			"Body":  `<p>Hi</p><img src=x onerror=alert(1)>`,
+		})
+	})
+
+	response, err := app.Test(httptest.NewRequest("GET", "/post", nil))
+	assert.Nil(t, err)
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	html := string(body)
+
+	assert.Equal(t, 1, strings.Count(html, "<script>"))
+	assert.NotContains(t, html, `"><script>alert(1)`)
+	assert.NotContains(t, html, `href="javascript:`)
+	assert.NotContains(t, html, "onerror")
+	assert.Contains(t, html, `<p>Hi</p><img src="x">`)
+}
+
+func TestAddFunc(t *testing.T) {
+	templates := fstest.MapFS{"page.html": {Data: []byte(`<link href="{{asset "app.css"}}">`)}}
+	engine := New(templates, "*.html").AddFunc("asset", func(name string) string {
+		return "/static/" + name
+	})
+	var out strings.Builder
+	assert.Nil(t, engine.Render(&out, "page.html", nil))
+	assert.Equal(t, `<link href="/static/app.css">`, out.String())
+}
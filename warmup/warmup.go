@@ -0,0 +1,92 @@
+// Package warmup fills caches in the background when the app starts and
+// reports it ready once they are, so a new instance doesn't take traffic
+// while every lookup misses.
+package warmup
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type task struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Warmup runs its tasks one after another. Failing tasks are logged and
+// don't keep the app from becoming ready: a cold cache is slower, not
+// broken.
+type Warmup struct {
+	timeout time.Duration
+	logger  *slog.Logger
+	tasks   []task
+
+	ready  atomic.Bool
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New gives the tasks timeout to finish in all together, zero for no
+// limit; the app is ready then regardless.
+func New(timeout time.Duration, logger *slog.Logger) *Warmup {
+	return &Warmup{timeout: timeout, logger: logger}
+}
+
+// Add adds a task to run on Start.
+func (w *Warmup) Add(name string, run func(ctx context.Context) error) {
+	w.tasks = append(w.tasks, task{name: name, run: run})
+}
+
+// Start runs the tasks in the background.
+func (w *Warmup) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	if w.timeout > 0 {
+		cancel()
+		ctx, cancel = context.WithTimeout(context.Background(), w.timeout)
+	}
+	w.cancel, w.done = cancel, make(chan struct{})
+	go func() {
+		defer close(w.done)
+		defer cancel()
+		start := time.Now()
+		for _, task := range w.tasks {
+			if err := task.run(ctx); err != nil {
+				w.logger.Warn("warming up failed", slog.String("task", task.name), slog.String("error", err.Error()))
+			}
+		}
+		w.ready.Store(true)
+		w.logger.Info("warmed up", slog.Duration("took", time.Since(start)))
+	}()
+	return nil
+}
+
+// Stop cancels the tasks still running and waits for them to return.
+func (w *Warmup) Stop(ctx context.Context) error {
+	if w.cancel == nil {
+		return nil
+	}
+	w.cancel()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Ready tells whether the tasks are done.
+func (w *Warmup) Ready() bool {
+	return w.ready.Load()
+}
+
+// Handler answers readiness probes: 503 until the tasks are done.
+func (w *Warmup) Handler(c *fiber.Ctx) error {
+	if !w.Ready() {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "warming up")
+	}
+	return c.SendString("ready")
+}
@@ -0,0 +1,65 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jalal-akbar/belajar-golang-fiber/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWarmup(timeout time.Duration) (*Warmup, *fiber.App) {
+	w := New(timeout, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	app := fiber.New()
+	app.Get("/readyz", w.Handler)
+	return w, app
+}
+
+func TestReadyOnceWarm(t *testing.T) {
+	w, app := newWarmup(time.Second)
+	release := make(chan struct{})
+	var ran []string
+	w.Add("failing", func(ctx context.Context) error {
+		ran = append(ran, "failing")
+		return errors.New("unreachable")
+	})
+	w.Add("slow", func(ctx context.Context) error {
+		<-release
+		ran = append(ran, "slow")
+		return nil
+	})
+
+	assert.Nil(t, w.Start(context.Background()))
+	testkit.Do(t, app, "GET", "/readyz", nil).AssertStatus(503)
+
+	// A failing task doesn't keep the app from becoming ready.
+	close(release)
+	assert.Eventually(t, w.Ready, time.Second, time.Millisecond)
+	testkit.Do(t, app, "GET", "/readyz", nil).AssertStatus(200).AssertBody("ready")
+	assert.Equal(t, []string{"failing", "slow"}, ran)
+	assert.Nil(t, w.Stop(context.Background()))
+}
+
+func TestTimeoutAndStop(t *testing.T) {
+	w, _ := newWarmup(10 * time.Millisecond)
+	w.Add("stuck", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.Nil(t, w.Start(context.Background()))
+	assert.Eventually(t, w.Ready, time.Second, time.Millisecond)
+
+	w, _ = newWarmup(0)
+	w.Add("stuck", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.Nil(t, w.Start(context.Background()))
+	assert.Nil(t, w.Stop(context.Background()))
+	assert.True(t, w.Ready())
+}
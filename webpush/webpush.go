@@ -0,0 +1,230 @@
+// Package webpush sends Web Push messages (RFC 8030) to browsers, with
+// payloads encrypted for the subscription (RFC 8291) and the app
+// identified by its VAPID key (RFC 8292).
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"golang.org/x/crypto/hkdf"
+)
+
+// recordSize is the size of the one record a payload is encrypted in,
+// which bounds the payload.
+const recordSize = 4096
+
+var (
+	// ErrGone is returned for subscriptions the push service no longer
+	// knows, which should be forgotten.
+	ErrGone = errors.New("webpush: subscription gone")
+	// ErrTooLarge is returned for payloads that don't fit a record.
+	ErrTooLarge = errors.New("webpush: payload too large")
+)
+
+// Subscription is what a browser's PushSubscription.toJSON() returns.
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// Sender pushes messages as the app whose VAPID key is configured.
+type Sender struct {
+	cfg    config.WebPushConfig
+	client *httpclient.Client
+	key    *ecdsa.PrivateKey
+	public []byte
+	now    func() time.Time
+}
+
+func New(cfg config.WebPushConfig, client *httpclient.Client) (*Sender, error) {
+	d, err := decode(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: private_key: %w", err)
+	}
+	private, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: private_key: %w", err)
+	}
+	public := private.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}
+	return &Sender{cfg: cfg, client: client, key: key, public: public, now: time.Now}, nil
+}
+
+// GenerateKey returns a new VAPID private key for the config, and its
+// public key.
+func GenerateKey() (private, public string, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return encode(key.Bytes()), encode(key.PublicKey().Bytes()), nil
+}
+
+// PublicKey is the applicationServerKey browsers subscribe with.
+func (s *Sender) PublicKey() string {
+	return encode(s.public)
+}
+
+// Valid checks that subscription has keys Send can encrypt for and an
+// https endpoint.
+func Valid(subscription Subscription) error {
+	endpoint, err := url.Parse(subscription.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return errors.New("endpoint must be an https URL")
+	}
+	public, err := decode(subscription.Keys.P256dh)
+	if err == nil {
+		_, err = ecdh.P256().NewPublicKey(public)
+	}
+	if err != nil {
+		return errors.New("keys.p256dh must be a P-256 public key")
+	}
+	if secret, err := decode(subscription.Keys.Auth); err != nil || len(secret) != 16 {
+		return errors.New("keys.auth must be 16 bytes")
+	}
+	return nil
+}
+
+// Send pushes payload to subscription. The push service keeps it for the
+// configured TTL while the browser is offline.
+func (s *Sender) Send(ctx context.Context, subscription Subscription, payload []byte) error {
+	if err := Valid(subscription); err != nil {
+		return fmt.Errorf("webpush: %w", err)
+	}
+	body, err := encrypt(subscription, payload)
+	if err != nil {
+		return err
+	}
+	endpoint, _ := url.Parse(subscription.Endpoint)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{endpoint.Scheme + "://" + endpoint.Host},
+		ExpiresAt: jwt.NewNumericDate(s.now().Add(12 * time.Hour)),
+		Subject:   s.cfg.Subject,
+	}).SignedString(s.key)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "vapid t="+token+", k="+s.PublicKey())
+	request.Header.Set("Content-Encoding", "aes128gcm")
+	request.Header.Set("Content-Type", "application/octet-stream")
+	request.Header.Set("TTL", strconv.Itoa(int(s.cfg.TTL.Seconds())))
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	switch {
+	case response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusGone:
+		return ErrGone
+	case response.StatusCode >= 300:
+		return fmt.Errorf("webpush: push service returned %s", response.Status)
+	}
+	return nil
+}
+
+// encrypt encrypts payload for subscription in a single aes128gcm record,
+// keyed with a new ephemeral key as RFC 8291 describes.
+func encrypt(subscription Subscription, payload []byte) ([]byte, error) {
+	if len(payload)+1+16 > recordSize {
+		return nil, ErrTooLarge
+	}
+	uaPublic, _ := decode(subscription.Keys.P256dh)
+	authSecret, _ := decode(subscription.Keys.Auth)
+	peer, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := ephemeral.PublicKey().Bytes()
+
+	info := append(append([]byte("WebPush: info\x00"), uaPublic...), asPublic...)
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, authSecret, info), ikm); err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// The header: salt, record size, and the ephemeral public key as the
+	// key id. The record ends with the last-record delimiter.
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+	record := append(append(make([]byte, 0, len(payload)+1), payload...), 2)
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decode reads base64url, which browsers and VAPID tools emit with or
+// without padding.
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
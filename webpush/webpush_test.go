@@ -0,0 +1,141 @@
+package webpush
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/httpclient"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/hkdf"
+)
+
+// browser is the user agent end of a subscription.
+type browser struct {
+	key    *ecdh.PrivateKey
+	secret []byte
+}
+
+func newBrowser(t *testing.T, endpoint string) (*browser, Subscription) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	b := &browser{key: key, secret: make([]byte, 16)}
+	rand.Read(b.secret)
+	var subscription Subscription
+	subscription.Endpoint = endpoint
+	subscription.Keys.P256dh = encode(key.PublicKey().Bytes())
+	subscription.Keys.Auth = encode(b.secret)
+	return b, subscription
+}
+
+// decrypt undoes encrypt as RFC 8291 has browsers do.
+func (b *browser) decrypt(t *testing.T, body []byte) string {
+	salt, rs, idlen := body[:16], binary.BigEndian.Uint32(body[16:20]), int(body[20])
+	assert.Equal(t, uint32(recordSize), rs)
+	asPublic, ciphertext := body[21:21+idlen], body[21+idlen:]
+	peer, err := ecdh.P256().NewPublicKey(asPublic)
+	assert.Nil(t, err)
+	shared, err := b.key.ECDH(peer)
+	assert.Nil(t, err)
+
+	read := func(secret, salt []byte, info string, n int) []byte {
+		out := make([]byte, n)
+		_, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), out)
+		assert.Nil(t, err)
+		return out
+	}
+	ikm := read(shared, b.secret, "WebPush: info\x00"+string(b.key.PublicKey().Bytes())+string(asPublic), 32)
+	block, err := aes.NewCipher(read(ikm, salt, "Content-Encoding: aes128gcm\x00", 16))
+	assert.Nil(t, err)
+	gcm, err := cipher.NewGCM(block)
+	assert.Nil(t, err)
+	plaintext, err := gcm.Open(nil, read(ikm, salt, "Content-Encoding: nonce\x00", 12), ciphertext, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(2), plaintext[len(plaintext)-1])
+	return string(plaintext[:len(plaintext)-1])
+}
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func TestSend(t *testing.T) {
+	var mu sync.Mutex
+	var requests []received
+	status := http.StatusCreated
+	service := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, received{r.Header.Clone(), body})
+		w.WriteHeader(status)
+	}))
+	defer service.Close()
+	transport := http.DefaultTransport
+	http.DefaultTransport = service.Client().Transport
+	defer func() { http.DefaultTransport = transport }()
+
+	private, public, err := GenerateKey()
+	assert.Nil(t, err)
+	sender, err := New(config.WebPushConfig{PrivateKey: private, Subject: "mailto:ops@example.com", TTL: time.Hour}, httpclient.New(config.Default().HTTPClient))
+	assert.Nil(t, err)
+	assert.Equal(t, public, sender.PublicKey())
+
+	b, subscription := newBrowser(t, service.URL+"/push/abc")
+	assert.Nil(t, sender.Send(context.Background(), subscription, []byte(`{"title":"Order 7 shipped"}`)))
+
+	mu.Lock()
+	assert.Len(t, requests, 1)
+	request := requests[0]
+	status = http.StatusGone
+	mu.Unlock()
+	assert.Equal(t, "aes128gcm", request.header.Get("Content-Encoding"))
+	assert.Equal(t, "3600", request.header.Get("TTL"))
+	assert.Equal(t, `{"title":"Order 7 shipped"}`, b.decrypt(t, request.body))
+
+	vapid, ok := strings.CutPrefix(request.header.Get("Authorization"), "vapid t=")
+	assert.True(t, ok)
+	token, k, _ := strings.Cut(vapid, ", k=")
+	assert.Equal(t, public, k)
+	claims := &jwt.RegisteredClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return &sender.key.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience(service.URL))
+	assert.Nil(t, err)
+	assert.Equal(t, "mailto:ops@example.com", claims.Subject)
+
+	assert.ErrorIs(t, sender.Send(context.Background(), subscription, []byte("{}")), ErrGone)
+	assert.ErrorIs(t, sender.Send(context.Background(), subscription, make([]byte, recordSize)), ErrTooLarge)
+}
+
+func TestValid(t *testing.T) {
+	_, subscription := newBrowser(t, "https://push.example.com/abc")
+	assert.Nil(t, Valid(subscription))
+
+	insecure := subscription
+	insecure.Endpoint = "http://push.example.com/abc"
+	assert.NotNil(t, Valid(insecure))
+	noKey := subscription
+	noKey.Keys.P256dh = "bm90IGEga2V5"
+	assert.NotNil(t, Valid(noKey))
+	shortAuth := subscription
+	shortAuth.Keys.Auth = "c2hvcnQ"
+	assert.NotNil(t, Valid(shortAuth))
+
+	_, err := New(config.WebPushConfig{PrivateKey: "not a key"}, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,135 @@
+// Package welcome mails new users a welcome, in their language, from the
+// job queue rather than from the request that created their account.
+package welcome
+
+import (
+	"context"
+	"embed"
+	"log/slog"
+	netmail "net/mail"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/jobs"
+	"github.com/jalal-akbar/belajar-golang-fiber/mail"
+	"github.com/jalal-akbar/belajar-golang-fiber/users"
+)
+
+// JobWelcome is the type of the jobs that send the welcome.
+const JobWelcome = "welcome"
+
+// DefaultLocale is the language of the welcome when the user accepts none
+// of the others.
+const DefaultLocale = "en"
+
+// templates holds a <locale>.tmpl per language, each defining a subject
+// and a body.
+//
+//go:embed templates
+var templates embed.FS
+
+// Welcome sends the welcome. Addresses come from address, which may know
+// a confirmed one, or else from the user ID when it is an address itself,
+// as with logins whose user claim is the email. Users without either are
+// skipped.
+type Welcome struct {
+	url     string
+	sender  mail.Sender
+	address func(ctx context.Context, userID string) (string, bool, error)
+	logger  *slog.Logger
+	locales map[string]*template.Template
+}
+
+// New links the welcome to url and sends it through sender.
+func New(url string, sender mail.Sender, address func(ctx context.Context, userID string) (string, bool, error), logger *slog.Logger) *Welcome {
+	w := &Welcome{url: url, sender: sender, address: address, logger: logger, locales: map[string]*template.Template{}}
+	files, _ := templates.ReadDir("templates")
+	for _, file := range files {
+		locale := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
+		w.locales[locale] = template.Must(template.ParseFS(templates, "templates/"+file.Name()))
+	}
+	return w
+}
+
+// Register has queue send the welcome for every user registered on bus.
+func (w *Welcome) Register(bus *events.Bus, queue *jobs.Queue) {
+	queue.Handle(JobWelcome, w.send)
+	bus.Subscribe(users.EventRegistered, func(ctx context.Context, event events.Event) {
+		err := queue.Enqueue(ctx, JobWelcome, map[string]string{
+			"user":   event.UserID,
+			"locale": w.locale(event.Data["accept_language"]),
+		})
+		if err != nil {
+			w.logger.ErrorContext(ctx, "queueing welcome failed", slog.String("error", err.Error()))
+		}
+	})
+}
+
+func (w *Welcome) send(ctx context.Context, job jobs.Job) error {
+	userID := job.Payload["user"]
+	to, ok := "", false
+	if w.address != nil {
+		var err error
+		if to, ok, err = w.address(ctx, userID); err != nil {
+			return err
+		}
+	}
+	if !ok {
+		if parsed, err := netmail.ParseAddress(userID); err == nil && parsed.Address == userID {
+			to, ok = userID, true
+		}
+	}
+	if !ok {
+		w.logger.DebugContext(ctx, "no address to welcome user", slog.String("user", userID))
+		return nil
+	}
+
+	locale, ok := w.locales[job.Payload["locale"]]
+	if !ok {
+		locale = w.locales[DefaultLocale]
+	}
+	data := map[string]string{"User": userID, "URL": w.url}
+	var subject, body strings.Builder
+	if err := locale.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return err
+	}
+	if err := locale.ExecuteTemplate(&body, "body", data); err != nil {
+		return err
+	}
+	return w.sender.Send(ctx, mail.Message{To: to, Subject: subject.String(), Body: strings.TrimLeft(body.String(), "\n")})
+}
+
+// locale picks the language of the welcome from an Accept-Language
+// header: the one with the highest quality that has a template, by its
+// primary subtag, so "id-ID" picks "id".
+func (w *Welcome) locale(acceptLanguage string) string {
+	type choice struct {
+		locale  string
+		quality float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, ok := w.locales[primary]; ok && quality > 0 {
+			choices = append(choices, choice{primary, quality})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].quality > choices[j].quality })
+	if len(choices) == 0 {
+		return DefaultLocale
+	}
+	return choices[0].locale
+}
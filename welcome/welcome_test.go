@@ -0,0 +1,89 @@
+package welcome
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/events"
+	"github.com/jalal-akbar/belajar-golang-fiber/jobs"
+	"github.com/jalal-akbar/belajar-golang-fiber/mail"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/users"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (r *recorder) Send(_ context.Context, message mail.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, message)
+	return nil
+}
+
+func (r *recorder) messages() []mail.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]mail.Message{}, r.sent...)
+}
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestLocale(t *testing.T) {
+	w := New("https://example.com", &recorder{}, nil, discard)
+	for header, want := range map[string]string{
+		"":                    "en",
+		"id-ID,en;q=0.5":      "id",
+		"en;q=0.4, id;q=0.9":  "id",
+		"fr-FR, en-GB;q=0.8":  "en",
+		"fr":                  "en",
+		"id;q=0, en;q=0.1":    "en",
+		"ID":                  "id",
+		"id;q=bogus, en;q=.2": "en",
+	} {
+		assert.Equal(t, want, w.locale(header), header)
+	}
+}
+
+func TestWelcome(t *testing.T) {
+	sent := &recorder{}
+	addresses := map[string]string{"u-1": "budi@example.com"}
+	w := New("https://example.com/start", sent, func(_ context.Context, userID string) (string, bool, error) {
+		address, ok := addresses[userID]
+		return address, ok, nil
+	}, discard)
+	queue := jobs.New(config.Default().Jobs, discard, metrics.NewRegistry())
+	bus := events.NewBus()
+	w.Register(bus, queue)
+	queue.Start()
+	defer queue.Stop()
+
+	ctx := context.Background()
+	bus.Publish(ctx, events.Event{Type: users.EventRegistered, UserID: "u-1", Data: map[string]string{"accept_language": "id-ID,id;q=0.9"}})
+	bus.Publish(ctx, events.Event{Type: users.EventRegistered, UserID: "ann@example.com"})
+	// Neither a known address nor an address itself.
+	bus.Publish(ctx, events.Event{Type: users.EventRegistered, UserID: "github|42"})
+
+	assert.Eventually(t, func() bool {
+		return queue.Backlog().Pending == 0 && len(sent.messages()) == 2
+	}, 5*time.Second, 5*time.Millisecond)
+	messages := sent.messages()
+	if messages[0].To != "budi@example.com" {
+		messages[0], messages[1] = messages[1], messages[0]
+	}
+	assert.Equal(t, "budi@example.com", messages[0].To)
+	assert.Equal(t, "Selamat datang", messages[0].Subject)
+	assert.Contains(t, messages[0].Body, "Halo u-1,")
+	assert.Contains(t, messages[0].Body, "https://example.com/start")
+	assert.Equal(t, "ann@example.com", messages[1].To)
+	assert.Contains(t, messages[1].Body, "https://example.com/start")
+	assert.NotEqual(t, "Selamat datang", messages[1].Subject)
+}
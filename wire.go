@@ -0,0 +1,27 @@
+//go:build wireinject
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/jalal-akbar/belajar-golang-fiber/config"
+	"github.com/jalal-akbar/belajar-golang-fiber/lifecycle"
+	"github.com/jalal-akbar/belajar-golang-fiber/metrics"
+	"github.com/jalal-akbar/belajar-golang-fiber/pools"
+)
+
+// newBackends picks the backends cfg asks for. Wire generates it into
+// wire_gen.go; run "go generate" after changing the providers.
+func newBackends(cfg *config.Config, hooks *lifecycle.Lifecycle, connectionPools *pools.Pools, logger *slog.Logger, registry *metrics.Registry) *backends {
+	wire.Build(
+		wire.FieldsOf(new(*config.Config), "Redis", "Cache"),
+		provideRedis,
+		provideRedisGuard,
+		provideUsageStore,
+		provideCacheStore,
+		wire.Struct(new(backends), "*"),
+	)
+	return nil
+}